@@ -12,10 +12,12 @@ import (
 	"gopkg.in/src-d/go-git.v3/diff"
 )
 
+// Blame is the result of blaming a file, the commit that introduced each of
+// its lines, see Commit.Blame.
 type Blame struct {
 	Path  string
 	Rev   core.Hash
-	Lines []*line
+	Lines []*BlameLine
 }
 
 // Blame returns the last commit that modified each line of a file in a
@@ -87,7 +89,7 @@ func (c *Commit) Blame(path string) (*Blame, error) {
 		return nil, err
 	}
 
-	lines, err := newLines(finalLines, b.sliceGraph(len(b.graph)-1))
+	lines, err := newLines(finalLines, b.graph[len(b.graph)-1])
 	if err != nil {
 		return nil, err
 	}
@@ -99,38 +101,72 @@ func (c *Commit) Blame(path string) (*Blame, error) {
 	}, nil
 }
 
-type line struct {
-	author string
-	text   string
+// BlameLine is a line of a blamed file.
+type BlameLine struct {
+	// Hash is the hash of the commit that introduced the line
+	Hash core.Hash
+	// Author is the email of the author of that commit
+	Author string
+	// Text is the content of the line, without its end of line
+	Text string
+	// OriginalLine is the number of the line, starting at 1, in the
+	// version of the file of the commit that introduced it
+	OriginalLine int
 }
 
-func newLine(author, text string) *line {
-	return &line{
-		author: author,
-		text:   text,
-	}
-}
-
-func newLines(contents []string, commits []*Commit) ([]*line, error) {
-	if len(contents) != len(commits) {
+func newLines(contents []string, origins []blameOrigin) ([]*BlameLine, error) {
+	if len(contents) != len(origins) {
 		return nil, errors.New("contents and commits have different length")
 	}
-	result := make([]*line, 0, len(contents))
+	result := make([]*BlameLine, 0, len(contents))
 	for i := range contents {
-		l := newLine(commits[i].Author.Email, contents[i])
-		result = append(result, l)
+		result = append(result, &BlameLine{
+			Hash:         origins[i].commit.Hash,
+			Author:       origins[i].commit.Author.Email,
+			Text:         contents[i],
+			OriginalLine: origins[i].line,
+		})
 	}
 	return result, nil
 }
 
+// String returns the blame in a format similar to the one of git blame
+// --porcelain: for each line, the hash of its commit, the original and final
+// line numbers, the author and the file name the first time each commit is
+// shown, and the contents of the line prefixed by a tab.
+func (b *Blame) String() string {
+	var buf bytes.Buffer
+
+	seen := make(map[core.Hash]bool, 0)
+	for i, l := range b.Lines {
+		fmt.Fprintf(&buf, "%s %d %d\n", l.Hash, l.OriginalLine, i+1)
+		if !seen[l.Hash] {
+			seen[l.Hash] = true
+			fmt.Fprintf(&buf, "author-mail <%s>\n", l.Author)
+			fmt.Fprintf(&buf, "filename %s\n", b.Path)
+		}
+
+		fmt.Fprintf(&buf, "\t%s\n", l.Text)
+	}
+
+	return buf.String()
+}
+
+// blameOrigin is the commit that introduced a line and the number of the
+// line in that commit.
+type blameOrigin struct {
+	commit *Commit
+	line   int
+}
+
 // this struct is internally used by the blame function to hold its
 // inputs, outputs and state.
 type blame struct {
-	path  string      // the path of the file to blame
-	fRev  *Commit     // the commit of the final revision of the file to blame
-	revs  []*Commit   // the chain of revisions affecting the the file to blame
-	data  []string    // the contents of the file across all its revisions
-	graph [][]*Commit // the graph of the lines in the file across all the revisions TODO: not all commits are needed, only the current rev and the prev
+	path  string          // the path of the file to blame
+	fRev  *Commit         // the commit of the final revision of the file to blame
+	revs  []*Commit       // the chain of revisions affecting the the file to blame
+	data  []string        // the contents of the file across all its revisions
+	graph [][]blameOrigin // the graph of the lines in the file across all the revisions TODO: not all commits are needed, only the current rev and the prev
 }
 
 // calculte the history of a file "path", starting from commit "from", sorted by commit date.
@@ -146,7 +182,7 @@ func (b *blame) fillRevs() error {
 
 // build graph of a file from its revision history
 func (b *blame) fillGraphAndData() error {
-	b.graph = make([][]*Commit, len(b.revs))
+	b.graph = make([][]blameOrigin, len(b.revs))
 	b.data = make([]string, len(b.revs)) // file contents in all the revisions
 	// for every revision of the file, starting with the first
 	// one...
@@ -162,13 +198,13 @@ func (b *blame) fillGraphAndData() error {
 		}
 		nLines := countLines(b.data[i])
 		// create a node for each line
-		b.graph[i] = make([]*Commit, nLines)
+		b.graph[i] = make([]blameOrigin, nLines)
 		// assign a commit to each node
 		// if this is the first revision, then the node is assigned to
 		// this first commit.
 		if i == 0 {
 			for j := 0; j < nLines; j++ {
-				b.graph[i][j] = (*Commit)(b.revs[i])
+				b.graph[i][j] = blameOrigin{b.revs[i], j + 1}
 			}
 		} else {
 			// if this is not the first commit, then assign to the old
@@ -180,18 +216,6 @@ func (b *blame) fillGraphAndData() error {
 	return nil
 }
 
-// sliceGraph returns a slice of commits (one per line) for a particular
-// revision of a file (0=first revision).
-func (b *blame) sliceGraph(i int) []*Commit {
-	fVs := b.graph[i]
-	result := make([]*Commit, 0, len(fVs))
-	for _, v := range fVs {
-		c := Commit(*v)
-		result = append(result, &c)
-	}
-	return result
-}
-
 // Assigns origin to vertexes in current (c) rev from data in its previous (p)
 // revision
 func (b *blame) assignOrigin(c, p int) {
@@ -209,7 +233,7 @@ func (b *blame) assignOrigin(c, p int) {
 				b.graph[c][dl] = b.graph[p][sl]
 			case hunks[h].Type == 1:
 				dl++
-				b.graph[c][dl] = (*Commit)(b.revs[c])
+				b.graph[c][dl] = blameOrigin{b.revs[c], dl + 1}
 			case hunks[h].Type == -1:
 				sl++
 			default:
@@ -242,8 +266,8 @@ func (b *blame) GoString() string {
 
 	fVs := b.graph[len(b.graph)-1]
 	for ln, v := range fVs {
-		fmt.Fprintf(&buf, format, v.Hash.String()[:8],
-			prettyPrintAuthor(fVs[ln]), ln+1, lines[ln])
+		fmt.Fprintf(&buf, format, v.commit.Hash.String()[:8],
+			prettyPrintAuthor(fVs[ln].commit), ln+1, lines[ln])
 	}
 	return buf.String()
 }
@@ -260,11 +284,11 @@ func (b *blame) maxAuthorLength() int {
 	fVs := b.graph[len(b.graph)-1]
 	m := 0
 	for ln := range fVs {
-		if _, ok := memo[fVs[ln].Hash]; ok {
+		if _, ok := memo[fVs[ln].commit.Hash]; ok {
 			continue
 		}
-		memo[fVs[ln].Hash] = struct{}{}
-		m = max(m, utf8.RuneCountInString(prettyPrintAuthor(fVs[ln])))
+		memo[fVs[ln].commit.Hash] = struct{}{}
+		m = max(m, utf8.RuneCountInString(prettyPrintAuthor(fVs[ln].commit)))
 	}
 	return m
 }
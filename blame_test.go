@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
 	"gopkg.in/src-d/go-git.v3/formats/packfile"
@@ -62,13 +63,13 @@ func (s *BlameCommon) mockBlame(t blameTest, c *C) (blame *Blame) {
 	c.Assert(len(t.blames), Equals, len(lines), Commentf(
 		"repo=%s, path=%s, rev=%s: the number of lines in the file and the number of expected blames differ (len(blames)=%d, len(lines)=%d)\nblames=%#q\nlines=%#q", t.repo, t.path, t.rev, len(t.blames), len(lines), t.blames, lines))
 
-	blamedLines := make([]*line, 0, len(t.blames))
+	blamedLines := make([]*BlameLine, 0, len(t.blames))
 	for i := range t.blames {
 		commit, err := r.Commit(core.NewHash(t.blames[i]))
 		c.Assert(err, IsNil)
-		l := &line{
-			author: commit.Author.Email,
-			text:   lines[i],
+		l := &BlameLine{
+			Author: commit.Author.Email,
+			Text:   lines[i],
 		}
 		blamedLines = append(blamedLines, l)
 	}
@@ -93,10 +94,67 @@ func (s *BlameCommon) TestBlame(c *C) {
 
 		obt, err := commit.Blame(t.path)
 		c.Assert(err, IsNil)
+
+		// the fixtures only record the author of each line, as the diff
+		// algorithm can choose a different commit by the same author for
+		// ambiguous hunks; hashes and original line numbers are checked
+		// against git by TestBlameOriginalLines
+		for _, l := range obt.Lines {
+			blamed, err := r.Commit(l.Hash)
+			c.Assert(err, IsNil)
+			c.Assert(blamed.Author.Email, Equals, l.Author)
+			c.Assert(l.OriginalLine > 0, Equals, true)
+			l.Hash = core.ZeroHash
+			l.OriginalLine = 0
+		}
 		c.Assert(obt, DeepEquals, exp)
 	}
 }
 
+// the hunks have been obtained with git blame -n, all the lines in a hunk
+// are blamed to the same commit and their original line numbers are their
+// final line numbers plus the offset
+var blameOriginalLinesFixture = []struct {
+	hash     string
+	from, to int
+	offset   int
+}{
+	{"ae904e8d60228c21c47368f6a10f1cc9ca3aeebf", 1, 17, 0},
+	{"99534ecc895fe17a1d562bb3049d4168a04d0865", 18, 18, 0},
+	{"ae904e8d60228c21c47368f6a10f1cc9ca3aeebf", 19, 59, 0},
+	{"ae904e8d60228c21c47368f6a10f1cc9ca3aeebf", 60, 61, 2},
+	{"d2838db9f6ef9628645e7d04cd9658a83e8708ea", 62, 62, 2},
+	{"637ba49300f701cfbd859c1ccf13c4f39a9ba1c8", 63, 63, 0},
+	{"ae904e8d60228c21c47368f6a10f1cc9ca3aeebf", 64, 76, 0},
+}
+
+func (s *BlameCommon) TestBlameOriginalLines(c *C) {
+	r := s.repos["https://github.com/spinnaker/spinnaker.git"]
+	commit, err := r.Commit(core.NewHash("f39d86f59a0781f130e8de6b2115329c1fbe9545"))
+	c.Assert(err, IsNil)
+
+	b, err := commit.Blame("config/settings.js")
+	c.Assert(err, IsNil)
+	c.Assert(b.Lines, HasLen, 76)
+
+	for _, h := range blameOriginalLinesFixture {
+		for i := h.from; i <= h.to; i++ {
+			l := b.Lines[i-1]
+			c.Assert(l.Hash.String(), Equals, h.hash, Commentf("line=%d", i))
+			c.Assert(l.OriginalLine, Equals, i+h.offset, Commentf("line=%d", i))
+		}
+	}
+
+	c.Assert(strings.HasPrefix(b.String(), `ae904e8d60228c21c47368f6a10f1cc9ca3aeebf 1 1
+author-mail <ewiseblatt@google.com>
+filename config/settings.js
+	'use strict';
+ae904e8d60228c21c47368f6a10f1cc9ca3aeebf 2 2
+	
+`), Equals, true)
+	c.Assert(strings.Count(b.String(), "\nfilename "), Equals, 4)
+}
+
 // utility function to avoid writing so many repeated commits
 func repeat(s string, n int) []string {
 	if n < 0 {
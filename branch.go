@@ -0,0 +1,242 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/config"
+)
+
+const (
+	branchSection = "branch"
+	branchPrefix  = "refs/heads/"
+	// localRemote is the remote of the upstreams that are local branches.
+	localRemote = "."
+)
+
+var (
+	// ErrBranchExists is returned by CreateBranch when the branch already
+	// exists and it is not forced.
+	ErrBranchExists = errors.New("branch already exists")
+	// ErrNoUpstream is returned by Upstream when the branch has no
+	// upstream.
+	ErrNoUpstream = errors.New("branch has no upstream")
+	// ErrUpstreamNotTracked is returned by Upstream when the upstream branch
+	// is not matched by the fetch refspecs of its remote, so it is not
+	// stored as a remote-tracking branch.
+	ErrUpstreamNotTracked = errors.New("upstream is not stored as a remote-tracking branch")
+	// ErrIncompleteUpstream is returned by CreateBranch when the upstream
+	// of the branch has a remote and no branch, or the other way around.
+	ErrIncompleteUpstream = errors.New("upstream requires a remote and a branch")
+)
+
+// BranchConfig is the config of a branch, its branch section of the config
+// of the repository, with its upstream, the branch it tracks.
+type BranchConfig struct {
+	// Name is the short name of the branch, "master" for
+	// refs/heads/master.
+	Name string
+	// Remote is the name of the remote of the upstream, "." if the upstream
+	// is a local branch, or empty if the branch has no upstream.
+	Remote string
+	// Merge is the full name of the upstream in its remote, as
+	// "refs/heads/master".
+	Merge core.ReferenceName
+}
+
+// Validate returns core.ErrInvalidReferenceName if the name of the branch or
+// its upstream is not valid, see core.ReferenceName.Valid, and
+// ErrIncompleteUpstream if it has a Remote without Merge, or a Merge
+// without Remote.
+func (c *BranchConfig) Validate() error {
+	if !branchName(c.Name).Valid() || c.Merge != "" && !c.Merge.Valid() {
+		return core.ErrInvalidReferenceName
+	}
+
+	if (c.Remote == "") != (c.Merge == "") {
+		return ErrIncompleteUpstream
+	}
+
+	return nil
+}
+
+func branchName(name string) core.ReferenceName {
+	return core.ReferenceName(branchPrefix + name)
+}
+
+// readBranchConfig returns the config of the branch with the given short
+// name in cfg, without upstream if it has no branch section.
+func readBranchConfig(cfg *config.Config, name string) *BranchConfig {
+	return &BranchConfig{
+		Name:   name,
+		Remote: cfg.String(branchSection, name, "remote"),
+		Merge:  core.ReferenceName(cfg.String(branchSection, name, "merge")),
+	}
+}
+
+// write replaces the branch section of the branch in cfg, which is removed
+// if the branch has no upstream.
+func (c *BranchConfig) write(cfg *config.Config) {
+	cfg.RemoveSection(branchSection, c.Name)
+	if c.Remote == "" {
+		return
+	}
+
+	cfg.Set(branchSection, c.Name, "remote", c.Remote)
+	cfg.Set(branchSection, c.Name, "merge", c.Merge.String())
+}
+
+// Branch returns the config of the branch with the given short name, like
+// "master", core.ErrReferenceNotFound is returned if there is no such
+// branch. Its Remote is empty if it has no upstream.
+func (r *Repository) Branch(name string) (*BranchConfig, error) {
+	if _, err := r.References.Get(branchName(name)); err != nil {
+		return nil, err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return readBranchConfig(cfg, name), nil
+}
+
+// CreateBranchOptions are the options of CreateBranch.
+type CreateBranchOptions struct {
+	// Committer is the signature of the entry appended to the reflog of the
+	// branch, at the current time if its When is zero.
+	Committer Signature
+	// Force replaces the branch, and its config, if it already exists.
+	Force bool
+}
+
+func (o *CreateBranchOptions) committer() Signature {
+	var s Signature
+	if o != nil {
+		s = o.Committer
+	}
+
+	if s.When.IsZero() {
+		s.When = time.Now()
+	}
+
+	return s
+}
+
+// CreateBranch creates the branch with the config c, refs/heads/<name>,
+// pointing to the commit with the given hash, and writes its upstream to
+// the config of the repository, returning its reference.
+//
+// The config is validated first, see BranchConfig.Validate,
+// ErrObjectNotFound is returned if the commit is not in the repository and
+// ErrBranchExists if the branch already exists, unless the options force
+// it.
+func (r *Repository) CreateBranch(c *BranchConfig, target core.Hash, opts *CreateBranchOptions) (*core.Reference, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Commit(target); err != nil {
+		return nil, err
+	}
+
+	n := branchName(c.Name)
+	var old *core.Reference
+	if opts != nil && opts.Force {
+		var err error
+		old, err = r.References.Get(n)
+		if err != nil && err != core.ErrReferenceNotFound {
+			return nil, err
+		}
+	}
+
+	ref := core.NewHashReference(n, target)
+	err := r.UpdateReference(ref, old, opts.committer(), fmt.Sprintf("branch: Created from %s", target))
+	if err == core.ErrReferenceHasChanged && old == nil {
+		return nil, ErrBranchExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c.write(cfg)
+	if err := r.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return ref, nil
+}
+
+// DeleteBranch removes the branch with the given name, refs/heads/<name>,
+// along with its branch section of the config, core.ErrReferenceNotFound is
+// returned if there is no such branch.
+func (r *Repository) DeleteBranch(name string) error {
+	if err := r.References.Remove(branchName(name)); err != nil {
+		return err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.HasSection(branchSection, name) {
+		return nil
+	}
+
+	cfg.RemoveSection(branchSection, name)
+	return r.SetConfig(cfg)
+}
+
+// Upstream returns the name of the reference of the upstream of the given
+// branch, a full name, as git rev-parse <branch>@{upstream} does: the
+// remote-tracking branch the upstream is fetched to, given by the fetch
+// refspecs of its remote, see Remote, or the upstream itself if it is a
+// local branch.
+//
+// ErrNoUpstream is returned if the branch has no upstream,
+// ErrUpstreamNotTracked if no refspec of its remote matches it, and a
+// *ErrRemoteNotFound if its remote does not exist.
+func (r *Repository) Upstream(branch core.ReferenceName) (core.ReferenceName, error) {
+	if !strings.HasPrefix(branch.String(), branchPrefix) {
+		return "", ErrNoUpstream
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimPrefix(branch.String(), branchPrefix)
+	c := readBranchConfig(cfg, name)
+	if c.Remote == "" || c.Merge == "" {
+		return "", ErrNoUpstream
+	}
+
+	if c.Remote == localRemote {
+		return c.Merge, nil
+	}
+
+	remote, err := r.Remote(c.Remote)
+	if err != nil {
+		return "", err
+	}
+
+	for _, s := range remote.fetchRefSpecs(c.Remote) {
+		if dst := s.Dst(c.Merge); s.Match(c.Merge) && dst != "" {
+			return dst, nil
+		}
+	}
+
+	return "", ErrUpstreamNotTracked
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteBranch struct{}
+
+var _ = Suite(&SuiteBranch{})
+
+func (s *SuiteBranch) TestCreateBranch(c *C) {
+	r, head := linearHistory(c, []int64{1, 2})
+
+	ref, err := r.CreateBranch(&BranchConfig{Name: "foo", Remote: "origin", Merge: "refs/heads/master"}, head, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, core.NewHashReference("refs/heads/foo", head))
+
+	_, err = r.CreateBranch(&BranchConfig{Name: "bar"}, head, nil)
+	c.Assert(err, IsNil)
+
+	c.Assert(encodeConfig(c, r), Equals, "[branch \"foo\"]\n"+
+		"\tremote = origin\n"+
+		"\tmerge = refs/heads/master\n")
+
+	b, err := r.Branch("foo")
+	c.Assert(err, IsNil)
+	c.Assert(b, DeepEquals, &BranchConfig{Name: "foo", Remote: "origin", Merge: "refs/heads/master"})
+
+	b, err = r.Branch("bar")
+	c.Assert(err, IsNil)
+	c.Assert(b, DeepEquals, &BranchConfig{Name: "bar"})
+
+	_, err = r.Branch("baz")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	iter, err := r.Reflog("refs/heads/foo")
+	c.Assert(err, IsNil)
+	entry, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(entry.Message, Equals, "branch: Created from "+head.String())
+	iter.Close()
+}
+
+func (s *SuiteBranch) TestCreateBranchErrors(c *C) {
+	r, head := linearHistory(c, []int64{1, 2})
+	_, err := r.CreateBranch(&BranchConfig{Name: "foo"}, head, nil)
+	c.Assert(err, IsNil)
+
+	for _, bc := range []*BranchConfig{
+		{Name: ""},
+		{Name: "a..b"},
+		{Name: "a", Remote: "origin", Merge: "refs/heads/a b"},
+	} {
+		_, err := r.CreateBranch(bc, head, nil)
+		c.Assert(err, Equals, core.ErrInvalidReferenceName, Commentf("name=%s", bc.Name))
+	}
+
+	_, err = r.CreateBranch(&BranchConfig{Name: "a", Remote: "origin"}, head, nil)
+	c.Assert(err, Equals, ErrIncompleteUpstream)
+	_, err = r.CreateBranch(&BranchConfig{Name: "a", Merge: "refs/heads/master"}, head, nil)
+	c.Assert(err, Equals, ErrIncompleteUpstream)
+
+	_, err = r.CreateBranch(&BranchConfig{Name: "a"}, core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), nil)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	_, err = r.CreateBranch(&BranchConfig{Name: "foo"}, head, nil)
+	c.Assert(err, Equals, ErrBranchExists)
+
+	// forced, the branch and its config are replaced
+	commit, err := r.Commit(head)
+	c.Assert(err, IsNil)
+	parent := commit.ParentHashes[0]
+	bc := &BranchConfig{Name: "foo", Remote: ".", Merge: "refs/heads/master"}
+	ref, err := r.CreateBranch(bc, parent, &CreateBranchOptions{Force: true})
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, parent)
+
+	found, err := r.Branch("foo")
+	c.Assert(err, IsNil)
+	c.Assert(found, DeepEquals, bc)
+}
+
+func (s *SuiteBranch) TestDeleteBranch(c *C) {
+	r, head := linearHistory(c, []int64{1})
+	_, err := r.CreateBranch(&BranchConfig{Name: "foo", Remote: "origin", Merge: "refs/heads/foo"}, head, nil)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.DeleteBranch("foo"), IsNil)
+	c.Assert(encodeConfig(c, r), Equals, "")
+	c.Assert(r.DeleteBranch("foo"), Equals, core.ErrReferenceNotFound)
+}
+
+func (s *SuiteBranch) TestUpstream(c *C) {
+	r, head := linearHistory(c, []int64{1})
+	_, err := r.CreateRemote(&RemoteConfig{Name: "origin", URLs: []string{"https://github.com/src-d/go-git.git"}})
+	c.Assert(err, IsNil)
+
+	// a remote with non-default refspecs
+	_, err = r.CreateRemote(&RemoteConfig{
+		Name: "mirror",
+		URLs: []string{"https://github.com/tyba/go-git.git"},
+		Fetch: []core.RefSpec{
+			"+refs/tags/*:refs/tags/*",
+			"+refs/heads/master:refs/mirror/main",
+			"+refs/heads/feature/*:refs/mirror/features/*",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	for name, upstream := range map[string]*BranchConfig{
+		"a": {Remote: "origin", Merge: "refs/heads/master"},
+		"b": {Remote: "mirror", Merge: "refs/heads/master"},
+		"c": {Remote: "mirror", Merge: "refs/heads/feature/x"},
+		"d": {Remote: ".", Merge: "refs/heads/a"},
+		"e": {Remote: "mirror", Merge: "refs/heads/other"},
+		"f": {Remote: "missing", Merge: "refs/heads/master"},
+		"g": {},
+	} {
+		upstream.Name = name
+		_, err := r.CreateBranch(upstream, head, nil)
+		c.Assert(err, IsNil)
+	}
+
+	for branch, expected := range map[core.ReferenceName]core.ReferenceName{
+		"refs/heads/a": "refs/remotes/origin/master",
+		"refs/heads/b": "refs/mirror/main",
+		"refs/heads/c": "refs/mirror/features/x",
+		"refs/heads/d": "refs/heads/a",
+	} {
+		upstream, err := r.Upstream(branch)
+		c.Assert(err, IsNil)
+		c.Assert(upstream, Equals, expected, Commentf("branch=%s", branch))
+	}
+
+	_, err = r.Upstream("refs/heads/e")
+	c.Assert(err, Equals, ErrUpstreamNotTracked)
+	_, err = r.Upstream("refs/heads/f")
+	c.Assert(err, DeepEquals, &ErrRemoteNotFound{Name: "missing"})
+	_, err = r.Upstream("refs/heads/g")
+	c.Assert(err, Equals, ErrNoUpstream)
+	_, err = r.Upstream("refs/tags/v1")
+	c.Assert(err, Equals, ErrNoUpstream)
+}
@@ -0,0 +1,244 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/bundle"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+)
+
+// ErrEmptyBundle is returned by CreateBundle when no reference is given, as
+// git refuses to create an empty bundle.
+var ErrEmptyBundle = errors.New("refusing to create empty bundle")
+
+// ErrMissingPrerequisites is returned fetching from a bundle whose
+// prerequisites, the commits its packfile needs, are not all in the
+// repository.
+type ErrMissingPrerequisites struct {
+	Missing []core.Hash
+}
+
+func (e *ErrMissingPrerequisites) Error() string {
+	missing := make([]string, len(e.Missing))
+	for i, h := range e.Missing {
+		missing[i] = h.String()
+	}
+
+	return fmt.Sprintf("the repository lacks the bundle prerequisites: %s",
+		strings.Join(missing, ", "))
+}
+
+// CreateBundle writes to w a bundle, as git bundle create does, with the
+// given references, resolved, and the objects reachable from them that are
+// not reachable from basis, see missingObjects. The basis are written as the
+// prerequisites of the bundle, the repository reading it must have them.
+//
+// ErrEmptyBundle is returned if no reference is given,
+// core.ErrReferenceNotFound if a reference is not found, and
+// ErrObjectNotFound if a basis is not in the repository.
+func (r *Repository) CreateBundle(w io.Writer, refs []core.ReferenceName, basis []core.Hash) error {
+	if len(refs) == 0 {
+		return ErrEmptyBundle
+	}
+
+	h := &bundle.Header{ObjectFormat: r.ObjectFormat()}
+	wants := make([]core.Hash, 0, len(refs))
+	for _, name := range refs {
+		ref, err := r.Reference(name, true)
+		if err != nil {
+			return err
+		}
+
+		h.References = append(h.References, core.NewHashReference(name, ref.Hash))
+		wants = append(wants, ref.Hash)
+	}
+
+	for _, b := range basis {
+		obj, err := r.Object(b)
+		if err != nil {
+			return err
+		}
+
+		p := bundle.Prerequisite{Hash: b}
+		if commit, ok := obj.(*Commit); ok {
+			p.Comment = strings.SplitN(commit.Message, "\n", 2)[0]
+		}
+
+		h.Prerequisites = append(h.Prerequisites, p)
+	}
+
+	hashes, err := r.missingObjects(wants, basis)
+	if err != nil {
+		return err
+	}
+
+	if _, err := bundle.NewEncoder(w).Encode(h); err != nil {
+		return err
+	}
+
+	e := packfile.NewEncoderWithOptions(r.Storage, packfile.DefaultEncoderOptions)
+	_, err = e.Encode(w, hashes)
+	return err
+}
+
+// BundleSource is a common.GitUploadPackService reading a bundle file, the
+// path of the endpoint it is connected to, so a repository can fetch from
+// a bundle as from any other remote, see NewBundleRemote. Its packfile is
+// sent whole, whatever the objects requested, and the objects of the
+// repository are used as the bases of its deltas.
+type BundleSource struct {
+	path   string
+	header *bundle.Header
+}
+
+// NewBundleSource returns a new BundleSource, not connected.
+func NewBundleSource() *BundleSource {
+	return &BundleSource{}
+}
+
+// NewBundleRemote returns a Remote fetching from the bundle file at the
+// given path, with a BundleSource. The remotes of bundles can not push.
+func NewBundleRemote(path string) *Remote {
+	return &Remote{
+		Endpoint: common.Endpoint(path),
+		upSrv:    NewBundleSource(),
+	}
+}
+
+// Connect reads the header of the bundle at the path of the endpoint.
+func (s *BundleSource) Connect(url common.Endpoint) error {
+	s.path = string(url)
+	f, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// ConnectWithAuth is like Connect, the bundles do not need authentication.
+func (s *BundleSource) ConnectWithAuth(url common.Endpoint, auth common.AuthMethod) error {
+	return s.Connect(url)
+}
+
+// open opens the bundle and reads its header, returning the file along with
+// a reader of the packfile, which is left at its start.
+func (s *BundleSource) open() (*bundleFile, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	d := bundle.NewDecoder(f)
+	h := &bundle.Header{}
+	if err := d.Decode(h); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.header = h
+	return &bundleFile{Reader: d.Packfile(), Closer: f}, nil
+}
+
+type bundleFile struct {
+	io.Reader
+	io.Closer
+}
+
+// Info returns the references of the bundle, as the ones advertised by a
+// remote, with the object-format capability of the bundle, and HEAD as a
+// symbolic reference to the first branch with its hash, if it has HEAD.
+func (s *BundleSource) Info() (*common.GitUploadPackInfo, error) {
+	if s.header == nil {
+		return nil, fmt.Errorf("bundle not connected")
+	}
+
+	info := common.NewGitUploadPackInfo()
+	info.Refs = make(map[string]core.Hash, len(s.header.References))
+	info.Capabilities.Set("object-format", s.header.ObjectFormat.String())
+
+	var branches []string
+	for _, ref := range s.header.References {
+		info.Refs[ref.Name.String()] = ref.Hash
+		if strings.HasPrefix(ref.Name.String(), "refs/heads/") {
+			branches = append(branches, ref.Name.String())
+		}
+	}
+
+	head, ok := info.Refs[core.HEAD.String()]
+	if !ok {
+		return info, nil
+	}
+
+	info.Head = head
+	sort.Strings(branches)
+	for _, name := range branches {
+		if info.Refs[name] == head {
+			info.Capabilities.Add("symref", core.HEAD.String()+":"+name)
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// Fetch returns the packfile of the bundle, the request is not used.
+func (s *BundleSource) Fetch(*common.GitUploadPackRequest) (io.ReadCloser, error) {
+	return s.open()
+}
+
+// Prerequisites returns the hashes of the prerequisites of the bundle, the
+// commits the repository fetching must have.
+func (s *BundleSource) Prerequisites() []core.Hash {
+	if s.header == nil {
+		return nil
+	}
+
+	hashes := make([]core.Hash, len(s.header.Prerequisites))
+	for i, p := range s.header.Prerequisites {
+		hashes[i] = p.Hash
+	}
+
+	return hashes
+}
+
+// prerequisiteService is implemented by the upload-pack services whose
+// packfiles need objects of the repository fetching, like BundleSource.
+type prerequisiteService interface {
+	Prerequisites() []core.Hash
+}
+
+// checkPrerequisites returns a *ErrMissingPrerequisites if the repository
+// does not have every prerequisite of the service of the remote, if it is a
+// prerequisiteService.
+func (r *Repository) checkPrerequisites(remote *Remote) error {
+	s, ok := remote.upSrv.(prerequisiteService)
+	if !ok {
+		return nil
+	}
+
+	var missing []core.Hash
+	for _, h := range s.Prerequisites() {
+		ok, err := r.hasObject(h)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			missing = append(missing, h)
+		}
+	}
+
+	if len(missing) != 0 {
+		return &ErrMissingPrerequisites{Missing: missing}
+	}
+
+	return nil
+}
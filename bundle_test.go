@@ -0,0 +1,141 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+// the bundles of formats/bundle/fixtures/getbundles.bash: full.bundle, with
+// master and the tag v1, its parent, and incremental.bundle, with master
+// and v1 as prerequisite
+const (
+	fullBundle        = "formats/bundle/fixtures/full.bundle"
+	incrementalBundle = "formats/bundle/fixtures/incremental.bundle"
+	bundleMaster      = "c77bd98bad585a118ff5533819aa4d6e6970131e"
+	bundleV1          = "736eb75d252c6de28dd61c15cce503b969012766"
+)
+
+var bundleRefSpecs = []core.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+type SuiteBundle struct{}
+
+var _ = Suite(&SuiteBundle{})
+
+func (s *SuiteBundle) TestFetch(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = NewBundleRemote(fullBundle)
+	c.Assert(r.Fetch(&FetchOptions{RefSpecs: bundleRefSpecs}), IsNil)
+
+	ref, err := r.Reference("refs/heads/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash.String(), Equals, bundleMaster)
+
+	ref, err = r.Reference("refs/tags/v1", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash.String(), Equals, bundleV1)
+
+	commit, err := r.Commit(core.NewHash(bundleMaster))
+	c.Assert(err, IsNil)
+	file, err := commit.File("a")
+	c.Assert(err, IsNil)
+	content, err := file.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "a\n")
+}
+
+func (s *SuiteBundle) TestFetchPrerequisites(c *C) {
+	r := NewPlainRepository()
+	r.Remotes["incremental"] = NewBundleRemote(incrementalBundle)
+	err := r.Fetch(&FetchOptions{RemoteName: "incremental", RefSpecs: bundleRefSpecs})
+	c.Assert(err, DeepEquals, &ErrMissingPrerequisites{Missing: []core.Hash{core.NewHash(bundleV1)}})
+	c.Assert(err.Error(), Equals, "the repository lacks the bundle prerequisites: "+bundleV1)
+
+	r.Remotes["full"] = NewBundleRemote(fullBundle)
+	err = r.Fetch(&FetchOptions{RemoteName: "full", RefSpecs: []core.RefSpec{"refs/tags/v1:refs/tags/v1"}})
+	c.Assert(err, IsNil)
+
+	c.Assert(r.Fetch(&FetchOptions{RemoteName: "incremental", RefSpecs: bundleRefSpecs}), IsNil)
+	ref, err := r.Reference("refs/heads/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash.String(), Equals, bundleMaster)
+
+	_, err = r.Commit(ref.Hash)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteBundle) TestCreateBundle(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = NewBundleRemote(fullBundle)
+	c.Assert(r.Fetch(&FetchOptions{RefSpecs: bundleRefSpecs}), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(r.CreateBundle(&buf, []core.ReferenceName{"refs/heads/master"}, []core.Hash{core.NewHash(bundleV1)}), IsNil)
+
+	// the header is the one written by git
+	expected, err := ioutil.ReadFile(incrementalBundle)
+	c.Assert(err, IsNil)
+	header := bytes.Index(expected, []byte("PACK"))
+	c.Assert(buf.String()[:header], Equals, string(expected[:header]))
+
+	dir := c.MkDir()
+	path := filepath.Join(dir, "master.bundle")
+	c.Assert(ioutil.WriteFile(path, buf.Bytes(), 0644), IsNil)
+
+	// the bundle is fetched by a repository with the prerequisite only
+	other := NewPlainRepository()
+	other.Remotes["full"] = NewBundleRemote(fullBundle)
+	err = other.Fetch(&FetchOptions{RemoteName: "full", RefSpecs: []core.RefSpec{"refs/tags/v1:refs/tags/v1"}})
+	c.Assert(err, IsNil)
+
+	other.Remotes["master"] = NewBundleRemote(path)
+	c.Assert(other.Fetch(&FetchOptions{RemoteName: "master", RefSpecs: bundleRefSpecs}), IsNil)
+	commit, err := other.Commit(core.NewHash(bundleMaster))
+	c.Assert(err, IsNil)
+	_, err = commit.File("c")
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteBundle) TestCreateBundleErrors(c *C) {
+	r, head := linearHistory(c, []int64{1, 2})
+	c.Assert(r.References.Set(core.NewHashReference("refs/heads/master", head)), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(r.CreateBundle(&buf, nil, nil), Equals, ErrEmptyBundle)
+
+	err := r.CreateBundle(&buf, []core.ReferenceName{"refs/heads/foo"}, nil)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	err = r.CreateBundle(&buf, []core.ReferenceName{"refs/heads/master"}, []core.Hash{core.NewHash(bundleV1)})
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+// HEAD is advertised as a symbolic reference to the branch it points to
+func (s *SuiteBundle) TestBundleSourceHead(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = NewBundleRemote(fullBundle)
+	c.Assert(r.Fetch(&FetchOptions{RefSpecs: bundleRefSpecs}), IsNil)
+	c.Assert(r.References.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+
+	path := filepath.Join(c.MkDir(), "head.bundle")
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	c.Assert(r.CreateBundle(f, []core.ReferenceName{core.HEAD, "refs/heads/master"}, nil), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	remote := NewBundleRemote(path)
+	c.Assert(remote.Connect(), IsNil)
+	c.Assert(remote.DefaultBranch(), Equals, "refs/heads/master")
+
+	h, err := remote.Head()
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, bundleMaster)
+
+	err = NewBundleRemote(filepath.Join(c.MkDir(), "foo.bundle")).Connect()
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
@@ -0,0 +1,150 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+var (
+	// ErrMainlineRequired is returned by Repository.CherryPick and
+	// Repository.Revert when the commit is a merge and the options do not
+	// give its mainline.
+	ErrMainlineRequired = errors.New("commit is a merge but no mainline was given")
+	// ErrInvalidMainline is returned by Repository.CherryPick and
+	// Repository.Revert when the mainline given is not a parent of the
+	// commit, or it is not a merge.
+	ErrInvalidMainline = errors.New("invalid mainline")
+)
+
+// CherryPickOptions are the options of Repository.CherryPick.
+type CherryPickOptions struct {
+	// Mainline is the number of the parent, from 1, the changes of a merge
+	// commit are taken against, as git cherry-pick -m does. It is required
+	// for the merges, and not allowed for the rest of the commits.
+	Mainline int
+	// Committer is the committer of the new commit, its Name and Email are
+	// the user.name and user.email of the config if they are empty, and its
+	// When is the current time if it is zero.
+	Committer Signature
+}
+
+// CherryPickResult is the result of Repository.CherryPick.
+type CherryPickResult struct {
+	// Commit is the hash of the new commit, the zero hash if the changes
+	// could not be applied.
+	Commit core.Hash
+	// Tree is the hash of the tree with the changes applied, with the
+	// conflicts as in MergeResult.Tree.
+	Tree core.Hash
+	// Conflicts are the files whose changes could not be applied, sorted by
+	// path, see MergeResult.Conflicts.
+	Conflicts []*MergeConflict
+}
+
+// CherryPick applies the changes of the commit c, compared to its parent,
+// on top of the commit onto, as git cherry-pick does: the trees of both are
+// merged with the tree of the parent of c as their merge base, see
+// Repository.Merge, and a new commit is written, with onto as its parent,
+// the author and message of c and a new committer, if they have no
+// conflicts. No reference is updated.
+//
+// ErrEmptyCommit is returned if the changes are already in onto, and
+// ErrMainlineRequired if c is a merge and the options do not say which of
+// its parents its changes are taken against.
+func (r *Repository) CherryPick(c *Commit, onto *Commit, opts *CherryPickOptions) (*CherryPickResult, error) {
+	if opts == nil {
+		opts = &CherryPickOptions{}
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return nil, err
+	}
+
+	var base core.Hash
+	if parent != nil {
+		base = parent.TreeHash
+	}
+
+	label := fmt.Sprintf("%s (%s)", abbrevHash(c.Hash), commitSubject(c))
+	sigs := &CommitOptions{Author: c.Author, Committer: opts.Committer}
+	h, res, err := r.pick(base, c.TreeHash, onto, label, sigs, c.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CherryPickResult{Commit: h, Tree: res.Tree, Conflicts: res.Conflicts}, nil
+}
+
+// pick applies the changes from the tree base to the tree theirs, the zero
+// hash for the empty tree, on top of the commit onto, with the given label
+// for theirs in the conflict markers, and commits them, if they have no
+// conflicts, with the given message and the signatures of the given options,
+// returning the hash of the commit and the result of the merge of the trees.
+// ErrEmptyCommit is returned if the tree merged is the one of onto.
+func (r *Repository) pick(base, theirs core.Hash, onto *Commit, label string, sigs *CommitOptions, msg string) (
+	core.Hash, *MergeResult, error) {
+
+	res, err := r.mergeTrees(base, onto.TreeHash, theirs, abbrevHash(onto.Hash), label)
+	if err != nil {
+		return core.ZeroHash, nil, err
+	}
+
+	if len(res.Conflicts) != 0 {
+		return core.ZeroHash, res, nil
+	}
+
+	if res.Tree == onto.TreeHash {
+		return core.ZeroHash, nil, ErrEmptyCommit
+	}
+
+	author, committer, err := sigs.signatures(r, nil)
+	if err != nil {
+		return core.ZeroHash, nil, err
+	}
+
+	commit := &Commit{
+		Author:       author,
+		Committer:    committer,
+		Message:      msg,
+		TreeHash:     res.Tree,
+		ParentHashes: []core.Hash{onto.Hash},
+	}
+
+	o := r.newObject()
+	if err := commit.Encode(o); err != nil {
+		return core.ZeroHash, nil, err
+	}
+
+	h, err := r.Storage.Set(o)
+	if err != nil {
+		return core.ZeroHash, nil, err
+	}
+
+	return h, res, nil
+}
+
+// mainlineParent returns the parent of the commit with the given number,
+// from 1, or its only parent if it is 0, nil if it has none.
+func mainlineParent(c *Commit, mainline int) (*Commit, error) {
+	switch n := len(c.ParentHashes); {
+	case n > 1 && mainline == 0:
+		return nil, ErrMainlineRequired
+	case n > 1 && mainline > n, n <= 1 && mainline != 0, mainline < 0:
+		return nil, ErrInvalidMainline
+	case n == 0:
+		return nil, nil
+	case mainline == 0:
+		mainline = 1
+	}
+
+	return c.r.Commit(c.ParentHashes[mainline-1])
+}
+
+// commitSubject returns the first line of the message of the commit.
+func commitSubject(c *Commit) string {
+	return strings.SplitN(c.Message, "\n", 2)[0]
+}
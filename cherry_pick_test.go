@@ -0,0 +1,96 @@
+package git
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func cherryPickOptions(mainline int) *CherryPickOptions {
+	sig := Signature{Name: "bar", Email: "bar@foo.com", When: time.Unix(100, 0).UTC()}
+	return &CherryPickOptions{Mainline: mainline, Committer: sig}
+}
+
+func (s *SuiteMerge) TestCherryPick(c *C) {
+	base := s.commit(c, map[string]string{"foo": "1\n2\n3\n4\n5\n", "bar": "bar\n"})
+	picked := s.commit(c, map[string]string{"foo": "one\n2\n3\n4\n5\n", "qux": "qux\n"}, base)
+	onto := s.commit(c, map[string]string{"foo": "1\n2\n3\n4\nfive\n", "bar": "bar\n"}, base)
+
+	res, err := s.r.CherryPick(picked, onto, cherryPickOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 0)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo": "one\n2\n3\n4\nfive\n",
+		"qux": "qux\n",
+	})
+
+	commit, err := s.r.Commit(res.Commit)
+	c.Assert(err, IsNil)
+	c.Assert(commit.TreeHash, Equals, res.Tree)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{onto.Hash})
+	c.Assert(commit.Message, Equals, picked.Message)
+	c.Assert(commit.Author.Name, Equals, picked.Author.Name)
+	c.Assert(commit.Author.When.Equal(picked.Author.When), Equals, true)
+	c.Assert(commit.Committer.Name, Equals, "bar")
+	c.Assert(commit.Committer.When.Unix(), Equals, int64(100))
+
+	// the changes are already there
+	applied := s.commit(c, map[string]string{"foo": "one\n2\n3\n4\n5\n", "qux": "qux\n"}, onto)
+	_, err = s.r.CherryPick(picked, applied, cherryPickOptions(0))
+	c.Assert(err, Equals, ErrEmptyCommit)
+
+	_, err = s.r.CherryPick(picked, onto, nil)
+	c.Assert(err, Equals, ErrMissingIdentity)
+}
+
+func (s *SuiteMerge) TestCherryPickConflicts(c *C) {
+	base := s.commit(c, map[string]string{"foo": "1\n2\n3\n"})
+	picked := s.commit(c, map[string]string{"foo": "1\ntwo\n3\n"}, base)
+	onto := s.commit(c, map[string]string{"foo": "1\nTWO\n3\n"}, base)
+
+	res, err := s.r.CherryPick(picked, onto, cherryPickOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(res.Commit, Equals, core.ZeroHash)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Path, Equals, "foo")
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo": "1\n<<<<<<< " + abbrevHash(onto.Hash) + "\nTWO\n=======\ntwo\n>>>>>>> " +
+			abbrevHash(picked.Hash) + " (foo)\n3\n",
+	})
+}
+
+func (s *SuiteMerge) TestCherryPickMainline(c *C) {
+	base := s.commit(c, map[string]string{"foo": "foo\n"})
+	a := s.commit(c, map[string]string{"foo": "foo\n", "a": "a\n"}, base)
+	b := s.commit(c, map[string]string{"foo": "foo\n", "b": "b\n"}, base)
+	merge := s.commit(c, map[string]string{"foo": "foo\n", "a": "a\n", "b": "b\n"}, a, b)
+
+	_, err := s.r.CherryPick(merge, base, cherryPickOptions(0))
+	c.Assert(err, Equals, ErrMainlineRequired)
+
+	_, err = s.r.CherryPick(merge, base, cherryPickOptions(3))
+	c.Assert(err, Equals, ErrInvalidMainline)
+
+	_, err = s.r.CherryPick(a, base, cherryPickOptions(1))
+	c.Assert(err, Equals, ErrInvalidMainline)
+
+	// the changes of the merge compared to a are the ones of b
+	res, err := s.r.CherryPick(merge, base, cherryPickOptions(1))
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"foo": "foo\n", "b": "b\n"})
+
+	res, err = s.r.CherryPick(merge, base, cherryPickOptions(2))
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"foo": "foo\n", "a": "a\n"})
+}
+
+func (s *SuiteMerge) TestCherryPickRoot(c *C) {
+	root := s.commit(c, map[string]string{"foo": "foo\n"})
+	onto := s.commit(c, map[string]string{"bar": "bar\n"})
+
+	res, err := s.r.CherryPick(root, onto, cherryPickOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"foo": "foo\n", "bar": "bar\n"})
+}
@@ -38,7 +38,10 @@ func init() {
 	}
 }
 
-// InstallProtocol adds or modifies an existing protocol.
+// InstallProtocol adds or modifies an existing protocol. An HTTP client
+// configured with proxies or TLS settings is used installing, for the http
+// and https schemes, the service returned by
+// http.NewGitUploadPackServiceWithClient.
 func InstallProtocol(scheme string, service common.GitUploadPackService) {
 	if service == nil {
 		panic("nil service")
@@ -51,14 +54,71 @@ func InstallProtocol(scheme string, service common.GitUploadPackService) {
 // among of the set of known protocols: HTTP, SSH. See `InstallProtocol`
 // to add or modify protocols.
 func NewGitUploadPackService(repoURL string) (common.GitUploadPackService, error) {
-	u, err := url.Parse(repoURL)
+	scheme, err := urlScheme(repoURL)
 	if err != nil {
-		return nil, fmt.Errorf("invalid url %q", repoURL)
+		return nil, err
 	}
-	s, ok := KnownProtocols[u.Scheme]
+	s, ok := KnownProtocols[scheme]
 	if !ok {
-		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+		return nil, fmt.Errorf("unsupported scheme %q", scheme)
 	}
 
 	return s, nil
 }
+
+// DefaultReceivePackProtocols are the protocols supported by default to
+// push.
+var DefaultReceivePackProtocols = map[string]common.GitReceivePackService{
+	"http":  http.NewGitReceivePackService(),
+	"https": http.NewGitReceivePackService(),
+	"ssh":   ssh.NewGitReceivePackService(),
+}
+
+// KnownReceivePackProtocols holds the current set of known protocols to
+// push. Initially it gets its contents from `DefaultReceivePackProtocols`.
+// See `InstallReceivePackProtocol` below to add or modify this variable.
+var KnownReceivePackProtocols = make(map[string]common.GitReceivePackService, len(DefaultReceivePackProtocols))
+
+func init() {
+	for k, v := range DefaultReceivePackProtocols {
+		InstallReceivePackProtocol(k, v)
+	}
+}
+
+// InstallReceivePackProtocol adds or modifies an existing protocol to push.
+func InstallReceivePackProtocol(scheme string, service common.GitReceivePackService) {
+	if service == nil {
+		panic("nil service")
+	}
+
+	KnownReceivePackProtocols[scheme] = service
+}
+
+// NewGitReceivePackService returns the appropriate receive pack service
+// among of the set of known protocols to push: HTTP, SSH. See
+// `InstallReceivePackProtocol` to add or modify protocols.
+func NewGitReceivePackService(repoURL string) (common.GitReceivePackService, error) {
+	scheme, err := urlScheme(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := KnownReceivePackProtocols[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheme %q", scheme)
+	}
+
+	return s, nil
+}
+
+// urlScheme returns the scheme of the URL, ssh for the scp-like ones,
+// [user@]host:path
+func urlScheme(repoURL string) (string, error) {
+	scheme := common.Endpoint(repoURL).Scheme()
+	if scheme == "" {
+		if _, err := url.Parse(repoURL); err != nil {
+			return "", fmt.Errorf("invalid url %q", repoURL)
+		}
+	}
+
+	return scheme, nil
+}
@@ -2,10 +2,13 @@
 package common
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"regexp"
 	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
@@ -28,6 +31,15 @@ type GitUploadPackService interface {
 	Fetch(r *GitUploadPackRequest) (io.ReadCloser, error)
 }
 
+// ContextGitUploadPackService is a GitUploadPackService whose requests can
+// be canceled: once the context is done, the connection is closed and the
+// error of the context is returned, by the reads of the packfile too.
+type ContextGitUploadPackService interface {
+	GitUploadPackService
+	InfoContext(ctx context.Context) (*GitUploadPackInfo, error)
+	FetchContext(ctx context.Context, r *GitUploadPackRequest) (io.ReadCloser, error)
+}
+
 type AuthMethod interface {
 	Name() string
 	String() string
@@ -35,13 +47,36 @@ type AuthMethod interface {
 
 type Endpoint string
 
-func NewEndpoint(url string) (Endpoint, error) {
-	vcs, err := vcsurl.Parse(url)
-	if err != nil {
-		return "", core.NewPermanentError(err)
+// scpLikeURL matches the scp-like syntax of the ssh URLs, [user@]host:path
+var scpLikeURL = regexp.MustCompile(`^(?:[^@/:]+@)?[^@/:]+:.+$`)
+
+// NewEndpoint returns the Endpoint of the repository at the given URL, the
+// ssh URLs, ssh://[user@]host[:port]/path or [user@]host:path, are used as
+// they are, and so are the http and https ones, but for a trailing ".git",
+// which is added if they do not have it, so their scheme is kept and the
+// repositories of plain HTTP servers can be reached.
+func NewEndpoint(rawurl string) (Endpoint, error) {
+	e := Endpoint(rawurl)
+	var link string
+	switch e.Scheme() {
+	case "ssh":
+		return e, nil
+	case "http", "https":
+		u, err := url.Parse(rawurl)
+		if err != nil || u.Host == "" {
+			return "", core.NewPermanentError(fmt.Errorf("invalid URL %q", rawurl))
+		}
+
+		link = strings.TrimSuffix(rawurl, "/")
+	default:
+		vcs, err := vcsurl.Parse(rawurl)
+		if err != nil {
+			return "", core.NewPermanentError(err)
+		}
+
+		link = vcs.Link()
 	}
 
-	link := vcs.Link()
 	if !strings.HasSuffix(link, ".git") {
 		link += ".git"
 	}
@@ -49,6 +84,21 @@ func NewEndpoint(url string) (Endpoint, error) {
 	return Endpoint(link), nil
 }
 
+// Scheme returns the scheme of the endpoint, ssh for the scp-like URLs, or
+// an empty string if it is not a valid URL.
+func (e Endpoint) Scheme() string {
+	if !strings.Contains(string(e), "://") && scpLikeURL.MatchString(string(e)) {
+		return "ssh"
+	}
+
+	u, err := url.Parse(string(e))
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme
+}
+
 func (e Endpoint) Service(name string) string {
 	return fmt.Sprintf("%s/info/refs?service=%s", e, name)
 }
@@ -147,6 +197,23 @@ func (c *Capabilities) SymbolicReference(sym string) string {
 	return ""
 }
 
+// ObjectFormat returns the format of the objects of the repository of the
+// server, the one of the object-format capability, core.SHA1 if it is not
+// present. core.ErrUnsupportedObjectFormat is returned if the format is not
+// supported.
+func (c *Capabilities) ObjectFormat() (core.ObjectFormat, error) {
+	if !c.Supports("object-format") {
+		return core.SHA1, nil
+	}
+
+	values := c.Get("object-format").Values
+	if len(values) == 0 {
+		return core.SHA1, core.ErrUnsupportedObjectFormat
+	}
+
+	return core.ParseObjectFormat(values[0])
+}
+
 func (c *Capabilities) String() string {
 	if len(c.o) == 0 {
 		return ""
@@ -200,12 +267,21 @@ func (r *GitUploadPackInfo) Decode(d *pktline.Decoder) error {
 	return nil
 }
 
+// read reads the advertised references up to the flush-pkt ending them, so
+// the rest of the session can be read by the caller, after the service
+// line block sent by the smart HTTP servers, if any
 func (r *GitUploadPackInfo) read(d *pktline.Decoder) error {
-	lines, err := d.ReadAll()
+	lines, err := d.ReadBlock()
 	if err != nil {
 		return err
 	}
 
+	if len(lines) != 0 && strings.HasPrefix(lines[0], "# service=") {
+		if lines, err = d.ReadBlock(); err != nil {
+			return err
+		}
+	}
+
 	isEmpty := true
 	r.Refs = map[string]core.Hash{}
 	for _, line := range lines {
@@ -270,6 +346,21 @@ func (r *GitUploadPackInfo) Bytes() []byte {
 type GitUploadPackRequest struct {
 	Wants []core.Hash
 	Haves []core.Hash
+	// Shallows are the shallow commits of the repository fetching, sent so
+	// the server does not assume their parents are known.
+	Shallows []core.Hash
+	// Depth limits the history fetched to the given number of commits from
+	// the wants, the whole history is fetched if it is zero.
+	Depth int
+	// Capabilities are the capabilities requested along with the first
+	// want, shallow is added if needed. The packfile of the response is
+	// demultiplexed if side-band or side-band-64k are requested.
+	Capabilities []string
+	// Progress receives the progress messages of the server if the
+	// packfile is demultiplexed, they are discarded if it is nil. It is
+	// written as the response is read, so it should not block, see
+	// ProgressWriter.
+	Progress io.Writer
 }
 
 func (r *GitUploadPackRequest) Want(h ...core.Hash) {
@@ -280,6 +371,11 @@ func (r *GitUploadPackRequest) Have(h ...core.Hash) {
 	r.Haves = append(r.Haves, h...)
 }
 
+// Shallow adds the given hashes to the shallow commits of the request
+func (r *GitUploadPackRequest) Shallow(h ...core.Hash) {
+	r.Shallows = append(r.Shallows, h...)
+}
+
 func (r *GitUploadPackRequest) String() string {
 	b, _ := ioutil.ReadAll(r.Reader())
 	return string(b)
@@ -287,16 +383,123 @@ func (r *GitUploadPackRequest) String() string {
 
 func (r *GitUploadPackRequest) Reader() *strings.Reader {
 	e := pktline.NewEncoder()
-	for _, want := range r.Wants {
+	for i, want := range r.Wants {
+		if i == 0 {
+			e.AddLine(strings.Join(append([]string{"want", want.String()}, r.capabilities()...), " "))
+			continue
+		}
+
 		e.AddLine(fmt.Sprintf("want %s", want))
 	}
 
+	shallows := make([]core.Hash, len(r.Shallows))
+	copy(shallows, r.Shallows)
+	core.SortHashes(shallows)
+	for _, shallow := range shallows {
+		e.AddLine(fmt.Sprintf("shallow %s", shallow))
+	}
+
+	if r.Depth > 0 {
+		e.AddLine(fmt.Sprintf("deepen %d", r.Depth))
+	}
+
+	e.AddFlush()
 	for _, have := range r.Haves {
 		e.AddLine(fmt.Sprintf("have %s", have))
 	}
 
-	e.AddFlush()
 	e.AddLine("done")
 
 	return e.Reader()
 }
+
+// isShallow reports whether the request needs the shallow capability
+func (r *GitUploadPackRequest) isShallow() bool {
+	return r.Depth > 0 || len(r.Shallows) != 0
+}
+
+// capabilities returns the capabilities sent with the first want
+func (r *GitUploadPackRequest) capabilities() []string {
+	c := r.Capabilities
+	if r.isShallow() {
+		c = append(c[:len(c):len(c)], "shallow")
+	}
+
+	return c
+}
+
+// GitUploadPackResponse is the response of the server to a
+// GitUploadPackRequest, reading the packfile once the lines before it have
+// been decoded
+type GitUploadPackResponse struct {
+	io.ReadCloser
+	// Shallows are the commits the server made shallow, whose parents have
+	// not been sent, if the request had a depth.
+	Shallows []core.Hash
+	// Unshallows are the shallow commits of the request whose parents have
+	// been sent, if the request had a depth.
+	Unshallows []core.Hash
+}
+
+// NewGitUploadPackResponse decodes the lines the server sends before the
+// packfile as response to the given request, the shallow commits if it had
+// a depth and the NAK or ACK line, leaving r at the start of the packfile,
+// demultiplexed if the request has a side-band capability
+func NewGitUploadPackResponse(r io.ReadCloser, req *GitUploadPackRequest) (*GitUploadPackResponse, error) {
+	res := &GitUploadPackResponse{ReadCloser: r}
+	d := pktline.NewDecoder(r)
+	if req.Depth > 0 {
+		if err := res.decodeShallows(d); err != nil {
+			return nil, err
+		}
+	}
+
+	line, err := d.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "NAK") && !strings.HasPrefix(line, "ACK") {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+
+	if hasSideband(req.Capabilities) {
+		d := NewDemuxer(r)
+		d.Progress = req.Progress
+		res.ReadCloser = &demuxReadCloser{d, r}
+	}
+
+	return res, nil
+}
+
+// demuxReadCloser reads the first side-band channel of a response, closing
+// the response itself
+type demuxReadCloser struct {
+	*Demuxer
+	io.Closer
+}
+
+func (r *GitUploadPackResponse) decodeShallows(d *pktline.Decoder) error {
+	lines, err := d.ReadBlock()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		parts := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+		if len(parts) != 2 || !core.IsHashHex(parts[1]) {
+			return fmt.Errorf("unexpected line %q", line)
+		}
+
+		switch parts[0] {
+		case "shallow":
+			r.Shallows = append(r.Shallows, core.NewHash(parts[1]))
+		case "unshallow":
+			r.Unshallows = append(r.Unshallows, core.NewHash(parts[1]))
+		default:
+			return fmt.Errorf("unexpected line %q", line)
+		}
+	}
+
+	return nil
+}
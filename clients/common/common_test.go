@@ -3,6 +3,7 @@ package common
 import (
 	"bytes"
 	"encoding/base64"
+	"io/ioutil"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -16,10 +17,33 @@ type SuiteCommon struct{}
 
 var _ = Suite(&SuiteCommon{})
 
+// the scp-like URLs are ssh, they were converted to https before
 func (s *SuiteCommon) TestNewEndpoint(c *C) {
 	e, err := NewEndpoint("git@github.com:user/repository.git")
 	c.Assert(err, IsNil)
+	c.Assert(e, Equals, Endpoint("git@github.com:user/repository.git"))
+	c.Assert(e.Scheme(), Equals, "ssh")
+}
+
+func (s *SuiteCommon) TestNewEndpointSSH(c *C) {
+	e, err := NewEndpoint("ssh://git@example.com:2222/var/repository")
+	c.Assert(err, IsNil)
+	c.Assert(e, Equals, Endpoint("ssh://git@example.com:2222/var/repository"))
+	c.Assert(e.Scheme(), Equals, "ssh")
+}
+
+func (s *SuiteCommon) TestNewEndpointHTTPS(c *C) {
+	e, err := NewEndpoint("https://github.com/user/repository")
+	c.Assert(err, IsNil)
 	c.Assert(e, Equals, Endpoint("https://github.com/user/repository.git"))
+	c.Assert(e.Scheme(), Equals, "https")
+}
+
+func (s *SuiteCommon) TestNewEndpointHTTP(c *C) {
+	e, err := NewEndpoint("http://127.0.0.1:8080/repository/")
+	c.Assert(err, IsNil)
+	c.Assert(e, Equals, Endpoint("http://127.0.0.1:8080/repository.git"))
+	c.Assert(e.Scheme(), Equals, "http")
 }
 
 func (s *SuiteCommon) TestNewEndpointWrongForgat(c *C) {
@@ -29,7 +53,7 @@ func (s *SuiteCommon) TestNewEndpointWrongForgat(c *C) {
 }
 
 func (s *SuiteCommon) TestEndpointService(c *C) {
-	e, _ := NewEndpoint("git@github.com:user/repository.git")
+	e, _ := NewEndpoint("https://github.com/user/repository.git")
 	c.Assert(e.Service("foo"), Equals, "https://github.com/user/repository.git/info/refs?service=foo")
 }
 
@@ -123,7 +147,64 @@ func (s *SuiteCommon) TestGitUploadPackRequest(c *C) {
 	c.Assert(r.String(), Equals,
 		"0032want d82f291cde9987322c8a0c81a325e1ba6159684c\n"+
 			"0032want 2b41ef280fdb67a9b250678686a0c3e03b0a9989\n"+
-			"0032have 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000"+
+			"0000"+
+			"0032have 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"+
 			"0009done\n",
 	)
 }
+
+func (s *SuiteCommon) TestGitUploadPackRequestShallow(c *C) {
+	r := &GitUploadPackRequest{Depth: 10}
+	r.Want(core.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c"))
+	r.Want(core.NewHash("2b41ef280fdb67a9b250678686a0c3e03b0a9989"))
+	r.Shallow(core.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c"))
+	r.Shallow(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	c.Assert(r.String(), Equals,
+		"003awant d82f291cde9987322c8a0c81a325e1ba6159684c shallow\n"+
+			"0032want 2b41ef280fdb67a9b250678686a0c3e03b0a9989\n"+
+			"0035shallow 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"+
+			"0035shallow d82f291cde9987322c8a0c81a325e1ba6159684c\n"+
+			"000edeepen 10\n0000"+
+			"0009done\n",
+	)
+}
+
+func (s *SuiteCommon) TestGitUploadPackRequestCapabilities(c *C) {
+	r := &GitUploadPackRequest{Depth: 1, Capabilities: []string{"side-band-64k", "ofs-delta"}}
+	r.Want(core.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c"))
+	r.Want(core.NewHash("2b41ef280fdb67a9b250678686a0c3e03b0a9989"))
+
+	c.Assert(r.String(), Equals,
+		"0052want d82f291cde9987322c8a0c81a325e1ba6159684c side-band-64k ofs-delta shallow\n"+
+			"0032want 2b41ef280fdb67a9b250678686a0c3e03b0a9989\n"+
+			"000ddeepen 1\n0000"+
+			"0009done\n",
+	)
+	c.Assert(r.Capabilities, DeepEquals, []string{"side-band-64k", "ofs-delta"})
+}
+
+func (s *SuiteCommon) TestGitUploadPackResponse(c *C) {
+	raw := "0035shallow d82f291cde9987322c8a0c81a325e1ba6159684c\n" +
+		"0037unshallow 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n" +
+		"0000" +
+		"0008NAK\n" +
+		"PACK"
+
+	req := &GitUploadPackRequest{Depth: 1}
+	res, err := NewGitUploadPackResponse(ioutil.NopCloser(bytes.NewBufferString(raw)), req)
+	c.Assert(err, IsNil)
+	c.Assert(res.Shallows, DeepEquals, []core.Hash{core.NewHash("d82f291cde9987322c8a0c81a325e1ba6159684c")})
+	c.Assert(res.Unshallows, DeepEquals, []core.Hash{core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")})
+
+	pack, err := ioutil.ReadAll(res)
+	c.Assert(err, IsNil)
+	c.Assert(string(pack), Equals, "PACK")
+
+	res, err = NewGitUploadPackResponse(ioutil.NopCloser(bytes.NewBufferString("0008NAK\nPACK")), &GitUploadPackRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(res.Shallows, HasLen, 0)
+
+	_, err = NewGitUploadPackResponse(ioutil.NopCloser(bytes.NewBufferString("0008NAK\nPACK")), req)
+	c.Assert(err, Not(IsNil))
+}
@@ -0,0 +1,271 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+const GitReceivePackServiceName = "git-receive-pack"
+
+var (
+	EmptyGitReceivePackErr = errors.New("empty git-receive-pack given")
+	EmptyReportStatusErr   = errors.New("empty report-status given")
+)
+
+// capabilitiesRef is the name of the reference advertised by receive-pack
+// for the capabilities of an empty repository.
+const capabilitiesRef = "capabilities^{}"
+
+// GitReceivePackService is the service pushing to a repository, speaking the
+// receive-pack protocol.
+type GitReceivePackService interface {
+	Connect(url Endpoint) error
+	ConnectWithAuth(url Endpoint, auth AuthMethod) error
+	Info() (*GitReceivePackInfo, error)
+	SendPack(r *GitReceivePackRequest) (*ReportStatus, error)
+}
+
+// ContextGitReceivePackService is a GitReceivePackService whose requests can
+// be canceled, see ContextGitUploadPackService.
+type ContextGitReceivePackService interface {
+	GitReceivePackService
+	InfoContext(ctx context.Context) (*GitReceivePackInfo, error)
+	SendPackContext(ctx context.Context, r *GitReceivePackRequest) (*ReportStatus, error)
+}
+
+// GitReceivePackInfo are the references and the capabilities advertised by
+// git-receive-pack
+type GitReceivePackInfo struct {
+	Capabilities *Capabilities
+	Refs         map[string]core.Hash
+}
+
+// NewGitReceivePackInfo returns a new empty GitReceivePackInfo
+func NewGitReceivePackInfo() *GitReceivePackInfo {
+	return &GitReceivePackInfo{
+		Capabilities: NewCapabilities(),
+		Refs:         make(map[string]core.Hash),
+	}
+}
+
+// Decode decodes the advertisement of git-receive-pack, preceded by the
+// service line sent by the smart HTTP servers, if any
+func (i *GitReceivePackInfo) Decode(d *pktline.Decoder) error {
+	if err := i.read(d); err != nil {
+		if err == EmptyGitReceivePackErr {
+			return core.NewPermanentError(err)
+		}
+
+		return core.NewUnexpectedError(err)
+	}
+
+	return nil
+}
+
+func (i *GitReceivePackInfo) read(d *pktline.Decoder) error {
+	lines, err := d.ReadBlock()
+	if err != nil {
+		return err
+	}
+
+	if len(lines) != 0 && strings.HasPrefix(lines[0], "# service=") {
+		if lines, err = d.ReadBlock(); err != nil {
+			return err
+		}
+	}
+
+	if len(lines) == 0 {
+		return EmptyGitReceivePackErr
+	}
+
+	for n, line := range lines {
+		line = strings.TrimSuffix(line, "\n")
+		if n == 0 {
+			parts := strings.SplitN(line, "\x00", 2)
+			if len(parts) == 2 {
+				i.decodeCapabilities(parts[1])
+			}
+
+			line = parts[0]
+		}
+
+		parts := strings.Split(line, " ")
+		if len(parts) != 2 || !core.IsHashHex(parts[0]) {
+			return fmt.Errorf("unexpected line %q", line)
+		}
+
+		if parts[1] == capabilitiesRef || parts[1] == ".have" {
+			continue
+		}
+
+		i.Refs[parts[1]] = core.NewHash(parts[0])
+	}
+
+	return nil
+}
+
+func (i *GitReceivePackInfo) decodeCapabilities(raw string) {
+	for _, c := range strings.Fields(raw) {
+		parts := strings.SplitN(c, "=", 2)
+		if len(parts) == 2 {
+			i.Capabilities.Add(parts[0], parts[1])
+			continue
+		}
+
+		i.Capabilities.Add(parts[0])
+	}
+}
+
+// Command is the update of a reference of a push, from the hash Old to New.
+// The reference is created if Old is zero, and deleted if New is zero
+type Command struct {
+	Name core.ReferenceName
+	Old  core.Hash
+	New  core.Hash
+}
+
+// IsDelete reports whether the command deletes the reference
+func (c *Command) IsDelete() bool {
+	return c.New.IsZero()
+}
+
+func (c *Command) String() string {
+	return fmt.Sprintf("%s %s %s", c.Old, c.New, c.Name)
+}
+
+// GitReceivePackRequest is a push: the commands updating the references,
+// the capabilities requested and the packfile with the objects missing in
+// the remote, if any
+type GitReceivePackRequest struct {
+	Commands     []*Command
+	Capabilities []string
+	Packfile     io.Reader
+}
+
+// Reader returns a reader of the request, the commands are encoded as
+// pkt-lines, the first one along with the capabilities, followed by the
+// packfile
+func (r *GitReceivePackRequest) Reader() (io.Reader, error) {
+	e := pktline.NewEncoder()
+	for i, c := range r.Commands {
+		line := c.String()
+		if i == 0 && len(r.Capabilities) != 0 {
+			line += "\x00" + strings.Join(r.Capabilities, " ")
+		}
+
+		if err := e.AddLine(line); err != nil {
+			return nil, err
+		}
+	}
+
+	e.AddFlush()
+	if r.Packfile == nil {
+		return e.Reader(), nil
+	}
+
+	return io.MultiReader(e.Reader(), r.Packfile), nil
+}
+
+// ReportStatus is the result of a push requesting the report-status
+// capability: the status of the unpacking of the packfile and the one of
+// every command
+type ReportStatus struct {
+	UnpackStatus    string
+	CommandStatuses []*CommandStatus
+}
+
+// CommandStatus is the status of a command of a push, "ok", or the reason
+// it failed
+type CommandStatus struct {
+	Name   core.ReferenceName
+	Status string
+}
+
+// NewReportStatus returns a new empty ReportStatus
+func NewReportStatus() *ReportStatus {
+	return &ReportStatus{}
+}
+
+// Decode decodes the report-status sent by git-receive-pack
+func (s *ReportStatus) Decode(d *pktline.Decoder) error {
+	lines, err := d.ReadBlock()
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "unpack ") {
+		return EmptyReportStatusErr
+	}
+
+	s.UnpackStatus = strings.TrimSuffix(strings.TrimPrefix(lines[0], "unpack "), "\n")
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+		switch {
+		case len(parts) == 2 && parts[0] == "ok":
+			s.CommandStatuses = append(s.CommandStatuses, &CommandStatus{
+				Name: core.ReferenceName(parts[1]), Status: "ok",
+			})
+		case len(parts) == 3 && parts[0] == "ng":
+			s.CommandStatuses = append(s.CommandStatuses, &CommandStatus{
+				Name: core.ReferenceName(parts[1]), Status: parts[2],
+			})
+		default:
+			return fmt.Errorf("unexpected line %q", line)
+		}
+	}
+
+	return nil
+}
+
+// Err returns an *UnpackError if the packfile could not be unpacked, or the
+// *CommandError of the first command that failed, nil if all of them
+// succeeded
+func (s *ReportStatus) Err() error {
+	if s.UnpackStatus != "ok" {
+		return &UnpackError{Reason: s.UnpackStatus}
+	}
+
+	for _, c := range s.CommandStatuses {
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Err returns a *CommandError if the command failed
+func (s *CommandStatus) Err() error {
+	if s.Status == "ok" {
+		return nil
+	}
+
+	return &CommandError{Name: s.Name, Reason: s.Status}
+}
+
+// UnpackError is returned when the remote could not unpack the packfile of
+// a push
+type UnpackError struct {
+	Reason string
+}
+
+func (e *UnpackError) Error() string {
+	return fmt.Sprintf("unpack error: %s", e.Reason)
+}
+
+// CommandError is returned when the remote could not update a reference of a
+// push
+type CommandError struct {
+	Name   core.ReferenceName
+	Reason string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command error on %s: %s", e.Name, e.Reason)
+}
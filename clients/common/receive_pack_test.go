@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+// the advertisements have been obtained with git receive-pack
+// --advertise-refs --stateless-rpc
+func (s *SuiteCommon) TestGitReceivePackInfoDecode(c *C) {
+	raw := "001f# service=git-receive-pack\n0000" +
+		"00b43535f80b8fc84ebedf448014e79191c0e867b575 refs/heads/feature\x00report-status report-status-v2 delete-refs side-band-64k quiet atomic ofs-delta object-format=sha1 agent=git/2.39.5\n" +
+		"003f972eb2a3177a422bd2b0ad4991df73d32e0fc763 refs/heads/master\n" +
+		"0000"
+
+	info := NewGitReceivePackInfo()
+	c.Assert(info.Decode(pktline.NewDecoder(strings.NewReader(raw))), IsNil)
+	c.Assert(info.Refs, DeepEquals, map[string]core.Hash{
+		"refs/heads/feature": core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"),
+		"refs/heads/master":  core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"),
+	})
+	c.Assert(info.Capabilities.Supports("report-status"), Equals, true)
+	c.Assert(info.Capabilities.Supports("atomic"), Equals, true)
+	c.Assert(info.Capabilities.Get("agent").Values, DeepEquals, []string{"git/2.39.5"})
+}
+
+func (s *SuiteCommon) TestGitReceivePackInfoDecodeEmptyRepository(c *C) {
+	raw := "00b10000000000000000000000000000000000000000 capabilities^{}\x00report-status report-status-v2 delete-refs side-band-64k quiet atomic ofs-delta object-format=sha1 agent=git/2.39.5\n" +
+		"0000"
+
+	info := NewGitReceivePackInfo()
+	c.Assert(info.Decode(pktline.NewDecoder(strings.NewReader(raw))), IsNil)
+	c.Assert(info.Refs, HasLen, 0)
+	c.Assert(info.Capabilities.Supports("delete-refs"), Equals, true)
+
+	err := NewGitReceivePackInfo().Decode(pktline.NewDecoder(strings.NewReader("0000")))
+	c.Assert(err, DeepEquals, core.NewPermanentError(EmptyGitReceivePackErr))
+
+	err = NewGitReceivePackInfo().Decode(pktline.NewDecoder(strings.NewReader("0008foo\n0000")))
+	_, ok := err.(*core.UnexpectedError)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *SuiteCommon) TestGitReceivePackRequest(c *C) {
+	r := &GitReceivePackRequest{
+		Commands: []*Command{
+			{Name: "refs/heads/feature", Old: core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575")},
+			{Name: "refs/heads/master", New: core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763")},
+		},
+		Capabilities: []string{"report-status", "delete-refs"},
+		Packfile:     strings.NewReader("PACK"),
+	}
+
+	reader, err := r.Reader()
+	c.Assert(err, IsNil)
+	raw, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(raw), Equals,
+		"00833535f80b8fc84ebedf448014e79191c0e867b575 0000000000000000000000000000000000000000 refs/heads/feature\x00report-status delete-refs\n"+
+			"00680000000000000000000000000000000000000000 972eb2a3177a422bd2b0ad4991df73d32e0fc763 refs/heads/master\n"+
+			"0000PACK",
+	)
+
+	c.Assert(r.Commands[0].IsDelete(), Equals, true)
+	c.Assert(r.Commands[1].IsDelete(), Equals, false)
+}
+
+func (s *SuiteCommon) TestReportStatusDecode(c *C) {
+	raw := "000eunpack ok\n" +
+		"0019ok refs/heads/master\n" +
+		"0034ng refs/heads/feature pre-receive hook declined\n" +
+		"0000"
+
+	status := NewReportStatus()
+	c.Assert(status.Decode(pktline.NewDecoder(bytes.NewBufferString(raw))), IsNil)
+	c.Assert(status, DeepEquals, &ReportStatus{
+		UnpackStatus: "ok",
+		CommandStatuses: []*CommandStatus{
+			{Name: "refs/heads/master", Status: "ok"},
+			{Name: "refs/heads/feature", Status: "pre-receive hook declined"},
+		},
+	})
+	c.Assert(status.Err(), DeepEquals, &CommandError{Name: "refs/heads/feature", Reason: "pre-receive hook declined"})
+	c.Assert(status.Err().Error(), Equals, "command error on refs/heads/feature: pre-receive hook declined")
+
+	status = NewReportStatus()
+	raw = "0024unpack index-pack abnormal exit\n0000"
+	c.Assert(status.Decode(pktline.NewDecoder(bytes.NewBufferString(raw))), IsNil)
+	c.Assert(status.Err(), DeepEquals, &UnpackError{Reason: "index-pack abnormal exit"})
+
+	status = NewReportStatus()
+	c.Assert(status.Decode(pktline.NewDecoder(bytes.NewBufferString("0000"))), Equals, EmptyReportStatusErr)
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+// the channels of the side-band capabilities
+const (
+	sidebandData     = 1
+	sidebandProgress = 2
+	sidebandError    = 3
+)
+
+// Demuxer reads the data sent by the server in the first channel of the
+// side-band or side-band-64k capabilities, the packfile or the report-status,
+// writing the progress messages of the second one, if any, to Progress. The
+// data ends at the flush-pkt, or with a *RemoteError if the server sends a
+// message in the third channel.
+type Demuxer struct {
+	// Progress receives the progress messages of the server, they are
+	// discarded if it is nil.
+	Progress io.Writer
+
+	d    *pktline.Decoder
+	data string
+	err  error
+}
+
+// NewDemuxer returns a new Demuxer reading the side-band multiplexed
+// pkt-lines of r.
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{d: pktline.NewDecoder(r)}
+}
+
+// Read reads the data of the first channel.
+func (d *Demuxer) Read(p []byte) (int, error) {
+	for d.data == "" {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		d.data, d.err = d.next()
+	}
+
+	n := copy(p, d.data)
+	d.data = d.data[n:]
+	return n, nil
+}
+
+// next returns the data of the next pkt-line of the first channel, writing
+// the progress messages before it.
+func (d *Demuxer) next() (string, error) {
+	line, err := d.d.ReadLine()
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if line == "" {
+		return "", io.EOF
+	}
+
+	switch line[0] {
+	case sidebandData:
+		return line[1:], nil
+	case sidebandProgress:
+		if d.Progress != nil {
+			if _, err := io.WriteString(d.Progress, line[1:]); err != nil {
+				return "", err
+			}
+		}
+
+		return "", nil
+	case sidebandError:
+		return "", &RemoteError{Message: strings.TrimSpace(line[1:])}
+	default:
+		return "", fmt.Errorf("unknown side-band channel %d", line[0])
+	}
+}
+
+// ProgressBufferSize is the number of bytes of messages a ProgressWriter
+// buffers while its writer is busy, the next ones are dropped until it
+// catches up.
+const ProgressBufferSize = 64 << 10
+
+// ProgressWriter writes the progress messages to a writer in its own
+// goroutine, so writing them never blocks the reading of the packfile: the
+// messages are buffered, up to ProgressBufferSize bytes, and dropped if they
+// do not fit. The errors of the writer are ignored, the messages are
+// discarded after the first one.
+type ProgressWriter struct {
+	w       io.Writer
+	m       sync.Mutex
+	buf     []byte
+	closed  bool
+	pending chan struct{}
+	done    chan struct{}
+}
+
+// NewProgressWriter returns a new ProgressWriter writing to w, it must be
+// closed once the progress has been written.
+func NewProgressWriter(w io.Writer) *ProgressWriter {
+	p := &ProgressWriter{
+		w:       w,
+		pending: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	go p.write()
+	return p
+}
+
+func (p *ProgressWriter) write() {
+	defer close(p.done)
+
+	var err error
+	for range p.pending {
+		p.m.Lock()
+		buf, closed := p.buf, p.closed
+		p.buf = nil
+		p.m.Unlock()
+
+		if len(buf) != 0 && err == nil {
+			_, err = p.w.Write(buf)
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+// Write buffers the message, or drops it if it does not fit in the buffer.
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	p.m.Lock()
+	if len(p.buf)+len(b) <= ProgressBufferSize {
+		p.buf = append(p.buf, b...)
+	}
+	p.m.Unlock()
+
+	p.signal()
+	return len(b), nil
+}
+
+// signal wakes up the goroutine writing the messages, if it is not already.
+func (p *ProgressWriter) signal() {
+	select {
+	case p.pending <- struct{}{}:
+	default:
+	}
+}
+
+// Close waits for the messages buffered to be written.
+func (p *ProgressWriter) Close() error {
+	p.m.Lock()
+	p.closed = true
+	p.m.Unlock()
+
+	p.signal()
+	<-p.done
+	return nil
+}
+
+// RemoteError is returned when the server sends a fatal error in the
+// third channel of the side-band capabilities
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote: " + e.Message
+}
+
+// hasSideband reports whether the capabilities request the side-band or
+// side-band-64k capabilities.
+func hasSideband(capabilities []string) bool {
+	for _, c := range capabilities {
+		if c == "side-band" || c == "side-band-64k" {
+			return true
+		}
+	}
+
+	return false
+}
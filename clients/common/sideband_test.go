@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+func (s *SuiteCommon) TestDemuxer(c *C) {
+	raw := "0009\x01PACK" +
+		"0019\x02Counting objects: 1\n" +
+		"000a\x01 data" +
+		"0000"
+
+	progress := bytes.NewBuffer(nil)
+	d := NewDemuxer(strings.NewReader(raw))
+	d.Progress = progress
+
+	data, err := ioutil.ReadAll(d)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "PACK data")
+	c.Assert(progress.String(), Equals, "Counting objects: 1\n")
+}
+
+func (s *SuiteCommon) TestDemuxerErrors(c *C) {
+	d := NewDemuxer(strings.NewReader("0009\x01PACK0013\x03access denied\n"))
+	data, err := ioutil.ReadAll(d)
+	c.Assert(string(data), Equals, "PACK")
+	c.Assert(err, DeepEquals, &RemoteError{Message: "access denied"})
+	c.Assert(err.Error(), Equals, "remote: access denied")
+
+	d = NewDemuxer(strings.NewReader("0009\x01PACK"))
+	_, err = ioutil.ReadAll(d)
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+
+	d = NewDemuxer(strings.NewReader("0009\x04PACK"))
+	_, err = ioutil.ReadAll(d)
+	c.Assert(err, ErrorMatches, "unknown side-band channel 4")
+}
+
+// the response has been obtained with git upload-pack --stateless-rpc
+func (s *SuiteCommon) TestGitUploadPackResponseSideband(c *C) {
+	f, err := os.Open("../../fixtures/upload-pack/fetch-2-side-band.response")
+	c.Assert(err, IsNil)
+
+	req := &GitUploadPackRequest{Capabilities: []string{"side-band-64k"}}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	res, err := NewGitUploadPackResponse(f, req)
+	c.Assert(err, IsNil)
+
+	progress := bytes.NewBuffer(nil)
+	res.ReadCloser.(*demuxReadCloser).Progress = progress
+
+	pack, err := ioutil.ReadAll(res)
+	c.Assert(err, IsNil)
+	c.Assert(string(pack[:4]), Equals, "PACK")
+	c.Assert(progress.String(), Matches, "(?s)Enumerating objects: 30, done.*")
+	c.Assert(res.Close(), IsNil)
+}
+
+func (s *SuiteCommon) TestProgressWriter(c *C) {
+	progress := bytes.NewBuffer(nil)
+	p := NewProgressWriter(progress)
+	for _, m := range []string{"Counting objects: 1\r", "Counting objects: 2, done.\n"} {
+		n, err := io.WriteString(p, m)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, len(m))
+	}
+
+	c.Assert(p.Close(), IsNil)
+	c.Assert(progress.String(), Equals, "Counting objects: 1\rCounting objects: 2, done.\n")
+}
+
+// blockingWriter blocks every write until unblock is closed
+type blockingWriter struct {
+	bytes.Buffer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+
+	<-w.unblock
+	return w.Buffer.Write(p)
+}
+
+func (s *SuiteCommon) TestProgressWriterSlow(c *C) {
+	w := &blockingWriter{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+	p := NewProgressWriter(w)
+
+	// the first message is being written when the next ones are written
+	_, err := io.WriteString(p, "first\n")
+	c.Assert(err, IsNil)
+	<-w.started
+
+	big := strings.Repeat("x", ProgressBufferSize/2)
+	for _, m := range []string{big, big, "dropped", "also dropped"} {
+		_, err := io.WriteString(p, m)
+		c.Assert(err, IsNil)
+	}
+
+	close(w.unblock)
+	c.Assert(p.Close(), IsNil)
+	c.Assert(w.String(), Equals, "first\n"+big+big)
+}
+
+func (s *SuiteCommon) TestGitUploadPackResponseProgress(c *C) {
+	f, err := os.Open("../../fixtures/upload-pack/fetch-2-side-band.response")
+	c.Assert(err, IsNil)
+
+	progress := bytes.NewBuffer(nil)
+	req := &GitUploadPackRequest{Capabilities: []string{"side-band-64k"}, Progress: progress}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	res, err := NewGitUploadPackResponse(f, req)
+	c.Assert(err, IsNil)
+
+	_, err = ioutil.ReadAll(res)
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Matches, "(?s)Enumerating objects: 30, done.*")
+	c.Assert(res.Close(), IsNil)
+}
@@ -44,6 +44,7 @@ func (s *SuiteCommon) TestNewGitUploadPackService(c *C) {
 		{"http://github.com/src-d/go-git", false, "*http.GitUploadPackService"},
 		{"https://github.com/src-d/go-git", false, "*http.GitUploadPackService"},
 		{"ssh://github.com/src-d/go-git", false, "*ssh.GitUploadPackService"},
+		{"git@github.com:src-d/go-git", false, "*ssh.GitUploadPackService"},
 	}
 
 	for i, t := range tests {
@@ -55,6 +56,29 @@ func (s *SuiteCommon) TestNewGitUploadPackService(c *C) {
 	}
 }
 
+func (s *SuiteCommon) TestNewGitReceivePackService(c *C) {
+	var tests = [...]struct {
+		input string
+		err   bool
+		exp   string
+	}{
+		{"://example.com", true, "<nil>"},
+		{"badscheme://github.com/src-d/go-git", true, "<nil>"},
+		{"http://github.com/src-d/go-git", false, "*http.GitReceivePackService"},
+		{"https://github.com/src-d/go-git", false, "*http.GitReceivePackService"},
+		{"ssh://github.com/src-d/go-git", false, "*ssh.GitReceivePackService"},
+		{"git@github.com:src-d/go-git", false, "*ssh.GitReceivePackService"},
+	}
+
+	for i, t := range tests {
+		output, err := NewGitReceivePackService(t.input)
+		c.Assert(err != nil, Equals, t.err,
+			Commentf("%d) %q: wrong error value (was: %s)", i, t.input, err))
+		c.Assert(typeAsString(output), Equals, t.exp,
+			Commentf("%d) %q: wrong type", i, t.input))
+	}
+}
+
 type dummyProtocolService struct{}
 
 func newDummyProtocolService() common.GitUploadPackService {
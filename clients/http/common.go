@@ -2,8 +2,12 @@
 package http
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"gopkg.in/src-d/go-git.v3/clients/common"
@@ -11,7 +15,126 @@ import (
 	"gopkg.in/src-d/go-git.v3/core"
 )
 
-var InvalidAuthMethodErr = errors.New("invalid http auth method: a http.HTTPAuthMethod should be provided.")
+var (
+	InvalidAuthMethodErr = errors.New("invalid http auth method: a http.HTTPAuthMethod should be provided.")
+	NotSmartHTTPErr      = errors.New("the server does not support the smart http protocol")
+)
+
+// gzipThreshold is the size of the bodies of the requests compressed with
+// gzip, the one git uses.
+const gzipThreshold = 1024
+
+// doRequest sends a request of the smart HTTP protocol for the given
+// service, the advertisement of its references if body is nil, and returns
+// the response if its status is a success. The body is compressed with gzip
+// if compress is true and it is bigger than gzipThreshold. The request, and
+// the reads of the body of the response, are canceled when ctx is done.
+func doRequest(ctx context.Context, c *http.Client, auth HTTPAuthMethod, method, url, service string, body []byte, compress bool) (*http.Response, error) {
+	var r io.Reader
+	var gzipped bool
+	if body != nil {
+		r = bytes.NewReader(body)
+		if compress && len(body) > gzipThreshold {
+			buf, err := gzipBody(body)
+			if err != nil {
+				return nil, core.NewPermanentError(err)
+			}
+
+			r, gzipped = buf, true
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, core.NewPermanentError(err)
+	}
+
+	req.Header.Add("User-Agent", "git/1.0")
+	if body == nil {
+		req.Header.Add("Accept", "*/*")
+	} else {
+		req.Header.Add("Accept", fmt.Sprintf("application/x-%s-result", service))
+		req.Header.Add("Content-Type", fmt.Sprintf("application/x-%s-request", service))
+	}
+
+	if gzipped {
+		req.Header.Add("Content-Encoding", "gzip")
+	}
+
+	if auth != nil {
+		auth.setAuth(req)
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, contextError(ctx, core.NewUnexpectedError(err))
+	}
+
+	if err := NewHTTPError(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// advertisedRefs requests the advertisement of the references of the given
+// service, returning the response, NotSmartHTTPErr is returned if the
+// server only supports the dumb HTTP protocol.
+func advertisedRefs(ctx context.Context, c *http.Client, auth HTTPAuthMethod, endpoint common.Endpoint, service string) (*http.Response, error) {
+	url := fmt.Sprintf("%s/info/refs?service=%s", endpoint, service)
+	res, err := doRequest(ctx, c, auth, "GET", url, service, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-advertisement", service) {
+		res.Body.Close()
+		return nil, core.NewPermanentError(NotSmartHTTPErr)
+	}
+
+	return res, nil
+}
+
+// contextError returns the error of the context if it is done, the one
+// making the request fail, or err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// contextBody is the body of a response whose reads return the error of
+// the context once it is done.
+type contextBody struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (b *contextBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = contextError(b.ctx, err)
+	}
+
+	return n, err
+}
+
+func gzipBody(body []byte) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
 
 type HTTPAuthMethod interface {
 	common.AuthMethod
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+type GitReceivePackService struct {
+	Client *http.Client
+
+	endpoint common.Endpoint
+	auth     HTTPAuthMethod
+}
+
+func NewGitReceivePackService() *GitReceivePackService {
+	return NewGitReceivePackServiceWithClient(http.DefaultClient)
+}
+
+// NewGitReceivePackServiceWithClient returns a new GitReceivePackService
+// sending the requests with the given client, see
+// NewGitUploadPackServiceWithClient.
+func NewGitReceivePackServiceWithClient(c *http.Client) *GitReceivePackService {
+	return &GitReceivePackService{
+		Client: c,
+	}
+}
+
+func (s *GitReceivePackService) Connect(url common.Endpoint) error {
+	s.endpoint = url
+
+	return nil
+}
+
+func (s *GitReceivePackService) ConnectWithAuth(url common.Endpoint, auth common.AuthMethod) error {
+	httpAuth, ok := auth.(HTTPAuthMethod)
+	if !ok {
+		return InvalidAuthMethodErr
+	}
+
+	s.endpoint = url
+	s.auth = httpAuth
+
+	return nil
+}
+
+func (s *GitReceivePackService) Info() (*common.GitReceivePackInfo, error) {
+	return s.InfoContext(context.Background())
+}
+
+// InfoContext is like Info, the request is canceled when ctx is done.
+func (s *GitReceivePackService) InfoContext(ctx context.Context) (*common.GitReceivePackInfo, error) {
+	res, err := advertisedRefs(ctx, s.Client, s.auth, s.endpoint, common.GitReceivePackServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	i := common.NewGitReceivePackInfo()
+	return i, i.Decode(pktline.NewDecoder(&contextBody{ctx, res.Body}))
+}
+
+// SendPack posts the request to git-receive-pack, returning its
+// report-status if the request has the report-status capability,
+// demultiplexed if it has a side-band capability too.
+func (s *GitReceivePackService) SendPack(r *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	return s.SendPackContext(context.Background(), r)
+}
+
+// SendPackContext is like SendPack, the request is canceled when ctx is
+// done.
+func (s *GitReceivePackService) SendPackContext(ctx context.Context, r *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	reader, err := r.Reader()
+	if err != nil {
+		return nil, core.NewPermanentError(err)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, core.NewPermanentError(err)
+	}
+
+	url := fmt.Sprintf("%s/%s", s.endpoint, common.GitReceivePackServiceName)
+	res, err := doRequest(ctx, s.Client, s.auth, "POST", url, common.GitReceivePackServiceName, body, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if !hasCapability(r.Capabilities, "report-status") {
+		return nil, nil
+	}
+
+	var status io.Reader = &contextBody{ctx, res.Body}
+	if hasCapability(r.Capabilities, "side-band-64k") || hasCapability(r.Capabilities, "side-band") {
+		status = common.NewDemuxer(status)
+	}
+
+	report := common.NewReportStatus()
+	if err := report.Decode(pktline.NewDecoder(status)); err != nil {
+		if _, ok := err.(*common.RemoteError); ok {
+			return nil, err
+		}
+
+		return nil, contextError(ctx, core.NewUnexpectedError(err))
+	}
+
+	return report, nil
+}
+
+func hasCapability(capabilities []string, name string) bool {
+	for _, c := range capabilities {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
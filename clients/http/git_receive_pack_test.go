@@ -0,0 +1,121 @@
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+type SuiteReceivePack struct {
+	server *httptest.Server
+	body   string
+}
+
+var _ = Suite(&SuiteReceivePack{})
+
+func (s *SuiteReceivePack) SetUpTest(c *C) {
+	s.body = ""
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repo/info/refs":
+			c.Assert(r.URL.Query().Get("service"), Equals, "git-receive-pack")
+			w.Header().Set("Content-Type", "application/x-git-receive-pack-advertisement")
+			fmt.Fprint(w, "001f# service=git-receive-pack\n0000"+
+				"00596ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\x00report-status delete-refs\n"+
+				"0000")
+		case r.Method == "POST" && r.URL.Path == "/repo/git-receive-pack":
+			c.Assert(r.Header.Get("Content-Type"), Equals, "application/x-git-receive-pack-request")
+			body, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, IsNil)
+			s.body = string(body)
+
+			w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+			if strings.Contains(s.body, "side-band-64k") {
+				fmt.Fprint(w, "000f\x02Resolving\n"+
+					"0030\x01000eunpack ok\n0019ok refs/heads/master\n0000"+
+					"0000")
+				return
+			}
+
+			fmt.Fprint(w, "000eunpack ok\n0019ok refs/heads/master\n0000")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func (s *SuiteReceivePack) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteReceivePack) TestInfo(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.Connect(common.Endpoint(s.server.URL+"/repo")), IsNil)
+
+	info, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(info.Refs, DeepEquals, map[string]core.Hash{
+		"refs/heads/master": core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+	c.Assert(info.Capabilities.Supports("delete-refs"), Equals, true)
+}
+
+func (s *SuiteReceivePack) TestInfoNotFound(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.Connect(common.Endpoint(s.server.URL+"/foo")), IsNil)
+
+	_, err := r.Info()
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *SuiteReceivePack) TestSendPack(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.Connect(common.Endpoint(s.server.URL+"/repo")), IsNil)
+
+	req := &common.GitReceivePackRequest{
+		Commands: []*common.Command{{
+			Name: "refs/heads/master",
+			Old:  core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+			New:  core.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		}},
+		Capabilities: []string{"report-status"},
+		Packfile:     strings.NewReader("PACK"),
+	}
+
+	status, err := r.SendPack(req)
+	c.Assert(err, IsNil)
+	c.Assert(status.Err(), IsNil)
+	c.Assert(status.CommandStatuses, HasLen, 1)
+	c.Assert(s.body, Equals, "00766ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 refs/heads/master\x00report-status\n0000PACK")
+
+	// without report-status nothing is decoded
+	req.Capabilities = nil
+	req.Packfile = strings.NewReader("PACK")
+	status, err = r.SendPack(req)
+	c.Assert(err, IsNil)
+	c.Assert(status, IsNil)
+}
+
+func (s *SuiteReceivePack) TestSendPackSideband(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.Connect(common.Endpoint(s.server.URL+"/repo")), IsNil)
+
+	status, err := r.SendPack(&common.GitReceivePackRequest{
+		Commands: []*common.Command{{
+			Name: "refs/heads/master",
+			Old:  core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		}},
+		Capabilities: []string{"report-status", "side-band-64k"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(status, DeepEquals, &common.ReportStatus{
+		UnpackStatus:    "ok",
+		CommandStatuses: []*common.CommandStatus{{Name: "refs/heads/master", Status: "ok"}},
+	})
+}
@@ -1,10 +1,11 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
-	"strings"
 
 	"gopkg.in/src-d/go-git.v3/clients/common"
 	"gopkg.in/src-d/go-git.v3/core"
@@ -14,13 +15,21 @@ import (
 type GitUploadPackService struct {
 	Client *http.Client
 
-	endpoint common.Endpoint
-	auth     HTTPAuthMethod
+	endpoint     common.Endpoint
+	auth         HTTPAuthMethod
+	capabilities *common.Capabilities
 }
 
 func NewGitUploadPackService() *GitUploadPackService {
+	return NewGitUploadPackServiceWithClient(http.DefaultClient)
+}
+
+// NewGitUploadPackServiceWithClient returns a new GitUploadPackService
+// sending the requests with the given client, configured with the proxies
+// or the TLS settings needed, see clients.InstallProtocol.
+func NewGitUploadPackServiceWithClient(c *http.Client) *GitUploadPackService {
 	return &GitUploadPackService{
-		Client: http.DefaultClient,
+		Client: c,
 	}
 }
 
@@ -43,8 +52,12 @@ func (s *GitUploadPackService) ConnectWithAuth(url common.Endpoint, auth common.
 }
 
 func (s *GitUploadPackService) Info() (*common.GitUploadPackInfo, error) {
-	url := fmt.Sprintf("%s/info/refs?service=%s", s.endpoint, common.GitUploadPackServiceName)
-	res, err := s.doRequest("GET", url, nil)
+	return s.InfoContext(context.Background())
+}
+
+// InfoContext is like Info, the request is canceled when ctx is done.
+func (s *GitUploadPackService) InfoContext(ctx context.Context) (*common.GitUploadPackInfo, error) {
+	res, err := advertisedRefs(ctx, s.Client, s.auth, s.endpoint, common.GitUploadPackServiceName)
 	if err != nil {
 		return nil, err
 	}
@@ -52,67 +65,59 @@ func (s *GitUploadPackService) Info() (*common.GitUploadPackInfo, error) {
 	defer res.Body.Close()
 
 	i := common.NewGitUploadPackInfo()
-	return i, i.Decode(pktline.NewDecoder(res.Body))
-}
-
-func (s *GitUploadPackService) Fetch(r *common.GitUploadPackRequest) (io.ReadCloser, error) {
-	url := fmt.Sprintf("%s/%s", s.endpoint, common.GitUploadPackServiceName)
-	res, err := s.doRequest("POST", url, r.Reader())
-	if err != nil {
+	if err := i.Decode(pktline.NewDecoder(&contextBody{ctx, res.Body})); err != nil {
 		return nil, err
 	}
 
-	h := make([]byte, 8)
-	if _, err := res.Body.Read(h); err != nil {
-		return nil, core.NewUnexpectedError(err)
-	}
-
-	return res.Body, nil
+	s.capabilities = i.Capabilities
+	return i, nil
 }
 
-func (s *GitUploadPackService) doRequest(method, url string, content *strings.Reader) (*http.Response, error) {
-	var body io.Reader
-	if content != nil {
-		body = content
-	}
+// Fetch posts the request to git-upload-pack, returning the packfile of the
+// response as it is read. The side-band-64k capability, or side-band, is
+// requested if the server advertised it, so the packfile is demultiplexed
+// from the progress messages. The request is compressed with gzip if it is
+// big, as git does.
+func (s *GitUploadPackService) Fetch(r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	return s.FetchContext(context.Background(), r)
+}
 
-	req, err := http.NewRequest(method, url, body)
+// FetchContext is like Fetch, the request and the reads of the packfile are
+// canceled when ctx is done.
+func (s *GitUploadPackService) FetchContext(ctx context.Context, r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	req := *r
+	req.Capabilities = append(r.Capabilities[:len(r.Capabilities):len(r.Capabilities)], s.sideband()...)
+	body, err := ioutil.ReadAll(req.Reader())
 	if err != nil {
 		return nil, core.NewPermanentError(err)
 	}
 
-	s.applyHeadersToRequest(req, content)
-	s.applyAuthToRequest(req)
-
-	res, err := s.Client.Do(req)
+	url := fmt.Sprintf("%s/%s", s.endpoint, common.GitUploadPackServiceName)
+	res, err := doRequest(ctx, s.Client, s.auth, "POST", url, common.GitUploadPackServiceName, body, true)
 	if err != nil {
-		return nil, core.NewUnexpectedError(err)
-	}
-
-	if err := NewHTTPError(res); err != nil {
 		return nil, err
 	}
 
-	return res, nil
-}
-
-func (s *GitUploadPackService) applyHeadersToRequest(req *http.Request, content *strings.Reader) {
-	req.Header.Add("User-Agent", "git/1.0")
-	req.Header.Add("Host", "github.com")
-
-	if content == nil {
-		req.Header.Add("Accept", "*/*")
-	} else {
-		req.Header.Add("Accept", "application/x-git-upload-pack-result")
-		req.Header.Add("Content-Type", "application/x-git-upload-pack-request")
-		req.Header.Add("Content-Length", string(content.Len()))
+	rc, err := common.NewGitUploadPackResponse(&contextBody{ctx, res.Body}, &req)
+	if err != nil {
+		res.Body.Close()
+		return nil, contextError(ctx, core.NewUnexpectedError(err))
 	}
+
+	return rc, nil
 }
 
-func (s *GitUploadPackService) applyAuthToRequest(req *http.Request) {
-	if s.auth == nil {
-		return
+// sideband returns the side-band capability requested, the best one the
+// server advertised, if any
+func (s *GitUploadPackService) sideband() []string {
+	switch {
+	case s.capabilities == nil:
+		return nil
+	case s.capabilities.Supports("side-band-64k"):
+		return []string{"side-band-64k"}
+	case s.capabilities.Supports("side-band"):
+		return []string{"side-band"}
+	default:
+		return nil
 	}
-
-	s.auth.setAuth(req)
 }
@@ -0,0 +1,250 @@
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// smartHandler is a smart HTTP server of git-upload-pack serving the
+// advertisement and the responses recorded in fixtures/upload-pack, it
+// stores the last request received, uncompressed. The response is stopped
+// after its first half, until the request is canceled, if stall is true.
+type smartHandler struct {
+	c        *C
+	response string
+	dumb     bool
+	stall    bool
+
+	auth     string
+	encoding string
+	body     string
+}
+
+func (h *smartHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.auth = r.Header.Get("Authorization")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/repo/info/refs" && h.dumb:
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "972eb2a3177a422bd2b0ad4991df73d32e0fc763\trefs/heads/master\n")
+	case r.Method == "GET" && r.URL.Path == "/repo/info/refs" && r.URL.Query().Get("service") == "git-upload-pack":
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		h.serveFile(w, "info-refs")
+	case r.Method == "POST" && r.URL.Path == "/repo/git-upload-pack":
+		h.c.Assert(r.Header.Get("Content-Type"), Equals, "application/x-git-upload-pack-request")
+		var body io.Reader = r.Body
+		h.encoding = r.Header.Get("Content-Encoding")
+		if h.encoding == "gzip" {
+			var err error
+			body, err = gzip.NewReader(r.Body)
+			h.c.Assert(err, IsNil)
+		}
+
+		b, err := ioutil.ReadAll(body)
+		h.c.Assert(err, IsNil)
+		h.body = string(b)
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		if h.stall {
+			h.serveStalled(w, r, h.response)
+			return
+		}
+
+		h.serveFile(w, h.response)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *smartHandler) serveFile(w io.Writer, name string) {
+	b, err := ioutil.ReadFile("../../fixtures/upload-pack/" + name)
+	h.c.Assert(err, IsNil)
+	_, err = w.Write(b)
+	h.c.Assert(err, IsNil)
+}
+
+func (h *smartHandler) serveStalled(w http.ResponseWriter, r *http.Request, name string) {
+	b, err := ioutil.ReadFile("../../fixtures/upload-pack/" + name)
+	h.c.Assert(err, IsNil)
+	_, err = w.Write(b[:len(b)/2])
+	h.c.Assert(err, IsNil)
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
+
+type SuiteSmart struct {
+	handler *smartHandler
+	server  *httptest.Server
+}
+
+var _ = Suite(&SuiteSmart{})
+
+func (s *SuiteSmart) SetUpTest(c *C) {
+	s.handler = &smartHandler{c: c, response: "fetch-2-side-band.response"}
+	s.server = httptest.NewServer(s.handler)
+}
+
+func (s *SuiteSmart) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteSmart) endpoint() common.Endpoint {
+	return common.Endpoint(s.server.URL + "/repo")
+}
+
+func (s *SuiteSmart) TestInfo(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+
+	info, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(info.Head, Equals, core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+	c.Assert(info.Refs, HasLen, 2)
+	c.Assert(info.Capabilities.SymbolicReference("HEAD"), Equals, "refs/heads/master")
+}
+
+func (s *SuiteSmart) TestInfoDumb(c *C) {
+	s.handler.dumb = true
+
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+
+	_, err := r.Info()
+	c.Assert(err, DeepEquals, core.NewPermanentError(NotSmartHTTPErr))
+}
+
+func (s *SuiteSmart) TestInfoNotFound(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(common.Endpoint(s.server.URL+"/foo")), IsNil)
+
+	_, err := r.Info()
+	c.Assert(err, DeepEquals, core.NewPermanentError(common.NotFoundErr))
+}
+
+// the side-band-64k capability advertised is requested, see
+// fixtures/upload-pack/fetch-2-side-band.request
+func (s *SuiteSmart) TestFetchSideband(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+	_, err := r.Info()
+	c.Assert(err, IsNil)
+
+	req := &common.GitUploadPackRequest{Capabilities: []string{"thin-pack", "ofs-delta"}}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	req.Want(core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+	req.Have(core.NewHash("053869ce909291337e76ac4e5e989d52b8a12f21"))
+	req.Have(core.NewHash("d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a"))
+
+	reader, err := r.Fetch(req)
+	c.Assert(err, IsNil)
+	pack, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(reader.Close(), IsNil)
+
+	expected, err := ioutil.ReadFile("../../fixtures/upload-pack/fetch-2-side-band.request")
+	c.Assert(err, IsNil)
+	c.Assert(s.handler.body, Equals, string(expected))
+	c.Assert(s.handler.encoding, Equals, "")
+	c.Assert(req.Capabilities, HasLen, 2)
+
+	c.Assert(string(pack[:4]), Equals, "PACK")
+	c.Assert(strings.Contains(string(pack), "Enumerating objects"), Equals, false)
+}
+
+func (s *SuiteSmart) TestFetchGzip(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+
+	req := &common.GitUploadPackRequest{}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	for i := 0; i < 50; i++ {
+		req.Have(core.NewHash("053869ce909291337e76ac4e5e989d52b8a12f21"))
+	}
+
+	s.handler.response = "fetch-2.response"
+	reader, err := r.Fetch(req)
+	c.Assert(err, IsNil)
+	c.Assert(reader.Close(), IsNil)
+	c.Assert(s.handler.encoding, Equals, "gzip")
+	c.Assert(s.handler.body, Equals, req.String())
+}
+
+func (s *SuiteSmart) TestBasicAuth(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.endpoint(), NewBasicAuth("foo", "bar")), IsNil)
+
+	_, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(s.handler.auth, Equals, "Basic Zm9vOmJhcg==")
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (s *SuiteSmart) TestClient(c *C) {
+	t := &countingTransport{}
+	r := NewGitUploadPackServiceWithClient(&http.Client{Transport: t})
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+
+	_, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(t.requests, Equals, 1)
+
+	rp := NewGitReceivePackServiceWithClient(&http.Client{Transport: t})
+	c.Assert(rp.Connect(s.endpoint()), IsNil)
+	_, err = rp.Info()
+	c.Assert(err, DeepEquals, core.NewPermanentError(common.NotFoundErr))
+	c.Assert(t.requests, Equals, 2)
+}
+
+func (s *SuiteSmart) TestFetchContextCanceled(c *C) {
+	s.handler.stall = true
+
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+	_, err := r.Info()
+	c.Assert(err, IsNil)
+
+	req := &common.GitUploadPackRequest{}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := r.FetchContext(ctx, req)
+	c.Assert(err, IsNil)
+
+	start := time.Now()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+	c.Assert(reader.Close(), IsNil)
+
+	_, err = r.FetchContext(ctx, req)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *SuiteSmart) TestInfoContextDeadline(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.Connect(s.endpoint()), IsNil)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := r.InfoContext(ctx)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
@@ -1,18 +1,35 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"gopkg.in/src-d/go-git.v3/clients/common"
 )
 
+var (
+	// ErrSSHAgentNotFound is returned by NewSSHAgentAuth when there is no
+	// SSH agent running, SSH_AUTH_SOCK not being set.
+	ErrSSHAgentNotFound = errors.New("SSH agent not found: SSH_AUTH_SOCK is not set")
+	// ErrKnownHostsNotFound is returned by NewKnownHostsCallback when none
+	// of the known_hosts files exist.
+	ErrKnownHostsNotFound = errors.New("known_hosts files not found")
+)
+
 // AuthMethod is the interface all auth methods for the ssh client
 // must implement. The clientConfig method returns the ssh client
 // configuration needed to establish an ssh connection.
 type AuthMethod interface {
 	common.AuthMethod
-	clientConfig() *ssh.ClientConfig
+	clientConfig() (*ssh.ClientConfig, error)
 }
 
 // The names of the AuthMethod implementations. To be returned by the
@@ -31,6 +48,7 @@ const (
 type KeyboardInteractive struct {
 	User      string
 	Challenge ssh.KeyboardInteractiveChallenge
+	HostKeyCallbackHelper
 }
 
 func (a *KeyboardInteractive) Name() string {
@@ -41,17 +59,18 @@ func (a *KeyboardInteractive) String() string {
 	return fmt.Sprintf("user: %s, name: %s", a.User, a.Name())
 }
 
-func (a *KeyboardInteractive) clientConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
+func (a *KeyboardInteractive) clientConfig() (*ssh.ClientConfig, error) {
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
 		User: a.User,
 		Auth: []ssh.AuthMethod{ssh.KeyboardInteractiveChallenge(a.Challenge)},
-	}
+	})
 }
 
 // Password implements AuthMethod by using the given password.
 type Password struct {
 	User string
 	Pass string
+	HostKeyCallbackHelper
 }
 
 func (a *Password) Name() string {
@@ -62,11 +81,11 @@ func (a *Password) String() string {
 	return fmt.Sprintf("user: %s, name: %s", a.User, a.Name())
 }
 
-func (a *Password) clientConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
+func (a *Password) clientConfig() (*ssh.ClientConfig, error) {
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
 		User: a.User,
 		Auth: []ssh.AuthMethod{ssh.Password(a.Pass)},
-	}
+	})
 }
 
 // PasswordCallback implements AuthMethod by using a callback
@@ -74,6 +93,7 @@ func (a *Password) clientConfig() *ssh.ClientConfig {
 type PasswordCallback struct {
 	User     string
 	Callback func() (pass string, err error)
+	HostKeyCallbackHelper
 }
 
 func (a *PasswordCallback) Name() string {
@@ -84,11 +104,40 @@ func (a *PasswordCallback) String() string {
 	return fmt.Sprintf("user: %s, name: %s", a.User, a.Name())
 }
 
-func (a *PasswordCallback) clientConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
+func (a *PasswordCallback) clientConfig() (*ssh.ClientConfig, error) {
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
 		User: a.User,
 		Auth: []ssh.AuthMethod{ssh.PasswordCallback(a.Callback)},
+	})
+}
+
+// NewPublicKeys returns a PublicKeys with the signer of the given PEM
+// encoded private key, decrypted with the password if it is not empty.
+func NewPublicKeys(user string, pemBytes []byte, password string) (*PublicKeys, error) {
+	var signer ssh.Signer
+	var err error
+	if password == "" {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	} else {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(password))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKeys{User: user, Signer: signer}, nil
+}
+
+// NewPublicKeysFromFile returns a PublicKeys with the signer of the PEM
+// encoded private key in the given file, see NewPublicKeys.
+func NewPublicKeysFromFile(user, pemFile, password string) (*PublicKeys, error) {
+	pemBytes, err := ioutil.ReadFile(pemFile)
+	if err != nil {
+		return nil, err
 	}
+
+	return NewPublicKeys(user, pemBytes, password)
 }
 
 // PublicKeys implements AuthMethod by using the given
@@ -96,6 +145,7 @@ func (a *PasswordCallback) clientConfig() *ssh.ClientConfig {
 type PublicKeys struct {
 	User   string
 	Signer ssh.Signer
+	HostKeyCallbackHelper
 }
 
 func (a *PublicKeys) Name() string {
@@ -106,11 +156,11 @@ func (a *PublicKeys) String() string {
 	return fmt.Sprintf("user: %s, name: %s", a.User, a.Name())
 }
 
-func (a *PublicKeys) clientConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
+func (a *PublicKeys) clientConfig() (*ssh.ClientConfig, error) {
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
 		User: a.User,
 		Auth: []ssh.AuthMethod{ssh.PublicKeys(a.Signer)},
-	}
+	})
 }
 
 // PublicKeysCallback implements AuthMethod by asking a
@@ -118,6 +168,7 @@ func (a *PublicKeys) clientConfig() *ssh.ClientConfig {
 type PublicKeysCallback struct {
 	User     string
 	Callback func() (signers []ssh.Signer, err error)
+	HostKeyCallbackHelper
 }
 
 func (a *PublicKeysCallback) Name() string {
@@ -128,9 +179,97 @@ func (a *PublicKeysCallback) String() string {
 	return fmt.Sprintf("user: %s, name: %s", a.User, a.Name())
 }
 
-func (a *PublicKeysCallback) clientConfig() *ssh.ClientConfig {
-	return &ssh.ClientConfig{
+func (a *PublicKeysCallback) clientConfig() (*ssh.ClientConfig, error) {
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
 		User: a.User,
 		Auth: []ssh.AuthMethod{ssh.PublicKeysCallback(a.Callback)},
+	})
+}
+
+// NewSSHAgentAuth returns a PublicKeysCallback using the keys of the SSH
+// agent listening in SSH_AUTH_SOCK, ErrSSHAgentNotFound is returned if it
+// is not set. The connection with the agent is kept open.
+func NewSSHAgentAuth(user string) (*PublicKeysCallback, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, ErrSSHAgentNotFound
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKeysCallback{
+		User:     user,
+		Callback: agent.NewClient(conn).Signers,
+	}, nil
+}
+
+// HostKeyCallbackHelper is embedded by the AuthMethod implementations to
+// configure the verification of the key of the server.
+type HostKeyCallbackHelper struct {
+	// HostKeyCallback is called to verify the key of the server, if nil
+	// the one returned by NewKnownHostsCallback without arguments is used.
+	// ssh.InsecureIgnoreHostKey accepts any key, it should only be used in
+	// tests.
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// SetHostKeyCallback sets the HostKeyCallback of the given config, or the
+// default one if it is nil.
+func (h *HostKeyCallbackHelper) SetHostKeyCallback(config *ssh.ClientConfig) (*ssh.ClientConfig, error) {
+	if h.HostKeyCallback == nil {
+		var err error
+		if h.HostKeyCallback, err = NewKnownHostsCallback(); err != nil {
+			return nil, err
+		}
+	}
+
+	config.HostKeyCallback = h.HostKeyCallback
+	return config, nil
+}
+
+// NewKnownHostsCallback returns a callback verifying the keys of the servers
+// with the given known_hosts files, as OpenSSH does. If no files are given,
+// the ones in SSH_KNOWN_HOSTS, separated by the path list separator, are
+// used, or the default ones, ~/.ssh/known_hosts and
+// /etc/ssh/ssh_known_hosts, that exist.
+func NewKnownHostsCallback(files ...string) (ssh.HostKeyCallback, error) {
+	if len(files) == 0 {
+		var err error
+		if files, err = defaultKnownHosts(); err != nil {
+			return nil, err
+		}
+	}
+
+	return knownhosts.New(files...)
+}
+
+func defaultKnownHosts() ([]string, error) {
+	if env := os.Getenv("SSH_KNOWN_HOSTS"); env != "" {
+		return filepath.SplitList(env), nil
+	}
+
+	var candidates []string
+	if u, err := user.Current(); err == nil {
+		candidates = append(candidates, filepath.Join(u.HomeDir, ".ssh", "known_hosts"))
+	} else if home := os.Getenv("HOME"); home != "" {
+		candidates = append(candidates, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+
+	candidates = append(candidates, "/etc/ssh/ssh_known_hosts")
+
+	var files []string
+	for _, f := range candidates {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
 	}
+
+	if len(files) == 0 {
+		return nil, ErrKnownHostsNotFound
+	}
+
+	return files, nil
 }
@@ -0,0 +1,228 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+)
+
+// DefaultPort is the port of the ssh servers used if the URL has none.
+const DefaultPort = "22"
+
+// scpLikeURL matches the scp-like syntax of the ssh URLs, [user@]host:path
+var scpLikeURL = regexp.MustCompile(`^(?:([^@/:]+)@)?([^@/:]+):(.+)$`)
+
+// endpoint is the location of a repository reached through ssh.
+type endpoint struct {
+	user string
+	host string
+	port string
+	path string
+}
+
+// parseEndpoint parses the ssh URLs, ssh://[user@]host[:port]/path, and the
+// scp-like ones, [user@]host:path, whose path is relative to the home of
+// the user. ErrInvalidEndpoint is returned for any other URL.
+func parseEndpoint(ep common.Endpoint) (*endpoint, error) {
+	raw := string(ep)
+	if !strings.Contains(raw, "://") {
+		m := scpLikeURL.FindStringSubmatch(raw)
+		if m == nil {
+			return nil, ErrInvalidEndpoint
+		}
+
+		return &endpoint{user: m[1], host: m[2], port: DefaultPort, path: m[3]}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "ssh" || u.Host == "" || u.Path == "" {
+		return nil, ErrInvalidEndpoint
+	}
+
+	e := &endpoint{host: u.Host, port: DefaultPort, path: u.Path}
+	if host, port, err := net.SplitHostPort(u.Host); err == nil {
+		e.host, e.port = host, port
+	}
+
+	if u.User != nil {
+		e.user = u.User.Username()
+	}
+
+	// the paths relative to the home of a user, /~user/path, as git does
+	if strings.HasPrefix(e.path, "/~") {
+		e.path = e.path[1:]
+	}
+
+	return e, nil
+}
+
+func (e *endpoint) address() string {
+	return net.JoinHostPort(e.host, e.port)
+}
+
+// command returns the command running the given service for the
+// repository, with its path quoted for the shell of the server.
+func (e *endpoint) command(service string) string {
+	return fmt.Sprintf("%s '%s'", service, strings.Replace(e.path, "'", `'\''`, -1))
+}
+
+// client is the ssh connection shared by the services, established with
+// ConnectWithAuth.
+type client struct {
+	connected bool
+	endpoint  *endpoint
+	client    *ssh.Client
+	auth      AuthMethod
+}
+
+// Connect cannot be used with SSH clients and always return
+// ErrAuthRequired. Use ConnectWithAuth instead.
+func (c *client) Connect(ep common.Endpoint) error {
+	return ErrAuthRequired
+}
+
+// ConnectWithAuth connects to ep using SSH. Authentication is handled
+// by auth, the user of the URL is used if auth has none.
+func (c *client) ConnectWithAuth(ep common.Endpoint, auth common.AuthMethod) error {
+	if c.connected {
+		return ErrAlreadyConnected
+	}
+
+	e, err := parseEndpoint(ep)
+	if err != nil {
+		return err
+	}
+
+	a, ok := auth.(AuthMethod)
+	if !ok {
+		return ErrInvalidAuthMethod
+	}
+
+	config, err := a.clientConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.User == "" {
+		config.User = e.user
+	}
+
+	sc, err := ssh.Dial("tcp", e.address(), config)
+	if err != nil {
+		return err
+	}
+
+	c.endpoint, c.auth, c.client = e, a, sc
+	c.connected = true
+	return nil
+}
+
+// Disconnect the SSH client.
+func (c *client) Disconnect() error {
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	c.connected = false
+	return c.client.Close()
+}
+
+// session is a service running in the server, its standard input and
+// output are the ones of the protocol. The session is closed as soon as its
+// context is done, making its reads and writes fail.
+type session struct {
+	*ssh.Session
+	stdin  io.WriteCloser
+	stdout io.Reader
+	ctx    context.Context
+	stop   chan struct{}
+}
+
+// start runs the service for the repository in a new session, closed when
+// ctx is done. The references advertised are read by the caller from its
+// stdout.
+func (c *client) start(ctx context.Context, service string) (*session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !c.connected {
+		return nil, ErrNotConnected
+	}
+
+	s, err := c.client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	stdin, err := s.StdinPipe()
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	stdout, err := s.StdoutPipe()
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	if err := s.Start(c.endpoint.command(service)); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	session := &session{
+		Session: s,
+		stdin:   stdin,
+		stdout:  stdout,
+		ctx:     ctx,
+		stop:    make(chan struct{}),
+	}
+
+	go session.watch()
+	return session, nil
+}
+
+// watch closes the session once its context is done, until it is closed.
+func (s *session) watch() {
+	select {
+	case <-s.ctx.Done():
+		_ = s.Session.Close()
+	case <-s.stop:
+	}
+}
+
+// err returns the error of the context of the session if it is done, the
+// one making the session fail, or err otherwise.
+func (s *session) err(err error) error {
+	if err != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+
+	return err
+}
+
+// Close waits for the service to exit, discarding its output not read yet,
+// and closes the session. The session can be closed by the other endpoint,
+// therefore a close error is ignored.
+func (s *session) Close() error {
+	close(s.stop)
+	_ = s.stdin.Close()
+	if _, err := io.Copy(ioutil.Discard, s.stdout); err != nil {
+		_ = s.Session.Close()
+		return s.err(err)
+	}
+
+	err := s.Wait()
+	_ = s.Session.Close()
+	return s.err(err)
+}
@@ -0,0 +1,527 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+func (s *SuiteCommon) TestParseEndpoint(c *C) {
+	var tests = [...]struct {
+		input string
+		exp   endpoint
+	}{
+		{"ssh://git@github.com/user/repository.git", endpoint{"git", "github.com", "22", "/user/repository.git"}},
+		{"ssh://example.com:2222/var/repository", endpoint{"", "example.com", "2222", "/var/repository"}},
+		{"ssh://git@example.com/~user/repository", endpoint{"git", "example.com", "22", "~user/repository"}},
+		{"git@github.com:user/repository.git", endpoint{"git", "github.com", "22", "user/repository.git"}},
+		{"example.com:/var/repository", endpoint{"", "example.com", "22", "/var/repository"}},
+	}
+
+	for i, t := range tests {
+		e, err := parseEndpoint(common.Endpoint(t.input))
+		c.Assert(err, IsNil, Commentf("%d) %q", i, t.input))
+		c.Assert(*e, Equals, t.exp, Commentf("%d) %q", i, t.input))
+	}
+}
+
+func (s *SuiteCommon) TestParseEndpointInvalid(c *C) {
+	for _, input := range []string{
+		"https://github.com/user/repository.git",
+		"ssh://github.com",
+		"/var/repository",
+		"repository",
+	} {
+		_, err := parseEndpoint(common.Endpoint(input))
+		c.Assert(err, Equals, ErrInvalidEndpoint, Commentf("%q", input))
+	}
+}
+
+func (s *SuiteCommon) TestEndpointCommand(c *C) {
+	e := &endpoint{path: "/var/it's a repository"}
+	c.Assert(e.command("git-upload-pack"), Equals, `git-upload-pack '/var/it'\''s a repository'`)
+}
+
+// server is a ssh server running the git services of a fake repository,
+// the upload-pack one answers with the responses recorded in
+// fixtures/upload-pack, the receive-pack one accepts any command.
+type server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.Signer
+
+	// stall, if not nil, stops the upload-pack response after its first
+	// half until it is closed
+	stall chan struct{}
+
+	sync.Mutex
+	commands []string
+	request  string
+	pack     []byte
+}
+
+func newServer(c *C, clientKey ssh.PublicKey) *server {
+	return newServerAt(c, "127.0.0.1:0", clientKey)
+}
+
+// newServerAt returns a new server listening in the given address, with a
+// new host key, accepting the given key of the client.
+func newServerAt(c *C, addr string, clientKey ssh.PublicKey) *server {
+	l, err := net.Listen("tcp", addr)
+	c.Assert(err, IsNil)
+
+	s := &server{listener: l, hostKey: newSigner(c)}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(m ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if m.User() == "git" && string(pass) == "secret" {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("wrong password for %q", m.User())
+		},
+		PublicKeyCallback: func(m ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("unknown public key for %q", m.User())
+		},
+	}
+	s.config.AddHostKey(s.hostKey)
+
+	go s.serve()
+	return s
+}
+
+func newSigner(c *C) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	signer, err := ssh.NewSignerFromKey(key)
+	c.Assert(err, IsNil)
+	return signer
+}
+
+func (s *server) endpoint(path string) common.Endpoint {
+	return common.Endpoint(fmt.Sprintf("ssh://git@%s%s", s.listener.Addr(), path))
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *server) handleConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handleSession(ch, reqs)
+	}
+}
+
+func (s *server) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+
+		req.Reply(true, nil)
+		s.Lock()
+		s.commands = append(s.commands, exec.Command)
+		s.Unlock()
+
+		status := s.run(exec.Command, ch)
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func (s *server) run(command string, ch ssh.Channel) uint32 {
+	switch {
+	case strings.HasPrefix(command, "git-upload-pack '/repo'"):
+		return s.uploadPack(ch)
+	case strings.HasPrefix(command, "git-receive-pack '/repo'"):
+		return s.receivePack(ch)
+	default:
+		fmt.Fprintf(ch.Stderr(), "fatal: %s: not found\n", command)
+		return 128
+	}
+}
+
+func (s *server) uploadPack(ch ssh.Channel) uint32 {
+	adv, err := ioutil.ReadFile("../../fixtures/upload-pack/info-refs")
+	if err != nil {
+		return 1
+	}
+
+	// the service block is only sent by the smart HTTP servers
+	if _, err := ch.Write(adv[bytes.Index(adv, []byte("0000"))+4:]); err != nil {
+		return 1
+	}
+
+	d := pktline.NewDecoder(ch)
+	request := ""
+	for {
+		line, err := d.ReadLine()
+		if err != nil {
+			return 1
+		}
+
+		if line == "" && request == "" {
+			return 0
+		}
+
+		if line == "" {
+			request += "0000"
+			continue
+		}
+
+		raw, _ := pktline.EncodeFromString(line)
+		request += raw
+		if line == "done\n" {
+			break
+		}
+	}
+
+	s.Lock()
+	s.request = request
+	s.Unlock()
+
+	res, err := ioutil.ReadFile("../../fixtures/upload-pack/fetch-2-side-band.response")
+	if err != nil {
+		return 1
+	}
+
+	s.Lock()
+	stall := s.stall
+	s.Unlock()
+
+	if stall != nil {
+		if _, err := ch.Write(res[:len(res)/2]); err != nil {
+			return 1
+		}
+
+		<-stall
+		res = res[len(res)/2:]
+	}
+
+	if _, err := ch.Write(res); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *server) receivePack(ch ssh.Channel) uint32 {
+	adv := "004d972eb2a3177a422bd2b0ad4991df73d32e0fc763 refs/heads/master\x00report-status\n0000"
+	if _, err := io.WriteString(ch, adv); err != nil {
+		return 1
+	}
+
+	d := pktline.NewDecoder(ch)
+	commands, err := d.ReadBlock()
+	if err != nil {
+		return 1
+	}
+
+	if len(commands) == 0 {
+		return 0
+	}
+
+	pack, err := ioutil.ReadAll(ch)
+	if err != nil {
+		return 1
+	}
+
+	s.Lock()
+	s.pack = pack
+	s.Unlock()
+
+	e := pktline.NewEncoder()
+	e.AddLine("unpack ok")
+	for _, command := range commands {
+		parts := strings.Fields(strings.Replace(command, "\x00", " ", 1))
+		e.AddLine("ok " + parts[2])
+	}
+
+	e.AddFlush()
+	if _, err := io.Copy(ch, e.Reader()); err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+func (s *server) Close() error {
+	return s.listener.Close()
+}
+
+type SuiteServer struct {
+	clientKey ssh.Signer
+	server    *server
+}
+
+var _ = Suite(&SuiteServer{})
+
+func (s *SuiteServer) SetUpTest(c *C) {
+	s.clientKey = newSigner(c)
+	s.server = newServer(c, s.clientKey.PublicKey())
+}
+
+func (s *SuiteServer) TearDownTest(c *C) {
+	c.Assert(s.server.Close(), IsNil)
+}
+
+func (s *SuiteServer) password(pass string) *Password {
+	auth := &Password{User: "git", Pass: pass}
+	auth.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	return auth
+}
+
+func (s *SuiteServer) TestInfo(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	info, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(info.Head, Equals, core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+	c.Assert(info.Refs, HasLen, 2)
+	c.Assert(s.server.commands, DeepEquals, []string{"git-upload-pack '/repo'"})
+}
+
+func (s *SuiteServer) TestInfoNotFound(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/foo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	_, err := r.Info()
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteServer) TestFetch(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	req := &common.GitUploadPackRequest{Capabilities: []string{"thin-pack", "ofs-delta", "side-band-64k"}}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	req.Want(core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+	req.Have(core.NewHash("053869ce909291337e76ac4e5e989d52b8a12f21"))
+	req.Have(core.NewHash("d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a"))
+
+	reader, err := r.Fetch(req)
+	c.Assert(err, IsNil)
+	pack, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(reader.Close(), IsNil)
+	c.Assert(string(pack[:4]), Equals, "PACK")
+
+	expected, err := ioutil.ReadFile("../../fixtures/upload-pack/fetch-2-side-band.request")
+	c.Assert(err, IsNil)
+	c.Assert(s.server.request, Equals, string(expected))
+}
+
+func (s *SuiteServer) TestFetchClosedEarly(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	req := &common.GitUploadPackRequest{}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+	req.Have(core.NewHash("053869ce909291337e76ac4e5e989d52b8a12f21"))
+
+	reader, err := r.Fetch(req)
+	c.Assert(err, IsNil)
+	c.Assert(reader.Close(), IsNil)
+
+	_, err = r.Info()
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteServer) TestFetchContextCanceled(c *C) {
+	stall := make(chan struct{})
+	defer close(stall)
+	s.server.Lock()
+	s.server.stall = stall
+	s.server.Unlock()
+
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	req := &common.GitUploadPackRequest{Capabilities: []string{"side-band-64k"}}
+	req.Want(core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := r.FetchContext(ctx, req)
+	c.Assert(err, IsNil)
+
+	start := time.Now()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = ioutil.ReadAll(reader)
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(reader.Close(), Equals, context.Canceled)
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+
+	_, err = r.InfoContext(ctx)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *SuiteServer) TestConnectWrongPassword(c *C) {
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("foo")), ErrorMatches, ".*unable to authenticate.*")
+	c.Assert(r.connected, Equals, false)
+}
+
+func (s *SuiteServer) TestConnectPublicKeys(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	file := filepath.Join(c.MkDir(), "id_ecdsa")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	c.Assert(ioutil.WriteFile(file, pemBytes, 0600), IsNil)
+
+	auth, err := NewPublicKeysFromFile("git", file, "")
+	c.Assert(err, IsNil)
+	auth.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), auth), ErrorMatches, ".*unable to authenticate.*")
+
+	s.server.Close()
+	s.server = newServer(c, auth.Signer.PublicKey())
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), auth), IsNil)
+	c.Assert(r.Disconnect(), IsNil)
+}
+
+func (s *SuiteServer) TestNewPublicKeysInvalid(c *C) {
+	_, err := NewPublicKeys("git", []byte("foo"), "")
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteServer) TestConnectSSHAgent(c *C) {
+	keyring := agent.NewKeyring()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	c.Assert(keyring.Add(agent.AddedKey{PrivateKey: key}), IsNil)
+
+	sock := filepath.Join(c.MkDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	c.Assert(os.Setenv("SSH_AUTH_SOCK", sock), IsNil)
+	auth, err := NewSSHAgentAuth("git")
+	c.Assert(err, IsNil)
+	auth.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+
+	signer, err := ssh.NewSignerFromKey(key)
+	c.Assert(err, IsNil)
+	s.server.Close()
+	s.server = newServer(c, signer.PublicKey())
+
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), auth), IsNil)
+	c.Assert(r.Disconnect(), IsNil)
+}
+
+func (s *SuiteServer) TestNewSSHAgentAuthNotFound(c *C) {
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	c.Assert(os.Setenv("SSH_AUTH_SOCK", ""), IsNil)
+
+	_, err := NewSSHAgentAuth("git")
+	c.Assert(err, Equals, ErrSSHAgentNotFound)
+}
+
+func (s *SuiteServer) TestConnectKnownHosts(c *C) {
+	addr := s.server.listener.Addr().String()
+	file := filepath.Join(c.MkDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, s.server.hostKey.PublicKey())
+	c.Assert(ioutil.WriteFile(file, []byte(line+"\n"), 0600), IsNil)
+
+	callback, err := NewKnownHostsCallback(file)
+	c.Assert(err, IsNil)
+	auth := &Password{User: "git", Pass: "secret"}
+	auth.HostKeyCallback = callback
+
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), auth), IsNil)
+	c.Assert(r.Disconnect(), IsNil)
+
+	// the same address, with a different key
+	s.server.Close()
+	s.server = newServerAt(c, addr, s.clientKey.PublicKey())
+
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), auth), ErrorMatches, ".*key mismatch.*")
+}
+
+func (s *SuiteServer) TestKnownHostsNotFound(c *C) {
+	defer os.Setenv("SSH_KNOWN_HOSTS", os.Getenv("SSH_KNOWN_HOSTS"))
+	c.Assert(os.Setenv("SSH_KNOWN_HOSTS", filepath.Join(c.MkDir(), "known_hosts")), IsNil)
+
+	r := NewGitUploadPackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), &Password{User: "git", Pass: "secret"}), NotNil)
+}
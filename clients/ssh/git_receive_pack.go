@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"context"
+	"io"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/formats/pktline"
+)
+
+// GitReceivePackService pushes to a repository running git-receive-pack
+// through ssh. The zero value is safe to use.
+type GitReceivePackService struct {
+	client
+}
+
+// NewGitReceivePackService initialises a GitReceivePackService.
+func NewGitReceivePackService() *GitReceivePackService {
+	return &GitReceivePackService{}
+}
+
+// Info returns the GitReceivePackInfo of the repository, the service must
+// be connected with ConnectWithAuth.
+func (s *GitReceivePackService) Info() (*common.GitReceivePackInfo, error) {
+	return s.InfoContext(context.Background())
+}
+
+// InfoContext is like Info, the session is closed when ctx is done.
+func (s *GitReceivePackService) InfoContext(ctx context.Context) (*common.GitReceivePackInfo, error) {
+	session, err := s.start(ctx, common.GitReceivePackServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	i := common.NewGitReceivePackInfo()
+	if err := i.Decode(pktline.NewDecoder(session.stdout)); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	// a flush-pkt ends the session without updating anything
+	if _, err := io.WriteString(session.stdin, "0000"); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	return i, session.Close()
+}
+
+// SendPack sends the commands and the packfile of the request in a new
+// session, returning the report-status if the request has the
+// report-status capability, demultiplexed if it has a side-band capability
+// too.
+func (s *GitReceivePackService) SendPack(r *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	return s.SendPackContext(context.Background(), r)
+}
+
+// SendPackContext is like SendPack, the session is closed when ctx is done.
+func (s *GitReceivePackService) SendPackContext(ctx context.Context, r *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	session, err := s.start(ctx, common.GitReceivePackServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := skipAdvertisement(session.stdout); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	reader, err := r.Reader()
+	if err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	if _, err := io.Copy(session.stdin, reader); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	// the end of the packfile is the end of the input
+	if err := session.stdin.Close(); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	if !hasCapability(r.Capabilities, "report-status") {
+		return nil, session.Close()
+	}
+
+	var status io.Reader = session.stdout
+	if hasCapability(r.Capabilities, "side-band-64k") || hasCapability(r.Capabilities, "side-band") {
+		status = common.NewDemuxer(session.stdout)
+	}
+
+	report := common.NewReportStatus()
+	if err := report.Decode(pktline.NewDecoder(status)); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
+	}
+
+	return report, session.Close()
+}
+
+func hasCapability(capabilities []string, name string) bool {
+	for _, c := range capabilities {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package ssh
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+func (s *SuiteServer) TestReceivePackInfo(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	info, err := r.Info()
+	c.Assert(err, IsNil)
+	c.Assert(info.Refs["refs/heads/master"], Equals, core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+	c.Assert(info.Capabilities.Supports("report-status"), Equals, true)
+	c.Assert(s.server.commands, DeepEquals, []string{"git-receive-pack '/repo'"})
+}
+
+func (s *SuiteServer) TestSendPack(c *C) {
+	r := NewGitReceivePackService()
+	c.Assert(r.ConnectWithAuth(s.server.endpoint("/repo"), s.password("secret")), IsNil)
+	defer func() { c.Assert(r.Disconnect(), IsNil) }()
+
+	pack := []byte("PACK fake")
+	req := &common.GitReceivePackRequest{
+		Commands: []*common.Command{{
+			Name: "refs/heads/master",
+			Old:  core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"),
+			New:  core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575"),
+		}},
+		Capabilities: []string{"report-status"},
+		Packfile:     bytes.NewReader(pack),
+	}
+
+	report, err := r.SendPack(req)
+	c.Assert(err, IsNil)
+	c.Assert(report.Err(), IsNil)
+	c.Assert(report.CommandStatuses, HasLen, 1)
+	c.Assert(s.server.pack, DeepEquals, pack)
+}
@@ -4,19 +4,12 @@
 package ssh
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"net/url"
 
 	"gopkg.in/src-d/go-git.v3/clients/common"
 	"gopkg.in/src-d/go-git.v3/formats/pktline"
-
-	"gopkg.in/sourcegraph/go-vcsurl.v1"
-	"golang.org/x/crypto/ssh"
 )
 
 // New errors introduced by this package.
@@ -26,18 +19,14 @@ var (
 	ErrNotConnected           = errors.New("not connected")
 	ErrAlreadyConnected       = errors.New("already connected")
 	ErrUploadPackAnswerFormat = errors.New("git-upload-pack bad answer format")
-	ErrUnsupportedVCS         = errors.New("only git is supported")
-	ErrUnsupportedRepo        = errors.New("only github.com is supported")
+	ErrInvalidEndpoint        = errors.New("invalid ssh endpoint")
 )
 
 // GitUploadPackService holds the service information.
 // The zero value is safe to use.
 // TODO: remove NewGitUploadPackService().
 type GitUploadPackService struct {
-	connected bool
-	vcs       *vcsurl.RepoInfo
-	client    *ssh.Client
-	auth      AuthMethod
+	client
 }
 
 // NewGitUploadPackService initialises a GitUploadPackService.
@@ -46,160 +35,93 @@ func NewGitUploadPackService() *GitUploadPackService {
 	return &GitUploadPackService{}
 }
 
-// Connect cannot be used with SSH clients and always return
-// ErrAuthRequired. Use ConnectWithAuth instead.
-func (s *GitUploadPackService) Connect(ep common.Endpoint) (err error) {
-	return ErrAuthRequired
-}
-
-// ConnectWithAuth connects to ep using SSH. Authentication is handled
-// by auth.
-func (s *GitUploadPackService) ConnectWithAuth(ep common.Endpoint, auth common.AuthMethod) (err error) {
-	if s.connected {
-		return ErrAlreadyConnected
-	}
-
-	s.vcs, err = vcsurl.Parse(string(ep))
-	if err != nil {
-		return err
-	}
-
-	url, err := vcsToURL(s.vcs)
-	if err != nil {
-		return
-	}
-
-	var ok bool
-	s.auth, ok = auth.(AuthMethod)
-	if !ok {
-		return ErrInvalidAuthMethod
-	}
-
-	s.client, err = ssh.Dial("tcp", url.Host, s.auth.clientConfig())
-	if err != nil {
-		return err
-	}
-
-	s.connected = true
-	return
-}
-
-func vcsToURL(vcs *vcsurl.RepoInfo) (u *url.URL, err error) {
-	if vcs.VCS != vcsurl.Git {
-		return nil, ErrUnsupportedVCS
-	}
-	if vcs.RepoHost != vcsurl.GitHub {
-		return nil, ErrUnsupportedRepo
-	}
-	s := "ssh://git@" + string(vcs.RepoHost) + ":22/" + vcs.FullName
-	u, err = url.Parse(s)
-	return
-}
-
 // Info returns the GitUploadPackInfo of the repository.
 // The client must be connected with the repository (using
 // the ConnectWithAuth() method) before using this
 // method.
-func (s *GitUploadPackService) Info() (i *common.GitUploadPackInfo, err error) {
-	if !s.connected {
-		return nil, ErrNotConnected
-	}
+func (s *GitUploadPackService) Info() (*common.GitUploadPackInfo, error) {
+	return s.InfoContext(context.Background())
+}
 
-	session, err := s.client.NewSession()
+// InfoContext is like Info, the session is closed when ctx is done.
+func (s *GitUploadPackService) InfoContext(ctx context.Context) (*common.GitUploadPackInfo, error) {
+	session, err := s.start(ctx, common.GitUploadPackServiceName)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		// the session can be closed by the other endpoint,
-		// therefore we must ignore a close error.
-		_ = session.Close()
-	}()
 
-	out, err := session.Output("git-upload-pack " + s.vcs.FullName + ".git")
-	if err != nil {
-		return nil, err
+	i := common.NewGitUploadPackInfo()
+	if err := i.Decode(pktline.NewDecoder(session.stdout)); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
 	}
 
-	i = common.NewGitUploadPackInfo()
-	return i, i.Decode(pktline.NewDecoder(bytes.NewReader(out)))
-}
-
-// Disconnect the SSH client.
-func (s *GitUploadPackService) Disconnect() (err error) {
-	if !s.connected {
-		return ErrNotConnected
+	// a flush-pkt ends the session without fetching anything
+	if _, err := io.WriteString(session.stdin, "0000"); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
 	}
-	s.connected = false
-	return s.client.Close()
+
+	return i, session.Close()
 }
 
 // Fetch retrieves the GitUploadPack form the repository.
 // You must be connected to the repository before using this method
-// (using the ConnectWithAuth() method).
-// TODO: fetch should really reuse the info session instead of openning a new
-// one
-func (s *GitUploadPackService) Fetch(r *common.GitUploadPackRequest) (rc io.ReadCloser, err error) {
-	if !s.connected {
-		return nil, ErrNotConnected
-	}
+// (using the ConnectWithAuth() method). The references are advertised
+// again in a new session, they are skipped before the request is sent.
+func (s *GitUploadPackService) Fetch(r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	return s.FetchContext(context.Background(), r)
+}
 
-	session, err := s.client.NewSession()
+// FetchContext is like Fetch, the session is closed when ctx is done, so the
+// reads of the packfile fail with the error of ctx.
+func (s *GitUploadPackService) FetchContext(ctx context.Context, r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	session, err := s.start(ctx, common.GitUploadPackServiceName)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		// the session can be closed by the other endpoint,
-		// therefore we must ignore a close error.
+
+	if err := skipAdvertisement(session.stdout); err != nil {
 		_ = session.Close()
-	}()
+		return nil, session.err(ErrUploadPackAnswerFormat)
+	}
 
-	si, err := session.StdinPipe()
-	if err != nil {
-		return nil, err
+	if _, err := io.Copy(session.stdin, r.Reader()); err != nil {
+		_ = session.Close()
+		return nil, session.err(err)
 	}
 
-	so, err := session.StdoutPipe()
+	res, err := common.NewGitUploadPackResponse(&sessionReader{session}, r)
 	if err != nil {
-		return nil, err
+		_ = session.Close()
+		return nil, session.err(err)
 	}
 
-	go func() {
-		fmt.Fprintln(si, r.String())
-		err = si.Close()
-	}()
+	return res, nil
+}
 
-	err = session.Start("git-upload-pack " + s.vcs.FullName + ".git")
+// skipAdvertisement reads the references advertised by the service, until
+// the flush-pkt ending them.
+func skipAdvertisement(r io.Reader) error {
+	lines, err := pktline.NewDecoder(r).ReadBlock()
 	if err != nil {
-		return nil, err
-	}
-	// TODO: investigate this *ExitError type (command fails or
-	// doesn't complete successfully), as it is happenning all
-	// the time, but everything seems to work fine.
-	err = session.Wait()
-	if err != nil {
-		if _, ok := err.(*ssh.ExitError); !ok {
-			return nil, err
-		}
+		return err
 	}
 
-	// read until the header of the second answer
-	soBuf := bufio.NewReader(so)
-	token := "0000"
-	for {
-		var line string
-		line, err = soBuf.ReadString('\n')
-		if err == io.EOF {
-			return nil, ErrUploadPackAnswerFormat
-		}
-		if line[0:len(token)] == token {
-			break
-		}
+	if len(lines) == 0 {
+		return io.ErrUnexpectedEOF
 	}
 
-	data, err := ioutil.ReadAll(soBuf)
-	if err != nil {
-		return nil, err
-	}
-	buf := bytes.NewBuffer(data)
-	return ioutil.NopCloser(buf), nil
+	return nil
+}
+
+// sessionReader reads the output of the service, closing the session once
+// the response has been read.
+type sessionReader struct {
+	*session
+}
+
+func (r *sessionReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	return n, r.err(err)
 }
@@ -3,7 +3,6 @@
 package ssh
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
@@ -77,19 +76,11 @@ func (s *SuiteRemote) TestConnectWithPublicKeysCallback(c *C) {
 	c.Assert(r.auth, Equals, agent.auth)
 }
 
-func (s *SuiteRemote) TestConnectBadVcs(c *C) {
-	r := NewGitUploadPackService()
-	c.Assert(r.ConnectWithAuth(fixRepoBadVcs, nil), ErrorMatches, fmt.Sprintf(".*%s.*", fixRepoBadVcs))
-}
-
-func (s *SuiteRemote) TestConnectNonGit(c *C) {
-	r := NewGitUploadPackService()
-	c.Assert(r.ConnectWithAuth(fixRepoNonGit, nil), Equals, ErrUnsupportedVCS)
-}
-
-func (s *SuiteRemote) TestConnectNonGithub(c *C) {
-	r := NewGitUploadPackService()
-	c.Assert(r.ConnectWithAuth(fixGitRepoNonGithub, nil), Equals, ErrUnsupportedRepo)
+func (s *SuiteRemote) TestConnectInvalidEndpoint(c *C) {
+	for _, ep := range []common.Endpoint{fixRepoBadVcs, fixRepoNonGit, fixGitRepoNonGithub} {
+		r := NewGitUploadPackService()
+		c.Assert(r.ConnectWithAuth(ep, nil), Equals, ErrInvalidEndpoint)
+	}
 }
 
 // A mock implementation of client.common.AuthMethod
@@ -3,9 +3,12 @@ package git
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"sort"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
 )
@@ -19,37 +22,82 @@ type Hash core.Hash
 // commit, a pointer to the previous commit(s), etc.
 // http://schacon.github.io/gitbook/1_the_git_object_model.html
 type Commit struct {
-	Hash      core.Hash
-	Author    Signature
-	Committer Signature
-	Message   string
+	Hash         core.Hash
+	Author       Signature
+	Committer    Signature
+	Message      string
+	TreeHash     core.Hash
+	ParentHashes []core.Hash
+	// ExtraHeaders are the headers other than the tree, the parents, the
+	// author and the committer, like gpgsig, encoding or mergetag, in the
+	// order they are written.
+	ExtraHeaders []ExtraHeader
 
-	tree    core.Hash
-	parents []core.Hash
-	r       *Repository
+	r *Repository
 }
 
-// Tree returns the Tree from the commit
-func (c *Commit) Tree() *Tree {
-	tree, _ := c.r.Tree(c.tree) // FIXME: Return error as well?
-	return tree
+// ExtraHeader is a header of a commit not decoded into a field of Commit.
+// The continuation lines of multi-line values, like signatures, are joined
+// with new lines, without the space that starts them.
+type ExtraHeader struct {
+	Key   string
+	Value string
+}
+
+// pgpSignatureHeader is the header of the PGP signature of a signed commit.
+const pgpSignatureHeader = "gpgsig"
+
+// Tree returns the Tree from the commit, reading it from the repository of
+// the commit.
+func (c *Commit) Tree() (*Tree, error) {
+	return c.r.Tree(c.TreeHash)
 }
 
 // Parents return a CommitIter to the parent Commits
 func (c *Commit) Parents() *CommitIter {
-	return NewCommitIter(c.r, core.NewObjectLookupIter(c.r.Storage, c.parents))
+	return NewCommitIter(c.r, core.NewObjectLookupIter(c.r.Storage, c.ParentHashes))
 }
 
 // NumParents returns the number of parents in a commit.
 func (c *Commit) NumParents() int {
-	return len(c.parents)
+	return len(c.ParentHashes)
 }
 
 // File returns the file with the specified "path" in the commit and a
 // nil error if the file exists. If the file does not exist, it returns
-// a nil file and the ErrFileNotFound error.
+// a nil file and the ErrFileNotFound error, see Tree.File for the errors
+// returned for directories and submodules.
 func (c *Commit) File(path string) (file *File, err error) {
-	return c.Tree().File(path)
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.File(path)
+}
+
+// PGPSignature returns the armored PGP signature of a signed commit, the
+// value of its gpgsig header ended by a new line, or an empty string if the
+// commit is not signed.
+func (c *Commit) PGPSignature() string {
+	for _, h := range c.ExtraHeaders {
+		if h.Key == pgpSignatureHeader {
+			return h.Value + "\n"
+		}
+	}
+
+	return ""
+}
+
+// Files returns a FileIter allowing to iterate over the files of the tree of
+// the commit.
+func (c *Commit) Files() (*FileIter, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.Files(), nil
 }
 
 // ID returns the object ID of the commit. The returned value will always match
@@ -67,7 +115,9 @@ func (c *Commit) Type() core.ObjectType {
 	return core.CommitObject
 }
 
-// Decode transforms a core.Object into a Commit struct.
+// Decode transforms a core.Object into a Commit struct. The message and the
+// extra headers are kept as they are written, so Encode writes the same
+// object and the signatures can be verified.
 func (c *Commit) Decode(o core.Object) (err error) {
 	if o.Type() != core.CommitObject {
 		return ErrUnsupportedObject
@@ -82,40 +132,100 @@ func (c *Commit) Decode(o core.Object) (err error) {
 	defer checkClose(reader, &err)
 
 	r := bufio.NewReader(reader)
-
-	var message bool
 	for {
-		line, err := r.ReadSlice('\n')
+		line, err := r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
 			return err
 		}
 
-		line = bytes.TrimSpace(line)
-		if !message {
-			if len(line) == 0 {
-				message = true
-				continue
-			}
-
-			split := bytes.SplitN(line, []byte{' '}, 2)
-			switch string(split[0]) {
-			case "tree":
-				c.tree = core.NewHash(string(split[1]))
-			case "parent":
-				c.parents = append(c.parents, core.NewHash(string(split[1])))
-			case "author":
-				c.Author.Decode(split[1])
-			case "committer":
-				c.Committer.Decode(split[1])
-			}
-		} else {
-			c.Message += string(line) + "\n"
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if n := len(c.ExtraHeaders); n != 0 && len(line) != 0 && line[0] == ' ' {
+			c.ExtraHeaders[n-1].Value += "\n" + string(line[1:])
+		} else if !c.decodeHeader(line) {
+			break // Start of message
 		}
 
 		if err == io.EOF {
 			return nil
 		}
 	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.Message = string(data)
+
+	return nil
+}
+
+// decodeHeader decodes a header line, returning false if it is the blank line
+// before the message.
+func (c *Commit) decodeHeader(line []byte) bool {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return false
+	}
+
+	split := bytes.SplitN(trimmed, []byte{' '}, 2)
+	switch string(split[0]) {
+	case "tree":
+		c.TreeHash = core.NewHash(string(split[1]))
+	case "parent":
+		c.ParentHashes = append(c.ParentHashes, core.NewHash(string(split[1])))
+	case "author":
+		c.Author.Decode(split[1])
+	case "committer":
+		c.Committer.Decode(split[1])
+	default:
+		h := ExtraHeader{Key: string(split[0])}
+		if i := bytes.IndexByte(line, ' '); i != -1 {
+			h.Value = string(line[i+1:])
+		}
+
+		c.ExtraHeaders = append(c.ExtraHeaders, h)
+	}
+
+	return true
+}
+
+// Encode transforms a Commit into a core.Object, the reverse of Decode,
+// writing the format of git: the tree, a parent line for every parent, the
+// author, the committer and the extra headers, a blank line and the message
+// as it is, so the commits written by git keep their hashes. The tree and
+// the parents must be in the format of the object, a
+// *core.ErrObjectFormatMismatch is returned otherwise.
+func (c *Commit) Encode(o core.Object) (err error) {
+	if err := checkObjectFormat(o, append([]core.Hash{c.TreeHash}, c.ParentHashes...)...); err != nil {
+		return err
+	}
+
+	o.SetType(core.CommitObject)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", c.TreeHash)
+	for _, p := range c.ParentHashes {
+		fmt.Fprintf(&buf, "parent %s\n", p)
+	}
+
+	fmt.Fprintf(&buf, "author %s\ncommitter %s\n", c.Author.Encode(), c.Committer.Encode())
+	for _, h := range c.ExtraHeaders {
+		fmt.Fprintf(&buf, "%s %s\n", h.Key, strings.Replace(h.Value, "\n", "\n ", -1))
+	}
+
+	buf.WriteByte('\n')
+	buf.WriteString(c.Message)
+
+	o.SetSize(int64(buf.Len()))
+
+	w, err := o.Writer()
+	if err != nil {
+		return err
+	}
+	defer checkClose(w, &err)
+
+	_, err = w.Write(buf.Bytes())
+	return err
 }
 
 func (c *Commit) String() string {
@@ -151,6 +261,39 @@ func (iter *CommitIter) Next() (*Commit, error) {
 	return commit, commit.Decode(obj)
 }
 
+// ForEach calls cb for each of the remaining commits of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *CommitIter) ForEach(cb func(*Commit) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each commit of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *CommitIter) ForEachContext(ctx context.Context, cb func(*Commit) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		commit, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(commit); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
 type commitSorterer struct {
 	l []*Commit
 }
@@ -0,0 +1,140 @@
+package git
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/commitgraph"
+)
+
+// ErrCommitGraphNotSupported is returned by WriteCommitGraph when the
+// storage of the repository cannot keep a commit-graph file, see
+// commitGraphWriter.
+var ErrCommitGraphNotSupported = errors.New("object storage cannot write a commit-graph")
+
+// generationInfinity is the generation of the commits not in the
+// commit-graph, which could be descendants of any commit in it.
+const generationInfinity = ^uint32(0)
+
+// WriteCommitGraph writes the commit-graph file of the repository with every
+// commit of its storage, as git commit-graph write does, so the history
+// walks, like the ones of MergeBase, IsAncestor or the negotiation of Push,
+// read the commits from it instead of decoding them, and skip the ones that
+// cannot lead to the commits looked for, by their generation numbers. The
+// commits written later are decoded, the file should be written again once
+// there are many of them.
+//
+// commitgraph.ErrParentNotFound is returned if a parent of a commit is not
+// in the storage, like the ones of the shallow commits, and
+// ErrCommitGraphNotSupported if the storage cannot keep a commit-graph file.
+// Only the repositories of the core.SHA1 format can have one, a
+// *core.ErrObjectFormatMismatch is returned for the rest.
+func (r *Repository) WriteCommitGraph() error {
+	w, ok := r.Storage.(commitGraphWriter)
+	if !ok {
+		return ErrCommitGraphNotSupported
+	}
+
+	iter, err := r.Commits()
+	if err != nil {
+		return err
+	}
+
+	var nodes []commitgraph.Node
+	err = iter.ForEach(func(c *Commit) error {
+		nodes = append(nodes, commitgraph.Node{
+			Hash:         c.Hash,
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			When:         c.Committer.When,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	g, err := commitgraph.New(nodes)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteCommitGraph(g)
+}
+
+// commitGraphReader is implemented by the ObjectStorages that can have a
+// commit-graph file, like filesystem.ObjectStorage.
+type commitGraphReader interface {
+	// CommitGraph returns the commit-graph, nil if there is none.
+	CommitGraph() (*commitgraph.CommitGraph, error)
+}
+
+// commitGraphWriter is implemented by the ObjectStorages that can write a
+// commit-graph file, like filesystem.ObjectStorage.
+type commitGraphWriter interface {
+	// WriteCommitGraph writes the commit-graph, replacing the current one.
+	WriteCommitGraph(g *commitgraph.CommitGraph) error
+}
+
+// commitGraph returns the commit-graph of the storage, nil if it has none
+// or the repository is shallow, as its parents would not be the ones of the
+// shallow commits, the way git ignores it.
+func (r *Repository) commitGraph() (*commitgraph.CommitGraph, error) {
+	cg, ok := r.Storage.(commitGraphReader)
+	if !ok {
+		return nil, nil
+	}
+
+	g, err := cg.CommitGraph()
+	if err != nil || g == nil {
+		return nil, err
+	}
+
+	shallows, err := r.shallows()
+	if err != nil || len(shallows) != 0 {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// graphParents returns the parents of the commit, read from the commit-graph
+// g if the commit is in it, see parentCommits otherwise. The commits read
+// from g only have their hash, tree, parents and committer date, enough for
+// the history walks, which decode the ones returned afterwards.
+func (r *Repository) graphParents(g *commitgraph.CommitGraph, c *Commit) ([]*Commit, error) {
+	if g == nil {
+		return r.parentCommits(c, false)
+	}
+
+	i, ok := g.Index(c.Hash)
+	if !ok {
+		return r.parentCommits(c, false)
+	}
+
+	parents := make([]*Commit, len(g.Commits[i].Parents))
+	for j, p := range g.Commits[i].Parents {
+		gc := &g.Commits[p]
+		parents[j] = &Commit{
+			Hash:         g.Hashes[p],
+			TreeHash:     gc.TreeHash,
+			ParentHashes: g.ParentHashes(p),
+			Committer:    Signature{When: gc.When},
+			r:            r,
+		}
+	}
+
+	return parents, nil
+}
+
+// generation returns the generation of the commit with the given hash in
+// the commit-graph g, generationInfinity if it is not in g.
+func generation(g *commitgraph.CommitGraph, h core.Hash) uint32 {
+	c, ok := g.Commit(h)
+	if !ok {
+		return generationInfinity
+	}
+
+	return c.Generation
+}
@@ -0,0 +1,269 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/commitgraph"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteCommitGraph struct {
+	dir string
+	r   *Repository // with a filesystem.ObjectStorage
+	cc  *Repository // without commit-graph
+}
+
+var _ = Suite(&SuiteCommitGraph{})
+
+func (s *SuiteCommitGraph) SetUpTest(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(crissCrossFixture)
+	c.Assert(err, IsNil)
+
+	s.cc, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	s.r, err = NewFilesystemRepository(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteCommitGraph) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *SuiteCommitGraph) TestWriteCommitGraph(c *C) {
+	c.Assert(s.r.WriteCommitGraph(), IsNil)
+
+	_, err := os.Stat(filepath.Join(s.dir, ".git", "objects", "info", "commit-graph"))
+	c.Assert(err, IsNil)
+
+	g, err := s.r.commitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g, NotNil)
+
+	iter, err := s.r.Commits()
+	c.Assert(err, IsNil)
+
+	count := 0
+	err = iter.ForEach(func(commit *Commit) error {
+		count++
+
+		i, ok := g.Index(commit.Hash)
+		c.Assert(ok, Equals, true, Commentf("commit=%s", commit.Hash))
+		c.Assert(g.Commits[i].TreeHash, Equals, commit.TreeHash)
+		c.Assert(g.Commits[i].When.Equal(commit.Committer.When), Equals, true)
+		c.Assert(g.ParentHashes(i), DeepEquals, append([]core.Hash{}, commit.ParentHashes...))
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(g.Hashes, HasLen, count)
+
+	// the file is read by a new storage
+	sto, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	read, err := sto.ObjectStorage().(*filesystem.ObjectStorage).CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(read.Hashes, DeepEquals, g.Hashes)
+}
+
+func (s *SuiteCommitGraph) TestWriteCommitGraphNotSupported(c *C) {
+	c.Assert(s.cc.WriteCommitGraph(), Equals, ErrCommitGraphNotSupported)
+}
+
+func (s *SuiteCommitGraph) TestWriteCommitGraphParentNotFound(c *C) {
+	dir, err := ioutil.TempDir("", "commit-graph")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, _ := filesystemCommitLine(c, dir, 2)
+	commit := &Commit{TreeHash: EmptyTreeHash, ParentHashes: []core.Hash{core.NewHash("0000000000000000000000000000000000000001")}}
+	obj := &memory.Object{}
+	c.Assert(commit.Encode(obj), IsNil)
+	_, err = r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.WriteCommitGraph(), Equals, commitgraph.ErrParentNotFound)
+}
+
+// the walks with the commit-graph find the same as the ones without it, for
+// every pair of commits of the fixture
+func (s *SuiteCommitGraph) TestWalks(c *C) {
+	c.Assert(s.r.WriteCommitGraph(), IsNil)
+
+	hashes := []string{ccInitial, ccX1, ccY1, ccMergeY, ccMergeX, ccX3, ccY3, ccOrphan}
+	for _, a := range hashes {
+		for _, b := range hashes {
+			s.assertWalks(c, core.NewHash(a), core.NewHash(b))
+		}
+	}
+}
+
+func (s *SuiteCommitGraph) assertWalks(c *C, a, b core.Hash) {
+	comment := Commentf("a=%s b=%s", a, b)
+	commit := func(r *Repository, h core.Hash) *Commit {
+		commit, err := r.Commit(h)
+		c.Assert(err, IsNil)
+		return commit
+	}
+
+	expected, err := s.cc.MergeBase(commit(s.cc, a), commit(s.cc, b))
+	c.Assert(err, IsNil)
+	obtained, err := s.r.MergeBase(commit(s.r, a), commit(s.r, b))
+	c.Assert(err, IsNil)
+	c.Assert(obtained, HasLen, len(expected), comment)
+	for i := range expected {
+		// the merge bases are decoded
+		c.Assert(obtained[i].Hash, Equals, expected[i].Hash, comment)
+		c.Assert(obtained[i].Message, Equals, expected[i].Message, comment)
+		c.Assert(obtained[i].Author, DeepEquals, expected[i].Author, comment)
+	}
+
+	ok, err := commit(s.cc, a).IsAncestor(commit(s.cc, b))
+	c.Assert(err, IsNil)
+	obtainedOK, err := commit(s.r, a).IsAncestor(commit(s.r, b))
+	c.Assert(err, IsNil)
+	c.Assert(obtainedOK, Equals, ok, comment)
+
+	ahead, behind, err := s.cc.AheadBehind(a, b)
+	c.Assert(err, IsNil)
+	obtainedAhead, obtainedBehind, err := s.r.AheadBehind(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(obtainedAhead, Equals, ahead, comment)
+	c.Assert(obtainedBehind, Equals, behind, comment)
+}
+
+// the commits of the commit-graph are not read, and the ones written after
+// it are decoded
+func (s *SuiteCommitGraph) TestWalksWithoutObjects(c *C) {
+	dir, err := ioutil.TempDir("", "commit-graph")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, hashes := filesystemCommitLine(c, dir, 10)
+	c.Assert(r.WriteCommitGraph(), IsNil)
+	for _, h := range hashes[:8] {
+		path := filepath.Join(dir, "objects", h.String()[:2], h.String()[2:])
+		c.Assert(os.Remove(path), IsNil)
+	}
+
+	local := newLineCommit(c, r, hashes[9], "local")
+	upstream := newLineCommit(c, r, hashes[9], "upstream")
+
+	first, err := r.Commit(hashes[8])
+	c.Assert(err, IsNil)
+	localCommit, err := r.Commit(local)
+	c.Assert(err, IsNil)
+	upstreamCommit, err := r.Commit(upstream)
+	c.Assert(err, IsNil)
+
+	ok, err := first.IsAncestor(upstreamCommit)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = localCommit.IsAncestor(upstreamCommit)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	bases, err := r.MergeBase(localCommit, upstreamCommit)
+	c.Assert(err, IsNil)
+	c.Assert(bases, HasLen, 1)
+	c.Assert(bases[0].Hash, Equals, hashes[9])
+
+	ahead, behind, err := r.AheadBehind(local, upstream)
+	c.Assert(err, IsNil)
+	c.Assert(ahead, Equals, 1)
+	c.Assert(behind, Equals, 1)
+}
+
+// the commit-graph is not used in the shallow repositories
+func (s *SuiteCommitGraph) TestCommitGraphShallow(c *C) {
+	c.Assert(s.r.WriteCommitGraph(), IsNil)
+	s.r.Shallows = memory.NewShallowStorage()
+	c.Assert(s.r.Shallows.SetShallow([]core.Hash{core.NewHash(ccX1)}), IsNil)
+
+	g, err := s.r.commitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g, IsNil)
+}
+
+func (s *SuiteCommitGraph) BenchmarkIsAncestor(c *C) {
+	s.benchmarkIsAncestor(c, false)
+}
+
+func (s *SuiteCommitGraph) BenchmarkIsAncestorCommitGraph(c *C) {
+	s.benchmarkIsAncestor(c, true)
+}
+
+// benchmarkIsAncestor checks whether the tip of a branch is an ancestor of
+// the one of another, forked from a line of a few thousand commits, which is
+// walked whole without commit-graph.
+func (s *SuiteCommitGraph) benchmarkIsAncestor(c *C, graph bool) {
+	dir, err := ioutil.TempDir("", "commit-graph")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, hashes := filesystemCommitLine(c, dir, 3000)
+	if graph {
+		c.Assert(r.WriteCommitGraph(), IsNil)
+	}
+
+	local, err := r.Commit(newLineCommit(c, r, hashes[len(hashes)-1], "local"))
+	c.Assert(err, IsNil)
+	upstream, err := r.Commit(newLineCommit(c, r, hashes[len(hashes)-1], "upstream"))
+	c.Assert(err, IsNil)
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		ok, err := local.IsAncestor(upstream)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, false)
+	}
+}
+
+// filesystemCommitLine returns a repository with a filesystem storage in the
+// given directory, with a line of n commits, and their hashes, oldest first.
+func filesystemCommitLine(c *C, dir string, n int) (*Repository, []core.Hash) {
+	r, err := NewFilesystemRepository(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+
+	var hashes []core.Hash
+	for i := 0; i < n; i++ {
+		sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(int64(i), 0).UTC()}
+		commit := &Commit{TreeHash: EmptyTreeHash, Author: sig, Committer: sig, Message: fmt.Sprintf("%d\n", i)}
+		if i != 0 {
+			commit.ParentHashes = []core.Hash{hashes[i-1]}
+		}
+
+		obj := &memory.Object{}
+		c.Assert(commit.Encode(obj), IsNil)
+		h, err := r.Storage.Set(obj)
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	return r, hashes
+}
+
+// newLineCommit stores a commit with the given parent and message, newer
+// than the commits of filesystemCommitLine.
+func newLineCommit(c *C, r *Repository, parent core.Hash, msg string) core.Hash {
+	sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(1<<20, 0).UTC()}
+	commit := &Commit{TreeHash: EmptyTreeHash, ParentHashes: []core.Hash{parent}, Author: sig, Committer: sig, Message: msg + "\n"}
+
+	obj := &memory.Object{}
+	c.Assert(commit.Encode(obj), IsNil)
+	h, err := r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+
+	return h
+}
@@ -2,14 +2,30 @@ package git
 
 import (
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/alcortesm/tgz"
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
 
 	. "gopkg.in/check.v1"
 )
 
+// signedFixture is a repository written by git with signed commits and
+// tags, a commit with an encoding header and a merge of a signed tag, with
+// a mergetag header. The public key of John Doe, key.asc, is in its working
+// directory; the commit and the tag of the branch jane are signed with
+// another key.
+const signedFixture = "fixtures/signed.tgz"
+
 type SuiteCommit struct {
-	repos map[string]*Repository
+	repos  map[string]*Repository
+	dir    string
+	signed *Repository
 }
 
 var _ = Suite(&SuiteCommit{})
@@ -20,6 +36,17 @@ func (s *SuiteCommit) SetUpSuite(c *C) {
 		{"https://github.com/tyba/git-fixture.git", "formats/packfile/fixtures/git-fixture.ofs-delta"},
 	}
 	s.repos = unpackFixtures(c, commitFixtures)
+
+	var err error
+	s.dir, err = tgz.Extract(signedFixture)
+	c.Assert(err, IsNil)
+
+	s.signed, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteCommit) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
 }
 
 var commitIterTests = []struct {
@@ -148,6 +175,157 @@ func (s *SuiteCommit) TestFile(c *C) {
 	}
 }
 
+func (s *SuiteCommit) TestTree(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	c.Assert(err, IsNil)
+
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	c.Assert(tree.Hash.String(), Equals, "aa9b383c260e1d05fbbf6b30a02914555e20c725")
+
+	iter, err := commit.Files()
+	c.Assert(err, IsNil)
+
+	var names []string
+	for f, err := iter.Next(); err != io.EOF; f, err = iter.Next() {
+		c.Assert(err, IsNil)
+		names = append(names, f.Name)
+	}
+	c.Assert(names, DeepEquals, []string{".gitignore", "LICENSE"})
+}
+
+func (s *SuiteCommit) TestTreeNotFound(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit := &Commit{r: r, TreeHash: core.NewHash("0000000000000000000000000000000000000001")}
+
+	_, err := commit.Tree()
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	_, err = commit.File("LICENSE")
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	_, err = commit.Files()
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteCommit) TestEncodeRoundTrip(c *C) {
+	repos := unpackFixtures(c, tagFixtures)
+	repos[signedFixture] = s.signed
+	for name, r := range s.repos {
+		repos[name] = r
+	}
+
+	for name, r := range repos {
+		iter, err := r.Storage.Iter(core.CommitObject)
+		c.Assert(err, IsNil)
+
+		n := 0
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			commit := &Commit{}
+			c.Assert(commit.Decode(obj), IsNil)
+
+			encoded := &memory.Object{}
+			c.Assert(commit.Encode(encoded), IsNil)
+			com := Commentf("repo=%s commit=%s", name, obj.Hash())
+			c.Assert(string(encoded.Content()), Equals, string(obj.Content()), com)
+			c.Assert(encoded.Hash(), Equals, obj.Hash(), com)
+			n++
+		}
+
+		c.Assert(n > 0, Equals, true)
+	}
+}
+
+func (s *SuiteCommit) TestEncode(c *C) {
+	// the hashes of the commits written by git commit-tree with the same
+	// trees, parents, signatures and messages
+	author := Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833006, 0).In(time.FixedZone("", 2*3600))}
+	committer := Signature{Name: "Jane Roe", Email: "jane@roe.com", When: time.Unix(1465833106, 0).In(time.FixedZone("", -90*60))}
+
+	root := &Commit{TreeHash: EmptyTreeHash, Author: author, Committer: committer, Message: "root\n"}
+	other := &Commit{TreeHash: EmptyTreeHash, Author: author, Committer: committer, Message: "other root\n"}
+	merge := &Commit{
+		TreeHash: EmptyTreeHash,
+		ParentHashes: []core.Hash{
+			core.NewHash("536fe124604a058321285077d7d87d954d129228"),
+			core.NewHash("5b33148b4e59720cf9c901695000cb3413fa931f"),
+		},
+		Author:    author,
+		Committer: committer,
+		Message:   "merge\n\nbody\n",
+	}
+
+	for hash, commit := range map[string]*Commit{
+		"536fe124604a058321285077d7d87d954d129228": root,
+		"5b33148b4e59720cf9c901695000cb3413fa931f": other,
+		"ef376137d4cf80c077bc3c1fa036002d41f938a9": merge,
+	} {
+		obj := &memory.Object{}
+		c.Assert(commit.Encode(obj), IsNil)
+		c.Assert(obj.Hash().String(), Equals, hash)
+
+		decoded := &Commit{}
+		c.Assert(decoded.Decode(obj), IsNil)
+		c.Assert(decoded.TreeHash, Equals, commit.TreeHash)
+		c.Assert(decoded.ParentHashes, DeepEquals, commit.ParentHashes)
+		c.Assert(decoded.Message, Equals, commit.Message)
+		c.Assert(decoded.Committer.When.Equal(committer.When), Equals, true)
+	}
+}
+
+func (s *SuiteCommit) TestExtraHeaders(c *C) {
+	merge, err := s.signed.Commit(core.NewHash("dfb58170a4d60fdd7ab88b55b37d40ea86118e3e"))
+	c.Assert(err, IsNil)
+	c.Assert(merge.ExtraHeaders, HasLen, 2)
+	c.Assert(merge.ExtraHeaders[0].Key, Equals, "mergetag")
+	c.Assert(strings.HasPrefix(merge.ExtraHeaders[0].Value, "object d5fbfee8049c28e7326d61f32c747c09c18feaa9\ntype commit\ntag side-tag\n"), Equals, true)
+	c.Assert(strings.Contains(merge.ExtraHeaders[0].Value, "\nside tag\n-----BEGIN PGP SIGNATURE-----\n\n"), Equals, true)
+	c.Assert(merge.ExtraHeaders[1].Key, Equals, "gpgsig")
+
+	sig := merge.PGPSignature()
+	c.Assert(strings.HasPrefix(sig, "-----BEGIN PGP SIGNATURE-----\n\n"), Equals, true)
+	c.Assert(strings.HasSuffix(sig, "\n-----END PGP SIGNATURE-----\n"), Equals, true)
+	c.Assert(merge.Message, Equals, "Merge tag side-tag\n")
+
+	encoded, err := s.signed.Commit(core.NewHash("8b2f8c71a30ba472ac9b1552c0f23d83d9b9f95f"))
+	c.Assert(err, IsNil)
+	c.Assert(encoded.ExtraHeaders, DeepEquals, []ExtraHeader{{Key: "encoding", Value: "ISO-8859-1"}})
+	c.Assert(encoded.PGPSignature(), Equals, "")
+	c.Assert(encoded.Message, Equals, "Caf\xe9\n")
+}
+
+func (s *SuiteCommit) TestEncodeExtraHeaders(c *C) {
+	sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(0, 0).UTC()}
+	commit := &Commit{
+		TreeHash:  EmptyTreeHash,
+		Author:    sig,
+		Committer: sig,
+		ExtraHeaders: []ExtraHeader{
+			{Key: "encoding", Value: "ISO-8859-1"},
+			{Key: "gpgsig", Value: "foo\n\nbar"},
+		},
+		Message: "foo\n",
+	}
+
+	obj := &memory.Object{}
+	c.Assert(commit.Encode(obj), IsNil)
+	c.Assert(string(obj.Content()), Equals, "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"+
+		"author foo <foo@bar.com> 0 +0000\ncommitter foo <foo@bar.com> 0 +0000\n"+
+		"encoding ISO-8859-1\ngpgsig foo\n \n bar\n\nfoo\n")
+
+	decoded := &Commit{}
+	c.Assert(decoded.Decode(obj), IsNil)
+	c.Assert(decoded.ExtraHeaders, DeepEquals, commit.ExtraHeaders)
+	c.Assert(decoded.PGPSignature(), Equals, "foo\n\nbar\n")
+}
+
 func makeObjectSlice(hashes []string, storage core.ObjectStorage) []core.Object {
 	series := make([]core.Object, 0, len(hashes))
 	for _, member := range hashes {
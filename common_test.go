@@ -50,6 +50,67 @@ func (s *MockGitUploadPackService) Fetch(*common.GitUploadPackRequest) (io.ReadC
 	return s.RC, err
 }
 
+// fixtureUploadPackService is a GitUploadPackService serving mergesFixture,
+// or the repository of formats/packfile/fixtures/thin.pack for fetch-thin,
+// with the responses of git upload-pack --stateless-rpc recorded in
+// fixtures/upload-pack, a request and its response for every name. Fetch
+// fails if the request is not the one recorded. The references advertised
+// are refs, or only master if nil. The side-band-64k capability is requested
+// if sideband is true, as the http client does.
+type fixtureUploadPackService struct {
+	c         *C
+	name      string
+	refs      map[string]core.Hash
+	noShallow bool
+	sideband  bool
+}
+
+func (s *fixtureUploadPackService) Connect(url common.Endpoint) error {
+	return nil
+}
+
+func (s *fixtureUploadPackService) ConnectWithAuth(url common.Endpoint, auth common.AuthMethod) error {
+	return nil
+}
+
+func (s *fixtureUploadPackService) Info() (*common.GitUploadPackInfo, error) {
+	c := common.NewCapabilities()
+	c.Decode("972eb2a3177a422bd2b0ad4991df73d32e0fc763 HEADmulti_ack thin-pack side-band side-band-64k ofs-delta shallow deepen-since deepen-not deepen-relative no-progress include-tag multi_ack_detailed no-done symref=HEAD:refs/heads/master object-format=sha1 agent=git/2.39.5")
+	if s.noShallow {
+		c = common.NewCapabilities()
+		c.Decode("972eb2a3177a422bd2b0ad4991df73d32e0fc763 HEADmulti_ack ofs-delta symref=HEAD:refs/heads/master")
+	}
+
+	refs := s.refs
+	if refs == nil {
+		refs = map[string]core.Hash{"refs/heads/master": shallowHead}
+	}
+
+	return &common.GitUploadPackInfo{
+		Capabilities: c,
+		Head:         refs["refs/heads/master"],
+		Refs:         refs,
+	}, nil
+}
+
+func (s *fixtureUploadPackService) Fetch(r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	req := *r
+	if s.sideband {
+		req.Capabilities = append(req.Capabilities, "side-band-64k")
+	}
+
+	expected, err := ioutil.ReadFile("fixtures/upload-pack/" + s.name + ".request")
+	s.c.Assert(err, IsNil)
+	s.c.Assert(req.String(), Equals, string(expected))
+
+	f, err := os.Open("fixtures/upload-pack/" + s.name + ".response")
+	if err != nil {
+		return nil, err
+	}
+
+	return common.NewGitUploadPackResponse(f, &req)
+}
+
 type packedFixture struct {
 	url      string
 	packfile string
@@ -0,0 +1,27 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v3/formats/config"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+// Config returns the config of the repository, the one of its Configs,
+// with the options of the files it includes. It is modified and written
+// with SetConfig, the options of the included files can not be changed.
+func (r *Repository) Config() (*config.Config, error) {
+	if r.Configs == nil {
+		return config.New(), nil
+	}
+
+	return r.Configs.Config()
+}
+
+// SetConfig replaces the config of the repository with the given one, as
+// returned by Config.
+func (r *Repository) SetConfig(c *config.Config) error {
+	if r.Configs == nil {
+		r.Configs = memory.NewConfigStorage()
+	}
+
+	return r.Configs.SetConfig(c)
+}
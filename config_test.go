@@ -0,0 +1,59 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/formats/config"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteConfig struct{}
+
+var _ = Suite(&SuiteConfig{})
+
+func (s *SuiteConfig) TestConfig(c *C) {
+	r := NewPlainRepository()
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Sections, HasLen, 0)
+
+	cfg.Set("user", "", "name", "Foo")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	cfg, err = r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.String("user", "", "name"), Equals, "Foo")
+
+	r.Configs = nil
+	cfg, err = r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Sections, HasLen, 0)
+
+	c.Assert(r.SetConfig(config.New()), IsNil)
+	c.Assert(r.Configs, NotNil)
+}
+
+func (s *SuiteConfig) TestConfigFromFS(c *C) {
+	dir, err := tgz.Extract(sha256Fixture)
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.String("extensions", "", "objectformat"), Equals, "sha256")
+
+	cfg.Set("user", "", "name", "Foo")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	cfg, err = r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.String("user", "", "name"), Equals, "Foo")
+	c.Assert(cfg.String("extensions", "", "objectformat"), Equals, "sha256")
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CachedObjectStorage is an ObjectStorage keeping the objects read from
+// another one in a LRU cache, bounded by the sum of the sizes of the objects
+// cached. It is safe to call Get from several goroutines at once if the
+// storage wrapped is, see ConcurrentSafeObjectStorage. Iter is not cached.
+type CachedObjectStorage struct {
+	s        ObjectStorage
+	maxBytes int64
+
+	m       sync.Mutex
+	size    int64
+	lru     *list.List // of *cachedObject, the most recently used first
+	objects map[Hash]*list.Element
+	hits    int64
+	misses  int64
+}
+
+type cachedObject struct {
+	h   Hash
+	obj Object
+}
+
+// NewCachedObjectStorage returns an ObjectStorage that caches up to maxBytes
+// of the objects read from s. The storage returned is a
+// *CachedObjectStorage, its Hits and Misses methods give the use of the
+// cache.
+func NewCachedObjectStorage(s ObjectStorage, maxBytes int64) ObjectStorage {
+	return &CachedObjectStorage{
+		s:        s,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		objects:  make(map[Hash]*list.Element, 0),
+	}
+}
+
+// Set stores the object in the storage wrapped, removing any object with the
+// same hash from the cache.
+func (s *CachedObjectStorage) Set(obj Object) (Hash, error) {
+	s.m.Lock()
+	s.remove(obj.Hash())
+	s.m.Unlock()
+
+	return s.s.Set(obj)
+}
+
+// Get returns the object with the given hash from the cache, or from the
+// storage wrapped, caching it, if it is not cached.
+func (s *CachedObjectStorage) Get(h Hash) (Object, error) {
+	if obj, ok := s.get(h); ok {
+		return obj, nil
+	}
+
+	obj, err := s.s.Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	s.add(h, obj)
+	return obj, nil
+}
+
+// GetMany returns the objects with the given hashes, see the GetMany
+// function, the objects not cached are read at once from the storage
+// wrapped and cached.
+func (s *CachedObjectStorage) GetMany(hs []Hash) ([]Object, error) {
+	objs := make([]Object, len(hs))
+	var positions []int
+	var missing []Hash
+	for i, h := range hs {
+		if obj, ok := s.get(h); ok {
+			objs[i] = obj
+			continue
+		}
+
+		positions = append(positions, i)
+		missing = append(missing, h)
+	}
+
+	if len(missing) == 0 {
+		return objs, nil
+	}
+
+	read, err := GetMany(s.s, missing)
+	var notFound map[int]error
+	if e, ok := err.(*GetManyError); ok {
+		notFound = e.Errors
+	} else if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[int]error, len(notFound))
+	for i, pos := range positions {
+		if err, ok := notFound[i]; ok {
+			errs[pos] = err
+			continue
+		}
+
+		objs[pos] = read[i]
+		s.add(hs[pos], read[i])
+	}
+
+	if len(errs) != 0 {
+		return objs, &GetManyError{Errors: errs}
+	}
+
+	return objs, nil
+}
+
+// Has reports whether the object with the given hash is cached or in the
+// storage wrapped, see HasObject.
+func (s *CachedObjectStorage) Has(h Hash) (bool, error) {
+	s.m.Lock()
+	_, ok := s.objects[h]
+	s.m.Unlock()
+	if ok {
+		return true, nil
+	}
+
+	return HasObject(s.s, h)
+}
+
+// ConcurrentSafe reports whether the storage wrapped is safe to use from
+// several goroutines at once, the cache always is.
+func (s *CachedObjectStorage) ConcurrentSafe() bool {
+	cs, ok := s.s.(ConcurrentSafeObjectStorage)
+	return ok && cs.ConcurrentSafe()
+}
+
+// Iter returns the iterator of the storage wrapped.
+func (s *CachedObjectStorage) Iter(t ObjectType) (ObjectIter, error) {
+	return s.s.Iter(t)
+}
+
+// Hits returns the number of objects returned from the cache.
+func (s *CachedObjectStorage) Hits() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.hits
+}
+
+// Misses returns the number of objects looked up but not found in the
+// cache, the ones not found in the storage wrapped included.
+func (s *CachedObjectStorage) Misses() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.misses
+}
+
+// Size returns the sum of the sizes of the objects cached.
+func (s *CachedObjectStorage) Size() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.size
+}
+
+func (s *CachedObjectStorage) get(h Hash) (Object, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	e, ok := s.objects[h]
+	if !ok {
+		s.misses++
+		return nil, false
+	}
+
+	s.hits++
+	s.lru.MoveToFront(e)
+	return e.Value.(*cachedObject).obj, true
+}
+
+// add caches an object, evicting the least recently used ones to make room
+// for it. The objects bigger than the cache are not cached.
+func (s *CachedObjectStorage) add(h Hash, obj Object) {
+	size := obj.Size()
+	if size > s.maxBytes {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.objects[h]; ok {
+		return // cached by another goroutine meanwhile
+	}
+
+	for s.size+size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*cachedObject).h)
+	}
+
+	s.objects[h] = s.lru.PushFront(&cachedObject{h: h, obj: obj})
+	s.size += size
+}
+
+func (s *CachedObjectStorage) remove(h Hash) {
+	e, ok := s.objects[h]
+	if !ok {
+		return
+	}
+
+	s.lru.Remove(e)
+	delete(s.objects, h)
+	s.size -= e.Value.(*cachedObject).obj.Size()
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type CacheSuite struct{}
+
+var _ = Suite(&CacheSuite{})
+
+type testSizedObject struct {
+	Object
+	h    Hash
+	size int64
+}
+
+func (o *testSizedObject) Hash() Hash  { return o.h }
+func (o *testSizedObject) Size() int64 { return o.size }
+
+// testMapStorage counts the calls to Get
+type testMapStorage struct {
+	testStorage
+	m       sync.Mutex
+	objects map[Hash]Object
+	gets    int
+}
+
+func newTestMapStorage(sizes ...int64) (*testMapStorage, []Hash) {
+	s := &testMapStorage{objects: make(map[Hash]Object, 0)}
+	var hs []Hash
+	for i, size := range sizes {
+		h := NewHash(fmt.Sprintf("%040x", i+1))
+		s.objects[h] = &testSizedObject{h: h, size: size}
+		hs = append(hs, h)
+	}
+
+	return s, hs
+}
+
+func (s *testMapStorage) Set(obj Object) (Hash, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.objects[obj.Hash()] = obj
+	return obj.Hash(), nil
+}
+
+func (s *testMapStorage) Get(h Hash) (Object, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.gets++
+	obj, ok := s.objects[h]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	return obj, nil
+}
+
+func (s *CacheSuite) TestGet(c *C) {
+	storage, hs := newTestMapStorage(10, 20, 30, 100)
+	cache := NewCachedObjectStorage(storage, 60).(*CachedObjectStorage)
+
+	for _, h := range hs[:3] {
+		obj, err := cache.Get(h)
+		c.Assert(err, IsNil)
+		c.Assert(obj, Equals, storage.objects[h])
+	}
+	c.Assert(cache.Size(), Equals, int64(60))
+
+	// all of them are cached
+	for _, h := range hs[:3] {
+		obj, err := cache.Get(h)
+		c.Assert(err, IsNil)
+		c.Assert(obj, Equals, storage.objects[h])
+	}
+	c.Assert(storage.gets, Equals, 3)
+	c.Assert(cache.Hits(), Equals, int64(3))
+	c.Assert(cache.Misses(), Equals, int64(3))
+
+	// the objects bigger than the cache are not cached
+	_, err := cache.Get(hs[3])
+	c.Assert(err, IsNil)
+	_, err = cache.Get(hs[3])
+	c.Assert(err, IsNil)
+	c.Assert(storage.gets, Equals, 5)
+	c.Assert(cache.Size(), Equals, int64(60))
+
+	_, err = cache.Get(NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, ErrObjectNotFound)
+	c.Assert(cache.Misses(), Equals, int64(6))
+}
+
+func (s *CacheSuite) TestEviction(c *C) {
+	storage, hs := newTestMapStorage(10, 20, 30, 25)
+	cache := NewCachedObjectStorage(storage, 60).(*CachedObjectStorage)
+
+	for _, h := range hs[:3] {
+		_, err := cache.Get(h)
+		c.Assert(err, IsNil)
+	}
+
+	// the first one is now the most recently used, so the second and third
+	// ones are evicted to make room for the fourth one
+	_, err := cache.Get(hs[0])
+	c.Assert(err, IsNil)
+	_, err = cache.Get(hs[3])
+	c.Assert(err, IsNil)
+	c.Assert(cache.Size(), Equals, int64(35))
+
+	gets := storage.gets
+	for _, h := range []Hash{hs[0], hs[3]} {
+		_, err := cache.Get(h)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(storage.gets, Equals, gets)
+
+	_, err = cache.Get(hs[1])
+	c.Assert(err, IsNil)
+	c.Assert(storage.gets, Equals, gets+1)
+}
+
+func (s *CacheSuite) TestSet(c *C) {
+	storage, hs := newTestMapStorage(10)
+	cache := NewCachedObjectStorage(storage, 60).(*CachedObjectStorage)
+
+	_, err := cache.Get(hs[0])
+	c.Assert(err, IsNil)
+
+	replaced := &testSizedObject{h: hs[0], size: 15}
+	h, err := cache.Set(replaced)
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, hs[0])
+	c.Assert(cache.Size(), Equals, int64(0))
+
+	obj, err := cache.Get(hs[0])
+	c.Assert(err, IsNil)
+	c.Assert(obj, Equals, replaced)
+	c.Assert(cache.Size(), Equals, int64(15))
+}
+
+func (s *CacheSuite) TestGetMany(c *C) {
+	storage, hs := newTestMapStorage(10, 20, 30)
+	cache := NewCachedObjectStorage(storage, 60).(*CachedObjectStorage)
+
+	_, err := cache.Get(hs[1])
+	c.Assert(err, IsNil)
+
+	missing := NewHash("ffffffffffffffffffffffffffffffffffffffff")
+	objs, err := GetMany(cache, []Hash{hs[0], missing, hs[1], hs[2]})
+	c.Assert(err, DeepEquals, &GetManyError{Errors: map[int]error{1: ErrObjectNotFound}})
+	c.Assert(objs, DeepEquals, []Object{
+		storage.objects[hs[0]], nil, storage.objects[hs[1]], storage.objects[hs[2]],
+	})
+	c.Assert(storage.gets, Equals, 4)
+
+	objs, err = GetMany(cache, hs)
+	c.Assert(err, IsNil)
+	c.Assert(objs, HasLen, 3)
+	c.Assert(storage.gets, Equals, 4)
+}
+
+func (s *CacheSuite) TestHas(c *C) {
+	storage, hs := newTestMapStorage(10)
+	cache := NewCachedObjectStorage(storage, 60)
+
+	ok, err := HasObject(cache, hs[0])
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = HasObject(cache, NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	c.Assert(cache.(ConcurrentSafeObjectStorage).ConcurrentSafe(), Equals, false)
+}
+
+func (s *CacheSuite) TestConcurrentGet(c *C) {
+	storage, hs := newTestMapStorage(10, 20, 30, 40, 50)
+	cache := NewCachedObjectStorage(storage, 100).(*CachedObjectStorage)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, h := range hs {
+					obj, err := cache.Get(h)
+					c.Check(err, IsNil)
+					c.Check(obj.Hash(), Equals, h)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	c.Assert(cache.Hits()+cache.Misses(), Equals, int64(8*100*len(hs)))
+	c.Assert(cache.Size() <= 100, Equals, true)
+}
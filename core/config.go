@@ -0,0 +1,14 @@
+package core
+
+import "gopkg.in/src-d/go-git.v3/formats/config"
+
+// ConfigStorage is the storage of the config of a repository, the options
+// of its .git/config file.
+type ConfigStorage interface {
+	// Config returns the config, empty if there is none, along with the
+	// sections of the files it includes, see config.Config.ResolveIncludes.
+	Config() (*config.Config, error)
+	// SetConfig replaces the config with the given one, the sections of
+	// the included files are not written.
+	SetConfig(*config.Config) error
+}
@@ -1,58 +1,102 @@
 package core
 
 import (
-	"crypto/sha1"
+	"bytes"
 	"encoding/hex"
 	"hash"
-	"strconv"
+	"sort"
+	"strings"
 )
 
-// Hash SHA1 hased content
-type Hash [20]byte
+// maxHashSize is the size of the largest hash of the object formats, the
+// one of SHA256.
+const maxHashSize = 32
+
+// Hash is the name of an object, the hash of its type, size and content in
+// the ObjectFormat of its repository. The first bytes are the hash, as many
+// as the Size of its format, which is kept in the last byte, so the hashes
+// of different formats are never equal. The zero value is the ZeroHash of
+// SHA1, the default format, whose hashes can be written as 20-byte literals.
+type Hash [maxHashSize + 1]byte
 
 // ZeroHash is Hash with value zero
 var ZeroHash Hash
 
-// ComputeHash compute the hash for a given ObjectType and content
+// ComputeHash compute the SHA1 hash for a given ObjectType and content, see
+// ObjectFormat.ComputeHash for the ones of other formats.
 func ComputeHash(t ObjectType, content []byte) Hash {
-	h := NewHasher(t, int64(len(content)))
-	h.Write(content)
-	return h.Sum()
+	return SHA1.ComputeHash(t, content)
 }
 
-// NewHash return a new Hash from a hexadecimal hash representation
+// NewHash return a new Hash from a hexadecimal hash representation, the
+// hashes of 64 hexadecimal digits are SHA256 hashes, the other ones SHA1.
 func NewHash(s string) Hash {
 	b, _ := hex.DecodeString(s)
+	if len(s) == SHA256.HexSize() {
+		return NewHashFromBytes(SHA256, b)
+	}
+
+	return NewHashFromBytes(SHA1, b)
+}
 
+// NewHashFromBytes returns the Hash of the format f with the given bytes,
+// truncated or zero padded to the Size of f.
+func NewHashFromBytes(f ObjectFormat, b []byte) Hash {
 	var h Hash
-	copy(h[:], b)
+	copy(h[:f.Size()], b)
+	h[maxHashSize] = byte(f)
 
 	return h
 }
 
+// Format returns the ObjectFormat of the hash.
+func (h Hash) Format() ObjectFormat {
+	return ObjectFormat(h[maxHashSize])
+}
+
+// Bytes returns the bytes of the hash, as many as the Size of its format.
+func (h Hash) Bytes() []byte {
+	return h[:h.Format().Size()]
+}
+
+// IsZero returns true if every byte of the hash is zero, whatever its
+// format.
 func (h Hash) IsZero() bool {
-	var empty Hash
-	return h == empty
+	return h == h.Format().ZeroHash()
 }
 
 func (h Hash) String() string {
-	return hex.EncodeToString(h[:])
+	return hex.EncodeToString(h.Bytes())
 }
 
+// HasPrefix returns true if the hexadecimal representation of the hash,
+// see String, starts with the given prefix, in lowercase.
+func (h Hash) HasPrefix(prefix string) bool {
+	return strings.HasPrefix(h.String(), prefix)
+}
+
+// SortHashes sorts the hashes in increasing order.
+func SortHashes(hashes []Hash) {
+	sort.Sort(hashSlice(hashes))
+}
+
+type hashSlice []Hash
+
+func (s hashSlice) Len() int           { return len(s) }
+func (s hashSlice) Less(i, j int) bool { return bytes.Compare(s[i][:], s[j][:]) < 0 }
+func (s hashSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 type Hasher struct {
 	hash.Hash
+	format ObjectFormat
 }
 
+// NewHasher returns a Hasher computing the SHA1 hash of an object of the
+// given type and size, see ObjectFormat.NewHasher for the other formats.
 func NewHasher(t ObjectType, size int64) Hasher {
-	h := Hasher{sha1.New()}
-	h.Write(t.Bytes())
-	h.Write([]byte(" "))
-	h.Write([]byte(strconv.FormatInt(size, 10)))
-	h.Write([]byte{0})
-	return h
+	return SHA1.NewHasher(t, size)
 }
 
 func (h Hasher) Sum() (hash Hash) {
-	copy(hash[:], h.Hash.Sum(nil))
-	return
+	return NewHashFromBytes(h.format, h.Hash.Sum(nil))
 }
@@ -40,3 +40,12 @@ func (s *HashSuite) TestNewHasher(c *C) {
 	hasher.Write([]byte(content))
 	c.Assert(hasher.Sum().String(), Equals, "dc42c3cc80028d0ec61f0a6b24cadd1c195c4dfc")
 }
+
+func (s *HashSuite) TestHasPrefix(c *C) {
+	hash := NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")
+	c.Assert(hash.HasPrefix(""), Equals, true)
+	c.Assert(hash.HasPrefix("8ab6"), Equals, true)
+	c.Assert(hash.HasPrefix("8ab686eafeb1f44702738c8b0f24f2567c36da6d"), Equals, true)
+	c.Assert(hash.HasPrefix("8ab7"), Equals, false)
+	c.Assert(hash.HasPrefix("8AB6"), Equals, false)
+}
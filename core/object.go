@@ -2,14 +2,26 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
 var (
 	ErrObjectNotFound = errors.New("object not found")
+	// ErrObjectNotDeletable is returned by DeletableObjectStorage.Delete
+	// when the object cannot be deleted alone.
+	ErrObjectNotDeletable = errors.New("object cannot be deleted alone")
 	// ErrInvalidType is returned when an invalid object type is provided.
 	ErrInvalidType = errors.New("invalid object type")
+	// ErrSkipDir is returned by the callbacks of the walk functions to skip
+	// the directory they are called for.
+	ErrSkipDir = errors.New("skip this directory")
+	// ErrStop is returned by the callbacks of the iteration functions to
+	// stop the iteration without an error.
+	ErrStop = errors.New("stop iteration")
 )
 
 // TODO: Consider adding a Hash function to the ObjectReader and ObjectWriter
@@ -46,6 +58,180 @@ type ObjectStorage interface {
 	Iter(ObjectType) (ObjectIter, error)
 }
 
+// HasObjectStorage is implemented by the ObjectStorages that can tell
+// whether they have an object without reading it. It is optional, see
+// HasObject.
+type HasObjectStorage interface {
+	ObjectStorage
+	// Has returns true if the storage has the object with the given hash.
+	Has(Hash) (bool, error)
+}
+
+// HasObject reports whether s has the object with the given hash, using its
+// Has method if it implements HasObjectStorage, so the object is not read,
+// or its Get method otherwise.
+func HasObject(s ObjectStorage, h Hash) (bool, error) {
+	if hs, ok := s.(HasObjectStorage); ok {
+		return hs.Has(h)
+	}
+
+	_, err := s.Get(h)
+	if err == ErrObjectNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// BatchObjectStorage is implemented by the ObjectStorages that can read
+// several objects at once faster than one by one, like the packfile based
+// ones, which can read them in the order they are stored. It is optional,
+// see GetMany.
+type BatchObjectStorage interface {
+	ObjectStorage
+	// GetMany returns the objects with the given hashes, as the GetMany
+	// function does.
+	GetMany([]Hash) ([]Object, error)
+}
+
+// GetManyError is returned by GetMany when some of the objects are not
+// found, Errors holds the error of each of them by its position in the
+// requested hashes. The objects found are returned along with it.
+type GetManyError struct {
+	Errors map[int]error
+}
+
+func (e *GetManyError) Error() string {
+	return fmt.Sprintf("%d objects not found", len(e.Errors))
+}
+
+// GetMany returns the objects with the given hashes from s, in the same
+// order, using its GetMany method if it implements BatchObjectStorage or
+// calling Get for each hash otherwise. The objects not found are nil and
+// reported with ErrObjectNotFound in a *GetManyError, any other error stops
+// the read and is returned as is.
+func GetMany(s ObjectStorage, hs []Hash) ([]Object, error) {
+	if bs, ok := s.(BatchObjectStorage); ok {
+		return bs.GetMany(hs)
+	}
+
+	objs := make([]Object, len(hs))
+	missing := make(map[int]error, 0)
+	for i, h := range hs {
+		obj, err := s.Get(h)
+		if err == ErrObjectNotFound {
+			missing[i] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objs[i] = obj
+	}
+
+	if len(missing) != 0 {
+		return objs, &GetManyError{Errors: missing}
+	}
+
+	return objs, nil
+}
+
+// PrefixObjectStorage is implemented by the ObjectStorages that can find the
+// objects whose hashes start with a prefix without reading every object,
+// like the ones with idx files, whose hashes are sorted. It is optional, see
+// HashesWithPrefix.
+type PrefixObjectStorage interface {
+	ObjectStorage
+	// HashesWithPrefix returns the hashes starting with the given prefix,
+	// as the HashesWithPrefix function does.
+	HashesWithPrefix(prefix string) ([]Hash, error)
+}
+
+// HashesWithPrefix returns the hashes of the objects of s whose hexadecimal
+// representation starts with the given prefix, in lowercase, sorted. It
+// uses the HashesWithPrefix method of s if it implements
+// PrefixObjectStorage, or iterates over all the objects of every type
+// otherwise.
+func HashesWithPrefix(s ObjectStorage, prefix string) ([]Hash, error) {
+	var hashes []Hash
+	if ps, ok := s.(PrefixObjectStorage); ok {
+		var err error
+		if hashes, err = ps.HashesWithPrefix(prefix); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, t := range []ObjectType{CommitObject, TreeObject, BlobObject, TagObject} {
+			iter, err := s.Iter(t)
+			if err != nil {
+				return nil, err
+			}
+
+			err = ForEachContext(context.Background(), iter, func(obj Object) error {
+				if h := obj.Hash(); h.HasPrefix(prefix) {
+					hashes = append(hashes, h)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	SortHashes(hashes)
+	return hashes, nil
+}
+
+// ConcurrentSafeObjectStorage is implemented by the ObjectStorages that
+// report whether their Get can be called from several goroutines at once.
+// It is optional, the storages not implementing it are only used from one
+// goroutine at a time by the parallel walks.
+type ConcurrentSafeObjectStorage interface {
+	ObjectStorage
+	ConcurrentSafe() bool
+}
+
+// DeletableObjectStorage is implemented by the ObjectStorages that can
+// delete objects. It is optional, see Repository.Prune.
+type DeletableObjectStorage interface {
+	ObjectStorage
+	// Delete deletes the object with the given hash. ErrObjectNotFound is
+	// returned if there is no such object, and ErrObjectNotDeletable if it
+	// cannot be deleted alone, like the objects of the packfiles.
+	Delete(Hash) error
+}
+
+// TimedObjectStorage is implemented by the ObjectStorages that know when
+// their objects were written. It is optional, see Repository.Prune.
+type TimedObjectStorage interface {
+	ObjectStorage
+	// ModTime returns the last time the object with the given hash was
+	// written, ErrObjectNotFound is returned if there is no such object.
+	ModTime(Hash) (time.Time, error)
+}
+
+// FormatObjectStorage is implemented by the ObjectStorages of repositories
+// whose objects can be named in another format than SHA1. It is optional,
+// see ObjectStorageFormat.
+type FormatObjectStorage interface {
+	ObjectStorage
+	// ObjectFormat returns the format of the hashes of the objects, the
+	// objects of another format cannot be set.
+	ObjectFormat() ObjectFormat
+}
+
+// ObjectStorageFormat returns the ObjectFormat of the objects of s, SHA1 if
+// it does not implement FormatObjectStorage.
+func ObjectStorageFormat(s ObjectStorage) ObjectFormat {
+	if fs, ok := s.(FormatObjectStorage); ok {
+		return fs.ObjectFormat()
+	}
+
+	return SHA1
+}
+
 // ObjectType internal object type's
 type ObjectType int8
 
@@ -114,6 +300,54 @@ type ObjectIter interface {
 	Close()
 }
 
+// ObjectIterContext is implemented by the ObjectIters with their own
+// ForEachContext, it is optional so existing implementations of ObjectIter
+// keep working with the ForEachContext function.
+type ObjectIterContext interface {
+	ObjectIter
+	// ForEachContext calls cb for each object of the iterator, as the
+	// ForEachContext function does.
+	ForEachContext(ctx context.Context, cb func(Object) error) error
+}
+
+// ForEachContext calls cb for each object of iter until the iterator is
+// exhausted, cb returns an error or ctx is done, checking ctx before every
+// object, and then closes iter. If cb returns ErrStop the iteration stops
+// without an error, if ctx is done its error is returned. The
+// ForEachContext method of iter is used if it implements ObjectIterContext.
+func ForEachContext(ctx context.Context, iter ObjectIter, cb func(Object) error) error {
+	if i, ok := iter.(ObjectIterContext); ok {
+		return i.ForEachContext(ctx, cb)
+	}
+
+	return forEachContext(ctx, iter, cb)
+}
+
+func forEachContext(ctx context.Context, iter ObjectIter, cb func(Object) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		obj, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(obj); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
 // ObjectLookupIter implements ObjectIter. It iterates over a series of object
 // hashes and yields their associated objects by retrieving each one from
 // object storage. The retrievals are lazy and only occur when the iterator
@@ -152,6 +386,12 @@ func (iter *ObjectLookupIter) Next() (Object, error) {
 	return obj, err
 }
 
+// ForEachContext calls cb for each object of the iterator and closes it,
+// see the ForEachContext function.
+func (iter *ObjectLookupIter) ForEachContext(ctx context.Context, cb func(Object) error) error {
+	return forEachContext(ctx, iter, cb)
+}
+
 // Close releases any resources used by the iterator.
 func (iter *ObjectLookupIter) Close() {
 	iter.pos = len(iter.series)
@@ -186,6 +426,12 @@ func (iter *ObjectSliceIter) Next() (Object, error) {
 	return obj, nil
 }
 
+// ForEachContext calls cb for each object of the iterator and closes it,
+// see the ForEachContext function.
+func (iter *ObjectSliceIter) ForEachContext(ctx context.Context, cb func(Object) error) error {
+	return forEachContext(ctx, iter, cb)
+}
+
 // Close releases any resources used by the iterator.
 func (iter *ObjectSliceIter) Close() {
 	iter.pos = len(iter.series)
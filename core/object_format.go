@@ -0,0 +1,141 @@
+package core
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+)
+
+// ErrUnsupportedObjectFormat is returned by ParseObjectFormat when the name
+// is not the one of a supported ObjectFormat.
+var ErrUnsupportedObjectFormat = errors.New("unsupported object format")
+
+// ObjectFormat is the hash algorithm naming the objects of a repository, as
+// chosen by git init --object-format. The zero value is SHA1, the default.
+type ObjectFormat byte
+
+const (
+	// SHA1 is the format of the repositories by default, with 20-byte hashes.
+	SHA1 ObjectFormat = iota
+	// SHA256 is the format of the repositories initialized with
+	// --object-format=sha256, with 32-byte hashes.
+	SHA256
+)
+
+// ParseObjectFormat returns the ObjectFormat with the given name, as written
+// in the extensions.objectformat option of the config of the repositories
+// and the object-format capability of the wire protocol. The empty name is
+// the one of SHA1.
+func ParseObjectFormat(name string) (ObjectFormat, error) {
+	switch name {
+	case "", "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	default:
+		return SHA1, ErrUnsupportedObjectFormat
+	}
+}
+
+func (f ObjectFormat) String() string {
+	switch f {
+	case SHA1:
+		return "sha1"
+	case SHA256:
+		return "sha256"
+	default:
+		return "unknown"
+	}
+}
+
+// Size returns the size in bytes of the hashes of the format.
+func (f ObjectFormat) Size() int {
+	if f == SHA256 {
+		return sha256.Size
+	}
+
+	return sha1.Size
+}
+
+// HexSize returns the length of the hexadecimal representation of the
+// hashes of the format.
+func (f ObjectFormat) HexSize() int {
+	return f.Size() * 2
+}
+
+// ZeroHash returns the Hash of the format with value zero.
+func (f ObjectFormat) ZeroHash() Hash {
+	return NewHashFromBytes(f, nil)
+}
+
+// New returns a new hash.Hash computing the hashes of the format, used for
+// the objects as well as the checksums of the packfiles and the idx files.
+func (f ObjectFormat) New() hash.Hash {
+	if f == SHA256 {
+		return sha256.New()
+	}
+
+	return sha1.New()
+}
+
+// ComputeHash computes the hash in the format of an object with the given
+// type and content.
+func (f ObjectFormat) ComputeHash(t ObjectType, content []byte) Hash {
+	h := f.NewHasher(t, int64(len(content)))
+	h.Write(content)
+	return h.Sum()
+}
+
+// NewHasher returns a Hasher computing the hash in the format of an object
+// with the given type and size, from its content written to it.
+func (f ObjectFormat) NewHasher(t ObjectType, size int64) Hasher {
+	h := Hasher{Hash: f.New(), format: f}
+	h.Write(t.Bytes())
+	h.Write([]byte(" "))
+	h.Write([]byte(strconv.FormatInt(size, 10)))
+	h.Write([]byte{0})
+	return h
+}
+
+// IsHashHex returns true if s is a full hexadecimal hash in lowercase of any
+// supported format, 40 digits for SHA1 and 64 for SHA256.
+func IsHashHex(s string) bool {
+	if len(s) != SHA1.HexSize() && len(s) != SHA256.HexSize() {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrObjectFormatMismatch is returned by the operations mixing the hashes or
+// the objects of different formats, like storing a SHA1 object in the
+// storage of a SHA256 repository, or fetching from a remote of another
+// format.
+type ErrObjectFormatMismatch struct {
+	Expected ObjectFormat
+	Actual   ObjectFormat
+}
+
+func (e *ErrObjectFormatMismatch) Error() string {
+	return fmt.Sprintf("object format mismatch: expected %s, found %s", e.Expected, e.Actual)
+}
+
+// CheckObjectFormat returns a *ErrObjectFormatMismatch if the format of h is
+// not f.
+func CheckObjectFormat(f ObjectFormat, h Hash) error {
+	if h.Format() != f {
+		return &ErrObjectFormatMismatch{Expected: f, Actual: h.Format()}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type ObjectFormatSuite struct{}
+
+var _ = Suite(&ObjectFormatSuite{})
+
+func (s *ObjectFormatSuite) TestParseObjectFormat(c *C) {
+	f, err := ParseObjectFormat("")
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, SHA1)
+
+	f, err = ParseObjectFormat("sha1")
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, SHA1)
+
+	f, err = ParseObjectFormat("sha256")
+	c.Assert(err, IsNil)
+	c.Assert(f, Equals, SHA256)
+	c.Assert(f.String(), Equals, "sha256")
+
+	_, err = ParseObjectFormat("md5")
+	c.Assert(err, Equals, ErrUnsupportedObjectFormat)
+}
+
+func (s *ObjectFormatSuite) TestSize(c *C) {
+	c.Assert(SHA1.Size(), Equals, 20)
+	c.Assert(SHA1.HexSize(), Equals, 40)
+	c.Assert(SHA256.Size(), Equals, 32)
+	c.Assert(SHA256.HexSize(), Equals, 64)
+}
+
+func (s *ObjectFormatSuite) TestComputeHash(c *C) {
+	hash := SHA256.ComputeHash(BlobObject, []byte(""))
+	c.Assert(hash.String(), Equals, "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813")
+	c.Assert(hash.Format(), Equals, SHA256)
+
+	hash = SHA256.ComputeHash(BlobObject, []byte("Hello, World!\n"))
+	c.Assert(hash.String(), Equals, "dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55653")
+	c.Assert(hash, Equals, NewHash(hash.String()))
+	c.Assert(hash.Bytes(), HasLen, 32)
+}
+
+func (s *ObjectFormatSuite) TestZeroHash(c *C) {
+	c.Assert(SHA1.ZeroHash(), Equals, ZeroHash)
+	c.Assert(SHA256.ZeroHash().IsZero(), Equals, true)
+	c.Assert(SHA256.ZeroHash(), Not(Equals), ZeroHash)
+	c.Assert(SHA256.ZeroHash().String(), HasLen, 64)
+}
+
+func (s *ObjectFormatSuite) TestIsHashHex(c *C) {
+	c.Assert(IsHashHex("8ab686eafeb1f44702738c8b0f24f2567c36da6d"), Equals, true)
+	c.Assert(IsHashHex("dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55653"), Equals, true)
+	c.Assert(IsHashHex("8AB686EAFEB1F44702738C8B0F24F2567C36DA6D"), Equals, false)
+	c.Assert(IsHashHex("8ab686eafeb1f44702738c8b0f24f2567c36da6"), Equals, false)
+	c.Assert(IsHashHex("8ab686eafeb1f44702738c8b0f24f2567c36daxx"), Equals, false)
+}
+
+func (s *ObjectFormatSuite) TestCheckObjectFormat(c *C) {
+	c.Assert(CheckObjectFormat(SHA1, ZeroHash), IsNil)
+
+	err := CheckObjectFormat(SHA1, SHA256.ZeroHash())
+	c.Assert(err, DeepEquals, &ErrObjectFormatMismatch{Expected: SHA1, Actual: SHA256})
+	c.Assert(err.Error(), Equals, "object format mismatch: expected sha1, found sha256")
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	. "gopkg.in/check.v1"
+)
+
+type ObjectSuite struct{}
+
+var _ = Suite(&ObjectSuite{})
+
+// closeTrackingIter is an ObjectIter without ForEachContext
+type closeTrackingIter struct {
+	ObjectIter
+	closed bool
+}
+
+func (iter *closeTrackingIter) Close() {
+	iter.closed = true
+	iter.ObjectIter.Close()
+}
+
+func newTestObjects() []Object {
+	return []Object{&testObject{}, &testObject{}, &testObject{}}
+}
+
+func (s *ObjectSuite) TestForEachContextCancel(c *C) {
+	for _, iter := range []ObjectIter{
+		NewObjectSliceIter(newTestObjects()),
+		&closeTrackingIter{ObjectIter: NewObjectSliceIter(newTestObjects())},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var count int
+		err := ForEachContext(ctx, iter, func(Object) error {
+			count++
+			if count == 2 {
+				cancel()
+			}
+
+			return nil
+		})
+		c.Assert(err, Equals, context.Canceled)
+		c.Assert(count, Equals, 2)
+
+		_, err = iter.Next()
+		c.Assert(err, Equals, io.EOF)
+		if t, ok := iter.(*closeTrackingIter); ok {
+			c.Assert(t.closed, Equals, true)
+		}
+	}
+}
+
+func (s *ObjectSuite) TestForEachContextStop(c *C) {
+	var count int
+	err := ForEachContext(context.Background(), NewObjectSliceIter(newTestObjects()), func(Object) error {
+		count++
+		return ErrStop
+	})
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 1)
+
+	expected := errors.New("foo")
+	err = ForEachContext(context.Background(), NewObjectSliceIter(newTestObjects()), func(Object) error {
+		return expected
+	})
+	c.Assert(err, Equals, expected)
+
+	count = 0
+	err = ForEachContext(context.Background(), NewObjectSliceIter(newTestObjects()), func(Object) error {
+		count++
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 3)
+}
+
+func (s *ObjectSuite) TestObjectLookupIterForEachContext(c *C) {
+	storage := &testStorage{}
+	iter := NewObjectLookupIter(storage, []Hash{NewHash("0000000000000000000000000000000000000001"), NewHash("0000000000000000000000000000000000000002")})
+	err := iter.ForEachContext(context.Background(), func(Object) error { return nil })
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+type testObject struct {
+	Object
+}
+
+type testStorage struct {
+	ObjectStorage
+}
+
+func (s *testStorage) Get(Hash) (Object, error) {
+	return nil, ErrObjectNotFound
+}
+
+type testHasStorage struct {
+	testStorage
+}
+
+func (s *testHasStorage) Has(h Hash) (bool, error) {
+	return h == NewHash("0000000000000000000000000000000000000001"), nil
+}
+
+func (s *ObjectSuite) TestHasObject(c *C) {
+	ok, err := HasObject(&testStorage{}, NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	ok, err = HasObject(&testHasStorage{}, NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = HasObject(&testHasStorage{}, NewHash("0000000000000000000000000000000000000002"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+var errTestGet = errors.New("get failed")
+
+// testGetStorage only has the object 1, and fails reading the object 3
+type testGetStorage struct {
+	testStorage
+	obj Object
+}
+
+func (s *testGetStorage) Get(h Hash) (Object, error) {
+	switch h {
+	case NewHash("0000000000000000000000000000000000000001"):
+		return s.obj, nil
+	case NewHash("0000000000000000000000000000000000000003"):
+		return nil, errTestGet
+	default:
+		return nil, ErrObjectNotFound
+	}
+}
+
+func (s *ObjectSuite) TestGetMany(c *C) {
+	storage := &testGetStorage{obj: &testObject{}}
+	one := NewHash("0000000000000000000000000000000000000001")
+	two := NewHash("0000000000000000000000000000000000000002")
+
+	objs, err := GetMany(storage, []Hash{one, one})
+	c.Assert(err, IsNil)
+	c.Assert(objs, DeepEquals, []Object{storage.obj, storage.obj})
+
+	objs, err = GetMany(storage, []Hash{two, one, two})
+	c.Assert(err, DeepEquals, &GetManyError{Errors: map[int]error{
+		0: ErrObjectNotFound,
+		2: ErrObjectNotFound,
+	}})
+	c.Assert(err, ErrorMatches, "2 objects not found")
+	c.Assert(objs, DeepEquals, []Object{nil, storage.obj, nil})
+
+	_, err = GetMany(storage, []Hash{two, NewHash("0000000000000000000000000000000000000003")})
+	c.Assert(err, Equals, errTestGet)
+
+	objs, err = GetMany(storage, nil)
+	c.Assert(err, IsNil)
+	c.Assert(objs, HasLen, 0)
+}
+
+// testIterStorage has blobs with the given hashes
+type testIterStorage struct {
+	testStorage
+	hashes []string
+}
+
+func (s *testIterStorage) Iter(t ObjectType) (ObjectIter, error) {
+	var objs []Object
+	if t == BlobObject {
+		for _, h := range s.hashes {
+			objs = append(objs, &testSizedObject{h: NewHash(h)})
+		}
+	}
+
+	return NewObjectSliceIter(objs), nil
+}
+
+type testPrefixStorage struct {
+	testStorage
+}
+
+func (s *testPrefixStorage) HashesWithPrefix(prefix string) ([]Hash, error) {
+	return []Hash{
+		NewHash("0000000000000000000000000000000000000002"),
+		NewHash("0000000000000000000000000000000000000001"),
+	}, nil
+}
+
+func (s *ObjectSuite) TestHashesWithPrefix(c *C) {
+	storage := &testIterStorage{hashes: []string{
+		"abcd000000000000000000000000000000000002",
+		"abce000000000000000000000000000000000000",
+		"abcd000000000000000000000000000000000001",
+	}}
+
+	hashes, err := HashesWithPrefix(storage, "abcd")
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []Hash{
+		NewHash("abcd000000000000000000000000000000000001"),
+		NewHash("abcd000000000000000000000000000000000002"),
+	})
+
+	hashes, err = HashesWithPrefix(storage, "abcf")
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+
+	// the hashes are sorted
+	hashes, err = HashesWithPrefix(&testPrefixStorage{}, "0000")
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []Hash{
+		NewHash("0000000000000000000000000000000000000001"),
+		NewHash("0000000000000000000000000000000000000002"),
+	})
+}
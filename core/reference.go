@@ -0,0 +1,345 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrReferenceNotFound is returned by the ReferenceStorages when the
+	// reference requested does not exist.
+	ErrReferenceNotFound = errors.New("reference not found")
+	// ErrInvalidReference is returned when the contents of a reference can
+	// not be parsed.
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrReferenceLoop is returned by ResolveReference when a chain of
+	// symbolic references is a loop or is longer than MaxResolveDepth.
+	ErrReferenceLoop = errors.New("symbolic reference loop or chain too long")
+	// ErrReferenceHasChanged is returned by SetReferenceChecked when the
+	// stored reference is not the expected one, as another writer updated
+	// it meanwhile.
+	ErrReferenceHasChanged = errors.New("reference has changed concurrently")
+	// ErrInvalidReferenceName is returned when a reference name does not
+	// follow the rules of git, see ReferenceName.Valid.
+	ErrInvalidReferenceName = errors.New("invalid reference name")
+)
+
+const symrefPrefix = "ref: "
+
+// ReferenceName is the full name of a reference, like "refs/heads/master"
+// or "HEAD".
+type ReferenceName string
+
+// HEAD is the name of the reference to the commit checked out.
+const HEAD ReferenceName = "HEAD"
+
+// MergeHead is the name of the pseudo reference to the commit being merged,
+// while a merge is stopped, which the next commit has as a parent.
+const MergeHead ReferenceName = "MERGE_HEAD"
+
+func (n ReferenceName) String() string {
+	return string(n)
+}
+
+// Valid reports whether the name follows the rules of git check-ref-format,
+// one level names like HEAD allowed: none of its slash separated components
+// is empty, begins with "." or ends with ".lock", it does not end with ".",
+// is not "@" and does not contain "..", "@{", control characters, spaces nor
+// any of the characters ~^:?*[\.
+func (n ReferenceName) Valid() bool {
+	s := string(n)
+	if s == "" || s == "@" || strings.HasSuffix(s, ".") ||
+		strings.Contains(s, "..") || strings.Contains(s, "@{") {
+		return false
+	}
+
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+
+	for _, p := range strings.Split(s, "/") {
+		if p == "" || p[0] == '.' || strings.HasSuffix(p, ".lock") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReferenceType is the type of a reference, hash references point to an
+// object and symbolic references to another reference.
+type ReferenceType int8
+
+const (
+	InvalidReference  ReferenceType = 0
+	HashReference     ReferenceType = 1
+	SymbolicReference ReferenceType = 2
+)
+
+func (t ReferenceType) String() string {
+	switch t {
+	case HashReference:
+		return "hash-reference"
+	case SymbolicReference:
+		return "symbolic-reference"
+	default:
+		return "invalid-reference"
+	}
+}
+
+// Reference is a named pointer to an object, by its Hash, or to another
+// reference, by its name in Target if it is symbolic.
+type Reference struct {
+	Type   ReferenceType
+	Name   ReferenceName
+	Hash   Hash
+	Target ReferenceName
+}
+
+// NewHashReference returns a reference with the given name pointing to the
+// object with the given hash.
+func NewHashReference(n ReferenceName, h Hash) *Reference {
+	return &Reference{Type: HashReference, Name: n, Hash: h}
+}
+
+// NewSymbolicReference returns a reference with the given name pointing to
+// the reference target.
+func NewSymbolicReference(n, target ReferenceName) *Reference {
+	return &Reference{Type: SymbolicReference, Name: n, Target: target}
+}
+
+// ParseReference returns the reference with the given name and contents, in
+// the format of the files of the git directory: a hexadecimal hash, or
+// "ref: " followed by the target name for the symbolic ones. Leading and
+// trailing white space is ignored.
+func ParseReference(n ReferenceName, content string) (*Reference, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, symrefPrefix) {
+		target := strings.TrimSpace(strings.TrimPrefix(content, symrefPrefix))
+		if target == "" {
+			return nil, ErrInvalidReference
+		}
+
+		return NewSymbolicReference(n, ReferenceName(target)), nil
+	}
+
+	if !isHexHash(content) {
+		return nil, ErrInvalidReference
+	}
+
+	return NewHashReference(n, NewHash(content)), nil
+}
+
+func isHexHash(s string) bool {
+	if len(s) != SHA1.HexSize() && len(s) != SHA256.HexSize() {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Content returns the contents of the reference in the format of the files
+// of the git directory, see ParseReference, without the trailing newline.
+func (r *Reference) Content() string {
+	if r.Type == SymbolicReference {
+		return symrefPrefix + r.Target.String()
+	}
+
+	return r.Hash.String()
+}
+
+// IsSymbolic returns true if the reference points to another reference.
+func (r *Reference) IsSymbolic() bool {
+	return r.Type == SymbolicReference
+}
+
+func (r *Reference) String() string {
+	return fmt.Sprintf("%s %s", r.Content(), r.Name)
+}
+
+// ReferenceStorage generic storage of references
+type ReferenceStorage interface {
+	Set(*Reference) error
+	Get(ReferenceName) (*Reference, error)
+	Iter() (ReferenceIter, error)
+	// Remove deletes the reference with the given name, ErrReferenceNotFound
+	// is returned if there is no such reference.
+	Remove(ReferenceName) error
+}
+
+// PrefixReferenceStorage is implemented by the ReferenceStorages that can
+// iterate the references with a given prefix without reading all of them.
+// It is optional, see IterReferencesPrefix.
+type PrefixReferenceStorage interface {
+	ReferenceStorage
+	// IterPrefix returns an iterator for the references whose name starts
+	// with the given prefix, as IterReferencesPrefix does.
+	IterPrefix(prefix string) (ReferenceIter, error)
+}
+
+// IterReferencesPrefix returns an iterator for the references of s whose
+// name starts with the given prefix, like "refs/heads/", in the order of
+// Iter. It uses the IterPrefix method of s if it implements
+// PrefixReferenceStorage, or filters all the references otherwise.
+func IterReferencesPrefix(s ReferenceStorage, prefix string) (ReferenceIter, error) {
+	if ps, ok := s.(PrefixReferenceStorage); ok {
+		return ps.IterPrefix(prefix)
+	}
+
+	iter, err := s.Iter()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var refs []*Reference
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(ref.Name.String(), prefix) {
+			refs = append(refs, ref)
+		}
+	}
+
+	return NewReferenceSliceIter(refs), nil
+}
+
+// CheckedReferenceStorage is implemented by the ReferenceStorages that can
+// update a reference only if it has not changed, atomically. It is
+// optional, see SetReferenceChecked.
+type CheckedReferenceStorage interface {
+	ReferenceStorage
+	// SetChecked stores new only if the stored reference with its name is
+	// old, as SetReferenceChecked does.
+	SetChecked(new, old *Reference) error
+}
+
+// SetReferenceChecked stores the reference new in s only if the reference
+// stored with its name is old, compared by their contents, or there is none
+// if old is nil; ErrReferenceHasChanged is returned otherwise. The check and
+// the update are atomic if s implements CheckedReferenceStorage, otherwise
+// the reference is read and then stored, so a concurrent update can still
+// be overwritten.
+func SetReferenceChecked(s ReferenceStorage, new, old *Reference) error {
+	if cs, ok := s.(CheckedReferenceStorage); ok {
+		return cs.SetChecked(new, old)
+	}
+
+	current, err := s.Get(new.Name)
+	if err != nil && err != ErrReferenceNotFound {
+		return err
+	}
+
+	if err := CheckReferenceUnchanged(current, old); err != nil {
+		return err
+	}
+
+	return s.Set(new)
+}
+
+// CheckReferenceUnchanged returns ErrReferenceHasChanged if the current
+// reference, nil if there is none, is not the old one, comparing their
+// contents, see SetReferenceChecked.
+func CheckReferenceUnchanged(current, old *Reference) error {
+	if current == nil && old == nil {
+		return nil
+	}
+
+	if current == nil || old == nil || current.Content() != old.Content() {
+		return ErrReferenceHasChanged
+	}
+
+	return nil
+}
+
+// MaxResolveDepth is the maximum number of symbolic references followed by
+// ResolveReference, the same limit git has.
+const MaxResolveDepth = 5
+
+// ResolveReference returns the hash reference the reference with the given
+// name points to, following its symbolic references, or the reference itself
+// if it is a hash reference. ErrReferenceNotFound is returned if any
+// reference of the chain does not exist, and ErrReferenceLoop if more than
+// MaxResolveDepth symbolic references have to be followed.
+func ResolveReference(s ReferenceStorage, n ReferenceName) (*Reference, error) {
+	for depth := 0; depth <= MaxResolveDepth; depth++ {
+		ref, err := s.Get(n)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ref.IsSymbolic() {
+			return ref, nil
+		}
+
+		n = ref.Target
+	}
+
+	return nil, ErrReferenceLoop
+}
+
+// Storage is the storage of the objects and the references of a repository.
+type Storage interface {
+	ObjectStorage() ObjectStorage
+	ReferenceStorage() ReferenceStorage
+}
+
+// ReferenceIter is a generic closable interface for iterating over
+// references.
+type ReferenceIter interface {
+	Next() (*Reference, error)
+	Close()
+}
+
+// ReferenceSliceIter implements ReferenceIter. It iterates over a series of
+// references stored in a slice and yields each one in turn when Next() is
+// called.
+//
+// The ReferenceSliceIter must be closed with a call to Close() when it is no
+// longer needed.
+type ReferenceSliceIter struct {
+	series []*Reference
+	pos    int
+}
+
+// NewReferenceSliceIter returns a reference iterator for the given slice of
+// references.
+func NewReferenceSliceIter(series []*Reference) *ReferenceSliceIter {
+	return &ReferenceSliceIter{
+		series: series,
+	}
+}
+
+// Next returns the next reference from the iterator. If the iterator has
+// reached the end it will return io.EOF as an error.
+func (iter *ReferenceSliceIter) Next() (*Reference, error) {
+	if iter.pos >= len(iter.series) {
+		return nil, io.EOF
+	}
+
+	r := iter.series[iter.pos]
+	iter.pos++
+	return r, nil
+}
+
+// Close releases any resources used by the iterator.
+func (iter *ReferenceSliceIter) Close() {
+	iter.pos = len(iter.series)
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReferenceSuite struct{}
+
+var _ = Suite(&ReferenceSuite{})
+
+func (s *ReferenceSuite) TestParseReference(c *C) {
+	ref, err := ParseReference("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n")
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, NewHashReference("refs/heads/master", NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")))
+	c.Assert(ref.Content(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(ref.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master")
+
+	ref, err = ParseReference(HEAD, "ref: refs/heads/master\n")
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, NewSymbolicReference(HEAD, "refs/heads/master"))
+	c.Assert(ref.Content(), Equals, "ref: refs/heads/master")
+
+	for _, content := range []string{"", "ref: ", "6ecf0ef2", "6ecf0ef2c2dffb796033e5a02219af86ec6584zz"} {
+		_, err = ParseReference(HEAD, content)
+		c.Assert(err, Equals, ErrInvalidReference, Commentf("content=%q", content))
+	}
+}
+
+func (s *ReferenceSuite) TestReferenceNameValid(c *C) {
+	for _, n := range []ReferenceName{
+		HEAD, "refs/heads/master", "refs/tags/v1.0", "refs/heads/feature/foo-bar_baz", "refs/tags/a.b@c",
+	} {
+		c.Assert(n.Valid(), Equals, true, Commentf("name=%q", n))
+	}
+
+	for _, n := range []ReferenceName{
+		"", "@", "refs/heads/", "/refs/heads/foo", "refs//heads", "refs/heads/.foo",
+		"refs/heads/foo.", "refs/heads/foo.lock", "refs/heads/foo..bar", "refs/heads/foo@{1}",
+		"refs/heads/foo bar", "refs/heads/foo\tbar", "refs/heads/foo~1", "refs/heads/foo^",
+		"refs/heads/a:b", "refs/heads/a?", "refs/heads/a*", "refs/heads/a[b", "refs/heads/a\\b",
+		"refs/heads/a\x7f",
+	} {
+		c.Assert(n.Valid(), Equals, false, Commentf("name=%q", n))
+	}
+}
+
+func (s *ReferenceSuite) TestReferenceSliceIter(c *C) {
+	refs := []*Reference{NewSymbolicReference(HEAD, "refs/heads/master")}
+	iter := NewReferenceSliceIter(refs)
+
+	ref, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, refs[0])
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *ReferenceSuite) TestResolveReference(c *C) {
+	hash := NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	storage := referenceMap{}
+	for _, ref := range []*Reference{
+		NewSymbolicReference(HEAD, "refs/heads/master"),
+		NewHashReference("refs/heads/master", hash),
+		NewSymbolicReference("refs/heads/a", "refs/heads/b"),
+		NewSymbolicReference("refs/heads/b", "refs/heads/a"),
+		NewSymbolicReference("refs/heads/missing", "refs/heads/foo"),
+	} {
+		storage.Set(ref)
+	}
+
+	ref, err := ResolveReference(storage, HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, NewHashReference("refs/heads/master", hash))
+	c.Assert(ref.IsSymbolic(), Equals, false)
+
+	ref, err = ResolveReference(storage, "refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Name, Equals, ReferenceName("refs/heads/master"))
+
+	_, err = ResolveReference(storage, "refs/heads/a")
+	c.Assert(err, Equals, ErrReferenceLoop)
+
+	_, err = ResolveReference(storage, "refs/heads/missing")
+	c.Assert(err, Equals, ErrReferenceNotFound)
+}
+
+func (s *ReferenceSuite) TestResolveReferenceMaxDepth(c *C) {
+	storage := referenceMap{}
+	storage.Set(NewHashReference("refs/heads/0", NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")))
+	for i := 1; i <= MaxResolveDepth+1; i++ {
+		storage.Set(NewSymbolicReference(
+			ReferenceName(fmt.Sprintf("refs/heads/%d", i)),
+			ReferenceName(fmt.Sprintf("refs/heads/%d", i-1)),
+		))
+	}
+
+	_, err := ResolveReference(storage, ReferenceName(fmt.Sprintf("refs/heads/%d", MaxResolveDepth)))
+	c.Assert(err, IsNil)
+
+	_, err = ResolveReference(storage, ReferenceName(fmt.Sprintf("refs/heads/%d", MaxResolveDepth+1)))
+	c.Assert(err, Equals, ErrReferenceLoop)
+}
+
+// referenceMap is a minimal ReferenceStorage, core can not import the
+// storages.
+type referenceMap map[ReferenceName]*Reference
+
+func (m referenceMap) Set(ref *Reference) error {
+	m[ref.Name] = ref
+	return nil
+}
+
+func (m referenceMap) Get(n ReferenceName) (*Reference, error) {
+	ref, ok := m[n]
+	if !ok {
+		return nil, ErrReferenceNotFound
+	}
+
+	return ref, nil
+}
+
+func (m referenceMap) Iter() (ReferenceIter, error) {
+	var refs []*Reference
+	for _, ref := range m {
+		refs = append(refs, ref)
+	}
+
+	return NewReferenceSliceIter(refs), nil
+}
+
+func (m referenceMap) Remove(n ReferenceName) error {
+	delete(m, n)
+	return nil
+}
+
+func (s *ReferenceSuite) TestSetReferenceChecked(c *C) {
+	storage := referenceMap{}
+	a := NewHashReference("refs/heads/master", NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	b := NewSymbolicReference("refs/heads/master", "refs/heads/foo")
+
+	c.Assert(SetReferenceChecked(storage, a, b), Equals, ErrReferenceHasChanged)
+	c.Assert(SetReferenceChecked(storage, a, nil), IsNil)
+	c.Assert(SetReferenceChecked(storage, b, nil), Equals, ErrReferenceHasChanged)
+	c.Assert(SetReferenceChecked(storage, b, NewHashReference(a.Name, a.Hash)), IsNil)
+	c.Assert(storage[a.Name], Equals, b)
+}
+
+func (s *ReferenceSuite) TestIterReferencesPrefix(c *C) {
+	storage := referenceMap{}
+	for _, n := range []ReferenceName{HEAD, "refs/heads/master", "refs/heads/foo/bar", "refs/tags/v1"} {
+		storage.Set(NewHashReference(n, NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")))
+	}
+
+	for prefix, expected := range map[string][]ReferenceName{
+		"refs/heads/":  {"refs/heads/foo/bar", "refs/heads/master"},
+		"refs/heads/f": {"refs/heads/foo/bar"},
+		"refs/":        {"refs/heads/foo/bar", "refs/heads/master", "refs/tags/v1"},
+		"refs/notes/":  nil,
+	} {
+		iter, err := IterReferencesPrefix(storage, prefix)
+		c.Assert(err, IsNil)
+
+		var names []ReferenceName
+		for {
+			ref, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			names = append(names, ref.Name)
+		}
+
+		sort.Sort(referenceNames(names))
+		c.Assert(names, DeepEquals, expected, Commentf("prefix=%q", prefix))
+	}
+}
+
+type referenceNames []ReferenceName
+
+func (s referenceNames) Len() int           { return len(s) }
+func (s referenceNames) Less(i, j int) bool { return s[i] < s[j] }
+func (s referenceNames) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
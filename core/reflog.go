@@ -0,0 +1,69 @@
+package core
+
+import (
+	"io"
+)
+
+// ReflogEntry is an entry of the reflog of a reference, the record of one of
+// its updates: the hashes it pointed to before and after it, ZeroHash when
+// it was created or deleted, who did it and when, and why.
+type ReflogEntry struct {
+	Old       Hash
+	New       Hash
+	Committer Signature
+	Message   string
+}
+
+// ReflogStorage generic storage of the reflogs of the references
+type ReflogStorage interface {
+	// Append adds an entry at the end of the reflog of the reference with
+	// the given name, creating it if there is none.
+	Append(ReferenceName, *ReflogEntry) error
+	// Entries returns an iterator for the entries of the reflog of the
+	// reference with the given name, the oldest first, the iterator is
+	// empty if there is no reflog.
+	Entries(ReferenceName) (ReflogIter, error)
+}
+
+// ReflogIter is a generic closable interface for iterating over reflog
+// entries.
+type ReflogIter interface {
+	Next() (*ReflogEntry, error)
+	Close()
+}
+
+// ReflogSliceIter implements ReflogIter. It iterates over a series of
+// reflog entries stored in a slice and yields each one in turn when Next()
+// is called.
+//
+// The ReflogSliceIter must be closed with a call to Close() when it is no
+// longer needed.
+type ReflogSliceIter struct {
+	series []*ReflogEntry
+	pos    int
+}
+
+// NewReflogSliceIter returns a reflog iterator for the given slice of
+// entries.
+func NewReflogSliceIter(series []*ReflogEntry) *ReflogSliceIter {
+	return &ReflogSliceIter{
+		series: series,
+	}
+}
+
+// Next returns the next entry from the iterator. If the iterator has
+// reached the end it will return io.EOF as an error.
+func (iter *ReflogSliceIter) Next() (*ReflogEntry, error) {
+	if iter.pos >= len(iter.series) {
+		return nil, io.EOF
+	}
+
+	e := iter.series[iter.pos]
+	iter.pos++
+	return e, nil
+}
+
+// Close releases any resources used by the iterator.
+func (iter *ReflogSliceIter) Close() {
+	iter.pos = len(iter.series)
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrRefSpecMalformedSeparator is returned by RefSpec.Validate when the
+	// refspec has not a source and a destination separated by one colon.
+	ErrRefSpecMalformedSeparator = errors.New("malformed refspec, separators are wrong")
+	// ErrRefSpecMalformedWildcard is returned by RefSpec.Validate when the
+	// refspec has more than one wildcard on a side, or only on one of them.
+	ErrRefSpecMalformedWildcard = errors.New("malformed refspec, mismatched number of wildcards")
+)
+
+const (
+	refSpecForce     = "+"
+	refSpecSeparator = ":"
+	refSpecWildcard  = "*"
+)
+
+// RefSpec is a mapping from the references of a remote to the local ones, as
+// git writes them, eg.: "+refs/heads/*:refs/remotes/origin/*". It is the
+// source, the references matched, and the destination they are stored at,
+// separated by a colon. A wildcard in both matches any part of the name, the
+// same part in the destination. A leading "+" forces the updates that are
+// not fast-forwards.
+type RefSpec string
+
+// Validate returns ErrRefSpecMalformedSeparator or
+// ErrRefSpecMalformedWildcard if the refspec is malformed.
+func (s RefSpec) Validate() error {
+	spec := strings.TrimPrefix(string(s), refSpecForce)
+	if strings.Count(spec, refSpecSeparator) != 1 {
+		return ErrRefSpecMalformedSeparator
+	}
+
+	sep := strings.Index(spec, refSpecSeparator)
+	if sep == 0 && s.IsForceUpdate() {
+		return ErrRefSpecMalformedSeparator
+	}
+
+	src, dst := spec[:sep], spec[sep+1:]
+	ws, wd := strings.Count(src, refSpecWildcard), strings.Count(dst, refSpecWildcard)
+	if ws > 1 || wd > 1 || (ws != wd && dst != "") {
+		return ErrRefSpecMalformedWildcard
+	}
+
+	return nil
+}
+
+// IsForceUpdate reports whether the updates that are not fast-forwards are
+// forced, if the refspec begins with "+".
+func (s RefSpec) IsForceUpdate() bool {
+	return strings.HasPrefix(string(s), refSpecForce)
+}
+
+// IsDelete reports whether the refspec has no source, as the ones deleting
+// the destination on a push, eg.: ":refs/heads/foo".
+func (s RefSpec) IsDelete() bool {
+	return strings.HasPrefix(string(s), refSpecSeparator)
+}
+
+// IsWildcard reports whether the source of the refspec has a wildcard.
+func (s RefSpec) IsWildcard() bool {
+	return strings.Contains(s.Src(), refSpecWildcard)
+}
+
+// Src returns the source of the refspec.
+func (s RefSpec) Src() string {
+	spec := strings.TrimPrefix(string(s), refSpecForce)
+	if i := strings.Index(spec, refSpecSeparator); i != -1 {
+		return spec[:i]
+	}
+
+	return spec
+}
+
+// dst returns the destination of the refspec, empty if it has none.
+func (s RefSpec) dst() string {
+	spec := string(s)
+	if i := strings.Index(spec, refSpecSeparator); i != -1 {
+		return spec[i+1:]
+	}
+
+	return ""
+}
+
+// Match reports whether the reference name is matched by the source of the
+// refspec.
+func (s RefSpec) Match(n ReferenceName) bool {
+	if !s.IsWildcard() {
+		return s.Src() == n.String()
+	}
+
+	_, ok := s.wildcardMatch(n)
+	return ok
+}
+
+// wildcardMatch returns the part of the name matched by the wildcard of the
+// source.
+func (s RefSpec) wildcardMatch(n ReferenceName) (string, bool) {
+	src, name := s.Src(), n.String()
+	i := strings.Index(src, refSpecWildcard)
+	prefix, suffix := src[:i], src[i+1:]
+	if len(name) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// Dst returns the destination of the reference name, matched by the refspec,
+// with the part matched by the wildcard of the source, if any, in place of
+// the one of the destination. It is empty if the refspec has no destination
+// and the reference is not to be stored.
+func (s RefSpec) Dst(n ReferenceName) ReferenceName {
+	dst := s.dst()
+	if !s.IsWildcard() {
+		return ReferenceName(dst)
+	}
+
+	match, _ := s.wildcardMatch(n)
+	return ReferenceName(strings.Replace(dst, refSpecWildcard, match, 1))
+}
+
+func (s RefSpec) String() string {
+	return string(s)
+}
+
+// MatchAny reports whether the reference name is matched by any of the
+// refspecs.
+func MatchAny(specs []RefSpec, n ReferenceName) bool {
+	for _, s := range specs {
+		if s.Match(n) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type RefSpecSuite struct{}
+
+var _ = Suite(&RefSpecSuite{})
+
+func (s *RefSpecSuite) TestValidate(c *C) {
+	for _, spec := range []RefSpec{
+		"+refs/heads/*:refs/remotes/origin/*",
+		"refs/heads/master:refs/remotes/origin/master",
+		"refs/heads/*:refs/remotes/origin/foo-*",
+		"refs/heads/master:",
+		":refs/heads/foo",
+		"refs/tags/*:",
+	} {
+		c.Assert(spec.Validate(), IsNil, Commentf("spec=%q", spec))
+	}
+
+	for spec, expected := range map[RefSpec]error{
+		"refs/heads/master":                  ErrRefSpecMalformedSeparator,
+		"refs/heads/master:foo:bar":          ErrRefSpecMalformedSeparator,
+		"+:refs/heads/foo":                   ErrRefSpecMalformedSeparator,
+		"refs/heads/*:refs/remotes/origin/x": ErrRefSpecMalformedWildcard,
+		"refs/heads/x:refs/remotes/origin/*": ErrRefSpecMalformedWildcard,
+		"refs/*/*:refs/remotes/origin/*/*":   ErrRefSpecMalformedWildcard,
+	} {
+		c.Assert(spec.Validate(), Equals, expected, Commentf("spec=%q", spec))
+	}
+}
+
+func (s *RefSpecSuite) TestFlags(c *C) {
+	spec := RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	c.Assert(spec.IsForceUpdate(), Equals, true)
+	c.Assert(spec.IsDelete(), Equals, false)
+	c.Assert(spec.IsWildcard(), Equals, true)
+	c.Assert(spec.Src(), Equals, "refs/heads/*")
+
+	spec = RefSpec(":refs/heads/foo")
+	c.Assert(spec.IsForceUpdate(), Equals, false)
+	c.Assert(spec.IsDelete(), Equals, true)
+	c.Assert(spec.IsWildcard(), Equals, false)
+	c.Assert(spec.Src(), Equals, "")
+}
+
+func (s *RefSpecSuite) TestMatch(c *C) {
+	for _, t := range []struct {
+		spec     RefSpec
+		name     ReferenceName
+		expected bool
+	}{
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/master", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/feature/foo", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/tags/v1.0", false},
+		{"refs/heads/master:refs/remotes/origin/master", "refs/heads/master", true},
+		{"refs/heads/master:refs/remotes/origin/master", "refs/heads/master2", false},
+		{"refs/heads/foo-*-bar:refs/remotes/origin/*", "refs/heads/foo-x-bar", true},
+		{"refs/heads/foo-*-bar:refs/remotes/origin/*", "refs/heads/foo-bar", false},
+		{"refs/heads/foo-*-bar:refs/remotes/origin/*", "refs/heads/foo--bar", true},
+	} {
+		c.Assert(t.spec.Match(t.name), Equals, t.expected, Commentf("spec=%q name=%q", t.spec, t.name))
+	}
+}
+
+func (s *RefSpecSuite) TestDst(c *C) {
+	for _, t := range []struct {
+		spec     RefSpec
+		name     ReferenceName
+		expected ReferenceName
+	}{
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/master", "refs/remotes/origin/master"},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/feature/foo", "refs/remotes/origin/feature/foo"},
+		{"refs/heads/master:refs/remotes/origin/mine", "refs/heads/master", "refs/remotes/origin/mine"},
+		{"refs/heads/foo-*-bar:refs/remotes/origin/x-*", "refs/heads/foo-baz-bar", "refs/remotes/origin/x-baz"},
+		{"refs/heads/master:", "refs/heads/master", ""},
+		{"refs/heads/master", "refs/heads/master", ""},
+	} {
+		c.Assert(t.spec.Dst(t.name), Equals, t.expected, Commentf("spec=%q name=%q", t.spec, t.name))
+	}
+}
+
+func (s *RefSpecSuite) TestMatchAny(c *C) {
+	specs := []RefSpec{"refs/heads/master:refs/remotes/origin/master", "refs/tags/*:refs/tags/*"}
+	c.Assert(MatchAny(specs, "refs/heads/master"), Equals, true)
+	c.Assert(MatchAny(specs, "refs/tags/v1.0"), Equals, true)
+	c.Assert(MatchAny(specs, "refs/heads/foo"), Equals, false)
+	c.Assert(MatchAny(nil, "refs/heads/foo"), Equals, false)
+}
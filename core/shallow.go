@@ -0,0 +1,12 @@
+package core
+
+// ShallowStorage is the storage of the shallow commits of a repository, the
+// commits whose parents are missing because the history was fetched only up
+// to a depth. A repository without shallow commits has its whole history.
+type ShallowStorage interface {
+	// Shallow returns the hashes of the shallow commits, sorted, none if
+	// the history is complete.
+	Shallow() ([]Hash, error)
+	// SetShallow replaces the shallow commits with the given ones.
+	SetShallow([]Hash) error
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Signature is the identity of who did an action and when, in the format
+// of the commits and the reflog entries: "Name <email> timestamp timezone".
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// Decode decodes a byte slice into a signature, the fields missing or
+// malformed are left empty.
+func (s *Signature) Decode(b []byte) {
+	open := bytes.IndexByte(b, '<')
+	close := bytes.IndexByte(b, '>')
+	if open == -1 || close == -1 {
+		return
+	}
+
+	s.Name = string(bytes.Trim(b[:open], " "))
+	s.Email = string(b[open+1 : close])
+
+	hasTime := close+2 < len(b)
+	if hasTime {
+		s.decodeTimeAndTimeZone(b[close+2:])
+	}
+}
+
+var timeZoneLength = 5
+
+func (s *Signature) decodeTimeAndTimeZone(b []byte) {
+	space := bytes.IndexByte(b, ' ')
+	if space == -1 {
+		space = len(b)
+	}
+
+	ts, err := strconv.ParseInt(string(b[:space]), 10, 64)
+	if err != nil {
+		return
+	}
+
+	s.When = time.Unix(ts, 0).In(time.UTC)
+	var tzStart = space + 1
+	if tzStart >= len(b) || tzStart+timeZoneLength > len(b) {
+		return
+	}
+
+	tl, err := time.Parse("-0700", string(b[tzStart:tzStart+timeZoneLength]))
+	if err != nil {
+		return
+	}
+
+	s.When = s.When.In(tl.Location())
+}
+
+// Encode returns the signature in the format read by Decode.
+func (s *Signature) Encode() []byte {
+	return []byte(fmt.Sprintf("%s <%s> %d %s",
+		s.Name, s.Email, s.When.Unix(), s.When.Format("-0700")))
+}
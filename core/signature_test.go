@@ -0,0 +1,28 @@
+package core
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SignatureSuite struct{}
+
+var _ = Suite(&SignatureSuite{})
+
+func (s *SignatureSuite) TestEncode(c *C) {
+	sig := &Signature{
+		Name:  "John Doe",
+		Email: "john@doe.com",
+		When:  time.Unix(1465833006, 0).In(time.FixedZone("", -(3*3600 + 30*60))),
+	}
+
+	c.Assert(string(sig.Encode()), Equals, "John Doe <john@doe.com> 1465833006 -0330")
+
+	decoded := &Signature{}
+	decoded.Decode(sig.Encode())
+	c.Assert(decoded.Name, Equals, sig.Name)
+	c.Assert(decoded.Email, Equals, sig.Email)
+	c.Assert(decoded.When.Equal(sig.When), Equals, true)
+	c.Assert(decoded.When.Format("-0700"), Equals, "-0330")
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"io"
+)
+
+// ErrObjectCorrupted is returned when the hash computed from the content of
+// an object read is not the hash it was read by, see VerifyObject.
+type ErrObjectCorrupted struct {
+	Expected Hash
+	Actual   Hash
+}
+
+func (e *ErrObjectCorrupted) Error() string {
+	return fmt.Sprintf("object corrupted: expected hash %s, computed %s", e.Expected, e.Actual)
+}
+
+// VerifyObject computes the hash of obj from its type, size and content, as
+// git does, and returns a *ErrObjectCorrupted if it is not h.
+func VerifyObject(h Hash, obj Object) error {
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+
+	hasher := h.Format().NewHasher(obj.Type(), obj.Size())
+	_, err = io.Copy(hasher, r)
+	if errClose := r.Close(); err == nil {
+		err = errClose
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if actual := hasher.Sum(); actual != h {
+		return &ErrObjectCorrupted{Expected: h, Actual: actual}
+	}
+
+	return nil
+}
+
+// StrictObjectStorage is implemented by the ObjectStorages that can verify
+// the objects they read more cheaply than computing the hash of every one of
+// them, like the packfile based ones, which can verify the checksum of each
+// packfile once. It is optional, see NewVerifyingObjectStorage.
+type StrictObjectStorage interface {
+	ObjectStorage
+	// Strict returns an ObjectStorage with the same objects, that returns a
+	// *ErrObjectCorrupted, or another error, when an object read is
+	// corrupted.
+	Strict() ObjectStorage
+}
+
+// VerifyingObjectStorage is an ObjectStorage verifying every object read
+// from another one, see VerifyObject, so a corrupted storage is noticed when
+// it is read instead of when the objects read fail to be parsed. Reading
+// the whole content of every object to compute its hash is expensive, so it
+// is opt-in.
+type VerifyingObjectStorage struct {
+	s ObjectStorage
+}
+
+// NewVerifyingObjectStorage returns an ObjectStorage that verifies the
+// objects read from s, returning a *ErrObjectCorrupted when one of them is
+// corrupted. The storage returned is the Strict one of s, if it implements
+// StrictObjectStorage, or a *VerifyingObjectStorage otherwise.
+func NewVerifyingObjectStorage(s ObjectStorage) ObjectStorage {
+	if ss, ok := s.(StrictObjectStorage); ok {
+		return ss.Strict()
+	}
+
+	return &VerifyingObjectStorage{s: s}
+}
+
+// Set stores the object in the storage wrapped.
+func (s *VerifyingObjectStorage) Set(obj Object) (Hash, error) {
+	return s.s.Set(obj)
+}
+
+// Get returns the object with the given hash from the storage wrapped, once
+// verified.
+func (s *VerifyingObjectStorage) Get(h Hash) (Object, error) {
+	obj, err := s.s.Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyObject(h, obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// GetMany returns the objects with the given hashes from the storage
+// wrapped, see the GetMany function, once verified.
+func (s *VerifyingObjectStorage) GetMany(hs []Hash) ([]Object, error) {
+	objs, err := GetMany(s.s, hs)
+	if _, ok := err.(*GetManyError); err != nil && !ok {
+		return nil, err
+	}
+
+	for i, obj := range objs {
+		if obj == nil {
+			continue
+		}
+
+		if err := VerifyObject(hs[i], obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, err
+}
+
+// Has reports whether the storage wrapped has the object with the given
+// hash, see HasObject.
+func (s *VerifyingObjectStorage) Has(h Hash) (bool, error) {
+	return HasObject(s.s, h)
+}
+
+// ConcurrentSafe reports whether the storage wrapped is safe to use from
+// several goroutines at once.
+func (s *VerifyingObjectStorage) ConcurrentSafe() bool {
+	cs, ok := s.s.(ConcurrentSafeObjectStorage)
+	return ok && cs.ConcurrentSafe()
+}
+
+// Iter returns the iterator of the storage wrapped, verifying every object
+// it returns by its own hash.
+func (s *VerifyingObjectStorage) Iter(t ObjectType) (ObjectIter, error) {
+	iter, err := s.s.Iter(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyingObjectIter{iter}, nil
+}
+
+type verifyingObjectIter struct {
+	ObjectIter
+}
+
+func (iter *verifyingObjectIter) Next() (Object, error) {
+	obj, err := iter.ObjectIter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyObject(obj.Hash(), obj); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
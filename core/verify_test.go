@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+)
+
+type VerifySuite struct{}
+
+var _ = Suite(&VerifySuite{})
+
+// testContentObject is a blob with the given content, and hash
+type testContentObject struct {
+	Object
+	h       Hash
+	content []byte
+}
+
+func newTestContentObject(content string) *testContentObject {
+	return &testContentObject{h: ComputeHash(BlobObject, []byte(content)), content: []byte(content)}
+}
+
+func (o *testContentObject) Hash() Hash       { return o.h }
+func (o *testContentObject) Type() ObjectType { return BlobObject }
+func (o *testContentObject) Size() int64      { return int64(len(o.content)) }
+func (o *testContentObject) Reader() (ObjectReader, error) {
+	return ioutil.NopCloser(bytes.NewReader(o.content)), nil
+}
+
+func (s *VerifySuite) TestVerifyObject(c *C) {
+	obj := newTestContentObject("hello\n")
+	c.Assert(obj.h, Equals, NewHash("ce013625030ba8dba906f756967f9e9ca394464a"))
+	c.Assert(VerifyObject(obj.h, obj), IsNil)
+
+	obj.content[0] = 'j'
+	err := VerifyObject(obj.h, obj)
+	c.Assert(err, DeepEquals, &ErrObjectCorrupted{
+		Expected: obj.h,
+		Actual:   ComputeHash(BlobObject, []byte("jello\n")),
+	})
+	c.Assert(err, ErrorMatches, "object corrupted: expected hash ce0136.*, computed .*")
+}
+
+func (s *VerifySuite) TestGet(c *C) {
+	storage, _ := newTestMapStorage()
+	good, bad := newTestContentObject("good\n"), newTestContentObject("bad\n")
+	bad.content = []byte("bac\n")
+	storage.Set(good)
+	storage.Set(bad)
+
+	v := NewVerifyingObjectStorage(storage)
+	obj, err := v.Get(good.h)
+	c.Assert(err, IsNil)
+	c.Assert(obj, Equals, good)
+
+	_, err = v.Get(bad.h)
+	c.Assert(err, FitsTypeOf, &ErrObjectCorrupted{})
+
+	_, err = v.Get(NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *VerifySuite) TestGetMany(c *C) {
+	storage, _ := newTestMapStorage()
+	good, bad := newTestContentObject("good\n"), newTestContentObject("bad\n")
+	bad.content = []byte("bac\n")
+	storage.Set(good)
+	storage.Set(bad)
+
+	missing := NewHash("ffffffffffffffffffffffffffffffffffffffff")
+	objs, err := GetMany(NewVerifyingObjectStorage(storage), []Hash{good.h, missing})
+	c.Assert(err, DeepEquals, &GetManyError{Errors: map[int]error{1: ErrObjectNotFound}})
+	c.Assert(objs, DeepEquals, []Object{good, nil})
+
+	_, err = GetMany(NewVerifyingObjectStorage(storage), []Hash{good.h, bad.h})
+	c.Assert(err, FitsTypeOf, &ErrObjectCorrupted{})
+}
+
+type testStrictStorage struct {
+	testStorage
+}
+
+func (s *testStrictStorage) Strict() ObjectStorage {
+	return &testStorage{}
+}
+
+func (s *VerifySuite) TestStrictObjectStorage(c *C) {
+	v := NewVerifyingObjectStorage(&testStrictStorage{})
+	c.Assert(v, DeepEquals, &testStorage{})
+}
+
+func (s *VerifySuite) TestIter(c *C) {
+	bad := newTestContentObject("bad\n")
+	bad.content = []byte("bac\n")
+	storage := &testSliceStorage{objects: []Object{newTestContentObject("good\n"), bad}}
+
+	iter, err := NewVerifyingObjectStorage(storage).Iter(BlobObject)
+	c.Assert(err, IsNil)
+	_, err = iter.Next()
+	c.Assert(err, IsNil)
+	_, err = iter.Next()
+	c.Assert(err, FitsTypeOf, &ErrObjectCorrupted{})
+	iter.Close()
+}
+
+type testSliceStorage struct {
+	testStorage
+	objects []Object
+}
+
+func (s *testSliceStorage) Iter(ObjectType) (ObjectIter, error) {
+	return NewObjectSliceIter(s.objects), nil
+}
@@ -18,7 +18,7 @@ func c_Commit_get_Hash(c uint64) *C.char {
 		return nil
 	}
 	commit := obj.(*git.Commit)
-	return CBytes(commit.Hash[:])
+	return CBytes(commit.Hash.Bytes())
 }
 
 //export c_Commit_get_Author
@@ -62,7 +62,10 @@ func c_Commit_Tree(c uint64) uint64 {
 		return IH
 	}
 	commit := obj.(*git.Commit)
-	tree := commit.Tree()
+	tree, err := commit.Tree()
+	if err != nil {
+		return IH
+	}
 	tree_handle := RegisterObject(tree)
 	return uint64(tree_handle)
 }
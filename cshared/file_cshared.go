@@ -36,7 +36,7 @@ func c_File_get_Hash(b uint64) *C.char {
 		return nil
 	}
 	file := obj.(*git.File)
-	return CBytes(file.Hash[:])
+	return CBytes(file.Hash.Bytes())
 }
 
 //export c_File_Size
@@ -7,6 +7,8 @@ import (
 	"math"
 	"sync"
 	"reflect"
+
+	"gopkg.in/src-d/go-git.v3/core"
 )
 
 type Handle uint64
@@ -18,6 +20,7 @@ const (
 )
 
 const MessageNotFound string = "object not found"
+const MessageInvalidHash string = "invalid hash"
 const InvalidHandle Handle = 0
 const IH uint64 = uint64(InvalidHandle)
 var counter Handle = InvalidHandle
@@ -147,6 +150,17 @@ func CBytes(bytes []byte) *C.char {
 	return (*C.char)(ptr)
 }
 
+// HashFromBytes returns the core.Hash with the given bytes, a SHA1 hash if
+// they are 20 and a SHA256 one if they are 32, false for any other length.
+func HashFromBytes(bytes []byte) (core.Hash, bool) {
+	for _, f := range []core.ObjectFormat{core.SHA1, core.SHA256} {
+		if len(bytes) == f.Size() {
+			return core.NewHashFromBytes(f, bytes), true
+		}
+	}
+	return core.ZeroHash, false
+}
+
 func SafeIsNil(v reflect.Value) bool {
   defer func() { recover() }()
   return v.IsNil()
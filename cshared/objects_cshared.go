@@ -54,7 +54,7 @@ func c_Blob_get_Hash(b uint64) *C.char {
 		return nil
 	}
 	blob := obj.(*git.Blob)
-	return CBytes(blob.Hash[:])
+	return CBytes(blob.Hash.Bytes())
 }
 
 //export c_Blob_Size
@@ -125,8 +125,10 @@ func c_Repository_Commit(r uint64, h []byte) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	var hash core.Hash
-	copy(hash[:], h)
+	hash, ok := HashFromBytes(h)
+	if !ok {
+		return IH, ErrorCodeInternal, C.CString(MessageInvalidHash)
+	}
 	commit, err := repo.Commit(hash)
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
@@ -157,8 +159,10 @@ func c_Repository_Tree(r uint64, h []byte) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	var hash core.Hash
-	copy(hash[:], h)
+	hash, ok := HashFromBytes(h)
+	if !ok {
+		return IH, ErrorCodeInternal, C.CString(MessageInvalidHash)
+	}
 	tree, err := repo.Tree(hash)
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
@@ -174,8 +178,10 @@ func c_Repository_Blob(r uint64, h []byte) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	var hash core.Hash
-	copy(hash[:], h)
+	hash, ok := HashFromBytes(h)
+	if !ok {
+		return IH, ErrorCodeInternal, C.CString(MessageInvalidHash)
+	}
 	blob, err := repo.Blob(hash)
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
@@ -191,9 +197,11 @@ func c_Repository_Tag(r uint64, h []byte) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	var hash core.Hash
-	copy(hash[:], h)
-	tag, err := repo.Tag(hash)
+	hash, ok := HashFromBytes(h)
+	if !ok {
+		return IH, ErrorCodeInternal, C.CString(MessageInvalidHash)
+	}
+	tag, err := repo.TagObject(hash)
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
 	}
@@ -208,7 +216,7 @@ func c_Repository_Tags(r uint64) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	iter, err := repo.Tags()
+	iter, err := repo.TagObjects()
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
 	}
@@ -223,8 +231,10 @@ func c_Repository_Object(r uint64, h []byte) (uint64, int, *C.char) {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
 	repo := obj.(*git.Repository)
-	var hash core.Hash
-	copy(hash[:], h)
+	hash, ok := HashFromBytes(h)
+	if !ok {
+		return IH, ErrorCodeInternal, C.CString(MessageInvalidHash)
+	}
 	robj, err := repo.Object(hash)
 	if err != nil {
 		return IH, ErrorCodeInternal, C.CString(err.Error())
@@ -5,6 +5,8 @@ import (
 	"C"
 	"reflect"
 	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
 )
 
 //export c_std_map_get_str_str
@@ -24,6 +26,9 @@ func c_std_map_get_str_str(m uint64, key string) *C.char {
 	if !val.IsValid() || SafeIsNil(val) {
 		return nil
 	}
+	if hash, ok := val.Interface().(core.Hash); ok {
+		return CBytes(hash.Bytes())
+	}
 	if (val.Kind() == reflect.Slice || val.Kind() == reflect.Array) &&
 	    val.Type().Elem().Kind() == reflect.Uint8 {
 		arr := make([]byte, val.Len(), val.Len())
@@ -15,7 +15,7 @@ func c_Tag_get_Hash(t uint64) *C.char {
 		return nil
 	}
 	tag := obj.(*git.Tag)
-	return CBytes(tag.Hash[:])
+	return CBytes(tag.Hash.Bytes())
 }
 
 func c_Tag_get_Name(t uint64) *C.char {
@@ -166,7 +166,7 @@ func c_NewTagIter(r uint64, i uint64) uint64 {
 		return IH
 	}
 	iter := obj.(*core.ObjectIter)
-	return uint64(RegisterObject(git.NewTagIter(repo, *iter)))
+	return uint64(RegisterObject(git.NewTagObjectIter(repo, *iter)))
 }
 
 //export c_TagIter_Next
@@ -175,7 +175,7 @@ func c_TagIter_Next(i uint64) (uint64, int, *C.char) {
 	if !ok {
 		return IH, ErrorCodeNotFound, C.CString(MessageNotFound)
 	}
-	tagiter := obj.(*git.TagIter)
+	tagiter := obj.(*git.TagObjectIter)
 	tag, err := tagiter.Next()
 	if err != nil {
 		if err == io.EOF {
@@ -26,7 +26,7 @@ func c_Tree_get_Entries_item(t uint64, index int) (*C.char, uint32, *C.char) {
 	}
 	tree := obj.(*git.Tree)
 	item := tree.Entries[index]
-	return C.CString(item.Name), uint32(item.Mode), CBytes(item.Hash[:])
+	return C.CString(item.Name), uint32(item.Mode), CBytes(item.Hash.Bytes())
 }
 
 //export c_Tree_get_Hash
@@ -36,7 +36,7 @@ func c_Tree_get_Hash(t uint64) *C.char {
 		return nil
 	}
 	tree := obj.(*git.Tree)
-	return CBytes(tree.Hash[:])
+	return CBytes(tree.Hash.Bytes())
 }
 
 //export c_Tree_File
@@ -118,7 +118,7 @@ func c_TreeWalker_Next(tw uint64) (*C.char, *C.char, uint32, *C.char,
 		return nil, nil, 0, nil, IH, ErrorCodeInternal, C.CString(err.Error())
 	}
 	return C.CString(name), C.CString(entry.Name), uint32(entry.Mode),
-	       CBytes(entry.Hash[:]), uint64(RegisterObject(&object)),
+	       CBytes(entry.Hash.Bytes()), uint64(RegisterObject(&object)),
 	       ErrorCodeSuccess, nil
 }
 
@@ -0,0 +1,354 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// DefaultAbbrev is the default number of hexadecimal digits of the
+// abbreviated hashes, as in git.
+const DefaultAbbrev = 7
+
+// maxDescribeCandidates is the number of tags Describe considers before
+// giving up finding closer ones, as in git.
+const maxDescribeCandidates = 10
+
+// DescribeOptions are the options of Describe.
+type DescribeOptions struct {
+	// Tags describes the commits with any tag, lightweight or annotated;
+	// only the annotated ones are used otherwise.
+	Tags bool
+	// Abbrev is the minimum number of hexadecimal digits of the abbreviated
+	// hash, DefaultAbbrev if zero. More digits are used if needed for it to
+	// be unique.
+	Abbrev int
+	// Match is a pattern, with the syntax of path.Match, the names of the
+	// tags used must match, any tag is used if it is empty.
+	Match string
+	// Dirty is appended to the description, like "-dirty". Describe does
+	// not look at any working tree, it is up to the caller to tell whether
+	// the one of the commit has changes.
+	Dirty string
+	// Always describes the commits no tag can describe with their
+	// abbreviated hash, instead of returning a *NoTagError.
+	Always bool
+}
+
+func (o *DescribeOptions) abbrev() int {
+	if o.Abbrev == 0 {
+		return DefaultAbbrev
+	}
+
+	return o.Abbrev
+}
+
+// NoTagError is returned by Describe when no tag can describe the commit.
+// Unannotated is true if only lightweight tags can, see DescribeOptions.Tags.
+type NoTagError struct {
+	Commit      core.Hash
+	Unannotated bool
+}
+
+func (e *NoTagError) Error() string {
+	if e.Unannotated {
+		return fmt.Sprintf("no annotated tags can describe %s, only lightweight tags", e.Commit)
+	}
+
+	return fmt.Sprintf("no tags can describe %s", e.Commit)
+}
+
+// Describe returns a name for the commit based on the closest tag reachable
+// from it, as git describe does: the name of the tag, if the commit is
+// tagged; or the name of the tag, the number of commits of the history of
+// the commit not in the history of the tag and the abbreviated hash of the
+// commit, like v1.2.3-14-gabc1234. Nil options describe the commit with the
+// annotated tags.
+//
+// When several tags tag the same commit, the annotated ones are preferred to
+// the lightweight ones, and the newest by tagger date among them. The history
+// is walked newest first by committer date, and the tags found are compared
+// by their number of commits, so the tag chosen is the same as git's, even
+// if it is not the one with the shortest path to the commit.
+//
+// A *NoTagError is returned if no tag can describe the commit, unless the
+// options describe it with its abbreviated hash, and path.ErrBadPattern if
+// the Match pattern is malformed.
+func (r *Repository) Describe(c *Commit, opts *DescribeOptions) (string, error) {
+	if opts == nil {
+		opts = &DescribeOptions{}
+	}
+
+	names, err := r.describeNames(opts.Match)
+	if err != nil {
+		return "", err
+	}
+
+	if n, ok := names[c.Hash]; ok && (opts.Tags || n.annotated) {
+		return n.name + opts.Dirty, nil
+	}
+
+	d := &describer{
+		r:       r,
+		names:   names,
+		tags:    opts.Tags,
+		flags:   map[core.Hash]uint{c.Hash: describeSeen},
+		pending: []*Commit{c},
+	}
+
+	best, err := d.describe()
+	if err != nil {
+		return "", err
+	}
+
+	abbrev, err := r.abbreviate(c.Hash, opts.abbrev())
+	if err != nil {
+		return "", err
+	}
+
+	if best == nil {
+		if opts.Always {
+			return abbrev + opts.Dirty, nil
+		}
+
+		return "", &NoTagError{Commit: c.Hash, Unannotated: d.unannotated}
+	}
+
+	return fmt.Sprintf("%s-%d-g%s%s", best.name.name, best.depth, abbrev, opts.Dirty), nil
+}
+
+// describeName is the tag used to describe a commit, among the ones tagging
+// it.
+type describeName struct {
+	name      string
+	annotated bool
+	date      time.Time // the tagger date of the annotated tags
+}
+
+// describeNames returns the tags of the commits, the ones whose name matches
+// the pattern, if any. The tags of other types of objects are ignored.
+func (r *Repository) describeNames(pattern string) (map[core.Hash]*describeName, error) {
+	iter, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[core.Hash]*describeName)
+	return names, iter.ForEach(func(t *TagReference) error {
+		if t.Commit == nil {
+			return nil
+		}
+
+		n := &describeName{name: strings.TrimPrefix(t.Name.String(), "refs/tags/")}
+		if pattern != "" {
+			ok, err := path.Match(pattern, n.name)
+			if err != nil || !ok {
+				return err
+			}
+		}
+
+		if t.Tag != nil {
+			n.annotated = true
+			n.date = t.Tag.Tagger.When
+		}
+
+		if old, ok := names[t.Commit.Hash]; !ok || n.replaces(old) {
+			names[t.Commit.Hash] = n
+		}
+
+		return nil
+	})
+}
+
+// replaces reports whether the tag is preferred to the old one, tagging the
+// same commit.
+func (n *describeName) replaces(old *describeName) bool {
+	if n.annotated != old.annotated {
+		return n.annotated
+	}
+
+	return n.annotated && n.date.After(old.date)
+}
+
+// describeSeen is the flag of the commits found by describer, the rest of
+// the flags are the ones of the candidates.
+const describeSeen = 1
+
+// describeCandidate is a tag found by describer, flag is the flag of the
+// commits reachable from it, and depth the number of commits found not
+// reachable from it.
+type describeCandidate struct {
+	name  *describeName
+	depth int
+	flag  uint
+}
+
+// describer walks the history of a commit looking for the candidates to
+// describe it, the same way git describe does.
+type describer struct {
+	r     *Repository
+	names map[core.Hash]*describeName
+	tags  bool
+
+	flags       map[core.Hash]uint
+	pending     []*Commit // sorted by committer date, newest first
+	candidates  describeCandidates
+	unannotated bool
+}
+
+// describe returns the best candidate to describe the commit, with the
+// fewest commits not reachable from it, or nil if there is none.
+func (d *describer) describe() (*describeCandidate, error) {
+	var walked, annotated int
+	var gaveUpOn *Commit
+	for len(d.pending) != 0 {
+		c := d.pop()
+		walked++
+		if n, ok := d.names[c.Hash]; ok {
+			if !d.tags && !n.annotated {
+				d.unannotated = true
+			} else if len(d.candidates) < maxDescribeCandidates {
+				t := &describeCandidate{
+					name:  n,
+					depth: walked - 1,
+					flag:  1 << uint(len(d.candidates)+1),
+				}
+
+				d.candidates = append(d.candidates, t)
+				d.flags[c.Hash] |= t.flag
+				if n.annotated {
+					annotated++
+				}
+			} else {
+				gaveUpOn = c
+				break
+			}
+		}
+
+		for _, t := range d.candidates {
+			if d.flags[c.Hash]&t.flag == 0 {
+				t.depth++
+			}
+		}
+
+		// the last commit left is reachable from the best candidates
+		if annotated != 0 && len(d.pending) == 0 {
+			if within := d.candidates.best(); d.flags[c.Hash]&within == within {
+				break
+			}
+		}
+
+		if err := d.push(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(d.candidates) == 0 {
+		return nil, nil
+	}
+
+	sort.Stable(d.candidates)
+	if gaveUpOn != nil {
+		d.insert(gaveUpOn)
+	}
+
+	best := d.candidates[0]
+	return best, d.finishDepth(best)
+}
+
+// finishDepth walks the history left, counting the commits not reachable
+// from the best candidate, until every commit left is reachable from it.
+func (d *describer) finishDepth(best *describeCandidate) error {
+	for len(d.pending) != 0 {
+		c := d.pop()
+		if d.flags[c.Hash]&best.flag != 0 {
+			if d.allReachable(best.flag) {
+				return nil
+			}
+		} else {
+			best.depth++
+		}
+
+		if err := d.push(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *describer) allReachable(flag uint) bool {
+	for _, c := range d.pending {
+		if d.flags[c.Hash]&flag == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// push adds the parents of the commit not found yet to the pending ones, and
+// paints all of them with the flags of the commit.
+func (d *describer) push(c *Commit) error {
+	parents, err := d.r.parentCommits(c, false)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range parents {
+		if d.flags[p.Hash]&describeSeen == 0 {
+			d.insert(p)
+		}
+
+		d.flags[p.Hash] |= d.flags[c.Hash]
+	}
+
+	return nil
+}
+
+func (d *describer) pop() *Commit {
+	c := d.pending[0]
+	d.pending = d.pending[1:]
+	return c
+}
+
+// insert adds the commit to the pending ones after the ones with the same
+// committer date, as git does, since the order of the commits with the same
+// date changes the counts.
+func (d *describer) insert(c *Commit) {
+	i := sort.Search(len(d.pending), func(i int) bool {
+		return d.pending[i].Committer.When.Before(c.Committer.When)
+	})
+
+	d.pending = append(d.pending, nil)
+	copy(d.pending[i+1:], d.pending[i:])
+	d.pending[i] = c
+}
+
+// describeCandidates implements sort.Interface, sorting the candidates by
+// depth.
+type describeCandidates []*describeCandidate
+
+func (s describeCandidates) Len() int           { return len(s) }
+func (s describeCandidates) Less(i, j int) bool { return s[i].depth < s[j].depth }
+func (s describeCandidates) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// best returns the flags of the candidates with the lowest depth.
+func (s describeCandidates) best() uint {
+	var within uint
+	depth := -1
+	for _, t := range s {
+		switch {
+		case depth == -1 || t.depth < depth:
+			depth, within = t.depth, t.flag
+		case t.depth == depth:
+			within |= t.flag
+		}
+	}
+
+	return within
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// describeFixture is a repository written by git with annotated and
+// lightweight tags: master merges the branch feature, and the branch many
+// has a dozen tagged commits on top of it. The branches orphan and
+// orphan-light do not share any history with them, orphan-light has a
+// lightweight tag.
+const describeFixture = "fixtures/describe.tgz"
+
+// the commits of describeFixture
+const (
+	describeMaster      = "89c57ddbe335c60570cfdbc710bf13da778db062"
+	describeMerge       = "5d7fe793727b7870734ea46f892b8b804c3818c3" // master~1
+	describeC5          = "7293471d6c522d399a92342354d295e8647c5df9" // master~2
+	describeC4          = "2b2a5ca1ef822510f52fc7294b9d6706aeeeb1f8" // v0.2, v0.2-rc
+	describeC3          = "30bdbd3865ece01af8a9cab47b67269a409b56a2" // light-1
+	describeC2          = "a47af818d008af8960d953bef8a88e9bbcc23266"
+	describeFeature     = "d11c261b387dd49987d3d15807c778bd8dd587eb"
+	describeMany        = "d2067adc7cb3bce166b8cf1c9b257ecb39f6c50b"
+	describeMany10      = "53e437b17a314dbc21d5e2010b6d9f6db303f6da"
+	describeOrphan      = "955074cdc565675287ff1db909e60fb759cb8c7c"
+	describeOrphanLight = "d68af0b0381450a7a5cc67fbca6dab7b558ffb7f"
+)
+
+type SuiteDescribe struct {
+	dir string
+	r   *Repository
+}
+
+var _ = Suite(&SuiteDescribe{})
+
+func (s *SuiteDescribe) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(describeFixture)
+	c.Assert(err, IsNil)
+
+	s.r, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDescribe) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+// the expected descriptions have been obtained with git describe
+func (s *SuiteDescribe) TestDescribe(c *C) {
+	for _, t := range []struct {
+		commit   string
+		opts     *DescribeOptions
+		expected string
+	}{
+		{describeMaster, nil, "v0.2-5-g89c57dd"},
+		{describeMerge, nil, "v0.2-4-g5d7fe79"},
+		{describeC5, nil, "v0.2-1-g7293471"},
+		{describeFeature, nil, "feature-1-1-gd11c261"},
+		{describeMany, nil, "many-12-1-gd2067ad"},
+		{describeMany10, nil, "many-10"},
+		{describeC4, nil, "v0.2"},
+		{describeC3, nil, "v0.1-2-g30bdbd3"},
+		{describeC2, nil, "v0.1-1-ga47af81"},
+		{describeMaster, &DescribeOptions{Tags: true}, "v0.2-5-g89c57dd"},
+		{describeC4, &DescribeOptions{Tags: true}, "v0.2"},
+		{describeC3, &DescribeOptions{Tags: true}, "light-1"},
+		{describeOrphanLight, &DescribeOptions{Tags: true}, "light-orphan-1-gd68af0b"},
+		{describeMaster, &DescribeOptions{Match: "v*"}, "v0.2-5-g89c57dd"},
+		{describeMaster, &DescribeOptions{Match: "v0.1"}, "v0.1-8-g89c57dd"},
+		{describeMaster, &DescribeOptions{Match: "feature*"}, "feature-1-6-g89c57dd"},
+		{describeMaster, &DescribeOptions{Tags: true, Match: "light*"}, "light-1-6-g89c57dd"},
+		{describeMany, &DescribeOptions{Match: "many-0[1-5]"}, "many-05-8-gd2067ad"},
+		{describeMaster, &DescribeOptions{Abbrev: 10}, "v0.2-5-g89c57ddbe3"},
+		{describeMaster, &DescribeOptions{Abbrev: 4}, "v0.2-5-g89c5"},
+		{describeMaster, &DescribeOptions{Always: true}, "v0.2-5-g89c57dd"},
+		{describeOrphan, &DescribeOptions{Always: true}, "955074c"},
+		{describeOrphan, &DescribeOptions{Always: true, Abbrev: 10}, "955074cdc5"},
+		{describeMaster, &DescribeOptions{Dirty: "-dirty"}, "v0.2-5-g89c57dd-dirty"},
+		{describeC4, &DescribeOptions{Dirty: "-dirty"}, "v0.2-dirty"},
+		{describeOrphan, &DescribeOptions{Always: true, Dirty: "-dirty"}, "955074c-dirty"},
+	} {
+		commit, err := s.r.Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil)
+
+		obtained, err := s.r.Describe(commit, t.opts)
+		c.Assert(err, IsNil, Commentf("commit=%s opts=%+v", t.commit, t.opts))
+		c.Assert(obtained, Equals, t.expected, Commentf("commit=%s opts=%+v", t.commit, t.opts))
+	}
+}
+
+func (s *SuiteDescribe) TestDescribeNoTag(c *C) {
+	for _, t := range []struct {
+		commit   string
+		opts     *DescribeOptions
+		expected *NoTagError
+	}{
+		{describeOrphan, nil, &NoTagError{Commit: core.NewHash(describeOrphan)}},
+		{describeOrphan, &DescribeOptions{Tags: true}, &NoTagError{Commit: core.NewHash(describeOrphan)}},
+		{describeOrphanLight, nil, &NoTagError{Commit: core.NewHash(describeOrphanLight), Unannotated: true}},
+		{describeMaster, &DescribeOptions{Match: "x*"}, &NoTagError{Commit: core.NewHash(describeMaster)}},
+	} {
+		commit, err := s.r.Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil)
+
+		_, err = s.r.Describe(commit, t.opts)
+		c.Assert(err, DeepEquals, t.expected, Commentf("commit=%s opts=%+v", t.commit, t.opts))
+	}
+
+	c.Assert((&NoTagError{Commit: core.NewHash(describeOrphan)}).Error(), Equals,
+		"no tags can describe "+describeOrphan)
+	c.Assert((&NoTagError{Commit: core.NewHash(describeOrphanLight), Unannotated: true}).Error(), Equals,
+		"no annotated tags can describe "+describeOrphanLight+", only lightweight tags")
+}
+
+func (s *SuiteDescribe) TestDescribeBadPattern(c *C) {
+	commit, err := s.r.Commit(core.NewHash(describeMaster))
+	c.Assert(err, IsNil)
+
+	_, err = s.r.Describe(commit, &DescribeOptions{Match: "v["})
+	c.Assert(err, Equals, path.ErrBadPattern)
+}
@@ -0,0 +1,756 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+var (
+	// NoErrAlreadyUpToDate is returned by Fetch when there is nothing to
+	// fetch, all the references are up to date.
+	NoErrAlreadyUpToDate = errors.New("already up-to-date")
+	// ErrShallowNotSupported is returned by Fetch when a depth is given, or
+	// the repository is shallow, and the remote does not support shallow
+	// histories.
+	ErrShallowNotSupported = errors.New("remote does not support shallow fetches")
+	// ErrNonFastForwardUpdate is returned by Fetch when some references were
+	// not updated, as the update was not a fast-forward and the refspec did
+	// not force it.
+	ErrNonFastForwardUpdate = errors.New("non-fast-forward update")
+)
+
+// FetchOptions are the options of Fetch.
+type FetchOptions struct {
+	// RemoteName is the name of the remote, DefaultRemoteName if empty, see
+	// Repository.Remote.
+	RemoteName string
+	// RefSpecs are the references fetched and where they are stored, they
+	// are the fetch refspecs of the config of the remote if empty, or
+	// "+refs/heads/*:refs/remotes/<remote>/*" if it has none.
+	RefSpecs []core.RefSpec
+	// Depth limits the history fetched to the given number of commits, see
+	// PullOptions.
+	Depth int
+	// Committer is the signature of the entries appended to the reflogs of
+	// the references updated, at the current time if its When is zero.
+	Committer Signature
+	// Progress, if not nil, receives the progress messages of the remote
+	// and the progress of the indexing of the objects fetched, see
+	// PullOptions.
+	Progress io.Writer
+}
+
+// ReferenceUpdateStatus is the result of the update of a reference by Fetch.
+type ReferenceUpdateStatus int
+
+const (
+	// ReferenceUpToDate is the status of a reference already pointing to
+	// the object fetched.
+	ReferenceUpToDate ReferenceUpdateStatus = iota
+	// ReferenceNew is the status of a reference that did not exist.
+	ReferenceNew
+	// ReferenceFastForward is the status of a reference updated to a
+	// descendant of its commit.
+	ReferenceFastForward
+	// ReferenceForced is the status of a reference updated by a forced
+	// refspec, the update not being a fast-forward.
+	ReferenceForced
+	// ReferenceRejected is the status of a reference not updated, the
+	// update not being a fast-forward and the refspec not forcing it.
+	ReferenceRejected
+)
+
+func (s ReferenceUpdateStatus) String() string {
+	switch s {
+	case ReferenceUpToDate:
+		return "up to date"
+	case ReferenceNew:
+		return "new"
+	case ReferenceFastForward:
+		return "fast-forward"
+	case ReferenceForced:
+		return "forced update"
+	case ReferenceRejected:
+		return "rejected"
+	default:
+		return "unknown"
+	}
+}
+
+// ReferenceUpdate is the update of a local reference to the object of a
+// remote reference, through a refspec.
+type ReferenceUpdate struct {
+	// Name is the name of the local reference.
+	Name core.ReferenceName
+	// Src is the name of the remote reference.
+	Src core.ReferenceName
+	// Old is the hash of the local reference before the update, zero if it
+	// did not exist.
+	Old core.Hash
+	// New is the hash of the remote reference.
+	New    core.Hash
+	Status ReferenceUpdateStatus
+}
+
+func (u *ReferenceUpdate) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", u.Src, u.Name, u.Status)
+}
+
+// Fetch updates the repository from a remote: the tips of the local
+// references are sent as haves, so only the objects missing are fetched, and
+// the remote references matched by the refspecs are stored at their
+// destinations. NoErrAlreadyUpToDate is returned if nothing was fetched nor
+// updated, see FetchUpdates.
+func (r *Repository) Fetch(o *FetchOptions) error {
+	return r.FetchContext(context.Background(), o)
+}
+
+// FetchContext is like Fetch, canceling the requests to the remote when ctx
+// is done, see FetchUpdatesContext.
+func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
+	_, err := r.FetchUpdatesContext(ctx, o)
+	return err
+}
+
+// FetchUpdates is like Fetch, returning the updates of the references. The
+// updates that are not fast-forwards are only done if the refspec forces
+// them, otherwise ErrNonFastForwardUpdate is returned along with the
+// updates, once the other references have been updated.
+//
+// The shallow commits of the repository are always sent to the remote, and
+// the ones of the response are stored if a depth is given.
+// ErrShallowNotSupported is returned if the remote does not support a depth
+// and one is given, or the repository is shallow. A
+// *core.ErrObjectFormatMismatch is returned if the objects of the remote
+// are of another format than the ones of the repository, see ObjectFormat,
+// and a *ErrMissingPrerequisites if the remote is a bundle whose
+// prerequisites are not in the repository, see NewBundleRemote.
+func (r *Repository) FetchUpdates(o *FetchOptions) ([]*ReferenceUpdate, error) {
+	return r.FetchUpdatesContext(context.Background(), o)
+}
+
+// FetchUpdatesContext is like FetchUpdates, canceling the requests to the
+// remote when ctx is done, the error of ctx is returned then. The objects
+// fetched are only stored once the whole packfile has been read, and the
+// references are only updated after them, so a fetch canceled leaves the
+// repository as it was.
+func (r *Repository) FetchUpdatesContext(ctx context.Context, o *FetchOptions) ([]*ReferenceUpdate, error) {
+	remoteName := o.RemoteName
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+	}
+
+	remote, err := r.Remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := remote.ConnectContext(ctx); err != nil {
+		return nil, err
+	}
+
+	specs := o.RefSpecs
+	if len(specs) == 0 {
+		specs = remote.fetchRefSpecs(remoteName)
+	}
+
+	return r.fetch(ctx, remote, specs, o.Depth, o.Progress, reflogUpdate{
+		committer: o.Committer,
+		action:    "fetch " + remoteName,
+	})
+}
+
+// reflogUpdate is the committer and the action, "fetch origin" or "pull
+// origin", of the reflog entries of the references updated by a fetch.
+type reflogUpdate struct {
+	committer Signature
+	action    string
+}
+
+// defaultRefSpec returns the refspec of the branches of a remote, the one git
+// clone writes.
+func defaultRefSpec(remoteName string) core.RefSpec {
+	return core.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remoteName))
+}
+
+// fetch fetches the references of the connected remote matched by the
+// refspecs, writing the progress to the given writer if not nil, see
+// FetchUpdatesContext.
+func (r *Repository) fetch(ctx context.Context, remote *Remote, specs []core.RefSpec, depth int, progress io.Writer, reflog reflogUpdate) ([]*ReferenceUpdate, error) {
+	refs, err := remoteRefs(remote, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkPrerequisites(remote); err != nil {
+		return nil, err
+	}
+
+	req := &common.GitUploadPackRequest{Depth: depth}
+	if err := r.addObjectFormat(&req.Capabilities, remote.Capabilities()); err != nil {
+		return nil, err
+	}
+
+	addFetchCapabilities(req, remote.Capabilities())
+	if progress != nil {
+		p := common.NewProgressWriter(progress)
+		defer p.Close()
+		req.Progress = p
+	}
+
+	if err := r.addWants(req, refs, depth > 0); err != nil {
+		return nil, err
+	}
+
+	// the shallow commits are always sent, otherwise the remote assumes the
+	// history behind them is in the repository
+	shallows, err := r.shallows()
+	if err != nil {
+		return nil, err
+	}
+
+	if depth > 0 || len(shallows) != 0 {
+		if !remote.Capabilities().Supports("shallow") {
+			return nil, ErrShallowNotSupported
+		}
+
+		req.Shallow(shallows...)
+	}
+
+	if len(req.Wants) != 0 {
+		if err := r.addHaves(req); err != nil {
+			return nil, err
+		}
+
+		if err := r.fetchPack(ctx, remote, req, depth > 0 || len(shallows) != 0, shallows); err != nil {
+			return nil, err
+		}
+	}
+
+	if reflog.committer.When.IsZero() {
+		reflog.committer.When = time.Now()
+	}
+
+	updates, err := r.updateReferences(specs, refs, reflog)
+	if err != nil {
+		return updates, err
+	}
+
+	if len(req.Wants) == 0 && upToDate(updates) {
+		return updates, NoErrAlreadyUpToDate
+	}
+
+	return updates, nil
+}
+
+// addFetchCapabilities requests the capabilities of the packfile supported
+// by the remote: thin-pack, so the deltas of the objects fetched can have
+// the objects of the repository as bases, and ofs-delta.
+func addFetchCapabilities(req *common.GitUploadPackRequest, c *common.Capabilities) {
+	for _, name := range []string{"thin-pack", "ofs-delta"} {
+		if c.Supports(name) {
+			req.Capabilities = append(req.Capabilities, name)
+		}
+	}
+}
+
+// addObjectFormat checks that the format of the objects of the remote, the
+// one of its object-format capability, is the one of the repository,
+// returning a *core.ErrObjectFormatMismatch otherwise, and requests it
+// along with the given capabilities if it is not core.SHA1, as git does.
+func (r *Repository) addObjectFormat(capabilities *[]string, c *common.Capabilities) error {
+	f, err := c.ObjectFormat()
+	if err != nil {
+		return err
+	}
+
+	if expected := r.ObjectFormat(); f != expected {
+		return &core.ErrObjectFormatMismatch{Expected: expected, Actual: f}
+	}
+
+	if f != core.SHA1 {
+		*capabilities = append(*capabilities, "object-format="+f.String())
+	}
+
+	return nil
+}
+
+// remoteRefs returns the references of the remote matched by the refspecs,
+// sorted by name. An error is returned if the source of a refspec without
+// wildcards is not found.
+func remoteRefs(remote *Remote, specs []core.RefSpec) ([]*core.Reference, error) {
+	for _, s := range specs {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+
+		if !s.IsWildcard() {
+			if _, err := remote.Ref(s.Src()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var refs []*core.Reference
+	for name, h := range remote.Refs() {
+		n := core.ReferenceName(name)
+		if strings.HasSuffix(name, "^{}") || !core.MatchAny(specs, n) {
+			continue
+		}
+
+		refs = append(refs, core.NewHashReference(n, h))
+	}
+
+	sort.Sort(referencesByName(refs))
+	return refs, nil
+}
+
+// addWants adds to the request the objects of the references that are not in
+// the repository, or all of them if the history is being deepened.
+func (r *Repository) addWants(req *common.GitUploadPackRequest, refs []*core.Reference, deepen bool) error {
+	wanted := make(map[core.Hash]bool, len(refs))
+	for _, ref := range refs {
+		if wanted[ref.Hash] {
+			continue
+		}
+
+		wanted[ref.Hash] = true
+		if !deepen {
+			ok, err := r.hasObject(ref.Hash)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				continue
+			}
+		}
+
+		req.Want(ref.Hash)
+	}
+
+	return nil
+}
+
+// addHaves adds to the request the objects of the hash references of the
+// repository that are in its storage, sorted by reference name, so the
+// remote sends only the objects missing.
+func (r *Repository) addHaves(req *common.GitUploadPackRequest) error {
+	iter, err := r.References.Iter()
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	var refs []*core.Reference
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !ref.IsSymbolic() {
+			refs = append(refs, ref)
+		}
+	}
+
+	sort.Sort(referencesByName(refs))
+	seen := make(map[core.Hash]bool, len(refs))
+	for _, ref := range refs {
+		if seen[ref.Hash] {
+			continue
+		}
+
+		seen[ref.Hash] = true
+		ok, err := r.hasObject(ref.Hash)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			req.Have(ref.Hash)
+		}
+	}
+
+	return nil
+}
+
+// fetchPack fetches the packfile of the request from the remote and stores
+// its objects, writing the progress of the indexing to the Progress of the
+// request, and the shallow commits of the response if shallow is true,
+// along with the ones the request had. The remote only sends the commits it
+// made shallow or unshallowed if the request has a depth, otherwise the
+// shallow commits of the request are kept as they are.
+//
+// The packfile is kept as it is, with a generated idx file, if the storage
+// of the repository can keep packfiles, see packfileWriter, or its objects
+// are indexed in a quarantine otherwise, and only stored once the whole
+// packfile has been read. Either way nothing is stored if the fetch fails or
+// ctx is done, and the objects are never all kept in memory but for the
+// quarantine. The delta bases that are not in the packfile, if it is thin,
+// are read from the repository.
+func (r *Repository) fetchPack(ctx context.Context, remote *Remote, req *common.GitUploadPackRequest, shallow bool, shallows []core.Hash) (err error) {
+	reader, err := remote.FetchContext(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	rc := newContextReadCloser(ctx, reader)
+	defer checkClose(rc, &err)
+
+	if w, ok := r.Storage.(packfileWriter); ok {
+		_, err = w.WritePackfile(rc, r.Storage, req.Progress)
+	} else {
+		err = r.indexPack(rc, req.Progress)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if !shallow {
+		return nil
+	}
+
+	res, ok := reader.(*common.GitUploadPackResponse)
+	if !ok {
+		return fmt.Errorf("the shallow commits of %s are unknown", remote.Endpoint)
+	}
+
+	return r.updateShallows(shallows, res)
+}
+
+// packfileWriter is implemented by the ObjectStorages that keep the
+// packfiles fetched as they are, like filesystem.ObjectStorage, instead of
+// storing their objects one by one.
+type packfileWriter interface {
+	// WritePackfile writes the packfile read from r, reading the delta
+	// bases that are not in it from bases, and returns its checksum.
+	WritePackfile(r io.Reader, bases core.ObjectStorage, progress io.Writer) (core.Hash, error)
+}
+
+// indexPack indexes the packfile read from r in a quarantine, and stores
+// its objects in the storage of the repository once it is read.
+func (r *Repository) indexPack(rd io.Reader, progress io.Writer) error {
+	quarantine := memory.NewObjectStorageWithFormat(r.ObjectFormat())
+	ix := packfile.NewIndexer(rd)
+	ix.Progress = progress
+	ix.Bases = r.Storage
+	if _, err := ix.Index(quarantine); err != nil {
+		return err
+	}
+
+	return copyObjects(r.Storage, quarantine)
+}
+
+// copyObjectsOrder is the order the objects are copied from a quarantine,
+// so the objects referenced by the ones copied are always stored before
+// them.
+var copyObjectsOrder = []core.ObjectType{
+	core.BlobObject,
+	core.TreeObject,
+	core.CommitObject,
+	core.TagObject,
+}
+
+// copyObjects stores the objects of src in dst.
+func copyObjects(dst, src core.ObjectStorage) error {
+	for _, t := range copyObjectsOrder {
+		iter, err := src.Iter(t)
+		if err != nil {
+			return err
+		}
+
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				iter.Close()
+				return err
+			}
+
+			if _, err := dst.Set(obj); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		iter.Close()
+	}
+
+	return nil
+}
+
+// contextReadCloser closes its reader once its context is done, so a read
+// blocked returns, failing with the error of the context. It lets the
+// fetches from the services that are not a
+// common.ContextGitUploadPackService be canceled too.
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+	closed   chan struct{}
+	done     chan struct{}
+	canceled bool
+}
+
+func newContextReadCloser(ctx context.Context, rc io.ReadCloser) *contextReadCloser {
+	r := &contextReadCloser{
+		ctx:        ctx,
+		ReadCloser: rc,
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go r.watch()
+	return r
+}
+
+func (r *contextReadCloser) watch() {
+	defer close(r.done)
+
+	select {
+	case <-r.ctx.Done():
+		r.canceled = true
+		_ = r.ReadCloser.Close()
+	case <-r.closed:
+	}
+}
+
+func (r *contextReadCloser) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && r.ctx.Err() != nil {
+		return n, r.ctx.Err()
+	}
+
+	return n, err
+}
+
+// Close closes the reader, unless it has been closed already because the
+// context is done.
+func (r *contextReadCloser) Close() error {
+	close(r.closed)
+	<-r.done
+	if r.canceled {
+		return nil
+	}
+
+	return r.ReadCloser.Close()
+}
+
+// updateReferences stores the references fetched at their destinations in
+// the refspecs, returning the updates, see FetchUpdates.
+func (r *Repository) updateReferences(specs []core.RefSpec, refs []*core.Reference, reflog reflogUpdate) ([]*ReferenceUpdate, error) {
+	var updates []*ReferenceUpdate
+	var rejected bool
+	for _, ref := range refs {
+		for _, s := range specs {
+			if !s.Match(ref.Name) || s.Dst(ref.Name) == "" {
+				continue
+			}
+
+			u := &ReferenceUpdate{Name: s.Dst(ref.Name), Src: ref.Name, New: ref.Hash}
+			if err := r.updateReference(u, s.IsForceUpdate(), reflog); err != nil {
+				return updates, err
+			}
+
+			updates = append(updates, u)
+			rejected = rejected || u.Status == ReferenceRejected
+		}
+	}
+
+	if rejected {
+		return updates, ErrNonFastForwardUpdate
+	}
+
+	return updates, nil
+}
+
+// updateReference stores the reference of the update, if it is new, or if
+// the update is a fast-forward or forced, setting its status. The reference
+// is only stored if it has not changed since it was read, see
+// Repository.UpdateReference, and the update is recorded in its reflog with
+// a message like the ones of git, "fetch origin: fast-forward".
+func (r *Repository) updateReference(u *ReferenceUpdate, force bool, reflog reflogUpdate) error {
+	new := core.NewHashReference(u.Name, u.New)
+	old, err := r.References.Get(u.Name)
+	if err == core.ErrReferenceNotFound {
+		u.Status = ReferenceNew
+		return r.UpdateReference(new, nil, reflog.committer, reflog.action+": "+storingMessage(u.Src))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	u.Old = old.Hash
+	if old.Hash == u.New && !old.IsSymbolic() {
+		u.Status = ReferenceUpToDate
+		return nil
+	}
+
+	ff, err := r.isFastForward(old, u.New)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	switch {
+	case ff:
+		u.Status = ReferenceFastForward
+		message = "fast-forward"
+	case force:
+		u.Status = ReferenceForced
+		message = "forced-update"
+	default:
+		u.Status = ReferenceRejected
+		return nil
+	}
+
+	return r.UpdateReference(new, old, reflog.committer, reflog.action+": "+message)
+}
+
+// storingMessage returns the reflog message of a new reference fetched from
+// the remote reference with the given name, as git writes it.
+func storingMessage(n core.ReferenceName) string {
+	switch {
+	case strings.HasPrefix(n.String(), "refs/heads/"):
+		return "storing head"
+	case strings.HasPrefix(n.String(), "refs/tags/"):
+		return "storing tag"
+	default:
+		return "storing ref"
+	}
+}
+
+// isFastForward reports whether the commit of the reference is an ancestor
+// of the commit with the given hash. Updates of references to other objects,
+// or to commits not in the repository, are not fast-forwards.
+func (r *Repository) isFastForward(old *core.Reference, h core.Hash) (bool, error) {
+	if old.IsSymbolic() {
+		return false, nil
+	}
+
+	from, err := r.Commit(old.Hash)
+	if err == ErrObjectNotFound || err == ErrUnsupportedObject {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	to, err := r.Commit(h)
+	if err == ErrUnsupportedObject {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return from.IsAncestor(to)
+}
+
+// upToDate reports whether all the updates are ReferenceUpToDate.
+func upToDate(updates []*ReferenceUpdate) bool {
+	for _, u := range updates {
+		if u.Status != ReferenceUpToDate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// shallows returns the shallow commits of the repository.
+func (r *Repository) shallows() ([]core.Hash, error) {
+	if r.Shallows == nil {
+		return nil, nil
+	}
+
+	return r.Shallows.Shallow()
+}
+
+// isShallow reports whether the commit with the given hash is shallow.
+func (r *Repository) isShallow(h core.Hash) (bool, error) {
+	shallows, err := r.shallows()
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range shallows {
+		if s == h {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// updateShallows stores the shallow commits of the repository after a fetch:
+// the given ones, sent to the remote, and the ones made shallow by the
+// response, without the ones it unshallowed.
+func (r *Repository) updateShallows(shallows []core.Hash, res *common.GitUploadPackResponse) error {
+	set := make(map[core.Hash]bool)
+	for _, h := range shallows {
+		set[h] = true
+	}
+
+	for _, h := range res.Shallows {
+		set[h] = true
+	}
+
+	for _, h := range res.Unshallows {
+		delete(set, h)
+	}
+
+	updated := make([]core.Hash, 0, len(set))
+	for h := range set {
+		updated = append(updated, h)
+	}
+
+	if r.Shallows == nil {
+		if len(updated) == 0 {
+			return nil
+		}
+
+		r.Shallows = memory.NewShallowStorage()
+	}
+
+	return r.Shallows.SetShallow(updated)
+}
+
+type referencesByName []*core.Reference
+
+func (s referencesByName) Len() int           { return len(s) }
+func (s referencesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s referencesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,368 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// the branches of mergesFixture before and after the fetches recorded in
+// fixtures/upload-pack
+var (
+	fetchMaster1  = core.NewHash("d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a")
+	fetchFeature1 = core.NewHash("053869ce909291337e76ac4e5e989d52b8a12f21")
+	fetchMaster2  = core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763")
+	fetchFeature2 = core.NewHash("3535f80b8fc84ebedf448014e79191c0e867b575")
+	fetchFeature3 = core.NewHash("b363aabeb50df3c06868d116c72e37ce1c72255a")
+)
+
+type SuiteFetch struct{}
+
+var _ = Suite(&SuiteFetch{})
+
+func (s *SuiteFetch) TestFetch(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+
+	updates, err := r.FetchUpdates(&FetchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(updates, DeepEquals, []*ReferenceUpdate{
+		{Name: "refs/remotes/origin/feature", Src: "refs/heads/feature", New: fetchFeature1, Status: ReferenceNew},
+		{Name: "refs/remotes/origin/master", Src: "refs/heads/master", New: fetchMaster1, Status: ReferenceNew},
+	})
+
+	c.Assert(r.Fetch(&FetchOptions{}), Equals, NoErrAlreadyUpToDate)
+
+	// the tips of the remote branches are sent as haves
+	srv.name = "fetch-2"
+	srv.refs = map[string]core.Hash{
+		"refs/heads/master":  fetchMaster2,
+		"refs/heads/feature": fetchFeature2,
+	}
+
+	updates, err = r.FetchUpdates(&FetchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(updates, DeepEquals, []*ReferenceUpdate{
+		{Name: "refs/remotes/origin/feature", Src: "refs/heads/feature", Old: fetchFeature1, New: fetchFeature2, Status: ReferenceFastForward},
+		{Name: "refs/remotes/origin/master", Src: "refs/heads/master", Old: fetchMaster1, New: fetchMaster2, Status: ReferenceFastForward},
+	})
+
+	iter, err := r.Log(LogOptions{From: fetchMaster2})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), HasLen, 15)
+
+	c.Assert(r.Fetch(&FetchOptions{}), Equals, NoErrAlreadyUpToDate)
+}
+
+// the packfiles fetched into a filesystem storage are kept as they are,
+// with a generated idx file
+func (s *SuiteFetch) TestFetchFilesystem(c *C) {
+	dir, err := ioutil.TempDir("", "fetch-filesystem")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "objects", "pack"), 0755), IsNil)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: &fixtureUploadPackService{
+		c: c, name: "fetch-1", refs: map[string]core.Hash{
+			"refs/heads/master":  fetchMaster1,
+			"refs/heads/feature": fetchFeature1,
+		}}}
+
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	packs, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "pack-*"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 2)
+
+	iter, err := r.Log(LogOptions{From: fetchMaster1})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), Not(HasLen), 0)
+}
+
+func (s *SuiteFetch) TestFetchNonFastForward(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	// feature is rewound to its parent, already in the repository
+	srv.name = ""
+	srv.refs["refs/heads/feature"] = fetchFeature3
+
+	updates, err := r.FetchUpdates(&FetchOptions{RefSpecs: []core.RefSpec{
+		"refs/heads/*:refs/remotes/origin/*",
+	}})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+	c.Assert(updates, DeepEquals, []*ReferenceUpdate{
+		{Name: "refs/remotes/origin/feature", Src: "refs/heads/feature", Old: fetchFeature1, New: fetchFeature3, Status: ReferenceRejected},
+		{Name: "refs/remotes/origin/master", Src: "refs/heads/master", Old: fetchMaster1, New: fetchMaster1, Status: ReferenceUpToDate},
+	})
+
+	ref, err := r.Reference("refs/remotes/origin/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, fetchFeature1)
+
+	updates, err = r.FetchUpdates(&FetchOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(updates[0], DeepEquals, &ReferenceUpdate{
+		Name: "refs/remotes/origin/feature", Src: "refs/heads/feature", Old: fetchFeature1, New: fetchFeature3, Status: ReferenceForced,
+	})
+	c.Assert(updates[0].String(), Equals, "refs/heads/feature -> refs/remotes/origin/feature (forced update)")
+
+	ref, err = r.Reference("refs/remotes/origin/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, fetchFeature3)
+}
+
+func (s *SuiteFetch) TestFetchReflog(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+
+	committer := Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833006, 0).UTC()}
+	c.Assert(r.Fetch(&FetchOptions{Committer: committer}), IsNil)
+
+	srv.name = "fetch-2"
+	srv.refs = map[string]core.Hash{
+		"refs/heads/master":  fetchMaster2,
+		"refs/heads/feature": fetchFeature2,
+	}
+	c.Assert(r.Fetch(&FetchOptions{Committer: committer}), IsNil)
+
+	iter, err := r.Reflog("refs/remotes/origin/master")
+	c.Assert(err, IsNil)
+
+	var obtained []*core.ReflogEntry
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		obtained = append(obtained, e)
+	}
+
+	c.Assert(obtained, DeepEquals, []*core.ReflogEntry{
+		{New: fetchMaster1, Committer: core.Signature(committer), Message: "fetch origin: storing head"},
+		{Old: fetchMaster1, New: fetchMaster2, Committer: core.Signature(committer), Message: "fetch origin: fast-forward"},
+	})
+}
+
+// the reference is not updated if it changed since it was read
+func (s *SuiteFetch) TestFetchReferenceChanged(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+	r.References = &changingReferenceStorage{
+		ReferenceStorage: r.References,
+		name:             "refs/remotes/origin/master",
+		hash:             fetchFeature1,
+	}
+
+	_, err := r.FetchUpdates(&FetchOptions{})
+	c.Assert(err, Equals, core.ErrReferenceHasChanged)
+
+	ref, err := r.Reference("refs/remotes/origin/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, fetchFeature1)
+}
+
+// changingReferenceStorage stores the reference with the given name and
+// hash the first time it is read, as another writer would.
+type changingReferenceStorage struct {
+	core.ReferenceStorage
+	name    core.ReferenceName
+	hash    core.Hash
+	changed bool
+}
+
+func (s *changingReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
+	ref, err := s.ReferenceStorage.Get(n)
+	if n == s.name && !s.changed {
+		s.changed = true
+		if err := s.ReferenceStorage.Set(core.NewHashReference(s.name, s.hash)); err != nil {
+			return nil, err
+		}
+	}
+
+	return ref, err
+}
+
+func (s *SuiteFetch) TestFetchRemoteNotFound(c *C) {
+	r := NewPlainRepository()
+	err := r.Fetch(&FetchOptions{RemoteName: "foo"})
+	c.Assert(err, ErrorMatches, `unable to find remote "foo"`)
+}
+
+func (s *SuiteFetch) TestFetchProgress(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	srv.name = "fetch-2-side-band"
+	srv.sideband = true
+	srv.refs = map[string]core.Hash{
+		"refs/heads/master":  fetchMaster2,
+		"refs/heads/feature": fetchFeature2,
+	}
+
+	progress := bytes.NewBuffer(nil)
+	c.Assert(r.Fetch(&FetchOptions{Progress: progress}), IsNil)
+	c.Assert(progress.String(), Matches, "(?s)Enumerating objects: 30, done.\n"+
+		".*Counting objects: 100% \\(28/28\\), done.\n"+
+		".*Indexing objects:   4% \\(1/22\\)\r"+
+		".*Indexing objects: 100% \\(22/22\\), done.\n")
+}
+
+// the commits of the repository of formats/packfile/fixtures/thin.pack, see
+// formats/packfile/fixtures/getthinpack.bash
+var (
+	thinFirst  = core.NewHash("9ef3eaebbb76c43479561c87d16a3adf41b61ed6")
+	thinSecond = core.NewHash("c47a0bbdf0866001955589c4ec5717569c4c0430")
+)
+
+func (s *SuiteFetch) TestFetchThin(c *C) {
+	srv := &fixtureUploadPackService{c: c, name: "fetch-thin", refs: map[string]core.Hash{
+		"refs/heads/master": thinSecond,
+	}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+
+	f, err := os.Open("formats/packfile/fixtures/thin-base.pack")
+	c.Assert(err, IsNil)
+	defer f.Close()
+	c.Assert(packfile.NewDecoder(packfile.NewStream(f)).Decode(r.Storage), IsNil)
+	c.Assert(r.References.Set(core.NewHashReference("refs/remotes/origin/master", thinFirst)), IsNil)
+
+	// the blob of second is a ref-delta of the one of first, not sent
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	commit, err := r.Commit(thinSecond)
+	c.Assert(err, IsNil)
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(f *File) error {
+		_, err := f.Contents()
+		return err
+	}), IsNil)
+}
+
+// remoteErrorUploadPackService is a fixtureUploadPackService whose response
+// is cut by an error in the third side-band channel
+type remoteErrorUploadPackService struct {
+	fixtureUploadPackService
+}
+
+func (s *remoteErrorUploadPackService) Fetch(r *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	req := *r
+	req.Capabilities = append(req.Capabilities, "side-band-64k")
+	raw := "0008NAK\n" +
+		"0011\x01PACK\x00\x00\x00\x02\x00\x00\x00\x16" +
+		"0024\x03upload-pack: not our ref 972eb2\n"
+
+	return common.NewGitUploadPackResponse(ioutil.NopCloser(strings.NewReader(raw)), &req)
+}
+
+func (s *SuiteFetch) TestFetchRemoteError(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: &remoteErrorUploadPackService{}}
+
+	err := r.Fetch(&FetchOptions{Progress: ioutil.Discard})
+	c.Assert(err, ErrorMatches, "remote: upload-pack: not our ref 972eb2")
+}
+
+// stalledUploadPackService is a fixtureUploadPackService whose response is
+// stopped after its first half until it is closed
+type stalledUploadPackService struct {
+	fixtureUploadPackService
+}
+
+func (s *stalledUploadPackService) Fetch(req *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	raw, err := ioutil.ReadFile("fixtures/upload-pack/" + s.name + ".response")
+	s.c.Assert(err, IsNil)
+
+	r, w := io.Pipe()
+	go w.Write(raw[:len(raw)/2])
+
+	return common.NewGitUploadPackResponse(r, req)
+}
+
+// a fetch canceled while the packfile is being read stores neither the
+// objects read nor the references
+func (s *SuiteFetch) TestFetchContextCanceled(c *C) {
+	srv := &stalledUploadPackService{fixtureUploadPackService{c: c, name: "fetch-1", refs: map[string]core.Hash{
+		"refs/heads/master":  fetchMaster1,
+		"refs/heads/feature": fetchFeature1,
+	}}}
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := r.FetchContext(ctx, &FetchOptions{})
+	c.Assert(err, Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+
+	_, err = r.References.Get("refs/remotes/origin/master")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	for _, t := range copyObjectsOrder {
+		iter, err := r.Storage.Iter(t)
+		c.Assert(err, IsNil)
+		_, err = iter.Next()
+		c.Assert(err, Equals, io.EOF)
+	}
+}
+
+func (s *SuiteFetch) TestFetchContextDone(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: &fixtureUploadPackService{c: c}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Assert(r.FetchContext(ctx, &FetchOptions{}), Equals, context.Canceled)
+	c.Assert(r.PullContext(ctx, &PullOptions{}), Equals, context.Canceled)
+}
@@ -1,12 +1,20 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"os"
 	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
 )
 
-// File represents git file objects.
+// File represents git file objects. The size of the file is available in
+// the Size field of the embedded Blob, which does not require reading its
+// contents.
 type File struct {
 	Name string
 	Mode os.FileMode
@@ -17,47 +25,301 @@ func newFile(name string, m os.FileMode, b *Blob) *File {
 	return &File{Name: name, Mode: m, Blob: *b}
 }
 
+var (
+	// ErrBlobTooLarge is returned by the limited versions of the methods
+	// reading the contents of a file when the file is larger than the limit.
+	ErrBlobTooLarge = errors.New("blob too large")
+	// ErrNotSymlink is returned by File.SymlinkTarget for files that are not
+	// symbolic links.
+	ErrNotSymlink = errors.New("not a symbolic link")
+)
+
+// IsExecutable returns true if the file is executable.
+func (f *File) IsExecutable() bool {
+	return isExecutableMode(f.Mode)
+}
+
+// IsSymlink returns true if the file is a symbolic link.
+func (f *File) IsSymlink() bool {
+	return isSymlinkMode(f.Mode)
+}
+
+// IsSubmodule returns true if the file is a git submodule.
+func (f *File) IsSubmodule() bool {
+	return isSubmoduleMode(f.Mode)
+}
+
+// SymlinkTarget returns the target of a symbolic link, which git stores as
+// the contents of its blob. ErrNotSymlink is returned for other files.
+func (f *File) SymlinkTarget() (string, error) {
+	if !f.IsSymlink() {
+		return "", ErrNotSymlink
+	}
+
+	return f.Contents()
+}
+
+// IsBinary reports whether the file looks binary, using the same heuristic
+// as git: a NUL byte in its first 8000 bytes. Only those bytes are read.
+func (f *File) IsBinary() (bin bool, err error) {
+	reader, err := f.Reader()
+	if err != nil {
+		return false, err
+	}
+	defer checkClose(reader, &err)
+
+	buf := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return isBinary(string(buf[:n])), nil
+}
+
 // Contents returns the contents of a file as a string.
 func (f *File) Contents() (content string, err error) {
+	return f.contents(-1)
+}
+
+// ContentsWithAttrs returns the contents of a file as git writes them to
+// the working tree, converting their end of lines according to the given
+// gitattributes, usually the ones returned by Tree.Attributes for the file.
+func (f *File) ContentsWithAttrs(attrs Attrs) (string, error) {
+	content, err := f.Contents()
+	if err != nil {
+		return "", err
+	}
+
+	return convertEOL(content, attrs), nil
+}
+
+// ContentsLimited is like Contents but returns ErrBlobTooLarge, without
+// reading the whole file, if it is larger than max bytes.
+func (f *File) ContentsLimited(max int64) (string, error) {
+	return f.contents(max)
+}
+
+// contents reads the contents of the file, up to max bytes if max is not
+// negative.
+func (f *File) contents(max int64) (content string, err error) {
+	if max >= 0 && f.Size > max {
+		return "", ErrBlobTooLarge
+	}
+
 	reader, err := f.Reader()
 	if err != nil {
 		return "", err
 	}
 	defer checkClose(reader, &err)
 
+	var r io.Reader = reader
+	if max >= 0 {
+		// the size of the object may be wrong, do not trust it
+		r = io.LimitReader(reader, max+1)
+	}
+
 	buf := new(bytes.Buffer)
-	buf.ReadFrom(reader)
+	buf.ReadFrom(r)
+
+	if max >= 0 && int64(buf.Len()) > max {
+		return "", ErrBlobTooLarge
+	}
 
 	return buf.String(), nil
 }
 
 // Lines returns a slice of lines from the contents of a file, stripping
-// all end of line characters. If the last line is empty (does not end
-// in an end of line), it is also stripped.
+// all end of line characters, both "\n" and "\r\n". If the last line is
+// empty (does not end in an end of line), it is also stripped.
 func (f *File) Lines() ([]string, error) {
 	content, err := f.Contents()
 	if err != nil {
 		return nil, err
 	}
 
-	splits := strings.Split(content, "\n")
+	return splitLines(content), nil
+}
+
+// LinesLimited is like Lines but returns ErrBlobTooLarge, without reading
+// the whole file, if it is larger than max bytes.
+func (f *File) LinesLimited(max int64) ([]string, error) {
+	content, err := f.ContentsLimited(max)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitLines(content), nil
+}
+
+// LinesWithEOL returns a slice of lines from the contents of a file, each
+// one with its end of line characters, and whether the last line ends with
+// an end of line. Joining the lines gives back the contents of the file.
+func (f *File) LinesWithEOL() (lines []string, eol bool, err error) {
+	content, err := f.Contents()
+	if err != nil {
+		return nil, false, err
+	}
+
+	lines = splitLinesWithEOL(content)
+	if len(lines) == 0 {
+		return lines, true, nil
+	}
+
+	return lines, strings.HasSuffix(lines[len(lines)-1], "\n"), nil
+}
+
+// DefaultMaxLineLength is the maximum length of the lines read by
+// File.ForEachLine when no other limit is given.
+const DefaultMaxLineLength = 64 * 1024
+
+// LineScanner returns a bufio.Scanner reading the lines of the file, without
+// their end of line characters, directly from the blob instead of loading
+// the whole contents in memory. Lines longer than maxLineLength, counting
+// their end of line, make the scanner fail with bufio.ErrTooLong, a zero or
+// negative maxLineLength means DefaultMaxLineLength. The returned io.Closer
+// must be closed when finished with the scanner.
+func (f *File) LineScanner(maxLineLength int) (*bufio.Scanner, io.Closer, error) {
+	if maxLineLength <= 0 {
+		maxLineLength = DefaultMaxLineLength
+	}
+
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bufSize := 4096
+	if bufSize > maxLineLength {
+		bufSize = maxLineLength
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, bufSize), maxLineLength)
+	scanner.Split(scanLines)
+
+	return scanner, reader, nil
+}
+
+// ForEachLine calls cb for each line of the file, as read by a LineScanner
+// with the given maxLineLength. If cb returns core.ErrStop the iteration
+// stops and nil is returned, any other error stops it and is returned.
+func (f *File) ForEachLine(maxLineLength int, cb func(line string) error) (err error) {
+	scanner, closer, err := f.LineScanner(maxLineLength)
+	if err != nil {
+		return err
+	}
+	defer checkClose(closer, &err)
+
+	for scanner.Scan() {
+		if err := cb(scanner.Text()); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// scanLines is like bufio.ScanLines but only strips the carriage returns
+// followed by a new line, as Lines does.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		if i > 0 && data[i-1] == '\r' {
+			return i + 1, data[:i-1], nil
+		}
+
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+func splitLines(content string) []string {
+	lines := splitLinesWithEOL(content)
+	for i, l := range lines {
+		if strings.HasSuffix(l, "\r\n") {
+			lines[i] = l[:len(l)-2]
+		} else {
+			lines[i] = strings.TrimSuffix(l, "\n")
+		}
+	}
+
+	return lines
+}
+
+func splitLinesWithEOL(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
 	// remove the last line if it is empty
-	if splits[len(splits)-1] == "" {
-		return splits[:len(splits)-1], nil
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
 	}
 
-	return splits, nil
+	return lines
 }
 
 type FileIter struct {
-	w TreeWalker
+	w   *TreeWalker
+	p   *parallelFileWalker // instead of w, see Tree.FilesParallel
+	err error               // returned by Next, see newErrFileIter
 }
 
 func NewFileIter(r *Repository, t *Tree) *FileIter {
-	return &FileIter{w: *NewTreeWalker(r, t)}
+	return &FileIter{w: NewTreeWalker(r, t)}
+}
+
+// newFileIterWithBase returns a FileIter for the given tree whose file names
+// are prefixed by the given base path.
+func newFileIterWithBase(r *Repository, t *Tree, base string) *FileIter {
+	w := NewTreeWalker(r, t)
+	w.setBase(base)
+
+	return &FileIter{w: w}
+}
+
+// newErrFileIter returns a FileIter without files whose Next returns the
+// given error.
+func newErrFileIter(r *Repository, err error) *FileIter {
+	return &FileIter{w: NewTreeWalker(r, &Tree{r: r}), err: err}
+}
+
+// NewNonRecursiveFileIter returns a FileIter that only returns the files
+// directly contained in the given tree, ignoring its subtrees.
+func NewNonRecursiveFileIter(r *Repository, t *Tree) *FileIter {
+	return &FileIter{w: NewNonRecursiveTreeWalker(r, t)}
+}
+
+// SetMaxDepth sets the maximum number of nested subtrees the iterator
+// descends into, see TreeWalker.SetMaxDepth.
+func (iter *FileIter) SetMaxDepth(depth int) {
+	if iter.p != nil {
+		iter.p.maxDepth = depth
+		return
+	}
+
+	iter.w.SetMaxDepth(depth)
 }
 
 func (iter *FileIter) Next() (*File, error) {
+	if iter.err != nil {
+		return nil, iter.err
+	}
+
+	if iter.p != nil {
+		return iter.p.next()
+	}
+
 	for {
 		name, entry, obj, err := iter.w.Next()
 		if err != nil {
@@ -70,6 +332,57 @@ func (iter *FileIter) Next() (*File, error) {
 	}
 }
 
+// ForEach calls cb for each of the remaining files of the iterator, the ones
+// not returned by Next yet, and then closes it. See ForEachContext.
+func (iter *FileIter) ForEach(cb func(*File) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each file of the iterator until it is
+// exhausted, cb returns an error or ctx is done, checking ctx before every
+// file, and then closes the iterator. If cb returns core.ErrStop the
+// iteration stops without an error, if ctx is done its error is returned.
+func (iter *FileIter) ForEachContext(ctx context.Context, cb func(*File) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		f, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(f); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Reset makes the iterator start again from the first file, even if it has
+// been closed.
+func (iter *FileIter) Reset() {
+	if iter.p != nil {
+		iter.p.reset()
+		return
+	}
+
+	iter.w.Reset()
+}
+
 func (iter *FileIter) Close() {
+	if iter.p != nil {
+		iter.p.close()
+		return
+	}
+
 	iter.w.Close()
 }
@@ -1,9 +1,16 @@
 package git
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"io"
+	"os"
+	"runtime"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -53,7 +60,9 @@ func (s *SuiteFile) TestIter(c *C) {
 		commit, err := r.Commit(core.NewHash(t.commit))
 		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
 
-		iter := NewFileIter(r, commit.Tree())
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		iter := NewFileIter(r, tree)
 		for k := 0; k < len(t.files); k++ {
 			exp := t.files[k]
 			file, err := iter.Next()
@@ -69,6 +78,136 @@ func (s *SuiteFile) TestIter(c *C) {
 	}
 }
 
+func (s *SuiteFile) TestIterNonRecursive(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	iter := tree.FilesNonRecursive()
+	defer iter.Close()
+
+	var names []string
+	for file, err := iter.Next(); err == nil; file, err = iter.Next() {
+		names = append(names, file.Name)
+	}
+	c.Assert(names, DeepEquals, []string{".gitignore", "CHANGELOG", "LICENSE", "binary.jpg"})
+}
+
+func (s *SuiteFile) TestIterForEachAndReset(c *C) {
+	t := fileIterTests[0]
+	r := s.repos[t.repo]
+	commit, err := r.Commit(core.NewHash(t.commit))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	var expected []string
+	for _, f := range t.files {
+		expected = append(expected, f.Name)
+	}
+
+	var names []string
+	collect := func(f *File) error {
+		names = append(names, f.Name)
+		return nil
+	}
+
+	// ForEach only returns the files not consumed by Next and closes the
+	// iterator, so calling it again returns nothing
+	iter := tree.Files()
+	file, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(file.Name, Equals, expected[0])
+	c.Assert(iter.ForEach(collect), IsNil)
+	c.Assert(names, DeepEquals, expected[1:])
+
+	names = nil
+	c.Assert(iter.ForEach(collect), IsNil)
+	c.Assert(names, HasLen, 0)
+
+	iter.Reset()
+	c.Assert(iter.ForEach(collect), IsNil)
+	c.Assert(names, DeepEquals, expected)
+
+	// the base of the iterators by prefix is kept
+	names = nil
+	iter = tree.FilesByPrefix("json")
+	c.Assert(iter.ForEach(collect), IsNil)
+	iter.Reset()
+	c.Assert(iter.ForEach(collect), IsNil)
+	c.Assert(names, DeepEquals, []string{
+		"json/long.json", "json/short.json", "json/long.json", "json/short.json",
+	})
+
+	var trees int
+	countTrees := func(*Tree) error {
+		trees++
+		return nil
+	}
+
+	treeIter := NewTreeIter(r, tree)
+	_, err = treeIter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(treeIter.ForEach(countTrees), IsNil)
+	c.Assert(trees, Equals, 3)
+	treeIter.Reset()
+	c.Assert(treeIter.ForEach(countTrees), IsNil)
+	c.Assert(trees, Equals, 7)
+}
+
+func (s *SuiteFile) TestIterForEachContext(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var names []string
+	iter := NewFileIter(r, tree)
+	err = iter.ForEachContext(ctx, func(f *File) error {
+		names = append(names, f.Name)
+		if len(names) == 2 {
+			cancel()
+		}
+
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(names, DeepEquals, []string{".gitignore", "CHANGELOG"})
+	c.Assert(iter.w.stack, IsNil)
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+
+	// the errors of the callback stop the iteration, core.ErrStop silently
+	names = nil
+	iter = NewFileIter(r, tree)
+	err = iter.ForEachContext(context.Background(), func(f *File) error {
+		names = append(names, f.Name)
+		return core.ErrStop
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{".gitignore"})
+	c.Assert(iter.w.stack, IsNil)
+
+	expected := errors.New("foo")
+	err = tree.Files().ForEachContext(context.Background(), func(f *File) error {
+		return expected
+	})
+	c.Assert(err, Equals, expected)
+
+	err = tree.Files().ForEachContext(ctx, func(f *File) error {
+		c.Fatal("unexpected call for a done context")
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+}
+
 var contentsTests = []struct {
 	repo     string // the repo name as in localRepos
 	commit   string // the commit to search for the file
@@ -186,7 +325,9 @@ func (s *SuiteFile) TestIgnoreEmptyDirEntries(c *C) {
 		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
 		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
 
-		iter := commit.Tree().Files()
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		iter := tree.Files()
 		defer iter.Close()
 		for file, err := iter.Next(); err == nil; file, err = iter.Next() {
 			_, _ = file.Contents()
@@ -194,3 +335,355 @@ func (s *SuiteFile) TestIgnoreEmptyDirEntries(c *C) {
 		}
 	}
 }
+
+// readCountingStorage counts the times the contents of the blobs it returns
+// are read.
+type readCountingStorage struct {
+	core.ObjectStorage
+	reads int
+}
+
+func (s *readCountingStorage) Get(h core.Hash) (core.Object, error) {
+	obj, err := s.ObjectStorage.Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readCountingObject{obj, s}, nil
+}
+
+type readCountingObject struct {
+	core.Object
+	s *readCountingStorage
+}
+
+func (o *readCountingObject) Reader() (core.ObjectReader, error) {
+	if o.Type() == core.BlobObject {
+		o.s.reads++
+	}
+
+	return o.Object.Reader()
+}
+
+func (s *SuiteFile) TestSizeWithoutReading(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	storage := &readCountingStorage{ObjectStorage: r.Storage}
+	repo := &Repository{Storage: storage}
+
+	tree, err := repo.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	// use git ls-tree -r -l to get the expected sizes
+	var size int64
+	iter := tree.Files()
+	for {
+		file, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		size += file.Size
+	}
+	iter.Close()
+
+	c.Assert(size, Equals, int64(310289))
+	c.Assert(storage.reads, Equals, 0)
+
+	file, err := tree.File("LICENSE")
+	c.Assert(err, IsNil)
+	c.Assert(file.Size, Equals, int64(1072))
+	c.Assert(storage.reads, Equals, 0)
+
+	_, err = file.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(storage.reads, Equals, 1)
+}
+
+func newTestFile(content string) *File {
+	blob := &Blob{}
+	blob.Decode(memory.NewObject(core.BlobObject, int64(len(content)), []byte(content)))
+
+	return newFile("file", 0100644, blob)
+}
+
+func (s *SuiteFile) TestContentsLimited(c *C) {
+	large := strings.Repeat("0123456789abcde\n", 512*1024) // 8 MiB
+	file := newTestFile(large)
+
+	_, err := file.ContentsLimited(1024 * 1024)
+	c.Assert(err, Equals, ErrBlobTooLarge)
+	_, err = file.ContentsLimited(int64(len(large)) - 1)
+	c.Assert(err, Equals, ErrBlobTooLarge)
+	_, err = file.LinesLimited(1024 * 1024)
+	c.Assert(err, Equals, ErrBlobTooLarge)
+
+	content, err := file.ContentsLimited(int64(len(large)))
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, large)
+
+	lines, err := file.LinesLimited(int64(len(large)))
+	c.Assert(err, IsNil)
+	c.Assert(lines, HasLen, 512*1024)
+
+	small := newTestFile("foo\nbar\n")
+	content, err = small.ContentsLimited(1024)
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo\nbar\n")
+	lines, err = small.LinesLimited(1024)
+	c.Assert(err, IsNil)
+	c.Assert(lines, DeepEquals, []string{"foo", "bar"})
+
+	// the limit is enforced while reading, even if the size is wrong
+	lying := newTestFile(large)
+	lying.Size = 10
+	_, err = lying.ContentsLimited(1024)
+	c.Assert(err, Equals, ErrBlobTooLarge)
+
+	// the default behaviour does not change
+	content, err = file.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, large)
+}
+
+func (s *SuiteFile) TestLineEndings(c *C) {
+	for i, t := range []struct {
+		content string
+		lines   []string // expected result of Lines
+		withEOL []string // expected result of LinesWithEOL
+		eol     bool     // expected end of line of the last line
+	}{
+		{"", nil, nil, true},
+		{"\n", []string{""}, []string{"\n"}, true},
+		{"foo\nbar\n", []string{"foo", "bar"}, []string{"foo\n", "bar\n"}, true},
+		{"foo\r\nbar\r\n", []string{"foo", "bar"}, []string{"foo\r\n", "bar\r\n"}, true},
+		{"foo\r\nbar\nbaz\r\n", []string{"foo", "bar", "baz"}, []string{"foo\r\n", "bar\n", "baz\r\n"}, true},
+		{"foo\nbar", []string{"foo", "bar"}, []string{"foo\n", "bar"}, false},
+		{"foo\r\nbar", []string{"foo", "bar"}, []string{"foo\r\n", "bar"}, false},
+		{"foo\r", []string{"foo\r"}, []string{"foo\r"}, false},
+		{"foo\rbar\r\n\r\n", []string{"foo\rbar", ""}, []string{"foo\rbar\r\n", "\r\n"}, true},
+	} {
+		com := Commentf("subtest %d, content=%q", i, t.content)
+		file := newTestFile(t.content)
+
+		lines, err := file.Lines()
+		c.Assert(err, IsNil, com)
+		c.Assert(lines, HasLen, len(t.lines), com)
+		if len(t.lines) != 0 {
+			c.Assert(lines, DeepEquals, t.lines, com)
+		}
+
+		withEOL, eol, err := file.LinesWithEOL()
+		c.Assert(err, IsNil, com)
+		c.Assert(withEOL, HasLen, len(t.withEOL), com)
+		if len(t.withEOL) != 0 {
+			c.Assert(withEOL, DeepEquals, t.withEOL, com)
+		}
+		c.Assert(eol, Equals, t.eol, com)
+		c.Assert(strings.Join(withEOL, ""), Equals, t.content, com)
+	}
+}
+
+// closeCountingObject counts the readers of the object still open.
+type closeCountingObject struct {
+	core.Object
+	open int
+}
+
+func (o *closeCountingObject) Reader() (core.ObjectReader, error) {
+	r, err := o.Object.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	o.open++
+	return &closeCountingReader{r, o}, nil
+}
+
+type closeCountingReader struct {
+	core.ObjectReader
+	o *closeCountingObject
+}
+
+func (r *closeCountingReader) Close() error {
+	r.o.open--
+	return r.ObjectReader.Close()
+}
+
+func newCloseCountingFile(content string) (*File, *closeCountingObject) {
+	obj := &closeCountingObject{
+		Object: memory.NewObject(core.BlobObject, int64(len(content)), []byte(content)),
+	}
+
+	blob := &Blob{}
+	blob.Decode(obj)
+
+	return newFile("file", 0100644, blob), obj
+}
+
+func (s *SuiteFile) TestForEachLine(c *C) {
+	file, obj := newCloseCountingFile("foo\r\nbar\n\nbaz\rqux")
+
+	var lines []string
+	err := file.ForEachLine(0, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(lines, DeepEquals, []string{"foo", "bar", "", "baz\rqux"})
+	c.Assert(obj.open, Equals, 0)
+
+	lines = nil
+	err = file.ForEachLine(0, func(line string) error {
+		lines = append(lines, line)
+		if line == "bar" {
+			return core.ErrStop
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(lines, DeepEquals, []string{"foo", "bar"})
+	c.Assert(obj.open, Equals, 0)
+
+	stop := errors.New("stop")
+	err = file.ForEachLine(0, func(line string) error { return stop })
+	c.Assert(err, Equals, stop)
+	c.Assert(obj.open, Equals, 0)
+
+	err = file.ForEachLine(2, func(line string) error { return nil })
+	c.Assert(err, Equals, bufio.ErrTooLong)
+	c.Assert(obj.open, Equals, 0)
+
+	lines = nil
+	c.Assert(file.ForEachLine(8, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}), IsNil)
+	c.Assert(lines, HasLen, 4)
+}
+
+func (s *SuiteFile) TestLineScanner(c *C) {
+	line := strings.Repeat("x", 1023) + "\n"
+	content := strings.Repeat(line, 4*1024) // 4 MiB
+	file, obj := newCloseCountingFile(content)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	scanner, closer, err := file.LineScanner(4096)
+	c.Assert(err, IsNil)
+
+	var n, size int
+	for scanner.Scan() {
+		n++
+		size += len(scanner.Bytes())
+	}
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(closer.Close(), IsNil)
+
+	runtime.ReadMemStats(&after)
+
+	c.Assert(n, Equals, 4*1024)
+	c.Assert(size, Equals, 4*1024*1023)
+	c.Assert(obj.open, Equals, 0)
+	// the contents are never loaded at once, only a small buffer is used
+	c.Assert(after.TotalAlloc-before.TotalAlloc < 256*1024, Equals, true,
+		Commentf("allocated %d bytes", after.TotalAlloc-before.TotalAlloc))
+}
+
+func (s *SuiteFile) TestModePredicates(c *C) {
+	r := NewPlainRepository()
+	content := newTestBlob(c, r, "#!/bin/sh\n")
+	target := newTestBlob(c, r, "../bin/run")
+	submodule := core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b")
+
+	b := NewTreeBuilder()
+	b.Insert("regular", content, 0100644)
+	b.Insert("executable", content, 0100755)
+	b.Insert("legacy", content, 0100664)
+	b.Insert("legacy-executable", content, 0100775)
+	b.Insert("link", target, 0120000)
+	b.Insert("submodule", submodule, 0160000)
+	b.Insert("go-executable", content, 0755)
+	b.Insert("go-link", target, os.ModeSymlink|0777)
+	b.Insert("go-submodule", submodule, os.ModeDir|os.ModeSymlink)
+	b.Insert("dir/regular", content, 0100644)
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	tree, err := r.Tree(h)
+	c.Assert(err, IsNil)
+
+	for i, t := range []struct {
+		path       string
+		executable bool
+		symlink    bool
+		submodule  bool
+	}{
+		{"regular", false, false, false},
+		{"executable", true, false, false},
+		{"legacy", false, false, false},
+		{"legacy-executable", true, false, false},
+		{"link", false, true, false},
+		{"submodule", false, false, true},
+		{"go-executable", true, false, false},
+		{"go-link", false, true, false},
+		{"go-submodule", false, false, true},
+		{"dir", false, false, false},
+	} {
+		com := Commentf("subtest %d, path=%s", i, t.path)
+		e, err := tree.FindEntry(t.path)
+		c.Assert(err, IsNil, com)
+		c.Assert(e.IsExecutable(), Equals, t.executable, com)
+		c.Assert(e.IsSymlink(), Equals, t.symlink, com)
+		c.Assert(e.IsSubmodule(), Equals, t.submodule, com)
+
+		if t.submodule || t.path == "dir" {
+			continue
+		}
+
+		f, err := tree.File(t.path)
+		c.Assert(err, IsNil, com)
+		c.Assert(f.IsExecutable(), Equals, t.executable, com)
+		c.Assert(f.IsSymlink(), Equals, t.symlink, com)
+		c.Assert(f.IsSubmodule(), Equals, false, com)
+
+		link, err := f.SymlinkTarget()
+		if !t.symlink {
+			c.Assert(err, Equals, ErrNotSymlink, com)
+			continue
+		}
+
+		c.Assert(err, IsNil, com)
+		c.Assert(link, Equals, "../bin/run", com)
+	}
+
+	// the Go modes used in memory, without encoding them
+	for _, e := range []TreeEntry{
+		{Mode: 0744},
+		{Mode: 0100744},
+	} {
+		c.Assert(e.IsExecutable(), Equals, true)
+	}
+
+	c.Assert((&TreeEntry{Mode: os.ModeNamedPipe | 0755}).IsExecutable(), Equals, false)
+}
+
+func (s *SuiteFile) TestIsBinary(c *C) {
+	for _, t := range []struct {
+		content string
+		binary  bool
+	}{
+		{"", false},
+		{"foo\nbar\n", false},
+		{"foo\x00bar", true},
+		{strings.Repeat("a", 7999) + "\x00", true},
+		{strings.Repeat("a", 8000) + "\x00", false},
+	} {
+		bin, err := newTestFile(t.content).IsBinary()
+		c.Assert(err, IsNil)
+		c.Assert(bin, Equals, t.binary, Commentf("len=%d", len(t.content)))
+	}
+}
@@ -0,0 +1,48 @@
+package bundle
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+const (
+	signatureV2 = "# v2 git bundle"
+	signatureV3 = "# v3 git bundle"
+
+	capabilityObjectFormat = "object-format"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the version of the
+	// bundle is not 2 or 3.
+	ErrUnsupportedVersion = errors.New("unsupported bundle version")
+	// ErrUnsupportedCapability is returned by Decode when the bundle has a
+	// capability other than object-format, like the filter of the partial
+	// bundles, since it can not be read without it.
+	ErrUnsupportedCapability = errors.New("unsupported bundle capability")
+	// ErrMalformedBundle is returned by Decode when the header is corrupted.
+	ErrMalformedBundle = errors.New("malformed bundle")
+)
+
+// Header is the header of a bundle, what the packfile following it has.
+type Header struct {
+	// Version is the version of the bundle, 2 or 3. It is only set by
+	// Decode, Encode writes the lowest version that can hold the header.
+	Version int
+	// ObjectFormat is the format of the hashes of the bundle.
+	ObjectFormat core.ObjectFormat
+	// Prerequisites are the commits the packfile needs, which are not in it.
+	Prerequisites []Prerequisite
+	// References are the references of the bundle, in the order they are
+	// written.
+	References []*core.Reference
+}
+
+// Prerequisite is a commit needed by the packfile of a bundle.
+type Prerequisite struct {
+	Hash core.Hash
+	// Comment is the text following the hash, the subject of the commit in
+	// the bundles written by git.
+	Comment string
+}
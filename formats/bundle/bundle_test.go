@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BundleSuite struct{}
+
+var _ = Suite(&BundleSuite{})
+
+// the bundles of fixtures/getbundles.bash
+const (
+	fixtureMaster = "c77bd98bad585a118ff5533819aa4d6e6970131e"
+	fixtureV1     = "736eb75d252c6de28dd61c15cce503b969012766"
+)
+
+func (s *BundleSuite) TestDecode(c *C) {
+	f, err := os.Open("fixtures/full.bundle")
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	d := NewDecoder(f)
+	var h Header
+	c.Assert(d.Decode(&h), IsNil)
+	c.Assert(h.Version, Equals, 2)
+	c.Assert(h.ObjectFormat, Equals, core.SHA1)
+	c.Assert(h.Prerequisites, HasLen, 0)
+	c.Assert(h.References, DeepEquals, []*core.Reference{
+		core.NewHashReference("refs/heads/master", core.NewHash(fixtureMaster)),
+		core.NewHashReference("refs/tags/v1", core.NewHash(fixtureV1)),
+	})
+
+	pack, err := ioutil.ReadAll(d.Packfile())
+	c.Assert(err, IsNil)
+	c.Assert(string(pack[:4]), Equals, "PACK")
+}
+
+func (s *BundleSuite) TestDecodePrerequisites(c *C) {
+	f, err := os.Open("fixtures/incremental.bundle")
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	var h Header
+	c.Assert(NewDecoder(f).Decode(&h), IsNil)
+	c.Assert(h.Prerequisites, DeepEquals, []Prerequisite{{Hash: core.NewHash(fixtureV1), Comment: "b"}})
+	c.Assert(h.References, HasLen, 1)
+}
+
+func (s *BundleSuite) TestDecodeErrors(c *C) {
+	for header, expected := range map[string]error{
+		"":                    ErrMalformedBundle,
+		"foo\n\n":             ErrMalformedBundle,
+		"# v4 git bundle\n\n": ErrUnsupportedVersion,
+		"# v2 git bundle\n":   ErrMalformedBundle,
+		"# v2 git bundle\n@object-format=sha1\n\n":         ErrMalformedBundle,
+		"# v3 git bundle\n@filter=blob:none\n\n":           ErrUnsupportedCapability,
+		"# v3 git bundle\n@object-format=md5\n\n":          core.ErrUnsupportedObjectFormat,
+		"# v2 git bundle\n" + fixtureMaster + "\n\n":       ErrMalformedBundle,
+		"# v2 git bundle\n-" + fixtureMaster[:39] + "\n\n": ErrMalformedBundle,
+	} {
+		var h Header
+		err := NewDecoder(strings.NewReader(header)).Decode(&h)
+		c.Assert(err, Equals, expected, Commentf("header=%q", header))
+	}
+}
+
+func (s *BundleSuite) TestEncode(c *C) {
+	expected, err := ioutil.ReadFile("fixtures/incremental.bundle")
+	c.Assert(err, IsNil)
+
+	h := &Header{
+		Prerequisites: []Prerequisite{{Hash: core.NewHash(fixtureV1), Comment: "b"}},
+		References:    []*core.Reference{core.NewHashReference("refs/heads/master", core.NewHash(fixtureMaster))},
+	}
+
+	var buf bytes.Buffer
+	n, err := NewEncoder(&buf).Encode(h)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, buf.Len())
+	c.Assert(buf.String(), Equals, string(expected[:n]))
+}
+
+func (s *BundleSuite) TestEncodeSHA256(c *C) {
+	hash := core.SHA256.ComputeHash(core.BlobObject, nil)
+	h := &Header{
+		ObjectFormat: core.SHA256,
+		References:   []*core.Reference{core.NewHashReference("refs/heads/master", hash)},
+	}
+
+	var buf bytes.Buffer
+	_, err := NewEncoder(&buf).Encode(h)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "# v3 git bundle\n@object-format=sha256\n"+hash.String()+" refs/heads/master\n\n")
+
+	var decoded Header
+	c.Assert(NewDecoder(&buf).Decode(&decoded), IsNil)
+	c.Assert(decoded.Version, Equals, 3)
+	c.Assert(decoded.ObjectFormat, Equals, core.SHA256)
+	c.Assert(decoded.References, DeepEquals, h.References)
+
+	h.Prerequisites = []Prerequisite{{Hash: core.NewHash(fixtureV1)}}
+	_, err = NewEncoder(&buf).Encode(h)
+	c.Assert(err, DeepEquals, &core.ErrObjectFormatMismatch{Expected: core.SHA256, Actual: core.SHA1})
+}
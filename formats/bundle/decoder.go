@@ -0,0 +1,146 @@
+package bundle
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// A Decoder reads and decodes the header of a bundle from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{bufio.NewReader(r)}
+}
+
+// Decode reads the header of the bundle from its input and stores it in the
+// value pointed to by h. The input is read up to the empty line ending the
+// header, the packfile is read from Packfile afterwards.
+func (d *Decoder) Decode(h *Header) error {
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	*h = Header{}
+	switch line {
+	case signatureV2:
+		h.Version = 2
+	case signatureV3:
+		h.Version = 3
+	default:
+		if strings.HasPrefix(line, "# v") && strings.HasSuffix(line, " git bundle") {
+			return ErrUnsupportedVersion
+		}
+
+		return ErrMalformedBundle
+	}
+
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "":
+			return nil
+		case line[0] == '@':
+			if h.Version < 3 || len(h.Prerequisites) != 0 || len(h.References) != 0 {
+				return ErrMalformedBundle
+			}
+
+			err = h.decodeCapability(line[1:])
+		case line[0] == '-':
+			err = h.decodePrerequisite(line[1:])
+		default:
+			err = h.decodeReference(line)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Packfile returns a reader for the packfile following the header, once it
+// has been decoded.
+func (d *Decoder) Packfile() io.Reader {
+	return d.r
+}
+
+// readLine returns the next line of the header, without its LF.
+// ErrMalformedBundle is returned if the input ends before the header does.
+func (d *Decoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF {
+		return "", ErrMalformedBundle
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return line[:len(line)-1], nil
+}
+
+func (h *Header) decodeCapability(line string) error {
+	parts := strings.SplitN(line, "=", 2)
+	if parts[0] != capabilityObjectFormat || len(parts) != 2 {
+		return ErrUnsupportedCapability
+	}
+
+	f, err := core.ParseObjectFormat(parts[1])
+	if err != nil {
+		return err
+	}
+
+	h.ObjectFormat = f
+	return nil
+}
+
+func (h *Header) decodePrerequisite(line string) error {
+	parts := strings.SplitN(line, " ", 2)
+	hash, err := h.decodeHash(parts[0])
+	if err != nil {
+		return err
+	}
+
+	p := Prerequisite{Hash: hash}
+	if len(parts) == 2 {
+		p.Comment = parts[1]
+	}
+
+	h.Prerequisites = append(h.Prerequisites, p)
+	return nil
+}
+
+func (h *Header) decodeReference(line string) error {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return ErrMalformedBundle
+	}
+
+	hash, err := h.decodeHash(parts[0])
+	if err != nil {
+		return err
+	}
+
+	h.References = append(h.References, core.NewHashReference(core.ReferenceName(parts[1]), hash))
+	return nil
+}
+
+// decodeHash returns the hash with the given hexadecimal representation,
+// which must be one of the format of the bundle.
+func (h *Header) decodeHash(s string) (core.Hash, error) {
+	if len(s) != h.ObjectFormat.HexSize() || !core.IsHashHex(s) {
+		return core.ZeroHash, ErrMalformedBundle
+	}
+
+	return core.NewHash(s), nil
+}
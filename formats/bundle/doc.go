@@ -0,0 +1,31 @@
+// Package bundle implements encoding and decoding of the header of bundle
+// files, the files git bundle create writes to move the objects and the
+// references of a repository without a connection to it, a header followed
+// by a packfile.
+/*
+== Version 2 and 3 bundle files have the following format:
+
+  - The signature line: "# v2 git bundle" or "# v3 git bundle".
+
+  - In version 3 only, the capability lines, "@" followed by the name of
+    the capability and optionally "=" and its value. The only capability
+    supported is object-format, with the name of the format of the hashes
+    of the bundle, sha1 if missing. Version 2 bundles are always sha1.
+
+  - The prerequisite lines, "-" followed by the hexadecimal hash of a
+    commit, a space and a comment, usually its subject. The prerequisites
+    are the commits the objects of the packfile need and are not in it, the
+    repository reading the bundle must have them.
+
+  - The reference lines, the hexadecimal hash of an object, a space and
+    the name of the reference pointing to it.
+
+  - An empty line, ending the header.
+
+  - The packfile, with the objects reachable from the references that are
+    not reachable from the prerequisites. Its deltas may have the objects
+    of the prerequisites as bases, as the ones of a thin pack.
+
+Every line but the empty one ends with a LF.
+*/
+package bundle
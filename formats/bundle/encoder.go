@@ -0,0 +1,52 @@
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// An Encoder writes the header of a bundle to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the header h, returning the number of bytes written. The
+// packfile is written to the output afterwards. Version 2 is written for
+// the SHA1 bundles and version 3, with the object-format capability, for
+// the other ones, as git does. A *core.ErrObjectFormatMismatch is returned
+// if a hash is not of the format of h.
+func (e *Encoder) Encode(h *Header) (int, error) {
+	var buf bytes.Buffer
+	if h.ObjectFormat == core.SHA1 {
+		fmt.Fprintf(&buf, "%s\n", signatureV2)
+	} else {
+		fmt.Fprintf(&buf, "%s\n@%s=%s\n", signatureV3, capabilityObjectFormat, h.ObjectFormat)
+	}
+
+	for _, p := range h.Prerequisites {
+		if err := core.CheckObjectFormat(h.ObjectFormat, p.Hash); err != nil {
+			return 0, err
+		}
+
+		fmt.Fprintf(&buf, "-%s %s\n", p.Hash, p.Comment)
+	}
+
+	for _, ref := range h.References {
+		if err := core.CheckObjectFormat(h.ObjectFormat, ref.Hash); err != nil {
+			return 0, err
+		}
+
+		fmt.Fprintf(&buf, "%s %s\n", ref.Hash, ref.Name)
+	}
+
+	buf.WriteByte('\n')
+	return e.w.Write(buf.Bytes())
+}
@@ -0,0 +1,40 @@
+#!/bin/bash
+
+# writes the bundles of a repository whose commits have fixed dates, so their
+# hashes are always the same: full.bundle, with the whole history of master
+# and a lightweight tag, and incremental.bundle, with the last commit of
+# master only, which has its parent as prerequisite.
+
+set -e
+
+dir=$(mktemp -d)
+trap "rm -rf ${dir}" EXIT
+
+export GIT_AUTHOR_NAME=foo GIT_AUTHOR_EMAIL=foo@bar.com
+export GIT_COMMITTER_NAME=foo GIT_COMMITTER_EMAIL=foo@bar.com
+
+n=0
+at() {
+    n=$((n+1))
+    export GIT_AUTHOR_DATE="@$((1500000000+n*60)) +0000"
+    export GIT_COMMITTER_DATE="${GIT_AUTHOR_DATE}"
+}
+
+commit() {
+    at
+    echo $1 > $1
+    git add $1
+    git commit -qm $1
+}
+
+pushd ${dir}
+git init -q -b master .
+commit a
+commit b
+git tag v1
+commit c
+git bundle create -q full.bundle master v1
+git bundle create -q incremental.bundle master~1..master
+popd
+
+cp ${dir}/full.bundle ${dir}/incremental.bundle .
@@ -0,0 +1,214 @@
+package commitgraph
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+const (
+	// VersionSupported is the only commit-graph version supported.
+	VersionSupported = 1
+
+	// GenerationMax is the greatest generation number that can be stored,
+	// the commits with greater ones are stored with it.
+	GenerationMax = 1<<30 - 1
+
+	hashVersion = 1 // SHA-1
+	parentNone  = 0x70000000
+	parentLast  = 1 << 31 // flag of the last parent of the edge list
+	hashSize    = 20
+	fanoutSize  = 256 * 4
+	commitSize  = hashSize + 16
+	headerSize  = 8
+	chunkSize   = 12 // of every entry of the chunk lookup table
+)
+
+var (
+	signature = []byte{'C', 'G', 'P', 'H'}
+
+	chunkFanout = [4]byte{'O', 'I', 'D', 'F'}
+	chunkLookup = [4]byte{'O', 'I', 'D', 'L'}
+	chunkData   = [4]byte{'C', 'D', 'A', 'T'}
+	chunkEdges  = [4]byte{'E', 'D', 'G', 'E'}
+)
+
+// ErrParentNotFound is returned by New when a parent of a commit is not one
+// of the commits, a commit-graph has every ancestor of its commits.
+var ErrParentNotFound = errors.New("parent of commit not found")
+
+// A CommitGraph represents a commit-graph file in memory: the commits it
+// has, sorted by hash, with the data needed to walk their history without
+// reading them.
+type CommitGraph struct {
+	Hashes  []core.Hash
+	Commits []Commit // of the commit with the same position in Hashes
+}
+
+// A Commit is the data of a commit of a CommitGraph.
+type Commit struct {
+	TreeHash core.Hash
+	// Parents are the positions of the parents of the commit in the
+	// CommitGraph, in order.
+	Parents []int
+	// Generation is one for the commits without parents, and one more than
+	// the greatest generation of its parents for the rest, so a commit is
+	// never an ancestor of another one with a lower generation, up to
+	// GenerationMax.
+	Generation uint32
+	// When is the committer date of the commit, in seconds.
+	When time.Time
+}
+
+// Node is a commit to add to a CommitGraph by New.
+type Node struct {
+	Hash         core.Hash
+	TreeHash     core.Hash
+	ParentHashes []core.Hash
+	When         time.Time
+}
+
+// New returns a CommitGraph with the given commits, computing their
+// generations. ErrParentNotFound is returned if a parent of a commit is not
+// one of them, and a *core.ErrObjectFormatMismatch if any hash is not a
+// core.SHA1 hash, the only format supported.
+func New(nodes []Node) (*CommitGraph, error) {
+	for _, n := range nodes {
+		if err := core.CheckObjectFormat(core.SHA1, n.Hash); err != nil {
+			return nil, err
+		}
+
+		if err := core.CheckObjectFormat(core.SHA1, n.TreeHash); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := make([]Node, 0, len(nodes))
+	sorted = append(sorted, nodes...)
+	sort.Sort(byHash(sorted))
+
+	g := &CommitGraph{}
+	for i, n := range sorted {
+		if i != 0 && sorted[i-1].Hash == n.Hash {
+			continue
+		}
+
+		g.Hashes = append(g.Hashes, n.Hash)
+	}
+
+	g.Commits = make([]Commit, 0, len(g.Hashes))
+	for i, n := range sorted {
+		if i != 0 && sorted[i-1].Hash == n.Hash {
+			continue
+		}
+
+		c := Commit{TreeHash: n.TreeHash, When: n.When}
+		for _, p := range n.ParentHashes {
+			pos, ok := g.Index(p)
+			if !ok {
+				return nil, ErrParentNotFound
+			}
+
+			c.Parents = append(c.Parents, pos)
+		}
+
+		g.Commits = append(g.Commits, c)
+	}
+
+	g.computeGenerations()
+	return g, nil
+}
+
+// computeGenerations sets the generations of the commits, walking the
+// parents of every commit before it, without recursion, as the histories
+// can be deep.
+func (g *CommitGraph) computeGenerations() {
+	var stack []int
+	for i := range g.Commits {
+		if g.Commits[i].Generation != 0 {
+			continue
+		}
+
+		stack = append(stack[:0], i)
+		for len(stack) != 0 {
+			c := &g.Commits[stack[len(stack)-1]]
+			var gen uint32
+			ready := true
+			for _, p := range c.Parents {
+				pg := g.Commits[p].Generation
+				if pg == 0 {
+					stack = append(stack, p)
+					ready = false
+				} else if pg > gen {
+					gen = pg
+				}
+			}
+
+			if !ready {
+				continue
+			}
+
+			stack = stack[:len(stack)-1]
+			if gen < GenerationMax {
+				gen++
+			}
+
+			c.Generation = gen
+		}
+	}
+}
+
+// Index returns the position of the commit with the given hash, and false if
+// the CommitGraph does not have it.
+func (g *CommitGraph) Index(h core.Hash) (int, bool) {
+	i := sort.Search(len(g.Hashes), func(i int) bool {
+		return bytes.Compare(g.Hashes[i][:], h[:]) >= 0
+	})
+
+	return i, i < len(g.Hashes) && g.Hashes[i] == h
+}
+
+// Commit returns the commit with the given hash, and false if the
+// CommitGraph does not have it.
+func (g *CommitGraph) Commit(h core.Hash) (*Commit, bool) {
+	i, ok := g.Index(h)
+	if !ok {
+		return nil, false
+	}
+
+	return &g.Commits[i], true
+}
+
+// ParentHashes returns the hashes of the parents of the commit with the
+// given position.
+func (g *CommitGraph) ParentHashes(i int) []core.Hash {
+	parents := g.Commits[i].Parents
+	hashes := make([]core.Hash, len(parents))
+	for j, p := range parents {
+		hashes[j] = g.Hashes[p]
+	}
+
+	return hashes
+}
+
+func (g *CommitGraph) fanout() [256]uint32 {
+	var fanout [256]uint32
+	for _, h := range g.Hashes {
+		fanout[h[0]]++
+	}
+
+	for i := 1; i < len(fanout); i++ {
+		fanout[i] += fanout[i-1]
+	}
+
+	return fanout
+}
+
+type byHash []Node
+
+func (s byHash) Len() int           { return len(s) }
+func (s byHash) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byHash) Less(i, j int) bool { return bytes.Compare(s[i].Hash[:], s[j].Hash[:]) < 0 }
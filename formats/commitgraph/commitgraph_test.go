@@ -0,0 +1,162 @@
+package commitgraph
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CommitGraphSuite struct{}
+
+var _ = Suite(&CommitGraphSuite{})
+
+// fixtureCommits are the commits of fixtures/commit-graph, see
+// fixtures/getcommitgraph.bash, newest first, with their tree, parents and
+// committer date.
+var fixtureCommits = [][]string{
+	{"e2ec6e93be3f31939070a17bb2de8e3f0a690021", "c198305ac198bbd8e7874bb904d240345c4e5883", "0c2c85a795a2a7ce269afa8880819b74f05759f8"},
+	{"0c2c85a795a2a7ce269afa8880819b74f05759f8", "3e6845f3bb019df0f9157ecffc65ce5e171c5c24", "313438ac4b1c8cbd4ffa61d91ebc510bcc508910", "c77bd98bad585a118ff5533819aa4d6e6970131e", "08efdab9c768d6b1d58fe937c3cc028e1022aa94", "ded734f7eea7de3a4f3c0fcbf2f14e8b71a31ebe"},
+	{"313438ac4b1c8cbd4ffa61d91ebc510bcc508910", "352d03485116d2daeb95fc4e2c5bcd388c195f5a", "736eb75d252c6de28dd61c15cce503b969012766"},
+	{"ded734f7eea7de3a4f3c0fcbf2f14e8b71a31ebe", "f4fbed2fceddf221fd9206f32f2d90fdb9e7fac8", "736eb75d252c6de28dd61c15cce503b969012766"},
+	{"08efdab9c768d6b1d58fe937c3cc028e1022aa94", "8637421956394f8ee950380d4c0d1b19fd121ce9", "736eb75d252c6de28dd61c15cce503b969012766"},
+	{"c77bd98bad585a118ff5533819aa4d6e6970131e", "04a59185a0c5f4047e4fd3fa87b0c84e671b00ee", "736eb75d252c6de28dd61c15cce503b969012766"},
+	{"736eb75d252c6de28dd61c15cce503b969012766", "3683f870be446c7cc05ffaef9fa06415276e1828", "c903e603038308c2a425b0126f16a7351f2de623"},
+	{"c903e603038308c2a425b0126f16a7351f2de623", "aaff74984cccd156a469afa7d9ab10e4777beb24"},
+}
+
+func fixtureNodes() []Node {
+	var nodes []Node
+	for i, c := range fixtureCommits {
+		n := Node{
+			Hash:     core.NewHash(c[0]),
+			TreeHash: core.NewHash(c[1]),
+			When:     time.Unix(int64(1500000000+(len(fixtureCommits)-i)*60), 0),
+		}
+
+		for _, p := range c[2:] {
+			n.ParentHashes = append(n.ParentHashes, core.NewHash(p))
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	return nodes
+}
+
+func (s *CommitGraphSuite) TestDecode(c *C) {
+	data, err := ioutil.ReadFile("fixtures/commit-graph")
+	c.Assert(err, IsNil)
+
+	g := &CommitGraph{}
+	c.Assert(NewDecoder(bytes.NewReader(data)).Decode(g), IsNil)
+	c.Assert(g.Hashes, HasLen, len(fixtureCommits))
+
+	generations := map[string]uint32{
+		"e2ec6e93be3f31939070a17bb2de8e3f0a690021": 5,
+		"0c2c85a795a2a7ce269afa8880819b74f05759f8": 4,
+		"736eb75d252c6de28dd61c15cce503b969012766": 2,
+		"c903e603038308c2a425b0126f16a7351f2de623": 1,
+	}
+
+	for _, n := range fixtureNodes() {
+		i, ok := g.Index(n.Hash)
+		c.Assert(ok, Equals, true, Commentf("hash=%s", n.Hash))
+
+		commit := g.Commits[i]
+		c.Assert(commit.TreeHash, Equals, n.TreeHash)
+		c.Assert(commit.When.Equal(n.When), Equals, true)
+		c.Assert(g.ParentHashes(i), DeepEquals, append([]core.Hash{}, n.ParentHashes...))
+
+		if gen, ok := generations[n.Hash.String()]; ok {
+			c.Assert(commit.Generation, Equals, gen, Commentf("hash=%s", n.Hash))
+		}
+	}
+
+	_, ok := g.Commit(core.NewHash("aaff74984cccd156a469afa7d9ab10e4777beb24"))
+	c.Assert(ok, Equals, false)
+}
+
+func (s *CommitGraphSuite) TestNew(c *C) {
+	data, err := ioutil.ReadFile("fixtures/commit-graph")
+	c.Assert(err, IsNil)
+
+	expected := &CommitGraph{}
+	c.Assert(NewDecoder(bytes.NewReader(data)).Decode(expected), IsNil)
+
+	nodes := fixtureNodes()
+	g, err := New(append(nodes, nodes[0]))
+	c.Assert(err, IsNil)
+	c.Assert(g.Hashes, DeepEquals, expected.Hashes)
+	for i := range g.Commits {
+		c.Assert(g.Commits[i].TreeHash, Equals, expected.Commits[i].TreeHash)
+		c.Assert(g.Commits[i].Parents, DeepEquals, expected.Commits[i].Parents)
+		c.Assert(g.Commits[i].Generation, Equals, expected.Commits[i].Generation)
+		c.Assert(g.Commits[i].When.Equal(expected.Commits[i].When), Equals, true)
+	}
+}
+
+func (s *CommitGraphSuite) TestNewParentNotFound(c *C) {
+	_, err := New(fixtureNodes()[:2])
+	c.Assert(err, Equals, ErrParentNotFound)
+}
+
+func (s *CommitGraphSuite) TestEncode(c *C) {
+	g, err := New(fixtureNodes())
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	n, err := NewEncoder(buf).Encode(g)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, buf.Len())
+
+	// the edge list is written for the octopus merge
+	c.Assert(bytes.Contains(buf.Bytes(), chunkEdges[:]), Equals, true)
+
+	decoded := &CommitGraph{}
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Hashes, DeepEquals, g.Hashes)
+	for i := range g.Commits {
+		c.Assert(decoded.Commits[i].TreeHash, Equals, g.Commits[i].TreeHash)
+		c.Assert(decoded.Commits[i].Parents, DeepEquals, g.Commits[i].Parents)
+		c.Assert(decoded.Commits[i].Generation, Equals, g.Commits[i].Generation)
+		c.Assert(decoded.Commits[i].When.Equal(g.Commits[i].When), Equals, true)
+	}
+}
+
+func (s *CommitGraphSuite) TestEncodeEmpty(c *C) {
+	buf := bytes.NewBuffer(nil)
+	_, err := NewEncoder(buf).Encode(&CommitGraph{})
+	c.Assert(err, IsNil)
+
+	g := &CommitGraph{}
+	c.Assert(NewDecoder(buf).Decode(g), IsNil)
+	c.Assert(g.Hashes, HasLen, 0)
+}
+
+func (s *CommitGraphSuite) TestDecodeMalformed(c *C) {
+	data, err := ioutil.ReadFile("fixtures/commit-graph")
+	c.Assert(err, IsNil)
+
+	for _, corrupt := range []func([]byte) []byte{
+		func(d []byte) []byte { return d[:len(d)-1] },
+		func(d []byte) []byte { d[0] = 'X'; return d },
+		func(d []byte) []byte { d[len(d)/2]++; return d },
+		func(d []byte) []byte { return nil },
+	} {
+		copied := append([]byte{}, data...)
+		err := NewDecoder(bytes.NewReader(corrupt(copied))).Decode(&CommitGraph{})
+		c.Assert(err, Equals, ErrMalformedCommitGraph)
+	}
+
+	copied := append([]byte{}, data...)
+	copied[4] = 2
+	err = NewDecoder(bytes.NewReader(copied)).Decode(&CommitGraph{})
+	c.Assert(err, Equals, ErrUnsupportedVersion)
+}
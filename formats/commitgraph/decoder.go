@@ -0,0 +1,193 @@
+package commitgraph
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the commit-graph
+	// version, or the version of its hashes, is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported commit-graph version")
+	// ErrMalformedCommitGraph is returned by Decode when the commit-graph
+	// is corrupted.
+	ErrMalformedCommitGraph = errors.New("malformed commit-graph file")
+)
+
+// A Decoder reads and decodes commit-graph files from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r}
+}
+
+// Decode reads the whole commit-graph file from its input and stores it in
+// the value pointed to by g. The checksum of the file is checked, and the
+// chunks not needed to walk the commits, like the ones of the newer
+// versions of git, are skipped.
+func (d *Decoder) Decode(g *CommitGraph) error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < headerSize+chunkSize+hashSize || !bytes.Equal(data[:4], signature) {
+		return ErrMalformedCommitGraph
+	}
+
+	if data[4] != VersionSupported || data[5] != hashVersion {
+		return ErrUnsupportedVersion
+	}
+
+	body := data[:len(data)-hashSize]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return ErrMalformedCommitGraph
+	}
+
+	chunks, err := readChunks(body, int(data[6]))
+	if err != nil {
+		return err
+	}
+
+	return decodeChunks(g, chunks)
+}
+
+// readChunks returns the content of every chunk of the lookup table.
+func readChunks(data []byte, count int) (map[[4]byte][]byte, error) {
+	if len(data) < headerSize+(count+1)*chunkSize {
+		return nil, ErrMalformedCommitGraph
+	}
+
+	chunks := make(map[[4]byte][]byte, count)
+	table := data[headerSize:]
+	for i := 0; i < count; i++ {
+		var id [4]byte
+		copy(id[:], table[i*chunkSize:])
+		start := binary.BigEndian.Uint64(table[i*chunkSize+4:])
+		end := binary.BigEndian.Uint64(table[(i+1)*chunkSize+4:])
+		if start > end || end > uint64(len(data)) {
+			return nil, ErrMalformedCommitGraph
+		}
+
+		chunks[id] = data[start:end]
+	}
+
+	return chunks, nil
+}
+
+func decodeChunks(g *CommitGraph, chunks map[[4]byte][]byte) error {
+	fanout, lookup, commits := chunks[chunkFanout], chunks[chunkLookup], chunks[chunkData]
+	if len(fanout) != fanoutSize || len(lookup)%hashSize != 0 {
+		return ErrMalformedCommitGraph
+	}
+
+	count := len(lookup) / hashSize
+	if len(commits) != count*commitSize ||
+		binary.BigEndian.Uint32(fanout[fanoutSize-4:]) != uint32(count) {
+		return ErrMalformedCommitGraph
+	}
+
+	g.Hashes = make([]core.Hash, count)
+	for i := range g.Hashes {
+		g.Hashes[i] = core.NewHashFromBytes(core.SHA1, lookup[i*hashSize:(i+1)*hashSize])
+	}
+
+	if !g.isValid(fanout) {
+		return ErrMalformedCommitGraph
+	}
+
+	g.Commits = make([]Commit, count)
+	for i := range g.Commits {
+		if err := g.decodeCommit(i, commits[i*commitSize:], chunks[chunkEdges]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isValid checks that the hashes are sorted and the fanout matches them.
+func (g *CommitGraph) isValid(fanout []byte) bool {
+	for i := 1; i < len(g.Hashes); i++ {
+		if bytes.Compare(g.Hashes[i-1][:], g.Hashes[i][:]) >= 0 {
+			return false
+		}
+	}
+
+	for i, c := range g.fanout() {
+		if binary.BigEndian.Uint32(fanout[i*4:]) != c {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeCommit decodes the commit with the given position from its entry of
+// the commit data chunk: its tree, its first two parents, its generation and
+// committer date, and the edge list with the rest of the parents, if any.
+func (g *CommitGraph) decodeCommit(i int, data, edges []byte) error {
+	c := &g.Commits[i]
+	c.TreeHash = core.NewHashFromBytes(core.SHA1, data[:hashSize])
+
+	parents := []uint32{
+		binary.BigEndian.Uint32(data[hashSize:]),
+		binary.BigEndian.Uint32(data[hashSize+4:]),
+	}
+
+	if parents[1]&parentLast != 0 {
+		var err error
+		if parents, err = readEdges(parents[0], parents[1]&^parentLast, edges); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range parents {
+		if p == parentNone {
+			break
+		}
+
+		if p >= uint32(len(g.Hashes)) {
+			return ErrMalformedCommitGraph
+		}
+
+		c.Parents = append(c.Parents, int(p))
+	}
+
+	genAndTime := binary.BigEndian.Uint32(data[hashSize+8:])
+	c.Generation = genAndTime >> 2
+	seconds := int64(genAndTime&3)<<32 | int64(binary.BigEndian.Uint32(data[hashSize+12:]))
+	c.When = time.Unix(seconds, 0)
+
+	return nil
+}
+
+// readEdges returns the parents of an octopus merge, the first one and the
+// ones of the edge list from the given position to the one flagged as the
+// last.
+func readEdges(first, pos uint32, edges []byte) ([]uint32, error) {
+	parents := []uint32{first}
+	for {
+		if int(pos)*4+4 > len(edges) {
+			return nil, ErrMalformedCommitGraph
+		}
+
+		p := binary.BigEndian.Uint32(edges[pos*4:])
+		parents = append(parents, p&^parentLast)
+		if p&parentLast != 0 {
+			return parents, nil
+		}
+
+		pos++
+	}
+}
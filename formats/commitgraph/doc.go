@@ -0,0 +1,43 @@
+// Package commitgraph implements encoding and decoding of commit-graph
+// files, the objects/info/commit-graph file git writes with git
+// commit-graph write, which has the parents, the tree, the generation
+// number and the committer date of the commits of a repository, so their
+// history can be walked without reading them.
+/*
+== Version 1 commit-graph files have the following format:
+
+  - A 8-byte header: the signature "CGPH", the version, 1, the version of
+    the hashes, 1 for SHA-1, the number of chunks C and the number of base
+    commit-graph files, 0.
+
+  - The chunk lookup table, of C+1 12-byte entries: the 4-byte identifier
+    of a chunk and the 8-byte network byte order offset of its content from
+    the beginning of the file. The last entry has an identifier of zeros
+    and the offset of the end of the last chunk.
+
+  - The content of the chunks:
+
+    OIDF, the fanout: 256 4-byte network byte order integers, the N-th one
+    the number of commits whose hash first byte is less than or equal to N.
+
+    OIDL, the lookup: the sorted 20-byte hashes of the commits.
+
+    CDAT, the commit data: one 36-byte entry per commit, in the order of
+    the lookup. The 20-byte hash of its tree, the 4-byte positions of its
+    first two parents, 0x70000000 if there is none, and 8 bytes with its
+    generation, the 30 most significant bits, and its committer date, in
+    seconds, the 34 least significant bits. If the commit has more than
+    two parents, its second parent is the position in the edge list of the
+    rest, with the most significant bit set.
+
+    EDGE, the edge list: the 4-byte positions of the parents of the
+    commits with more than two parents but their first one, the last
+    parent of every commit with the most significant bit set. The chunk is
+    only written if there are such commits.
+
+    Any other chunk, like the ones of the newer versions of git, is
+    skipped.
+
+  - A trailer with the 20-byte SHA-1 checksum of all of the above.
+*/
+package commitgraph
@@ -0,0 +1,107 @@
+package commitgraph
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+)
+
+// An Encoder writes commit-graph files to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the commit-graph file of g, with the fanout, lookup and
+// commit data chunks, and the edge list chunk if there are commits with more
+// than two parents, returning the number of bytes written. The hashes of g
+// must be sorted, as New sorts them.
+func (e *Encoder) Encode(g *CommitGraph) (int, error) {
+	data, edges := g.encodeCommits()
+
+	var fanout bytes.Buffer
+	for _, c := range g.fanout() {
+		binary.Write(&fanout, binary.BigEndian, c)
+	}
+
+	lookup := make([]byte, 0, len(g.Hashes)*hashSize)
+	for _, h := range g.Hashes {
+		lookup = append(lookup, h.Bytes()...)
+	}
+
+	ids := [][4]byte{chunkFanout, chunkLookup, chunkData}
+	chunks := [][]byte{fanout.Bytes(), lookup, data}
+	if len(edges) != 0 {
+		ids = append(ids, chunkEdges)
+		chunks = append(chunks, edges)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(signature)
+	buf.Write([]byte{VersionSupported, hashVersion, byte(len(chunks)), 0})
+
+	offset := uint64(headerSize + (len(chunks)+1)*chunkSize)
+	for i, id := range append(ids, [4]byte{}) {
+		buf.Write(id[:])
+		binary.Write(&buf, binary.BigEndian, offset)
+		if i < len(chunks) {
+			offset += uint64(len(chunks[i]))
+		}
+	}
+
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+
+	return e.w.Write(buf.Bytes())
+}
+
+// encodeCommits returns the commit data and the edge list chunks.
+func (g *CommitGraph) encodeCommits() (data, edges []byte) {
+	data = make([]byte, 0, len(g.Commits)*commitSize)
+	var entry [commitSize]byte
+	for _, c := range g.Commits {
+		copy(entry[:], c.TreeHash.Bytes())
+
+		parents := [2]uint32{parentNone, parentNone}
+		for i := 0; i < len(c.Parents) && i < 2; i++ {
+			parents[i] = uint32(c.Parents[i])
+		}
+
+		if len(c.Parents) > 2 {
+			parents[1] = parentLast | uint32(len(edges)/4)
+			for i, p := range c.Parents[1:] {
+				v := uint32(p)
+				if i == len(c.Parents)-2 {
+					v |= parentLast
+				}
+
+				edges = append(edges, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			}
+		}
+
+		binary.BigEndian.PutUint32(entry[hashSize:], parents[0])
+		binary.BigEndian.PutUint32(entry[hashSize+4:], parents[1])
+
+		gen := c.Generation
+		if gen > GenerationMax {
+			gen = GenerationMax
+		}
+
+		seconds := uint64(c.When.Unix())
+		binary.BigEndian.PutUint32(entry[hashSize+8:], gen<<2|uint32(seconds>>32)&3)
+		binary.BigEndian.PutUint32(entry[hashSize+12:], uint32(seconds))
+
+		data = append(data, entry[:]...)
+	}
+
+	return data, edges
+}
@@ -0,0 +1,46 @@
+#!/bin/bash
+
+# writes the commit-graph file of a repository with an octopus merge, whose
+# commits have fixed dates, so their hashes are always the same.
+
+set -e
+
+dir=$(mktemp -d)
+trap "rm -rf ${dir}" EXIT
+
+export GIT_AUTHOR_NAME=foo GIT_AUTHOR_EMAIL=foo@bar.com
+export GIT_COMMITTER_NAME=foo GIT_COMMITTER_EMAIL=foo@bar.com
+
+n=0
+at() {
+    n=$((n+1))
+    export GIT_AUTHOR_DATE="@$((1500000000+n*60)) +0000"
+    export GIT_COMMITTER_DATE="${GIT_AUTHOR_DATE}"
+}
+
+commit() {
+    at
+    echo $1 > $1
+    git add $1
+    git commit -qm $1
+}
+
+pushd ${dir}
+git init -q -b master .
+commit a
+commit b
+git checkout -qb x
+commit c
+git checkout -qb y master
+commit d
+git checkout -qb z master
+commit e
+git checkout -q master
+commit f
+at
+git merge -q --no-edit -m octopus x y z
+commit g
+git commit-graph write --reachable
+popd
+
+cp ${dir}/.git/objects/info/commit-graph ./commit-graph
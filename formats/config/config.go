@@ -0,0 +1,479 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	includeSection = "include"
+	includePathKey = "path"
+)
+
+// ErrSyntax is returned by Decode when a line of the config file is not
+// valid.
+type ErrSyntax struct {
+	Line int
+}
+
+func (e *ErrSyntax) Error() string {
+	return fmt.Sprintf("bad config line %d", e.Line)
+}
+
+// ErrInvalidValue is returned by the typed accessors of Config when the
+// value of an option is not of their type.
+type ErrInvalidValue struct {
+	// Name is the full name of the option, as "core.bare".
+	Name  string
+	Value string
+}
+
+func (e *ErrInvalidValue) Error() string {
+	return fmt.Sprintf("bad config value %q for %s", e.Value, e.Name)
+}
+
+// Config is a config file, its sections and its comments, in order, so it
+// is encoded as it was decoded, byte for byte, but for the sections and
+// options changed.
+type Config struct {
+	// Comments are the comment and empty lines before the first section,
+	// without their LF.
+	Comments []string
+	Sections []*Section
+
+	// the text of the comments, sections and options decoded, and of the
+	// whitespace at the end of the file, see Encoder.Encode
+	rawComments []rawLine
+	rawSections map[*Section]rawSection
+	rawOptions  map[*Option]rawOption
+	rawTrailing string
+}
+
+// rawLine is the text of a comment line, with its LF, and the comment as it
+// was decoded.
+type rawLine struct {
+	text, comment string
+}
+
+// rawSection is the text of a section header, up to the end of its line or
+// its first option, and its name, subsection and comment as they were
+// decoded.
+type rawSection struct {
+	text                      string
+	name, subsection, comment string
+}
+
+// rawOption is the text of an option, or comment line, with all its lines,
+// and the option as it was decoded. inline tells whether it follows the
+// header of its section in the same line.
+type rawOption struct {
+	text   string
+	opt    Option
+	inline bool
+}
+
+// rawSection returns the text of the given section header as it was
+// decoded, or false if it was not decoded or it changed since then.
+func (c *Config) rawSection(s *Section) (string, bool) {
+	r, ok := c.rawSections[s]
+	if !ok || r.name != s.Name || r.subsection != s.Subsection || r.comment != s.Comment {
+		return "", false
+	}
+
+	return r.text, true
+}
+
+// rawOption returns the text of the given option as it was decoded, or
+// false if it was not decoded or it changed since then, or it followed the
+// header of its section, which is not written as it was decoded.
+func (c *Config) rawOption(o *Option, rawHeader bool) (string, bool) {
+	r, ok := c.rawOptions[o]
+	if !ok || r.opt != *o || r.inline && !rawHeader {
+		return "", false
+	}
+
+	return r.text, true
+}
+
+// rawCommentLines returns the text of the comment lines before the first
+// section as it was decoded, or false if they changed since then.
+func (c *Config) rawCommentLines() (string, bool) {
+	if len(c.rawComments) != len(c.Comments) {
+		return "", false
+	}
+
+	var text string
+	for i, r := range c.rawComments {
+		if r.comment != c.Comments[i] {
+			return "", false
+		}
+
+		text += r.text
+	}
+
+	return text, true
+}
+
+// Section is a section of a config file, with the options following its
+// header.
+type Section struct {
+	// Name is the name of the section, in lowercase.
+	Name string
+	// Subsection is the subsection, empty if there is none.
+	Subsection string
+	// Comment is the comment following the header, with its "#" or ";".
+	Comment string
+	// Options are the options of the section, along with the comment and
+	// empty lines in between, in order.
+	Options []*Option
+
+	// included tells whether the section comes from an included file, so it
+	// is not encoded.
+	included bool
+}
+
+// Option is an option of a section, or a comment or empty line when Key is
+// empty.
+type Option struct {
+	// Key is the key of the option, in lowercase.
+	Key string
+	// Value is the value, unquoted and unescaped.
+	Value string
+	// NoValue tells whether the key has no "=", a boolean true.
+	NoValue bool
+	// Comment is the comment following the option, with its "#" or ";", or
+	// the whole line if Key is empty.
+	Comment string
+}
+
+// New returns a new empty Config.
+func New() *Config {
+	return &Config{}
+}
+
+// Included returns true if the section comes from a file included by the
+// config, see ResolveIncludes.
+func (s *Section) Included() bool {
+	return s.included
+}
+
+func (s *Section) is(name, subsection string) bool {
+	return s.Name == strings.ToLower(name) && s.Subsection == subsection
+}
+
+// options returns the options with the given key of the sections with the
+// given name and subsection, in order.
+func (c *Config) options(section, subsection, key string) []*Option {
+	key = strings.ToLower(key)
+
+	var opts []*Option
+	for _, s := range c.Sections {
+		if !s.is(section, subsection) {
+			continue
+		}
+
+		for _, o := range s.Options {
+			if o.Key == key {
+				opts = append(opts, o)
+			}
+		}
+	}
+
+	return opts
+}
+
+// HasSection returns true if the config has a section with the given name
+// and subsection.
+func (c *Config) HasSection(section, subsection string) bool {
+	for _, s := range c.Sections {
+		if s.is(section, subsection) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subsections returns the subsections of the sections with the given name,
+// without duplicates, in the order they first appear, as the names of the
+// remotes of the remote sections.
+func (c *Config) Subsections(section string) []string {
+	var subsections []string
+	seen := make(map[string]bool)
+	for _, s := range c.Sections {
+		if s.Name != strings.ToLower(section) || s.Subsection == "" || seen[s.Subsection] {
+			continue
+		}
+
+		seen[s.Subsection] = true
+		subsections = append(subsections, s.Subsection)
+	}
+
+	return subsections
+}
+
+// Value returns the value of the option with the given key, the last one if
+// it has several, and whether there is such option. An empty subsection
+// looks at the sections without one.
+func (c *Config) Value(section, subsection, key string) (string, bool) {
+	opts := c.options(section, subsection, key)
+	if len(opts) == 0 {
+		return "", false
+	}
+
+	return opts[len(opts)-1].Value, true
+}
+
+// String returns the value of the option with the given key, the last one
+// if it has several, or an empty string if there is no such option.
+func (c *Config) String(section, subsection, key string) string {
+	v, _ := c.Value(section, subsection, key)
+	return v
+}
+
+// Strings returns the values of the option with the given key, in order,
+// for the options with several values.
+func (c *Config) Strings(section, subsection, key string) []string {
+	var values []string
+	for _, o := range c.options(section, subsection, key) {
+		values = append(values, o.Value)
+	}
+
+	return values
+}
+
+// Bool returns the value of the option with the given key as a boolean, def
+// if there is no such option. As in git, true, yes, on and the keys without
+// value are true, false, no, off and the empty values are false, and the
+// integers are true unless they are zero. A *ErrInvalidValue is returned for
+// the other values.
+func (c *Config) Bool(section, subsection, key string, def bool) (bool, error) {
+	opts := c.options(section, subsection, key)
+	if len(opts) == 0 {
+		return def, nil
+	}
+
+	o := opts[len(opts)-1]
+	if o.NoValue {
+		return true, nil
+	}
+
+	switch strings.ToLower(o.Value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+
+	i, err := parseInt(o.Value)
+	if err != nil {
+		return false, &ErrInvalidValue{Name: optionName(section, subsection, key), Value: o.Value}
+	}
+
+	return i != 0, nil
+}
+
+// Int returns the value of the option with the given key as an integer, def
+// if there is no such option. As in git, the value may have a k, m or g
+// suffix, for 1024, 1024^2 and 1024^3. A *ErrInvalidValue is returned if it
+// is not an integer.
+func (c *Config) Int(section, subsection, key string, def int64) (int64, error) {
+	v, ok := c.Value(section, subsection, key)
+	if !ok {
+		return def, nil
+	}
+
+	i, err := parseInt(v)
+	if err != nil {
+		return 0, &ErrInvalidValue{Name: optionName(section, subsection, key), Value: v}
+	}
+
+	return i, nil
+}
+
+func parseInt(v string) (int64, error) {
+	var unit int64 = 1
+	if v != "" {
+		switch strings.ToLower(v[len(v)-1:]) {
+		case "k":
+			unit = 1 << 10
+		case "m":
+			unit = 1 << 20
+		case "g":
+			unit = 1 << 30
+		}
+	}
+
+	if unit != 1 {
+		v = v[:len(v)-1]
+	}
+
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if i > 0 && i > (1<<63-1)/unit || i < 0 && i < (-1<<63)/unit {
+		return 0, strconv.ErrRange
+	}
+
+	return i * unit, nil
+}
+
+func optionName(section, subsection, key string) string {
+	if subsection == "" {
+		return strings.ToLower(section + "." + key)
+	}
+
+	return strings.ToLower(section) + "." + subsection + "." + strings.ToLower(key)
+}
+
+// Set sets the value of the option with the given key, replacing all its
+// values. The option is set in the last section with the given name and
+// subsection, which is added if there is none. The sections of included
+// files are never changed.
+func (c *Config) Set(section, subsection, key, value string) {
+	key = strings.ToLower(key)
+
+	var last *Option
+	for _, s := range c.Sections {
+		if s.included || !s.is(section, subsection) {
+			continue
+		}
+
+		for _, o := range s.Options {
+			if o.Key == key {
+				last = o
+			}
+		}
+	}
+
+	if last == nil {
+		c.Add(section, subsection, key, value)
+		return
+	}
+
+	for _, s := range c.Sections {
+		if !s.included && s.is(section, subsection) {
+			s.removeOptions(func(o *Option) bool { return o.Key == key && o != last })
+		}
+	}
+
+	last.Value = value
+	last.NoValue = false
+}
+
+// Add adds a value to the option with the given key, after its other
+// values, for the options with several values. The option is added to the
+// last section with the given name and subsection, which is added if there
+// is none.
+func (c *Config) Add(section, subsection, key, value string) {
+	s := c.section(section, subsection)
+	o := &Option{Key: strings.ToLower(key), Value: value}
+
+	// the option is added before the trailing comments and empty lines,
+	// which usually precede the next section
+	i := len(s.Options)
+	for i > 0 && s.Options[i-1].Key == "" {
+		i--
+	}
+
+	s.Options = append(s.Options, nil)
+	copy(s.Options[i+1:], s.Options[i:])
+	s.Options[i] = o
+}
+
+// section returns the last section, not included, with the given name and
+// subsection, adding it if there is none.
+func (c *Config) section(name, subsection string) *Section {
+	for i := len(c.Sections) - 1; i >= 0; i-- {
+		if s := c.Sections[i]; !s.included && s.is(name, subsection) {
+			return s
+		}
+	}
+
+	s := &Section{Name: strings.ToLower(name), Subsection: subsection}
+	c.Sections = append(c.Sections, s)
+	return s
+}
+
+// Unset removes all the values of the option with the given key, in the
+// sections that are not included.
+func (c *Config) Unset(section, subsection, key string) {
+	key = strings.ToLower(key)
+	for _, s := range c.Sections {
+		if !s.included && s.is(section, subsection) {
+			s.removeOptions(func(o *Option) bool { return o.Key == key })
+		}
+	}
+}
+
+// RemoveSection removes the sections, not included, with the given name and
+// subsection, along with their options.
+func (c *Config) RemoveSection(section, subsection string) {
+	sections := c.Sections[:0]
+	for _, s := range c.Sections {
+		if s.included || !s.is(section, subsection) {
+			sections = append(sections, s)
+		}
+	}
+
+	for i := len(sections); i < len(c.Sections); i++ {
+		c.Sections[i] = nil
+	}
+
+	c.Sections = sections
+}
+
+func (s *Section) removeOptions(remove func(*Option) bool) {
+	opts := s.Options[:0]
+	for _, o := range s.Options {
+		if !remove(o) {
+			opts = append(opts, o)
+		}
+	}
+
+	for i := len(opts); i < len(s.Options); i++ {
+		s.Options[i] = nil
+	}
+
+	s.Options = opts
+}
+
+// ResolveIncludes inserts the sections of the files named by the path
+// options of the include sections after each of them, so their options are
+// read as if they were at the place of the include section, as git does.
+// They are marked as included, see Section.Included, so they are not
+// encoded. The included files are read by load, given the paths as they
+// are, which must resolve their own includes; an include section with a
+// path to a file that is not found should be given an empty config, as git
+// ignores them.
+func (c *Config) ResolveIncludes(load func(path string) (*Config, error)) error {
+	var sections []*Section
+	for _, s := range c.Sections {
+		sections = append(sections, s)
+		if s.included || !s.is(includeSection, "") {
+			continue
+		}
+
+		for _, o := range s.Options {
+			if o.Key != includePathKey || o.Value == "" {
+				continue
+			}
+
+			included, err := load(o.Value)
+			if err != nil {
+				return err
+			}
+
+			for _, is := range included.Sections {
+				is.included = true
+				sections = append(sections, is)
+			}
+		}
+	}
+
+	c.Sections = sections
+	return nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct{}
+
+var _ = Suite(&ConfigSuite{})
+
+func decode(c *C, input string) *Config {
+	cfg := New()
+	c.Assert(NewDecoder(strings.NewReader(input)).Decode(cfg), IsNil)
+	return cfg
+}
+
+func encode(c *C, cfg *Config) string {
+	var buf bytes.Buffer
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	return buf.String()
+}
+
+func (s *ConfigSuite) TestValues(c *C) {
+	cfg := decode(c, testConfig)
+
+	v, ok := cfg.Value("CORE", "", "RepositoryFormatVersion")
+	c.Assert(ok, Equals, true)
+	c.Assert(v, Equals, "0")
+	_, ok = cfg.Value("core", "", "foo")
+	c.Assert(ok, Equals, false)
+	c.Assert(cfg.String("branch", "master", "remote"), Equals, "")
+	c.Assert(cfg.String("branch", "Master", "remote"), Equals, "origin")
+
+	c.Assert(cfg.Strings("remote", "origin", "fetch"), DeepEquals, []string{
+		"+refs/heads/*:refs/remotes/origin/*",
+		"+refs/tags/*:refs/tags/*",
+	})
+
+	c.Assert(cfg.HasSection("remote", "origin"), Equals, true)
+	c.Assert(cfg.HasSection("remote", ""), Equals, false)
+	c.Assert(cfg.Subsections("branch"), DeepEquals, []string{"Master", "legacy"})
+}
+
+func (s *ConfigSuite) TestBool(c *C) {
+	cfg := decode(c, "[a]\n"+
+		"t1 = true\nt2 = Yes\nt3 = on\nt4 = 1\nt5\nt6 = 1k\n"+
+		"f1 = false\nf2 = NO\nf3 = off\nf4 = 0\nf5 =\n"+
+		"bad = foo\n")
+
+	for _, key := range []string{"t1", "t2", "t3", "t4", "t5", "t6"} {
+		v, err := cfg.Bool("a", "", key, false)
+		c.Assert(err, IsNil)
+		c.Assert(v, Equals, true, Commentf("key=%s", key))
+	}
+
+	for _, key := range []string{"f1", "f2", "f3", "f4", "f5"} {
+		v, err := cfg.Bool("a", "", key, true)
+		c.Assert(err, IsNil)
+		c.Assert(v, Equals, false, Commentf("key=%s", key))
+	}
+
+	v, err := cfg.Bool("a", "", "missing", true)
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, true)
+
+	_, err = cfg.Bool("a", "", "bad", false)
+	c.Assert(err, DeepEquals, &ErrInvalidValue{Name: "a.bad", Value: "foo"})
+	c.Assert(err.Error(), Equals, `bad config value "foo" for a.bad`)
+}
+
+func (s *ConfigSuite) TestInt(c *C) {
+	cfg := decode(c, "[a \"B\"]\n"+
+		"i = -12\nk = 2k\nm = 3M\ng = 1g\nbad = 1x\nbig = 9007199254740992g\n")
+
+	for key, expected := range map[string]int64{
+		"i": -12, "k": 2 << 10, "m": 3 << 20, "g": 1 << 30, "missing": 7,
+	} {
+		v, err := cfg.Int("a", "B", key, 7)
+		c.Assert(err, IsNil)
+		c.Assert(v, Equals, expected, Commentf("key=%s", key))
+	}
+
+	_, err := cfg.Int("a", "B", "bad", 0)
+	c.Assert(err, DeepEquals, &ErrInvalidValue{Name: "a.B.bad", Value: "1x"})
+	_, err = cfg.Int("a", "B", "big", 0)
+	c.Assert(err, DeepEquals, &ErrInvalidValue{Name: "a.B.big", Value: "9007199254740992g"})
+}
+
+func (s *ConfigSuite) TestSet(c *C) {
+	cfg := decode(c, "[core]\n\tbare = true\n\n[remote \"origin\"]\n\tfetch = a\n\tfetch = b\n")
+
+	cfg.Set("core", "", "bare", "false")
+	cfg.Set("core", "", "filemode", "true")
+	cfg.Set("remote", "origin", "fetch", "c")
+	cfg.Set("user", "", "name", "Foo")
+
+	c.Assert(encode(c, cfg), Equals, "[core]\n"+
+		"\tbare = false\n"+
+		"\tfilemode = true\n"+
+		"\n"+
+		"[remote \"origin\"]\n"+
+		"\tfetch = c\n"+
+		"[user]\n"+
+		"\tname = Foo\n")
+}
+
+func (s *ConfigSuite) TestAddAndUnset(c *C) {
+	cfg := decode(c, "[remote \"origin\"]\n\tfetch = a\n[remote \"origin\"]\n\turl = b\n")
+
+	cfg.Add("remote", "origin", "fetch", "c")
+	c.Assert(cfg.Strings("remote", "origin", "fetch"), DeepEquals, []string{"a", "c"})
+	c.Assert(encode(c, cfg), Equals, "[remote \"origin\"]\n\tfetch = a\n[remote \"origin\"]\n\turl = b\n\tfetch = c\n")
+
+	cfg.Unset("remote", "origin", "fetch")
+	c.Assert(cfg.Strings("remote", "origin", "fetch"), HasLen, 0)
+	c.Assert(cfg.String("remote", "origin", "url"), Equals, "b")
+
+	cfg.RemoveSection("remote", "origin")
+	c.Assert(cfg.Sections, HasLen, 0)
+}
+
+func (s *ConfigSuite) TestResolveIncludes(c *C) {
+	cfg := decode(c, "[user]\n\tname = Foo\n[include]\n\tpath = a\n\tpath = b\n[core]\n\tbare = true\n")
+
+	files := map[string]*Config{
+		"a": decode(c, "[user]\n\tname = Bar\n\temail = bar@example.com\n"),
+		"b": decode(c, "[core]\n\tbare = false\n\tfilemode = false\n"),
+	}
+
+	var loaded []string
+	c.Assert(cfg.ResolveIncludes(func(path string) (*Config, error) {
+		loaded = append(loaded, path)
+		return files[path], nil
+	}), IsNil)
+	c.Assert(loaded, DeepEquals, []string{"a", "b"})
+
+	// the included options override the ones before the include section
+	c.Assert(cfg.String("user", "", "name"), Equals, "Bar")
+	c.Assert(cfg.String("user", "", "email"), Equals, "bar@example.com")
+	c.Assert(cfg.String("core", "", "bare"), Equals, "true")
+	c.Assert(cfg.String("core", "", "filemode"), Equals, "false")
+	c.Assert(cfg.Sections[2].Included(), Equals, true)
+
+	// the included sections are not changed nor encoded
+	cfg.Set("core", "", "filemode", "true")
+	cfg.Unset("user", "", "email")
+	cfg.RemoveSection("core", "")
+	c.Assert(cfg.String("user", "", "email"), Equals, "bar@example.com")
+	c.Assert(cfg.String("core", "", "filemode"), Equals, "false")
+	c.Assert(encode(c, cfg), Equals, "[user]\n\tname = Foo\n[include]\n\tpath = a\n\tpath = b\n")
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// A Decoder reads and decodes a config file from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r}
+}
+
+// Decode reads the whole input and stores the config in the value pointed
+// to by c. A *ErrSyntax is returned if any line is not valid.
+func (d *Decoder) Decode(c *Config) error {
+	input, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	*c = Config{}
+	p := &parser{input: string(input), line: 1}
+	return p.parse(c)
+}
+
+type parser struct {
+	input string
+	pos   int
+	line  int
+}
+
+func (p *parser) parse(c *Config) error {
+	c.rawSections = make(map[*Section]rawSection)
+	c.rawOptions = make(map[*Option]rawOption)
+
+	var section *Section
+	for {
+		start := p.pos
+		p.skipSpaces()
+		if p.eof() {
+			c.rawTrailing = p.input[start:]
+			return nil
+		}
+
+		switch ch := p.input[p.pos]; {
+		case ch == '\n' || isComment(ch):
+			line := p.restOfLine()
+			if section == nil {
+				c.Comments = append(c.Comments, line)
+				c.rawComments = append(c.rawComments, rawLine{p.input[start:p.pos], line})
+			} else {
+				o := &Option{Comment: line}
+				section.Options = append(section.Options, o)
+				c.rawOptions[o] = rawOption{p.input[start:p.pos], *o, false}
+			}
+
+			continue
+		case ch == '[':
+			var err error
+			if section, err = p.parseHeader(); err != nil {
+				return err
+			}
+
+			c.Sections = append(c.Sections, section)
+			p.skipSpaces()
+			if !p.eof() {
+				if ch := p.input[p.pos]; ch == '\n' || isComment(ch) {
+					section.Comment = p.restOfLine()
+				}
+			}
+
+			c.rawSections[section] = rawSection{
+				p.input[start:p.pos], section.Name, section.Subsection, section.Comment,
+			}
+
+			if p.eof() {
+				return nil
+			}
+
+			// an option may follow the header in the same line
+			if p.input[p.pos-1] != '\n' {
+				if err := p.addOption(c, section, p.pos, true); err != nil {
+					return err
+				}
+			}
+		default:
+			if section == nil {
+				return p.syntaxError()
+			}
+
+			if err := p.addOption(c, section, start, false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addOption parses an option, whose line starts at start, and adds it to
+// the section s of c.
+func (p *parser) addOption(c *Config, s *Section, start int, inline bool) error {
+	o, err := p.parseOption()
+	if err != nil {
+		return err
+	}
+
+	s.Options = append(s.Options, o)
+	c.rawOptions[o] = rawOption{p.input[start:p.pos], *o, inline}
+	return nil
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// restOfLine returns the rest of the line, without its trailing whitespace,
+// and moves to the next one.
+func (p *parser) restOfLine() string {
+	end := strings.IndexByte(p.input[p.pos:], '\n')
+	if end == -1 {
+		end = len(p.input) - p.pos
+	}
+
+	line := strings.TrimRight(p.input[p.pos:p.pos+end], " \t\r")
+	p.pos += end
+	if !p.eof() {
+		p.pos++
+		p.line++
+	}
+
+	return line
+}
+
+func (p *parser) syntaxError() error {
+	return &ErrSyntax{Line: p.line}
+}
+
+// parseHeader parses a section header, from its "[" to its "]".
+func (p *parser) parseHeader() (*Section, error) {
+	p.pos++
+	start := p.pos
+	for !p.eof() && isNameChar(p.input[p.pos]) {
+		p.pos++
+	}
+
+	s := &Section{Name: strings.ToLower(p.input[start:p.pos])}
+	if s.Name == "" || p.eof() {
+		return nil, p.syntaxError()
+	}
+
+	// the legacy form, [section.subsection]
+	if i := strings.IndexByte(s.Name, '.'); i != -1 {
+		if p.input[p.pos] != ']' || i == 0 || i == len(s.Name)-1 {
+			return nil, p.syntaxError()
+		}
+
+		s.Name, s.Subsection = s.Name[:i], s.Name[i+1:]
+		p.pos++
+		return s, nil
+	}
+
+	if isSpace(p.input[p.pos]) {
+		p.skipSpaces()
+		sub, err := p.parseSubsection()
+		if err != nil {
+			return nil, err
+		}
+
+		s.Subsection = sub
+	}
+
+	if p.eof() || p.input[p.pos] != ']' {
+		return nil, p.syntaxError()
+	}
+
+	p.pos++
+	return s, nil
+}
+
+// parseSubsection parses a quoted subsection, with the escapes \" and \\.
+func (p *parser) parseSubsection() (string, error) {
+	if p.eof() || p.input[p.pos] != '"' {
+		return "", p.syntaxError()
+	}
+
+	var sub []byte
+	for p.pos++; !p.eof(); p.pos++ {
+		switch ch := p.input[p.pos]; ch {
+		case '\n':
+			return "", p.syntaxError()
+		case '"':
+			p.pos++
+			return string(sub), nil
+		case '\\':
+			p.pos++
+			if p.eof() || p.input[p.pos] == '\n' {
+				return "", p.syntaxError()
+			}
+
+			sub = append(sub, p.input[p.pos])
+		default:
+			sub = append(sub, ch)
+		}
+	}
+
+	return "", p.syntaxError()
+}
+
+// parseOption parses an option, up to the end of its line, or of the last
+// line of its value if it is continued.
+func (p *parser) parseOption() (*Option, error) {
+	start := p.pos
+	if !isLetter(p.input[p.pos]) {
+		return nil, p.syntaxError()
+	}
+
+	for !p.eof() && (isLetter(p.input[p.pos]) || isDigit(p.input[p.pos]) || p.input[p.pos] == '-') {
+		p.pos++
+	}
+
+	o := &Option{Key: strings.ToLower(p.input[start:p.pos])}
+	p.skipSpaces()
+	if p.eof() || p.input[p.pos] == '\n' || isComment(p.input[p.pos]) {
+		o.NoValue = true
+		o.Comment = p.restOfLine()
+		return o, nil
+	}
+
+	if p.input[p.pos] != '=' {
+		return nil, p.syntaxError()
+	}
+
+	p.pos++
+	p.skipSpaces()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	o.Value = value
+	o.Comment = p.restOfLine()
+	return o, nil
+}
+
+// parseValue parses a value, up to the end of the line or a comment, which
+// are left to be read. As in git, the whitespace inside the value is kept,
+// as spaces, and the trailing one is not unless it is quoted.
+func (p *parser) parseValue() (string, error) {
+	var value []byte
+	var quoted bool
+	var spaces int
+	for ; !p.eof(); p.pos++ {
+		ch := p.input[p.pos]
+		if ch == '\n' {
+			if quoted {
+				return "", p.syntaxError()
+			}
+
+			break
+		}
+
+		if !quoted && isComment(ch) {
+			break
+		}
+
+		if !quoted && isSpace(ch) {
+			if len(value) != 0 {
+				spaces++
+			}
+
+			continue
+		}
+
+		for ; spaces > 0; spaces-- {
+			value = append(value, ' ')
+		}
+
+		switch ch {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.syntaxError()
+			}
+
+			switch p.input[p.pos] {
+			case '\n':
+				p.line++
+			case '\r':
+				if p.pos+1 < len(p.input) && p.input[p.pos+1] == '\n' {
+					p.pos++
+					p.line++
+					continue
+				}
+
+				return "", p.syntaxError()
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case '"', '\\':
+				value = append(value, p.input[p.pos])
+			default:
+				return "", p.syntaxError()
+			}
+		default:
+			value = append(value, ch)
+		}
+	}
+
+	if quoted {
+		return "", p.syntaxError()
+	}
+
+	return string(value), nil
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r'
+}
+
+func isComment(ch byte) bool {
+	return ch == '#' || ch == ';'
+}
+
+func isLetter(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// isNameChar tells whether ch is allowed in the names of the sections, the
+// dot being the separator of the legacy subsections.
+func isNameChar(ch byte) bool {
+	return isLetter(ch) || isDigit(ch) || ch == '-' || ch == '.'
+}
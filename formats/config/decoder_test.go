@@ -0,0 +1,105 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+const testConfig = `# the config of the repository
+; with comments
+
+[core]
+	repositoryformatversion = 0
+	bare = false ; inline comment
+	logallrefupdates
+[remote "origin"] # the default remote
+	url = https://github.com/src-d/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+
+	# a comment in the section
+[Branch "Master"]
+	Remote = origin
+[branch.Legacy]
+	merge = refs/heads/legacy
+[alias]
+	lg = log --oneline   --graph
+	quoted = " leading and trailing "
+	escaped = "a\"b\\c" \t d\nmore
+	comments = "# not a comment" ; a comment
+	continued = one \
+two
+[user] name = Foo Bar
+`
+
+func (s *DecoderSuite) TestDecode(c *C) {
+	cfg := New()
+	c.Assert(NewDecoder(strings.NewReader(testConfig)).Decode(cfg), IsNil)
+
+	c.Assert(cfg.Comments, DeepEquals, []string{"# the config of the repository", "; with comments", ""})
+	c.Assert(cfg.Sections, HasLen, 6)
+
+	core := cfg.Sections[0]
+	c.Assert(core.Name, Equals, "core")
+	c.Assert(core.Options, DeepEquals, []*Option{
+		{Key: "repositoryformatversion", Value: "0"},
+		{Key: "bare", Value: "false", Comment: "; inline comment"},
+		{Key: "logallrefupdates", NoValue: true},
+	})
+
+	remote := cfg.Sections[1]
+	c.Assert(remote.Name, Equals, "remote")
+	c.Assert(remote.Subsection, Equals, "origin")
+	c.Assert(remote.Comment, Equals, "# the default remote")
+	c.Assert(remote.Options, HasLen, 5)
+	c.Assert(remote.Options[3], DeepEquals, &Option{})
+	c.Assert(remote.Options[4], DeepEquals, &Option{Comment: "# a comment in the section"})
+
+	c.Assert(cfg.Sections[2].Name, Equals, "branch")
+	c.Assert(cfg.Sections[2].Subsection, Equals, "Master")
+	c.Assert(cfg.Sections[2].Options[0].Key, Equals, "remote")
+	c.Assert(cfg.Sections[3].Name, Equals, "branch")
+	c.Assert(cfg.Sections[3].Subsection, Equals, "legacy")
+
+	for key, expected := range map[string]string{
+		"lg":        "log --oneline   --graph",
+		"quoted":    " leading and trailing ",
+		"escaped":   "a\"b\\c \t d\nmore",
+		"comments":  "# not a comment",
+		"continued": "one two",
+	} {
+		c.Assert(cfg.String("alias", "", key), Equals, expected, Commentf("key=%s", key))
+	}
+
+	c.Assert(cfg.String("user", "", "name"), Equals, "Foo Bar")
+}
+
+func (s *DecoderSuite) TestDecodeErrors(c *C) {
+	for input, line := range map[string]int{
+		"key = value\n":                 1,
+		"[core\n":                       1,
+		"[]\n":                          1,
+		"[core]\n\t1key = value\n":      2,
+		"[core]\n\tkey value\n":         2,
+		"[core]\n\tkey = \"value\n":     2,
+		"[core]\n\tkey = \\x\n":         2,
+		"[remote origin]\n":             1,
+		"[remote \"origin]\n":           1,
+		"[remote \"origin\"\n":          1,
+		"[remote.]\n":                   1,
+		"\n\n[core]\n\tkey = \"a\\\n":   5,
+		"[core]\n\tkey = \"a\nb\"\n":    2,
+		"[core]\n\tkey = a\\\nb\n\tb\"": 4,
+	} {
+		err := NewDecoder(strings.NewReader(input)).Decode(New())
+		c.Assert(err, DeepEquals, &ErrSyntax{Line: line}, Commentf("input=%q", input))
+	}
+}
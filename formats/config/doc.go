@@ -0,0 +1,29 @@
+// Package config implements encoding and decoding of git config files, the
+// INI-like files of the options of a repository, like its .git/config file,
+// as described in git-config(1).
+/*
+== A config file has the following format:
+
+  - Section headers: the name of a section between brackets, "[core]",
+    optionally followed by a subsection, a quoted string with the escapes
+    \" and \\, "[remote "origin"]". The names of the sections are case
+    insensitive and the subsections case sensitive. The legacy form with a
+    dot, "[branch.master]", has a lowercase subsection.
+
+  - Options: a key, case insensitive, with alphanumeric characters and "-",
+    starting with a letter, optionally followed by "=" and a value, in the
+    section they follow. The leading and trailing whitespace of the values
+    is ignored, unless it is quoted, and the escapes \n, \t, \b, \" and \\
+    are allowed. A backslash at the end of a line continues the value in
+    the next one. A key without "=" is a boolean true.
+
+  - Comments: from a "#" or ";", not quoted, to the end of the line.
+
+A key may have several values, in the same or several sections with the
+same name, like the fetch refspecs of a remote.
+
+The include.path options name other config files, whose options are read as
+if they were at the place of the include section, see
+Config.ResolveIncludes.
+*/
+package config
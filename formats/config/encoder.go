@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// An Encoder writes config files to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the config c. The comments, sections and options decoded
+// are written as they were read, byte for byte, unless they changed, and
+// the rest in the format written by git: the options are indented with a
+// tab and their values are quoted only when needed. The sections of
+// included files are not written.
+func (e *Encoder) Encode(c *Config) error {
+	var buf bytes.Buffer
+	if text, ok := c.rawCommentLines(); ok {
+		buf.WriteString(text)
+	} else {
+		for _, line := range c.Comments {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	for _, s := range c.Sections {
+		if s.included {
+			continue
+		}
+
+		text, rawHeader := c.rawSection(s)
+		if rawHeader {
+			buf.WriteString(text)
+		} else {
+			startLine(&buf)
+			buf.WriteString("[" + s.Name)
+			if s.Subsection != "" {
+				buf.WriteString(` "` + subsectionReplacer.Replace(s.Subsection) + `"`)
+			}
+
+			buf.WriteString("]")
+			writeComment(&buf, s.Comment)
+		}
+
+		for _, o := range s.Options {
+			if text, ok := c.rawOption(o, rawHeader); ok {
+				buf.WriteString(text)
+				continue
+			}
+
+			startLine(&buf)
+			if o.Key == "" {
+				buf.WriteString(o.Comment + "\n")
+				continue
+			}
+
+			buf.WriteString("\t" + o.Key)
+			if !o.NoValue {
+				buf.WriteString(" = " + encodeValue(o.Value))
+			}
+
+			writeComment(&buf, o.Comment)
+		}
+	}
+
+	buf.WriteString(c.rawTrailing)
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// startLine ends the line written last, if it was not ended, as the header
+// of a section followed by an option, or the last line of a file without a
+// trailing LF.
+func startLine(buf *bytes.Buffer) {
+	if b := buf.Bytes(); len(b) != 0 && b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
+
+func writeComment(buf *bytes.Buffer, comment string) {
+	if comment != "" {
+		buf.WriteString(" " + comment)
+	}
+
+	buf.WriteByte('\n')
+}
+
+var (
+	subsectionReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	valueReplacer      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`)
+)
+
+// encodeValue escapes the value, and quotes it if it has leading or
+// trailing whitespace or comment characters.
+func encodeValue(v string) string {
+	escaped := valueReplacer.Replace(v)
+	if strings.TrimSpace(v) != v || strings.ContainsAny(v, "#;") {
+		return `"` + escaped + `"`
+	}
+
+	return escaped
+}
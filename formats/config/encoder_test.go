@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+func (s *EncoderSuite) TestEncode(c *C) {
+	cfg := New()
+	c.Assert(NewDecoder(strings.NewReader(testConfig)).Decode(cfg), IsNil)
+
+	// the config decoded is written as it was read
+	var buf bytes.Buffer
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, testConfig)
+
+	// and the sections and options changed in the format of git
+	for _, s := range cfg.Sections {
+		s.Comment = ""
+		for _, o := range s.Options {
+			o.Value += ""
+			if o.Key != "" {
+				o.Comment = ""
+			}
+		}
+	}
+
+	cfg.Sections[3].Name = "branch"
+	cfg.Sections[5].Subsection = "me"
+	cfg.Comments = cfg.Comments[:1]
+	cfg.Set("alias", "", "Quoted", " leading and trailing ")
+
+	buf.Reset()
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, `# the config of the repository
+[core]
+	repositoryformatversion = 0
+	bare = false
+	logallrefupdates
+[remote "origin"]
+	url = https://github.com/src-d/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+
+	# a comment in the section
+[Branch "Master"]
+	Remote = origin
+[branch.Legacy]
+	merge = refs/heads/legacy
+[alias]
+	lg = log --oneline   --graph
+	quoted = " leading and trailing "
+	escaped = "a\"b\\c" \t d\nmore
+	comments = "# not a comment"
+	continued = one \
+two
+[user "me"]
+	name = Foo Bar
+`)
+
+	// the encoded config is decoded as the original one
+	decoded := New()
+	c.Assert(NewDecoder(&buf).Decode(decoded), IsNil)
+	for _, key := range []string{"lg", "quoted", "escaped", "comments", "continued"} {
+		c.Assert(decoded.String("alias", "", key), Equals, cfg.String("alias", "", key))
+	}
+}
+
+// rewriting a remote does not change the rest of the file
+func (s *EncoderSuite) TestEncodeRoundTrip(c *C) {
+	const input = "[url \"git@github.com:\"]\n" +
+		"\tinsteadOf = https://github.com/\n" +
+		"[Section.Sub]\n" +
+		"\tMixedCase = yes\n" +
+		"[alias]\n" +
+		"    co = \"checkout --quiet\" ; trailing\n" +
+		"\tlong = log \\\n" +
+		"\t\t--oneline\n" +
+		"[remote \"origin\"]\n" +
+		"\turl = https://example.com/foo.git\n" +
+		"\tfetch = +refs/heads/*:refs/remotes/origin/*\n" +
+		"[core]\tbare = false"
+
+	cfg := New()
+	c.Assert(NewDecoder(strings.NewReader(input)).Decode(cfg), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, input)
+
+	cfg.Set("remote", "origin", "url", "https://example.com/bar.git")
+	cfg.Set("core", "", "bare", "true")
+	buf.Reset()
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, strings.Replace(input, "foo.git", "bar.git", 1)[:len(input)-len("bare = false")]+
+		"\n\tbare = true\n")
+}
+
+func (s *EncoderSuite) TestEncodeSubsection(c *C) {
+	cfg := New()
+	cfg.Set("remote", `a "quoted\ name`, "url", "foo")
+
+	var buf bytes.Buffer
+	c.Assert(NewEncoder(&buf).Encode(cfg), IsNil)
+	c.Assert(buf.String(), Equals, "[remote \"a \\\"quoted\\\\ name\"]\n\turl = foo\n")
+
+	decoded := New()
+	c.Assert(NewDecoder(&buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Subsections("remote"), DeepEquals, []string{`a "quoted\ name`})
+}
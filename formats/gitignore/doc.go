@@ -0,0 +1,19 @@
+// Package gitignore implements the parsing and matching of the patterns of
+// the .gitignore files, as described in gitignore(5).
+//
+// Every line of a .gitignore file is a pattern, except the blank ones and
+// the ones starting with "#". The trailing spaces are ignored unless they
+// are escaped with a backslash. The patterns are matched against the paths
+// relative to the directory of their file, their domain:
+//
+//   - A leading "!" negates the pattern, so the paths matched are included
+//     again, unless any of their parent directories is excluded.
+//   - A trailing "/" only matches directories.
+//   - A pattern with a slash at the beginning or in the middle is anchored:
+//     it matches the whole path, relative to its domain. Otherwise it matches
+//     the name of the paths in any directory below the domain.
+//   - "*" matches anything but a slash, "?" any character but a slash and
+//     "[...]" a character of a class, negated with "!" or "^".
+//   - A leading "**/" matches any directory, a trailing "/**" everything
+//     inside a directory and "/**/" zero or more directories.
+package gitignore
@@ -0,0 +1,46 @@
+package gitignore
+
+// Matcher tells whether the paths are ignored by a set of patterns.
+type Matcher interface {
+	// Match reports whether a path, given by its components relative to the
+	// root of the tree, is ignored. isDir tells whether it is a directory.
+	Match(path []string, isDir bool) bool
+}
+
+type matcher struct {
+	patterns []Pattern
+}
+
+// NewMatcher returns a Matcher for the given patterns, in order of increasing
+// precedence: the last pattern matching a path decides whether it is ignored,
+// as the patterns of the .gitignore files of deeper directories override the
+// ones of their parents, and the later lines of a file the earlier ones.
+func NewMatcher(ps []Pattern) Matcher {
+	return &matcher{patterns: ps}
+}
+
+// Match returns true if the path, or any of its parent directories, is
+// excluded: as in git, a path cannot be included again by a negated pattern
+// if any of its parents is excluded.
+func (m *matcher) Match(path []string, isDir bool) bool {
+	for i := 1; i < len(path); i++ {
+		if m.match(path[:i], true) {
+			return true
+		}
+	}
+
+	return m.match(path, isDir)
+}
+
+func (m *matcher) match(path []string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		switch m.patterns[i].Match(path, isDir) {
+		case Exclude:
+			return true
+		case Include:
+			return false
+		}
+	}
+
+	return false
+}
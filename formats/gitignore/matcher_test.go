@@ -0,0 +1,77 @@
+package gitignore
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type MatcherSuite struct{}
+
+var _ = Suite(&MatcherSuite{})
+
+const (
+	testRootGitignore = "# comment\n" +
+		"*.log\n" +
+		"!important.log\n" +
+		"/build\n" +
+		"doc/*.txt\n" +
+		"tmp/\n" +
+		"!tmp/keep\n" +
+		"**/cache\n" +
+		"logs/**\n" +
+		"a/**/z\n" +
+		"\\#hash\n" +
+		"trailing   \n" +
+		"escaped\\ \n" +
+		"*.[!o]bj\n" +
+		"foo\\[x]\n"
+
+	testSubGitignore = "!*.log\n" +
+		"/local\n" +
+		"foo/\n"
+)
+
+// the files ignored have been obtained with git ls-files -o -i --exclude-standard
+// in a directory with the same files and .gitignore files
+func (s *MatcherSuite) TestMatch(c *C) {
+	root, err := ParsePatterns(strings.NewReader(testRootGitignore), nil)
+	c.Assert(err, IsNil)
+	sub, err := ParsePatterns(strings.NewReader(testSubGitignore), []string{"sub"})
+	c.Assert(err, IsNil)
+	m := NewMatcher(append(root, sub...))
+
+	ignored := []string{
+		"#hash", "a.log", "a/b/c/z", "a/z", "build", "cache/f", "doc/a.txt",
+		"escaped ", "foo[x]", "logs/a", "sub/foo/f", "sub/local", "sub/tmp/f",
+		"sub/y/foo/f", "tmp/f", "tmp/keep", "trailing", "x.abj", "x/y/cache",
+	}
+	for _, path := range ignored {
+		c.Assert(m.Match(strings.Split(path, "/"), false), Equals, true, Commentf("path=%s", path))
+	}
+
+	notIgnored := []string{
+		".gitignore", "doc/x/a.txt", "escaped", "foox", "important.log", "local",
+		"sub/.gitignore", "sub/a.log", "sub/build", "sub/important.log",
+		"sub/x/a.log", "trailing ", "x.obj", "x/tmp",
+	}
+	for _, path := range notIgnored {
+		c.Assert(m.Match(strings.Split(path, "/"), false), Equals, false, Commentf("path=%s", path))
+	}
+}
+
+func (s *MatcherSuite) TestMatchDirectories(c *C) {
+	ps, err := ParsePatterns(strings.NewReader("tmp/\nlogs/**\n"), nil)
+	c.Assert(err, IsNil)
+	m := NewMatcher(ps)
+
+	c.Assert(m.Match([]string{"tmp"}, true), Equals, true)
+	c.Assert(m.Match([]string{"x", "tmp"}, true), Equals, true)
+	c.Assert(m.Match([]string{"x", "tmp"}, false), Equals, false)
+	c.Assert(m.Match([]string{"logs"}, true), Equals, false)
+	c.Assert(m.Match([]string{"logs", "a"}, true), Equals, true)
+}
+
+func (s *MatcherSuite) TestMatchEmpty(c *C) {
+	c.Assert(NewMatcher(nil).Match([]string{"foo"}, false), Equals, false)
+}
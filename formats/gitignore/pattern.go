@@ -0,0 +1,215 @@
+package gitignore
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// MatchResult is the result of matching a path against a Pattern.
+type MatchResult int
+
+const (
+	// NoMatch is returned when the pattern does not match the path.
+	NoMatch MatchResult = iota
+	// Exclude is returned when the path is ignored by the pattern.
+	Exclude
+	// Include is returned when the path is matched by a negated pattern.
+	Include
+)
+
+const (
+	commentPrefix  = "#"
+	negatePrefix   = "!"
+	zeroToManyDirs = "**"
+)
+
+// Pattern is a pattern of a .gitignore file.
+type Pattern interface {
+	// Match matches a path, given by its components relative to the root
+	// of the tree, not to the domain of the pattern. isDir tells whether
+	// the path is a directory.
+	Match(path []string, isDir bool) MatchResult
+}
+
+type pattern struct {
+	domain   []string
+	pattern  []string // the components of the anchored patterns, or the name
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// ParsePattern parses a line of a .gitignore file found in the directory
+// given by domain, the components of its path relative to the root of the
+// tree. It returns nil for the blank lines and the comments.
+func ParsePattern(line string, domain []string) Pattern {
+	p := parsePattern(line, domain)
+	if p == nil {
+		return nil
+	}
+
+	return p
+}
+
+// ParsePatterns parses the patterns of a .gitignore file, read from r, found
+// in the directory given by domain. See ParsePattern.
+func ParsePatterns(r io.Reader, domain []string) ([]Pattern, error) {
+	var ps []Pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p := parsePattern(scanner.Text(), domain); p != nil {
+			ps = append(ps, p)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func parsePattern(line string, domain []string) *pattern {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.HasPrefix(line, commentPrefix) {
+		return nil
+	}
+
+	line = trimTrailingSpaces(line)
+	p := &pattern{domain: domain}
+	if strings.HasPrefix(line, negatePrefix) {
+		p.negate = true
+		line = line[len(negatePrefix):]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = line[:len(line)-1]
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	line = translateClasses(line)
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		p.pattern = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	} else {
+		p.pattern = []string{line}
+	}
+
+	return p
+}
+
+// trimTrailingSpaces removes the trailing spaces of a line, but the ones
+// escaped with a backslash, as trim_trailing_spaces in git's dir.c.
+func trimTrailingSpaces(line string) string {
+	end := -1
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			if end == -1 {
+				end = i
+			}
+		case '\\':
+			i++
+			if i == len(line) {
+				return line
+			}
+			fallthrough
+		default:
+			end = -1
+		}
+	}
+
+	if end == -1 {
+		return line
+	}
+
+	return line[:end]
+}
+
+// translateClasses replaces the "!" negating the character classes by "^",
+// the only one supported by path.Match.
+func translateClasses(p string) string {
+	b := []byte(p)
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '[':
+			if i+1 < len(b) && b[i+1] == '!' {
+				b[i+1] = '^'
+			}
+		}
+	}
+
+	return string(b)
+}
+
+func (p *pattern) Match(path []string, isDir bool) MatchResult {
+	if len(path) <= len(p.domain) {
+		return NoMatch
+	}
+
+	for i, name := range p.domain {
+		if path[i] != name {
+			return NoMatch
+		}
+	}
+
+	if p.dirOnly && !isDir {
+		return NoMatch
+	}
+
+	path = path[len(p.domain):]
+	var match bool
+	if p.anchored {
+		match = matchComponents(p.pattern, path)
+	} else {
+		match = matchName(p.pattern[0], path[len(path)-1])
+	}
+
+	switch {
+	case !match:
+		return NoMatch
+	case p.negate:
+		return Include
+	default:
+		return Exclude
+	}
+}
+
+// matchComponents matches the components of a path against the ones of a
+// pattern, "**" matching zero or more of them, or one or more at the end.
+func matchComponents(pattern, names []string) bool {
+	for ; len(pattern) != 0; pattern, names = pattern[1:], names[1:] {
+		if pattern[0] == zeroToManyDirs {
+			if len(pattern) == 1 {
+				return len(names) != 0
+			}
+
+			for i := 0; i <= len(names); i++ {
+				if matchComponents(pattern[1:], names[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(names) == 0 || !matchName(pattern[0], names[0]) {
+			return false
+		}
+	}
+
+	return len(names) == 0
+}
+
+func matchName(pattern, name string) bool {
+	match, err := path.Match(pattern, name)
+	return err == nil && match
+}
@@ -0,0 +1,119 @@
+package gitignore
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type PatternSuite struct{}
+
+var _ = Suite(&PatternSuite{})
+
+func (s *PatternSuite) TestParsePatterns(c *C) {
+	ps, err := ParsePatterns(strings.NewReader(
+		"# comment\n\n   \n*.o\r\n!keep.o  \n/build/\nescaped\\ \n\\#hash\n!\n"), nil)
+	c.Assert(err, IsNil)
+	c.Assert(ps, DeepEquals, []Pattern{
+		&pattern{pattern: []string{"*.o"}},
+		&pattern{pattern: []string{"keep.o"}, negate: true},
+		&pattern{pattern: []string{"build"}, anchored: true, dirOnly: true},
+		&pattern{pattern: []string{"escaped\\ "}},
+		&pattern{pattern: []string{"\\#hash"}},
+	})
+
+	c.Assert(ParsePattern("# comment", nil), IsNil)
+	c.Assert(ParsePattern("/", nil), IsNil)
+}
+
+func (s *PatternSuite) TestTrimTrailingSpaces(c *C) {
+	for _, t := range []struct{ line, expected string }{
+		{"foo", "foo"},
+		{"foo  ", "foo"},
+		{"foo\\ ", "foo\\ "},
+		{"foo\\  ", "foo\\ "},
+		{"foo\\\\ ", "foo\\\\"},
+		{"foo \\", "foo \\"},
+		{"   ", ""},
+	} {
+		c.Assert(trimTrailingSpaces(t.line), Equals, t.expected, Commentf("line=%q", t.line))
+	}
+}
+
+// a subset of the test cases of git's t3070-wildmatch.sh, with the semantics
+// of the paths (WM_PATHNAME) used for the .gitignore files
+func (s *PatternSuite) TestMatchWildmatch(c *C) {
+	for _, t := range []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"foo", "foo", true},
+		{"bar", "foo", false},
+		{"???", "foo", true},
+		{"??", "foo", false},
+		{"*", "foo", true},
+		{"f*", "foo", true},
+		{"*f", "foo", false},
+		{"*foo*", "foo", true},
+		{"*ob*a*r*", "foobar", true},
+		{"*ab", "aaaaaaabababab", true},
+		{"foo\\*", "foo*", true},
+		{"foo\\*bar", "foobar", false},
+		{"f\\\\oo", "f\\oo", true},
+		{"*[al]?", "ball", true},
+		{"[ten]", "ten", false},
+		{"**[!te]", "ten", true},
+		{"**[!ten]", "ten", false},
+		{"t[a-g]n", "ten", true},
+		{"t[!a-g]n", "ten", false},
+		{"t[!a-g]n", "ton", true},
+		{"t[^a-g]n", "ton", true},
+		{"\\[!a]", "[!a]", true},
+		{"foo*bar", "foo/baz/bar", false},
+		{"foo?bar", "foo/bar", false},
+		{"foo/*", "foo/bar", true},
+		{"foo/*", "foo/bar/baz", false},
+		{"*/foo", "bar/foo", true},
+		{"*/foo", "bar/baz/foo", false},
+		{"**/foo", "foo", true},
+		{"**/foo", "bar/baz/foo", true},
+		{"foo/**", "foo", false},
+		{"foo/**", "foo/bar/baz", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/xb", false},
+		{"a/**/b", "a/x/bc", false},
+		{"x/**/y/**/z", "x/y/a/b/z", true},
+		{"[", "[", false},
+	} {
+		p := ParsePattern(t.pattern, nil)
+		c.Assert(p.Match(strings.Split(t.path, "/"), false) == Exclude, Equals, t.match,
+			Commentf("pattern=%q, path=%q", t.pattern, t.path))
+	}
+}
+
+func (s *PatternSuite) TestMatchDomain(c *C) {
+	p := ParsePattern("/foo", []string{"a", "b"})
+	c.Assert(p.Match([]string{"a", "b", "foo"}, false), Equals, Exclude)
+	c.Assert(p.Match([]string{"a", "b", "c", "foo"}, false), Equals, NoMatch)
+	c.Assert(p.Match([]string{"a", "foo"}, false), Equals, NoMatch)
+	c.Assert(p.Match([]string{"foo"}, false), Equals, NoMatch)
+
+	p = ParsePattern("foo", []string{"a"})
+	c.Assert(p.Match([]string{"a", "b", "foo"}, false), Equals, Exclude)
+	c.Assert(p.Match([]string{"a"}, true), Equals, NoMatch)
+	c.Assert(p.Match([]string{"b", "foo"}, false), Equals, NoMatch)
+}
+
+func (s *PatternSuite) TestMatchDirOnlyAndNegate(c *C) {
+	p := ParsePattern("foo/", nil)
+	c.Assert(p.Match([]string{"x", "foo"}, true), Equals, Exclude)
+	c.Assert(p.Match([]string{"x", "foo"}, false), Equals, NoMatch)
+
+	p = ParsePattern("!foo", nil)
+	c.Assert(p.Match([]string{"foo"}, false), Equals, Include)
+	c.Assert(p.Match([]string{"bar"}, false), Equals, NoMatch)
+}
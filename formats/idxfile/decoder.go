@@ -40,6 +40,7 @@ func (d *Decoder) Decode(idx *Idxfile) error {
 		readObjectNames,
 		readCRC32,
 		readOffsets,
+		readLargeOffsets,
 		readChecksums,
 	}
 
@@ -58,7 +59,7 @@ func (d *Decoder) Decode(idx *Idxfile) error {
 
 func validateHeader(r io.Reader) error {
 	var h = make([]byte, 4)
-	if _, err := r.Read(h); err != nil {
+	if _, err := io.ReadFull(r, h); err != nil {
 		return err
 	}
 
@@ -102,8 +103,8 @@ func readFanout(idx *Idxfile, r io.Reader) error {
 func readObjectNames(idx *Idxfile, r io.Reader) error {
 	c := int(idx.ObjectCount)
 	for i := 0; i < c; i++ {
-		var ref core.Hash
-		if _, err := r.Read(ref[:]); err != nil {
+		ref, err := readHash(r, idx.Format)
+		if err != nil {
 			return err
 		}
 
@@ -116,7 +117,7 @@ func readObjectNames(idx *Idxfile, r io.Reader) error {
 func readCRC32(idx *Idxfile, r io.Reader) error {
 	c := int(idx.ObjectCount)
 	for i := 0; i < c; i++ {
-		if _, err := r.Read(idx.Entries[i].CRC32[:]); err != nil {
+		if _, err := io.ReadFull(r, idx.Entries[i].CRC32[:]); err != nil {
 			return err
 		}
 	}
@@ -138,18 +139,59 @@ func readOffsets(idx *Idxfile, r io.Reader) error {
 	return nil
 }
 
-func readChecksums(idx *Idxfile, r io.Reader) error {
-	if _, err := r.Read(idx.PackfileChecksum[:]); err != nil {
-		return err
+// readLargeOffsets reads the table of the offsets that do not fit in 31
+// bits, the entries with the most significant bit of their offset set hold
+// the position of their offset in this table instead.
+func readLargeOffsets(idx *Idxfile, r io.Reader) error {
+	var large []*Entry
+	for i := range idx.Entries {
+		if idx.Entries[i].Offset&isLargeOffset != 0 {
+			large = append(large, &idx.Entries[i])
+		}
 	}
 
-	if _, err := r.Read(idx.IdxChecksum[:]); err != nil {
-		return err
+	if len(large) == 0 {
+		return nil
+	}
+
+	offsets := make([]uint64, len(large))
+	for i := range offsets {
+		if err := binary.Read(r, binary.BigEndian, &offsets[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range large {
+		pos := e.Offset &^ isLargeOffset
+		if pos >= uint64(len(offsets)) {
+			return ErrMalformedIdxFile
+		}
+
+		e.Offset = offsets[pos]
 	}
 
 	return nil
 }
 
+func readChecksums(idx *Idxfile, r io.Reader) (err error) {
+	if idx.PackfileChecksum, err = readHash(r, idx.Format); err != nil {
+		return err
+	}
+
+	idx.IdxChecksum, err = readHash(r, idx.Format)
+	return err
+}
+
+// readHash reads a hash of the given format.
+func readHash(r io.Reader, f core.ObjectFormat) (core.Hash, error) {
+	var h core.Hash
+	if _, err := io.ReadFull(r, h[:f.Size()]); err != nil {
+		return core.ZeroHash, err
+	}
+
+	return core.NewHashFromBytes(f, h[:]), nil
+}
+
 func readInt32(r io.Reader) (uint32, error) {
 	var v uint32
 	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
@@ -1,10 +1,13 @@
 package idxfile
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/binary"
 	"os"
 	"testing"
 
+	"gopkg.in/src-d/go-git.v3/core"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -32,9 +35,47 @@ func (s *IdxfileSuite) TestDecode(c *C) {
 		"1669dce138d9b841a518c64b10914d88f5e488ea")
 	c.Assert(idx.Entries[0].Offset, Equals, uint64(615))
 
-	c.Assert(fmt.Sprintf("%x", idx.IdxChecksum), Equals,
+	c.Assert(idx.IdxChecksum.String(), Equals,
 		"bba9b7a9895724819225a044c857d391bb9d61d9")
-	c.Assert(fmt.Sprintf("%x", idx.PackfileChecksum), Equals,
+	c.Assert(idx.PackfileChecksum.String(), Equals,
 		"54bb61360ab2dad1a3e344a8cd3f82b848518cba")
 
 }
+
+func (s *IdxfileSuite) TestDecodeLargeOffsets(c *C) {
+	hashes := []core.Hash{
+		core.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"),
+		core.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"),
+		core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"),
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(idxHeader)
+	binary.Write(buf, binary.BigEndian, uint32(2))
+	for i := 0; i < 256; i++ {
+		var count uint32
+		for _, h := range hashes {
+			if int(h[0]) <= i {
+				count++
+			}
+		}
+
+		binary.Write(buf, binary.BigEndian, count)
+	}
+
+	for _, h := range hashes {
+		buf.Write(h.Bytes())
+	}
+	buf.Write(make([]byte, 4*len(hashes)))
+	binary.Write(buf, binary.BigEndian, []uint32{12, isLargeOffset | 1, isLargeOffset})
+	binary.Write(buf, binary.BigEndian, []uint64{1 << 33, 1<<32 + 7})
+	buf.Write(make([]byte, 40))
+
+	idx := &Idxfile{}
+	c.Assert(NewDecoder(buf).Decode(idx), IsNil)
+	c.Assert(idx.Entries, HasLen, 3)
+	c.Assert(idx.Entries[0].Offset, Equals, uint64(12))
+	c.Assert(idx.Entries[1].Offset, Equals, uint64(1<<32+7))
+	c.Assert(idx.Entries[2].Offset, Equals, uint64(1<<33))
+	c.Assert(buf.Len(), Equals, 0)
+}
@@ -1,27 +1,52 @@
 package idxfile
 
 import (
-	"crypto/sha1"
+	"bytes"
 	"encoding/binary"
 	"hash"
 	"io"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v3/core"
 )
 
 // An Encoder writes idx files to an output stream.
 type Encoder struct {
 	io.Writer
+	w    io.Writer
 	hash hash.Hash
 }
 
 // NewEncoder returns a new encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
-	h := sha1.New()
-	mw := io.MultiWriter(w, h)
-	return &Encoder{mw, h}
+	return &Encoder{w: w}
 }
 
 // Encode writes the idx in an idx file format to the stream of the encoder.
+// The entries of the idx are sorted by hash, as they are written, and its
+// fan-out table, object count and checksum are set. The offsets bigger than
+// 31 bits are written in the table of 64-bit offsets. The hashes of the
+// entries must be in the format of the idx, a *core.ErrObjectFormatMismatch
+// is returned otherwise.
 func (e *Encoder) Encode(idx *Idxfile) (int, error) {
+	if idx.Version != VersionSupported {
+		return 0, ErrUnsupportedVersion
+	}
+
+	for _, ent := range idx.Entries {
+		if err := core.CheckObjectFormat(idx.Format, ent.Hash); err != nil {
+			return 0, err
+		}
+	}
+
+	e.hash = idx.Format.New()
+	e.Writer = io.MultiWriter(e.w, e.hash)
+
+	sort.Sort(entriesByHash(idx.Entries))
+	fanout := idx.calculateFanout()
+	copy(idx.Fanout[:], fanout[:])
+	idx.ObjectCount = uint32(len(idx.Entries))
+
 	flow := []func(*Idxfile) (int, error){
 		e.encodeHeader,
 		e.encodeFanout,
@@ -77,7 +102,7 @@ func (e *Encoder) encodeEntryField(idx *Idxfile, isHash bool) (int, error) {
 	for _, ent := range idx.Entries {
 		var data []byte
 		if isHash {
-			data = ent.Hash[:]
+			data = ent.Hash.Bytes()
 		} else {
 			data = ent.CRC32[:]
 		}
@@ -94,31 +119,53 @@ func (e *Encoder) encodeEntryField(idx *Idxfile, isHash bool) (int, error) {
 
 func (e *Encoder) encodeOffsets(idx *Idxfile) (int, error) {
 	sz := 0
+	var large []uint64
 	for _, ent := range idx.Entries {
-		if err := e.writeInt32(uint32(ent.Offset)); err != nil {
+		offset := uint32(ent.Offset)
+		if ent.Offset >= isLargeOffset {
+			offset = isLargeOffset | uint32(len(large))
+			large = append(large, ent.Offset)
+		}
+
+		if err := e.writeInt32(offset); err != nil {
 			return sz, err
 		}
 
 		sz += 4
+	}
+
+	for _, offset := range large {
+		if err := binary.Write(e, binary.BigEndian, offset); err != nil {
+			return sz, err
+		}
 
+		sz += 8
 	}
 
 	return sz, nil
 }
 
 func (e *Encoder) encodeChecksums(idx *Idxfile) (int, error) {
-	if _, err := e.Write(idx.PackfileChecksum[:]); err != nil {
+	if _, err := e.Write(idx.PackfileChecksum[:idx.Format.Size()]); err != nil {
 		return 0, err
 	}
 
-	copy(idx.IdxChecksum[:], e.hash.Sum(nil)[:20])
-	if _, err := e.Write(idx.IdxChecksum[:]); err != nil {
+	idx.IdxChecksum = core.NewHashFromBytes(idx.Format, e.hash.Sum(nil))
+	if _, err := e.Write(idx.IdxChecksum.Bytes()); err != nil {
 		return 0, err
 	}
 
-	return 40, nil
+	return 2 * idx.Format.Size(), nil
 }
 
 func (e *Encoder) writeInt32(value uint32) error {
 	return binary.Write(e, binary.BigEndian, value)
 }
+
+type entriesByHash []Entry
+
+func (s entriesByHash) Len() int { return len(s) }
+func (s entriesByHash) Less(i, j int) bool {
+	return bytes.Compare(s[i].Hash[:], s[j].Hash[:]) < 0
+}
+func (s entriesByHash) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
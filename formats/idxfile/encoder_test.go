@@ -2,9 +2,12 @@ package idxfile
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"io"
 	"os"
 
+	"gopkg.in/src-d/go-git.v3/core"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -45,3 +48,54 @@ func decode(path string) (*bytes.Buffer, *Idxfile, error) {
 
 	return cont, idx, f.Close()
 }
+
+func (s *IdxfileSuite) TestEncodeLargeOffsets(c *C) {
+	idx := &Idxfile{Version: VersionSupported}
+	for i, e := range []struct {
+		hash   string
+		offset uint64
+	}{
+		{"a8d315b2b1c615d43042c3a62402b8a54288cf5c", 1 << 33},
+		{"1669dce138d9b841a518c64b10914d88f5e488ea", 12},
+		{"32858aad3c383ed1ff0a0f9bdf231d54a00c9e88", 1<<32 + 7},
+		{"a8e471f58bcbca63b07bda20e428190409c2db47", isLargeOffset - 1},
+		{"b8e471f58bcbca63b07bda20e428190409c2db47", isLargeOffset},
+	} {
+		idx.Entries = append(idx.Entries, Entry{
+			Hash:   core.NewHash(e.hash),
+			CRC32:  [4]byte{byte(i)},
+			Offset: e.offset,
+		})
+	}
+	idx.PackfileChecksum[0] = 42
+
+	buf := new(bytes.Buffer)
+	size, err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, buf.Len())
+	c.Assert(size, Equals, 4+4+1024+5*(20+4+4)+3*8+40)
+
+	sum := sha1.Sum(buf.Bytes()[:size-20])
+	c.Assert(idx.IdxChecksum.Bytes(), DeepEquals, sum[:])
+
+	obtained := &Idxfile{}
+	c.Assert(NewDecoder(buf).Decode(obtained), IsNil)
+	c.Assert(obtained, DeepEquals, idx)
+
+	var offsets []uint64
+	for i, e := range obtained.Entries {
+		if i > 0 {
+			c.Assert(bytes.Compare(obtained.Entries[i-1].Hash[:], e.Hash[:]) < 0, Equals, true)
+		}
+
+		offsets = append(offsets, e.Offset)
+	}
+
+	c.Assert(offsets, DeepEquals, []uint64{12, 1<<32 + 7, 1 << 33, isLargeOffset - 1, isLargeOffset})
+	c.Assert(obtained.ObjectCount, Equals, uint32(5))
+}
+
+func (s *IdxfileSuite) TestEncodeUnsupportedVersion(c *C) {
+	_, err := NewEncoder(new(bytes.Buffer)).Encode(&Idxfile{Version: 3})
+	c.Assert(err, Equals, ErrUnsupportedVersion)
+}
@@ -5,20 +5,27 @@ import "gopkg.in/src-d/go-git.v3/core"
 const (
 	// VersionSupported is the only idx version supported.
 	VersionSupported = 2
+
+	// isLargeOffset is the flag of the 31-bit offsets that are the position
+	// of the actual offset in the table of 64-bit offsets.
+	isLargeOffset = 1 << 31
 )
 
 var (
 	idxHeader = []byte{255, 't', 'O', 'c'}
 )
 
-// An Idxfile represents an idx file in memory.
+// An Idxfile represents an idx file in memory. Format is the format of the
+// hashes of the entries and of the checksums, which is not written in the
+// file, so it must be set before decoding it, SHA1 by default.
 type Idxfile struct {
+	Format           core.ObjectFormat
 	Version          uint32
 	Fanout           [255]uint32
 	ObjectCount      uint32
 	Entries          []Entry
-	PackfileChecksum [20]byte
-	IdxChecksum      [20]byte
+	PackfileChecksum core.Hash
+	IdxChecksum      core.Hash
 }
 
 // An Entry represents data about an object in the packfile: its hash,
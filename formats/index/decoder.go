@@ -0,0 +1,373 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the index version is
+	// not supported.
+	ErrUnsupportedVersion = errors.New("unsupported index version")
+	// ErrMalformedIndex is returned by Decode when the index is corrupted.
+	ErrMalformedIndex = errors.New("malformed index file")
+)
+
+// ErrUnsupportedExtension is returned by Decode when the index has an
+// extension that can not be ignored, as the ones of the split index and the
+// sparse index, which are not supported.
+type ErrUnsupportedExtension struct {
+	Signature [4]byte
+}
+
+func (e *ErrUnsupportedExtension) Error() string {
+	return fmt.Sprintf("unsupported index extension %q", e.Signature[:])
+}
+
+// A Decoder reads and decodes index files from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r}
+}
+
+// Decode reads the whole index file from its input and stores it in the
+// value pointed to by idx, whose Format must be the one of the index. The
+// checksum of the file is checked, and the optional extensions not
+// supported are kept in its Extensions.
+func (d *Decoder) Decode(idx *Index) error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	size := idx.Format.Size()
+	if len(data) < headerSize+size || !bytes.Equal(data[:4], signature) {
+		return ErrMalformedIndex
+	}
+
+	idx.Version = binary.BigEndian.Uint32(data[4:])
+	if idx.Version < VersionMin || idx.Version > VersionMax {
+		return ErrUnsupportedVersion
+	}
+
+	body := data[:len(data)-size]
+	h := idx.Format.New()
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), data[len(body):]) {
+		return ErrMalformedIndex
+	}
+
+	r := &reader{data: body, pos: headerSize, format: idx.Format}
+	count := binary.BigEndian.Uint32(data[8:])
+	idx.Entries = make([]*Entry, 0, count)
+	var name []byte
+	for i := uint32(0); i < count; i++ {
+		e, err := r.readEntry(idx.Version, name)
+		if err != nil {
+			return err
+		}
+
+		name = []byte(e.Name)
+		idx.Entries = append(idx.Entries, e)
+	}
+
+	return r.readExtensions(idx)
+}
+
+// reader reads the content of an index file, failing with
+// ErrMalformedIndex when it is shorter than expected.
+type reader struct {
+	data   []byte
+	pos    int
+	format core.ObjectFormat
+}
+
+func (r *reader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, ErrMalformedIndex
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) uint32() (uint32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (r *reader) uint16() (uint16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (r *reader) hash() (core.Hash, error) {
+	b, err := r.next(r.format.Size())
+	if err != nil {
+		return core.Hash{}, err
+	}
+
+	return core.NewHashFromBytes(r.format, b), nil
+}
+
+// until returns the bytes up to the given delimiter, skipping it.
+func (r *reader) until(delim byte) ([]byte, error) {
+	i := bytes.IndexByte(r.data[r.pos:], delim)
+	if i == -1 {
+		return nil, ErrMalformedIndex
+	}
+
+	b := r.data[r.pos : r.pos+i]
+	r.pos += i + 1
+	return b, nil
+}
+
+// varint reads a number encoded as git does in the version 4, as the
+// offsets of the deltas of the packfiles, with one added to every byte but
+// the last one, so every number has a single encoding.
+func (r *reader) varint() (int, error) {
+	var v int
+	for i := 0; ; i++ {
+		b, err := r.next(1)
+		if err != nil || i == 8 {
+			return 0, ErrMalformedIndex
+		}
+
+		if i != 0 {
+			v++
+		}
+
+		v = v<<7 | int(b[0]&0x7f)
+		if b[0]&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// readEntry reads an entry of the given version, prev is the name of the
+// previous entry, which the names of the version 4 are relative to.
+func (r *reader) readEntry(version uint32, prev []byte) (*Entry, error) {
+	start := r.pos
+	var stat [10]uint32
+	for i := range stat {
+		var err error
+		if stat[i], err = r.uint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &Entry{
+		Mode: os.FileMode(stat[6]),
+		Stat: Stat{
+			CreatedAt:  time.Unix(int64(stat[0]), int64(stat[1])),
+			ModifiedAt: time.Unix(int64(stat[2]), int64(stat[3])),
+			Dev:        stat[4],
+			Inode:      stat[5],
+			UID:        stat[7],
+			GID:        stat[8],
+			Size:       stat[9],
+		},
+	}
+
+	var err error
+	if e.Hash, err = r.hash(); err != nil {
+		return nil, err
+	}
+
+	flags, err := r.uint16()
+	if err != nil {
+		return nil, err
+	}
+
+	e.AssumeValid = flags&assumeValid != 0
+	e.Stage = Stage(flags&stageMask) >> stageShift
+	if flags&extended != 0 {
+		if version < 3 {
+			return nil, ErrMalformedIndex
+		}
+
+		extFlags, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+
+		e.SkipWorktree = extFlags&skipWorktree != 0
+		e.IntentToAdd = extFlags&intentToAdd != 0
+	}
+
+	if version == 4 {
+		return e, r.readCompressedName(e, prev)
+	}
+
+	name, err := r.until(0)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Name = string(name)
+	// the entry is padded to a multiple of 8 bytes, the NUL byte included
+	if _, err := r.next(7 - (r.pos-start+7)%8); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// readCompressedName reads the name of an entry of the version 4, the
+// number of bytes removed from the end of the previous name, and the bytes
+// appended to the rest.
+func (r *reader) readCompressedName(e *Entry, prev []byte) error {
+	n, err := r.varint()
+	if err != nil {
+		return err
+	}
+
+	if n > len(prev) {
+		return ErrMalformedIndex
+	}
+
+	suffix, err := r.until(0)
+	if err != nil {
+		return err
+	}
+
+	e.Name = string(prev[:len(prev)-n]) + string(suffix)
+	return nil
+}
+
+// readExtensions reads the extensions, the rest of the data, to the given
+// index.
+func (r *reader) readExtensions(idx *Index) error {
+	for r.pos < len(r.data) {
+		header, err := r.next(extensionSize)
+		if err != nil {
+			return err
+		}
+
+		var sig [4]byte
+		copy(sig[:], header)
+		data, err := r.next(int(binary.BigEndian.Uint32(header[4:])))
+		if err != nil {
+			return err
+		}
+
+		ext := &reader{data: data, format: r.format}
+		switch {
+		case sig == treeExtension:
+			idx.Cache, err = ext.readTree()
+		case sig == resolveUndoExtension:
+			idx.ResolveUndo, err = ext.readResolveUndo()
+		case sig[0] >= 'A' && sig[0] <= 'Z':
+			idx.Extensions = append(idx.Extensions, Extension{Signature: sig, Data: data})
+		default:
+			err = &ErrUnsupportedExtension{Signature: sig}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *reader) readTree() (*Tree, error) {
+	t := &Tree{}
+	for r.pos < len(r.data) {
+		path, err := r.until(0)
+		if err != nil {
+			return nil, err
+		}
+
+		e := TreeEntry{Path: string(path)}
+		if e.Entries, err = r.number(' ', 10); err != nil {
+			return nil, err
+		}
+
+		if e.Trees, err = r.number('\n', 10); err != nil {
+			return nil, err
+		}
+
+		if e.Entries >= 0 {
+			if e.Hash, err = r.hash(); err != nil {
+				return nil, err
+			}
+		}
+
+		t.Entries = append(t.Entries, e)
+	}
+
+	return t, nil
+}
+
+func (r *reader) readResolveUndo() (*ResolveUndo, error) {
+	ru := &ResolveUndo{}
+	for r.pos < len(r.data) {
+		path, err := r.until(0)
+		if err != nil {
+			return nil, err
+		}
+
+		e := ResolveUndoEntry{Path: string(path)}
+		for i := range e.Modes {
+			mode, err := r.number(0, 8)
+			if err != nil {
+				return nil, err
+			}
+
+			e.Modes[i] = os.FileMode(mode)
+		}
+
+		for i, mode := range e.Modes {
+			if mode == 0 {
+				e.Hashes[i] = r.format.ZeroHash()
+				continue
+			}
+
+			if e.Hashes[i], err = r.hash(); err != nil {
+				return nil, err
+			}
+		}
+
+		ru.Entries = append(ru.Entries, e)
+	}
+
+	return ru, nil
+}
+
+// number reads an ASCII number in the given base up to the given delimiter.
+func (r *reader) number(delim byte, base int) (int, error) {
+	b, err := r.until(delim)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(string(b), base, 32)
+	if err != nil {
+		return 0, ErrMalformedIndex
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,167 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DecoderSuite struct{}
+
+var _ = Suite(&DecoderSuite{})
+
+// fixtureEntries are the names, hashes and modes of the entries of the
+// fixtures, see fixtures/getindex.bash, the version 2 does not have new.
+var fixtureEntries = [][]string{
+	{"a/b/c/baz", "76018072e09c5d31c8c6e3113b8aa0fe625195ca", "100644"},
+	{"a/b/qux", "100b0dec8c53a40e4de7714b2c612dad5fad9985", "100644"},
+	{"a/bar", "5716ca5987cbf97d6bb54920bea6adde242d87e6", "100644"},
+	{"foo", "20b117fdd3804508359ec883abe519486f0d19dd", "100644"},
+	{"link", "19102815663d23f8b75a47e7a01965dcdc96468c", "120000"},
+	{"new", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", "100644"},
+	{"run.sh", "1a2485251c33a70432394c93fb89330ef214bfc9", "100755"},
+}
+
+func decodeFixture(c *C, name string) *Index {
+	data, err := ioutil.ReadFile("fixtures/" + name)
+	c.Assert(err, IsNil)
+
+	idx := &Index{}
+	c.Assert(NewDecoder(bytes.NewReader(data)).Decode(idx), IsNil)
+	return idx
+}
+
+func (s *DecoderSuite) TestDecode(c *C) {
+	for _, version := range []uint32{2, 3, 4} {
+		comment := Commentf("version=%d", version)
+		idx := decodeFixture(c, fmt.Sprintf("index-v%d", version))
+		c.Assert(idx.Version, Equals, version)
+
+		expected := fixtureEntries
+		if version == 2 {
+			expected = append(expected[:5:5], expected[6])
+		}
+
+		c.Assert(idx.Entries, HasLen, len(expected), comment)
+		for i, e := range idx.Entries {
+			c.Assert(e.Name, Equals, expected[i][0], comment)
+			c.Assert(e.Hash, Equals, core.NewHash(expected[i][1]), comment)
+			c.Assert(e.Mode.String(), Equals, modeString(expected[i][2]), comment)
+			c.Assert(e.Stage, Equals, Merged)
+			c.Assert(e.AssumeValid, Equals, false)
+			c.Assert(e.SkipWorktree, Equals, version != 2 && e.Name == "a/bar", comment)
+			c.Assert(e.IntentToAdd, Equals, e.Name == "new", comment)
+		}
+
+		foo := idx.Entries[3]
+		c.Assert(foo.ModifiedAt.Equal(time.Unix(1500000000, 0)), Equals, true)
+		c.Assert(foo.Size, Equals, uint32(7))
+		c.Assert(foo.Dev, Not(Equals), uint32(0))
+		c.Assert(foo.Inode, Not(Equals), uint32(0))
+
+		c.Assert(idx.Cache.Entries, HasLen, 4, comment)
+		c.Assert(idx.Cache.Entries[0], DeepEquals, TreeEntry{Entries: -1, Trees: 1})
+		c.Assert(idx.Cache.Entries[2], DeepEquals, TreeEntry{
+			Path: "b", Entries: 2, Trees: 1,
+			Hash: core.NewHash("b418dba8d915dc1387e5760ee91f76f57f8c1430"),
+		})
+		c.Assert(idx.Cache.Entries[3], DeepEquals, TreeEntry{
+			Path: "c", Entries: 1,
+			Hash: core.NewHash("66e8684b359a4bfe0c0fbb574d905e6999482e61"),
+		})
+
+		c.Assert(idx.ResolveUndo, DeepEquals, &ResolveUndo{Entries: []ResolveUndoEntry{{
+			Path:  "foo",
+			Modes: [3]os.FileMode{0100644, 0100644, 0100644},
+			Hashes: [3]core.Hash{
+				core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99"),
+				core.NewHash("1f7391f92b6a3792204e07e99f71f643cc35e7e1"),
+				core.NewHash("587be6b4c3f93f93c489c0111bba5596147a26cb"),
+			},
+		}}})
+
+		c.Assert(idx.Extensions, HasLen, 0)
+	}
+
+	// the tree of a is invalidated in the newer ones, when a/bar is flagged
+	idx := decodeFixture(c, "index-v2")
+	c.Assert(idx.Cache.Entries[1], DeepEquals, TreeEntry{
+		Path: "a", Entries: 3, Trees: 1,
+		Hash: core.NewHash("b04350a9d4d2b50f81b4511e538f1ed9d0afe132"),
+	})
+}
+
+func modeString(octal string) string {
+	var mode os.FileMode
+	for _, d := range octal {
+		mode = mode<<3 | os.FileMode(d-'0')
+	}
+
+	return mode.String()
+}
+
+// withExtension returns the given index file with an extension appended.
+func withExtension(c *C, name string, sig string, content []byte) []byte {
+	data, err := ioutil.ReadFile("fixtures/" + name)
+	c.Assert(err, IsNil)
+
+	data = append([]byte{}, data[:len(data)-sha1.Size]...)
+	data = append(data, sig...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], uint32(len(content)))
+	data = append(data, content...)
+	sum := sha1.Sum(data)
+	return append(data, sum[:]...)
+}
+
+func (s *DecoderSuite) TestDecodeExtensions(c *C) {
+	data := withExtension(c, "index-v4", "UNTR", []byte("foo"))
+
+	idx := &Index{}
+	c.Assert(NewDecoder(bytes.NewReader(data)).Decode(idx), IsNil)
+	c.Assert(idx.Entries, HasLen, len(fixtureEntries))
+	c.Assert(idx.Extensions, DeepEquals, []Extension{
+		{Signature: [4]byte{'U', 'N', 'T', 'R'}, Data: []byte("foo")},
+	})
+
+	data = withExtension(c, "index-v2", "link", []byte("foo"))
+	err := NewDecoder(bytes.NewReader(data)).Decode(&Index{})
+	c.Assert(err, DeepEquals, &ErrUnsupportedExtension{Signature: [4]byte{'l', 'i', 'n', 'k'}})
+	c.Assert(err.Error(), Equals, `unsupported index extension "link"`)
+}
+
+func (s *DecoderSuite) TestDecodeErrors(c *C) {
+	data, err := ioutil.ReadFile("fixtures/index-v3")
+	c.Assert(err, IsNil)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(data)/2]++
+	c.Assert(NewDecoder(bytes.NewReader(corrupted)).Decode(&Index{}), Equals, ErrMalformedIndex)
+
+	c.Assert(NewDecoder(bytes.NewReader(data[:10])).Decode(&Index{}), Equals, ErrMalformedIndex)
+
+	// a wrong count of entries, with a valid checksum
+	corrupted = append([]byte{}, data[:len(data)-sha1.Size]...)
+	corrupted[11] = 100
+	sum := sha1.Sum(corrupted)
+	corrupted = append(corrupted, sum[:]...)
+	c.Assert(NewDecoder(bytes.NewReader(corrupted)).Decode(&Index{}), Equals, ErrMalformedIndex)
+
+	unsupported := append([]byte{}, data...)
+	unsupported[7] = 5
+	c.Assert(NewDecoder(bytes.NewReader(unsupported)).Decode(&Index{}), Equals, ErrUnsupportedVersion)
+
+	// the fixtures are SHA1 files
+	c.Assert(NewDecoder(bytes.NewReader(data)).Decode(&Index{Format: core.SHA256}), Equals, ErrMalformedIndex)
+}
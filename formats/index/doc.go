@@ -0,0 +1,52 @@
+// Package index implements encoding and decoding of index files, the
+// .git/index file git writes with git add, also known as the dircache or the
+// staging area, which has the files of the next commit, with the stat data
+// of the files of the worktree they were read from, so the changed files can
+// be found without reading them.
+/*
+== The versions 2, 3 and 4 of the index files have the following format:
+
+  - A 12-byte header: the signature "DIRC", the 4-byte network byte order
+    version and the 4-byte number of entries.
+
+  - The entries, sorted by name, and by stage for the same name, each one
+    with the following format:
+
+    The 4-byte seconds and nanoseconds of the ctime and the mtime of the
+    file, its 4-byte dev, ino, mode, uid, gid and size, all of them in
+    network byte order, and the hash of its blob.
+
+    The 2-byte flags: the assume-valid flag, the most significant bit, the
+    extended flag, the next one, the 2-bit stage of the entry, and the
+    12-bit length of its name, 0xFFF if it is longer.
+
+    Only in the versions 3 and 4, if the extended flag is set, the 2-byte
+    extended flags: the skip-worktree flag, the second most significant
+    bit, and the intent-to-add flag, the next one.
+
+    The name, a path relative to the root of the worktree, with slashes
+    and without any trailing one, terminated by a NUL byte. Before it, in
+    the version 4, the varint encoded number of bytes removed from the end
+    of the name of the previous entry before appending it to them, so the
+    common prefixes of the names are not written. In the versions 2 and 3,
+    the entries are padded with NUL bytes to a multiple of 8 bytes.
+
+  - The extensions, each one with a 4-byte signature, the 4-byte network
+    byte order size of its content and its content. The ones whose
+    signature starts with an uppercase letter are optional, the rest can
+    not be ignored:
+
+    TREE, the cache tree: the trees of the directories of the entries, in
+    preorder, each one with its path, relative to its parent, terminated by
+    a NUL byte, the number of entries it has, or -1 if it is invalid, in
+    ASCII decimal, a space, the number of its subtrees, in ASCII decimal, a
+    newline and the hash of the tree, if it is valid.
+
+    REUC, the resolve undo: the stages of the conflicts that were resolved,
+    each one with its path, terminated by a NUL byte, the modes of its
+    stages 1 to 3, in ASCII octal, each one terminated by a NUL byte, and
+    the hashes of the stages whose mode is not zero.
+
+  - A trailer with the checksum of all of the above.
+*/
+package index
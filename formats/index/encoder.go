@@ -0,0 +1,202 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// An Encoder writes index files to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the index file of idx, with its entries, the TREE and REUC
+// extensions, if any, and the rest of its extensions as they are, returning
+// the number of bytes written. The entries must be sorted, as Add keeps
+// them. The version 3 is written instead of the 2 if any entry has the
+// extended flags, as git does.
+func (e *Encoder) Encode(idx *Index) (int, error) {
+	version := idx.Version
+	if version < VersionMin || version > VersionMax {
+		return 0, ErrUnsupportedVersion
+	}
+
+	if version == 2 && idx.hasExtendedFlags() {
+		version = 3
+	}
+
+	var buf bytes.Buffer
+	buf.Write(signature)
+	binary.Write(&buf, binary.BigEndian, version)
+	binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries)))
+
+	var prev string
+	for _, entry := range idx.Entries {
+		encodeEntry(&buf, entry, version, prev)
+		prev = entry.Name
+	}
+
+	if idx.Cache != nil {
+		writeExtension(&buf, treeExtension, idx.Cache.encode())
+	}
+
+	if idx.ResolveUndo != nil {
+		writeExtension(&buf, resolveUndoExtension, idx.ResolveUndo.encode())
+	}
+
+	for _, ext := range idx.Extensions {
+		writeExtension(&buf, ext.Signature, ext.Data)
+	}
+
+	h := idx.Format.New()
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+
+	return e.w.Write(buf.Bytes())
+}
+
+func (idx *Index) hasExtendedFlags() bool {
+	for _, e := range idx.Entries {
+		if e.extended() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extended returns true if the entry has to be written with the extended
+// flags.
+func (e *Entry) extended() bool {
+	return e.SkipWorktree || e.IntentToAdd
+}
+
+// encodeEntry writes the entry e in the given version, prev is the name of
+// the previous entry, which the names of the version 4 are relative to.
+func encodeEntry(buf *bytes.Buffer, e *Entry, version uint32, prev string) {
+	start := buf.Len()
+	for _, v := range []uint32{
+		uint32(e.CreatedAt.Unix()), uint32(e.CreatedAt.Nanosecond()),
+		uint32(e.ModifiedAt.Unix()), uint32(e.ModifiedAt.Nanosecond()),
+		e.Dev, e.Inode, uint32(e.Mode), e.UID, e.GID, e.Size,
+	} {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+
+	buf.Write(e.Hash.Bytes())
+
+	flags := uint16(e.Stage) << stageShift & stageMask
+	if len(e.Name) < nameMask {
+		flags |= uint16(len(e.Name))
+	} else {
+		flags |= nameMask
+	}
+
+	if e.AssumeValid {
+		flags |= assumeValid
+	}
+
+	if e.extended() {
+		flags |= extended
+	}
+
+	binary.Write(buf, binary.BigEndian, flags)
+	if e.extended() {
+		var extFlags uint16
+		if e.SkipWorktree {
+			extFlags |= skipWorktree
+		}
+
+		if e.IntentToAdd {
+			extFlags |= intentToAdd
+		}
+
+		binary.Write(buf, binary.BigEndian, extFlags)
+	}
+
+	if version == 4 {
+		common := commonPrefix(prev, e.Name)
+		writeVarint(buf, len(prev)-common)
+		buf.WriteString(e.Name[common:])
+		buf.WriteByte(0)
+		return
+	}
+
+	buf.WriteString(e.Name)
+	// the entry is padded to a multiple of 8 bytes with at least a NUL byte
+	buf.Write(make([]byte, 8-(buf.Len()-start)%8))
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+// writeVarint writes a number encoded as git does in the version 4, see
+// reader.varint.
+func writeVarint(buf *bytes.Buffer, v int) {
+	var b [16]byte
+	i := len(b) - 1
+	b[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		i--
+		b[i] = 0x80 | byte(v&0x7f)
+	}
+
+	buf.Write(b[i:])
+}
+
+func writeExtension(buf *bytes.Buffer, sig [4]byte, data []byte) {
+	buf.Write(sig[:])
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+func (t *Tree) encode() []byte {
+	var buf bytes.Buffer
+	for _, e := range t.Entries {
+		buf.WriteString(e.Path)
+		buf.WriteByte(0)
+		buf.WriteString(strconv.Itoa(e.Entries))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Itoa(e.Trees))
+		buf.WriteByte('\n')
+		if e.Entries >= 0 {
+			buf.Write(e.Hash.Bytes())
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (r *ResolveUndo) encode() []byte {
+	var buf bytes.Buffer
+	for _, e := range r.Entries {
+		buf.WriteString(e.Path)
+		buf.WriteByte(0)
+		for _, mode := range e.Modes {
+			buf.WriteString(strconv.FormatUint(uint64(mode), 8))
+			buf.WriteByte(0)
+		}
+
+		for i, mode := range e.Modes {
+			if mode != 0 {
+				buf.Write(e.Hashes[i].Bytes())
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
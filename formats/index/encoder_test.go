@@ -0,0 +1,100 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+func (s *EncoderSuite) TestEncode(c *C) {
+	for _, version := range []int{2, 3, 4} {
+		name := fmt.Sprintf("fixtures/index-v%d", version)
+		data, err := ioutil.ReadFile(name)
+		c.Assert(err, IsNil)
+
+		idx := &Index{}
+		c.Assert(NewDecoder(bytes.NewReader(data)).Decode(idx), IsNil)
+
+		buf := new(bytes.Buffer)
+		n, err := NewEncoder(buf).Encode(idx)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, len(data))
+		c.Assert(buf.Bytes(), DeepEquals, data, Commentf("version=%d", version))
+	}
+}
+
+func (s *EncoderSuite) TestEncodeVersion(c *C) {
+	idx := decodeFixture(c, "index-v3")
+	for _, version := range []uint32{2, 4} {
+		idx.Version = version
+
+		buf := new(bytes.Buffer)
+		_, err := NewEncoder(buf).Encode(idx)
+		c.Assert(err, IsNil)
+
+		// the version 3 is written for the extended flags
+		expected := version
+		if version == 2 {
+			expected = 3
+		}
+
+		decoded := &Index{}
+		c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+		c.Assert(decoded.Version, Equals, expected)
+		c.Assert(decoded.Entries, DeepEquals, idx.Entries)
+		c.Assert(decoded.Cache, DeepEquals, idx.Cache)
+		c.Assert(decoded.ResolveUndo, DeepEquals, idx.ResolveUndo)
+	}
+}
+
+func (s *EncoderSuite) TestEncodeLongNames(c *C) {
+	idx := New(core.SHA1)
+	idx.Version = 4
+	long := string(bytes.Repeat([]byte("a"), 5000))
+	for _, name := range []string{long + "/a", long + "/b", "b", long[:200] + "/c"} {
+		idx.Add(name, core.NewHash("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"), 0100644, Stat{})
+	}
+
+	for _, version := range []uint32{2, 4} {
+		idx.Version = version
+		buf := new(bytes.Buffer)
+		_, err := NewEncoder(buf).Encode(idx)
+		c.Assert(err, IsNil)
+
+		decoded := &Index{}
+		c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+		c.Assert(decoded.Entries, HasLen, 4)
+		for i, e := range decoded.Entries {
+			c.Assert(e.Name, Equals, idx.Entries[i].Name)
+		}
+	}
+}
+
+func (s *EncoderSuite) TestEncodeSHA256(c *C) {
+	idx := New(core.SHA256)
+	h := core.SHA256.ComputeHash(core.BlobObject, nil)
+	idx.Add("foo", h, 0100644, Stat{})
+	idx.Cache = &Tree{Entries: []TreeEntry{{Entries: 1, Hash: h}}}
+
+	buf := new(bytes.Buffer)
+	_, err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	decoded := &Index{Format: core.SHA256}
+	c.Assert(NewDecoder(buf).Decode(decoded), IsNil)
+	c.Assert(decoded.Entries[0].Hash, Equals, h)
+	c.Assert(decoded.Cache, DeepEquals, idx.Cache)
+}
+
+func (s *EncoderSuite) TestEncodeUnsupportedVersion(c *C) {
+	_, err := NewEncoder(new(bytes.Buffer)).Encode(&Index{Version: 1})
+	c.Assert(err, Equals, ErrUnsupportedVersion)
+}
@@ -0,0 +1,59 @@
+#!/bin/bash
+
+# writes the index of a repository at every version, with an entry per file
+# mode, nested directories and a resolved conflict, so it has the TREE and
+# REUC extensions. The ones of the versions 3 and 4 have entries with the
+# extended flags, an intent-to-add one and a skip-worktree one. The commits and the modification times of the files
+# are fixed, so the hashes and the times are always the same.
+
+set -e
+
+dir=$(mktemp -d)
+trap "rm -rf ${dir}" EXIT
+
+export GIT_AUTHOR_NAME=foo GIT_AUTHOR_EMAIL=foo@bar.com
+export GIT_COMMITTER_NAME=foo GIT_COMMITTER_EMAIL=foo@bar.com
+export GIT_AUTHOR_DATE="@1500000000 +0000" GIT_COMMITTER_DATE="@1500000000 +0000"
+
+pushd ${dir}
+git init -q -b master .
+git config core.untrackedCache false
+mkdir -p a/b/c
+echo foo > foo
+echo bar > a/bar
+echo baz > a/b/c/baz
+echo qux > a/b/qux
+printf '#!/bin/sh\n' > run.sh
+chmod +x run.sh
+ln -s foo link
+git add .
+git commit -qm initial
+
+git checkout -qb x
+echo x > foo
+git commit -qam x
+git checkout -q master
+echo master > foo
+git commit -qam master
+git merge -q x || true
+echo merged > foo
+git add foo
+
+touch -d @1500000000 foo a/bar a/b/c/baz a/b/qux run.sh
+git update-index -q --refresh
+git update-index --index-version 2
+popd
+cp ${dir}/.git/index ./index-v2
+
+# the extended flags are only written by the version 3 and newer
+pushd ${dir}
+echo new > new
+touch -d @1500000000 new
+git add -N new
+git update-index --skip-worktree a/bar
+git update-index --index-version 3
+popd
+cp ${dir}/.git/index ./index-v3
+
+git -C ${dir} update-index --index-version 4
+cp ${dir}/.git/index ./index-v4
@@ -0,0 +1,373 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+const (
+	// VersionMin is the oldest index version supported.
+	VersionMin = 2
+	// VersionMax is the newest index version supported.
+	VersionMax = 4
+
+	headerSize    = 12
+	entryFixSize  = 40 // of the stat data, before the hash of the entries
+	nameMask      = 0xfff
+	stageMask     = 0x3000
+	stageShift    = 12
+	assumeValid   = 1 << 15
+	extended      = 1 << 14
+	skipWorktree  = 1 << 14 // of the extended flags
+	intentToAdd   = 1 << 13 // of the extended flags
+	extensionSize = 8       // of the signature and the size of the extensions
+)
+
+// ErrEntryNotFound is returned by Remove when the index has no entry with
+// the given name.
+var ErrEntryNotFound = errors.New("entry not found")
+
+var (
+	signature = []byte{'D', 'I', 'R', 'C'}
+
+	treeExtension        = [4]byte{'T', 'R', 'E', 'E'}
+	resolveUndoExtension = [4]byte{'R', 'E', 'U', 'C'}
+)
+
+// Stage is the stage of an entry of the index, Merged for the files without
+// conflicts, or the stage of a side of a conflict.
+type Stage int
+
+const (
+	// Merged is the stage of the entries without conflicts.
+	Merged Stage = iota
+	// AncestorStage is the stage of the version of a conflicting file of the
+	// common ancestor.
+	AncestorStage
+	// OurStage is the stage of the version of a conflicting file of the
+	// current branch.
+	OurStage
+	// TheirStage is the stage of the version of a conflicting file of the
+	// branch being merged.
+	TheirStage
+)
+
+// An Index represents an index file in memory. Format is the format of the
+// hashes of the entries and of the checksum, which is not written in the
+// file, so it must be set before decoding it, SHA1 by default.
+type Index struct {
+	Format  core.ObjectFormat
+	Version uint32
+	// Entries are the entries of the index, sorted by name and stage.
+	Entries []*Entry
+	// Cache is the content of the TREE extension, nil if there is none.
+	Cache *Tree
+	// ResolveUndo is the content of the REUC extension, nil if there is
+	// none.
+	ResolveUndo *ResolveUndo
+	// Extensions are the rest of the optional extensions, in the order of
+	// the file, kept as they are.
+	Extensions []Extension
+}
+
+// New returns a new empty Index of the given format, of the version 2, the
+// one written by git by default.
+func New(f core.ObjectFormat) *Index {
+	return &Index{Format: f, Version: VersionMin}
+}
+
+// An Entry is a file of the index, with the stat data of the file of the
+// worktree it was read from.
+type Entry struct {
+	// Name is the path of the file, relative to the root of the worktree.
+	Name string
+	Hash core.Hash
+	Mode os.FileMode // the one of the blob in the trees
+	Stat
+	Stage Stage
+	// AssumeValid is set for the files git assumes unchanged, without
+	// checking them, see git update-index --assume-unchanged.
+	AssumeValid bool
+	// SkipWorktree is set for the files that are not in the worktree, as
+	// the ones out of a sparse checkout.
+	SkipWorktree bool
+	// IntentToAdd is set for the files added with git add -N, whose
+	// content is not in the index yet.
+	IntentToAdd bool
+}
+
+// Stat is the stat data of a file of the worktree, as recorded in the
+// entries of the index, so the files whose stat data did not change since
+// they were added are not read again.
+type Stat struct {
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Dev        uint32
+	Inode      uint32
+	UID        uint32
+	GID        uint32
+	// Size is the size of the file, truncated to 32 bits.
+	Size uint32
+}
+
+// NewStat returns the stat data of the file with the given info, its
+// modification time and its size. The rest of the stat data is not
+// available in every platform, so its creation time is the modification
+// time and the rest is zero.
+func NewStat(fi os.FileInfo) Stat {
+	return Stat{
+		CreatedAt:  fi.ModTime(),
+		ModifiedAt: fi.ModTime(),
+		Size:       uint32(fi.Size()),
+	}
+}
+
+// A Tree is the content of the TREE extension, the cache tree: the trees of
+// the directories of the entries, so the trees of a commit are not computed
+// again for the directories that did not change.
+type Tree struct {
+	// Entries are the trees in preorder, the one of the root first.
+	Entries []TreeEntry
+}
+
+// A TreeEntry is the tree of a directory of a Tree.
+type TreeEntry struct {
+	// Path is the name of the directory, relative to the one of its
+	// parent, empty for the root.
+	Path string
+	// Entries is the number of entries of the index in the directory, and
+	// its subdirectories, or -1 if the tree is invalid, as an entry in it
+	// changed, and it has no Hash.
+	Entries int
+	// Trees is the number of subtrees, the ones following it.
+	Trees int
+	Hash  core.Hash
+}
+
+// A ResolveUndo is the content of the REUC extension, the stages of the
+// conflicts that were resolved, so they can be recreated, see git checkout
+// --merge.
+type ResolveUndo struct {
+	Entries []ResolveUndoEntry
+}
+
+// A ResolveUndoEntry are the stages of a resolved conflict. Their modes and
+// hashes are indexed by stage minus one, AncestorStage first, and the mode
+// is zero for the stages that were missing.
+type ResolveUndoEntry struct {
+	Path   string
+	Modes  [3]os.FileMode
+	Hashes [3]core.Hash
+}
+
+// An Extension is an optional extension of the index not supported by this
+// package, with its signature and its content.
+type Extension struct {
+	Signature [4]byte
+	Data      []byte
+}
+
+// Entry returns the entry of the file with the given name at the Merged
+// stage, and false if there is no such entry, as when it has conflicts.
+func (i *Index) Entry(name string) (*Entry, bool) {
+	pos := i.search(name)
+	if pos < len(i.Entries) && i.Entries[pos].Name == name && i.Entries[pos].Stage == Merged {
+		return i.Entries[pos], true
+	}
+
+	return nil, false
+}
+
+// Add adds the file with the given name, relative to the root of the
+// worktree, to the index, with the given hash of its blob, mode and stat
+// data, as git add does, returning its entry. The entries of the file are
+// replaced, resolving its conflicts, if any, which are recorded in
+// ResolveUndo, and so are the ones of the files that can not be in the same
+// tree, the ones in a directory with its name or in its name as a
+// directory. The trees of the directories of the file in Cache are
+// invalidated.
+func (i *Index) Add(name string, h core.Hash, mode os.FileMode, stat Stat) *Entry {
+	i.remove(name)
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		i.remove(dir)
+	}
+
+	pos := i.search(name + "/")
+	for pos < len(i.Entries) && strings.HasPrefix(i.Entries[pos].Name, name+"/") {
+		i.remove(i.Entries[pos].Name)
+	}
+
+	e := &Entry{Name: name, Hash: h, Mode: mode, Stat: stat}
+	pos = i.search(name)
+	i.Entries = append(i.Entries, nil)
+	copy(i.Entries[pos+1:], i.Entries[pos:])
+	i.Entries[pos] = e
+	i.Cache.invalidate(name)
+
+	return e
+}
+
+// Remove removes the entries of the file with the given name from the
+// index, as git rm --cached does, recording its conflicts, if any, in
+// ResolveUndo. The trees of the directories of the file in Cache are
+// invalidated. ErrEntryNotFound is returned if there is no such file.
+func (i *Index) Remove(name string) error {
+	if !i.remove(name) {
+		return ErrEntryNotFound
+	}
+
+	return nil
+}
+
+// remove removes the entries with the given name, returning false if there
+// are none.
+func (i *Index) remove(name string) bool {
+	pos := i.search(name)
+	end := pos
+	for end < len(i.Entries) && i.Entries[end].Name == name {
+		end++
+	}
+
+	if end == pos {
+		return false
+	}
+
+	i.recordResolveUndo(i.Entries[pos:end])
+	i.Entries = append(i.Entries[:pos], i.Entries[end:]...)
+	i.Cache.invalidate(name)
+	return true
+}
+
+// recordResolveUndo records the stages of the given entries of a file in
+// ResolveUndo, if it has conflicts.
+func (i *Index) recordResolveUndo(entries []*Entry) {
+	if entries[0].Stage == Merged {
+		return
+	}
+
+	ru := ResolveUndoEntry{Path: entries[0].Name}
+	for j := range ru.Hashes {
+		ru.Hashes[j] = i.Format.ZeroHash()
+	}
+
+	for _, e := range entries {
+		ru.Modes[e.Stage-1] = e.Mode
+		ru.Hashes[e.Stage-1] = e.Hash
+	}
+
+	if i.ResolveUndo == nil {
+		i.ResolveUndo = &ResolveUndo{}
+	}
+
+	r := i.ResolveUndo
+	pos := sort.Search(len(r.Entries), func(j int) bool {
+		return r.Entries[j].Path >= ru.Path
+	})
+
+	if pos == len(r.Entries) || r.Entries[pos].Path != ru.Path {
+		r.Entries = append(r.Entries, ResolveUndoEntry{})
+		copy(r.Entries[pos+1:], r.Entries[pos:])
+	}
+
+	r.Entries[pos] = ru
+}
+
+// search returns the position of the first entry with the given name, or
+// the one where it would be inserted.
+func (i *Index) search(name string) int {
+	return sort.Search(len(i.Entries), func(j int) bool {
+		return i.Entries[j].Name >= name
+	})
+}
+
+// Glob returns the entries whose name matches the given pattern, see
+// path.Match, so the wildcards do not match the slashes of the names.
+// path.ErrBadPattern is returned if the pattern is malformed.
+func (i *Index) Glob(pattern string) ([]*Entry, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []*Entry
+	for _, e := range i.Entries {
+		if ok, _ := path.Match(pattern, e.Name); ok {
+			matches = append(matches, e)
+		}
+	}
+
+	return matches, nil
+}
+
+// invalidate invalidates the trees of the directories the file with the
+// given name is in, as the entries of the file changed.
+func (t *Tree) invalidate(name string) {
+	if t == nil || len(t.Entries) == 0 {
+		return
+	}
+
+	dirs := strings.Split(name, "/")
+	for i := 0; ; dirs = dirs[1:] {
+		t.Entries[i].Entries = -1
+		t.Entries[i].Hash = core.Hash{}
+		if len(dirs) == 1 {
+			return
+		}
+
+		if i = t.child(i, dirs[0]); i == -1 {
+			return
+		}
+	}
+}
+
+// Subtree returns the cache tree of the directory with the given slash
+// separated path, relative to the root of the worktree, "" for the root: the
+// entry of its tree, with its Path, followed by the ones of its
+// subdirectories. Nil is returned if the directory is not in t.
+func (t *Tree) Subtree(dir string) *Tree {
+	if t == nil || len(t.Entries) == 0 {
+		return nil
+	}
+
+	i := 0
+	if dir != "" {
+		for _, name := range strings.Split(dir, "/") {
+			if i = t.child(i, name); i == -1 {
+				return nil
+			}
+		}
+	}
+
+	return &Tree{Entries: append([]TreeEntry(nil), t.Entries[i:t.skip(i)]...)}
+}
+
+// child returns the position of the subtree with the given name of the tree
+// at the given position, or -1 if there is no such subtree.
+func (t *Tree) child(i int, name string) int {
+	child := i + 1
+	for n := 0; n < t.Entries[i].Trees && child < len(t.Entries); n++ {
+		if t.Entries[child].Path == name {
+			return child
+		}
+
+		child = t.skip(child)
+	}
+
+	return -1
+}
+
+// skip returns the position of the entry following the tree at the given
+// position and its subtrees.
+func (t *Tree) skip(i int) int {
+	trees := t.Entries[i].Trees
+	for i++; trees > 0 && i < len(t.Entries); trees-- {
+		i = t.skip(i)
+	}
+
+	return i
+}
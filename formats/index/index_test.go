@@ -0,0 +1,127 @@
+package index
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type IndexSuite struct{}
+
+var _ = Suite(&IndexSuite{})
+
+func names(entries []*Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+
+	return names
+}
+
+func (s *IndexSuite) TestAdd(c *C) {
+	idx := decodeFixture(c, "index-v2")
+	h := core.NewHash("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	stat := Stat{ModifiedAt: time.Unix(1500000000, 0), Size: 3}
+
+	e := idx.Add("a/b/new", h, 0100755, stat)
+	c.Assert(e, DeepEquals, &Entry{Name: "a/b/new", Hash: h, Mode: 0100755, Stat: stat})
+	c.Assert(names(idx.Entries), DeepEquals, []string{"a/b/c/baz", "a/b/new", "a/b/qux", "a/bar", "foo", "link", "run.sh"})
+
+	found, ok := idx.Entry("a/b/new")
+	c.Assert(ok, Equals, true)
+	c.Assert(found, Equals, e)
+
+	// the trees of a and a/b are invalidated, the one of a/b/c is not
+	for i, entries := range []int{-1, -1, -1, 1} {
+		c.Assert(idx.Cache.Entries[i].Entries, Equals, entries)
+	}
+
+	c.Assert(idx.Cache.Entries[3].Hash, Equals, core.NewHash("66e8684b359a4bfe0c0fbb574d905e6999482e61"))
+
+	// replaced
+	idx.Add("foo", h, 0100644, stat)
+	c.Assert(idx.Entries, HasLen, 7)
+	foo, _ := idx.Entry("foo")
+	c.Assert(foo.Hash, Equals, h)
+}
+
+func (s *IndexSuite) TestAddDirectoryConflicts(c *C) {
+	idx := decodeFixture(c, "index-v2")
+	h := core.NewHash("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+
+	idx.Add("a/b", h, 0100644, Stat{})
+	c.Assert(names(idx.Entries), DeepEquals, []string{"a/b", "a/bar", "foo", "link", "run.sh"})
+
+	idx.Add("foo/x", h, 0100644, Stat{})
+	c.Assert(names(idx.Entries), DeepEquals, []string{"a/b", "a/bar", "foo/x", "link", "run.sh"})
+}
+
+func (s *IndexSuite) TestAddResolvesConflict(c *C) {
+	idx := New(core.SHA1)
+	ancestor := core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99")
+	ours := core.NewHash("1f7391f92b6a3792204e07e99f71f643cc35e7e1")
+	idx.Entries = []*Entry{
+		{Name: "foo", Hash: ancestor, Mode: 0100644, Stage: AncestorStage},
+		{Name: "foo", Hash: ours, Mode: 0100755, Stage: OurStage},
+	}
+
+	_, ok := idx.Entry("foo")
+	c.Assert(ok, Equals, false)
+
+	h := core.NewHash("e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	idx.Add("foo", h, 0100644, Stat{})
+	c.Assert(idx.Entries, HasLen, 1)
+	c.Assert(idx.Entries[0].Stage, Equals, Merged)
+	c.Assert(idx.ResolveUndo, DeepEquals, &ResolveUndo{Entries: []ResolveUndoEntry{{
+		Path:   "foo",
+		Modes:  [3]os.FileMode{0100644, 0100755, 0},
+		Hashes: [3]core.Hash{ancestor, ours, core.ZeroHash},
+	}}})
+}
+
+func (s *IndexSuite) TestRemove(c *C) {
+	idx := decodeFixture(c, "index-v2")
+	c.Assert(idx.Remove("a/b/c/baz"), IsNil)
+	c.Assert(names(idx.Entries), DeepEquals, []string{"a/b/qux", "a/bar", "foo", "link", "run.sh"})
+	c.Assert(idx.Cache.Entries[3].Entries, Equals, -1)
+	c.Assert(idx.Remove("a/b/c/baz"), Equals, ErrEntryNotFound)
+	c.Assert(idx.Remove("a"), Equals, ErrEntryNotFound)
+}
+
+func (s *IndexSuite) TestSubtree(c *C) {
+	idx := decodeFixture(c, "index-v2")
+	c.Assert(idx.Cache.Subtree(""), DeepEquals, idx.Cache)
+	c.Assert(idx.Cache.Subtree("a/b"), DeepEquals, &Tree{Entries: idx.Cache.Entries[2:]})
+	c.Assert(idx.Cache.Subtree("a/b/c"), DeepEquals, &Tree{Entries: []TreeEntry{{
+		Path: "c", Entries: 1,
+		Hash: core.NewHash("66e8684b359a4bfe0c0fbb574d905e6999482e61"),
+	}}})
+
+	c.Assert(idx.Cache.Subtree("b"), IsNil)
+	c.Assert(idx.Cache.Subtree("a/b/c/baz"), IsNil)
+	c.Assert((*Tree)(nil).Subtree(""), IsNil)
+}
+
+func (s *IndexSuite) TestGlob(c *C) {
+	idx := decodeFixture(c, "index-v2")
+	for pattern, expected := range map[string][]string{
+		"a/*":   {"a/bar"},
+		"a/*/*": {"a/b/qux"},
+		"*":     {"foo", "link", "run.sh"},
+		"*.sh":  {"run.sh"},
+		"[fl]*": {"foo", "link"},
+		"x":     nil,
+	} {
+		matches, err := idx.Glob(pattern)
+		c.Assert(err, IsNil)
+		c.Assert(names(matches), DeepEquals, expected, Commentf("pattern=%s", pattern))
+	}
+
+	_, err := idx.Glob("[")
+	c.Assert(err, Equals, path.ErrBadPattern)
+}
@@ -20,11 +20,12 @@ var (
 // the Reader. Close will not close the underlying io.Reader.
 type Reader struct {
 	header header
+	format core.ObjectFormat
 	hash   core.Hash // final computed hash stored after Close
 
 	r            io.Reader     // provided reader wrapped in decompressor and tee
 	decompressor io.ReadCloser // provided reader wrapped in decompressor, retained for calling Close
-	h            core.Hasher   // streaming SHA1 hash of decoded data
+	h            core.Hasher   // streaming hash of decoded data
 }
 
 // NewReader returns a new Reader reading from r.
@@ -36,7 +37,13 @@ type Reader struct {
 // The returned Reader implements io.ReadCloser. Close should be called when
 // finished with the Reader. Close will not close the underlying io.Reader.
 func NewReader(r io.Reader) (*Reader, error) {
-	reader := &Reader{}
+	return NewReaderWithFormat(r, core.SHA1)
+}
+
+// NewReaderWithFormat returns a new Reader reading from r, see NewReader, hashing
+// the object in the given format.
+func NewReaderWithFormat(r io.Reader, f core.ObjectFormat) (*Reader, error) {
+	reader := &Reader{format: f}
 	return reader, reader.init(r)
 }
 
@@ -58,7 +65,7 @@ func (r *Reader) init(input io.Reader) (err error) {
 		return
 	}
 
-	r.h = core.NewHasher(r.header.t, r.header.size)
+	r.h = r.format.NewHasher(r.header.t, r.header.size)
 	r.r = io.TeeReader(r.decompressor, r.h) // All reads from the decompressor also write to the hash
 
 	return
@@ -22,11 +22,12 @@ var (
 // the Writer. Close will not close the underlying io.Writer.
 type Writer struct {
 	header header
+	format core.ObjectFormat
 	hash   core.Hash // final computed hash stored after Close
 
 	w          io.Writer      // provided writer wrapped in compressor and tee
 	compressor io.WriteCloser // provided writer wrapped in compressor, retained for calling Close
-	h          core.Hasher    // streaming SHA1 hash of encoded data
+	h          core.Hasher    // streaming hash of encoded data
 	written    int64          // Number of bytes written
 }
 
@@ -45,6 +46,12 @@ type Writer struct {
 // The returned Writer implements io.WriteCloser. Close should be called when
 // finished with the Writer. Close will not close the underlying io.Writer.
 func NewWriter(w io.Writer, t core.ObjectType, size int64) (*Writer, error) {
+	return NewWriterWithFormat(w, core.SHA1, t, size)
+}
+
+// NewWriterWithFormat returns a new Writer writing to w, see NewWriter, hashing
+// the object in the given format.
+func NewWriterWithFormat(w io.Writer, f core.ObjectFormat, t core.ObjectType, size int64) (*Writer, error) {
 	if !t.Valid() {
 		return nil, core.ErrInvalidType
 	}
@@ -53,6 +60,7 @@ func NewWriter(w io.Writer, t core.ObjectType, size int64) (*Writer, error) {
 	}
 	writer := &Writer{
 		header: header{t: t, size: size},
+		format: f,
 	}
 	return writer, writer.init(w)
 }
@@ -71,7 +79,7 @@ func (w *Writer) init(output io.Writer) (err error) {
 		return
 	}
 
-	w.h = core.NewHasher(w.header.t, w.header.size)
+	w.h = w.format.NewHasher(w.header.t, w.header.size)
 	w.w = io.MultiWriter(w.compressor, w.h) // All writes to the compressor also write to the hash
 
 	return
@@ -1,6 +1,7 @@
 package packfile
 
 import (
+	"fmt"
 	"io"
 
 	"gopkg.in/src-d/go-git.v3/core"
@@ -49,9 +50,19 @@ type Decoder struct {
 	// than enough to work with any repository, with higher values and huge
 	// repositories you can run out of memory.
 	MaxObjectsLimit uint32
-
-	p *Parser
-	s core.ObjectStorage
+	// Progress, if not nil, receives the progress of the decoding as git
+	// writes it, "Unpacking objects:  50% (21/42)\r", every time the
+	// percentage of objects decoded changes, and ", done.\n" at the end.
+	Progress io.Writer
+	// Bases is the storage of the delta bases that are not in the
+	// packfile, the ones of the ref-deltas of the thin packs sent to the
+	// repositories having them, see ExternalBases. The storage the objects
+	// are decoded into is used if it is nil.
+	Bases core.ObjectStorage
+
+	p        *Parser
+	s        core.ObjectStorage
+	external *externalBases
 }
 
 // NewDecoder returns a new Decoder that reads from r.
@@ -63,9 +74,18 @@ func NewDecoder(r ReadRecaller) *Decoder {
 	}
 }
 
-// Decode reads a packfile and stores it in the value pointed to by s.
+// Decode reads a packfile and stores it in the value pointed to by s. The
+// hashes of the objects are computed in the format of s, see
+// core.ObjectStorageFormat.
 func (d *Decoder) Decode(s core.ObjectStorage) error {
 	d.s = s
+	d.p.Format = core.ObjectStorageFormat(s)
+	d.external = &externalBases{ObjectStorage: d.Bases, seen: make(map[core.Hash]bool)}
+	if d.Bases == nil {
+		d.external.ObjectStorage = s
+	}
+
+	d.p.bases = d.external
 
 	count, err := d.p.ReadHeader()
 	if err != nil {
@@ -86,6 +106,9 @@ func (d *Decoder) readObjects(count uint32) error {
 	// Together with zlib inflation, it's 400-410 µs for small objects.
 	// That's 1 sec for ~2450 objects, ~4.20 MB, or ~250 ms per MB,
 	// of which 12-20 % is _not_ zlib inflation (ie. is our code).
+	p := &progress{w: d.Progress, title: "Unpacking objects", total: count}
+	defer p.done()
+
 	for i := 0; i < int(count); i++ {
 		start, err := d.p.Offset()
 		if err != nil {
@@ -110,7 +133,71 @@ func (d *Decoder) readObjects(count uint32) error {
 		if err == io.EOF {
 			break
 		}
+
+		p.update(uint32(i + 1))
 	}
 
 	return nil
 }
+
+// ExternalBases returns the hashes of the delta bases of the last packfile
+// decoded that are not in it, read from Bases, sorted. The packfile is
+// thin if there is any, see FixThin.
+func (d *Decoder) ExternalBases() []core.Hash {
+	if d.external == nil {
+		return nil
+	}
+
+	hashes := make([]core.Hash, len(d.external.hashes))
+	copy(hashes, d.external.hashes)
+	core.SortHashes(hashes)
+	return hashes
+}
+
+// externalBases is the storage of the delta bases that are not in a
+// packfile, keeping the hashes of the ones read.
+type externalBases struct {
+	core.ObjectStorage
+	hashes []core.Hash
+	seen   map[core.Hash]bool
+}
+
+func (s *externalBases) Get(h core.Hash) (core.Object, error) {
+	obj, err := s.ObjectStorage.Get(h)
+	if err == nil && !s.seen[h] {
+		s.seen[h] = true
+		s.hashes = append(s.hashes, h)
+	}
+
+	return obj, err
+}
+
+// progress writes the progress of the objects processed out of a total, the
+// errors of the writer are ignored.
+type progress struct {
+	w       io.Writer
+	title   string
+	total   uint32
+	current uint32
+	percent uint32
+}
+
+func (p *progress) update(current uint32) {
+	p.current = current
+	percent := current * 100 / p.total
+	if p.w == nil || (percent == p.percent && current != 1) {
+		return
+	}
+
+	p.percent = percent
+	fmt.Fprintf(p.w, "%s: %3d%% (%d/%d)\r", p.title, percent, current, p.total)
+}
+
+// done writes the final line, if every object has been processed.
+func (p *progress) done() {
+	if p.w == nil || p.total == 0 || p.current != p.total {
+		return
+	}
+
+	fmt.Fprintf(p.w, "%s: 100%% (%d/%d), done.\n", p.title, p.total, p.total)
+}
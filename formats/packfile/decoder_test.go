@@ -49,6 +49,28 @@ func (s *ReaderSuite) TestReadPackfile(c *C) {
 	})
 }
 
+func (s *ReaderSuite) TestReadPackfileProgress(c *C) {
+	data, _ := base64.StdEncoding.DecodeString(packFileWithEmptyObjects)
+	d := NewDecoder(NewStream(bytes.NewReader(data)))
+	progress := bytes.NewBuffer(nil)
+	d.Progress = progress
+
+	c.Assert(d.Decode(memory.NewObjectStorage()), IsNil)
+	c.Assert(progress.String(), Equals, ""+
+		"Unpacking objects:   9% (1/11)\r"+
+		"Unpacking objects:  18% (2/11)\r"+
+		"Unpacking objects:  27% (3/11)\r"+
+		"Unpacking objects:  36% (4/11)\r"+
+		"Unpacking objects:  45% (5/11)\r"+
+		"Unpacking objects:  54% (6/11)\r"+
+		"Unpacking objects:  63% (7/11)\r"+
+		"Unpacking objects:  72% (8/11)\r"+
+		"Unpacking objects:  81% (9/11)\r"+
+		"Unpacking objects:  90% (10/11)\r"+
+		"Unpacking objects: 100% (11/11)\r"+
+		"Unpacking objects: 100% (11/11), done.\n")
+}
+
 func (s *ReaderSuite) TestReadPackfileOFSDelta(c *C) {
 	s.testReadPackfileGitFixture(c, "fixtures/git-fixture.ofs-delta", OFSDeltaFormat)
 
@@ -0,0 +1,152 @@
+package packfile
+
+import (
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// findDeltas looks for the delta base of every object, the way git does in
+// pack-objects: the objects are sorted by type and size, the biggest
+// first, and the previous objects in a window of this order are tried as
+// bases of every object, keeping the smallest delta.
+//
+// The sorted objects are split in as many parts as threads, the bases of
+// the objects of every part are looked for in a different goroutine.
+func (e *Encoder) findDeltas(objects []*objectToPack) error {
+	sorted := make([]*objectToPack, len(objects))
+	copy(sorted, objects)
+	sort.Stable(byTypeAndSize(sorted))
+
+	threads := e.opts.Threads
+	if threads < 1 {
+		threads = 1
+	}
+
+	size := (len(sorted) + threads - 1) / threads
+	errs := make([]error, 0, threads)
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	for start := 0; start < len(sorted); start += size {
+		end := start + size
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+
+		wg.Add(1)
+		go func(part []*objectToPack) {
+			defer wg.Done()
+			if err := e.findPartDeltas(part); err != nil {
+				m.Lock()
+				errs = append(errs, err)
+				m.Unlock()
+			}
+		}(sorted[start:end])
+	}
+
+	wg.Wait()
+	if len(errs) != 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+func (e *Encoder) findPartDeltas(objects []*objectToPack) error {
+	defer func() {
+		for _, o := range objects {
+			o.content, o.index = nil, nil
+		}
+	}()
+
+	for i, target := range objects {
+		// only the objects of the window are kept in memory
+		if i > e.opts.Window {
+			old := objects[i-e.opts.Window-1]
+			old.content, old.index = nil, nil
+		}
+
+		if err := target.readContent(); err != nil {
+			return err
+		}
+
+		for j := i - 1; j >= 0 && j >= i-e.opts.Window; j-- {
+			base := objects[j]
+			if base.Type() != target.Type() {
+				break
+			}
+
+			e.tryDelta(target, base)
+		}
+	}
+
+	return nil
+}
+
+func (o *objectToPack) readContent() error {
+	r, err := o.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	o.content, err = ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(o.content)) != o.Size() {
+		return ErrInvalidObject.AddDetails("%s: %d bytes read, %d expected",
+			o.Hash(), len(o.content), o.Size())
+	}
+
+	return nil
+}
+
+// tryDelta sets base as the delta base of target, if the delta is small
+// enough and smaller than the delta with its current base.
+func (e *Encoder) tryDelta(target, base *objectToPack) {
+	if base.depth >= e.opts.Depth {
+		return
+	}
+
+	// the delta has to be smaller than half of the object, and the longer
+	// the resulting chain the smaller, as git does
+	maxSize := len(target.content)/2 - 20
+	maxSize = maxSize * (e.opts.Depth - base.depth) / e.opts.Depth
+	if target.delta != nil && len(target.delta) <= maxSize {
+		maxSize = len(target.delta) - 1
+	}
+
+	if maxSize <= 0 {
+		return
+	}
+
+	diff := len(target.content) - len(base.content)
+	if diff >= maxSize || -diff >= maxSize {
+		return
+	}
+
+	if base.index == nil {
+		base.index = newDeltaIndex(base.content)
+	}
+
+	delta := diffDelta(base.index, base.content, target.content, maxSize)
+	if delta == nil {
+		return
+	}
+
+	target.base, target.delta, target.depth = base, delta, base.depth+1
+}
+
+type byTypeAndSize []*objectToPack
+
+func (s byTypeAndSize) Len() int { return len(s) }
+func (s byTypeAndSize) Less(i, j int) bool {
+	if s[i].Type() != s[j].Type() {
+		return typeOrder[s[i].Type()] < typeOrder[s[j].Type()]
+	}
+
+	return s[i].Size() > s[j].Size()
+}
+func (s byTypeAndSize) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,153 @@
+package packfile
+
+// See delta.go for the format of the deltas, these are created the same way
+// git does in diff-delta.c: the source is indexed by blocks, and every block
+// of the target found in the index is copied from the source, extending the
+// match as much as possible, while the rest of the target is inserted.
+
+const (
+	// deltaBlockSize is the size of the blocks of the source indexed to
+	// find the copies.
+	deltaBlockSize = 16
+	// maxCopySize is the biggest size of a copy instruction, a longer match
+	// is written as several copies.
+	maxCopySize = 0x10000
+	// maxInsertSize is the biggest size of an insert instruction, the size
+	// is written in the instruction byte.
+	maxInsertSize = 0x7f
+)
+
+// deltaIndex is the offset in a source of each of its blocks.
+type deltaIndex map[[deltaBlockSize]byte]int
+
+func newDeltaIndex(src []byte) deltaIndex {
+	index := make(deltaIndex, len(src)/deltaBlockSize)
+	var block [deltaBlockSize]byte
+	// the last occurrence of each block is indexed, as git does
+	for i := 0; i+deltaBlockSize <= len(src); i += deltaBlockSize {
+		copy(block[:], src[i:])
+		index[block] = i
+	}
+
+	return index
+}
+
+// diffDelta returns the delta transforming src into tgt, using the index of
+// src, or nil if it would be bigger than maxSize, when maxSize is positive.
+func diffDelta(index deltaIndex, src, tgt []byte, maxSize int) []byte {
+	delta := encodeLEB128(nil, uint(len(src)))
+	delta = encodeLEB128(delta, uint(len(tgt)))
+
+	var block [deltaBlockSize]byte
+	insert := 0 // start of the pending bytes to insert
+	for i := 0; i+deltaBlockSize <= len(tgt); {
+		copy(block[:], tgt[i:])
+		offset, ok := index[block]
+		if !ok {
+			i++
+			continue
+		}
+
+		// the match is extended backwards, over the pending bytes, and
+		// forwards as much as possible
+		size := deltaBlockSize
+		for offset > 0 && i > insert && src[offset-1] == tgt[i-1] {
+			offset--
+			i--
+			size++
+		}
+
+		for offset+size < len(src) && i+size < len(tgt) && src[offset+size] == tgt[i+size] {
+			size++
+		}
+
+		delta = appendInserts(delta, tgt[insert:i])
+		delta = appendCopies(delta, offset, size)
+		i += size
+		insert = i
+
+		if maxSize > 0 && len(delta) > maxSize {
+			return nil
+		}
+	}
+
+	delta = appendInserts(delta, tgt[insert:])
+	if maxSize > 0 && len(delta) > maxSize {
+		return nil
+	}
+
+	return delta
+}
+
+func appendInserts(delta, data []byte) []byte {
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxInsertSize {
+			n = maxInsertSize
+		}
+
+		delta = append(delta, byte(n))
+		delta = append(delta, data[:n]...)
+		data = data[n:]
+	}
+
+	return delta
+}
+
+func appendCopies(delta []byte, offset, size int) []byte {
+	for size > 0 {
+		n := size
+		if n > maxCopySize {
+			n = maxCopySize
+		}
+
+		delta = appendCopy(delta, offset, n)
+		offset += n
+		size -= n
+	}
+
+	return delta
+}
+
+// appendCopy appends a copy instruction, see decodeOffset and decodeSize:
+// only the non-zero bytes of the offset and the size are written, and the
+// size maxCopySize is written as zero.
+func appendCopy(delta []byte, offset, size int) []byte {
+	if size == maxCopySize {
+		size = 0
+	}
+
+	i := len(delta)
+	cmd := byte(0x80)
+	delta = append(delta, cmd)
+	for b := uint(0); b < 4; b++ {
+		if v := byte(offset >> (b * 8)); v != 0 {
+			cmd |= 0x01 << b
+			delta = append(delta, v)
+		}
+	}
+
+	for b := uint(0); b < 3; b++ {
+		if v := byte(size >> (b * 8)); v != 0 {
+			cmd |= 0x10 << b
+			delta = append(delta, v)
+		}
+	}
+
+	delta[i] = cmd
+	return delta
+}
+
+// encodeLEB128 appends a number encoded as an unsigned LEB128, see
+// decodeLEB128.
+func encodeLEB128(buf []byte, num uint) []byte {
+	for {
+		b := byte(num & payload)
+		num >>= 7
+		if num == 0 {
+			return append(buf, b)
+		}
+
+		buf = append(buf, b|continuation)
+	}
+}
@@ -0,0 +1,62 @@
+package packfile
+
+import (
+	"bytes"
+	"math/rand"
+
+	. "gopkg.in/check.v1"
+)
+
+type DiffDeltaSuite struct{}
+
+var _ = Suite(&DiffDeltaSuite{})
+
+func (s *DiffDeltaSuite) TestDiffDelta(c *C) {
+	r := rand.New(rand.NewSource(42))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		r.Read(b)
+		return b
+	}
+
+	base := random(1 << 18)
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	for i, t := range []struct {
+		src, tgt []byte
+	}{
+		{nil, []byte("foo")},
+		{[]byte("foo"), []byte("bar")},
+		{base, base},
+		{base, base[:1000]},
+		{base, base[3:20]},
+		{base[:1000], base},
+		{base, join(base[5000:6000], []byte("new content"), base[:100])},
+		{base, join([]byte("begin"), base[100000:], base[:100000], []byte("end"))},
+		{base, join(random(300), base[7:231], random(1), base[2000:50000])},
+		{bytes.Repeat([]byte("a"), 1000), bytes.Repeat([]byte("a"), 1001)},
+	} {
+		com := Commentf("test %d", i)
+		delta := diffDelta(newDeltaIndex(t.src), t.src, t.tgt, 0)
+		c.Assert(PatchDelta(t.src, delta), DeepEquals, t.tgt, com)
+	}
+}
+
+func (s *DiffDeltaSuite) TestDiffDeltaMaxSize(c *C) {
+	src := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	tgt := append([]byte("a new line\n"), src...)
+
+	delta := diffDelta(newDeltaIndex(src), src, tgt, 0)
+	c.Assert(PatchDelta(src, delta), DeepEquals, tgt)
+	c.Assert(diffDelta(newDeltaIndex(src), src, tgt, len(delta)), DeepEquals, delta)
+	c.Assert(diffDelta(newDeltaIndex(src), src, tgt, len(delta)-1), IsNil)
+}
+
+func (s *DiffDeltaSuite) TestEncodeLEB128(c *C) {
+	for _, n := range []uint{0, 1, 127, 128, 300, 1 << 20, 1<<32 + 5} {
+		buf := encodeLEB128(nil, n)
+		obtained, rest := decodeLEB128(buf)
+		c.Assert(obtained, Equals, n)
+		c.Assert(rest, HasLen, 0)
+	}
+}
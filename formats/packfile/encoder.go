@@ -0,0 +1,327 @@
+package packfile
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/idxfile"
+)
+
+// EncoderOptions are the options of the delta compression of an Encoder.
+type EncoderOptions struct {
+	// Window is the number of objects, of the same type and with the
+	// closest sizes, tried as delta bases of every object. There is no
+	// delta compression with a Window lower than 1.
+	Window int
+	// Depth is the maximum length of the delta chains, there is no delta
+	// compression with a Depth lower than 1.
+	Depth int
+	// Threads is the number of goroutines looking for delta bases, every
+	// one of them in a different part of the objects, values lower than 1
+	// are taken as 1.
+	Threads int
+}
+
+// DefaultEncoderOptions are the options used by git by default.
+var DefaultEncoderOptions = EncoderOptions{Window: 10, Depth: 50, Threads: 1}
+
+func (o EncoderOptions) deltas() bool {
+	return o.Window > 0 && o.Depth > 0
+}
+
+// An Encoder writes packfiles with the objects of an object storage.
+type Encoder struct {
+	s    core.ObjectStorage
+	opts EncoderOptions
+	idx  *idxfile.Idxfile
+}
+
+// NewEncoder returns a new Encoder writing the objects of s, without delta
+// compression.
+func NewEncoder(s core.ObjectStorage) *Encoder {
+	return &Encoder{s: s}
+}
+
+// NewEncoderWithOptions returns a new Encoder writing the objects of s with
+// the given delta compression options.
+func NewEncoderWithOptions(s core.ObjectStorage, opts EncoderOptions) *Encoder {
+	return &Encoder{s: s, opts: opts}
+}
+
+// Encode writes to w a packfile with the objects with the given hashes, and
+// returns its checksum, the hash written at the end of the packfile, in the
+// format of the storage, see core.ObjectStorageFormat. The repeated hashes
+// are written once, a *core.ErrObjectFormatMismatch is returned if any of
+// them is not in the format of the storage.
+//
+// The objects are written sorted by type, commits first, then tags, trees
+// and blobs, so the objects usually read together are close in the
+// packfile. The order of the given hashes is kept for the objects of the
+// same type, except for the delta bases, written before their deltas, as
+// ofs-deltas.
+func (e *Encoder) Encode(w io.Writer, hashes []core.Hash) (core.Hash, error) {
+	f := core.ObjectStorageFormat(e.s)
+	for _, h := range hashes {
+		if err := core.CheckObjectFormat(f, h); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	objects, err := e.objects(hashes)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	if e.opts.deltas() {
+		if err := e.findDeltas(objects); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	h := f.New()
+	pw := &packWriter{w: io.MultiWriter(w, h), crc: crc32.NewIEEE()}
+
+	if err := writeHeader(pw, uint32(len(objects))); err != nil {
+		return core.ZeroHash, err
+	}
+
+	for _, o := range objects {
+		if err := pw.writeObject(o); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	checksum := core.NewHashFromBytes(f, h.Sum(nil))
+	if _, err := w.Write(checksum.Bytes()); err != nil {
+		return core.ZeroHash, err
+	}
+
+	e.idx = newIdxfile(objects, checksum)
+	return checksum, nil
+}
+
+// Idxfile returns the idx of the last packfile written by Encode, or nil if
+// there is none, to be written with an idxfile.Encoder.
+func (e *Encoder) Idxfile() *idxfile.Idxfile {
+	return e.idx
+}
+
+func newIdxfile(objects []*objectToPack, checksum core.Hash) *idxfile.Idxfile {
+	idx := &idxfile.Idxfile{
+		Format:           checksum.Format(),
+		Version:          idxfile.VersionSupported,
+		Entries:          make([]idxfile.Entry, len(objects)),
+		PackfileChecksum: checksum,
+	}
+
+	for i, o := range objects {
+		idx.Entries[i] = idxfile.Entry{
+			Hash:   o.Hash(),
+			CRC32:  o.crc32,
+			Offset: uint64(o.offset),
+		}
+	}
+
+	return idx
+}
+
+// objectToPack is an object to write in the packfile, as a delta of base
+// if it has one.
+type objectToPack struct {
+	core.Object
+	base  *objectToPack
+	delta []byte
+	depth int // the length of the delta chain of the object
+
+	// used only while looking for the delta bases
+	content []byte
+	index   deltaIndex
+
+	written bool
+	offset  int64
+	crc32   [4]byte // of the entry of the object
+}
+
+// objects returns the objects with the given hashes, without repetitions,
+// in the order they are written.
+func (e *Encoder) objects(hashes []core.Hash) ([]*objectToPack, error) {
+	unique := make([]core.Hash, 0, len(hashes))
+	seen := make(map[core.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		if !seen[h] {
+			seen[h] = true
+			unique = append(unique, h)
+		}
+	}
+
+	objects, err := core.GetMany(e.s, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*objectToPack, len(objects))
+	for i, obj := range objects {
+		result[i] = &objectToPack{Object: obj}
+	}
+
+	sort.Stable(byTypeOrder(result))
+	return result, nil
+}
+
+// typeOrder is the position of the objects of each type in the packfiles
+// written by Encode.
+var typeOrder = map[core.ObjectType]int{
+	core.CommitObject: 0,
+	core.TagObject:    1,
+	core.TreeObject:   2,
+	core.BlobObject:   3,
+}
+
+type byTypeOrder []*objectToPack
+
+func (s byTypeOrder) Len() int { return len(s) }
+func (s byTypeOrder) Less(i, j int) bool {
+	return typeOrder[s[i].Type()] < typeOrder[s[j].Type()]
+}
+func (s byTypeOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func writeHeader(w io.Writer, count uint32) error {
+	if _, err := w.Write([]byte{'P', 'A', 'C', 'K'}); err != nil {
+		return err
+	}
+
+	for _, v := range []uint32{VersionSupported, count} {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packWriter writes the entries of a packfile, keeping their offsets and
+// their CRC32.
+type packWriter struct {
+	w      io.Writer
+	offset int64
+	crc    hash.Hash32
+}
+
+func (w *packWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	w.crc.Write(p[:n])
+	return n, err
+}
+
+// writeObject writes the entry of an object, if it is not already written,
+// writing its delta base first.
+func (w *packWriter) writeObject(o *objectToPack) error {
+	if o.written {
+		return nil
+	}
+
+	if o.base != nil {
+		if err := w.writeObject(o.base); err != nil {
+			return err
+		}
+	}
+
+	o.offset = w.offset
+	o.written = true
+	w.crc.Reset()
+
+	var err error
+	if o.base != nil {
+		err = w.writeDelta(o)
+	} else {
+		err = w.writeUndeltified(o)
+	}
+
+	binary.BigEndian.PutUint32(o.crc32[:], w.crc.Sum32())
+	return err
+}
+
+// writeUndeltified writes the entry of an undeltified object: its type and
+// length, and its zlib compressed content.
+func (w *packWriter) writeUndeltified(o *objectToPack) error {
+	if !o.Type().Valid() {
+		return ErrInvalidObject.AddDetails("type %q", o.Type())
+	}
+
+	if _, err := w.Write(encodeTypeAndLength(o.Type(), o.Size())); err != nil {
+		return err
+	}
+
+	r, err := o.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	zw := zlib.NewWriter(w)
+	n, err := io.Copy(zw, r)
+	if err != nil {
+		zw.Close()
+		return err
+	}
+
+	if n != o.Size() {
+		zw.Close()
+		return ErrInvalidObject.AddDetails("%s: %d bytes read, %d expected",
+			o.Hash(), n, o.Size())
+	}
+
+	return zw.Close()
+}
+
+// writeDelta writes the entry of an ofs-delta: its type and the length of
+// the delta, the negative offset of its base and the zlib compressed delta.
+func (w *packWriter) writeDelta(o *objectToPack) error {
+	header := encodeTypeAndLength(core.OFSDeltaObject, int64(len(o.delta)))
+	header = append(header, encodeNegativeOffset(o.offset-o.base.offset)...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	zw := zlib.NewWriter(w)
+	if _, err := zw.Write(o.delta); err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+// encodeTypeAndLength returns the type and length of an object entry, see
+// readLength.
+func encodeTypeAndLength(t core.ObjectType, length int64) []byte {
+	c := byte(t)<<firstLengthBits | byte(length)&maskFirstLength
+	length >>= firstLengthBits
+
+	var buf []byte
+	for length != 0 {
+		buf = append(buf, c|maskContinue)
+		c = byte(length) & maskLength
+		length >>= lengthBits
+	}
+
+	return append(buf, c)
+}
+
+// encodeNegativeOffset returns the offset of an ofs-delta base, see
+// ReadNegativeOffset.
+func encodeNegativeOffset(offset int64) []byte {
+	buf := []byte{byte(offset) & maskLength}
+	for offset >>= lengthBits; offset != 0; offset >>= lengthBits {
+		offset--
+		buf = append([]byte{maskContinue | byte(offset)&maskLength}, buf...)
+	}
+
+	return buf
+}
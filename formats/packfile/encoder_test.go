@@ -0,0 +1,207 @@
+package packfile
+
+import (
+	"bytes"
+	"crypto/sha1"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+func (s *EncoderSuite) TestEncode(c *C) {
+	s.testEncode(c, EncoderOptions{})
+}
+
+func (s *EncoderSuite) TestEncodeDeltas(c *C) {
+	s.testEncode(c, DefaultEncoderOptions)
+	s.testEncode(c, EncoderOptions{Window: 3, Depth: 1, Threads: 4})
+}
+
+func (s *EncoderSuite) testEncode(c *C, opts EncoderOptions) {
+	for _, file := range []string{
+		"fixtures/git-fixture.ofs-delta",
+		"fixtures/git-fixture.ref-delta",
+		"fixtures/spinnaker-spinnaker.pack",
+	} {
+		com := Commentf("file=%s, options=%+v", file, opts)
+		sto := readFromFile(c, file, UnknownFormat)
+		hashes := storageHashes(sto)
+
+		buf := bytes.NewBuffer(nil)
+		checksum, err := NewEncoderWithOptions(sto, opts).Encode(buf, hashes)
+		c.Assert(err, IsNil, com)
+
+		data := buf.Bytes()
+		c.Assert(checksum.Bytes(), DeepEquals, data[len(data)-20:], com)
+		sum := sha1.Sum(data[:len(data)-20])
+		c.Assert(checksum.Bytes(), DeepEquals, sum[:], com)
+
+		decoded := memory.NewObjectStorage()
+		c.Assert(NewDecoder(NewStream(bytes.NewReader(data))).Decode(decoded), IsNil, com)
+		c.Assert(decoded.Objects, HasLen, len(sto.Objects), com)
+		for h, expected := range sto.Objects {
+			obtained, err := decoded.Get(h)
+			c.Assert(err, IsNil, com)
+			c.Assert(obtained.Type(), Equals, expected.Type(), com)
+			c.Assert(obtained.Content(), DeepEquals, expected.Content(), com)
+		}
+	}
+}
+
+func (s *EncoderSuite) TestEncodeDeltasSize(c *C) {
+	sto := readFromFile(c, "fixtures/spinnaker-spinnaker.pack", UnknownFormat)
+	hashes := storageHashes(sto)
+
+	undeltified := bytes.NewBuffer(nil)
+	_, err := NewEncoder(sto).Encode(undeltified, hashes)
+	c.Assert(err, IsNil)
+
+	deltified := bytes.NewBuffer(nil)
+	_, err = NewEncoderWithOptions(sto, DefaultEncoderOptions).Encode(deltified, hashes)
+	c.Assert(err, IsNil)
+
+	c.Assert(deltified.Len() < undeltified.Len()/2, Equals, true,
+		Commentf("undeltified=%d, deltified=%d", undeltified.Len(), deltified.Len()))
+}
+
+func (s *EncoderSuite) TestFindDeltasDepth(c *C) {
+	sto := readFromFile(c, "fixtures/spinnaker-spinnaker.pack", UnknownFormat)
+	for _, opts := range []EncoderOptions{
+		{Window: 10, Depth: 1, Threads: 1},
+		{Window: 10, Depth: 3, Threads: 3},
+	} {
+		com := Commentf("options=%+v", opts)
+		e := NewEncoderWithOptions(sto, opts)
+		objects, err := e.objects(storageHashes(sto))
+		c.Assert(err, IsNil, com)
+		c.Assert(e.findDeltas(objects), IsNil, com)
+
+		deltas := 0
+		for _, o := range objects {
+			depth := 0
+			for b := o; b.base != nil; b = b.base {
+				c.Assert(b.base.Type(), Equals, o.Type(), com)
+				depth++
+			}
+
+			c.Assert(depth, Equals, o.depth, com)
+			c.Assert(depth <= opts.Depth, Equals, true, com)
+			if depth != 0 {
+				deltas++
+			}
+		}
+
+		c.Assert(deltas > 0, Equals, true, com)
+	}
+}
+
+func (s *EncoderSuite) TestEncodeOrder(c *C) {
+	sto := memory.NewObjectStorage()
+	var hashes []core.Hash
+	for _, obj := range []core.Object{
+		memory.NewObject(core.BlobObject, 3, []byte("foo")),
+		memory.NewObject(core.TreeObject, 0, nil),
+		memory.NewObject(core.BlobObject, 3, []byte("bar")),
+		memory.NewObject(core.TagObject, 3, []byte("tag")),
+		memory.NewObject(core.CommitObject, 6, []byte("commit")),
+	} {
+		h, err := sto.Set(obj)
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	// the repeated hashes are written once
+	hashes = append(hashes, hashes[0])
+
+	buf := bytes.NewBuffer(nil)
+	_, err := NewEncoder(sto).Encode(buf, hashes)
+	c.Assert(err, IsNil)
+
+	p := NewParser(NewStream(buf))
+	count, err := p.ReadHeader()
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, uint32(5))
+
+	var obtained []string
+	for i := 0; i < int(count); i++ {
+		obj, err := p.ReadObject()
+		c.Assert(err, IsNil)
+		obtained = append(obtained, string(obj.Content()))
+	}
+
+	c.Assert(obtained, DeepEquals, []string{"commit", "tag", "", "foo", "bar"})
+}
+
+func (s *EncoderSuite) TestEncodeNotFound(c *C) {
+	_, err := NewEncoder(memory.NewObjectStorage()).Encode(bytes.NewBuffer(nil),
+		[]core.Hash{core.NewHash("ffffffffffffffffffffffffffffffffffffffff")})
+	c.Assert(err, NotNil)
+}
+
+func (s *EncoderSuite) TestEncodeNegativeOffset(c *C) {
+	for _, offset := range []int64{1, 127, 128, 16511, 16512, 2113663, 2113664, 1 << 40} {
+		p := NewParser(NewStream(bytes.NewReader(encodeNegativeOffset(offset))))
+		obtained, err := p.ReadNegativeOffset()
+		c.Assert(err, IsNil)
+		c.Assert(obtained, Equals, -offset)
+
+		_, err = p.ReadByte()
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *EncoderSuite) TestEncodeTypeAndLength(c *C) {
+	for _, length := range []int64{0, 1, 15, 16, 127, 128, 2047, 2048, 1 << 20, 1<<35 + 3} {
+		com := Commentf("length=%d", length)
+		data := encodeTypeAndLength(core.TreeObject, length)
+
+		p := NewParser(NewStream(bytes.NewReader(data)))
+		typ, obtained, err := p.ReadObjectTypeAndLength()
+		c.Assert(err, IsNil, com)
+		c.Assert(typ, Equals, core.TreeObject, com)
+		c.Assert(obtained, Equals, length, com)
+
+		_, err = p.ReadByte()
+		c.Assert(err, NotNil, com)
+	}
+}
+
+func (s *EncoderSuite) BenchmarkEncode(c *C) {
+	s.benchmarkEncode(c, EncoderOptions{})
+}
+
+func (s *EncoderSuite) BenchmarkEncodeDeltas(c *C) {
+	s.benchmarkEncode(c, DefaultEncoderOptions)
+}
+
+func (s *EncoderSuite) benchmarkEncode(c *C, opts EncoderOptions) {
+	sto := readFromFile(c, "fixtures/spinnaker-spinnaker.pack", UnknownFormat)
+	hashes := storageHashes(sto)
+	e := NewEncoderWithOptions(sto, opts)
+
+	c.ResetTimer()
+	var size int
+	for i := 0; i < c.N; i++ {
+		buf := bytes.NewBuffer(nil)
+		_, err := e.Encode(buf, hashes)
+		c.Assert(err, IsNil)
+		size = buf.Len()
+	}
+
+	c.Logf("%d objects, %d bytes", len(hashes), size)
+}
+
+func storageHashes(sto *memory.ObjectStorage) []core.Hash {
+	var hashes []core.Hash
+	for h := range sto.Objects {
+		hashes = append(hashes, h)
+	}
+
+	return hashes
+}
@@ -0,0 +1,37 @@
+#!/bin/bash
+
+# writes thin-base.pack, the packfile of the first commit of a repository
+# with a file of 200 lines, and thin.pack, the thin packfile git sends
+# fetching the second commit, changing a line of the file, from a
+# repository having the first one.
+
+set -e
+
+dir=$(mktemp -d)
+trap "rm -rf ${dir}" EXIT
+
+export GIT_AUTHOR_NAME=Fixture GIT_AUTHOR_EMAIL=fixture@example.com
+export GIT_COMMITTER_NAME=Fixture GIT_COMMITTER_EMAIL=fixture@example.com
+
+pushd ${dir}
+git init -q -b master .
+for i in $(seq 1 200); do
+    echo "line $i of a file big enough to be stored as a delta"
+done > file.txt
+git add file.txt
+GIT_AUTHOR_DATE="2016-07-01T10:00:00Z" GIT_COMMITTER_DATE="2016-07-01T10:00:00Z" \
+    git commit -qm "first"
+first=$(git rev-parse HEAD)
+
+sed -i 's/^line 100 of/line one hundred of/' file.txt
+GIT_AUTHOR_DATE="2016-07-01T11:00:00Z" GIT_COMMITTER_DATE="2016-07-01T11:00:00Z" \
+    git commit -qam "second"
+second=$(git rev-parse HEAD)
+
+git rev-list --objects ${first} | git pack-objects -q --delta-base-offset --stdout > base.pack
+printf "0046want ${second} thin-pack ofs-delta\n00000032have ${first}\n0009done\n" |
+    git upload-pack --stateless-rpc . > response
+popd
+
+cp ${dir}/base.pack ./thin-base.pack
+tail -c +$(($(grep -abo PACK ${dir}/response | head -1 | cut -d: -f1) + 1)) ${dir}/response > ./thin.pack
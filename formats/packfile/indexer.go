@@ -0,0 +1,376 @@
+package packfile
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/idxfile"
+)
+
+// DefaultIndexerCacheSize is the default maximum size of the delta bases
+// cached by an Indexer.
+const DefaultIndexerCacheSize = 16 * 1024 * 1024
+
+// Indexer reads a packfile in one pass, as git index-pack does, storing
+// every object as soon as it is read and returning its idx file. Unlike
+// Decoder, the objects read are not kept in memory: only the delta bases
+// recently read are cached, by offset, up to CacheSize bytes, and the ones
+// not cached are read again from Packfile, or from the storage the objects
+// are stored into. The memory used is roughly the size of the largest
+// object plus CacheSize.
+type Indexer struct {
+	// MaxObjectsLimit is the limit of objects in the packfile, see
+	// Decoder.MaxObjectsLimit.
+	MaxObjectsLimit uint32
+	// Progress, if not nil, receives the progress of the indexing as git
+	// writes it, "Indexing objects:  50% (21/42)\r", see Decoder.Progress.
+	Progress io.Writer
+	// Bases is the storage of the delta bases that are not in the
+	// packfile, see Decoder.Bases. The storage the objects are stored into
+	// is used if it is nil.
+	Bases core.ObjectStorage
+	// CacheSize is the maximum size of the delta bases cached, the objects
+	// bigger than it are never cached.
+	CacheSize int64
+	// Packfile, if not nil, is used to read again the delta bases that are
+	// not cached, it is usually another handle of the file the packfile is
+	// read from. It is required if the objects are not stored, see Index.
+	Packfile io.ReadSeeker
+	// Format is the format of the hashes of the objects, and of the
+	// checksum, when they are not stored. The one of the storage they are
+	// stored into is used otherwise, see core.ObjectStorageFormat.
+	Format core.ObjectFormat
+
+	r        *indexReader
+	format   core.ObjectFormat
+	s        core.ObjectStorage
+	external *externalBases
+	cache    *offsetCache
+	offsets  map[core.Hash]int64
+	hashes   map[int64]core.Hash
+}
+
+// NewIndexer returns a new Indexer that reads the packfile from r.
+func NewIndexer(r io.Reader) *Indexer {
+	return &Indexer{
+		MaxObjectsLimit: DefaultMaxObjectsLimit,
+		CacheSize:       DefaultIndexerCacheSize,
+
+		r: newIndexReader(r),
+	}
+}
+
+// Index reads the packfile, stores its objects in s and returns its idx
+// file, with the entries in the order they are in the packfile. The objects
+// are only indexed if s is nil, and then the delta bases not cached are
+// read from Packfile. ErrBadChecksum is returned if the checksum at the end
+// of the packfile is not the one of its content.
+func (ix *Indexer) Index(s core.ObjectStorage) (*idxfile.Idxfile, error) {
+	ix.s = s
+	ix.format = ix.Format
+	if s != nil {
+		ix.format = core.ObjectStorageFormat(s)
+	}
+
+	ix.r.sha = ix.format.New()
+	ix.external = &externalBases{ObjectStorage: ix.Bases, seen: make(map[core.Hash]bool)}
+	if ix.Bases == nil {
+		ix.external.ObjectStorage = s
+	}
+
+	ix.cache = newOffsetCache(ix.CacheSize)
+	ix.offsets = make(map[core.Hash]int64, 0)
+	ix.hashes = make(map[int64]core.Hash, 0)
+
+	p := &Parser{ReadRecaller: &indexRecaller{indexReader: ix.r, ix: ix}, Format: ix.format}
+	if ix.external.ObjectStorage != nil {
+		p.bases = ix.external
+	}
+
+	count, err := p.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if count > ix.MaxObjectsLimit {
+		return nil, ErrMaxObjectsLimitReached.AddDetails("%d", count)
+	}
+
+	idx := &idxfile.Idxfile{
+		Format:  ix.format,
+		Version: idxfile.VersionSupported,
+		Entries: make([]idxfile.Entry, 0, count),
+	}
+
+	if err := ix.readObjects(p, count, idx); err != nil {
+		return nil, err
+	}
+
+	checksum := ix.r.sha.Sum(nil)
+	trailer := make([]byte, ix.format.Size())
+	if _, err := io.ReadFull(ix.r, trailer); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(checksum, trailer) {
+		return nil, ErrBadChecksum
+	}
+
+	idx.PackfileChecksum = core.NewHashFromBytes(ix.format, trailer)
+
+	return idx, nil
+}
+
+func (ix *Indexer) readObjects(p *Parser, count uint32, idx *idxfile.Idxfile) error {
+	progress := &progress{w: ix.Progress, title: "Indexing objects", total: count}
+	defer progress.done()
+
+	for i := 0; i < int(count); i++ {
+		start := ix.r.offset
+		ix.r.crc.Reset()
+
+		obj, err := p.ReadObject()
+		if err != nil {
+			return err
+		}
+
+		e := idxfile.Entry{Hash: obj.Hash(), Offset: uint64(start)}
+		binary.BigEndian.PutUint32(e.CRC32[:], ix.r.crc.Sum32())
+		idx.Entries = append(idx.Entries, e)
+
+		if err := ix.remember(start, obj); err != nil {
+			return err
+		}
+
+		if ix.s != nil {
+			if _, err := ix.s.Set(obj); err != nil {
+				return err
+			}
+		}
+
+		progress.update(uint32(i + 1))
+	}
+
+	return nil
+}
+
+func (ix *Indexer) remember(offset int64, obj core.Object) error {
+	h := obj.Hash()
+	if _, ok := ix.offsets[h]; ok {
+		return ErrDuplicatedObject.AddDetails("with hash %s", h)
+	}
+
+	ix.offsets[h] = offset
+	ix.hashes[offset] = h
+	ix.cache.add(offset, obj)
+	return nil
+}
+
+// recall returns the object at the given offset, from the cache, or
+// reading it again from Packfile or from the storage the objects are stored
+// into, and caches it.
+func (ix *Indexer) recall(offset int64) (obj core.Object, err error) {
+	if obj, ok := ix.cache.get(offset); ok {
+		return obj, nil
+	}
+
+	h, ok := ix.hashes[offset]
+	if !ok {
+		return nil, ErrCannotRecall.AddDetails("no object found at offset %d", offset)
+	}
+
+	switch {
+	case ix.Packfile != nil:
+		obj, err = ix.reread(offset)
+	case ix.s != nil:
+		obj, err = ix.s.Get(h)
+	default:
+		err = ErrCannotRecall.AddDetails("by offset %d", offset)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ix.cache.add(offset, obj)
+	return obj, nil
+}
+
+// reread reads the object at the given offset from Packfile, solving its
+// own deltas with recall, and restores the position of Packfile, as the
+// object could be a delta base of another one being read from it.
+func (ix *Indexer) reread(offset int64) (obj core.Object, err error) {
+	before, err := ix.Packfile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_, seekErr := ix.Packfile.Seek(before, os.SEEK_SET)
+		if err == nil {
+			err = seekErr
+		}
+	}()
+
+	if _, err := ix.Packfile.Seek(offset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	r := &indexReader{r: bufio.NewReader(ix.Packfile), offset: offset}
+	p := NewParser(&indexRecaller{indexReader: r, ix: ix})
+	p.Format = ix.format
+	return p.ReadObject()
+}
+
+// ExternalBases returns the hashes of the delta bases of the last packfile
+// indexed that are not in it, sorted, see Decoder.ExternalBases.
+func (ix *Indexer) ExternalBases() []core.Hash {
+	if ix.external == nil {
+		return nil
+	}
+
+	hashes := make([]core.Hash, len(ix.external.hashes))
+	copy(hashes, ix.external.hashes)
+	core.SortHashes(hashes)
+	return hashes
+}
+
+// indexReader is a buffered reader of a packfile keeping the offset of the
+// bytes read, and, when they are not nil, the checksum of all of them and
+// the CRC32 of the ones read since it was reset.
+type indexReader struct {
+	r      *bufio.Reader
+	offset int64
+	sha    hash.Hash
+	crc    hash.Hash32
+}
+
+func newIndexReader(r io.Reader) *indexReader {
+	return &indexReader{
+		r:   bufio.NewReader(r),
+		crc: crc32.NewIEEE(),
+	}
+}
+
+// Read reads up to len(p) bytes into p.
+func (r *indexReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.consume(p[:n])
+	return n, err
+}
+
+// ReadByte reads a byte.
+func (r *indexReader) ReadByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	r.consume([]byte{c})
+	return c, nil
+}
+
+func (r *indexReader) consume(p []byte) {
+	r.offset += int64(len(p))
+	if r.sha != nil {
+		r.sha.Write(p)
+		r.crc.Write(p)
+	}
+}
+
+// Offset returns the offset of the next byte read.
+func (r *indexReader) Offset() (int64, error) {
+	return r.offset, nil
+}
+
+// indexRecaller is the ReadRecaller of the parsers of an Indexer, which
+// remembers and recalls the objects.
+type indexRecaller struct {
+	*indexReader
+	ix *Indexer
+}
+
+// Remember remembers the offset and hash of the object, caching it.
+func (r *indexRecaller) Remember(o int64, obj core.Object) error {
+	return r.ix.remember(o, obj)
+}
+
+// ForgetAll does nothing, the objects are remembered until the next call to
+// Index.
+func (r *indexRecaller) ForgetAll() {}
+
+// RecallByHash returns the object with the given hash, see RecallByOffset.
+func (r *indexRecaller) RecallByHash(h core.Hash) (core.Object, error) {
+	o, ok := r.ix.offsets[h]
+	if !ok {
+		return nil, ErrCannotRecall.AddDetails("by hash %s", h)
+	}
+
+	return r.ix.recall(o)
+}
+
+// RecallByOffset returns the object at the given offset, from the cache or
+// reading it again.
+func (r *indexRecaller) RecallByOffset(o int64) (core.Object, error) {
+	return r.ix.recall(o)
+}
+
+// offsetCache is a LRU cache of objects by offset, bounded by the sum of
+// their sizes.
+type offsetCache struct {
+	maxBytes int64
+	size     int64
+	lru      *list.List // of *cachedBase, the most recently used first
+	objects  map[int64]*list.Element
+}
+
+type cachedBase struct {
+	offset int64
+	obj    core.Object
+}
+
+func newOffsetCache(maxBytes int64) *offsetCache {
+	return &offsetCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		objects:  make(map[int64]*list.Element, 0),
+	}
+}
+
+func (c *offsetCache) get(offset int64) (core.Object, bool) {
+	e, ok := c.objects[offset]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBase).obj, true
+}
+
+func (c *offsetCache) add(offset int64, obj core.Object) {
+	size := obj.Size()
+	if size > c.maxBytes {
+		return
+	}
+
+	if _, ok := c.objects[offset]; ok {
+		return
+	}
+
+	for c.size+size > c.maxBytes {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.objects, e.Value.(*cachedBase).offset)
+		c.size -= e.Value.(*cachedBase).obj.Size()
+	}
+
+	c.objects[offset] = c.lru.PushFront(&cachedBase{offset: offset, obj: obj})
+	c.size += size
+}
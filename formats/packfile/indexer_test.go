@@ -0,0 +1,193 @@
+package packfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/idxfile"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type IndexerSuite struct{}
+
+var _ = Suite(&IndexerSuite{})
+
+func (s *IndexerSuite) TestIndex(c *C) {
+	data, err := ioutil.ReadFile("fixtures/spinnaker-spinnaker.pack")
+	c.Assert(err, IsNil)
+
+	sto := memory.NewObjectStorage()
+	idx, err := NewIndexer(bytes.NewReader(data)).Index(sto)
+	c.Assert(err, IsNil)
+	assertSameObjects(c, sto, readFromFile(c, "fixtures/spinnaker-spinnaker.pack", UnknownFormat))
+
+	// the idx file generated is the one generated by git
+	expected, err := ioutil.ReadFile("fixtures/spinnaker-spinnaker.idx")
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	_, err = idxfile.NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+	c.Assert(buf.Bytes(), DeepEquals, expected)
+}
+
+func (s *IndexerSuite) TestIndexDeltas(c *C) {
+	for _, file := range []string{
+		"fixtures/git-fixture.ofs-delta",
+		"fixtures/git-fixture.ref-delta",
+	} {
+		com := Commentf("file=%s", file)
+		data, err := ioutil.ReadFile(file)
+		c.Assert(err, IsNil, com)
+
+		sto := memory.NewObjectStorage()
+		idx, err := NewIndexer(bytes.NewReader(data)).Index(sto)
+		c.Assert(err, IsNil, com)
+		c.Assert(idx.Entries, HasLen, len(sto.Objects), com)
+		c.Assert(idx.PackfileChecksum.Bytes(), DeepEquals, data[len(data)-20:], com)
+		assertSameObjects(c, sto, readFromFile(c, file, UnknownFormat))
+	}
+}
+
+// syntheticPack returns a packfile of deltified blobs, every one of them
+// the previous one with some random lines appended, bigger than the given
+// size.
+func syntheticPack(c *C, size int) ([]byte, *memory.ObjectStorage) {
+	sto := memory.NewObjectStorage()
+	rnd := rand.New(rand.NewSource(42))
+	var content []byte
+	var hashes []core.Hash
+	for n := 0; n < size/128; n++ {
+		for i := 0; i < 16; i++ {
+			content = append(content, fmt.Sprintf("%032x\n", rnd.Int63())...)
+		}
+
+		obj := memory.NewObject(core.BlobObject, int64(len(content)), append([]byte(nil), content...))
+		h, err := sto.Set(obj)
+		c.Assert(err, IsNil)
+		hashes = append(hashes, h)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err := NewEncoderWithOptions(sto, DefaultEncoderOptions).Encode(buf, hashes)
+	c.Assert(err, IsNil)
+	return buf.Bytes(), sto
+}
+
+func (s *IndexerSuite) TestIndexBoundedCache(c *C) {
+	const cacheSize = 16 * 1024
+	data, expected := syntheticPack(c, cacheSize)
+	c.Assert(len(data) > cacheSize, Equals, true, Commentf("size=%d", len(data)))
+
+	sto := &countingStorage{ObjectStorage: memory.NewObjectStorage()}
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.CacheSize = cacheSize
+	idx, err := ix.Index(sto)
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, len(expected.Objects))
+	assertSameObjects(c, sto.ObjectStorage.(*memory.ObjectStorage), expected)
+
+	// the bases evicted from the cache are read again from the storage
+	c.Assert(ix.cache.size <= cacheSize, Equals, true)
+	c.Assert(sto.gets > 0, Equals, true)
+}
+
+func (s *IndexerSuite) TestIndexPackfileNotStored(c *C) {
+	const cacheSize = 16 * 1024
+	data, expected := syntheticPack(c, cacheSize)
+
+	stored := memory.NewObjectStorage()
+	expectedIdx, err := NewIndexer(bytes.NewReader(data)).Index(stored)
+	c.Assert(err, IsNil)
+
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.CacheSize = cacheSize
+	ix.Packfile = bytes.NewReader(data)
+	idx, err := ix.Index(nil)
+	c.Assert(err, IsNil)
+	c.Assert(idx, DeepEquals, expectedIdx)
+	c.Assert(len(idx.Entries), Equals, len(expected.Objects))
+}
+
+func (s *IndexerSuite) TestIndexNotStoredWithoutPackfile(c *C) {
+	data, _ := syntheticPack(c, 1024)
+
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.CacheSize = 1024
+	_, err := ix.Index(nil)
+	c.Assert(err, ErrorMatches, "cannot recall object: by offset .*")
+}
+
+func (s *IndexerSuite) TestIndexProgress(c *C) {
+	data, err := ioutil.ReadFile("fixtures/git-fixture.ofs-delta")
+	c.Assert(err, IsNil)
+
+	progress := bytes.NewBuffer(nil)
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.Progress = progress
+	_, err = ix.Index(memory.NewObjectStorage())
+	c.Assert(err, IsNil)
+	c.Assert(progress.String(), Matches, "Indexing objects:   3% \\(1/28\\)\r"+
+		".*Indexing objects: 100% \\(28/28\\), done.\n")
+}
+
+func (s *IndexerSuite) TestIndexThin(c *C) {
+	data, err := ioutil.ReadFile("fixtures/thin.pack")
+	c.Assert(err, IsNil)
+
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.Bases = readFromFile(c, "fixtures/thin-base.pack", OFSDeltaFormat)
+	sto := memory.NewObjectStorage()
+	_, err = ix.Index(sto)
+	c.Assert(err, IsNil)
+	c.Assert(ix.ExternalBases(), DeepEquals, []core.Hash{thinBase})
+
+	blob, err := sto.Get(thinBlob)
+	c.Assert(err, IsNil)
+	c.Assert(blob.Hash(), Equals, thinBlob)
+}
+
+func (s *IndexerSuite) TestIndexBadChecksum(c *C) {
+	data, err := ioutil.ReadFile("fixtures/git-fixture.ofs-delta")
+	c.Assert(err, IsNil)
+	data[len(data)-1]++
+
+	_, err = NewIndexer(bytes.NewReader(data)).Index(memory.NewObjectStorage())
+	c.Assert(err, Equals, ErrBadChecksum)
+}
+
+func (s *IndexerSuite) TestIndexMaxObjectsLimit(c *C) {
+	data, err := ioutil.ReadFile("fixtures/git-fixture.ofs-delta")
+	c.Assert(err, IsNil)
+
+	ix := NewIndexer(bytes.NewReader(data))
+	ix.MaxObjectsLimit = 1
+	_, err = ix.Index(memory.NewObjectStorage())
+	c.Assert(err, ErrorMatches, "max. objects limit reached: 28")
+}
+
+func assertSameObjects(c *C, obtained, expected *memory.ObjectStorage) {
+	c.Assert(obtained.Objects, HasLen, len(expected.Objects))
+	for h, e := range expected.Objects {
+		o, err := obtained.Get(h)
+		c.Assert(err, IsNil)
+		c.Assert(o.Type(), Equals, e.Type())
+		c.Assert(o.Content(), DeepEquals, e.Content())
+	}
+}
+
+// countingStorage counts the objects read from an ObjectStorage.
+type countingStorage struct {
+	core.ObjectStorage
+	gets int
+}
+
+func (s *countingStorage) Get(h core.Hash) (core.Object, error) {
+	s.gets++
+	return s.ObjectStorage.Get(h)
+}
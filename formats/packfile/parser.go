@@ -30,6 +30,12 @@ const (
 // Values from this type are not zero-value safe. See the NewParser function bellow.
 type Parser struct {
 	ReadRecaller
+	// Format is the format of the hashes of the objects, and of the bases
+	// of the ref-deltas, SHA1 by default.
+	Format core.ObjectFormat
+	// bases are the delta bases of the ref-deltas that are not in the
+	// packfile, see Decoder.Bases.
+	bases core.ObjectStorage
 }
 
 // NewParser returns a new Parser that reads from the packfile represented by r.
@@ -201,7 +207,7 @@ func (p Parser) ReadObject() (core.Object, error) {
 		return nil, err
 	}
 
-	return memory.NewObject(typ, int64(len(cont)), cont), nil
+	return memory.NewObjectWithFormat(p.Format, typ, int64(len(cont)), cont), nil
 }
 
 // ReadNonDeltaObjectContent reads and returns a non-deltified object
@@ -238,7 +244,9 @@ func (p Parser) inflate(w io.Writer) (err error) {
 }
 
 // ReadREFDeltaObjectContent reads and returns an object specified by a
-// REF-Delta entry in the packfile, form the hash onwards.
+// REF-Delta entry in the packfile, form the hash onwards. The bases that are
+// not in the packfile, the ones of the thin packs, are read from the bases
+// of the parser, if any.
 func (p Parser) ReadREFDeltaObjectContent() ([]byte, core.ObjectType, error) {
 	refHash, err := p.ReadHash()
 	if err != nil {
@@ -246,6 +254,15 @@ func (p Parser) ReadREFDeltaObjectContent() ([]byte, core.ObjectType, error) {
 	}
 
 	refObj, err := p.RecallByHash(refHash)
+	if err != nil && p.bases != nil {
+		var baseErr error
+		if refObj, baseErr = p.bases.Get(refHash); baseErr == nil {
+			err = nil
+		} else if baseErr != core.ErrObjectNotFound {
+			err = baseErr
+		}
+	}
+
 	if err != nil {
 		return nil, core.ObjectType(0), err
 	}
@@ -258,14 +275,14 @@ func (p Parser) ReadREFDeltaObjectContent() ([]byte, core.ObjectType, error) {
 	return content, refObj.Type(), nil
 }
 
-// ReadHash reads a hash.
+// ReadHash reads a hash in the format of the parser.
 func (p Parser) ReadHash() (core.Hash, error) {
 	var h core.Hash
-	if _, err := io.ReadFull(p, h[:]); err != nil {
+	if _, err := io.ReadFull(p, h[:p.Format.Size()]); err != nil {
 		return core.ZeroHash, err
 	}
 
-	return h, nil
+	return core.NewHashFromBytes(p.Format, h[:]), nil
 }
 
 // ReadSolveDelta reads and returns the base patched with the contents
@@ -328,10 +345,9 @@ func (p Parser) ReadOFSDeltaObjectContent(start int64) (
 //
 // This is how the offset is saved in C:
 //
-//     dheader[pos] = ofs & 127;
-//     while (ofs >>= 7)
-//         dheader[--pos] = 128 | (--ofs & 127);
-//
+//	dheader[pos] = ofs & 127;
+//	while (ofs >>= 7)
+//	    dheader[--pos] = 128 | (--ofs & 127);
 func (p Parser) ReadNegativeOffset() (int64, error) {
 	var c byte
 	var err error
@@ -0,0 +1,100 @@
+package packfile
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ErrBadChecksum is returned by FixThin when the checksum at the end of the
+// packfile is not the one of its content.
+var ErrBadChecksum = NewError("malformed pack file checksum")
+
+// FixThin writes to w the thin packfile read from r completed with the
+// given bases, the objects its ref-deltas refer to that are not in it, see
+// Decoder.ExternalBases, as git index-pack --fix-thin does, returning the
+// new checksum. The bases are written undeltified before the entries of the
+// thin packfile, instead of after them, so the packfile can be decoded in
+// one pass; the offsets of the ofs-deltas are relative, so the entries are
+// copied as they are.
+func FixThin(w io.Writer, r io.Reader, bases []core.Object) (core.Hash, error) {
+	return FixThinWithFormat(w, r, core.SHA1, bases)
+}
+
+// FixThinWithFormat completes the thin packfile read from r as FixThin does,
+// for the packfiles of the repositories of the given format. The bases must
+// be in the same format, a *core.ErrObjectFormatMismatch is returned
+// otherwise.
+func FixThinWithFormat(w io.Writer, r io.Reader, f core.ObjectFormat, bases []core.Object) (core.Hash, error) {
+	for _, b := range bases {
+		if err := core.CheckObjectFormat(f, b.Hash()); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	p := NewParser(NewStream(r))
+	count, err := p.ReadHeader()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	h := f.New()
+	pw := &packWriter{w: io.MultiWriter(w, h), crc: crc32.NewIEEE()}
+	if err := writeHeader(pw, count+uint32(len(bases))); err != nil {
+		return core.ZeroHash, err
+	}
+
+	for _, b := range bases {
+		if err := pw.writeObject(&objectToPack{Object: b}); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	// the entries are copied as they are, checking the old checksum
+	old := f.New()
+	if err := writeHeader(old, count); err != nil {
+		return core.ZeroHash, err
+	}
+
+	t := &trailerWriter{w: io.MultiWriter(pw, old), size: f.Size()}
+	if _, err := io.Copy(t, p); err != nil {
+		return core.ZeroHash, err
+	}
+
+	if len(t.trailer) != f.Size() || !bytes.Equal(t.trailer, old.Sum(nil)) {
+		return core.ZeroHash, ErrBadChecksum
+	}
+
+	checksum := core.NewHashFromBytes(f, h.Sum(nil))
+	if _, err := w.Write(checksum.Bytes()); err != nil {
+		return core.ZeroHash, err
+	}
+
+	return checksum, nil
+}
+
+// trailerWriter writes all but the last size bytes written, the checksum of
+// the packfile, which are kept in trailer.
+type trailerWriter struct {
+	w       io.Writer
+	size    int
+	trailer []byte
+}
+
+func (t *trailerWriter) Write(p []byte) (int, error) {
+	buf := append(t.trailer, p...)
+	if len(buf) <= t.size {
+		t.trailer = buf
+		return len(p), nil
+	}
+
+	n := len(buf) - t.size
+	if _, err := t.w.Write(buf[:n]); err != nil {
+		return 0, err
+	}
+
+	t.trailer = append([]byte(nil), buf[n:]...)
+	return len(p), nil
+}
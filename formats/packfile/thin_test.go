@@ -0,0 +1,78 @@
+package packfile
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+// the blobs of fixtures/thin.pack and its base, see
+// fixtures/getthinpack.bash
+var (
+	thinBlob = core.NewHash("0dc1c74dab291f0c7b35680dafb390bf97a40ffe")
+	thinBase = core.NewHash("11ff56e20e8a30201eb057e9ade09fcc4e6db569")
+)
+
+func (s *ReaderSuite) TestDecodeThin(c *C) {
+	data, err := ioutil.ReadFile("fixtures/thin.pack")
+	c.Assert(err, IsNil)
+
+	d := NewDecoder(NewStream(bytes.NewReader(data)))
+	d.Bases = readFromFile(c, "fixtures/thin-base.pack", OFSDeltaFormat)
+	sto := memory.NewObjectStorage()
+	c.Assert(d.Decode(sto), IsNil)
+	c.Assert(sto.Commits, HasLen, 1)
+	c.Assert(sto.Trees, HasLen, 1)
+	c.Assert(sto.Blobs, HasLen, 1)
+	c.Assert(d.ExternalBases(), DeepEquals, []core.Hash{thinBase})
+
+	blob, err := sto.Get(thinBlob)
+	c.Assert(err, IsNil)
+	c.Assert(blob.Hash(), Equals, thinBlob)
+}
+
+func (s *ReaderSuite) TestDecodeThinBaseNotFound(c *C) {
+	data, err := ioutil.ReadFile("fixtures/thin.pack")
+	c.Assert(err, IsNil)
+
+	d := NewDecoder(NewStream(bytes.NewReader(data)))
+	err = d.Decode(memory.NewObjectStorage())
+	c.Assert(err, ErrorMatches, "cannot recall object: by hash "+thinBase.String())
+}
+
+func (s *ReaderSuite) TestFixThin(c *C) {
+	data, err := ioutil.ReadFile("fixtures/thin.pack")
+	c.Assert(err, IsNil)
+
+	bases := readFromFile(c, "fixtures/thin-base.pack", OFSDeltaFormat)
+	base, err := bases.Get(thinBase)
+	c.Assert(err, IsNil)
+
+	fixed := bytes.NewBuffer(nil)
+	checksum, err := FixThin(fixed, bytes.NewReader(data), []core.Object{base})
+	c.Assert(err, IsNil)
+	c.Assert(fixed.Bytes()[fixed.Len()-20:], DeepEquals, checksum.Bytes())
+
+	// the packfile fixed is decoded without any other object
+	d := NewDecoder(NewStream(bytes.NewReader(fixed.Bytes())))
+	sto := memory.NewObjectStorage()
+	c.Assert(d.Decode(sto), IsNil)
+	c.Assert(d.ExternalBases(), HasLen, 0)
+	c.Assert(sto.Blobs, HasLen, 2)
+
+	_, err = sto.Get(thinBlob)
+	c.Assert(err, IsNil)
+}
+
+func (s *ReaderSuite) TestFixThinBadChecksum(c *C) {
+	data, err := ioutil.ReadFile("fixtures/thin.pack")
+	c.Assert(err, IsNil)
+	data[len(data)-1]++
+
+	_, err = FixThin(ioutil.Discard, bytes.NewReader(data), nil)
+	c.Assert(err, Equals, ErrBadChecksum)
+}
@@ -3,6 +3,7 @@ package pktline
 import (
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	. "gopkg.in/check.v1"
 )
@@ -21,6 +22,14 @@ func (s *DecoderSuite) TestReadLine(c *C) {
 	c.Assert(line, Equals, "a\n")
 }
 
+func (s *DecoderSuite) TestReadLineShortReads(c *C) {
+	j := NewDecoder(iotest.OneByteReader(strings.NewReader("0006a\n0006b\n")))
+
+	lines, err := j.ReadAll()
+	c.Assert(err, IsNil)
+	c.Assert(lines, DeepEquals, []string{"a\n", "b\n"})
+}
+
 func (s *DecoderSuite) TestReadLineInvalidHeader(c *C) {
 	j := NewDecoder(strings.NewReader("foo\n"))
 
@@ -0,0 +1,400 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// FsckSeverity is the severity of a FsckIssue.
+type FsckSeverity int
+
+const (
+	// FsckError is the severity of the issues that break the repository,
+	// like missing or malformed objects.
+	FsckError FsckSeverity = iota
+	// FsckWarning is the severity of the issues git would refuse to write,
+	// but that can still be read, like the invalid tree entry names.
+	FsckWarning
+	// FsckDangling is the severity of the dangling objects, the unreachable
+	// objects no other unreachable object points to.
+	FsckDangling
+)
+
+func (s FsckSeverity) String() string {
+	switch s {
+	case FsckError:
+		return "error"
+	case FsckWarning:
+		return "warning"
+	case FsckDangling:
+		return "dangling"
+	default:
+		return "unknown"
+	}
+}
+
+// FsckIssue is an issue found by Fsck.
+type FsckIssue struct {
+	Severity FsckSeverity
+	// Hash is the hash of the object with the issue, the missing one for
+	// the missing objects.
+	Hash        core.Hash
+	Description string
+}
+
+func (i FsckIssue) String() string {
+	return fmt.Sprintf("%s %s: %s", i.Severity, i.Hash, i.Description)
+}
+
+// FsckOptions are the options of Fsck.
+type FsckOptions struct {
+	// References are the names of the references the walk starts from,
+	// every reference of the repository and HEAD if empty. The dangling
+	// objects are only looked for when every reference is walked, as the
+	// objects reachable from the other references would be reported
+	// otherwise, so a few references of a huge repository can be checked
+	// without reading all its objects.
+	References []core.ReferenceName
+}
+
+// Fsck checks the integrity of the repository, as git fsck does, returning
+// the issues found sorted by severity and hash: every object reachable from
+// the references must exist, have the type it is referenced with and be
+// parsed; the trees of the commits, their parents, but for the shallow
+// commits, and the targets of the tags must exist, and the names of the
+// tree entries must not be empty, "." or "..", nor have a slash or a NUL
+// byte. The storage can be wrapped with core.NewVerifyingObjectStorage to
+// check the hashes of the objects too, the corrupted ones are then reported
+// as issues as well.
+//
+// The errors reading the storage are returned as they are, the issues are
+// the problems found in the objects read.
+func (r *Repository) Fsck(opts FsckOptions) ([]FsckIssue, error) {
+	f := &fsck{r: r, seen: make(map[core.Hash]core.ObjectType)}
+
+	shallows, err := r.shallows()
+	if err != nil {
+		return nil, err
+	}
+
+	f.shallow = make(map[core.Hash]bool, len(shallows))
+	for _, h := range shallows {
+		f.shallow[h] = true
+	}
+
+	names := opts.References
+	if len(names) == 0 {
+		if names, err = r.referenceNames(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, n := range names {
+		ref, err := core.ResolveReference(r.References, n)
+		if err == core.ErrReferenceNotFound && n == core.HEAD && len(opts.References) == 0 {
+			continue // unborn branch
+		}
+
+		if err == core.ErrReferenceNotFound || err == core.ErrReferenceLoop {
+			f.issues = append(f.issues, FsckIssue{
+				Severity:    FsckError,
+				Description: fmt.Sprintf("invalid reference %s: %s", n, err),
+			})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		f.push(ref.Hash, 0, "reference "+n.String())
+	}
+
+	if err := f.walk(); err != nil {
+		return nil, err
+	}
+
+	if len(opts.References) == 0 {
+		if err := f.dangling(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Stable(fsckIssuesBySeverity(f.issues))
+	return f.issues, nil
+}
+
+// referenceNames returns the names of every reference of the repository,
+// HEAD included.
+func (r *Repository) referenceNames() ([]core.ReferenceName, error) {
+	iter, err := r.References.Iter()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	names := []core.ReferenceName{core.HEAD}
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ref.Name != core.HEAD {
+			names = append(names, ref.Name)
+		}
+	}
+}
+
+// fsck is the state of a Fsck.
+type fsck struct {
+	r       *Repository
+	shallow map[core.Hash]bool
+	seen    map[core.Hash]core.ObjectType // zero for the missing objects
+	pending []fsckObject
+	issues  []FsckIssue
+}
+
+// fsckObject is an object to check, with the type it is referenced with, if
+// known, and who references it, for the issues.
+type fsckObject struct {
+	h    core.Hash
+	t    core.ObjectType
+	from string
+}
+
+func (f *fsck) push(h core.Hash, t core.ObjectType, from string) {
+	o := fsckObject{h: h, t: t, from: from}
+	if !f.checkSeen(o) {
+		f.pending = append(f.pending, o)
+	}
+}
+
+// checkSeen returns true if the object was already checked, checking that
+// it has the type it is referenced with this time.
+func (f *fsck) checkSeen(o fsckObject) bool {
+	t, ok := f.seen[o.h]
+	if ok && t != 0 && o.t != 0 && t != o.t {
+		f.issue(FsckError, o.h, "%s is a %s, referenced by %s", o.t, t, o.from)
+	}
+
+	return ok
+}
+
+func (f *fsck) issue(s FsckSeverity, h core.Hash, format string, args ...interface{}) {
+	f.issues = append(f.issues, FsckIssue{Severity: s, Hash: h, Description: fmt.Sprintf(format, args...)})
+}
+
+func (f *fsck) walk() error {
+	for len(f.pending) != 0 {
+		o := f.pending[len(f.pending)-1]
+		f.pending = f.pending[:len(f.pending)-1]
+		if f.checkSeen(o) {
+			continue
+		}
+
+		f.seen[o.h] = 0
+		if err := f.check(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check checks an object, pushing the objects it references.
+func (f *fsck) check(o fsckObject) error {
+	what := "object"
+	if o.t != 0 {
+		what = o.t.String()
+	}
+
+	obj, err := f.r.getObject(o.h)
+	if err == core.ErrObjectNotFound {
+		f.issue(FsckError, o.h, "missing %s, referenced by %s", what, o.from)
+		return nil
+	}
+
+	if corrupted, ok := err.(*core.ErrObjectCorrupted); ok {
+		f.issue(FsckError, o.h, "corrupted %s, computed hash %s", what, corrupted.Actual)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	f.seen[o.h] = obj.Type()
+	if o.t != 0 && obj.Type() != o.t {
+		f.issue(FsckError, o.h, "%s is a %s, referenced by %s", what, obj.Type(), o.from)
+		return nil
+	}
+
+	decoded, err := f.r.decodeObject(obj)
+	if err != nil {
+		f.issue(FsckError, o.h, "cannot parse %s: %s", obj.Type(), err)
+		return nil
+	}
+
+	switch d := decoded.(type) {
+	case *Commit:
+		f.checkCommit(d)
+	case *Tree:
+		f.checkTree(d)
+	case *Tag:
+		if d.Target.IsZero() {
+			f.issue(FsckError, d.Hash, "tag without target")
+			break
+		}
+
+		f.push(d.Target, d.TargetType, "tag "+d.Hash.String())
+	}
+
+	return nil
+}
+
+func (f *fsck) checkCommit(c *Commit) {
+	from := "commit " + c.Hash.String()
+	if c.TreeHash.IsZero() {
+		f.issue(FsckError, c.Hash, "commit without tree")
+	} else {
+		f.push(c.TreeHash, core.TreeObject, from)
+	}
+
+	if f.shallow[c.Hash] {
+		return
+	}
+
+	for _, p := range c.ParentHashes {
+		f.push(p, core.CommitObject, from)
+	}
+}
+
+func (f *fsck) checkTree(t *Tree) {
+	from := "tree " + t.Hash.String()
+	for _, e := range t.Entries {
+		if reason := checkTreeEntryName(e.Name); reason != "" {
+			f.issue(FsckWarning, t.Hash, "invalid entry name %q: %s", e.Name, reason)
+		}
+
+		m, err := gitFileMode(e.Mode)
+		if err != nil {
+			f.issue(FsckWarning, t.Hash, "invalid mode %o of entry %q", uint32(e.Mode), e.Name)
+			continue
+		}
+
+		switch m {
+		case treeEntrySubmoduleMode:
+			// the commits of the submodules are in other repositories
+		case treeEntryDirMode:
+			f.push(e.Hash, core.TreeObject, from)
+		default:
+			f.push(e.Hash, core.BlobObject, from)
+		}
+	}
+}
+
+// checkTreeEntryName returns why the given name of a tree entry is invalid,
+// or an empty string if it is valid.
+func checkTreeEntryName(name string) string {
+	switch {
+	case name == "":
+		return "empty name"
+	case name == "." || name == "..":
+		return "relative path"
+	case strings.ContainsRune(name, '/'):
+		return "contains a slash"
+	case strings.ContainsRune(name, 0):
+		return "contains a NUL byte"
+	}
+
+	return ""
+}
+
+// dangling reports the unreachable objects of the storage no other
+// unreachable object points to, the ones git fsck reports as dangling.
+func (f *fsck) dangling() error {
+	unreachable := make(map[core.Hash]core.ObjectType)
+	referenced := make(map[core.Hash]bool)
+	for _, t := range []core.ObjectType{core.CommitObject, core.TreeObject, core.BlobObject, core.TagObject} {
+		iter, err := f.r.Storage.Iter(t)
+		if err != nil {
+			return err
+		}
+
+		err = core.ForEachContext(context.Background(), iter, func(obj core.Object) error {
+			if _, ok := f.seen[obj.Hash()]; ok {
+				return nil
+			}
+
+			unreachable[obj.Hash()] = obj.Type()
+			decoded, err := f.r.decodeObject(obj)
+			if err != nil {
+				f.issue(FsckError, obj.Hash(), "cannot parse %s: %s", obj.Type(), err)
+				return nil
+			}
+
+			for _, h := range referencedHashes(decoded) {
+				referenced[h] = true
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for h, t := range unreachable {
+		if !referenced[h] {
+			f.issue(FsckDangling, h, "dangling %s", t)
+		}
+	}
+
+	return nil
+}
+
+// referencedHashes returns the hashes of the objects the given object points
+// to: the tree and parents of a commit, the entries of a tree, but the
+// submodules, and the target of a tag.
+func referencedHashes(obj Object) []core.Hash {
+	switch o := obj.(type) {
+	case *Commit:
+		return append([]core.Hash{o.TreeHash}, o.ParentHashes...)
+	case *Tree:
+		var hashes []core.Hash
+		for _, e := range o.Entries {
+			if !isSubmoduleMode(e.Mode) {
+				hashes = append(hashes, e.Hash)
+			}
+		}
+
+		return hashes
+	case *Tag:
+		return []core.Hash{o.Target}
+	}
+
+	return nil
+}
+
+// fsckIssuesBySeverity sorts the issues by severity and then by hash.
+type fsckIssuesBySeverity []FsckIssue
+
+func (s fsckIssuesBySeverity) Len() int      { return len(s) }
+func (s fsckIssuesBySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s fsckIssuesBySeverity) Less(i, j int) bool {
+	if s[i].Severity != s[j].Severity {
+		return s[i].Severity < s[j].Severity
+	}
+
+	return s[i].Hash.String() < s[j].Hash.String()
+}
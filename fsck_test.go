@@ -0,0 +1,227 @@
+package git
+
+import (
+	"sort"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteFsck struct {
+	r      *Repository
+	sto    *memory.ObjectStorage
+	foo    core.Hash
+	bar    core.Hash
+	sub    core.Hash
+	root   core.Hash
+	first  core.Hash
+	second core.Hash
+}
+
+var _ = Suite(&SuiteFsck{})
+
+// SetUpTest creates a repository with two commits of the same tree, with a
+// file and a subdirectory, the master branch, HEAD and an annotated tag of
+// the last commit.
+func (s *SuiteFsck) SetUpTest(c *C) {
+	s.r = NewPlainRepository()
+	s.sto = s.r.Storage.(*memory.ObjectStorage)
+
+	s.foo = newTestBlob(c, s.r, "foo")
+	s.bar = newTestBlob(c, s.r, "bar")
+	s.sub = newTestTree(c, s.r, TreeEntry{Name: "bar", Mode: 0100644, Hash: s.bar}).Hash
+	s.root = newTestTree(c, s.r,
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: s.foo},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: s.sub},
+	).Hash
+
+	s.first = s.storeCommit(c, s.root)
+	s.second = s.storeCommit(c, s.root, s.first)
+
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/master", s.second)), IsNil)
+	c.Assert(s.r.References.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+	_, err := s.r.CreateTag("v1", s.second, &CreateTagOptions{
+		Tagger:  Signature{Name: "foo", Email: "foo@bar.com"},
+		Message: "v1",
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteFsck) storeCommit(c *C, tree core.Hash, parents ...core.Hash) core.Hash {
+	sig := Signature{Name: "foo", Email: "foo@bar.com"}
+	commit := &Commit{Author: sig, Committer: sig, Message: "foo\n", TreeHash: tree, ParentHashes: parents}
+
+	obj := &memory.Object{}
+	c.Assert(commit.Encode(obj), IsNil)
+	h, err := s.r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+
+	return h
+}
+
+func (s *SuiteFsck) remove(h core.Hash) {
+	for _, m := range []map[core.Hash]core.Object{s.sto.Objects, s.sto.Commits, s.sto.Trees, s.sto.Blobs, s.sto.Tags} {
+		delete(m, h)
+	}
+}
+
+// replaceTree stores a tree with the given content with the hash of
+// another one
+func (s *SuiteFsck) replaceTree(h core.Hash, content string) {
+	s.remove(h)
+	obj := &hashedObject{memory.NewObject(core.TreeObject, int64(len(content)), []byte(content)), h}
+	s.sto.Objects[h] = obj
+	s.sto.Trees[h] = obj
+}
+
+// hashedObject is an object with a hash that is not the one of its content
+type hashedObject struct {
+	core.Object
+	h core.Hash
+}
+
+func (o *hashedObject) Hash() core.Hash { return o.h }
+
+func (s *SuiteFsck) TestFsck(c *C) {
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, HasLen, 0)
+}
+
+func (s *SuiteFsck) TestFsckMissing(c *C) {
+	s.remove(s.bar)
+	s.remove(s.first)
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, sortedIssues(
+		FsckIssue{FsckError, s.bar, "missing blob, referenced by tree " + s.sub.String()},
+		FsckIssue{FsckError, s.first, "missing commit, referenced by commit " + s.second.String()},
+	))
+}
+
+func (s *SuiteFsck) TestFsckShallow(c *C) {
+	s.remove(s.first)
+	c.Assert(s.r.Shallows.SetShallow([]core.Hash{s.second}), IsNil)
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, HasLen, 0)
+}
+
+func (s *SuiteFsck) TestFsckWrongType(c *C) {
+	commit := s.storeCommit(c, s.foo, s.second)
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/master", commit)), IsNil)
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, []FsckIssue{
+		{FsckError, s.foo, "tree is a blob, referenced by commit " + commit.String()},
+	})
+}
+
+func (s *SuiteFsck) TestFsckMalformed(c *C) {
+	s.replaceTree(s.sub, "100644 foo")
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, HasLen, 2)
+	c.Assert(issues[0].Severity, Equals, FsckError)
+	c.Assert(issues[0].Hash, Equals, s.sub)
+	c.Assert(issues[0].Description, Matches, "cannot parse tree: malformed tree: .*")
+
+	// bar is only referenced by the tree replaced
+	c.Assert(issues[1], DeepEquals, FsckIssue{FsckDangling, s.bar, "dangling blob"})
+}
+
+func (s *SuiteFsck) TestFsckCorrupted(c *C) {
+	s.sto.Objects[s.foo] = memory.NewObject(core.BlobObject, 3, []byte("bar"))
+	s.r.Storage = core.NewVerifyingObjectStorage(s.r.Storage)
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, []FsckIssue{
+		{FsckError, s.foo, "corrupted blob, computed hash " + s.bar.String()},
+	})
+}
+
+func (s *SuiteFsck) TestFsckTreeEntryNames(c *C) {
+	tree := newTestTree(c, s.r,
+		TreeEntry{Name: ".", Mode: 0100644, Hash: s.foo},
+		TreeEntry{Name: "..", Mode: 040000, Hash: s.sub},
+		TreeEntry{Name: "a/b", Mode: 0100644, Hash: s.bar},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: s.foo},
+	).Hash
+	commit := s.storeCommit(c, tree, s.second)
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/master", commit)), IsNil)
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, []FsckIssue{
+		{FsckWarning, tree, `invalid entry name ".": relative path`},
+		{FsckWarning, tree, `invalid entry name "..": relative path`},
+		{FsckWarning, tree, `invalid entry name "a/b": contains a slash`},
+	})
+}
+
+func (s *SuiteFsck) TestCheckTreeEntryName(c *C) {
+	for name, expected := range map[string]string{
+		"foo":      "",
+		".foo":     "",
+		"":         "empty name",
+		".":        "relative path",
+		"..":       "relative path",
+		"foo/":     "contains a slash",
+		"foo\x00a": "contains a NUL byte",
+	} {
+		c.Assert(checkTreeEntryName(name), Equals, expected, Commentf("name=%q", name))
+	}
+}
+
+func (s *SuiteFsck) TestFsckDangling(c *C) {
+	blob := newTestBlob(c, s.r, "qux")
+	tree := newTestTree(c, s.r, TreeEntry{Name: "qux", Mode: 0100644, Hash: blob}).Hash
+	commit := s.storeCommit(c, tree, s.first)
+	loose := newTestBlob(c, s.r, "loose")
+
+	issues, err := s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, sortedIssues(
+		FsckIssue{FsckDangling, commit, "dangling commit"},
+		FsckIssue{FsckDangling, loose, "dangling blob"},
+	))
+}
+
+func (s *SuiteFsck) TestFsckReferences(c *C) {
+	s.remove(s.bar)
+	loose := newTestBlob(c, s.r, "loose")
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/other", loose)), IsNil)
+	s.remove(loose)
+
+	// the dangling objects are not looked for, nor other references walked
+	issues, err := s.r.Fsck(FsckOptions{References: []core.ReferenceName{"refs/tags/v1", "refs/heads/missing"}})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, []FsckIssue{
+		{FsckError, core.ZeroHash, "invalid reference refs/heads/missing: reference not found"},
+		{FsckError, s.bar, "missing blob, referenced by tree " + s.sub.String()},
+	})
+
+	issues, err = s.r.Fsck(FsckOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(issues, DeepEquals, sortedIssues(
+		FsckIssue{FsckError, s.bar, "missing blob, referenced by tree " + s.sub.String()},
+		FsckIssue{FsckError, loose, "missing object, referenced by reference refs/heads/other"},
+	))
+}
+
+func (s *SuiteFsck) TestFsckIssueString(c *C) {
+	issue := FsckIssue{FsckDangling, s.foo, "dangling blob"}
+	c.Assert(issue.String(), Equals, "dangling 19102815663d23f8b75a47e7a01965dcdc96468c: dangling blob")
+}
+
+func sortedIssues(issues ...FsckIssue) []FsckIssue {
+	sort.Stable(fsckIssuesBySeverity(issues))
+	return issues
+}
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+// IndexStorage is the storage of the index of a repository, the files of its
+// next commit, with the stat data of the ones of its worktree. It is not a
+// storage of the core package, as the index package depends on it.
+type IndexStorage interface {
+	// Index returns the index, empty if there is none.
+	Index() (*index.Index, error)
+	// SetIndex replaces the index with the given one.
+	SetIndex(*index.Index) error
+}
+
+// Index returns the index of the repository, the one of its Indexes, or an
+// empty one in the format of its objects if it has no IndexStorage.
+func (r *Repository) Index() (*index.Index, error) {
+	if r.Indexes == nil {
+		return index.New(r.ObjectFormat()), nil
+	}
+
+	return r.Indexes.Index()
+}
+
+// SetIndex replaces the index of the repository with the given one, as
+// returned by Index.
+func (r *Repository) SetIndex(idx *index.Index) error {
+	if r.Indexes == nil {
+		r.Indexes = memory.NewIndexStorage()
+	}
+
+	return r.Indexes.SetIndex(idx)
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	"github.com/alcortesm/tgz"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteIndex struct{}
+
+var _ = Suite(&SuiteIndex{})
+
+func (s *SuiteIndex) TestIndex(c *C) {
+	r := NewPlainRepository()
+	idx, err := r.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 0)
+
+	r.Indexes = nil
+	idx, err = r.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx, DeepEquals, index.New(core.SHA1))
+}
+
+func (s *SuiteIndex) TestIndexFromFS(c *C) {
+	dir, err := tgz.Extract(crissCrossFixture)
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepositoryFromFS(fs.NewOS(), filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+
+	idx, err := r.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 3)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.Commit(head.Hash)
+	c.Assert(err, IsNil)
+
+	// the index of the worktree is the one of its last commit
+	for _, e := range idx.Entries {
+		f, err := commit.File(e.Name)
+		c.Assert(err, IsNil)
+		c.Assert(e.Hash, Equals, f.Hash, Commentf("name=%s", e.Name))
+		c.Assert(e.Mode, Equals, f.Mode, Commentf("name=%s", e.Name))
+	}
+}
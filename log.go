@@ -0,0 +1,549 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// LogOrder is the order of the commits returned by Log.
+type LogOrder int
+
+const (
+	// LogOrderDefault is the default order, LogOrderCommitterTime.
+	LogOrderDefault LogOrder = iota
+	// LogOrderTopo returns the commits in topological order, as git log
+	// --topo-order does: no commit is returned before all its children,
+	// and the commits of a line of history are returned together, the
+	// last parent of a merge first.
+	LogOrderTopo
+	// LogOrderCommitterTime returns the commits newest first by committer
+	// date, as git log does by default.
+	LogOrderCommitterTime
+)
+
+// logSlop is the number of generations of commits older than
+// LogOptions.Since whose parents are still followed, so the newer commits
+// behind a commit with a wrong, older, committer date are found.
+const logSlop = 5
+
+// LogOptions are the options of Log.
+type LogOptions struct {
+	// From is the commit whose history is returned.
+	From core.Hash
+	// Path, if not empty, returns only the commits changing the entry at
+	// the path, see Log.
+	Path string
+	// Order is the order of the commits returned.
+	Order LogOrder
+	// Since, if not zero, returns only the commits with a committer date
+	// not before it. The parents of the older commits are not followed,
+	// but for a few generations, see logSlop.
+	Since time.Time
+	// Until, if not zero, returns only the commits with a committer date
+	// not after it.
+	Until time.Time
+	// FirstParent follows only the first parent of the merges, as git log
+	// --first-parent does, so the commits of the merged branches are not
+	// returned, but the merges are.
+	FirstParent bool
+	// Author, if not nil, returns only the commits whose author matches it,
+	// as "Name <Email>", as git log --author does.
+	Author *regexp.Regexp
+	// Grep, if not nil, returns only the commits whose message matches it,
+	// as git log --grep does. The message is matched as a whole, use the
+	// (?m) flag to match its lines.
+	Grep *regexp.Regexp
+	// InvertGrep returns the commits whose message does not match Grep
+	// instead.
+	InvertGrep bool
+	// All returns only the commits matching both Author and Grep, instead
+	// of the ones matching any of them.
+	All bool
+}
+
+// matches returns true if the commit matches the Author and Grep options,
+// true if there are none.
+func (o *LogOptions) matches(c *Commit) bool {
+	var matches []bool
+	if o.Author != nil {
+		author := fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email)
+		matches = append(matches, o.Author.MatchString(author))
+	}
+
+	if o.Grep != nil {
+		matches = append(matches, o.Grep.MatchString(c.Message) != o.InvertGrep)
+	}
+
+	if len(matches) == 0 {
+		return true
+	}
+
+	for _, m := range matches {
+		if o.All && !m {
+			return false
+		}
+
+		if !o.All && m {
+			return true
+		}
+	}
+
+	return o.All
+}
+
+// Log returns the commits reachable from the commit opts.From, in the order
+// of opts.Order and within the dates of opts.Since and opts.Until.
+//
+// If opts.Path is not empty only the commits that changed the entry at the
+// path are returned. A commit changes the entry if its hash differs from the
+// one of the same path in the first parent of the commit, with a path
+// missing in one of them counting as a change, so the commits creating and
+// deleting the path are returned as well. The commits are found comparing
+// the hashes of the tree entries, without reading the contents of any file.
+// Only the first parent of each commit is compared, but all of them are
+// followed, unless opts.FirstParent is set, so the changes made in merged
+// branches are also returned.
+//
+// The history is walked as the commits are requested, keeping in memory only
+// the commits found and not returned yet. The topological order relies on
+// the committer dates to know when all the children of a commit have been
+// found, so a commit could be returned before a child with an older
+// committer date.
+func (r *Repository) Log(opts LogOptions) (*CommitIter, error) {
+	var pathParts []string
+	if opts.Path != "" {
+		var err error
+		if pathParts, err = splitPath(opts.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := r.Commit(opts.From)
+	if err != nil {
+		return nil, err
+	}
+
+	var l *sinceLimit
+	if !opts.Since.IsZero() {
+		l = newSinceLimit(opts.Since, c)
+	}
+
+	var w commitWalker
+	switch opts.Order {
+	case LogOrderTopo:
+		w = newTopoWalker(r, c, l, opts.FirstParent)
+	default:
+		w = newDateWalker(r, c, l, opts.FirstParent)
+	}
+
+	iter := &logIter{
+		r:         r,
+		w:         w,
+		opts:      opts,
+		pathParts: pathParts,
+		entries:   make(map[core.Hash]core.Hash, 0),
+	}
+
+	return NewCommitIter(r, iter), nil
+}
+
+// logIter implements core.ObjectIter, it walks the history of a commit in
+// the order of a commitWalker yielding the commits matching the options, so
+// the history is walked only as far as the commits are requested.
+type logIter struct {
+	r         *Repository
+	w         commitWalker
+	opts      LogOptions
+	pathParts []string
+	entries   map[core.Hash]core.Hash // entry hashes by tree hash
+}
+
+func (iter *logIter) Next() (core.Object, error) {
+	for iter.w != nil {
+		c, parents, err := iter.w.next()
+		if err != nil {
+			return nil, err
+		}
+
+		when := c.Committer.When
+		if !iter.opts.Since.IsZero() && when.Before(iter.opts.Since) ||
+			!iter.opts.Until.IsZero() && when.After(iter.opts.Until) ||
+			!iter.opts.matches(c) {
+			continue
+		}
+
+		var parent *Commit
+		if len(parents) != 0 {
+			parent = parents[0]
+		}
+
+		changed := true
+		if iter.pathParts != nil {
+			if changed, err = iter.changed(c, parent); err != nil {
+				return nil, err
+			}
+		}
+
+		if changed {
+			return iter.r.Storage.Get(c.Hash)
+		}
+	}
+
+	return nil, io.EOF
+}
+
+// commitWalker walks the history of a commit, next returns the commits in
+// its order along with their parents, and io.EOF at the end.
+type commitWalker interface {
+	next() (*Commit, []*Commit, error)
+}
+
+// parentCommits returns the parents of a commit, read at once, see
+// core.GetMany, or only its first parent if firstParent is true. A shallow
+// commit whose parents are missing has none, so the walks stop at the
+// boundary of a shallow history, see Repository.Shallows.
+func (r *Repository) parentCommits(c *Commit, firstParent bool) ([]*Commit, error) {
+	hashes := c.ParentHashes
+	if firstParent && len(hashes) > 1 {
+		hashes = hashes[:1]
+	}
+
+	objs, err := r.objects(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]*Commit, 0, len(hashes))
+	for i := range hashes {
+		if objs[i] == nil {
+			return nil, r.missingParent(c)
+		}
+
+		p, ok := objs[i].(*Commit)
+		if !ok {
+			return nil, ErrUnsupportedObject
+		}
+
+		parents = append(parents, p)
+	}
+
+	return parents, nil
+}
+
+// missingParent returns the error of the walks when a parent of the commit
+// is missing: none if the commit is shallow, ErrObjectNotFound otherwise.
+func (r *Repository) missingParent(c *Commit) error {
+	shallow, err := r.isShallow(c.Hash)
+	if err != nil {
+		return err
+	}
+
+	if !shallow {
+		return ErrObjectNotFound
+	}
+
+	return nil
+}
+
+// dateWalker walks the history newest first by committer date.
+type dateWalker struct {
+	r           *Repository
+	l           *sinceLimit
+	firstParent bool
+	pending     commitHeap
+	seen        map[core.Hash]bool
+}
+
+func newDateWalker(r *Repository, c *Commit, l *sinceLimit, firstParent bool) *dateWalker {
+	w := &dateWalker{
+		r:           r,
+		l:           l,
+		firstParent: firstParent,
+		seen:        map[core.Hash]bool{c.Hash: true},
+	}
+
+	heap.Push(&w.pending, c)
+	return w
+}
+
+func (w *dateWalker) next() (*Commit, []*Commit, error) {
+	if len(w.pending) == 0 {
+		return nil, nil, io.EOF
+	}
+
+	c := heap.Pop(&w.pending).(*Commit)
+	slop := w.l.take(c)
+	if slop <= 0 {
+		return c, nil, nil
+	}
+
+	parents, err := w.r.parentCommits(c, w.firstParent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range parents {
+		w.l.found(slop, p)
+		if !w.seen[p.Hash] {
+			w.seen[p.Hash] = true
+			heap.Push(&w.pending, p)
+		}
+	}
+
+	return c, parents, nil
+}
+
+// topoWalker walks the history in topological order, see LogOrderTopo, with
+// the algorithm of git: a commit is ready once all its children have been
+// returned, and the last commit ready is returned first. The children are
+// counted exploring the history newest first by committer date, only until
+// the date of the commit whose children are needed.
+type topoWalker struct {
+	r           *Repository
+	l           *sinceLimit
+	firstParent bool
+	explore     commitHeap // found, their parents not explored yet
+	seen        map[core.Hash]bool
+	// the commits found and not returned yet, with their parents once they
+	// are explored, and the number of their children not returned yet
+	commits map[core.Hash]*topoCommit
+	ready   []*Commit
+}
+
+type topoCommit struct {
+	parents  []*Commit
+	children int
+}
+
+func newTopoWalker(r *Repository, c *Commit, l *sinceLimit, firstParent bool) *topoWalker {
+	w := &topoWalker{
+		r:           r,
+		l:           l,
+		firstParent: firstParent,
+		seen:        map[core.Hash]bool{c.Hash: true},
+		commits:     map[core.Hash]*topoCommit{c.Hash: {}},
+		ready:       []*Commit{c},
+	}
+
+	heap.Push(&w.explore, c)
+	return w
+}
+
+func (w *topoWalker) next() (*Commit, []*Commit, error) {
+	if len(w.ready) == 0 {
+		return nil, nil, io.EOF
+	}
+
+	c := w.ready[len(w.ready)-1]
+	w.ready = w.ready[:len(w.ready)-1]
+
+	if err := w.exploreTo(c); err != nil {
+		return nil, nil, err
+	}
+
+	tc := w.commits[c.Hash]
+	delete(w.commits, c.Hash)
+
+	for _, p := range tc.parents {
+		if err := w.exploreTo(p); err != nil {
+			return nil, nil, err
+		}
+
+		// a parent already returned, with a child with an older date
+		tp, ok := w.commits[p.Hash]
+		if !ok {
+			continue
+		}
+
+		tp.children--
+		if tp.children == 0 {
+			w.ready = append(w.ready, p)
+		}
+	}
+
+	return c, tc.parents, nil
+}
+
+func (w *topoWalker) unready(h core.Hash) {
+	for i, c := range w.ready {
+		if c.Hash == h {
+			w.ready = append(w.ready[:i], w.ready[i+1:]...)
+			return
+		}
+	}
+}
+
+// exploreTo explores the commits found not older than c, counting the
+// children of their parents, so all the children of c not older than it
+// have been found. c itself is explored, as it has been found.
+func (w *topoWalker) exploreTo(c *Commit) error {
+	for len(w.explore) != 0 && !w.explore[0].Committer.When.Before(c.Committer.When) {
+		e := heap.Pop(&w.explore).(*Commit)
+		slop := w.l.take(e)
+		if slop <= 0 {
+			continue
+		}
+
+		parents, err := w.r.parentCommits(e, w.firstParent)
+		if err != nil {
+			return err
+		}
+
+		w.commits[e.Hash].parents = parents
+		for _, p := range parents {
+			w.l.found(slop, p)
+			if !w.seen[p.Hash] {
+				w.seen[p.Hash] = true
+				w.commits[p.Hash] = &topoCommit{}
+				heap.Push(&w.explore, p)
+			}
+
+			if tp, ok := w.commits[p.Hash]; ok {
+				if tp.children == 0 {
+					// found ready by a child with an older date
+					w.unready(p.Hash)
+				}
+
+				tp.children++
+			}
+		}
+	}
+
+	return nil
+}
+
+// changed reports whether the entry at the path differs between a commit and
+// its parent, parent is nil for root commits.
+func (iter *logIter) changed(c, parent *Commit) (bool, error) {
+	if parent != nil && c.TreeHash == parent.TreeHash {
+		return false, nil
+	}
+
+	h, err := iter.entryHash(c)
+	if err != nil {
+		return false, err
+	}
+
+	if parent == nil {
+		return h != core.ZeroHash, nil
+	}
+
+	ph, err := iter.entryHash(parent)
+	if err != nil {
+		return false, err
+	}
+
+	return h != ph, nil
+}
+
+// entryHash returns the hash of the entry at the path in the tree of a
+// commit, or core.ZeroHash if the path does not exist. The hashes are
+// memoized, as every commit is usually compared with both its parent and
+// its child.
+func (iter *logIter) entryHash(c *Commit) (core.Hash, error) {
+	if h, ok := iter.entries[c.TreeHash]; ok {
+		return h, nil
+	}
+
+	tree, err := iter.r.Tree(c.TreeHash)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	var h core.Hash
+	e, err := tree.findEntry(iter.pathParts)
+	switch err {
+	case nil:
+		h = e.Hash
+	case ErrEntryNotFound, ErrDirectoryNotFound:
+	default:
+		return core.ZeroHash, err
+	}
+
+	iter.entries[c.TreeHash] = h
+	return h, nil
+}
+
+// sinceLimit decides which commits have their parents followed with
+// LogOptions.Since: the commits not older than the date, and the older
+// ones for logSlop generations. Every commit found has a slop, positive
+// if its parents are followed: one more than logSlop for the commits not
+// older than the date, and one less than the greatest of its children for
+// the older ones.
+// The methods of a nil sinceLimit follow every parent.
+type sinceLimit struct {
+	since time.Time
+	slop  map[core.Hash]int // of the commits found and not taken yet
+}
+
+func newSinceLimit(since time.Time, from *Commit) *sinceLimit {
+	l := &sinceLimit{since: since, slop: make(map[core.Hash]int)}
+	l.found(logSlop+1, from)
+	return l
+}
+
+// found records the commit c, a parent of a commit with the given slop.
+func (l *sinceLimit) found(slop int, c *Commit) {
+	if l == nil {
+		return
+	}
+
+	if c.Committer.When.Before(l.since) {
+		slop--
+	} else {
+		slop = logSlop + 1
+	}
+
+	if slop > l.slop[c.Hash] {
+		l.slop[c.Hash] = slop
+	}
+}
+
+// take returns the slop of a commit, once all its children have been found,
+// its parents are followed if it is positive.
+func (l *sinceLimit) take(c *Commit) int {
+	if l == nil {
+		return logSlop
+	}
+
+	slop := l.slop[c.Hash]
+	delete(l.slop, c.Hash)
+	return slop
+}
+
+func (iter *logIter) Close() {
+	iter.w = nil
+}
+
+// commitHeap implements heap.Interface, the newest commit by committer date
+// is on top.
+type commitHeap []*Commit
+
+func (h commitHeap) Len() int {
+	return len(h)
+}
+
+func (h commitHeap) Less(i, j int) bool {
+	return h[i].Committer.When.After(h[j].Committer.When)
+}
+
+func (h commitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *commitHeap) Push(x interface{}) {
+	*h = append(*h, x.(*Commit))
+}
+
+func (h *commitHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return c
+}
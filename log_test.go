@@ -0,0 +1,463 @@
+package git
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// mergesFixture is a repository written by git with several merges, one of
+// them an octopus merge, see mergesTopoOrder.
+const mergesFixture = "fixtures/merges.tgz"
+
+type SuiteLog struct {
+	repos  map[string]*Repository
+	dir    string
+	merges *Repository
+}
+
+var _ = Suite(&SuiteLog{})
+
+func (s *SuiteLog) SetUpSuite(c *C) {
+	s.repos = unpackFixtures(c, fixtureRepos)
+
+	var err error
+	s.dir, err = tgz.Extract(mergesFixture)
+	c.Assert(err, IsNil)
+
+	s.merges, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteLog) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+// the expected commits have been obtained comparing, for every commit
+// returned by git rev-list --date-order, the output of git rev-parse for
+// <commit>:<path> and <commit>^1:<path>
+var logTests = []struct {
+	repo     string
+	from     string
+	path     string
+	expected []string
+}{
+	{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "CHANGELOG", []string{
+		"1669dce138d9b841a518c64b10914d88f5e488ea", // merge, changed from its first parent
+		"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69", // merge, changed from its first parent
+		"b8e471f58bcbca63b07bda20e428190409c2db47", // creation
+	}},
+	{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "LICENSE", []string{
+		"b029517f6300c2da0f4b651b8642506cd6aaf45d", // root commit
+	}},
+	{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "/go/", []string{
+		"918c48b83bd081e863dbe1b80f8998f058cd8294", // a directory
+	}},
+	{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "vendor/foo.go", []string{
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	}},
+	{"https://github.com/tyba/git-fixture.git", "918c48b83bd081e863dbe1b80f8998f058cd8294", "vendor/foo.go", nil},
+	{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "not-found", nil},
+	{"https://github.com/spinnaker/spinnaker.git", "f39d86f59a0781f130e8de6b2115329c1fbe9545", "install/install_spinnaker.sh", []string{
+		"8586b7cd3f70fe63053fd5fa321bc86c6b803622", // merge of the deletion
+		"1ef157853d770a26e7682e543ac42de485b34f77", // deletion
+		"427af6949a88f076bb0cd6925071c21be66b41a5", // merge of the creation
+		"0d9c9cef53af38cefcb6801bb492aaed3f2c9a42", // creation
+	}},
+}
+
+func (s *SuiteLog) TestLog(c *C) {
+	for i, t := range logTests {
+		r, ok := s.repos[t.repo]
+		c.Assert(ok, Equals, true)
+
+		iter, err := r.Log(LogOptions{From: core.NewHash(t.from), Path: t.path})
+		c.Assert(err, IsNil, Commentf("subtest %d", i))
+
+		var obtained []string
+		for {
+			commit, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil, Commentf("subtest %d", i))
+			obtained = append(obtained, commit.Hash.String())
+		}
+
+		c.Assert(obtained, DeepEquals, t.expected, Commentf("subtest %d: path=%s", i, t.path))
+	}
+}
+
+func (s *SuiteLog) TestLogErrors(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+
+	_, err := r.Log(LogOptions{From: core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Path: "../CHANGELOG"})
+	c.Assert(err, Equals, ErrInvalidPath)
+
+	_, err = r.Log(LogOptions{From: core.NewHash("0000000000000000000000000000000000000001"), Path: "CHANGELOG"})
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteLog) TestLogClose(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+
+	iter, err := r.Log(LogOptions{From: core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Path: "CHANGELOG"})
+	c.Assert(err, IsNil)
+
+	_, err = iter.Next()
+	c.Assert(err, IsNil)
+
+	iter.Close()
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+// mergesTopoOrder is the output of git log --topo-order for the master
+// branch of mergesFixture
+var mergesTopoOrder = []string{
+	"972eb2a3177a422bd2b0ad4991df73d32e0fc763", // Merge feature again
+	"3535f80b8fc84ebedf448014e79191c0e867b575", // feature 3
+	"4e41be12f377c59513e92d8036c8ffbca3024427", // master 4
+	"ec34268509ffcc216a4fedc55daaac0dfbb2dbb4", // Octopus merge of a, b and c
+	"4e77e23f41ac412bcea558829c0e3454df543864", // c 1
+	"b3ceefccccd8f675401864adcca50ba3b464b93c", // b 2
+	"65348e200a5e368f71c8973e0e5359c275be42c5", // b 1
+	"40453c574516d6288d84f3eeebe6253fe24bc77c", // a 1
+	"d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a", // master 3
+	"0ac063db656012ad3b4617e13f6e5d3849b41426", // Merge feature
+	"053869ce909291337e76ac4e5e989d52b8a12f21", // feature 2
+	"b363aabeb50df3c06868d116c72e37ce1c72255a", // feature 1
+	"ccfbed8fca74c50500aaa9897e18767d1784fdae", // master 2
+	"ffba15f01fbccc976040100f5ed890d1730bcd0c", // master 1
+	"4b8bf322541f1422d5fa3d89627ad4ea13c163a4", // initial
+}
+
+func (s *SuiteLog) TestLogTopoOrder(c *C) {
+	for _, t := range []struct {
+		path     string
+		expected []string
+	}{
+		{"", mergesTopoOrder},
+		{"feature.txt", []string{
+			"972eb2a3177a422bd2b0ad4991df73d32e0fc763",
+			"3535f80b8fc84ebedf448014e79191c0e867b575",
+			"0ac063db656012ad3b4617e13f6e5d3849b41426",
+			"053869ce909291337e76ac4e5e989d52b8a12f21",
+			"b363aabeb50df3c06868d116c72e37ce1c72255a",
+		}},
+	} {
+		iter, err := s.merges.Log(LogOptions{
+			From:  core.NewHash(mergesTopoOrder[0]),
+			Path:  t.path,
+			Order: LogOrderTopo,
+		})
+		c.Assert(err, IsNil)
+		c.Assert(logHashes(c, iter), DeepEquals, t.expected, Commentf("path=%s", t.path))
+	}
+}
+
+func (s *SuiteLog) TestLogTopoOrderFromMerge(c *C) {
+	iter, err := s.merges.Log(LogOptions{
+		From:  core.NewHash("ec34268509ffcc216a4fedc55daaac0dfbb2dbb4"),
+		Order: LogOrderTopo,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), DeepEquals, mergesTopoOrder[3:])
+}
+
+func (s *SuiteLog) TestLogDefaultOrder(c *C) {
+	iter, err := s.merges.Log(LogOptions{From: core.NewHash(mergesTopoOrder[0])})
+	c.Assert(err, IsNil)
+
+	// the output of git log --date-order
+	c.Assert(logHashes(c, iter), DeepEquals, []string{
+		"972eb2a3177a422bd2b0ad4991df73d32e0fc763",
+		"4e41be12f377c59513e92d8036c8ffbca3024427",
+		"3535f80b8fc84ebedf448014e79191c0e867b575",
+		"ec34268509ffcc216a4fedc55daaac0dfbb2dbb4",
+		"d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a",
+		"4e77e23f41ac412bcea558829c0e3454df543864",
+		"b3ceefccccd8f675401864adcca50ba3b464b93c",
+		"65348e200a5e368f71c8973e0e5359c275be42c5",
+		"40453c574516d6288d84f3eeebe6253fe24bc77c",
+		"0ac063db656012ad3b4617e13f6e5d3849b41426",
+		"053869ce909291337e76ac4e5e989d52b8a12f21",
+		"ccfbed8fca74c50500aaa9897e18767d1784fdae",
+		"b363aabeb50df3c06868d116c72e37ce1c72255a",
+		"ffba15f01fbccc976040100f5ed890d1730bcd0c",
+		"4b8bf322541f1422d5fa3d89627ad4ea13c163a4",
+	})
+}
+
+func logHashes(c *C, iter *CommitIter) []string {
+	defer iter.Close()
+
+	var hashes []string
+	for {
+		commit, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		hashes = append(hashes, commit.Hash.String())
+	}
+
+	return hashes
+}
+
+func (s *SuiteLog) TestLogCommitterTime(c *C) {
+	for _, order := range []LogOrder{LogOrderDefault, LogOrderCommitterTime} {
+		iter, err := s.merges.Log(LogOptions{From: core.NewHash(mergesTopoOrder[0]), Order: order})
+		c.Assert(err, IsNil)
+
+		obtained := logHashes(c, iter)
+		c.Assert(obtained, HasLen, len(mergesTopoOrder))
+		for i := 1; i < len(obtained); i++ {
+			prev, err := s.merges.Commit(core.NewHash(obtained[i-1]))
+			c.Assert(err, IsNil)
+			commit, err := s.merges.Commit(core.NewHash(obtained[i]))
+			c.Assert(err, IsNil)
+			c.Assert(commit.Committer.When.After(prev.Committer.When), Equals, false)
+		}
+	}
+}
+
+func (s *SuiteLog) TestLogSinceUntil(c *C) {
+	since := time.Unix(1465834000, 0) // c 1
+	until := time.Unix(1465834200, 0) // Octopus merge
+	octopus := "ec34268509ffcc216a4fedc55daaac0dfbb2dbb4"
+	master3 := "d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a"
+	c1 := "4e77e23f41ac412bcea558829c0e3454df543864"
+
+	for order, expected := range map[LogOrder][]string{
+		LogOrderCommitterTime: {octopus, master3, c1},
+		LogOrderTopo:          {octopus, c1, master3},
+	} {
+		iter, err := s.merges.Log(LogOptions{
+			From:  core.NewHash(mergesTopoOrder[0]),
+			Order: order,
+			Since: since,
+			Until: until,
+		})
+		c.Assert(err, IsNil)
+		c.Assert(logHashes(c, iter), DeepEquals, expected, Commentf("order=%d", order))
+	}
+}
+
+func (s *SuiteLog) TestLogSinceSlop(c *C) {
+	since := time.Unix(50, 0)
+	for _, t := range []struct {
+		dates    []int64 // of a line of history, the oldest first
+		expected []int64
+	}{
+		// the commit of 60 is found behind the one of 5, older than its
+		// parent
+		{[]int64{10, 60, 5, 80, 90}, []int64{90, 80, 60}},
+		{[]int64{10, 60, 1, 2, 3, 4, 5, 80}, []int64{80, 60}},
+		// but not behind more than logSlop older commits
+		{[]int64{10, 60, 1, 2, 3, 4, 5, 6, 80}, []int64{80}},
+	} {
+		r, tip := linearHistory(c, t.dates)
+		for _, order := range []LogOrder{LogOrderCommitterTime, LogOrderTopo} {
+			iter, err := r.Log(LogOptions{From: tip, Order: order, Since: since})
+			c.Assert(err, IsNil)
+
+			var obtained []int64
+			for _, h := range logHashes(c, iter) {
+				commit, err := r.Commit(core.NewHash(h))
+				c.Assert(err, IsNil)
+				obtained = append(obtained, commit.Committer.When.Unix())
+			}
+
+			c.Assert(obtained, DeepEquals, t.expected, Commentf("dates=%v order=%d", t.dates, order))
+		}
+	}
+}
+
+// the output of git log --first-parent, with the same commits in every order
+var mergesFirstParent = []string{
+	"972eb2a3177a422bd2b0ad4991df73d32e0fc763", // Merge feature again
+	"4e41be12f377c59513e92d8036c8ffbca3024427", // master 4
+	"ec34268509ffcc216a4fedc55daaac0dfbb2dbb4", // Octopus merge
+	"d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a", // master 3
+	"0ac063db656012ad3b4617e13f6e5d3849b41426", // Merge feature
+	"ccfbed8fca74c50500aaa9897e18767d1784fdae", // master 2
+	"ffba15f01fbccc976040100f5ed890d1730bcd0c", // master 1
+	"4b8bf322541f1422d5fa3d89627ad4ea13c163a4", // initial
+}
+
+func (s *SuiteLog) TestLogFirstParent(c *C) {
+	for _, t := range []struct {
+		opts     LogOptions
+		expected []string
+	}{
+		{LogOptions{}, mergesFirstParent},
+		{LogOptions{Order: LogOrderTopo}, mergesFirstParent},
+		{LogOptions{Path: "feature.txt"}, []string{
+			mergesFirstParent[0],
+			mergesFirstParent[4],
+		}},
+		{LogOptions{
+			Since: time.Unix(1465833600, 0), // Merge feature
+			Until: time.Unix(1465834400, 0), // master 4
+		}, mergesFirstParent[1:5]},
+	} {
+		opts := t.opts
+		opts.From = core.NewHash(mergesFirstParent[0])
+		opts.FirstParent = true
+
+		iter, err := s.merges.Log(opts)
+		c.Assert(err, IsNil)
+		c.Assert(logHashes(c, iter), DeepEquals, t.expected, Commentf("opts=%+v", t.opts))
+	}
+}
+
+func (s *SuiteLog) TestLogAuthorGrep(c *C) {
+	r, tip := commitLine(c, []*Commit{
+		{
+			Author:  Signature{Name: "José Núñez", Email: "jose@example.com"},
+			Message: "Fix the parser\n\nThe parser failed with the empty\nfiles.\n",
+		},
+		{
+			Author:  Signature{Name: "John Doe", Email: "john@doe.com"},
+			Message: "Add the README\n",
+		},
+		{
+			Author:  Signature{Name: "Zoë", Email: "zoe@example.com"},
+			Message: "Update the parser\n\nFixes #12\n",
+		},
+	})
+
+	jose, john, zoe := "Fix the parser", "Add the README", "Update the parser"
+	for _, t := range []struct {
+		opts     LogOptions
+		expected []string
+	}{
+		{LogOptions{}, []string{zoe, john, jose}},
+		{LogOptions{Author: regexp.MustCompile("Núñez")}, []string{jose}},
+		{LogOptions{Author: regexp.MustCompile("^Zoë <")}, []string{zoe}},
+		{LogOptions{Author: regexp.MustCompile(`@example\.com>$`)}, []string{zoe, jose}},
+		{LogOptions{Grep: regexp.MustCompile(`(?m)^Fixes #\d+$`)}, []string{zoe}},
+		{LogOptions{Grep: regexp.MustCompile(`empty\nfiles`)}, []string{jose}},
+		{LogOptions{Grep: regexp.MustCompile("parser")}, []string{zoe, jose}},
+		{LogOptions{Grep: regexp.MustCompile("parser"), InvertGrep: true}, []string{john}},
+		{LogOptions{
+			Author: regexp.MustCompile("example"),
+			Grep:   regexp.MustCompile("Fixes"),
+		}, []string{zoe, jose}},
+		{LogOptions{
+			Author: regexp.MustCompile("example"),
+			Grep:   regexp.MustCompile("Fixes"),
+			All:    true,
+		}, []string{zoe}},
+		{LogOptions{
+			Author:     regexp.MustCompile("example"),
+			Grep:       regexp.MustCompile("Fixes"),
+			InvertGrep: true,
+			All:        true,
+		}, []string{jose}},
+		{LogOptions{
+			Author: regexp.MustCompile("Doe"),
+			Grep:   regexp.MustCompile("parser"),
+		}, []string{zoe, john, jose}},
+		{LogOptions{
+			Author: regexp.MustCompile("Doe"),
+			Grep:   regexp.MustCompile("parser"),
+			All:    true,
+		}, nil},
+	} {
+		opts := t.opts
+		opts.From = tip
+
+		iter, err := r.Log(opts)
+		c.Assert(err, IsNil)
+
+		var obtained []string
+		c.Assert(iter.ForEach(func(commit *Commit) error {
+			obtained = append(obtained, strings.SplitN(commit.Message, "\n", 2)[0])
+			return nil
+		}), IsNil)
+
+		c.Assert(obtained, DeepEquals, t.expected, Commentf("opts=%+v", t.opts))
+	}
+}
+
+func (s *SuiteLog) TestLogStop(c *C) {
+	// the parent of the first commit is missing, so the log fails once its
+	// parents are read
+	r, tip := commitLine(c, []*Commit{
+		{ParentHashes: []core.Hash{core.NewHash("0000000000000000000000000000000000000001")}},
+		{Message: "foo\n"},
+		{Message: "bar\n"},
+	})
+
+	iter, err := r.Log(LogOptions{From: tip, Grep: regexp.MustCompile("foo")})
+	c.Assert(err, IsNil)
+	c.Assert(iter.ForEach(func(*Commit) error { return nil }), Equals, ErrObjectNotFound)
+
+	iter, err = r.Log(LogOptions{From: tip, Grep: regexp.MustCompile("foo")})
+	c.Assert(err, IsNil)
+
+	var obtained []string
+	c.Assert(iter.ForEach(func(commit *Commit) error {
+		obtained = append(obtained, commit.Message)
+		return core.ErrStop
+	}), IsNil)
+	c.Assert(obtained, DeepEquals, []string{"foo\n"})
+}
+
+// linearHistory returns a repository with a line of commits with the given
+// committer dates, the oldest first, and the hash of the last one.
+func linearHistory(c *C, dates []int64) (*Repository, core.Hash) {
+	commits := make([]*Commit, len(dates))
+	for i, sec := range dates {
+		sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(sec, 0).UTC()}
+		commits[i] = &Commit{Author: sig, Committer: sig, Message: "foo\n"}
+	}
+
+	return commitLine(c, commits)
+}
+
+// commitLine returns a repository with a line of the given commits, the
+// oldest first, and the hash of the last one. Every commit but the first is
+// a child of the previous one, and their trees are empty. The commits
+// without dates are one second apart, from the Unix epoch.
+func commitLine(c *C, commits []*Commit) (*Repository, core.Hash) {
+	r := NewPlainRepository()
+
+	var h core.Hash
+	for i, commit := range commits {
+		if i != 0 {
+			commit.ParentHashes = []core.Hash{h}
+		}
+
+		commit.TreeHash = EmptyTreeHash
+		if commit.Author.When.IsZero() {
+			commit.Author.When = time.Unix(int64(i), 0).UTC()
+		}
+
+		if commit.Committer.When.IsZero() {
+			commit.Committer = commit.Author
+		}
+
+		obj := &memory.Object{}
+		c.Assert(commit.Encode(obj), IsNil)
+
+		var err error
+		h, err = r.Storage.Set(obj)
+		c.Assert(err, IsNil)
+	}
+
+	return r, h
+}
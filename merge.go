@@ -0,0 +1,551 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/diff"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ErrUnrelatedHistories is returned by Repository.Merge when the commits do
+// not share any history, unless the options allow it.
+var ErrUnrelatedHistories = errors.New("refusing to merge unrelated histories")
+
+// the labels of the conflict markers, by default
+const (
+	defaultOursLabel   = "ours"
+	defaultTheirsLabel = "theirs"
+)
+
+// MergeOptions are the options of Repository.Merge.
+type MergeOptions struct {
+	// NoFastForward merges the trees even if theirs is a descendant of
+	// ours, as git merge --no-ff does.
+	NoFastForward bool
+	// AllowUnrelatedHistories merges the commits without common history
+	// as if their base was an empty tree.
+	AllowUnrelatedHistories bool
+	// OursLabel and TheirsLabel are the labels of the sides of the
+	// conflict markers, "ours" and "theirs" if they are empty.
+	OursLabel, TheirsLabel string
+}
+
+func (o *MergeOptions) labels() (ours, theirs string) {
+	ours, theirs = defaultOursLabel, defaultTheirsLabel
+	if o != nil && o.OursLabel != "" {
+		ours = o.OursLabel
+	}
+
+	if o != nil && o.TheirsLabel != "" {
+		theirs = o.TheirsLabel
+	}
+
+	return ours, theirs
+}
+
+// MergeResult is the result of Repository.Merge.
+type MergeResult struct {
+	// Tree is the hash of the merged tree, with the conflicted files
+	// written with conflict markers, when they can be merged by lines, or
+	// as in ours otherwise.
+	Tree core.Hash
+	// Conflicts are the files that could not be merged, sorted by path.
+	Conflicts []*MergeConflict
+	// FastForward is true if theirs is a descendant of ours, and then Tree
+	// is the one of theirs, unless the options ask for a merge.
+	FastForward bool
+	// UpToDate is true if theirs is ours, or one of its ancestors, and
+	// then Tree is the one of ours.
+	UpToDate bool
+}
+
+// MergeConflict is a file changed on both sides of a merge that could not be
+// merged: changed in different lines, removed on one of them, or changed in
+// binary files or any other files but the regular ones.
+type MergeConflict struct {
+	// Path is the path of the file, relative to the root of the tree.
+	Path string
+	// Base, Ours and Theirs are the entries of the file in the merge base
+	// and on each side, nil where the file does not exist.
+	Base, Ours, Theirs *TreeEntry
+}
+
+// Merge merges the commit theirs into ours, as git merge does, without
+// committing it nor updating any reference: when theirs is a descendant of
+// ours the result is a fast-forward, and otherwise the trees of both are
+// merged with the one of their merge base, as git does with its recursive
+// strategy, file by file and with a three-way merge of the lines of the
+// files changed on both sides. The trees and blobs merged are stored.
+//
+// When the commits have several merge bases, they are merged first into a
+// virtual base, and ErrUnrelatedHistories is returned if they have none,
+// unless the options allow it.
+func (r *Repository) Merge(ours, theirs *Commit, opts *MergeOptions) (*MergeResult, error) {
+	bases, err := r.MergeBase(ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 && (opts == nil || !opts.AllowUnrelatedHistories) {
+		return nil, ErrUnrelatedHistories
+	}
+
+	if len(bases) == 1 && bases[0].Hash == theirs.Hash {
+		return &MergeResult{Tree: ours.TreeHash, UpToDate: true}, nil
+	}
+
+	if len(bases) == 1 && bases[0].Hash == ours.Hash && (opts == nil || !opts.NoFastForward) {
+		return &MergeResult{Tree: theirs.TreeHash, FastForward: true}, nil
+	}
+
+	base, err := r.virtualBase(bases)
+	if err != nil {
+		return nil, err
+	}
+
+	oursLabel, theirsLabel := opts.labels()
+	return r.mergeTrees(base, ours.TreeHash, theirs.TreeHash, oursLabel, theirsLabel)
+}
+
+// virtualBase returns the hash of the tree of the merge base of a merge with
+// the given merge bases: the tree of the base if there is only one, the
+// empty tree if there are none, and otherwise the tree of all of them
+// merged, one by one, as git merge-recursive does.
+func (r *Repository) virtualBase(bases []*Commit) (core.Hash, error) {
+	if len(bases) == 0 {
+		return core.ZeroHash, nil
+	}
+
+	tree := bases[0].TreeHash
+	for i, b := range bases[1:] {
+		common, err := r.MergeBase(bases[i], b)
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		base, err := r.virtualBase(common)
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		res, err := r.mergeTrees(base, tree, b.TreeHash,
+			"Temporary merge branch 1", "Temporary merge branch 2")
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		tree = res.Tree
+	}
+
+	return tree, nil
+}
+
+// mergeTrees merges the trees with the hashes ours and theirs, with the
+// tree base as their merge base, the empty tree if it is the zero hash, and
+// the given labels for the conflict markers.
+func (r *Repository) mergeTrees(base, ours, theirs core.Hash, oursLabel, theirsLabel string) (*MergeResult, error) {
+	m := &treeMerger{
+		r:           r,
+		b:           NewTreeBuilder(),
+		oursLabel:   oursLabel,
+		theirsLabel: theirsLabel,
+	}
+
+	entries := make([]*TreeEntry, 3)
+	for i, h := range []core.Hash{base, ours, theirs} {
+		if !h.IsZero() {
+			entries[i] = &TreeEntry{Mode: treeEntryDirMode, Hash: h}
+		}
+	}
+
+	if err := m.mergeDir("", entries[0], entries[1], entries[2]); err != nil {
+		return nil, err
+	}
+
+	tree, err := m.b.Write(r.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(mergeConflictsByPath(m.conflicts))
+	return &MergeResult{Tree: tree, Conflicts: m.conflicts}, nil
+}
+
+type mergeConflictsByPath []*MergeConflict
+
+func (s mergeConflictsByPath) Len() int           { return len(s) }
+func (s mergeConflictsByPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s mergeConflictsByPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
+
+// treeMerger merges trees into a TreeBuilder, collecting their conflicts.
+type treeMerger struct {
+	r                      *Repository
+	b                      *TreeBuilder
+	conflicts              []*MergeConflict
+	oursLabel, theirsLabel string
+}
+
+// merge merges the entries with the given path, from the merge base and
+// both sides, nil where they do not exist. The entries changed on a single
+// side are taken from it as they are, the whole subtree for a directory.
+func (m *treeMerger) merge(p string, base, ours, theirs *TreeEntry) error {
+	if !isTreeEntryDir(base) && !isTreeEntryDir(ours) && !isTreeEntryDir(theirs) ||
+		sameTreeEntry(ours, theirs) || sameTreeEntry(base, ours) || sameTreeEntry(base, theirs) {
+		e, ok, err := m.mergeFile(p, base, ours, theirs)
+		if err != nil {
+			return err
+		}
+
+		m.insert(p, e)
+		if !ok {
+			m.conflict(p, base, ours, theirs)
+		}
+
+		return nil
+	}
+
+	return m.mergeDirAndFile(p, base, ours, theirs)
+}
+
+// mergeDirAndFile merges the entries with the given path, some of them
+// directories. The directories are merged, and so are the files, but they
+// are a conflict if a file is left along with a directory, and then the
+// file is left out of the tree.
+func (m *treeMerger) mergeDirAndFile(p string, base, ours, theirs *TreeEntry) error {
+	var dirs, files [3]*TreeEntry
+	for i, e := range []*TreeEntry{base, ours, theirs} {
+		if isTreeEntryDir(e) {
+			dirs[i] = e
+		} else {
+			files[i] = e
+		}
+	}
+
+	if err := m.mergeDir(p, dirs[0], dirs[1], dirs[2]); err != nil {
+		return err
+	}
+
+	e, ok, err := m.mergeFile(p, files[0], files[1], files[2])
+	if err != nil || e == nil {
+		return err
+	}
+
+	if dirs[1] == nil && dirs[2] == nil {
+		m.insert(p, e)
+		if !ok {
+			m.conflict(p, files[0], files[1], files[2])
+		}
+
+		return nil
+	}
+
+	m.conflict(p, files[0], files[1], files[2])
+	return nil
+}
+
+// mergeDir merges the entries of the directories with the given path, nil
+// where they do not exist.
+func (m *treeMerger) mergeDir(dir string, base, ours, theirs *TreeEntry) error {
+	var names []string
+	entries := make(map[string][]*TreeEntry)
+	for i, e := range []*TreeEntry{base, ours, theirs} {
+		if e == nil {
+			continue
+		}
+
+		tree, err := m.r.Tree(e.Hash)
+		if err != nil {
+			return err
+		}
+
+		for j := range tree.Entries {
+			te := &tree.Entries[j]
+			if _, ok := entries[te.Name]; !ok {
+				entries[te.Name] = make([]*TreeEntry, 3)
+				names = append(names, te.Name)
+			}
+
+			entries[te.Name][i] = te
+		}
+	}
+
+	for _, name := range names {
+		es := entries[name]
+		if err := m.merge(path.Join(dir, name), es[0], es[1], es[2]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeFile merges the files with the given path, returning the entry of
+// the file merged, nil if it is removed, and false if they are a conflict,
+// as the ones removed on a side and changed on the other. The modes are merged
+// as the rest of the entries, and the content of the regular files by
+// lines, otherwise the entry is the one of ours, if it exists, or theirs.
+func (m *treeMerger) mergeFile(p string, base, ours, theirs *TreeEntry) (*TreeEntry, bool, error) {
+	switch {
+	case sameTreeEntry(ours, theirs), sameTreeEntry(base, theirs):
+		return ours, true, nil
+	case sameTreeEntry(base, ours):
+		return theirs, true, nil
+	case ours == nil:
+		return theirs, false, nil
+	case theirs == nil:
+		return ours, false, nil
+	}
+
+	e := &TreeEntry{Name: ours.Name, Mode: ours.Mode, Hash: ours.Hash}
+	ok := true
+	switch {
+	case ours.Mode == theirs.Mode:
+	case base != nil && base.Mode == ours.Mode:
+		e.Mode = theirs.Mode
+	case base == nil || base.Mode != theirs.Mode:
+		ok = false
+	}
+
+	if !isRegularMode(ours.Mode) || !isRegularMode(theirs.Mode) {
+		return e, false, nil
+	}
+
+	switch {
+	case ours.Hash == theirs.Hash:
+		return e, ok, nil
+	case base != nil && base.Hash == ours.Hash:
+		e.Hash = theirs.Hash
+		return e, ok, nil
+	case base != nil && base.Hash == theirs.Hash:
+		return e, ok, nil
+	}
+
+	var contents [3]string
+	for i, f := range []*TreeEntry{base, ours, theirs} {
+		if f == nil || !isRegularMode(f.Mode) {
+			continue
+		}
+
+		blob, err := m.r.BlobObject(f.Hash)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if contents[i], err = newFile(p, f.Mode, blob).Contents(); err != nil {
+			return nil, false, err
+		}
+
+		if isBinary(contents[i]) {
+			return e, false, nil
+		}
+	}
+
+	merged, clean := mergeLines(contents[0], contents[1], contents[2], m.oursLabel, m.theirsLabel)
+	obj := memory.NewObjectWithFormat(m.r.ObjectFormat(), core.BlobObject, int64(len(merged)), []byte(merged))
+	h, err := m.r.Storage.Set(obj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	e.Hash = h
+	return e, ok && clean, nil
+}
+
+func (m *treeMerger) insert(p string, e *TreeEntry) {
+	if e != nil {
+		m.b.Insert(p, e.Hash, e.Mode)
+	}
+}
+
+func (m *treeMerger) conflict(p string, base, ours, theirs *TreeEntry) {
+	m.conflicts = append(m.conflicts, &MergeConflict{Path: p, Base: base, Ours: ours, Theirs: theirs})
+}
+
+func sameTreeEntry(a, b *TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Mode == b.Mode && a.Hash == b.Hash
+}
+
+func isTreeEntryDir(e *TreeEntry) bool {
+	return e != nil && e.Mode == treeEntryDirMode
+}
+
+func isRegularMode(m os.FileMode) bool {
+	return m&^0777 == treeEntryRegularType
+}
+
+// mergeHunk is a change of a file compared to the merge base: the lines
+// from start to end of the base, not included, replaced by lines.
+type mergeHunk struct {
+	start, end int
+	lines      []string
+}
+
+// mergeLines merges the changes of ours and theirs compared to base, line
+// by line, as git merge-file does, returning the content merged and false
+// if they have conflicts. The changes of both sides that overlap, or touch
+// each other, are a conflict unless they are the same, and then the lines
+// of each side are written between conflict markers with the given labels,
+// without the ones at their start and end that are the same in both.
+func mergeLines(base, ours, theirs, oursLabel, theirsLabel string) (string, bool) {
+	lines := splitLinesWithEOL(base)
+	o := mergeHunks(diff.Do(base, ours))
+	t := mergeHunks(diff.Do(base, theirs))
+
+	var buf bytes.Buffer
+	clean := true
+	pos := 0
+	for len(o) != 0 || len(t) != 0 {
+		// the hunks of both sides that overlap with the first one
+		var first []mergeHunk
+		if len(t) == 0 || len(o) != 0 && o[0].start <= t[0].start {
+			first = o
+		} else {
+			first = t
+		}
+
+		start, end := first[0].start, first[0].end
+		var i, j int
+		for {
+			if i < len(o) && o[i].start <= end {
+				if o[i].end > end {
+					end = o[i].end
+				}
+
+				i++
+			} else if j < len(t) && t[j].start <= end {
+				if t[j].end > end {
+					end = t[j].end
+				}
+
+				j++
+			} else {
+				break
+			}
+		}
+
+		writeLines(&buf, lines[pos:start])
+		ol := applyHunks(lines, start, end, o[:i])
+		tl := applyHunks(lines, start, end, t[:j])
+		switch {
+		case j == 0:
+			writeLines(&buf, ol)
+		case i == 0 || equalLines(ol, tl):
+			writeLines(&buf, tl)
+		default:
+			clean = false
+			writeConflict(&buf, ol, tl, oursLabel, theirsLabel)
+		}
+
+		o, t, pos = o[i:], t[j:], end
+	}
+
+	writeLines(&buf, lines[pos:])
+	return buf.String(), clean
+}
+
+// mergeHunks returns the hunks of the given diff of the lines of a file.
+func mergeHunks(diffs []diffmatchpatch.Diff) []mergeHunk {
+	var hunks []mergeHunk
+	var pos int
+	open := false
+	for _, d := range diffs {
+		lines := splitLinesWithEOL(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			pos += len(lines)
+			open = false
+			continue
+		}
+
+		if !open {
+			hunks = append(hunks, mergeHunk{start: pos, end: pos})
+			open = true
+		}
+
+		h := &hunks[len(hunks)-1]
+		if d.Type == diffmatchpatch.DiffDelete {
+			pos += len(lines)
+			h.end = pos
+		} else {
+			h.lines = append(h.lines, lines...)
+		}
+	}
+
+	return hunks
+}
+
+// applyHunks returns the lines from start to end of the base, not included,
+// with the given hunks, in them, applied.
+func applyHunks(base []string, start, end int, hunks []mergeHunk) []string {
+	var lines []string
+	pos := start
+	for _, h := range hunks {
+		lines = append(lines, base[pos:h.start]...)
+		lines = append(lines, h.lines...)
+		pos = h.end
+	}
+
+	return append(lines, base[pos:end]...)
+}
+
+// writeConflict writes the lines of ours and theirs between conflict
+// markers, but the ones at their start and end that are the same.
+func writeConflict(buf *bytes.Buffer, ours, theirs []string, oursLabel, theirsLabel string) {
+	var prefix, suffix int
+	for prefix < len(ours) && prefix < len(theirs) && ours[prefix] == theirs[prefix] {
+		prefix++
+	}
+
+	for suffix < len(ours)-prefix && suffix < len(theirs)-prefix &&
+		ours[len(ours)-1-suffix] == theirs[len(theirs)-1-suffix] {
+		suffix++
+	}
+
+	writeLines(buf, ours[:prefix])
+	buf.WriteString("<<<<<<< " + oursLabel + "\n")
+	writeConflictLines(buf, ours[prefix:len(ours)-suffix])
+	buf.WriteString("=======\n")
+	writeConflictLines(buf, theirs[prefix:len(theirs)-suffix])
+	buf.WriteString(">>>>>>> " + theirsLabel + "\n")
+	writeLines(buf, ours[len(ours)-suffix:])
+}
+
+// writeConflictLines writes the lines of a side of a conflict, ending the
+// last one, as the markers are written in lines of their own.
+func writeConflictLines(buf *bytes.Buffer, lines []string) {
+	writeLines(buf, lines)
+	if len(lines) != 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		buf.WriteByte('\n')
+	}
+}
+
+func writeLines(buf *bytes.Buffer, lines []string) {
+	for _, l := range lines {
+		buf.WriteString(l)
+	}
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
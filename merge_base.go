@@ -0,0 +1,250 @@
+package git
+
+import (
+	"container/heap"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// the flags painted on the commits by paintDownToCommon
+const (
+	parent1 = 1 << iota // reachable from the first commit
+	parent2             // reachable from the other commits
+	stale               // reachable from a common ancestor
+	result              // a common ancestor found
+)
+
+// MergeBase returns the best common ancestors of the commits a and b, the
+// ones that are not ancestors of any other common ancestor, newest first by
+// committer date, as git merge-base --all does. There is usually one, but a
+// criss-cross merge history has several, and there are none if the commits
+// do not share any history.
+func (r *Repository) MergeBase(a, b *Commit) ([]*Commit, error) {
+	if a.Hash == b.Hash {
+		return []*Commit{a}, nil
+	}
+
+	candidates, flags, err := r.paintDownToCommon(a, []*Commit{b})
+	if err != nil {
+		return nil, err
+	}
+
+	var bases []*Commit
+	for _, c := range candidates {
+		if flags[c.Hash]&stale == 0 {
+			bases = append(bases, c)
+		}
+	}
+
+	bases, err = r.removeRedundant(bases)
+	if err != nil {
+		return nil, err
+	}
+
+	// the commits read from the commit-graph are decoded
+	for i, c := range bases {
+		if bases[i], err = r.Commit(c.Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return bases, nil
+}
+
+// AheadBehind returns the number of commits reachable from local and not from
+// upstream, and the other way around, as git rev-list --left-right --count
+// local...upstream does. Only the history newer than the merge bases of both
+// commits is walked, so the counts are the whole histories only if they are
+// unrelated.
+func (r *Repository) AheadBehind(local, upstream core.Hash) (ahead, behind int, err error) {
+	l, err := r.Commit(local)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	u, err := r.Commit(upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if local == upstream {
+		return 0, 0, nil
+	}
+
+	// every commit found is flagged, the ones not flagged as common are in
+	// the history of only one of the commits
+	_, flags, err := r.paintDownToCommon(l, []*Commit{u})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, f := range flags {
+		switch f & (parent1 | parent2 | stale) {
+		case parent1:
+			ahead++
+		case parent2:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+// IsAncestor returns true if the commit is an ancestor of other, or other
+// itself, as git merge-base --is-ancestor does. The history of other is
+// walked only until the commit is found.
+func (c *Commit) IsAncestor(other *Commit) (bool, error) {
+	return c.r.isAncestor(c, []*Commit{other})
+}
+
+// isAncestor returns true if the commit c is an ancestor of any of the
+// commits of others, or one of them. With a commit-graph, the parents of the
+// commits with a lower generation than c are not walked, as c cannot be one
+// of their ancestors.
+func (r *Repository) isAncestor(c *Commit, others []*Commit) (bool, error) {
+	if len(others) == 0 {
+		return false, nil
+	}
+
+	g, err := r.commitGraph()
+	if err != nil {
+		return false, err
+	}
+
+	var minGeneration uint32
+	if g != nil {
+		minGeneration = generation(g, c.Hash)
+	}
+
+	seen := make(map[core.Hash]bool, len(others))
+	var pending commitHeap
+	for _, o := range others {
+		if !seen[o.Hash] {
+			seen[o.Hash] = true
+			heap.Push(&pending, o)
+		}
+	}
+
+	for len(pending) != 0 {
+		o := heap.Pop(&pending).(*Commit)
+		if o.Hash == c.Hash {
+			return true, nil
+		}
+
+		if g != nil && generation(g, o.Hash) < minGeneration {
+			continue
+		}
+
+		parents, err := r.graphParents(g, o)
+		if err != nil {
+			return false, err
+		}
+
+		for _, p := range parents {
+			if !seen[p.Hash] {
+				seen[p.Hash] = true
+				heap.Push(&pending, p)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// paintDownToCommon finds the common ancestors of the commit one and any of
+// the commits of twos, the way git does: the history of all of them is
+// walked newest first by committer date, painting every commit with the
+// commits it is reachable from. The commits painted from both sides are
+// common ancestors, and their ancestors are painted as stale, so the walk
+// ends once only stale commits are left.
+//
+// The common ancestors found are returned in the order they were found,
+// read from the commit-graph if they are in it, see graphParents, along
+// with the flags of every commit walked. The ones flagged as stale are
+// ancestors of another common ancestor.
+func (r *Repository) paintDownToCommon(one *Commit, twos []*Commit) (
+	[]*Commit, map[core.Hash]int, error) {
+
+	g, err := r.commitGraph()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flags := map[core.Hash]int{one.Hash: parent1}
+	var pending commitHeap
+	heap.Push(&pending, one)
+	for _, two := range twos {
+		if flags[two.Hash]&parent2 == 0 {
+			flags[two.Hash] |= parent2
+			heap.Push(&pending, two)
+		}
+	}
+
+	var common []*Commit
+	for hasNonStale(pending, flags) {
+		c := heap.Pop(&pending).(*Commit)
+		f := flags[c.Hash] & (parent1 | parent2 | stale)
+		if f == parent1|parent2 {
+			if flags[c.Hash]&result == 0 {
+				flags[c.Hash] |= result
+				common = append(common, c)
+			}
+
+			f |= stale
+		}
+
+		parents, err := r.graphParents(g, c)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, p := range parents {
+			if flags[p.Hash]&f == f {
+				continue
+			}
+
+			flags[p.Hash] |= f
+			heap.Push(&pending, p)
+		}
+	}
+
+	return common, flags, nil
+}
+
+func hasNonStale(pending commitHeap, flags map[core.Hash]int) bool {
+	for _, c := range pending {
+		if flags[c.Hash]&stale == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeRedundant returns the commits that are not ancestors of any other of
+// the given commits, newest first by committer date.
+func (r *Repository) removeRedundant(commits []*Commit) ([]*Commit, error) {
+	sort.Stable(commitHeap(commits))
+	if len(commits) < 2 {
+		return commits, nil
+	}
+
+	var bases []*Commit
+	for i, c := range commits {
+		others := make([]*Commit, 0, len(commits)-1)
+		others = append(others, commits[:i]...)
+		others = append(others, commits[i+1:]...)
+
+		redundant, err := r.isAncestor(c, others)
+		if err != nil {
+			return nil, err
+		}
+
+		if !redundant {
+			bases = append(bases, c)
+		}
+	}
+
+	return bases, nil
+}
@@ -0,0 +1,253 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// crissCrossFixture is a repository written by git with a criss-cross merge:
+// the branches master and y merge each other, and then have a commit each.
+// The branch orphan does not share any history with them.
+const crissCrossFixture = "fixtures/crisscross.tgz"
+
+// the commits of crissCrossFixture
+const (
+	ccInitial = "05e37b2ba49411d497493b50bafb48e0d2f5c0d0"
+	ccX1      = "ecb069cff3666ae5b7ab3b25cd0a988e66319912"
+	ccY1      = "fe4692965636e19debe9fff5544a99487381acca"
+	ccMergeY  = "6f361fa0cc33d97227b5f77c5ff5ff03041e8e42" // y 1 into master
+	ccMergeX  = "37c68f17d9936170cf2016d6e444d632a07fa6c2" // x 1 into y
+	ccX3      = "a6286ef7a619781bf177b8d07e6230288e5f4969" // master
+	ccY3      = "b43a5d8283194f9001a34785a7be7f70e0f4b15d" // y
+	ccOrphan  = "f5231d45b299afdabe35a011c3bf294a77b1c7a0" // orphan
+)
+
+type SuiteMergeBase struct {
+	dirs   []string
+	cc     *Repository
+	merges *Repository
+}
+
+var _ = Suite(&SuiteMergeBase{})
+
+func (s *SuiteMergeBase) SetUpSuite(c *C) {
+	for _, t := range []struct {
+		fixture string
+		r       **Repository
+	}{
+		{crissCrossFixture, &s.cc},
+		{mergesFixture, &s.merges},
+	} {
+		dir, err := tgz.Extract(t.fixture)
+		c.Assert(err, IsNil)
+		s.dirs = append(s.dirs, dir)
+
+		*t.r, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(dir, ".git"))
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *SuiteMergeBase) TearDownSuite(c *C) {
+	for _, dir := range s.dirs {
+		c.Assert(os.RemoveAll(dir), IsNil)
+	}
+}
+
+// the expected merge bases have been obtained with git merge-base --all
+func (s *SuiteMergeBase) TestMergeBase(c *C) {
+	for _, t := range []struct {
+		r        *Repository
+		a, b     string
+		expected []string
+	}{
+		{s.cc, ccX3, ccY3, []string{ccY1, ccX1}},
+		{s.cc, ccMergeY, ccMergeX, []string{ccY1, ccX1}},
+		{s.cc, ccX1, ccY1, []string{ccInitial}},
+		{s.cc, ccX3, ccX1, []string{ccX1}},
+		{s.cc, ccX1, ccX3, []string{ccX1}},
+		{s.cc, ccX3, ccX3, []string{ccX3}},
+		{s.cc, ccX3, ccOrphan, nil},
+		{
+			s.merges,
+			"3535f80b8fc84ebedf448014e79191c0e867b575", // feature 3
+			"4e41be12f377c59513e92d8036c8ffbca3024427", // master 4
+			[]string{"053869ce909291337e76ac4e5e989d52b8a12f21"},
+		},
+		{
+			s.merges,
+			"65348e200a5e368f71c8973e0e5359c275be42c5", // b 1
+			"4e77e23f41ac412bcea558829c0e3454df543864", // c 1
+			[]string{"0ac063db656012ad3b4617e13f6e5d3849b41426"},
+		},
+	} {
+		a, err := t.r.Commit(core.NewHash(t.a))
+		c.Assert(err, IsNil)
+		b, err := t.r.Commit(core.NewHash(t.b))
+		c.Assert(err, IsNil)
+
+		bases, err := t.r.MergeBase(a, b)
+		c.Assert(err, IsNil)
+
+		var obtained []string
+		for _, base := range bases {
+			obtained = append(obtained, base.Hash.String())
+		}
+
+		c.Assert(obtained, DeepEquals, t.expected, Commentf("a=%s b=%s", t.a, t.b))
+	}
+}
+
+func (s *SuiteMergeBase) TestIsAncestor(c *C) {
+	for _, t := range []struct {
+		c, other string
+		expected bool
+	}{
+		{ccInitial, ccX3, true},
+		{ccX1, ccY3, true},
+		{ccY1, ccX3, true},
+		{ccMergeY, ccX3, true},
+		{ccMergeY, ccY3, false},
+		{ccX3, ccX3, true},
+		{ccX3, ccX1, false},
+		{ccX3, ccY3, false},
+		{ccOrphan, ccX3, false},
+		{ccInitial, ccOrphan, false},
+	} {
+		commit, err := s.cc.Commit(core.NewHash(t.c))
+		c.Assert(err, IsNil)
+		other, err := s.cc.Commit(core.NewHash(t.other))
+		c.Assert(err, IsNil)
+
+		ok, err := commit.IsAncestor(other)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, t.expected, Commentf("c=%s other=%s", t.c, t.other))
+	}
+}
+
+func (s *SuiteMergeBase) TestMergeBaseObjectNotFound(c *C) {
+	// the parent of the first commit is missing
+	missing := core.NewHash("0000000000000000000000000000000000000001")
+	r, h := commitLine(c, []*Commit{{ParentHashes: []core.Hash{missing}}, {}})
+
+	tip, err := r.Commit(h)
+	c.Assert(err, IsNil)
+	first, err := r.Commit(tip.ParentHashes[0])
+	c.Assert(err, IsNil)
+
+	_, err = r.MergeBase(first, tip)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	_, err = tip.IsAncestor(first)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	ok, err := first.IsAncestor(tip)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+}
+
+// the expected counts have been obtained with git rev-list --left-right
+// --count
+func (s *SuiteMergeBase) TestAheadBehind(c *C) {
+	for _, t := range []struct {
+		r               *Repository
+		local, upstream string
+		ahead, behind   int
+	}{
+		{s.cc, ccX3, ccY3, 2, 2},
+		{s.cc, ccX3, ccOrphan, 5, 1},
+		{s.cc, ccMergeY, ccX3, 0, 1},
+		{s.cc, ccX3, ccX3, 0, 0},
+		{s.cc, ccY1, ccX3, 0, 3},
+		{
+			s.merges,
+			"3535f80b8fc84ebedf448014e79191c0e867b575", // feature 3
+			"4e41be12f377c59513e92d8036c8ffbca3024427", // master 4
+			1, 10,
+		},
+		{
+			s.merges,
+			"65348e200a5e368f71c8973e0e5359c275be42c5", // b 1
+			"972eb2a3177a422bd2b0ad4991df73d32e0fc763", // Merge feature again
+			0, 8,
+		},
+	} {
+		ahead, behind, err := t.r.AheadBehind(core.NewHash(t.local), core.NewHash(t.upstream))
+		c.Assert(err, IsNil)
+
+		comment := Commentf("local=%s upstream=%s", t.local, t.upstream)
+		c.Assert(ahead, Equals, t.ahead, comment)
+		c.Assert(behind, Equals, t.behind, comment)
+	}
+}
+
+func (s *SuiteMergeBase) TestAheadBehindObjectNotFound(c *C) {
+	_, _, err := s.cc.AheadBehind(core.NewHash(ccX3), core.NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteMergeBase) TestAheadBehindHistoryNotWalked(c *C) {
+	// the parent of the first commit is missing, so the history older than
+	// the merge base must not be walked
+	r, local, upstream := forkedHistory(c, 10, 3, 5)
+	ahead, behind, err := r.AheadBehind(local, upstream)
+	c.Assert(err, IsNil)
+	c.Assert(ahead, Equals, 3)
+	c.Assert(behind, Equals, 5)
+}
+
+func (s *SuiteMergeBase) BenchmarkAheadBehind(c *C) {
+	r, local, upstream := forkedHistory(c, 10000, 3, 5)
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		_, _, err := r.AheadBehind(local, upstream)
+		c.Assert(err, IsNil)
+	}
+}
+
+// forkedHistory returns a repository with a line of n commits, with the
+// parent of the first one missing, and the tips of two branches forked from
+// its last commit, with the given number of commits each.
+func forkedHistory(c *C, n, local, upstream int) (*Repository, core.Hash, core.Hash) {
+	missing := core.NewHash("0000000000000000000000000000000000000001")
+	commits := []*Commit{{ParentHashes: []core.Hash{missing}}}
+	for i := 1; i < n; i++ {
+		commits = append(commits, &Commit{})
+	}
+
+	r, fork := commitLine(c, commits)
+	forkCommit, err := r.Commit(fork)
+	c.Assert(err, IsNil)
+
+	tips := make([]core.Hash, 2)
+	for i, count := range []int{local, upstream} {
+		tips[i] = fork
+		for j := 0; j < count; j++ {
+			sig := forkCommit.Author
+			sig.When = sig.When.Add(time.Duration(j+1) * time.Second)
+			commit := &Commit{
+				TreeHash:     EmptyTreeHash,
+				ParentHashes: []core.Hash{tips[i]},
+				Author:       sig,
+				Committer:    sig,
+				Message:      fmt.Sprintf("branch %d, commit %d\n", i, j),
+			}
+
+			obj := &memory.Object{}
+			c.Assert(commit.Encode(obj), IsNil)
+			tips[i], err = r.Storage.Set(obj)
+			c.Assert(err, IsNil)
+		}
+	}
+
+	return r, tips[0], tips[1]
+}
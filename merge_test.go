@@ -0,0 +1,268 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMerge struct {
+	r    *Repository
+	when int64
+}
+
+var _ = Suite(&SuiteMerge{})
+
+func (s *SuiteMerge) SetUpTest(c *C) {
+	s.r = NewPlainRepository()
+	s.when = 0
+}
+
+// commit commits a tree with the given files, their contents by path, and
+// the executable ones with a trailing "*" in their paths.
+func (s *SuiteMerge) commit(c *C, files map[string]string, parents ...*Commit) *Commit {
+	b := NewTreeBuilder()
+	for p, content := range files {
+		mode := treeEntryRegularMode
+		if p[len(p)-1] == '*' {
+			p, mode = p[:len(p)-1], treeEntryExecutableMode
+		}
+
+		blob := memory.NewObject(core.BlobObject, int64(len(content)), []byte(content))
+		h, err := s.r.Storage.Set(blob)
+		c.Assert(err, IsNil)
+		b.Insert(p, h, mode)
+	}
+
+	tree, err := b.Write(s.r.Storage)
+	c.Assert(err, IsNil)
+
+	s.when++
+	sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(s.when, 0)}
+	commit := &Commit{Author: sig, Committer: sig, Message: "foo\n", TreeHash: tree}
+	for _, p := range parents {
+		commit.ParentHashes = append(commit.ParentHashes, p.Hash)
+	}
+
+	o := s.r.newObject()
+	c.Assert(commit.Encode(o), IsNil)
+	h, err := s.r.Storage.Set(o)
+	c.Assert(err, IsNil)
+
+	commit, err = s.r.Commit(h)
+	c.Assert(err, IsNil)
+	return commit
+}
+
+// files returns the files of the tree with the given hash, their contents
+// by path, as the ones given to commit.
+func (s *SuiteMerge) files(c *C, h core.Hash) map[string]string {
+	tree, err := s.r.Tree(h)
+	c.Assert(err, IsNil)
+
+	files := make(map[string]string)
+	iter := tree.Files()
+	defer iter.Close()
+	c.Assert(iter.ForEach(func(f *File) error {
+		content, err := f.Contents()
+		if f.IsExecutable() {
+			f.Name += "*"
+		}
+
+		files[f.Name] = content
+		return err
+	}), IsNil)
+
+	return files
+}
+
+func (s *SuiteMerge) TestMergeFastForward(c *C) {
+	base := s.commit(c, map[string]string{"foo": "foo\n"})
+	next := s.commit(c, map[string]string{"foo": "bar\n"}, base)
+
+	res, err := s.r.Merge(base, next, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res, DeepEquals, &MergeResult{Tree: next.TreeHash, FastForward: true})
+
+	res, err = s.r.Merge(next, base, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res, DeepEquals, &MergeResult{Tree: next.TreeHash, UpToDate: true})
+
+	res, err = s.r.Merge(next, next, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.UpToDate, Equals, true)
+
+	res, err = s.r.Merge(base, next, &MergeOptions{NoFastForward: true})
+	c.Assert(err, IsNil)
+	c.Assert(res, DeepEquals, &MergeResult{Tree: next.TreeHash})
+}
+
+func (s *SuiteMerge) TestMerge(c *C) {
+	base := s.commit(c, map[string]string{
+		"foo":   "1\n2\n3\n4\n5\n",
+		"bar":   "bar\n",
+		"dir/a": "a\n",
+		"same":  "same\n",
+		"mode":  "1\n2\n3\n",
+	})
+
+	ours := s.commit(c, map[string]string{
+		"foo":   "one\n2\n3\n4\n5\n",
+		"dir/a": "a\n",
+		"dir/b": "b\n",
+		"same":  "changed\n",
+		"mode*": "1\n2\n3\n",
+	}, base)
+
+	theirs := s.commit(c, map[string]string{
+		"foo":   "1\n2\n3\n4\nfive\n",
+		"bar":   "bar\n",
+		"dir/a": "A\n",
+		"same":  "changed\n",
+		"mode":  "1\n2\nthree\n",
+		"qux":   "qux\n",
+	}, base)
+
+	res, err := s.r.Merge(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 0)
+	c.Assert(res.FastForward, Equals, false)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo":   "one\n2\n3\n4\nfive\n",
+		"dir/a": "A\n",
+		"dir/b": "b\n",
+		"same":  "changed\n",
+		"mode*": "1\n2\nthree\n",
+		"qux":   "qux\n",
+	})
+}
+
+func (s *SuiteMerge) TestMergeConflicts(c *C) {
+	base := s.commit(c, map[string]string{
+		"foo":     "1\n2\n3\n4\n5\n",
+		"deleted": "deleted\n",
+		"binary":  "\x00foo",
+		"mode":    "mode\n",
+	})
+
+	ours := s.commit(c, map[string]string{
+		"foo":    "1\n2\nours\n4\n5\n",
+		"added":  "a\nb\n",
+		"binary": "\x00bar",
+		"mode*":  "mode\n",
+	}, base)
+
+	theirs := s.commit(c, map[string]string{
+		"foo":     "1\n2\ntheirs\n4\n5\n",
+		"added":   "a\nc\n",
+		"deleted": "changed\n",
+		"binary":  "\x00qux",
+		"mode":    "changed\n",
+	}, base)
+
+	res, err := s.r.Merge(ours, theirs, &MergeOptions{OursLabel: "HEAD", TheirsLabel: "feature"})
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo":     "1\n2\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\n4\n5\n",
+		"added":   "a\n<<<<<<< HEAD\nb\n=======\nc\n>>>>>>> feature\n",
+		"deleted": "changed\n",
+		"binary":  "\x00bar",
+		"mode*":   "changed\n",
+	})
+
+	var paths []string
+	for _, conflict := range res.Conflicts {
+		paths = append(paths, conflict.Path)
+	}
+
+	c.Assert(paths, DeepEquals, []string{"added", "binary", "deleted", "foo"})
+
+	deleted := res.Conflicts[2]
+	c.Assert(deleted.Base.Name, Equals, "deleted")
+	c.Assert(deleted.Ours, IsNil)
+	c.Assert(deleted.Theirs.Hash, Not(Equals), deleted.Base.Hash)
+	c.Assert(res.Conflicts[0].Base, IsNil)
+}
+
+func (s *SuiteMerge) TestMergeDirectoryAndFile(c *C) {
+	base := s.commit(c, map[string]string{"foo": "foo\n", "bar": "bar\n"})
+	ours := s.commit(c, map[string]string{"foo/a": "a\n", "bar/b": "b\n"}, base)
+	theirs := s.commit(c, map[string]string{"foo": "changed\n", "bar": "bar\n"}, base)
+
+	res, err := s.r.Merge(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Path, Equals, "foo")
+	c.Assert(res.Conflicts[0].Theirs.Name, Equals, "foo")
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"foo/a": "a\n", "bar/b": "b\n"})
+}
+
+func (s *SuiteMerge) TestMergeUnrelated(c *C) {
+	ours := s.commit(c, map[string]string{"foo": "foo\n", "bar": "bar\n"})
+	theirs := s.commit(c, map[string]string{"foo": "foo\n", "qux": "qux\n"})
+
+	_, err := s.r.Merge(ours, theirs, nil)
+	c.Assert(err, Equals, ErrUnrelatedHistories)
+
+	res, err := s.r.Merge(ours, theirs, &MergeOptions{AllowUnrelatedHistories: true})
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 0)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo": "foo\n", "bar": "bar\n", "qux": "qux\n",
+	})
+}
+
+// the merged trees are the ones of git merge-tree --write-tree
+func (s *SuiteMerge) TestMergeCrissCross(c *C) {
+	dir, err := tgz.Extract(crissCrossFixture)
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		ours, theirs, tree string
+	}{
+		{ccX3, ccY3, "6d2f7c9c5ec38c22c41ad03b6717cc7a0e106b79"},
+		{ccX1, ccY1, "07710ffba99fbfe36111bf00a38b4afac6cf61c6"},
+	} {
+		ours, err := r.Commit(core.NewHash(t.ours))
+		c.Assert(err, IsNil)
+		theirs, err := r.Commit(core.NewHash(t.theirs))
+		c.Assert(err, IsNil)
+
+		res, err := r.Merge(ours, theirs, nil)
+		c.Assert(err, IsNil)
+		c.Assert(res.Conflicts, HasLen, 0)
+		c.Assert(res.Tree, Equals, core.NewHash(t.tree))
+	}
+}
+
+func (s *SuiteMerge) TestMergeLines(c *C) {
+	for _, t := range []struct {
+		base, ours, theirs string
+		merged             string
+		clean              bool
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", true},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", true},
+		{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", true},
+		{"a\nb\nc\n", "x\na\nb\nc\n", "a\nb\nc\ny\n", "x\na\nb\nc\ny\n", true},
+		{"a\nb\nc\n", "a\nc\n", "a\nb\nc\n", "a\nc\n", true},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nB\nc\n", "<<<<<<< ours\nA\nb\n=======\na\nB\n>>>>>>> theirs\nc\n", false},
+		{"a\nb\n", "a\nb\nx", "a\nb\ny", "a\nb\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", false},
+		{"a\n", "a\nx\ny\nz\n", "a\nx\nq\nz\n", "a\nx\n<<<<<<< ours\ny\n=======\nq\n>>>>>>> theirs\nz\n", false},
+	} {
+		merged, clean := mergeLines(t.base, t.ours, t.theirs, "ours", "theirs")
+		c.Assert(merged, Equals, t.merged, Commentf("ours=%q theirs=%q", t.ours, t.theirs))
+		c.Assert(clean, Equals, t.clean)
+	}
+}
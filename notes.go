@@ -0,0 +1,409 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+// DefaultNotesRef is the notes reference used by git notes by default, the
+// one of the notes of the commits.
+const DefaultNotesRef = "refs/notes/commits"
+
+var (
+	// ErrNoteNotFound is returned by Repository.Note and RemoveNote when the
+	// object has no note.
+	ErrNoteNotFound = errors.New("note not found")
+	// ErrNoteExists is returned by Repository.AddNote when the object has a
+	// note already, unless the options force it.
+	ErrNoteExists = errors.New("note already exists")
+)
+
+// Note is a note attached to an object, stored as a blob in the tree of the
+// commit of a notes reference.
+type Note struct {
+	// Target is the hash of the object the note is attached to.
+	Target core.Hash
+	// File is the blob of the note, named after its path in the notes tree,
+	// the hash of the target, split in fan-out directories like ab/cdef...
+	// in the large notes trees.
+	*File
+}
+
+// NoteOptions describes how a note is added or removed.
+type NoteOptions struct {
+	// Committer is the author and committer of the commit of the notes
+	// reference, at the current time if its When is zero.
+	Committer Signature
+	// Message is the message of the commit, the one of git notes by default.
+	Message string
+	// Force replaces the note of the object if it has one already, it is not
+	// used by RemoveNote.
+	Force bool
+}
+
+// committer returns the signature of the commit, the one of the options at
+// the current time if its When is zero.
+func (o *NoteOptions) committer() Signature {
+	var s Signature
+	if o != nil {
+		s = o.Committer
+	}
+
+	if s.When.IsZero() {
+		s.When = time.Now()
+	}
+
+	return s
+}
+
+func (o *NoteOptions) message(def string) string {
+	if o == nil || o.Message == "" {
+		return def
+	}
+
+	if !strings.HasSuffix(o.Message, "\n") {
+		return o.Message + "\n"
+	}
+
+	return o.Message
+}
+
+// notesRefName returns the name of the notes reference ref, as git notes
+// --ref does: DefaultNotesRef if ref is empty, ref itself if it is under
+// refs/notes/, and refs/notes/<ref> otherwise.
+func notesRefName(ref string) core.ReferenceName {
+	switch {
+	case ref == "":
+		return DefaultNotesRef
+	case strings.HasPrefix(ref, "refs/notes/"):
+		return core.ReferenceName(ref)
+	default:
+		return core.ReferenceName("refs/notes/" + ref)
+	}
+}
+
+// notesTree returns the reference with the given name and the tree of its
+// commit, both nil if there is no such reference.
+func (r *Repository) notesTree(name core.ReferenceName) (*core.Reference, *Tree, error) {
+	ref, err := r.Reference(name, true)
+	if err == core.ErrReferenceNotFound {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit, err := r.Commit(ref.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ref, tree, nil
+}
+
+// Notes returns a NoteIter for the notes of DefaultNotesRef, empty if there
+// is no such reference.
+func (r *Repository) Notes() (*NoteIter, error) {
+	_, tree, err := r.notesTree(DefaultNotesRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if tree == nil {
+		tree = &Tree{r: r}
+	}
+
+	return NewNoteIter(r, tree), nil
+}
+
+// Note returns the blob of the note attached to the object with the given
+// hash in the notes reference ref, see git notes --ref, DefaultNotesRef if
+// ref is empty. The note is found at any fan-out level of the notes tree.
+// ErrNoteNotFound is returned if the object has no note, or there is no such
+// reference.
+func (r *Repository) Note(ref string, target core.Hash) (*File, error) {
+	_, tree, err := r.notesTree(notesRefName(ref))
+	if err != nil {
+		return nil, err
+	}
+
+	if tree == nil {
+		return nil, ErrNoteNotFound
+	}
+
+	return tree.note("", target.String())
+}
+
+// note returns the note whose remaining name, once the fan-out directories
+// found are stripped, is name: a blob named so, or the one in the directory
+// named after its first two digits, recursively.
+func (t *Tree) note(base, name string) (*File, error) {
+	if e, err := t.entry(name); err == nil && e.Mode != treeEntryDirMode {
+		return t.file(base+name, e)
+	}
+
+	if len(name) <= 2 {
+		return nil, ErrNoteNotFound
+	}
+
+	e, err := t.entry(name[:2])
+	if err != nil || e.Mode != treeEntryDirMode {
+		return nil, ErrNoteNotFound
+	}
+
+	sub, err := t.subtree(e)
+	if err == ErrDirectoryNotFound {
+		return nil, ErrNoteNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sub.note(base+name[:2]+"/", name[2:])
+}
+
+// AddNote attaches a note with the given content to the object with the
+// given hash, in the notes reference ref, DefaultNotesRef if it is empty,
+// and returns the hash of the new commit of the reference. The notes tree is
+// written with a TreeBuilder, the note at the fan-out level of the other
+// notes, and the commit has the previous one of the reference as parent.
+//
+// ErrObjectNotFound is returned if the object is not in the repository, and
+// ErrNoteExists if it has a note already, unless the options force it.
+func (r *Repository) AddNote(ref string, target core.Hash, content string, opts *NoteOptions) (core.Hash, error) {
+	ok, err := r.hasObject(target)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	if !ok {
+		return core.ZeroHash, ErrObjectNotFound
+	}
+
+	blob := memory.NewObjectWithFormat(r.ObjectFormat(), core.BlobObject, int64(len(content)), []byte(content))
+	h, err := r.Storage.Set(blob)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	message := opts.message("Notes added by 'git notes add'\n")
+	return r.updateNotes(notesRefName(ref), target, opts, message,
+		func(b *TreeBuilder, old string, fanout int) error {
+			if old != "" {
+				if opts == nil || !opts.Force {
+					return ErrNoteExists
+				}
+
+				b.Remove(old)
+			}
+
+			b.Insert(notePath(target, fanout), h, treeEntryRegularMode)
+			return nil
+		})
+}
+
+// RemoveNote removes the note attached to the object with the given hash
+// from the notes reference ref, DefaultNotesRef if it is empty, and returns
+// the hash of the new commit of the reference. ErrNoteNotFound is returned
+// if the object has no note.
+func (r *Repository) RemoveNote(ref string, target core.Hash, opts *NoteOptions) (core.Hash, error) {
+	message := opts.message("Notes removed by 'git notes remove'\n")
+	return r.updateNotes(notesRefName(ref), target, opts, message,
+		func(b *TreeBuilder, old string, fanout int) error {
+			if old == "" {
+				return ErrNoteNotFound
+			}
+
+			b.Remove(old)
+			return nil
+		})
+}
+
+// updateNotes commits to the notes reference with the given name the notes
+// tree changed by fn, which is called with a TreeBuilder holding the current
+// tree, the path of the note of target in it, empty if it has none, and the
+// number of fan-out directories of the notes, the ones of the first note.
+func (r *Repository) updateNotes(
+	name core.ReferenceName, target core.Hash, opts *NoteOptions, message string,
+	fn func(b *TreeBuilder, old string, fanout int) error,
+) (core.Hash, error) {
+	ref, tree, err := r.notesTree(name)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	b := NewTreeBuilder()
+	var old string
+	fanout := -1
+	if tree != nil {
+		err = tree.Walk(func(path string, e TreeEntry) error {
+			if e.Mode == treeEntryDirMode {
+				return nil
+			}
+
+			b.Insert(path, e.Hash, e.Mode)
+			h, ok := noteTarget(r.ObjectFormat(), path)
+			if !ok {
+				return nil
+			}
+
+			if fanout < 0 {
+				fanout = strings.Count(path, "/")
+			}
+
+			if h == target {
+				old = path
+			}
+
+			return nil
+		})
+		if err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	if fanout < 0 {
+		fanout = 0
+	}
+
+	if err := fn(b, old, fanout); err != nil {
+		return core.ZeroHash, err
+	}
+
+	treeHash, err := b.Write(r.Storage)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	committer := opts.committer()
+	commit := &Commit{
+		TreeHash:  treeHash,
+		Author:    committer,
+		Committer: committer,
+		Message:   message,
+	}
+
+	if ref != nil {
+		commit.ParentHashes = []core.Hash{ref.Hash}
+	}
+
+	o := r.newObject()
+	if err := commit.Encode(o); err != nil {
+		return core.ZeroHash, err
+	}
+
+	h, err := r.Storage.Set(o)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	msg := "notes: " + strings.TrimSuffix(message, "\n")
+	if err := r.UpdateReference(core.NewHashReference(name, h), ref, committer, msg); err != nil {
+		return core.ZeroHash, err
+	}
+
+	return h, nil
+}
+
+// noteTarget returns the hash of the object the note at the given path of a
+// notes tree is attached to, the path without its slashes, and false if it
+// is not the hash of an object of the format f.
+func noteTarget(f core.ObjectFormat, path string) (core.Hash, bool) {
+	name := strings.Replace(path, "/", "", -1)
+	if len(name) != f.HexSize() || !core.IsHashHex(name) {
+		return core.ZeroHash, false
+	}
+
+	return core.NewHash(name), true
+}
+
+// notePath returns the path of the note of target in a notes tree with the
+// given number of fan-out directories, of two digits each.
+func notePath(target core.Hash, fanout int) string {
+	name := target.String()
+	parts := make([]string, 0, fanout+1)
+	for i := 0; i < fanout && len(name) > 2; i++ {
+		parts = append(parts, name[:2])
+		name = name[2:]
+	}
+
+	return strings.Join(append(parts, name), "/")
+}
+
+// NoteIter provides an iterator for the notes of a notes tree, the blobs
+// named after the hash of an object, the other files are skipped.
+type NoteIter struct {
+	files *FileIter
+	f     core.ObjectFormat
+}
+
+// NewNoteIter returns a NoteIter for the notes of the given notes tree.
+func NewNoteIter(r *Repository, t *Tree) *NoteIter {
+	return &NoteIter{files: NewFileIter(r, t), f: r.ObjectFormat()}
+}
+
+// Next moves the iterator to the next note and returns it. If it has reached
+// the end of the notes it will return io.EOF.
+func (iter *NoteIter) Next() (*Note, error) {
+	for {
+		file, err := iter.files.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if h, ok := noteTarget(iter.f, file.Name); ok {
+			return &Note{Target: h, File: file}, nil
+		}
+	}
+}
+
+// ForEach calls cb for each of the remaining notes of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *NoteIter) ForEach(cb func(*Note) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each note of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *NoteIter) ForEachContext(ctx context.Context, cb func(*Note) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		note, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(note); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Close releases the resources of the iterator.
+func (iter *NoteIter) Close() {
+	iter.files.Close()
+}
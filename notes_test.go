@@ -0,0 +1,175 @@
+package git
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteNotes struct {
+	r      *Repository
+	head   core.Hash
+	parent core.Hash
+}
+
+var _ = Suite(&SuiteNotes{})
+
+var notesCommitter = Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(1<<20, 0).UTC()}
+
+func (s *SuiteNotes) SetUpTest(c *C) {
+	s.r, s.head = linearHistory(c, []int64{1, 2, 3})
+
+	head, err := s.r.Commit(s.head)
+	c.Assert(err, IsNil)
+	s.parent = head.ParentHashes[0]
+}
+
+func (s *SuiteNotes) TestAddNote(c *C) {
+	h, err := s.r.AddNote("", s.head, "build: ok\n", &NoteOptions{Committer: notesCommitter})
+	c.Assert(err, IsNil)
+
+	ref, err := s.r.Reference(DefaultNotesRef, true)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, h)
+
+	commit, err := s.r.Commit(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "Notes added by 'git notes add'\n")
+	c.Assert(commit.Committer.Email, Equals, notesCommitter.Email)
+	c.Assert(commit.Committer.When.Equal(notesCommitter.When), Equals, true)
+	c.Assert(commit.ParentHashes, HasLen, 0)
+
+	note, err := s.r.Note("", s.head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Name, Equals, s.head.String())
+	content, err := note.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "build: ok\n")
+
+	entries, err := s.r.Reflog(DefaultNotesRef)
+	c.Assert(err, IsNil)
+	entry, err := entries.Next()
+	c.Assert(err, IsNil)
+	c.Assert(entry.New, Equals, h)
+	c.Assert(entry.Message, Equals, "notes: Notes added by 'git notes add'")
+
+	_, err = s.r.Note("", s.parent)
+	c.Assert(err, Equals, ErrNoteNotFound)
+
+	// a second note is committed on top of the first one
+	second, err := s.r.AddNote("", s.parent, "build: failed\n", &NoteOptions{Committer: notesCommitter})
+	c.Assert(err, IsNil)
+	commit, err = s.r.Commit(second)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{h})
+
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	c.Assert(tree.Entries, HasLen, 2)
+}
+
+func (s *SuiteNotes) TestAddNoteExists(c *C) {
+	_, err := s.r.AddNote("", s.head, "foo\n", nil)
+	c.Assert(err, IsNil)
+
+	_, err = s.r.AddNote("", s.head, "bar\n", nil)
+	c.Assert(err, Equals, ErrNoteExists)
+
+	_, err = s.r.AddNote("", s.head, "bar\n", &NoteOptions{Force: true, Message: "replaced"})
+	c.Assert(err, IsNil)
+
+	note, err := s.r.Note("", s.head)
+	c.Assert(err, IsNil)
+	content, err := note.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "bar\n")
+
+	_, err = s.r.AddNote("", core.NewHash("0000000000000000000000000000000000000001"), "foo\n", nil)
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteNotes) TestNoteRef(c *C) {
+	_, err := s.r.AddNote("ci", s.head, "foo\n", nil)
+	c.Assert(err, IsNil)
+
+	_, err = s.r.Reference("refs/notes/ci", false)
+	c.Assert(err, IsNil)
+
+	_, err = s.r.Note("refs/notes/ci", s.head)
+	c.Assert(err, IsNil)
+
+	_, err = s.r.Note("", s.head)
+	c.Assert(err, Equals, ErrNoteNotFound)
+}
+
+func (s *SuiteNotes) TestRemoveNote(c *C) {
+	_, err := s.r.RemoveNote("", s.head, nil)
+	c.Assert(err, Equals, ErrNoteNotFound)
+
+	_, err = s.r.AddNote("", s.head, "foo\n", nil)
+	c.Assert(err, IsNil)
+
+	h, err := s.r.RemoveNote("", s.head, &NoteOptions{Committer: notesCommitter})
+	c.Assert(err, IsNil)
+
+	commit, err := s.r.Commit(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "Notes removed by 'git notes remove'\n")
+	c.Assert(commit.TreeHash, Equals, EmptyTreeHash)
+
+	_, err = s.r.Note("", s.head)
+	c.Assert(err, Equals, ErrNoteNotFound)
+}
+
+// the notes of the large notes trees are split in fan-out directories, the
+// new notes are written at the same level
+func (s *SuiteNotes) TestNoteFanout(c *C) {
+	blob := newTestBlob(c, s.r, "foo\n")
+	b := NewTreeBuilder()
+	b.Insert(notePath(s.parent, 1), blob, treeEntryRegularMode)
+	b.Insert("README", blob, treeEntryRegularMode)
+	tree, err := b.Write(s.r.Storage)
+	c.Assert(err, IsNil)
+
+	commit := &Commit{TreeHash: tree, Author: notesCommitter, Committer: notesCommitter, Message: "foo\n"}
+	obj := s.r.newObject()
+	c.Assert(commit.Encode(obj), IsNil)
+	h, err := s.r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+	c.Assert(s.r.References.Set(core.NewHashReference(DefaultNotesRef, h)), IsNil)
+
+	note, err := s.r.Note("", s.parent)
+	c.Assert(err, IsNil)
+	c.Assert(note.Name, Equals, s.parent.String()[:2]+"/"+s.parent.String()[2:])
+
+	_, err = s.r.AddNote("", s.head, "bar\n", nil)
+	c.Assert(err, IsNil)
+	note, err = s.r.Note("", s.head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Name, Equals, s.head.String()[:2]+"/"+s.head.String()[2:])
+
+	notes := make(map[core.Hash]string)
+	iter, err := s.r.Notes()
+	c.Assert(err, IsNil)
+	c.Assert(iter.ForEach(func(n *Note) error {
+		content, err := n.Contents()
+		c.Assert(err, IsNil)
+		notes[n.Target] = content
+		return nil
+	}), IsNil)
+	c.Assert(notes, DeepEquals, map[core.Hash]string{s.parent: "foo\n", s.head: "bar\n"})
+}
+
+func (s *SuiteNotes) TestNotesEmpty(c *C) {
+	iter, err := s.r.Notes()
+	c.Assert(err, IsNil)
+
+	count := 0
+	c.Assert(iter.ForEach(func(*Note) error {
+		count++
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, 0)
+}
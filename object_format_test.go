@@ -0,0 +1,113 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// a repository initialized with git init --object-format=sha256, with two
+// commits, the first one packed
+const sha256Fixture = "fixtures/sha256.tgz"
+
+const (
+	sha256Head   = "d8d0cf660301c81d23df1c3d9aed2f323115e9b008d3954d7327733101fab16e"
+	sha256First  = "4ad1c4ca9c0583454f1ec9bfa728c1a4c68e3912e053bdbb8d7aa7f3b1c13cdc"
+	sha256HeadTr = "f9eb995d3a775e65417e31de5d263e7214877e2b55e4d98995ef02ee6e933ef0"
+)
+
+type SuiteObjectFormat struct {
+	dir string
+	r   *Repository
+}
+
+var _ = Suite(&SuiteObjectFormat{})
+
+func (s *SuiteObjectFormat) SetUpTest(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(sha256Fixture)
+	c.Assert(err, IsNil)
+
+	s.r, err = NewFilesystemRepository(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteObjectFormat) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *SuiteObjectFormat) TestCommit(c *C) {
+	c.Assert(s.r.ObjectFormat(), Equals, core.SHA256)
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash.String(), Equals, sha256Head)
+
+	commit, err := s.r.Commit(head.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.TreeHash.String(), Equals, sha256HeadTr)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{core.NewHash(sha256First)})
+	c.Assert(commit.Message, Equals, "second\n")
+
+	file, err := commit.File("d/hello")
+	c.Assert(err, IsNil)
+	c.Assert(file.Hash.String(), Equals, "dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55653")
+	content, err := file.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "Hello, World!\n")
+}
+
+func (s *SuiteObjectFormat) TestEncode(c *C) {
+	tree, err := s.r.Tree(core.NewHash(sha256HeadTr))
+	c.Assert(err, IsNil)
+	c.Assert(tree.Entries, HasLen, 2)
+
+	obj := s.r.newObject()
+	c.Assert(tree.Encode(obj), IsNil)
+	c.Assert(obj.Hash(), Equals, tree.Hash)
+
+	commit, err := s.r.Commit(core.NewHash(sha256Head))
+	c.Assert(err, IsNil)
+
+	obj = s.r.newObject()
+	c.Assert(commit.Encode(obj), IsNil)
+	c.Assert(obj.Hash(), Equals, commit.Hash)
+
+	// the hashes of the objects of a format cannot be written in another
+	err = commit.Encode(&memory.Object{})
+	c.Assert(err, DeepEquals, &core.ErrObjectFormatMismatch{Expected: core.SHA1, Actual: core.SHA256})
+}
+
+func (s *SuiteObjectFormat) TestEmptyTree(c *C) {
+	h := core.NewHash("6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321")
+	tree, err := s.r.Tree(h)
+	c.Assert(err, IsNil)
+	c.Assert(tree.Entries, HasLen, 0)
+
+	obj := s.r.newObject()
+	c.Assert((&Tree{}).Encode(obj), IsNil)
+	c.Assert(obj.Hash(), Equals, h)
+}
+
+func (s *SuiteObjectFormat) TestExpandHash(c *C) {
+	h, err := s.r.ExpandHash(sha256Head[:8])
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, sha256Head)
+
+	h, err = s.r.ExpandHash(sha256Head)
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, sha256Head)
+
+	_, err = s.r.ExpandHash(sha256Head + "0")
+	c.Assert(err, Equals, ErrInvalidHashPrefix)
+
+	h, err = s.r.ResolveRevision("HEAD~1")
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, sha256First)
+}
@@ -1,10 +1,10 @@
 package git
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"io"
 	"time"
 
 	"gopkg.in/src-d/go-git.v3/core"
@@ -13,6 +13,18 @@ import (
 // ErrUnsupportedObject trigger when a non-supported object is being decoded.
 var ErrUnsupportedObject = errors.New("unsupported object type")
 
+// ErrObjectTypeMismatch is returned by the typed getters of Repository, like
+// CommitObject, when the object with the given hash is of another type.
+type ErrObjectTypeMismatch struct {
+	Hash     core.Hash
+	Expected core.ObjectType
+	Actual   core.ObjectType
+}
+
+func (e *ErrObjectTypeMismatch) Error() string {
+	return fmt.Sprintf("object %s is a %s, not a %s", e.Hash, e.Actual, e.Expected)
+}
+
 // Object is a generic representation of any git object. It is implemented by
 // Commit, Tree, Blob and Tag, and includes the functions that are common to
 // them.
@@ -44,6 +56,8 @@ type Object interface {
 // Blob is used to store file data - it is generally a file.
 type Blob struct {
 	Hash core.Hash
+	// Size is the size of the content of the blob, taken from the object
+	// when decoding it, so it is known without reading the content.
 	Size int64
 
 	obj core.Object
@@ -89,50 +103,199 @@ type Signature struct {
 	When  time.Time
 }
 
-// Decode decodes a byte slice into a signature
+// Decode decodes a byte slice into a signature, see core.Signature.Decode
 func (s *Signature) Decode(b []byte) {
-	open := bytes.IndexByte(b, '<')
-	close := bytes.IndexByte(b, '>')
-	if open == -1 || close == -1 {
-		return
-	}
+	sig := core.Signature(*s)
+	sig.Decode(b)
+	*s = Signature(sig)
+}
 
-	s.Name = string(bytes.Trim(b[:open], " "))
-	s.Email = string(b[open+1 : close])
+// Encode returns the signature in the format read by Decode, see
+// core.Signature.Encode
+func (s *Signature) Encode() []byte {
+	sig := core.Signature(*s)
+	return sig.Encode()
+}
+
+func (s *Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// formatObject is implemented by the core.Objects that know the format their
+// hash is computed in, like memory.Object.
+type formatObject interface {
+	Format() core.ObjectFormat
+}
 
-	hasTime := close+2 < len(b)
-	if hasTime {
-		s.decodeTimeAndTimeZone(b[close+2:])
+// checkObjectFormat returns a *core.ErrObjectFormatMismatch if any of the
+// hashes, referenced by the object o being encoded, is not in the format of
+// o, SHA1 if it does not implement formatObject.
+func checkObjectFormat(o core.Object, hashes ...core.Hash) error {
+	f := core.SHA1
+	if fo, ok := o.(formatObject); ok {
+		f = fo.Format()
 	}
+
+	for _, h := range hashes {
+		if err := core.CheckObjectFormat(f, h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// objectTypes are the types of the objects iterated by ObjectIter.
+var objectTypes = []core.ObjectType{
+	core.CommitObject,
+	core.TreeObject,
+	core.BlobObject,
+	core.TagObject,
 }
 
-var timeZoneLength = 5
+// ObjectIter provides an iterator for all the objects of a storage, decoded,
+// the commits first, then the trees, the blobs and the tags.
+type ObjectIter struct {
+	r     *Repository
+	s     core.ObjectStorage
+	types []core.ObjectType
+	iter  core.ObjectIter
+}
+
+// NewObjectIter returns an ObjectIter for the objects of every type of the
+// given storage, decoded for the given repository.
+func NewObjectIter(r *Repository, s core.ObjectStorage) *ObjectIter {
+	return &ObjectIter{r: r, s: s, types: objectTypes}
+}
+
+// Next moves the iterator to the next object and returns it, a *Commit, a
+// *Tree, a *Blob or a *Tag. If it has reached the end of the set it will
+// return io.EOF.
+func (iter *ObjectIter) Next() (Object, error) {
+	for {
+		if iter.iter == nil {
+			if len(iter.types) == 0 {
+				return nil, io.EOF
+			}
+
+			var err error
+			if iter.iter, err = iter.s.Iter(iter.types[0]); err != nil {
+				return nil, err
+			}
+
+			iter.types = iter.types[1:]
+		}
 
-func (s *Signature) decodeTimeAndTimeZone(b []byte) {
-	space := bytes.IndexByte(b, ' ')
-	if space == -1 {
-		space = len(b)
+		obj, err := iter.iter.Next()
+		if err == io.EOF {
+			iter.iter.Close()
+			iter.iter = nil
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return iter.r.decodeObject(obj)
 	}
+}
 
-	ts, err := strconv.ParseInt(string(b[:space]), 10, 64)
-	if err != nil {
-		return
+// ForEach calls cb for each of the remaining objects of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *ObjectIter) ForEach(cb func(Object) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each object of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *ObjectIter) ForEachContext(ctx context.Context, cb func(Object) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		obj, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(obj); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
 	}
+}
 
-	s.When = time.Unix(ts, 0).In(time.UTC)
-	var tzStart = space + 1
-	if tzStart >= len(b) || tzStart+timeZoneLength > len(b) {
-		return
+// Close releases the storage iterator in use, if any, and ends the
+// iteration.
+func (iter *ObjectIter) Close() {
+	if iter.iter != nil {
+		iter.iter.Close()
+		iter.iter = nil
 	}
 
-	tl, err := time.Parse("-0700", string(b[tzStart:tzStart+timeZoneLength]))
+	iter.types = nil
+}
+
+// BlobIter provides an iterator for a set of blobs.
+type BlobIter struct {
+	core.ObjectIter
+}
+
+// NewBlobIter returns a BlobIter for the given underlying object iterator.
+func NewBlobIter(iter core.ObjectIter) *BlobIter {
+	return &BlobIter{iter}
+}
+
+// Next moves the iterator to the next blob and returns a pointer to it. If it
+// has reached the end of the set it will return io.EOF.
+func (iter *BlobIter) Next() (*Blob, error) {
+	obj, err := iter.ObjectIter.Next()
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	s.When = s.When.In(tl.Location())
+	blob := &Blob{}
+	return blob, blob.Decode(obj)
 }
 
-func (s *Signature) String() string {
-	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+// ForEach calls cb for each of the remaining blobs of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *BlobIter) ForEach(cb func(*Blob) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each blob of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *BlobIter) ForEachContext(ctx context.Context, cb func(*Blob) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		blob, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(blob); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
 }
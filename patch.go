@@ -0,0 +1,295 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	patchContextLines = 3
+	patchHashLength   = 7
+	// number of bytes inspected looking for a NUL to detect binary files,
+	// the same git uses.
+	binarySniffLength = 8000
+	// maximum length of the section heading of a hunk, the same git uses.
+	maxHunkHeadingLength = 80
+)
+
+// Patch is a set of changes that can be encoded as a unified diff, in the
+// same format used by git diff.
+type Patch struct {
+	Changes []*Change
+}
+
+// NewPatch returns a new Patch for the given changes.
+func NewPatch(changes []*Change) *Patch {
+	return &Patch{Changes: changes}
+}
+
+// Patch returns a Patch containing only the change c.
+func (c *Change) Patch() *Patch {
+	return NewPatch([]*Change{c})
+}
+
+// Patch returns the Patch needed to turn the tree of the commit c into the
+// tree of the commit to.
+func (c *Commit) Patch(to *Commit) (*Patch, error) {
+	from, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	dest, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := DiffTree(from, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPatch(changes), nil
+}
+
+// Encode writes the patch to w as a unified diff. The hunks are generated
+// with a Myers diff of the lines of both versions of each file, binary files
+// are reported as differing without their contents.
+func (p *Patch) Encode(w io.Writer) error {
+	for _, c := range p.Changes {
+		if err := encodeChange(w, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String returns the patch as a unified diff. If the contents of any of the
+// files cannot be read, the diff is truncated at that file.
+func (p *Patch) String() string {
+	buf := new(bytes.Buffer)
+	_ = p.Encode(buf)
+
+	return buf.String()
+}
+
+func encodeChange(w io.Writer, c *Change) error {
+	from, to := "a/"+c.Name, "b/"+c.Name
+	fmt.Fprintf(w, "diff --git %s %s\n", from, to)
+
+	switch c.Action {
+	case Insert:
+		from = "/dev/null"
+		fmt.Fprintf(w, "new file mode %o\n", uint32(c.To.Mode))
+		fmt.Fprintf(w, "index %s..%s\n", abbrevHash(core.ZeroHash), abbrevHash(c.To.Hash))
+	case Delete:
+		to = "/dev/null"
+		fmt.Fprintf(w, "deleted file mode %o\n", uint32(c.From.Mode))
+		fmt.Fprintf(w, "index %s..%s\n", abbrevHash(c.From.Hash), abbrevHash(core.ZeroHash))
+	case Modify:
+		if c.From.Mode != c.To.Mode {
+			fmt.Fprintf(w, "old mode %o\n", uint32(c.From.Mode))
+			fmt.Fprintf(w, "new mode %o\n", uint32(c.To.Mode))
+		}
+
+		if c.From.Hash == c.To.Hash {
+			return nil
+		}
+
+		fmt.Fprintf(w, "index %s..%s", abbrevHash(c.From.Hash), abbrevHash(c.To.Hash))
+		if c.From.Mode == c.To.Mode {
+			fmt.Fprintf(w, " %o", uint32(c.To.Mode))
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	src, err := fileContents(c.Files[0])
+	if err != nil {
+		return err
+	}
+
+	dst, err := fileContents(c.Files[1])
+	if err != nil {
+		return err
+	}
+
+	if isBinary(src) || isBinary(dst) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", from, to)
+		return err
+	}
+
+	if src == dst {
+		return nil // empty files, there are no lines to show
+	}
+
+	fmt.Fprintf(w, "--- %s\n", from)
+	fmt.Fprintf(w, "+++ %s\n", to)
+
+	return encodeHunks(w, patchLines(diff.Do(src, dst)))
+}
+
+func fileContents(f *File) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+
+	return f.Contents()
+}
+
+func abbrevHash(h core.Hash) string {
+	return h.String()[:patchHashLength]
+}
+
+func isBinary(content string) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+
+	return strings.IndexByte(content, 0) != -1
+}
+
+// patchLine is a line of a unified diff, op is ' ', '-' or '+' for context,
+// deleted and inserted lines. The text of the line includes its end of line,
+// if any.
+type patchLine struct {
+	op   byte
+	text string
+}
+
+func patchLines(diffs []diffmatchpatch.Diff) []patchLine {
+	var lines []patchLine
+	for _, d := range diffs {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+
+		text := d.Text
+		for len(text) > 0 {
+			end := strings.IndexByte(text, '\n') + 1
+			if end == 0 {
+				end = len(text)
+			}
+
+			lines = append(lines, patchLine{op, text[:end]})
+			text = text[end:]
+		}
+	}
+
+	return lines
+}
+
+// encodeHunks writes the lines grouped in hunks, each one with up to
+// patchContextLines lines of context around the changes.
+func encodeHunks(w io.Writer, lines []patchLine) error {
+	// number of lines of the source and destination before each line
+	srcBefore := make([]int, len(lines)+1)
+	dstBefore := make([]int, len(lines)+1)
+	for i, l := range lines {
+		srcBefore[i+1], dstBefore[i+1] = srcBefore[i], dstBefore[i]
+		if l.op != '+' {
+			srcBefore[i+1]++
+		}
+		if l.op != '-' {
+			dstBefore[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		last := i
+		for j := i + 1; j < len(lines) && j-last-1 <= 2*patchContextLines; j++ {
+			if lines[j].op != ' ' {
+				last = j
+			}
+		}
+
+		start := i - patchContextLines
+		if start < 0 {
+			start = 0
+		}
+
+		stop := last + patchContextLines + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		_, err := fmt.Fprintf(w, "@@ -%s +%s @@%s\n",
+			hunkRange(srcBefore[start], srcBefore[stop]-srcBefore[start]),
+			hunkRange(dstBefore[start], dstBefore[stop]-dstBefore[start]),
+			hunkHeading(lines[:start]),
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range lines[start:stop] {
+			if _, err := fmt.Fprintf(w, "%c%s", l.op, l.text); err != nil {
+				return err
+			}
+
+			if !strings.HasSuffix(l.text, "\n") {
+				if _, err := fmt.Fprint(w, "\n\\ No newline at end of file\n"); err != nil {
+					return err
+				}
+			}
+		}
+
+		i = stop
+	}
+
+	return nil
+}
+
+// hunkHeading returns the section heading of a hunk, the last source line
+// before the hunk starting with a letter, an underscore or a dollar sign, as
+// the default function name detection of git does.
+func hunkHeading(before []patchLine) string {
+	for i := len(before) - 1; i >= 0; i-- {
+		l := before[i]
+		if l.op == '+' || l.text == "" {
+			continue
+		}
+
+		c := l.text[0]
+		if c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			heading := l.text
+			if len(heading) > maxHunkHeadingLength {
+				heading = heading[:maxHunkHeadingLength]
+			}
+
+			return " " + strings.TrimRight(heading, " \t\r\n")
+		}
+	}
+
+	return ""
+}
+
+// hunkRange formats the range of a hunk given the number of lines before it
+// and its length, like git does: the length is omitted when it is one, and
+// empty ranges start at the line preceding them.
+func hunkRange(before, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, length)
+	}
+}
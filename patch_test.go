@@ -0,0 +1,124 @@
+package git
+
+import (
+	"bytes"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type PatchSuite struct{}
+
+var _ = Suite(&PatchSuite{})
+
+// the expected output has been generated with git diff
+const patchFixture = `diff --git a/bin b/bin
+index d5d0b8b..4a27031 100644
+Binary files a/bin and b/bin differ
+diff --git a/foo b/foo
+index 92dfa21..1c7ce5b 100644
+--- a/foo
++++ b/foo
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -7,4 +7,4 @@ f
+ g
+ h
+ i
+-j
++J
+diff --git a/new b/new
+new file mode 100644
+index 0000000..ce01362
+--- /dev/null
++++ b/new
+@@ -0,0 +1 @@
++hello
+diff --git a/old b/old
+deleted file mode 100644
+index 0abaeaa..0000000
+--- a/old
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+\ No newline at end of file
+diff --git a/script b/script
+old mode 100644
+new mode 100755
+`
+
+func (s *PatchSuite) TestPatch(c *C) {
+	r := NewPlainRepository()
+	binA := newTestBlob(c, r, "x\x00y")
+	binB := newTestBlob(c, r, "x\x00z")
+	fooA := newTestBlob(c, r, "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	fooB := newTestBlob(c, r, "a\nB\nc\nd\ne\nf\ng\nh\ni\nJ\n")
+	newBlob := newTestBlob(c, r, "hello\n")
+	oldBlob := newTestBlob(c, r, "bye")
+	script := newTestBlob(c, r, "#!/bin/sh\n")
+
+	a := newTestTree(c, r,
+		TreeEntry{Name: "bin", Mode: 0100644, Hash: binA},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: fooA},
+		TreeEntry{Name: "old", Mode: 0100644, Hash: oldBlob},
+		TreeEntry{Name: "script", Mode: 0100644, Hash: script},
+	)
+	b := newTestTree(c, r,
+		TreeEntry{Name: "bin", Mode: 0100644, Hash: binB},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: fooB},
+		TreeEntry{Name: "new", Mode: 0100644, Hash: newBlob},
+		TreeEntry{Name: "script", Mode: 0100755, Hash: script},
+	)
+
+	changes, err := DiffTree(a, b)
+	c.Assert(err, IsNil)
+
+	patch := NewPatch(changes)
+	c.Assert(patch.String(), Equals, patchFixture)
+
+	buf := new(bytes.Buffer)
+	c.Assert(patch.Encode(buf), IsNil)
+	c.Assert(buf.String(), Equals, patchFixture)
+}
+
+func (s *PatchSuite) TestChangePatch(c *C) {
+	r := NewPlainRepository()
+	empty := newTestBlob(c, r, "")
+
+	a := newTestTree(c, r)
+	b := newTestTree(c, r, TreeEntry{Name: "empty", Mode: 0100644, Hash: empty})
+
+	changes, err := DiffTree(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].Patch().String(), Equals, `diff --git a/empty b/empty
+new file mode 100644
+index 0000000..e69de29
+`)
+}
+
+func (s *PatchSuite) TestCommitPatch(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+
+	from, err := r.Commit(core.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	c.Assert(err, IsNil)
+	to, err := r.Commit(core.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"))
+	c.Assert(err, IsNil)
+
+	patch, err := from.Patch(to)
+	c.Assert(err, IsNil)
+	c.Assert(patch.String(), Equals, `diff --git a/CHANGELOG b/CHANGELOG
+new file mode 100644
+index 0000000..d3ff53e
+--- /dev/null
++++ b/CHANGELOG
+@@ -0,0 +1 @@
++Initial changelog
+`)
+}
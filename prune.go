@@ -0,0 +1,233 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ErrDeleteNotSupported is returned by Prune when the storage of the
+// repository cannot delete objects, see core.DeletableObjectStorage.
+var ErrDeleteNotSupported = errors.New("object storage cannot delete objects")
+
+// PruneOptions are the options of Prune.
+type PruneOptions struct {
+	// DryRun only returns the objects that would be deleted, see
+	// PruneObjects, without deleting them.
+	DryRun bool
+	// OnlyObjectsOlderThan, if not zero, protects the objects written since
+	// then, which could be written by a concurrent fetch or commit whose
+	// references are not updated yet, as git prune --expire does. The
+	// objects are only deleted if the storage tells when they were
+	// written, see core.TimedObjectStorage.
+	OnlyObjectsOlderThan time.Time
+}
+
+// Prune deletes the objects of the storage that are not reachable from the
+// references, HEAD, the entries of their reflogs, the shallow commits or the
+// index, see PruneObjects.
+func (r *Repository) Prune(opts PruneOptions) error {
+	_, err := r.PruneObjects(opts)
+	return err
+}
+
+// PruneObjects deletes the objects of the storage that are not reachable
+// from the references, HEAD, the entries of their reflogs, the shallow
+// commits or the index, its entries and cache tree, and returns their hashes, sorted. With DryRun the objects that
+// would be deleted are returned, the ones the storage cannot delete alone
+// included, like the objects of the packfiles, which are kept otherwise.
+// ErrDeleteNotSupported is returned if there are objects to delete and the
+// storage does not implement core.DeletableObjectStorage.
+func (r *Repository) PruneObjects(opts PruneOptions) ([]core.Hash, error) {
+	roots, err := r.pruneRoots()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[core.Hash]bool)
+	if _, err := r.reachableObjects(roots, seen, true); err != nil {
+		return nil, err
+	}
+
+	hashes, err := core.HashesWithPrefix(r.Storage, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var unreachable []core.Hash
+	for _, h := range hashes {
+		if seen[h] {
+			continue
+		}
+
+		ok, err := r.isExpired(h, opts.OnlyObjectsOlderThan)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			unreachable = append(unreachable, h)
+		}
+	}
+
+	if opts.DryRun || len(unreachable) == 0 {
+		return unreachable, nil
+	}
+
+	ds, ok := r.Storage.(core.DeletableObjectStorage)
+	if !ok {
+		return nil, ErrDeleteNotSupported
+	}
+
+	var deleted []core.Hash
+	for _, h := range unreachable {
+		err := ds.Delete(h)
+		if err == core.ErrObjectNotDeletable || err == core.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted = append(deleted, h)
+	}
+
+	return deleted, nil
+}
+
+// isExpired reports whether the object with the given hash was written
+// before the given time, or true if the time is zero. The objects whose time
+// is unknown are never expired.
+func (r *Repository) isExpired(h core.Hash, before time.Time) (bool, error) {
+	if before.IsZero() {
+		return true, nil
+	}
+
+	ts, ok := r.Storage.(core.TimedObjectStorage)
+	if !ok {
+		return false, nil
+	}
+
+	mtime, err := ts.ModTime(h)
+	if err != nil {
+		return false, err
+	}
+
+	return mtime.Before(before), nil
+}
+
+// pruneRoots returns the hashes the objects kept by Prune are reachable
+// from: the ones of the references and HEAD, of the entries of their
+// reflogs, the shallow commits and the objects of the index.
+func (r *Repository) pruneRoots() ([]core.Hash, error) {
+	names, err := r.referenceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []core.Hash
+	for _, n := range names {
+		ref, err := core.ResolveReference(r.References, n)
+		if err == nil {
+			roots = append(roots, ref.Hash)
+		} else if err != core.ErrReferenceNotFound && err != core.ErrReferenceLoop {
+			return nil, err
+		}
+
+		if r.Reflogs == nil {
+			continue
+		}
+
+		hashes, err := r.reflogHashes(n)
+		if err != nil {
+			return nil, err
+		}
+
+		roots = append(roots, hashes...)
+	}
+
+	shallows, err := r.shallows()
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := r.indexHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	roots = append(roots, shallows...)
+	return append(roots, indexed...), nil
+}
+
+// indexHashes returns the hashes of the objects of the index, as git prune
+// keeps them: the blobs of its entries, the trees of its cache tree that are
+// valid, and the blobs of the conflicts it can recreate.
+func (r *Repository) indexHashes() ([]core.Hash, error) {
+	if r.Indexes == nil {
+		return nil, nil
+	}
+
+	idx, err := r.Indexes.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []core.Hash
+	for _, e := range idx.Entries {
+		if !e.IntentToAdd && !isSubmoduleMode(e.Mode) {
+			hashes = append(hashes, e.Hash)
+		}
+	}
+
+	if idx.Cache != nil {
+		for _, e := range idx.Cache.Entries {
+			if e.Entries >= 0 {
+				hashes = append(hashes, e.Hash)
+			}
+		}
+	}
+
+	if idx.ResolveUndo != nil {
+		for _, e := range idx.ResolveUndo.Entries {
+			for i, h := range e.Hashes {
+				if e.Modes[i] != 0 {
+					hashes = append(hashes, h)
+				}
+			}
+		}
+	}
+
+	return hashes, nil
+}
+
+// reflogHashes returns the hashes of the entries of the reflog of the
+// reference with the given name.
+func (r *Repository) reflogHashes(n core.ReferenceName) ([]core.Hash, error) {
+	iter, err := r.Reflogs.Entries(n)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var hashes []core.Hash
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return hashes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range []core.Hash{e.Old, e.New} {
+			if !h.IsZero() {
+				hashes = append(hashes, h)
+			}
+		}
+	}
+}
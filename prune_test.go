@@ -0,0 +1,201 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuitePrune struct{}
+
+var _ = Suite(&SuitePrune{})
+
+// pruneFixture stores in the repository a line of two commits, the first
+// one only reachable from the reflog of master, a blob of the tree of the
+// last one, and an unreachable commit and blob, whose hashes are returned.
+func pruneFixture(c *C, r *Repository) (unreachable []core.Hash) {
+	blob := newTestBlob(c, r, "foo")
+	tree := newTestTree(c, r, TreeEntry{Name: "foo", Mode: 0100644, Hash: blob}).Hash
+
+	sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(0, 0).UTC()}
+	store := func(tree core.Hash, parents ...core.Hash) core.Hash {
+		obj := &memory.Object{}
+		commit := &Commit{Author: sig, Committer: sig, Message: "foo\n", TreeHash: tree, ParentHashes: parents}
+		c.Assert(commit.Encode(obj), IsNil)
+		h, err := r.Storage.Set(obj)
+		c.Assert(err, IsNil)
+		return h
+	}
+
+	first := store(EmptyTreeHash)
+	second := store(tree)
+	c.Assert(r.References.Set(core.NewHashReference("refs/heads/master", second)), IsNil)
+	c.Assert(r.Reflogs.Append("refs/heads/master", &core.ReflogEntry{New: first, Committer: core.Signature(sig)}), IsNil)
+	c.Assert(r.Reflogs.Append("refs/heads/master", &core.ReflogEntry{Old: first, New: second, Committer: core.Signature(sig)}), IsNil)
+
+	unreachable = []core.Hash{store(EmptyTreeHash, second), newTestBlob(c, r, "bar")}
+	core.SortHashes(unreachable)
+	return unreachable
+}
+
+func (s *SuitePrune) TestPrune(c *C) {
+	r := NewPlainRepository()
+	unreachable := pruneFixture(c, r)
+	sto := r.Storage.(*memory.ObjectStorage)
+	objects := len(sto.Objects)
+
+	hashes, err := r.PruneObjects(PruneOptions{DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, unreachable)
+	c.Assert(sto.Objects, HasLen, objects)
+
+	hashes, err = r.PruneObjects(PruneOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, unreachable)
+	c.Assert(sto.Objects, HasLen, objects-2)
+
+	for _, h := range unreachable {
+		_, err := sto.Get(h)
+		c.Assert(err, Equals, core.ErrObjectNotFound)
+	}
+
+	c.Assert(r.Prune(PruneOptions{}), IsNil)
+	c.Assert(sto.Objects, HasLen, objects-2)
+}
+
+func (s *SuitePrune) TestPruneOnlyObjectsOlderThan(c *C) {
+	r := NewPlainRepository()
+	unreachable := pruneFixture(c, r)
+	sto := r.Storage.(*memory.ObjectStorage)
+
+	now := time.Now()
+	sto.ModTimes[unreachable[0]] = now.Add(-time.Hour)
+
+	hashes, err := r.PruneObjects(PruneOptions{OnlyObjectsOlderThan: now.Add(-time.Minute)})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, unreachable[:1])
+
+	_, err = sto.Get(unreachable[1])
+	c.Assert(err, IsNil)
+}
+
+func (s *SuitePrune) TestPruneOnlyObjectsOlderThanUnknownTime(c *C) {
+	r := NewPlainRepository()
+	pruneFixture(c, r)
+	r.Storage = &deletableObjectStorage{r.Storage.(*memory.ObjectStorage)}
+
+	hashes, err := r.PruneObjects(PruneOptions{OnlyObjectsOlderThan: time.Now()})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+}
+
+func (s *SuitePrune) TestPruneNotSupported(c *C) {
+	r := NewPlainRepository()
+	unreachable := pruneFixture(c, r)
+	r.Storage = &struct{ core.ObjectStorage }{r.Storage}
+
+	hashes, err := r.PruneObjects(PruneOptions{DryRun: true})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, unreachable)
+
+	c.Assert(r.Prune(PruneOptions{}), Equals, ErrDeleteNotSupported)
+}
+
+// the objects of the packfiles are not deleted
+func (s *SuitePrune) TestPruneFilesystem(c *C) {
+	dir, err := ioutil.TempDir("", "prune-filesystem")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+
+	packed := newTestBlob(c, r, "packed")
+	_, err = r.Storage.(*filesystem.ObjectStorage).WritePack([]core.Hash{packed}, packfile.DefaultEncoderOptions)
+	c.Assert(err, IsNil)
+
+	// the loose copy of the blob is deleted, the packed one is kept
+	ds := r.Storage.(core.DeletableObjectStorage)
+	c.Assert(ds.Delete(packed), IsNil)
+	c.Assert(ds.Delete(packed), Equals, core.ErrObjectNotDeletable)
+
+	unreachable := pruneFixture(c, r)
+
+	hashes, err := r.PruneObjects(PruneOptions{DryRun: true})
+	c.Assert(err, IsNil)
+	expected := append([]core.Hash{packed}, unreachable...)
+	core.SortHashes(expected)
+	c.Assert(hashes, DeepEquals, expected)
+
+	hashes, err = r.PruneObjects(PruneOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, unreachable)
+
+	loose, err := filepath.Glob(filepath.Join(dir, "objects", "??", "*"))
+	c.Assert(err, IsNil)
+	c.Assert(loose, HasLen, 4)
+
+	_, err = r.Storage.Get(packed)
+	c.Assert(err, IsNil)
+}
+
+// the objects of the index are kept, the staged blobs and the valid trees of
+// its cache tree
+func (s *SuitePrune) TestPruneIndex(c *C) {
+	dir, err := ioutil.TempDir("", "prune-index")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	c.Assert(os.Mkdir(filepath.Join(dir, ".git"), 0755), IsNil)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), filepath.Join(dir, ".git"))
+	c.Assert(err, IsNil)
+
+	unreachable := pruneFixture(c, r)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "f"), []byte("staged\n"), 0644), IsNil)
+	staged, err := r.Worktree(fs.NewOS(), dir).Add("f")
+	c.Assert(err, IsNil)
+
+	cached := newTestTree(c, r, TreeEntry{Name: "f", Mode: 0100644, Hash: staged}).Hash
+	invalid := newTestTree(c, r, TreeEntry{Name: "g", Mode: 0100644, Hash: staged}).Hash
+	idx, err := r.Index()
+	c.Assert(err, IsNil)
+	idx.Cache = &index.Tree{Entries: []index.TreeEntry{
+		{Entries: 1, Trees: 1, Hash: cached},
+		{Path: "dir", Entries: -1, Hash: invalid},
+	}}
+	c.Assert(r.SetIndex(idx), IsNil)
+
+	hashes, err := r.PruneObjects(PruneOptions{})
+	c.Assert(err, IsNil)
+	expected := append([]core.Hash{invalid}, unreachable...)
+	core.SortHashes(expected)
+	c.Assert(hashes, DeepEquals, expected)
+
+	for _, h := range []core.Hash{staged, cached} {
+		_, err = r.Storage.Get(h)
+		c.Assert(err, IsNil)
+	}
+}
+
+// deletableObjectStorage hides the times of the objects of a memory storage
+type deletableObjectStorage struct {
+	s *memory.ObjectStorage
+}
+
+func (s *deletableObjectStorage) Set(obj core.Object) (core.Hash, error) { return s.s.Set(obj) }
+func (s *deletableObjectStorage) Get(h core.Hash) (core.Object, error)   { return s.s.Get(h) }
+func (s *deletableObjectStorage) Delete(h core.Hash) error               { return s.s.Delete(h) }
+func (s *deletableObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
+	return s.s.Iter(t)
+}
@@ -0,0 +1,355 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+)
+
+var (
+	// ErrPushNotSupported is returned by Push when the protocol of the
+	// remote can not push.
+	ErrPushNotSupported = errors.New("push not supported by the remote protocol")
+	// ErrAtomicPushNotSupported is returned by Push when an atomic push is
+	// requested and the remote does not support it.
+	ErrAtomicPushNotSupported = errors.New("remote does not support atomic pushes")
+	// ErrDeleteRefsNotSupported is returned by Push when a reference is
+	// deleted and the remote does not support it.
+	ErrDeleteRefsNotSupported = errors.New("remote does not support deleting references")
+)
+
+// PushOptions are the options of Push.
+type PushOptions struct {
+	// RemoteName is the name of the remote, DefaultRemoteName if empty, see
+	// Repository.Remote.
+	RemoteName string
+	// RefSpecs are the local references pushed and the remote references
+	// they update, the branch HEAD points to is pushed to the branch with
+	// the same name if empty. A refspec without source, ":<dst>", deletes
+	// the remote reference.
+	RefSpecs []core.RefSpec
+	// Atomic requests the remote to update all the references or none of
+	// them.
+	Atomic bool
+}
+
+// Push updates the references of a remote with the local references matched
+// by the refspecs, sending the objects the remote is missing: the ones
+// reachable from the pushed references and not from the remote ones.
+// NoErrAlreadyUpToDate is returned if all the remote references are up to
+// date.
+//
+// The updates that are not fast-forwards are only done if the refspec forces
+// them, otherwise ErrNonFastForwardUpdate is returned and nothing is pushed.
+// The status of the updates reported by the remote is returned as a
+// *common.UnpackError or a *common.CommandError if any of them failed, and
+// a *core.ErrObjectFormatMismatch is returned if the objects of the remote
+// are of another format than the ones of the repository.
+//
+// The remotes of the config with several URLs are pushed to through every
+// one of them, in order, see RemoteConfig.
+func (r *Repository) Push(o *PushOptions) error {
+	return r.PushContext(context.Background(), o)
+}
+
+// PushContext is like Push, canceling the requests to the remote when ctx is
+// done, the error of ctx is returned then.
+func (r *Repository) PushContext(ctx context.Context, o *PushOptions) error {
+	remoteName := o.RemoteName
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+	}
+
+	remote, err := r.Remote(remoteName)
+	if err != nil {
+		return err
+	}
+
+	specs := o.RefSpecs
+	if len(specs) == 0 {
+		spec, err := r.defaultPushRefSpec()
+		if err != nil {
+			return err
+		}
+
+		specs = []core.RefSpec{spec}
+	}
+
+	for _, s := range specs {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+	}
+
+	remotes, err := remote.pushRemotes()
+	if err != nil {
+		return err
+	}
+
+	upToDate := true
+	for _, remote := range remotes {
+		err := r.push(ctx, remote, specs, o.Atomic)
+		if err == NoErrAlreadyUpToDate {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		upToDate = false
+	}
+
+	if upToDate {
+		return NoErrAlreadyUpToDate
+	}
+
+	return nil
+}
+
+// push updates the references of the remote with the local references
+// matched by the refspecs, see Push.
+func (r *Repository) push(ctx context.Context, remote *Remote, specs []core.RefSpec, atomic bool) error {
+	if err := remote.ConnectReceivePackContext(ctx); err != nil {
+		return err
+	}
+
+	info := remote.ReceivePackInfo()
+	req := &common.GitReceivePackRequest{}
+	if err := r.addObjectFormat(&req.Capabilities, info.Capabilities); err != nil {
+		return err
+	}
+
+	commands, err := r.pushCommands(specs, info.Refs)
+	if err != nil {
+		return err
+	}
+
+	if len(commands) == 0 {
+		return NoErrAlreadyUpToDate
+	}
+
+	req.Commands = commands
+	if err := addPushCapabilities(req, info.Capabilities, atomic); err != nil {
+		return err
+	}
+
+	pack, err := r.pushPackfile(commands, info)
+	if err != nil {
+		return err
+	}
+
+	if pack != nil {
+		defer pack.Close()
+		req.Packfile = pack
+	}
+
+	report, err := remote.SendPackContext(ctx, req)
+	if err != nil || report == nil {
+		return err
+	}
+
+	return report.Err()
+}
+
+// defaultPushRefSpec returns the refspec of the branch HEAD points to,
+// pushed to the branch with the same name.
+func (r *Repository) defaultPushRefSpec() (core.RefSpec, error) {
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(head.Name.String(), "refs/heads/") {
+		return "", fmt.Errorf("HEAD is not a branch, a refspec is required")
+	}
+
+	return core.RefSpec(fmt.Sprintf("%s:%s", head.Name, head.Name)), nil
+}
+
+// pushCommands returns the commands updating the remote references, given
+// by name, with the local references matched by the refspecs, sorted by
+// name. The references already up to date are skipped.
+func (r *Repository) pushCommands(specs []core.RefSpec, remoteRefs map[string]core.Hash) ([]*common.Command, error) {
+	byName := make(map[core.ReferenceName]*common.Command)
+	for _, s := range specs {
+		refs, err := r.pushedReferences(s)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			cmd := &common.Command{Name: s.Dst(ref.Name), New: ref.Hash}
+			if cmd.Name == "" {
+				cmd.Name = ref.Name
+			}
+
+			old, ok := remoteRefs[cmd.Name.String()]
+			if !ok && cmd.IsDelete() {
+				return nil, fmt.Errorf("remote reference %q not found", cmd.Name)
+			}
+
+			cmd.Old = old
+			if cmd.Old == cmd.New {
+				continue
+			}
+
+			if ok && !cmd.IsDelete() && !s.IsForceUpdate() {
+				ff, err := r.isFastForward(core.NewHashReference(cmd.Name, old), cmd.New)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ff {
+					return nil, ErrNonFastForwardUpdate
+				}
+			}
+
+			byName[cmd.Name] = cmd
+		}
+	}
+
+	commands := make([]*common.Command, 0, len(byName))
+	for _, cmd := range byName {
+		commands = append(commands, cmd)
+	}
+
+	sort.Sort(commandsByName(commands))
+	return commands, nil
+}
+
+// pushedReferences returns the local hash references matched by the
+// refspec, a reference without name and hash for the refspecs deleting, or
+// an error if the source of a refspec without wildcards is not found.
+func (r *Repository) pushedReferences(s core.RefSpec) ([]*core.Reference, error) {
+	if s.IsDelete() {
+		return []*core.Reference{core.NewHashReference("", core.ZeroHash)}, nil
+	}
+
+	if !s.IsWildcard() {
+		ref, err := r.Reference(core.ReferenceName(s.Src()), true)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*core.Reference{core.NewHashReference(core.ReferenceName(s.Src()), ref.Hash)}, nil
+	}
+
+	iter, err := r.References.Iter()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var refs []*core.Reference
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ref.IsSymbolic() && s.Match(ref.Name) {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// addPushCapabilities adds to the request the capabilities it needs
+// that the remote supports, report-status if it does, returning an error if
+// a required one is not supported.
+func addPushCapabilities(req *common.GitReceivePackRequest, c *common.Capabilities, atomic bool) error {
+	if c.Supports("report-status") {
+		req.Capabilities = append(req.Capabilities, "report-status")
+	}
+
+	if atomic {
+		if !c.Supports("atomic") {
+			return ErrAtomicPushNotSupported
+		}
+
+		req.Capabilities = append(req.Capabilities, "atomic")
+	}
+
+	for _, cmd := range req.Commands {
+		if !cmd.IsDelete() {
+			continue
+		}
+
+		if !c.Supports("delete-refs") {
+			return ErrDeleteRefsNotSupported
+		}
+
+		req.Capabilities = append(req.Capabilities, "delete-refs")
+		break
+	}
+
+	if c.Supports("ofs-delta") {
+		req.Capabilities = append(req.Capabilities, "ofs-delta")
+	}
+
+	return nil
+}
+
+// pushPackfile returns the packfile with the objects of the commands the
+// remote is missing, the ones not reachable from the remote references, see
+// missingObjects, or nil if all the commands delete references. The objects
+// are written as ofs-deltas if the remote supports them.
+//
+// The packfile is encoded as it is read, it must be closed once the push is
+// done to stop the encoding, any error of the encoding is returned reading
+// it.
+func (r *Repository) pushPackfile(commands []*common.Command, info *common.GitReceivePackInfo) (io.ReadCloser, error) {
+	var wants []core.Hash
+	for _, cmd := range commands {
+		if !cmd.IsDelete() {
+			wants = append(wants, cmd.New)
+		}
+	}
+
+	if len(wants) == 0 {
+		return nil, nil
+	}
+
+	haves := make([]core.Hash, 0, len(info.Refs))
+	for _, h := range info.Refs {
+		haves = append(haves, h)
+	}
+
+	core.SortHashes(haves)
+	missing, err := r.missingObjects(wants, haves)
+	if err != nil {
+		return nil, err
+	}
+
+	e := packfile.NewEncoder(r.Storage)
+	if info.Capabilities.Supports("ofs-delta") {
+		e = packfile.NewEncoderWithOptions(r.Storage, packfile.DefaultEncoderOptions)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := e.Encode(pw, missing)
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+type commandsByName []*common.Command
+
+func (s commandsByName) Len() int           { return len(s) }
+func (s commandsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s commandsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
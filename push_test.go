@@ -0,0 +1,335 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// memoryReceivePackService is a GitReceivePackService pushing to a plain
+// repository, storing the objects of the packfiles received and updating
+// its references as git-receive-pack does. The commands on the references
+// in reject fail with the given reason.
+type memoryReceivePackService struct {
+	r            *Repository
+	capabilities []string
+	reject       map[core.ReferenceName]string
+
+	requests []*common.GitReceivePackRequest
+	// objects is the number of objects of the last packfile received
+	objects int
+}
+
+func newMemoryReceivePackService() *memoryReceivePackService {
+	return &memoryReceivePackService{
+		r:            NewPlainRepository(),
+		capabilities: []string{"report-status", "delete-refs", "ofs-delta", "atomic"},
+	}
+}
+
+func (s *memoryReceivePackService) Connect(url common.Endpoint) error {
+	return nil
+}
+
+func (s *memoryReceivePackService) ConnectWithAuth(url common.Endpoint, auth common.AuthMethod) error {
+	return nil
+}
+
+func (s *memoryReceivePackService) Info() (*common.GitReceivePackInfo, error) {
+	info := common.NewGitReceivePackInfo()
+	for _, c := range s.capabilities {
+		info.Capabilities.Add(c)
+	}
+
+	iter, err := s.r.References.Iter()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			return info, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		info.Refs[ref.Name.String()] = ref.Hash
+	}
+}
+
+func (s *memoryReceivePackService) SendPack(req *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	s.requests = append(s.requests, req)
+	s.objects = 0
+	if req.Packfile != nil {
+		pack, err := ioutil.ReadAll(req.Packfile)
+		if err != nil {
+			return nil, err
+		}
+
+		s.objects = int(binary.BigEndian.Uint32(pack[8:12]))
+		d := packfile.NewDecoder(packfile.NewStream(bytes.NewReader(pack)))
+		if err := d.Decode(s.r.Storage); err != nil {
+			return nil, err
+		}
+	}
+
+	status := &common.ReportStatus{UnpackStatus: "ok"}
+	for _, cmd := range req.Commands {
+		if reason, ok := s.reject[cmd.Name]; ok {
+			status.CommandStatuses = append(status.CommandStatuses, &common.CommandStatus{Name: cmd.Name, Status: reason})
+			continue
+		}
+
+		var err error
+		if cmd.IsDelete() {
+			err = s.r.References.Remove(cmd.Name)
+		} else {
+			err = s.r.References.Set(core.NewHashReference(cmd.Name, cmd.New))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		status.CommandStatuses = append(status.CommandStatuses, &common.CommandStatus{Name: cmd.Name, Status: "ok"})
+	}
+
+	return status, nil
+}
+
+type SuitePush struct {
+	dir    string
+	merges *Repository
+}
+
+var _ = Suite(&SuitePush{})
+
+func (s *SuitePush) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(mergesFixture)
+	c.Assert(err, IsNil)
+
+	s.merges, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuitePush) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *SuitePush) remote() *memoryReceivePackService {
+	srv := newMemoryReceivePackService()
+	s.merges.Remotes[DefaultRemoteName] = &Remote{rpSrv: srv}
+	return srv
+}
+
+// the number of objects sent have been obtained with git rev-list --objects
+func (s *SuitePush) TestPush(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/feature:refs/heads/feature"},
+	}), IsNil)
+	c.Assert(srv.objects, Equals, 12)
+	c.Assert(srv.requests[0].Commands, DeepEquals, []*common.Command{
+		{Name: "refs/heads/feature", New: fetchFeature2},
+	})
+	c.Assert(srv.requests[0].Capabilities, DeepEquals, []string{"report-status", "ofs-delta"})
+
+	// the branch HEAD points to is pushed by default
+	c.Assert(s.merges.Push(&PushOptions{}), IsNil)
+	c.Assert(srv.objects, Equals, 30)
+	c.Assert(srv.requests[1].Commands, DeepEquals, []*common.Command{
+		{Name: "refs/heads/master", New: fetchMaster2},
+	})
+
+	iter, err := srv.r.Log(LogOptions{From: fetchMaster2})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), HasLen, 15)
+
+	commit, err := srv.r.Commit(fetchMaster2)
+	c.Assert(err, IsNil)
+	files, err := commit.Files()
+	c.Assert(err, IsNil)
+	c.Assert(files.ForEach(func(f *File) error {
+		_, err := f.Contents()
+		return err
+	}), IsNil)
+
+	c.Assert(s.merges.Push(&PushOptions{}), Equals, NoErrAlreadyUpToDate)
+	c.Assert(srv.requests, HasLen, 2)
+}
+
+func (s *SuitePush) TestPushWildcard(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/*:refs/heads/*"},
+	}), IsNil)
+	c.Assert(srv.objects, Equals, 42)
+	c.Assert(srv.requests[0].Commands, DeepEquals, []*common.Command{
+		{Name: "refs/heads/feature", New: fetchFeature2},
+		{Name: "refs/heads/master", New: fetchMaster2},
+	})
+}
+
+// countingObjectStorage counts the objects read by type
+type countingObjectStorage struct {
+	core.ObjectStorage
+	reads map[core.ObjectType]int
+}
+
+func (s *countingObjectStorage) Get(h core.Hash) (core.Object, error) {
+	obj, err := s.ObjectStorage.Get(h)
+	if err == nil {
+		s.reads[obj.Type()]++
+	}
+
+	return obj, err
+}
+
+// the history of the remote references is only walked until the commits
+// pushed, the trees of the commits the remote has are not read
+func (s *SuitePush) TestPushBoundedWalk(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{}), IsNil)
+	c.Assert(srv.objects, Equals, 42)
+
+	storage := &countingObjectStorage{ObjectStorage: s.merges.Storage, reads: make(map[core.ObjectType]int)}
+	s.merges.Storage = storage
+	defer func() { s.merges.Storage = storage.ObjectStorage }()
+
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/feature:refs/heads/other"},
+	}), IsNil)
+	c.Assert(srv.objects, Equals, 0)
+	c.Assert(storage.reads[core.TreeObject], Equals, 0)
+	c.Assert(storage.reads[core.BlobObject], Equals, 0)
+}
+
+// the encoding of the packfile stops if the push fails before reading it
+func (s *SuitePush) TestPushPackfileClosed(c *C) {
+	srv := s.remote()
+	info, err := srv.Info()
+	c.Assert(err, IsNil)
+
+	pack, err := s.merges.pushPackfile([]*common.Command{{Name: "refs/heads/master", New: fetchMaster2}}, info)
+	c.Assert(err, IsNil)
+	c.Assert(pack.Close(), IsNil)
+
+	_, err = ioutil.ReadAll(pack)
+	c.Assert(err, Equals, io.ErrClosedPipe)
+}
+
+func (s *SuitePush) TestPushDelete(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/*:refs/heads/*"},
+	}), IsNil)
+
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{":refs/heads/feature"},
+	}), IsNil)
+	c.Assert(srv.requests[1].Commands, DeepEquals, []*common.Command{
+		{Name: "refs/heads/feature", Old: fetchFeature2},
+	})
+	c.Assert(srv.requests[1].Capabilities, DeepEquals, []string{"report-status", "delete-refs", "ofs-delta"})
+	c.Assert(srv.requests[1].Packfile, IsNil)
+
+	_, err := srv.r.References.Get("refs/heads/feature")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	err = s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{":refs/heads/feature"},
+	})
+	c.Assert(err, ErrorMatches, `remote reference "refs/heads/feature" not found`)
+
+	srv.capabilities = []string{"report-status"}
+	err = s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{":refs/heads/master"},
+	})
+	c.Assert(err, Equals, ErrDeleteRefsNotSupported)
+}
+
+func (s *SuitePush) TestPushNonFastForward(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{}), IsNil)
+
+	// feature is an ancestor of master
+	err := s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/feature:refs/heads/master"},
+	})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+	c.Assert(srv.requests, HasLen, 1)
+
+	c.Assert(s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"+refs/heads/feature:refs/heads/master"},
+	}), IsNil)
+	c.Assert(srv.objects, Equals, 0)
+
+	ref, err := srv.r.References.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, fetchFeature2)
+}
+
+func (s *SuitePush) TestPushAtomic(c *C) {
+	srv := s.remote()
+	c.Assert(s.merges.Push(&PushOptions{Atomic: true}), IsNil)
+	c.Assert(srv.requests[0].Capabilities, DeepEquals, []string{"report-status", "atomic", "ofs-delta"})
+
+	srv.capabilities = []string{"report-status", "ofs-delta"}
+	err := s.merges.Push(&PushOptions{
+		RefSpecs: []core.RefSpec{"refs/heads/feature:refs/heads/feature"},
+		Atomic:   true,
+	})
+	c.Assert(err, Equals, ErrAtomicPushNotSupported)
+}
+
+func (s *SuitePush) TestPushRejected(c *C) {
+	srv := s.remote()
+	srv.reject = map[core.ReferenceName]string{"refs/heads/master": "pre-receive hook declined"}
+
+	err := s.merges.Push(&PushOptions{})
+	c.Assert(err, DeepEquals, &common.CommandError{
+		Name:   "refs/heads/master",
+		Reason: "pre-receive hook declined",
+	})
+}
+
+func (s *SuitePush) TestPushErrors(c *C) {
+	s.remote()
+	err := s.merges.Push(&PushOptions{RemoteName: "foo"})
+	c.Assert(err, ErrorMatches, `unable to find remote "foo"`)
+
+	err = s.merges.Push(&PushOptions{RefSpecs: []core.RefSpec{"refs/heads/*:refs/heads/master"}})
+	c.Assert(err, Equals, core.ErrRefSpecMalformedWildcard)
+
+	err = s.merges.Push(&PushOptions{RefSpecs: []core.RefSpec{"refs/heads/foo:refs/heads/foo"}})
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	s.merges.Remotes[DefaultRemoteName] = &Remote{}
+	c.Assert(s.merges.Push(&PushOptions{}), Equals, ErrPushNotSupported)
+}
+
+func (s *SuitePush) TestPushContextDone(c *C) {
+	srv := s.remote()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Assert(s.merges.PushContext(ctx, &PushOptions{}), Equals, context.Canceled)
+	c.Assert(srv.objects, Equals, 0)
+}
@@ -0,0 +1,225 @@
+package git
+
+import (
+	"container/heap"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// reachableObjects returns the hashes of the objects reachable from the
+// given ones, themselves included, that are not in seen: the trees and the
+// parents of the commits, the targets of the tags and the entries of the
+// trees, except the submodules. The objects found are added to seen, so it
+// can be shared by several walks to skip the objects already visited.
+//
+// The parents of the shallow commits are not followed. If missing is true
+// the objects not in the storage are skipped, otherwise ErrObjectNotFound
+// is returned for them. The blobs are not read.
+func (r *Repository) reachableObjects(hashes []core.Hash, seen map[core.Hash]bool, missing bool) ([]core.Hash, error) {
+	shallows, err := r.shallows()
+	if err != nil {
+		return nil, err
+	}
+
+	shallow := make(map[core.Hash]bool, len(shallows))
+	for _, h := range shallows {
+		shallow[h] = true
+	}
+
+	var found []core.Hash
+	pending := append([]core.Hash(nil), hashes...)
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		obj, err := r.Object(h)
+		if err == ErrObjectNotFound && missing {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		seen[h] = true
+		found = append(found, h)
+		switch o := obj.(type) {
+		case *Commit:
+			pending = append(pending, o.TreeHash)
+			if !shallow[h] {
+				pending = append(pending, o.ParentHashes...)
+			}
+		case *Tag:
+			pending = append(pending, o.Target)
+		case *Tree:
+			for _, e := range o.Entries {
+				if seen[e.Hash] || isSubmoduleMode(e.Mode) {
+					continue
+				}
+
+				if m, err := gitFileMode(e.Mode); err == nil && m == treeEntryDirMode {
+					pending = append(pending, e.Hash)
+					continue
+				}
+
+				if ok, err := r.hasObject(e.Hash); err != nil || !ok {
+					if err == nil && missing {
+						continue
+					}
+
+					if err == nil {
+						err = ErrObjectNotFound
+					}
+
+					return nil, err
+				}
+
+				seen[e.Hash] = true
+				found = append(found, e.Hash)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// the flags of the commits walked by missingObjects
+const (
+	wanted        = 1 << iota // reachable from the wants
+	uninteresting             // reachable from the haves
+)
+
+// missingObjects returns the objects reachable from wants that are not
+// reachable from haves, as git rev-list --objects wants --not haves does,
+// without walking the whole history of the haves: the commits of both sides
+// are walked newest first by committer date, painted with the side they are
+// reachable from, until only commits reachable from the haves are left. The
+// objects of the haves not in the storage are ignored.
+//
+// The commits reachable from the haves are not sent, nor the objects of the
+// trees of the ones that are parents of the commits sent, the boundary of
+// the walk. Some objects the remote already has may be sent, the ones of
+// older commits, but none is left out.
+func (r *Repository) missingObjects(wants, haves []core.Hash) ([]core.Hash, error) {
+	seen := make(map[core.Hash]bool)
+	wantCommits, err := r.peelCommits(wants, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	haveCommits, err := r.peelCommits(haves, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.commitGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[core.Hash]int)
+	var pending commitHeap
+	paint := func(c *Commit, f int) {
+		if flags[c.Hash]&f != f {
+			flags[c.Hash] |= f
+			heap.Push(&pending, c)
+		}
+	}
+
+	for _, c := range wantCommits {
+		paint(c, wanted)
+	}
+
+	for _, c := range haveCommits {
+		paint(c, uninteresting)
+	}
+
+	boundary := make(map[core.Hash]*Commit)
+	for hasWanted(pending, flags) {
+		c := heap.Pop(&pending).(*Commit)
+		f := flags[c.Hash]
+		if f&uninteresting != 0 {
+			f = uninteresting
+		}
+
+		parents, err := r.graphParents(g, c)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range parents {
+			if f == wanted {
+				boundary[p.Hash] = p
+			}
+
+			paint(p, f)
+		}
+	}
+
+	for h, f := range flags {
+		if f&uninteresting != 0 {
+			seen[h] = true
+		}
+	}
+
+	for h, c := range boundary {
+		if flags[h]&uninteresting == 0 {
+			continue
+		}
+
+		if _, err := r.reachableObjects([]core.Hash{c.TreeHash}, seen, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.reachableObjects(wants, seen, false)
+}
+
+// peelCommits returns the commits of the given hashes, the targets of the
+// tags peeled, skipping the objects not in the storage and the ones that are
+// not commits. The tags peeled are added to seen, if it is not nil.
+func (r *Repository) peelCommits(hashes []core.Hash, seen map[core.Hash]bool) ([]*Commit, error) {
+	var commits []*Commit
+	for _, h := range hashes {
+		for {
+			obj, err := r.Object(h)
+			if err == ErrObjectNotFound {
+				break
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if tag, ok := obj.(*Tag); ok {
+				if seen != nil {
+					seen[h] = true
+				}
+
+				h = tag.Target
+				continue
+			}
+
+			if c, ok := obj.(*Commit); ok {
+				commits = append(commits, c)
+			}
+
+			break
+		}
+	}
+
+	return commits, nil
+}
+
+func hasWanted(pending commitHeap, flags map[core.Hash]int) bool {
+	for _, c := range pending {
+		if flags[c.Hash]&uninteresting == 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,289 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ObjectNotFoundError is returned by the iterators of references, along
+// with the reference, when the object it points to, or any of the objects
+// followed to peel it, is not in the repository. Hash is the hash of the
+// missing object. The iteration can go on after it.
+type ObjectNotFoundError struct {
+	Reference core.ReferenceName
+	Hash      core.Hash
+}
+
+func (e *ObjectNotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrObjectNotFound, e.Hash, e.Reference)
+}
+
+// ReferenceIter provides an iterator for a set of references of a
+// repository, like its branches or its tags.
+type ReferenceIter struct {
+	core.ReferenceIter
+	r *Repository
+}
+
+// NewReferenceIter returns a ReferenceIter for the given repository and
+// underlying reference iterator.
+func NewReferenceIter(r *Repository, iter core.ReferenceIter) *ReferenceIter {
+	return &ReferenceIter{iter, r}
+}
+
+// NextCommit moves the iterator to the next reference and returns it along
+// with the commit it points to, following the symbolic references and
+// peeling the annotated tags, so the commit tagged is returned. If the
+// reference points to a different type of object ErrUnsupportedObject will
+// be returned, and an *ObjectNotFoundError if the object is missing. If it
+// has reached the end of the set it will return io.EOF.
+func (iter *ReferenceIter) NextCommit() (*core.Reference, *Commit, error) {
+	ref, err := iter.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit, err := iter.r.referenceCommit(ref)
+	return ref, commit, err
+}
+
+// ForEach calls cb for each of the remaining references of the iterator and
+// then closes it, as FileIter.ForEach does with the files.
+func (iter *ReferenceIter) ForEach(cb func(*core.Reference) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each reference of the iterator and closes it,
+// as FileIter.ForEachContext does with the files.
+func (iter *ReferenceIter) ForEachContext(ctx context.Context, cb func(*core.Reference) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ref, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(ref); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// referenceCommit returns the commit the reference points to, see
+// ReferenceIter.NextCommit.
+func (r *Repository) referenceCommit(ref *core.Reference) (*Commit, error) {
+	obj, err := r.referenceObject(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.peelCommit(ref.Name, obj)
+}
+
+// referenceObject returns the object the reference points to, following it
+// if it is symbolic.
+func (r *Repository) referenceObject(ref *core.Reference) (Object, error) {
+	name := ref.Name
+	if ref.IsSymbolic() {
+		var err error
+		if ref, err = core.ResolveReference(r.References, ref.Target); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.referencedObject(name, ref.Hash)
+}
+
+// peelCommit returns the commit tagged by obj, following the tags of tags,
+// or obj itself if it is a commit. ErrUnsupportedObject is returned if obj
+// is, or tags, an object of a different type.
+func (r *Repository) peelCommit(name core.ReferenceName, obj Object) (*Commit, error) {
+	for {
+		switch o := obj.(type) {
+		case *Commit:
+			return o, nil
+		case *Tag:
+			var err error
+			if obj, err = r.referencedObject(name, o.Target); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrUnsupportedObject
+		}
+	}
+}
+
+// referencedObject returns the object with the given hash, an
+// *ObjectNotFoundError for the reference with the given name is returned if
+// it is missing.
+func (r *Repository) referencedObject(name core.ReferenceName, h core.Hash) (Object, error) {
+	obj, err := r.Object(h)
+	if err == ErrObjectNotFound {
+		return nil, &ObjectNotFoundError{Reference: name, Hash: h}
+	}
+
+	return obj, err
+}
+
+// TagReference is a tag of a repository, as returned by TagIter: the name of
+// its reference, its tag object if it is an annotated tag, or nil if it is a
+// lightweight one, and the commit tagged, or nil if a different type of
+// object is tagged.
+type TagReference struct {
+	Name   core.ReferenceName
+	Tag    *Tag
+	Commit *Commit
+}
+
+// TagIter provides an iterator for the tags of a repository, lightweight and
+// annotated, see Repository.Tags.
+type TagIter struct {
+	core.ReferenceIter
+	r *Repository
+}
+
+// NewTagIter returns a TagIter for the given repository and underlying
+// iterator of the references of its tags.
+func NewTagIter(r *Repository, iter core.ReferenceIter) *TagIter {
+	return &TagIter{iter, r}
+}
+
+// Next moves the iterator to the next tag and returns it. If the object of
+// the tag, or any object followed to peel it, is missing, the tag is
+// returned with the objects found along with an *ObjectNotFoundError, and
+// the iteration can go on. If it has reached the end of the set it will
+// return io.EOF.
+func (iter *TagIter) Next() (*TagReference, error) {
+	ref, err := iter.ReferenceIter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	tag := &TagReference{Name: ref.Name}
+	obj, err := iter.r.referenceObject(ref)
+	if err != nil {
+		return tag, err
+	}
+
+	tag.Tag, _ = obj.(*Tag)
+	tag.Commit, err = iter.r.peelCommit(ref.Name, obj)
+	if err == ErrUnsupportedObject {
+		err = nil
+	}
+
+	return tag, err
+}
+
+// ForEach calls cb for each of the remaining tags of the iterator and then
+// closes it, as FileIter.ForEach does with the files. The tags whose objects
+// are missing are skipped, Next returns them along with the error.
+func (iter *TagIter) ForEach(cb func(*TagReference) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each tag of the iterator and closes it, as
+// ForEach does.
+func (iter *TagIter) ForEachContext(ctx context.Context, cb func(*TagReference) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tag, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if _, ok := err.(*ObjectNotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(tag); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// UpdateReference stores the reference new if the stored one with its name
+// is still old, or there is none if old is nil, see
+// core.SetReferenceChecked, and appends an entry with the given committer
+// and message to its reflog. The entry is also appended to the reflog of
+// HEAD if HEAD points to the reference, as git does. This is the way the
+// operations updating the references keep their reflogs.
+func (r *Repository) UpdateReference(new, old *core.Reference, committer Signature, message string) error {
+	entry := &core.ReflogEntry{
+		Old:       r.reflogHash(old),
+		Committer: core.Signature(committer),
+		Message:   message,
+	}
+
+	if err := core.SetReferenceChecked(r.References, new, old); err != nil {
+		return err
+	}
+
+	entry.New = r.reflogHash(new)
+	if err := r.Reflogs.Append(new.Name, entry); err != nil {
+		return err
+	}
+
+	head, err := r.References.Get(core.HEAD)
+	if err == core.ErrReferenceNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if head.IsSymbolic() && head.Target == new.Name {
+		return r.Reflogs.Append(core.HEAD, entry)
+	}
+
+	return nil
+}
+
+// reflogHash returns the hash the reference points to, resolving it if it is
+// symbolic, or ZeroHash if there is no reference or it can not be resolved.
+func (r *Repository) reflogHash(ref *core.Reference) core.Hash {
+	if ref == nil {
+		return core.ZeroHash
+	}
+
+	if !ref.IsSymbolic() {
+		return ref.Hash
+	}
+
+	resolved, err := core.ResolveReference(r.References, ref.Target)
+	if err != nil {
+		return core.ZeroHash
+	}
+
+	return resolved.Hash
+}
+
+// Reflog returns an iterator for the entries of the reflog of the reference
+// with the given name, the oldest first.
+func (r *Repository) Reflog(name core.ReferenceName) (core.ReflogIter, error) {
+	return r.Reflogs.Entries(name)
+}
@@ -0,0 +1,254 @@
+package git
+
+import (
+	"io"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteReferenceIter struct {
+	r *Repository
+}
+
+var _ = Suite(&SuiteReferenceIter{})
+
+func (s *SuiteReferenceIter) SetUpTest(c *C) {
+	repos := unpackFixtures(c, tagFixtures)
+	s.r = repos["https://github.com/spinnaker/spinnaker.git"]
+	s.r.References = memory.NewReferenceStorage()
+
+	commit, err := s.r.Commit(core.NewHash("a77d88e40e86ae81b3ce1c19d04fd73f473f5644"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	for _, ref := range []*core.Reference{
+		core.NewSymbolicReference(core.HEAD, "refs/heads/master"),
+		core.NewHashReference("refs/heads/master", commit.Hash),
+		core.NewSymbolicReference("refs/heads/alias", "refs/heads/master"),
+		core.NewHashReference("refs/heads/old", core.NewHash("65e37611b1ff9cb589e3060507427a9a2645907e")),
+		core.NewHashReference("refs/tags/v0.13.0", core.NewHash("48b655898fa9c72d62e8dd73b022ecbddd6e4cc2")),
+		core.NewHashReference("refs/tags/lightweight", commit.Hash),
+		core.NewHashReference("refs/tags/tree", tree.Hash),
+		core.NewHashReference("refs/remotes/origin/master", commit.Hash),
+	} {
+		c.Assert(s.r.References.Set(ref), IsNil)
+	}
+}
+
+func (s *SuiteReferenceIter) TestBranches(c *C) {
+	iter, err := s.r.Branches()
+	c.Assert(err, IsNil)
+
+	c.Assert(referenceCommits(c, iter), DeepEquals, map[core.ReferenceName]string{
+		"refs/heads/alias":  "a77d88e40e86ae81b3ce1c19d04fd73f473f5644",
+		"refs/heads/master": "a77d88e40e86ae81b3ce1c19d04fd73f473f5644",
+		"refs/heads/old":    "65e37611b1ff9cb589e3060507427a9a2645907e",
+	})
+}
+
+func (s *SuiteReferenceIter) TestTags(c *C) {
+	iter, err := s.r.Tags()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	// the tags sorted by name: lightweight, tree, v0.13.0
+	tag, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, core.ReferenceName("refs/tags/lightweight"))
+	c.Assert(tag.Tag, IsNil)
+	c.Assert(tag.Commit.Hash.String(), Equals, "a77d88e40e86ae81b3ce1c19d04fd73f473f5644")
+
+	tag, err = iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, core.ReferenceName("refs/tags/tree"))
+	c.Assert(tag.Tag, IsNil)
+	c.Assert(tag.Commit, IsNil)
+
+	tag, err = iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, core.ReferenceName("refs/tags/v0.13.0"))
+	c.Assert(tag.Tag.Hash.String(), Equals, "48b655898fa9c72d62e8dd73b022ecbddd6e4cc2")
+	c.Assert(tag.Commit.Hash.String(), Equals, "a77d88e40e86ae81b3ce1c19d04fd73f473f5644")
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *SuiteReferenceIter) TestTagsObjectNotFound(c *C) {
+	missing := core.NewHash("0000000000000000000000000000000000000001")
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/tags/missing", missing)), IsNil)
+
+	iter, err := s.r.Tags()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	_, err = iter.Next()
+	c.Assert(err, IsNil)
+
+	tag, err := iter.Next()
+	c.Assert(tag, DeepEquals, &TagReference{Name: "refs/tags/missing"})
+	c.Assert(err, DeepEquals, &ObjectNotFoundError{Reference: "refs/tags/missing", Hash: missing})
+
+	tag, err = iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, core.ReferenceName("refs/tags/tree"))
+}
+
+func (s *SuiteReferenceIter) TestTagIterForEach(c *C) {
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/tags/missing", core.NewHash("0000000000000000000000000000000000000001"))), IsNil)
+
+	iter, err := s.r.Tags()
+	c.Assert(err, IsNil)
+
+	var names []core.ReferenceName
+	err = iter.ForEach(func(tag *TagReference) error {
+		names = append(names, tag.Name)
+		if tag.Name == "refs/tags/tree" {
+			return core.ErrStop
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []core.ReferenceName{"refs/tags/lightweight", "refs/tags/tree"})
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *SuiteReferenceIter) TestReferenceIterForEach(c *C) {
+	iter, err := s.r.Branches()
+	c.Assert(err, IsNil)
+
+	var names []core.ReferenceName
+	err = iter.ForEach(func(ref *core.Reference) error {
+		names = append(names, ref.Name)
+		if ref.Name == "refs/heads/master" {
+			return core.ErrStop
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []core.ReferenceName{"refs/heads/alias", "refs/heads/master"})
+
+	iter, err = s.r.Branches()
+	c.Assert(err, IsNil)
+	err = iter.ForEach(func(ref *core.Reference) error { return io.ErrUnexpectedEOF })
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+}
+
+func (s *SuiteReferenceIter) TestNextCommitUnsupported(c *C) {
+	tree, err := s.r.References.Get("refs/tags/tree")
+	c.Assert(err, IsNil)
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/tree", tree.Hash)), IsNil)
+
+	iter, err := s.r.Branches()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	// the branches sorted by name: alias, master, old, tree
+	for i := 0; i < 3; i++ {
+		_, _, err = iter.NextCommit()
+		c.Assert(err, IsNil)
+	}
+
+	ref, _, err := iter.NextCommit()
+	c.Assert(ref.Name, Equals, core.ReferenceName("refs/heads/tree"))
+	c.Assert(err, Equals, ErrUnsupportedObject)
+
+	_, _, err = iter.NextCommit()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *SuiteReferenceIter) TestNextCommitObjectNotFound(c *C) {
+	missing := core.NewHash("0000000000000000000000000000000000000001")
+	c.Assert(s.r.References.Set(core.NewHashReference("refs/heads/missing", missing)), IsNil)
+
+	iter, err := s.r.Branches()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	// the branches sorted by name: alias, master, missing, old
+	for i := 0; i < 2; i++ {
+		_, _, err = iter.NextCommit()
+		c.Assert(err, IsNil)
+	}
+
+	ref, commit, err := iter.NextCommit()
+	c.Assert(ref.Name, Equals, core.ReferenceName("refs/heads/missing"))
+	c.Assert(commit, IsNil)
+	c.Assert(err, DeepEquals, &ObjectNotFoundError{Reference: "refs/heads/missing", Hash: missing})
+
+	_, commit, err = iter.NextCommit()
+	c.Assert(err, IsNil)
+	c.Assert(commit.Hash.String(), Equals, "65e37611b1ff9cb589e3060507427a9a2645907e")
+}
+
+func referenceCommits(c *C, iter *ReferenceIter) map[core.ReferenceName]string {
+	defer iter.Close()
+
+	commits := make(map[core.ReferenceName]string)
+	for {
+		ref, commit, err := iter.NextCommit()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		commits[ref.Name] = commit.Hash.String()
+	}
+
+	return commits
+}
+
+func (s *SuiteReferenceIter) TestUpdateReference(c *C) {
+	committer := Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833006, 0)}
+	master, err := s.r.References.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+
+	updated := core.NewHashReference(master.Name, core.NewHash("65e37611b1ff9cb589e3060507427a9a2645907e"))
+	c.Assert(s.r.UpdateReference(updated, master, committer, "reset: moving"), IsNil)
+	c.Assert(s.r.UpdateReference(updated, master, committer, "reset: again"), Equals, core.ErrReferenceHasChanged)
+
+	other := core.NewHashReference("refs/heads/other", master.Hash)
+	c.Assert(s.r.UpdateReference(other, nil, committer, "branch: Created"), IsNil)
+
+	expected := &core.ReflogEntry{
+		Old:       master.Hash,
+		New:       updated.Hash,
+		Committer: core.Signature(committer),
+		Message:   "reset: moving",
+	}
+
+	for n, entries := range map[core.ReferenceName][]*core.ReflogEntry{
+		"refs/heads/master": {expected},
+		core.HEAD:           {expected},
+		"refs/heads/other": {{
+			New:       master.Hash,
+			Committer: core.Signature(committer),
+			Message:   "branch: Created",
+		}},
+	} {
+		iter, err := s.r.Reflog(n)
+		c.Assert(err, IsNil)
+
+		var obtained []*core.ReflogEntry
+		for {
+			e, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			obtained = append(obtained, e)
+		}
+
+		c.Assert(obtained, DeepEquals, entries, Commentf("name=%s", n))
+	}
+}
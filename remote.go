@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -14,8 +15,11 @@ type Remote struct {
 	Endpoint common.Endpoint
 	Auth     common.AuthMethod
 
+	config *RemoteConfig
 	upSrv  common.GitUploadPackService
 	upInfo *common.GitUploadPackInfo
+	rpSrv  common.GitReceivePackService
+	rpInfo *common.GitReceivePackInfo
 }
 
 // NewRemote returns a new Remote, using as client http.DefaultClient
@@ -35,15 +39,66 @@ func NewAuthenticatedRemote(url string, auth common.AuthMethod) (*Remote, error)
 	if err != nil {
 		return nil, err
 	}
+
+	// the remotes of the protocols that can not push are still valid to fetch
+	rpSrv, _ := clients.NewGitReceivePackService(url)
 	return &Remote{
 		Endpoint: end,
 		Auth:     auth,
 		upSrv:    upSrv,
+		rpSrv:    rpSrv,
 	}, nil
 }
 
+// Config returns the config of the remote, nil if it does not come from
+// the config of a repository, see Repository.Remote.
+func (r *Remote) Config() *RemoteConfig {
+	return r.config
+}
+
+// fetchRefSpecs returns the refspecs fetched by default from the remote with
+// the given name: the ones of its config, or the ones of its
+// remote-tracking branches if it has none.
+func (r *Remote) fetchRefSpecs(name string) []core.RefSpec {
+	if r.config != nil && len(r.config.Fetch) != 0 {
+		return r.config.Fetch
+	}
+
+	return []core.RefSpec{defaultRefSpec(name)}
+}
+
+// pushRemotes returns the remotes pushed to when pushing to the remote, one
+// for every URL of its config, itself for the first one.
+func (r *Remote) pushRemotes() ([]*Remote, error) {
+	remotes := []*Remote{r}
+	if r.config == nil {
+		return remotes, nil
+	}
+
+	for _, url := range r.config.URLs[1:] {
+		remote, err := NewAuthenticatedRemote(url, r.Auth)
+		if err != nil {
+			return nil, err
+		}
+
+		remotes = append(remotes, remote)
+	}
+
+	return remotes, nil
+}
+
 // Connect with the endpoint
 func (r *Remote) Connect() error {
+	return r.ConnectContext(context.Background())
+}
+
+// ConnectContext is like Connect, retrieving the references advertised
+// until ctx is done, see FetchContext.
+func (r *Remote) ConnectContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	var err error
 	if r.Auth == nil {
 		err = r.upSrv.Connect(r.Endpoint)
@@ -55,12 +110,18 @@ func (r *Remote) Connect() error {
 		return err
 	}
 
-	return r.retrieveUpInfo()
+	return r.retrieveUpInfo(ctx)
 }
 
-func (r *Remote) retrieveUpInfo() error {
+func (r *Remote) retrieveUpInfo(ctx context.Context) error {
 	var err error
-	if r.upInfo, err = r.upSrv.Info(); err != nil {
+	if s, ok := r.upSrv.(common.ContextGitUploadPackService); ok {
+		r.upInfo, err = s.InfoContext(ctx)
+	} else {
+		r.upInfo, err = r.upSrv.Info()
+	}
+
+	if err != nil {
 		return err
 	}
 
@@ -89,6 +150,21 @@ func (r *Remote) Head() (core.Hash, error) {
 
 // Fetch returns a reader using the request
 func (r *Remote) Fetch(req *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	return r.FetchContext(context.Background(), req)
+}
+
+// FetchContext is like Fetch, the request is canceled when ctx is done if
+// the service is a common.ContextGitUploadPackService: the reads of the
+// packfile fail then with the error of ctx.
+func (r *Remote) FetchContext(ctx context.Context, req *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	if s, ok := r.upSrv.(common.ContextGitUploadPackService); ok {
+		return s.FetchContext(ctx, req)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	return r.upSrv.Fetch(req)
 }
 
@@ -115,6 +191,69 @@ func (r *Remote) Ref(refName string) (core.Hash, error) {
 	return ref, nil
 }
 
+// ConnectReceivePack connects with the endpoint to push, retrieving the
+// references advertised by git-receive-pack. ErrPushNotSupported is returned
+// if the protocol of the endpoint can not push.
+func (r *Remote) ConnectReceivePack() error {
+	return r.ConnectReceivePackContext(context.Background())
+}
+
+// ConnectReceivePackContext is like ConnectReceivePack, retrieving the
+// references advertised until ctx is done, see SendPackContext.
+func (r *Remote) ConnectReceivePackContext(ctx context.Context) error {
+	if r.rpSrv == nil {
+		return ErrPushNotSupported
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var err error
+	if r.Auth == nil {
+		err = r.rpSrv.Connect(r.Endpoint)
+	} else {
+		err = r.rpSrv.ConnectWithAuth(r.Endpoint, r.Auth)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if s, ok := r.rpSrv.(common.ContextGitReceivePackService); ok {
+		r.rpInfo, err = s.InfoContext(ctx)
+	} else {
+		r.rpInfo, err = r.rpSrv.Info()
+	}
+
+	return err
+}
+
+// ReceivePackInfo returns the git-receive-pack info
+func (r *Remote) ReceivePackInfo() *common.GitReceivePackInfo {
+	return r.rpInfo
+}
+
+// SendPack sends the request to git-receive-pack, returning its
+// report-status if requested
+func (r *Remote) SendPack(req *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	return r.SendPackContext(context.Background(), req)
+}
+
+// SendPackContext is like SendPack, the request is canceled when ctx is done
+// if the service is a common.ContextGitReceivePackService.
+func (r *Remote) SendPackContext(ctx context.Context, req *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	if s, ok := r.rpSrv.(common.ContextGitReceivePackService); ok {
+		return s.SendPackContext(ctx, req)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.rpSrv.SendPack(req)
+}
+
 // Refs returns the Hash pointing the given refName
 func (r *Remote) Refs() map[string]core.Hash {
 	return r.upInfo.Refs
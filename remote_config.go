@@ -0,0 +1,309 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/config"
+)
+
+const remoteSection = "remote"
+
+// ErrRemoteURLRequired is returned by CreateRemote when the remote has no
+// URL.
+var ErrRemoteURLRequired = errors.New("remote requires a URL")
+
+// ErrRemoteNotFound is returned when there is no remote with the given name,
+// neither in Remotes nor in the config.
+type ErrRemoteNotFound struct {
+	Name string
+}
+
+func (e *ErrRemoteNotFound) Error() string {
+	return fmt.Sprintf("unable to find remote %q", e.Name)
+}
+
+// ErrRemoteExists is returned by CreateRemote when there is already a
+// remote with the given name.
+type ErrRemoteExists struct {
+	Name string
+}
+
+func (e *ErrRemoteExists) Error() string {
+	return fmt.Sprintf("remote %q already exists", e.Name)
+}
+
+// ErrInvalidRemoteName is returned by CreateRemote when the name of the
+// remote is empty or it can not be part of a reference name, as the ones of
+// its remote-tracking branches, see core.ReferenceName.Valid.
+type ErrInvalidRemoteName struct {
+	Name string
+}
+
+func (e *ErrInvalidRemoteName) Error() string {
+	return fmt.Sprintf("invalid remote name %q", e.Name)
+}
+
+// RemoteConfig is the config of a remote, its remote section of the config
+// of the repository.
+type RemoteConfig struct {
+	Name string
+	// URLs are the URLs of the remote, the first one is fetched from and all
+	// of them are pushed to, as git does.
+	URLs []string
+	// Fetch are the refspecs fetched by default, see FetchOptions.RefSpecs.
+	// CreateRemote uses the refspec of the remote-tracking branches of the
+	// remote, "+refs/heads/*:refs/remotes/<name>/*", if there are none.
+	Fetch []core.RefSpec
+}
+
+// Validate returns a *ErrInvalidRemoteName if the name of the remote is not
+// valid, ErrRemoteURLRequired if it has no URL and the error of the first
+// refspec that is not valid, see core.RefSpec.Validate.
+func (c *RemoteConfig) Validate() error {
+	if c.Name == "" || !remoteTrackingName(c.Name, "HEAD").Valid() {
+		return &ErrInvalidRemoteName{Name: c.Name}
+	}
+
+	if len(c.URLs) == 0 {
+		return ErrRemoteURLRequired
+	}
+
+	for _, s := range c.Fetch {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remoteTrackingName returns the name of the remote-tracking branch of the
+// given remote for the branch with the given short name.
+func remoteTrackingName(remote, branch string) core.ReferenceName {
+	return core.ReferenceName("refs/remotes/" + remote + "/" + branch)
+}
+
+// readRemoteConfig returns the config of the remote with the given name in
+// cfg, nil if it has no remote section with an URL.
+func readRemoteConfig(cfg *config.Config, name string) *RemoteConfig {
+	c := &RemoteConfig{Name: name, URLs: cfg.Strings(remoteSection, name, "url")}
+	if len(c.URLs) == 0 {
+		return nil
+	}
+
+	for _, s := range cfg.Strings(remoteSection, name, "fetch") {
+		c.Fetch = append(c.Fetch, core.RefSpec(s))
+	}
+
+	return c
+}
+
+// write adds the remote section of the remote to cfg.
+func (c *RemoteConfig) write(cfg *config.Config) {
+	for _, url := range c.URLs {
+		cfg.Add(remoteSection, c.Name, "url", url)
+	}
+
+	for _, s := range c.Fetch {
+		cfg.Add(remoteSection, c.Name, "fetch", s.String())
+	}
+}
+
+// Remote returns the remote with the given name: the one in Remotes, or a
+// new one created from the remote section of the config, which is added to
+// Remotes. A *ErrRemoteNotFound is returned if there is no such remote.
+func (r *Repository) Remote(name string) (*Remote, error) {
+	if remote, ok := r.Remotes[name]; ok {
+		return remote, nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	rc := readRemoteConfig(cfg, name)
+	if rc == nil {
+		return nil, &ErrRemoteNotFound{Name: name}
+	}
+
+	if err := rc.Validate(); err != nil {
+		return nil, err
+	}
+
+	remote, err := newConfiguredRemote(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Remotes[name] = remote
+	return remote, nil
+}
+
+func newConfiguredRemote(c *RemoteConfig) (*Remote, error) {
+	remote, err := NewRemote(c.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	remote.config = c
+	return remote, nil
+}
+
+// ListRemotes returns the remotes of the repository, the ones in Remotes
+// and the ones in the config, sorted by name, see Remote. The method can
+// not be called Remotes, as the field holding them.
+func (r *Repository) ListRemotes() ([]*Remote, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(r.Remotes))
+	for name := range r.Remotes {
+		names = append(names, name)
+	}
+
+	for _, name := range cfg.Subsections(remoteSection) {
+		if _, ok := r.Remotes[name]; !ok && readRemoteConfig(cfg, name) != nil {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	remotes := make([]*Remote, len(names))
+	for i, name := range names {
+		if remotes[i], err = r.Remote(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return remotes, nil
+}
+
+// CreateRemote adds the remote with the given config to the config of the
+// repository and to Remotes, returning it. The config is validated first,
+// see RemoteConfig.Validate, and a *ErrRemoteExists is returned if there is
+// already a remote with its name.
+func (r *Repository) CreateRemote(c *RemoteConfig) (*Remote, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.Remotes[c.Name]; ok || cfg.HasSection(remoteSection, c.Name) {
+		return nil, &ErrRemoteExists{Name: c.Name}
+	}
+
+	rc := *c
+	if len(rc.Fetch) == 0 {
+		rc.Fetch = []core.RefSpec{defaultRefSpec(c.Name)}
+	}
+
+	remote, err := newConfiguredRemote(&rc)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.write(cfg)
+	if err := r.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	r.Remotes[c.Name] = remote
+	return remote, nil
+}
+
+// DeleteRemote removes the remote with the given name from Remotes and its
+// section from the config of the repository, along with its remote-tracking
+// branches, as git remote remove does. The branches tracking the remote stop
+// tracking it: their remote and merge options are removed, and so is their
+// pushRemote option if it is the remote. A *ErrRemoteNotFound is returned
+// if there is no such remote.
+func (r *Repository) DeleteRemote(name string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	_, ok := r.Remotes[name]
+	changed := cfg.HasSection(remoteSection, name)
+	if !ok && !changed {
+		return &ErrRemoteNotFound{Name: name}
+	}
+
+	cfg.RemoveSection(remoteSection, name)
+	if untrackRemote(cfg, name) {
+		changed = true
+	}
+
+	if changed {
+		if err := r.SetConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	delete(r.Remotes, name)
+	return r.removeReferencesPrefix(remoteTrackingName(name, "").String())
+}
+
+// untrackRemote removes the options of the branches of cfg tracking the
+// remote with the given name, returning false if there are none.
+func untrackRemote(cfg *config.Config, name string) bool {
+	var changed bool
+	for _, branch := range cfg.Subsections(branchSection) {
+		if cfg.String(branchSection, branch, "remote") == name {
+			cfg.Unset(branchSection, branch, "remote")
+			cfg.Unset(branchSection, branch, "merge")
+			changed = true
+		}
+
+		if cfg.String(branchSection, branch, "pushRemote") == name {
+			cfg.Unset(branchSection, branch, "pushRemote")
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// removeReferencesPrefix removes the references whose name starts with the
+// given prefix.
+func (r *Repository) removeReferencesPrefix(prefix string) error {
+	iter, err := core.IterReferencesPrefix(r.References, prefix)
+	if err != nil {
+		return err
+	}
+
+	var names []core.ReferenceName
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			iter.Close()
+			return err
+		}
+
+		names = append(names, ref.Name)
+	}
+
+	iter.Close()
+	for _, name := range names {
+		if err := r.References.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v3/clients"
+	"gopkg.in/src-d/go-git.v3/clients/common"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/config"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRemoteConfig struct{}
+
+var _ = Suite(&SuiteRemoteConfig{})
+
+func encodeConfig(c *C, r *Repository) string {
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(config.NewEncoder(&buf).Encode(cfg), IsNil)
+	return buf.String()
+}
+
+func (s *SuiteRemoteConfig) TestCreateRemote(c *C) {
+	r := NewPlainRepository()
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Set("core", "", "bare", "true")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	remote, err := r.CreateRemote(&RemoteConfig{
+		Name: "upstream",
+		URLs: []string{"https://github.com/src-d/go-git.git"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(remote.Endpoint, Equals, common.Endpoint("https://github.com/src-d/go-git.git"))
+	c.Assert(remote.Config().Fetch, DeepEquals, []core.RefSpec{"+refs/heads/*:refs/remotes/upstream/*"})
+
+	_, err = r.CreateRemote(&RemoteConfig{
+		Name:  "mirror",
+		URLs:  []string{"https://github.com/src-d/go-git.git", "https://github.com/tyba/go-git.git"},
+		Fetch: []core.RefSpec{"+refs/heads/master:refs/remotes/mirror/master"},
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(encodeConfig(c, r), Equals, "[core]\n"+
+		"\tbare = true\n"+
+		"[remote \"upstream\"]\n"+
+		"\turl = https://github.com/src-d/go-git.git\n"+
+		"\tfetch = +refs/heads/*:refs/remotes/upstream/*\n"+
+		"[remote \"mirror\"]\n"+
+		"\turl = https://github.com/src-d/go-git.git\n"+
+		"\turl = https://github.com/tyba/go-git.git\n"+
+		"\tfetch = +refs/heads/master:refs/remotes/mirror/master\n")
+
+	found, err := r.Remote("upstream")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, remote)
+}
+
+func (s *SuiteRemoteConfig) TestCreateRemoteErrors(c *C) {
+	r := NewPlainRepository()
+	r.Remotes["origin"] = &Remote{}
+	url := []string{"https://github.com/src-d/go-git.git"}
+
+	_, err := r.CreateRemote(&RemoteConfig{Name: "foo", URLs: url})
+	c.Assert(err, IsNil)
+
+	for _, rc := range []*RemoteConfig{
+		{Name: "", URLs: url},
+		{Name: "a b", URLs: url},
+		{Name: "a..b", URLs: url},
+		{Name: "a/", URLs: url},
+	} {
+		_, err := r.CreateRemote(rc)
+		c.Assert(err, DeepEquals, &ErrInvalidRemoteName{Name: rc.Name})
+	}
+
+	_, err = r.CreateRemote(&RemoteConfig{Name: "origin", URLs: url})
+	c.Assert(err, DeepEquals, &ErrRemoteExists{Name: "origin"})
+	_, err = r.CreateRemote(&RemoteConfig{Name: "foo", URLs: url})
+	c.Assert(err, DeepEquals, &ErrRemoteExists{Name: "foo"})
+	c.Assert(err.Error(), Equals, `remote "foo" already exists`)
+
+	_, err = r.CreateRemote(&RemoteConfig{Name: "bar"})
+	c.Assert(err, Equals, ErrRemoteURLRequired)
+
+	_, err = r.CreateRemote(&RemoteConfig{Name: "bar", URLs: url, Fetch: []core.RefSpec{"refs/heads/*"}})
+	c.Assert(err, Equals, core.ErrRefSpecMalformedSeparator)
+
+	_, err = r.Remote("bar")
+	c.Assert(err, DeepEquals, &ErrRemoteNotFound{Name: "bar"})
+}
+
+func (s *SuiteRemoteConfig) TestListRemotes(c *C) {
+	r := NewPlainRepository()
+	r.Remotes["origin"] = &Remote{}
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(config.NewDecoder(bytes.NewBufferString("[remote \"b\"]\n"+
+		"\turl = https://github.com/src-d/go-git.git\n"+
+		"[remote \"a\"]\n"+
+		"\turl = https://github.com/tyba/go-git.git\n"+
+		"[remote \"nourl\"]\n"+
+		"\tfetch = +refs/heads/*:refs/remotes/nourl/*\n")).Decode(cfg), IsNil)
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	remotes, err := r.ListRemotes()
+	c.Assert(err, IsNil)
+	c.Assert(remotes, HasLen, 3)
+	c.Assert(remotes[0].Config().Name, Equals, "a")
+	c.Assert(remotes[1].Config().Name, Equals, "b")
+	c.Assert(remotes[2], Equals, r.Remotes["origin"])
+	c.Assert(remotes[2].Config(), IsNil)
+
+	// the remotes of the config are added to Remotes
+	c.Assert(r.Remotes["a"], Equals, remotes[0])
+}
+
+func (s *SuiteRemoteConfig) TestDeleteRemote(c *C) {
+	r := NewPlainRepository()
+	_, err := r.CreateRemote(&RemoteConfig{Name: "foo", URLs: []string{"https://github.com/src-d/go-git.git"}})
+	c.Assert(err, IsNil)
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Set("user", "", "name", "Foo")
+	cfg.Set("branch", "master", "remote", "foo")
+	cfg.Set("branch", "master", "merge", "refs/heads/master")
+	cfg.Set("branch", "dev", "remote", "origin")
+	cfg.Set("branch", "dev", "merge", "refs/heads/dev")
+	cfg.Set("branch", "dev", "pushRemote", "foo")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	h := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	for _, name := range []core.ReferenceName{"refs/remotes/foo/master", "refs/remotes/foo/bar/baz", "refs/remotes/foobar/master"} {
+		c.Assert(r.References.Set(core.NewHashReference(name, h)), IsNil)
+	}
+
+	c.Assert(r.DeleteRemote("foo"), IsNil)
+	c.Assert(encodeConfig(c, r), Equals, "[user]\n\tname = Foo\n"+
+		"[branch \"master\"]\n"+
+		"[branch \"dev\"]\n\tremote = origin\n\tmerge = refs/heads/dev\n")
+	c.Assert(r.Remotes, HasLen, 0)
+
+	cfg, err = r.Config()
+	c.Assert(err, IsNil)
+	_, ok := cfg.Value("branch", "master", "remote")
+	c.Assert(ok, Equals, false)
+
+	_, err = r.Reference("refs/remotes/foo/master", false)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+	_, err = r.Reference("refs/remotes/foo/bar/baz", false)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+	_, err = r.Reference("refs/remotes/foobar/master", false)
+	c.Assert(err, IsNil)
+
+	c.Assert(r.DeleteRemote("foo"), DeepEquals, &ErrRemoteNotFound{Name: "foo"})
+
+	r.Remotes["bar"] = &Remote{}
+	c.Assert(r.DeleteRemote("bar"), IsNil)
+	c.Assert(r.Remotes, HasLen, 0)
+}
+
+func (s *SuiteRemoteConfig) TestFetchConfigRefSpecs(c *C) {
+	r := NewPlainRepository()
+	_, err := r.CreateRemote(&RemoteConfig{
+		Name: "origin",
+		URLs: []string{"https://github.com/tyba/git-fixture.git"},
+		Fetch: []core.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/heads/master:refs/heads/mirror",
+		},
+	})
+	c.Assert(err, IsNil)
+	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
+
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+	for _, name := range []core.ReferenceName{"refs/remotes/origin/master", "refs/heads/mirror"} {
+		ref, err := r.Reference(name, false)
+		c.Assert(err, IsNil)
+		c.Assert(ref.Hash.String(), Equals, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	}
+}
+
+// endpointReceivePackService is a GitReceivePackService pushing to the
+// memoryReceivePackService of the endpoint it is connected to.
+type endpointReceivePackService struct {
+	services map[common.Endpoint]*memoryReceivePackService
+	current  *memoryReceivePackService
+}
+
+func (s *endpointReceivePackService) Connect(url common.Endpoint) error {
+	var ok bool
+	if s.current, ok = s.services[url]; !ok {
+		return fmt.Errorf("unknown endpoint %s", url)
+	}
+
+	return nil
+}
+
+func (s *endpointReceivePackService) ConnectWithAuth(url common.Endpoint, auth common.AuthMethod) error {
+	return s.Connect(url)
+}
+
+func (s *endpointReceivePackService) Info() (*common.GitReceivePackInfo, error) {
+	return s.current.Info()
+}
+
+func (s *endpointReceivePackService) SendPack(req *common.GitReceivePackRequest) (*common.ReportStatus, error) {
+	return s.current.SendPack(req)
+}
+
+func (s *SuiteRemoteConfig) TestPushURLs(c *C) {
+	r := NewPlainRepository()
+	r.Remotes["bundle"] = NewBundleRemote(fullBundle)
+	c.Assert(r.Fetch(&FetchOptions{RemoteName: "bundle", RefSpecs: bundleRefSpecs}), IsNil)
+	c.Assert(r.DeleteRemote("bundle"), IsNil)
+
+	urls := []string{"https://github.com/src-d/one.git", "https://github.com/src-d/two.git"}
+	srv := &endpointReceivePackService{services: map[common.Endpoint]*memoryReceivePackService{
+		common.Endpoint(urls[0]): newMemoryReceivePackService(),
+		common.Endpoint(urls[1]): newMemoryReceivePackService(),
+	}}
+
+	clients.InstallReceivePackProtocol("https", srv)
+	defer clients.InstallReceivePackProtocol("https", clients.DefaultReceivePackProtocols["https"])
+
+	_, err := r.CreateRemote(&RemoteConfig{Name: "origin", URLs: urls})
+	c.Assert(err, IsNil)
+
+	opts := &PushOptions{RefSpecs: []core.RefSpec{"refs/heads/master:refs/heads/master"}}
+	c.Assert(r.Push(opts), IsNil)
+	for _, srv := range srv.services {
+		ref, err := srv.r.Reference("refs/heads/master", false)
+		c.Assert(err, IsNil)
+		c.Assert(ref.Hash.String(), Equals, bundleMaster)
+	}
+
+	c.Assert(r.Push(opts), Equals, NoErrAlreadyUpToDate)
+}
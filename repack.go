@@ -0,0 +1,73 @@
+package git
+
+import (
+	"errors"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+)
+
+// ErrRepackNotSupported is returned by Repack when the storage of the
+// repository does not keep its objects in packfiles, see repacker.
+var ErrRepackNotSupported = errors.New("object storage cannot repack objects")
+
+// RepackOptions are the options of Repack.
+type RepackOptions struct {
+	// EncoderOptions are the options the new packfile is written with, the
+	// objects are stored as deltas when their Window and Depth are not
+	// zero, as they are in packfile.DefaultEncoderOptions.
+	EncoderOptions packfile.EncoderOptions
+}
+
+// RepackStats are the statistics of a Repack.
+type RepackStats struct {
+	// Objects is the number of objects of the new packfile.
+	Objects int
+	// SizeBefore and SizeAfter are the sizes in bytes of the loose objects,
+	// the packfiles and their idx files before and after the repack.
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Repack writes every object of the storage to a single new packfile, and
+// removes the loose objects and the packfiles it supersedes, see
+// RepackObjects.
+func (r *Repository) Repack(opts RepackOptions) error {
+	_, err := r.RepackObjects(opts)
+	return err
+}
+
+// RepackObjects writes every object of the storage to a single new
+// packfile, along with its idx file, and then removes the loose objects and
+// the old packfiles, as git repack -a -d does, returning the statistics of
+// the repack. The objects are not removed until the new packfile is
+// complete, so an interrupted repack never loses objects.
+// ErrRepackNotSupported is returned if the storage does not keep its
+// objects in packfiles.
+func (r *Repository) RepackObjects(opts RepackOptions) (*RepackStats, error) {
+	rp, ok := r.Storage.(repacker)
+	if !ok {
+		return nil, ErrRepackNotSupported
+	}
+
+	hashes, err := core.HashesWithPrefix(r.Storage, "")
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := rp.Repack(hashes, opts.EncoderOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*RepackStats)(stats), nil
+}
+
+// repacker is implemented by the ObjectStorages that keep their objects in
+// packfiles, like filesystem.ObjectStorage.
+type repacker interface {
+	// Repack writes the objects with the given hashes to a new packfile
+	// and removes the loose objects and the packfiles it supersedes.
+	Repack(hashes []core.Hash, opts packfile.EncoderOptions) (*filesystem.RepackStats, error)
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRepack struct{}
+
+var _ = Suite(&SuiteRepack{})
+
+func (s *SuiteRepack) TestRepack(c *C) {
+	dir, err := ioutil.TempDir("", "repack")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	r, err := NewFilesystemRepository(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+
+	packed := newTestBlob(c, r, "packed")
+	_, err = r.Storage.(*filesystem.ObjectStorage).WritePack([]core.Hash{packed}, packfile.DefaultEncoderOptions)
+	c.Assert(err, IsNil)
+	unreachable := pruneFixture(c, r)
+
+	hashes, err := core.HashesWithPrefix(r.Storage, "")
+	c.Assert(err, IsNil)
+
+	stats, err := r.RepackObjects(RepackOptions{EncoderOptions: packfile.DefaultEncoderOptions})
+	c.Assert(err, IsNil)
+	c.Assert(stats.Objects, Equals, len(hashes))
+	c.Assert(stats.SizeAfter > 0, Equals, true)
+
+	loose, err := filepath.Glob(filepath.Join(dir, "objects", "??", "*"))
+	c.Assert(err, IsNil)
+	c.Assert(loose, HasLen, 0)
+
+	packs, err := filepath.Glob(filepath.Join(dir, "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+
+	// the unreachable objects are repacked too, prune deletes them
+	for _, h := range append(unreachable, packed) {
+		_, err := r.Storage.Get(h)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(r.Repack(RepackOptions{}), IsNil)
+	packs, err = filepath.Glob(filepath.Join(dir, "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+}
+
+func (s *SuiteRepack) TestRepackNotSupported(c *C) {
+	r := NewPlainRepository()
+	newTestBlob(c, r, "foo")
+
+	c.Assert(r.Repack(RepackOptions{}), Equals, ErrRepackNotSupported)
+}
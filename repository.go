@@ -1,12 +1,16 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"gopkg.in/src-d/go-git.v3/clients/common"
 	"gopkg.in/src-d/go-git.v3/core"
-	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
 	"gopkg.in/src-d/go-git.v3/storage/memory"
 	"gopkg.in/src-d/go-git.v3/storage/seekable"
 	"gopkg.in/src-d/go-git.v3/utils/fs"
@@ -15,8 +19,25 @@ import (
 var (
 	// ErrObjectNotFound object not found
 	ErrObjectNotFound = errors.New("object not found")
+	// ErrTagExists is returned by CreateTag when the tag already exists and
+	// it is not forced.
+	ErrTagExists = errors.New("tag already exists")
 )
 
+// EmptyTreeHash is the hash of the tree without entries. Git resolves it
+// even if it is not stored, and so does Repository.
+var EmptyTreeHash = core.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+
+// emptyTreeHashSHA256 is the hash of the tree without entries in the
+// repositories of the core.SHA256 format.
+var emptyTreeHashSHA256 = core.SHA256.ComputeHash(core.TreeObject, nil)
+
+// isEmptyTree returns true if h is the hash of the tree without entries, in
+// any format.
+func isEmptyTree(h core.Hash) bool {
+	return h == EmptyTreeHash || h == emptyTreeHashSHA256
+}
+
 const (
 	// DefaultRemoteName name of the default Remote, just like git command
 	DefaultRemoteName = "origin"
@@ -24,8 +45,19 @@ const (
 
 // Repository git repository struct
 type Repository struct {
-	Remotes map[string]*Remote
-	Storage core.ObjectStorage
+	Remotes    map[string]*Remote
+	Storage    core.ObjectStorage
+	References core.ReferenceStorage
+	Reflogs    core.ReflogStorage
+	// Shallows are the shallow commits of the repository, the ones whose
+	// parents were not fetched. A nil ShallowStorage has none.
+	Shallows core.ShallowStorage
+	// Configs is the storage of the config of the repository, see Config.
+	// A nil ConfigStorage has an empty config.
+	Configs core.ConfigStorage
+	// Indexes is the storage of the index of the repository, see Index. A
+	// nil IndexStorage has an empty index.
+	Indexes IndexStorage
 }
 
 // NewRepository creates a new repository setting remote as default remote
@@ -51,60 +83,160 @@ func NewRepository(url string, auth common.AuthMethod) (*Repository, error) {
 // memory.
 //
 // To be able to use git repositories this way, you must run "git gc" on
-// them beforehand.
+// them beforehand. The storage is read only, see NewFilesystemRepository for
+// a repository whose objects can be written, repacked and pruned.
 func NewRepositoryFromFS(fs fs.FS, path string) (*Repository, error) {
 	repo := NewPlainRepository()
 
 	var err error
 	repo.Storage, err = seekable.New(fs, path)
+	repo.References = filesystem.NewReferenceStorage(fs, path)
+	repo.Reflogs = filesystem.NewReflogStorage(fs, path)
+	repo.Shallows = filesystem.NewShallowStorage(fs, path)
+	repo.Configs = filesystem.NewConfigStorage(fs, path)
+	repo.Indexes = filesystem.NewIndexStorage(fs, path)
 
 	return repo, err
 }
 
+// NewFilesystemRepository returns the repository of the git directory at
+// the given path, as git reads and writes it, see filesystem.New: its loose
+// objects and packfiles, references, reflogs, shallow commits, config and
+// index. Unlike the ones of NewRepositoryFromFS, its objects can be written,
+// as loose objects or packfiles, so the operations needing a
+// filesystem.ObjectStorage, as Repack, Prune and WriteCommitGraph,
+// are supported. filesystem.ErrNotFound is returned if the directory does
+// not exist.
+func NewFilesystemRepository(fs fs.FS, path string) (*Repository, error) {
+	sto, err := filesystem.New(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := NewPlainRepository()
+	repo.Storage = sto.ObjectStorage()
+	repo.References = sto.ReferenceStorage()
+	repo.Reflogs = sto.ReflogStorage()
+	repo.Shallows = sto.ShallowStorage()
+	repo.Configs = sto.ConfigStorage()
+	repo.Indexes = sto.IndexStorage()
+
+	return repo, nil
+}
+
 // NewPlainRepository creates a new repository without remotes
 func NewPlainRepository() *Repository {
 	return &Repository{
-		Remotes: map[string]*Remote{},
-		Storage: memory.NewObjectStorage(),
+		Remotes:    map[string]*Remote{},
+		Storage:    memory.NewObjectStorage(),
+		References: memory.NewReferenceStorage(),
+		Reflogs:    memory.NewReflogStorage(),
+		Shallows:   memory.NewShallowStorage(),
+		Configs:    memory.NewConfigStorage(),
+		Indexes:    memory.NewIndexStorage(),
 	}
 }
 
-// Pull connect and fetch the given branch from the given remote, the branch
-// should be provided with the full path not only the abbreviation, eg.:
-// "refs/heads/master"
-func (r *Repository) Pull(remoteName, branch string) (err error) {
-	remote, ok := r.Remotes[remoteName]
-	if !ok {
-		return fmt.Errorf("unable to find remote %q", remoteName)
+// PullOptions are the options of PullWithOptions.
+type PullOptions struct {
+	// RemoteName is the name of the remote, DefaultRemoteName if empty, see
+	// Repository.Remote.
+	RemoteName string
+	// ReferenceName is the full name of the branch fetched if SingleBranch
+	// is true, eg.: "refs/heads/master", the default branch of the remote if
+	// empty.
+	ReferenceName string
+	// SingleBranch fetches only the branch ReferenceName, instead of all the
+	// branches of the remote, if there are no RefSpecs.
+	SingleBranch bool
+	// RefSpecs are the references fetched and where they are stored. They
+	// are the ones of FetchOptions.RefSpecs if empty, or the refspec of
+	// ReferenceName if SingleBranch is true.
+	RefSpecs []core.RefSpec
+	// Depth limits the history fetched to the given number of commits, the
+	// commits at the limit are recorded as shallow, see Repository.Shallows.
+	// Pulling again with a greater depth deepens the history. The whole
+	// history is fetched if it is zero.
+	Depth int
+	// Committer is the signature of the entries appended to the reflogs of
+	// the references updated, at the current time if its When is zero.
+	Committer Signature
+	// Progress, if not nil, receives the progress messages the remote
+	// sends in the second side-band channel, "Counting objects: ...", as
+	// they arrive, and the progress of the indexing of the objects
+	// fetched. The messages are dropped while it is busy, so a slow writer
+	// does not slow down the fetch.
+	Progress io.Writer
+}
+
+// refSpecs returns the RefSpecs of the options, or the default ones, for a
+// remote.
+func (o *PullOptions) refSpecs(remoteName string, remote *Remote) []core.RefSpec {
+	if len(o.RefSpecs) != 0 {
+		return o.RefSpecs
 	}
 
-	if err = remote.Connect(); err != nil {
-		return err
+	if !o.SingleBranch {
+		return remote.fetchRefSpecs(remoteName)
 	}
 
+	branch := o.ReferenceName
 	if branch == "" {
 		branch = remote.DefaultBranch()
 	}
 
-	ref, err := remote.Ref(branch)
-	if err != nil {
-		return err
+	dst := branch
+	if strings.HasPrefix(branch, "refs/heads/") {
+		dst = fmt.Sprintf("refs/remotes/%s/%s", remoteName, strings.TrimPrefix(branch, "refs/heads/"))
 	}
 
-	req := &common.GitUploadPackRequest{}
-	req.Want(ref)
+	return []core.RefSpec{core.RefSpec(fmt.Sprintf("+%s:%s", branch, dst))}
+}
 
-	// TODO: Provide "haves" for what's already in the repository's storage
+// Pull connect and fetch the given branch from the given remote, the branch
+// should be provided with the full path not only the abbreviation, eg.:
+// "refs/heads/master". It is stored as a remote branch, eg.:
+// "refs/remotes/origin/master".
+func (r *Repository) Pull(remoteName, branch string) (err error) {
+	return r.PullWithOptions(&PullOptions{
+		RemoteName:    remoteName,
+		ReferenceName: branch,
+		SingleBranch:  true,
+	})
+}
 
-	reader, err := remote.Fetch(req)
+// PullWithOptions is like Pull, with the given options, it fetches the
+// references of the refspecs as Fetch does, returning nil instead of
+// NoErrAlreadyUpToDate.
+func (r *Repository) PullWithOptions(opts *PullOptions) error {
+	return r.PullContext(context.Background(), opts)
+}
+
+// PullContext is like PullWithOptions, canceling the requests to the remote
+// when ctx is done, see FetchUpdatesContext. A repository is cloned pulling
+// from the remote of NewRepository, so the clone can be canceled too.
+func (r *Repository) PullContext(ctx context.Context, opts *PullOptions) error {
+	remoteName := opts.RemoteName
+	if remoteName == "" {
+		remoteName = DefaultRemoteName
+	}
+
+	remote, err := r.Remote(remoteName)
 	if err != nil {
 		return err
 	}
-	defer checkClose(reader, &err)
-	stream := packfile.NewStream(reader)
 
-	d := packfile.NewDecoder(stream)
-	err = d.Decode(r.Storage)
+	if err := remote.ConnectContext(ctx); err != nil {
+		return err
+	}
+
+	_, err = r.fetch(ctx, remote, opts.refSpecs(remoteName, remote), opts.Depth, opts.Progress, reflogUpdate{
+		committer: opts.Committer,
+		action:    "pull " + remoteName,
+	})
+	if err == NoErrAlreadyUpToDate {
+		return nil
+	}
 
 	return err
 }
@@ -138,9 +270,9 @@ func (r *Repository) Commits() (*CommitIter, error) {
 	return NewCommitIter(r, iter), nil
 }
 
-// Tree return the tree with the given hash
+// Tree return the tree with the given hash, EmptyTreeHash is always found.
 func (r *Repository) Tree(h core.Hash) (*Tree, error) {
-	obj, err := r.Storage.Get(h)
+	obj, err := r.getObject(h)
 	if err != nil {
 		if err == core.ErrObjectNotFound {
 			return nil, ErrObjectNotFound
@@ -152,6 +284,62 @@ func (r *Repository) Tree(h core.Hash) (*Tree, error) {
 	return tree, tree.Decode(obj)
 }
 
+// CommitObject returns the commit with the given hash, as Commit does, but a
+// *ErrObjectTypeMismatch is returned if the object is not a commit.
+func (r *Repository) CommitObject(h core.Hash) (*Commit, error) {
+	obj, err := r.typedObject(h, core.CommitObject)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := &Commit{r: r}
+	return commit, commit.Decode(obj)
+}
+
+// TreeObject returns the tree with the given hash, as Tree does, but a
+// *ErrObjectTypeMismatch is returned if the object is not a tree.
+func (r *Repository) TreeObject(h core.Hash) (*Tree, error) {
+	obj, err := r.typedObject(h, core.TreeObject)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{r: r}
+	return tree, tree.Decode(obj)
+}
+
+// Trees returns a TreeObjectIter for all the trees of the storage.
+func (r *Repository) Trees() (*TreeObjectIter, error) {
+	iter, err := r.Storage.Iter(core.TreeObject)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTreeObjectIter(r, iter), nil
+}
+
+// BlobObject returns the blob with the given hash, as Blob does, but a
+// *ErrObjectTypeMismatch is returned if the object is not a blob.
+func (r *Repository) BlobObject(h core.Hash) (*Blob, error) {
+	obj, err := r.typedObject(h, core.BlobObject)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &Blob{}
+	return blob, blob.Decode(obj)
+}
+
+// Blobs returns a BlobIter for all the blobs of the storage.
+func (r *Repository) Blobs() (*BlobIter, error) {
+	iter, err := r.Storage.Iter(core.BlobObject)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlobIter(iter), nil
+}
+
 // Blob returns the blob with the given hash
 func (r *Repository) Blob(h core.Hash) (*Blob, error) {
 	obj, err := r.Storage.Get(h)
@@ -166,13 +354,35 @@ func (r *Repository) Blob(h core.Hash) (*Blob, error) {
 	return blob, blob.Decode(obj)
 }
 
-// Tag returns a tag with the given hash.
-func (r *Repository) Tag(h core.Hash) (*Tag, error) {
-	obj, err := r.Storage.Get(h)
+// Tag returns the object the tag with the given name, refs/tags/<name>,
+// points to: the Tag object of an annotated tag, or the commit it tags,
+// following the tags of tags, if peel is true, see Tag.Commit; and the
+// object tagged by a lightweight tag. core.ErrReferenceNotFound is returned
+// if there is no such tag.
+func (r *Repository) Tag(name string, peel bool) (Object, error) {
+	ref, err := r.Reference(core.ReferenceName("refs/tags/"+name), true)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := r.Object(ref.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag, ok := obj.(*Tag); ok && peel {
+		return tag.Commit()
+	}
+
+	return obj, nil
+}
+
+// TagObject returns the annotated tag object with the given hash, see Tag
+// for the tags by name. A *ErrObjectTypeMismatch is returned if the object
+// is not a tag.
+func (r *Repository) TagObject(h core.Hash) (*Tag, error) {
+	obj, err := r.typedObject(h, core.TagObject)
 	if err != nil {
-		if err == core.ErrObjectNotFound {
-			return nil, ErrObjectNotFound
-		}
 		return nil, err
 	}
 
@@ -180,20 +390,49 @@ func (r *Repository) Tag(h core.Hash) (*Tag, error) {
 	return t, t.Decode(obj)
 }
 
-// Tags returns a TagIter that can step through all of the annotated tags
-// in the repository.
-func (r *Repository) Tags() (*TagIter, error) {
+// TagObjects returns a TagObjectIter that can step through all of the
+// annotated tags in the repository, the tag objects, see Tags for the tag
+// references.
+func (r *Repository) TagObjects() (*TagObjectIter, error) {
 	iter, err := r.Storage.Iter(core.TagObject)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewTagObjectIter(r, iter), nil
+}
+
+// Branches returns a ReferenceIter for the branches of the repository, the
+// references under refs/heads/, sorted by name.
+func (r *Repository) Branches() (*ReferenceIter, error) {
+	return r.referencesPrefix("refs/heads/")
+}
+
+// Tags returns a TagIter for the tags of the repository, lightweight and
+// annotated, the references under refs/tags/, sorted by name, along with
+// their tag objects and the commits tagged.
+func (r *Repository) Tags() (*TagIter, error) {
+	iter, err := core.IterReferencesPrefix(r.References, "refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+
 	return NewTagIter(r, iter), nil
 }
 
-// Object returns an object with the given hash.
+func (r *Repository) referencesPrefix(prefix string) (*ReferenceIter, error) {
+	iter, err := core.IterReferencesPrefix(r.References, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReferenceIter(r, iter), nil
+}
+
+// Object returns an object with the given hash, EmptyTreeHash is always
+// found.
 func (r *Repository) Object(h core.Hash) (Object, error) {
-	obj, err := r.Storage.Get(h)
+	obj, err := r.getObject(h)
 	if err != nil {
 		if err == core.ErrObjectNotFound {
 			return nil, ErrObjectNotFound
@@ -201,6 +440,68 @@ func (r *Repository) Object(h core.Hash) (Object, error) {
 		return nil, err
 	}
 
+	return r.decodeObject(obj)
+}
+
+// Objects returns an ObjectIter for all the objects of the storage, of every
+// type, decoded.
+func (r *Repository) Objects() (*ObjectIter, error) {
+	return NewObjectIter(r, r.Storage), nil
+}
+
+// typedObject returns the object with the given hash, see getObject, and a
+// *ErrObjectTypeMismatch if it is not of type t.
+func (r *Repository) typedObject(h core.Hash, t core.ObjectType) (core.Object, error) {
+	obj, err := r.getObject(h)
+	if err != nil {
+		if err == core.ErrObjectNotFound {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	if obj.Type() != t {
+		return nil, &ErrObjectTypeMismatch{Hash: h, Expected: t, Actual: obj.Type()}
+	}
+
+	return obj, nil
+}
+
+// objects returns the objects with the given hashes, in the same order,
+// reading them at once if the storage supports it, see core.GetMany. The
+// objects not found are nil, EmptyTreeHash is always found.
+func (r *Repository) objects(hs []core.Hash) ([]Object, error) {
+	objs, err := core.GetMany(r.Storage, hs)
+	var missing map[int]error
+	if e, ok := err.(*core.GetManyError); ok {
+		missing = e.Errors
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := make([]Object, len(hs))
+	for i, obj := range objs {
+		if err, ok := missing[i]; ok {
+			if err != core.ErrObjectNotFound {
+				return nil, err
+			}
+
+			if !isEmptyTree(hs[i]) {
+				continue
+			}
+
+			obj = memory.NewObjectWithFormat(hs[i].Format(), core.TreeObject, 0, nil)
+		}
+
+		if result[i], err = r.decodeObject(obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (r *Repository) decodeObject(obj core.Object) (Object, error) {
 	switch obj.Type() {
 	case core.CommitObject:
 		commit := &Commit{r: r}
@@ -219,31 +520,167 @@ func (r *Repository) Object(h core.Hash) (Object, error) {
 	}
 }
 
-// Head returns the hash of the HEAD of the repository or the head of a
-// remote, if one is passed.
-func (r *Repository) Head(remote string) (core.Hash, error) {
-	if remote == "" {
-		return r.localHead()
+// ObjectFormat returns the format of the hashes of the objects of the
+// repository, the one of its Storage, see core.ObjectStorageFormat.
+func (r *Repository) ObjectFormat() core.ObjectFormat {
+	return core.ObjectStorageFormat(r.Storage)
+}
+
+// newObject returns an empty object to encode the objects written to the
+// storage, whose hash is computed in the format of the repository.
+func (r *Repository) newObject() *memory.Object {
+	o := &memory.Object{}
+	o.SetFormat(r.ObjectFormat())
+	return o
+}
+
+// getObject returns the object with the given hash from the storage, or an
+// empty tree object for EmptyTreeHash, or the one of its format, if the
+// storage does not have it.
+func (r *Repository) getObject(h core.Hash) (core.Object, error) {
+	obj, err := r.Storage.Get(h)
+	if err == core.ErrObjectNotFound && isEmptyTree(h) {
+		return memory.NewObjectWithFormat(h.Format(), core.TreeObject, 0, nil), nil
+	}
+
+	return obj, err
+}
+
+// hasObject reports whether the storage has the object with the given hash,
+// without reading it if the storage supports it, see core.HasObject.
+func (r *Repository) hasObject(h core.Hash) (bool, error) {
+	if isEmptyTree(h) {
+		return true, nil
+	}
+
+	return core.HasObject(r.Storage, h)
+}
+
+// DeleteTag removes the tag with the given name, refs/tags/<name>,
+// core.ErrReferenceNotFound is returned if there is no such tag. The tag
+// object of an annotated tag is kept in the storage.
+func (r *Repository) DeleteTag(name string) error {
+	return r.References.Remove(core.ReferenceName("refs/tags/" + name))
+}
+
+// CreateTagOptions are the options of an annotated tag created by CreateTag.
+type CreateTagOptions struct {
+	// Tagger is the signature of the tagger.
+	Tagger Signature
+	// Message is the message of the tag, a new line is appended if it does
+	// not end with one, as git does.
+	Message string
+	// Force replaces the tag if it already exists.
+	Force bool
+}
+
+// committer returns the signature of the reflog entry of the tag, the one of
+// the tagger at the current time if its When is zero.
+func (o *CreateTagOptions) committer() Signature {
+	var s Signature
+	if o != nil {
+		s = o.Tagger
+	}
+
+	if s.When.IsZero() {
+		s.When = time.Now()
+	}
+
+	return s
+}
+
+// annotated reports whether the options are the ones of an annotated tag.
+func (o *CreateTagOptions) annotated() bool {
+	return o != nil && (o.Message != "" || o.Tagger != Signature{})
+}
+
+// CreateTag creates the tag with the given name, refs/tags/<name>, for the
+// object with the given hash, and returns its reference. With nil options,
+// or options without a tagger nor a message, a lightweight tag is created,
+// the reference points to the object; otherwise a Tag object is encoded and
+// stored, and the reference points to it.
+//
+// core.ErrInvalidReferenceName is returned if the name is not valid, see
+// core.ReferenceName.Valid, ErrObjectNotFound if the object is not in the
+// repository, and ErrTagExists if the tag already exists, unless the options
+// force it.
+func (r *Repository) CreateTag(name string, target core.Hash, opts *CreateTagOptions) (*core.Reference, error) {
+	n := core.ReferenceName("refs/tags/" + name)
+	if !n.Valid() {
+		return nil, core.ErrInvalidReferenceName
 	}
 
-	return r.remoteHead(remote)
+	obj, err := r.Object(target)
+	if err != nil {
+		return nil, err
+	}
+
+	h := target
+	if opts.annotated() {
+		if h, err = r.storeTag(name, obj, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var old *core.Reference
+	if opts != nil && opts.Force {
+		old, err = r.References.Get(n)
+		if err != nil && err != core.ErrReferenceNotFound {
+			return nil, err
+		}
+	}
+
+	ref := core.NewHashReference(n, h)
+	err = r.UpdateReference(ref, old, opts.committer(), fmt.Sprintf("tag: tagging %s", target))
+	if err == core.ErrReferenceHasChanged && old == nil {
+		return nil, ErrTagExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ref, nil
 }
 
-func (r *Repository) remoteHead(remote string) (core.Hash, error) {
-	rem, ok := r.Remotes[remote]
-	if !ok {
-		return core.ZeroHash, fmt.Errorf("unable to find remote %q", remote)
+// storeTag encodes and stores the Tag object of an annotated tag of obj,
+// returning its hash.
+func (r *Repository) storeTag(name string, obj Object, opts *CreateTagOptions) (core.Hash, error) {
+	tag := &Tag{
+		Name:       name,
+		Tagger:     opts.Tagger,
+		Message:    opts.Message,
+		TargetType: obj.Type(),
+		Target:     obj.ID(),
 	}
 
-	return rem.Head()
+	if tag.Message != "" && !strings.HasSuffix(tag.Message, "\n") {
+		tag.Message += "\n"
+	}
+
+	o := r.newObject()
+	if err := tag.Encode(o); err != nil {
+		return core.ZeroHash, err
+	}
+
+	return r.Storage.Set(o)
 }
 
-func (r *Repository) localHead() (core.Hash, error) {
-	storage, ok := r.Storage.(*seekable.ObjectStorage)
-	if !ok {
-		return core.ZeroHash,
-			fmt.Errorf("cannot retrieve local head: no local data found")
+// Reference returns the reference with the given name. If resolve is true
+// the symbolic references are followed, see core.ResolveReference, and the
+// hash reference at the end of the chain is returned.
+func (r *Repository) Reference(name core.ReferenceName, resolve bool) (*core.Reference, error) {
+	if !resolve {
+		return r.References.Get(name)
 	}
 
-	return storage.Head()
+	return core.ResolveReference(r.References, name)
+}
+
+// Head returns the reference HEAD points to, resolved: the branch checked out
+// or, if HEAD is detached, the HEAD hash reference itself, so the name of the
+// reference returned is core.HEAD only for a detached HEAD. The head of a
+// remote is returned by its Head method.
+func (r *Repository) Head() (*core.Reference, error) {
+	return r.Reference(core.HEAD, true)
 }
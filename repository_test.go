@@ -2,10 +2,16 @@ package git
 
 import (
 	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
 	"os"
 
+	"gopkg.in/src-d/go-git.v3/clients/common"
 	"gopkg.in/src-d/go-git.v3/clients/http"
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
 	"gopkg.in/src-d/go-git.v3/storage/seekable"
 	"gopkg.in/src-d/go-git.v3/utils/fs"
 
@@ -75,6 +81,35 @@ func (s *SuiteRepository) TestNewRepositoryWithAuth(c *C) {
 	c.Assert(r.Remotes["origin"].Auth, Equals, auth)
 }
 
+// the plain HTTP servers are reached over http, not https
+func (s *SuiteRepository) TestNewRepositoryHTTP(c *C) {
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		if req.URL.Path != "/repo.git/info/refs" || req.URL.Query().Get("service") != "git-upload-pack" {
+			nethttp.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		f, err := os.Open("fixtures/upload-pack/info-refs")
+		c.Assert(err, IsNil)
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		c.Assert(err, IsNil)
+	}))
+	defer srv.Close()
+
+	r, err := NewRepository(srv.URL+"/repo", nil)
+	c.Assert(err, IsNil)
+
+	remote := r.Remotes[DefaultRemoteName]
+	c.Assert(remote.Endpoint, Equals, common.Endpoint(srv.URL+"/repo.git"))
+	c.Assert(remote.Connect(), IsNil)
+
+	head, err := remote.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head, Equals, core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763"))
+}
+
 func (s *SuiteRepository) TestNewRepositoryFromFS(c *C) {
 	for name, fix := range s.dirFixtures {
 		fs := fs.NewOS()
@@ -83,14 +118,37 @@ func (s *SuiteRepository) TestNewRepositoryFromFS(c *C) {
 		repo, err := NewRepositoryFromFS(fs, gitPath)
 		c.Assert(err, IsNil, com)
 
-		err = repo.PullDefault()
-		c.Assert(err, ErrorMatches, `unable to find remote "origin"`)
+		// the remotes are the ones of the config
+		remote, err := repo.Remote(DefaultRemoteName)
+		c.Assert(err, IsNil, com)
+		c.Assert(remote.Endpoint, Equals, common.Endpoint("https://github.com/alcortesm/binary-relations.git"), com)
 
 		c.Assert(repo.Storage, NotNil, com)
 		c.Assert(repo.Storage, FitsTypeOf, &seekable.ObjectStorage{}, com)
 	}
 }
 
+func (s *SuiteRepository) TestNewFilesystemRepository(c *C) {
+	for name, fix := range s.dirFixtures {
+		fs := fs.NewOS()
+		gitPath := fs.Join(fix.path, ".git")
+		com := Commentf("dir fixture %q → %q\n", name, gitPath)
+		repo, err := NewFilesystemRepository(fs, gitPath)
+		c.Assert(err, IsNil, com)
+		c.Assert(repo.Storage, FitsTypeOf, &filesystem.ObjectStorage{}, com)
+
+		head, err := repo.Head()
+		c.Assert(err, IsNil, com)
+		c.Assert(head.Hash, Equals, fix.head, com)
+
+		_, err = repo.Commit(head.Hash)
+		c.Assert(err, IsNil, com)
+	}
+
+	_, err := NewFilesystemRepository(fs.NewOS(), "/does/not/exist")
+	c.Assert(err, Equals, filesystem.ErrNotFound)
+}
+
 func (s *SuiteRepository) TestPull(c *C) {
 	r, err := NewRepository(RepositoryFixture, nil)
 	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
@@ -118,6 +176,145 @@ func (s *SuiteRepository) TestPullDefault(c *C) {
 	c.Assert(err, Not(IsNil), Commentf("pull leaks an open fd from the fetch"))
 }
 
+// refsUploadPackService is a MockGitUploadPackService advertising several
+// references of the git-fixture repository, recording the requests fetched.
+type refsUploadPackService struct {
+	MockGitUploadPackService
+	requests []*common.GitUploadPackRequest
+}
+
+func (s *refsUploadPackService) Info() (*common.GitUploadPackInfo, error) {
+	info, err := s.MockGitUploadPackService.Info()
+	if err != nil {
+		return nil, err
+	}
+
+	info.Refs["refs/heads/branch"] = core.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")
+	info.Refs["refs/tags/v1.0"] = core.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	info.Refs["refs/tags/v1.0^{}"] = core.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	return info, nil
+}
+
+func (s *refsUploadPackService) Fetch(req *common.GitUploadPackRequest) (io.ReadCloser, error) {
+	s.requests = append(s.requests, req)
+	return s.MockGitUploadPackService.Fetch(req)
+}
+
+func (s *SuiteRepository) TestPullRefSpecs(c *C) {
+	master := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := core.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")
+	tag := core.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	for _, t := range []struct {
+		opts     *PullOptions
+		wants    []core.Hash
+		expected map[core.ReferenceName]core.Hash
+	}{
+		{
+			&PullOptions{},
+			[]core.Hash{branch, master},
+			map[core.ReferenceName]core.Hash{
+				"refs/remotes/origin/branch": branch,
+				"refs/remotes/origin/master": master,
+			},
+		},
+		{
+			&PullOptions{SingleBranch: true},
+			[]core.Hash{master},
+			map[core.ReferenceName]core.Hash{"refs/remotes/origin/master": master},
+		},
+		{
+			&PullOptions{SingleBranch: true, ReferenceName: "refs/heads/branch"},
+			[]core.Hash{branch},
+			map[core.ReferenceName]core.Hash{"refs/remotes/origin/branch": branch},
+		},
+		{
+			&PullOptions{SingleBranch: true, ReferenceName: "refs/tags/v1.0"},
+			[]core.Hash{tag},
+			map[core.ReferenceName]core.Hash{"refs/tags/v1.0": tag},
+		},
+		{
+			&PullOptions{RefSpecs: []core.RefSpec{"refs/tags/*:refs/tags/*", "refs/heads/branch:refs/heads/mine"}},
+			[]core.Hash{branch, tag},
+			map[core.ReferenceName]core.Hash{"refs/heads/mine": branch, "refs/tags/v1.0": tag},
+		},
+		{
+			&PullOptions{RefSpecs: []core.RefSpec{"refs/heads/master:"}},
+			[]core.Hash{master},
+			map[core.ReferenceName]core.Hash{},
+		},
+	} {
+		r := NewPlainRepository()
+		srv := &refsUploadPackService{}
+		r.Remotes[DefaultRemoteName] = &Remote{upSrv: srv}
+
+		c.Assert(r.PullWithOptions(t.opts), IsNil)
+		c.Assert(srv.requests, HasLen, 1)
+		c.Assert(srv.requests[0].Wants, DeepEquals, t.wants, Commentf("opts=%+v", t.opts))
+
+		refs := make(map[core.ReferenceName]core.Hash)
+		iter, err := r.References.Iter()
+		c.Assert(err, IsNil)
+		for {
+			ref, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+
+			c.Assert(err, IsNil)
+			refs[ref.Name] = ref.Hash
+		}
+		c.Assert(refs, DeepEquals, t.expected, Commentf("opts=%+v", t.opts))
+
+		// the objects are not requested again
+		c.Assert(r.PullWithOptions(t.opts), IsNil)
+		c.Assert(srv.requests, HasLen, 1)
+	}
+}
+
+func (s *SuiteRepository) TestPullNonFastForward(c *C) {
+	master := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := core.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")
+	initial := core.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d")
+
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: &refsUploadPackService{}}
+	c.Assert(r.PullWithOptions(&PullOptions{}), IsNil)
+
+	// branch is an ancestor of master and a descendant of initial
+	c.Assert(r.References.Set(core.NewHashReference("refs/heads/foo", master)), IsNil)
+	c.Assert(r.References.Set(core.NewHashReference("refs/heads/bar", initial)), IsNil)
+	err := r.PullWithOptions(&PullOptions{RefSpecs: []core.RefSpec{
+		"refs/heads/branch:refs/heads/foo",
+		"refs/heads/branch:refs/heads/bar",
+	}})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+
+	ref, err := r.References.Get("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, master)
+	ref, err = r.References.Get("refs/heads/bar")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, branch)
+
+	err = r.PullWithOptions(&PullOptions{RefSpecs: []core.RefSpec{"+refs/heads/branch:refs/heads/foo"}})
+	c.Assert(err, IsNil)
+	ref, err = r.References.Get("refs/heads/foo")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, branch)
+}
+
+func (s *SuiteRepository) TestPullRefSpecErrors(c *C) {
+	r := NewPlainRepository()
+	r.Remotes[DefaultRemoteName] = &Remote{upSrv: &refsUploadPackService{}}
+
+	err := r.PullWithOptions(&PullOptions{RefSpecs: []core.RefSpec{"refs/heads/master"}})
+	c.Assert(err, Equals, core.ErrRefSpecMalformedSeparator)
+
+	err = r.PullWithOptions(&PullOptions{RefSpecs: []core.RefSpec{"refs/heads/foo:refs/heads/foo"}})
+	c.Assert(err, ErrorMatches, `unable to find ref "refs/heads/foo"`)
+}
+
 func (s *SuiteRepository) TestCommit(c *C) {
 	r, err := NewRepository(RepositoryFixture, nil)
 	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
@@ -133,7 +330,9 @@ func (s *SuiteRepository) TestCommit(c *C) {
 	c.Assert(commit.Hash, Equals, commit.ID())
 	c.Assert(commit.Hash, Equals, hash)
 	c.Assert(commit.Type(), Equals, core.CommitObject)
-	c.Assert(commit.Tree().Hash.IsZero(), Equals, false)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	c.Assert(tree.Hash.IsZero(), Equals, false)
 	c.Assert(commit.Author.Email, Equals, "daniel@lordran.local")
 }
 
@@ -163,14 +362,98 @@ func (s *SuiteRepository) TestCommits(c *C) {
 	c.Assert(count, Equals, 8)
 }
 
-func (s *SuiteRepository) TestTag(c *C) {
+func (s *SuiteRepository) TestTypedObjects(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
+
+	c.Assert(err, IsNil)
+	c.Assert(r.Pull("origin", "refs/heads/master"), IsNil)
+
+	hash := core.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")
+	commit, err := r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Hash, Equals, hash)
+
+	tree, err := r.TreeObject(commit.TreeHash)
+	c.Assert(err, IsNil)
+	c.Assert(tree.Hash, Equals, commit.TreeHash)
+
+	blob, err := r.BlobObject(tree.Entries[0].Hash)
+	c.Assert(err, IsNil)
+	c.Assert(blob.Hash, Equals, tree.Entries[0].Hash)
+
+	tree, err = r.TreeObject(EmptyTreeHash)
+	c.Assert(err, IsNil)
+	c.Assert(tree.Entries, HasLen, 0)
+
+	_, err = r.TreeObject(hash)
+	c.Assert(err, DeepEquals, &ErrObjectTypeMismatch{Hash: hash, Expected: core.TreeObject, Actual: core.CommitObject})
+	c.Assert(err.Error(), Equals, "object b8e471f58bcbca63b07bda20e428190409c2db47 is a commit, not a tree")
+
+	_, err = r.TagObject(hash)
+	c.Assert(err, DeepEquals, &ErrObjectTypeMismatch{Hash: hash, Expected: core.TagObject, Actual: core.CommitObject})
+
+	_, err = r.BlobObject(core.NewHash("0000000000000000000000000000000000000001"))
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteRepository) TestObjectIters(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
+
+	c.Assert(err, IsNil)
+	c.Assert(r.Pull("origin", "refs/heads/master"), IsNil)
+
+	counts := make(map[core.ObjectType]int)
+	objects, err := r.Objects()
+	c.Assert(err, IsNil)
+	err = objects.ForEach(func(obj Object) error {
+		counts[obj.Type()]++
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(counts[core.CommitObject], Equals, 8)
+
+	trees, err := r.Trees()
+	c.Assert(err, IsNil)
+	count := 0
+	c.Assert(trees.ForEach(func(t *Tree) error {
+		count++
+		c.Assert(t.Hash.IsZero(), Equals, false)
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, counts[core.TreeObject])
+
+	blobs, err := r.Blobs()
+	c.Assert(err, IsNil)
+	count = 0
+	c.Assert(blobs.ForEach(func(b *Blob) error {
+		count++
+		c.Assert(b.Hash.IsZero(), Equals, false)
+		return nil
+	}), IsNil)
+	c.Assert(count, Equals, counts[core.BlobObject])
+	c.Assert(count > 0, Equals, true)
+
+	// the iteration is stopped with core.ErrStop
+	objects, err = r.Objects()
+	c.Assert(err, IsNil)
+	count = 0
+	c.Assert(objects.ForEach(func(obj Object) error {
+		count++
+		return core.ErrStop
+	}), IsNil)
+	c.Assert(count, Equals, 1)
+}
+
+func (s *SuiteRepository) TestTagObject(c *C) {
 	for i, t := range tagTests {
 		r, ok := s.repos[t.repo]
 		c.Assert(ok, Equals, true)
 		k := 0
 		for hashString, exp := range t.tags {
 			hash := core.NewHash(hashString)
-			tag, err := r.Tag(hash)
+			tag, err := r.TagObject(hash)
 			c.Assert(err, IsNil)
 			testTagExpected(c, tag, hash, exp, fmt.Sprintf("subtest %d, tag %d: ", i, k))
 			k++
@@ -178,13 +461,13 @@ func (s *SuiteRepository) TestTag(c *C) {
 	}
 }
 
-func (s *SuiteRepository) TestTags(c *C) {
+func (s *SuiteRepository) TestTagObjects(c *C) {
 	for i, t := range tagTests {
 		r, ok := s.repos[t.repo]
 		c.Assert(ok, Equals, true)
-		tagsIter, err := r.Tags()
+		tagsIter, err := r.TagObjects()
 		c.Assert(err, IsNil)
-		testTagIter(c, tagsIter, t.tags, fmt.Sprintf("subtest %d, ", i))
+		testTagObjectIter(c, tagsIter, t.tags, fmt.Sprintf("subtest %d, ", i))
 	}
 }
 
@@ -204,6 +487,120 @@ func (s *SuiteRepository) TestObject(c *C) {
 	}
 }
 
+func (s *SuiteRepository) TestObjects(c *C) {
+	for i, t := range treeWalkerTests {
+		r, ok := s.repos[t.repo]
+		c.Assert(ok, Equals, true)
+
+		hashes := []core.Hash{core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"), EmptyTreeHash}
+		for _, info := range t.objs {
+			hashes = append(hashes, core.NewHash(info.Hash))
+		}
+
+		objs, err := r.objects(hashes)
+		c.Assert(err, IsNil, Commentf("subtest %d", i))
+		c.Assert(objs, HasLen, len(hashes))
+		c.Assert(objs[0], IsNil)
+		c.Assert(objs[1].ID(), Equals, EmptyTreeHash)
+		for k, info := range t.objs {
+			com := Commentf("subtest %d, object %d", i, k)
+			c.Assert(objs[k+2].Type(), Equals, info.Kind, com)
+			c.Assert(objs[k+2].ID(), Equals, core.NewHash(info.Hash), com)
+		}
+	}
+}
+
+// the trees of a seekable storage are compared reading their entries at once
+func (s *SuiteRepository) TestDiffTreeFromFS(c *C) {
+	fix := s.dirFixtures["binrels"]
+	fs := fs.NewOS()
+	r, err := NewRepositoryFromFS(fs, fs.Join(fix.path, ".git/"))
+	c.Assert(err, IsNil)
+	serial := &Repository{Storage: serialStorage{r.Storage}}
+
+	commit, err := r.Commit(fix.head)
+	c.Assert(err, IsNil)
+	for commit.NumParents() != 0 {
+		parent, err := commit.Parents().Next()
+		c.Assert(err, IsNil)
+
+		changes, err := diffCommits(r, parent.Hash, commit.Hash)
+		c.Assert(err, IsNil)
+		expected, err := diffCommits(serial, parent.Hash, commit.Hash)
+		c.Assert(err, IsNil)
+		c.Assert(changes.String(), Equals, expected.String(), Commentf("commit=%s", commit.Hash))
+
+		commit = parent
+	}
+}
+
+func diffCommits(r *Repository, from, to core.Hash) (Changes, error) {
+	a, err := r.Commit(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := r.Commit(to)
+	if err != nil {
+		return nil, err
+	}
+
+	ta, err := a.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	tb, err := b.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffTree(ta, tb)
+}
+
+func (s *SuiteRepository) TestEmptyTree(c *C) {
+	r := NewPlainRepository()
+
+	tree, err := r.Tree(EmptyTreeHash)
+	c.Assert(err, IsNil)
+	c.Assert(tree.Hash, Equals, EmptyTreeHash)
+	c.Assert(tree.Entries, HasLen, 0)
+
+	obj, err := r.Object(EmptyTreeHash)
+	c.Assert(err, IsNil)
+	c.Assert(obj.ID(), Equals, EmptyTreeHash)
+	c.Assert(obj.Type(), Equals, core.TreeObject)
+
+	_, err = r.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	encoded := &memory.Object{}
+	c.Assert((&Tree{}).Encode(encoded), IsNil)
+	c.Assert(encoded.Hash(), Equals, EmptyTreeHash)
+}
+
+func (s *SuiteRepository) TestEmptyTreeDiff(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+
+	empty, err := r.Tree(EmptyTreeHash)
+	c.Assert(err, IsNil)
+	tree, err := r.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	changes, err := DiffTree(empty, tree)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 9)
+	for _, change := range changes {
+		c.Assert(change.Action, Equals, Insert)
+	}
+
+	// an entry pointing to the empty tree, not stored either
+	parent := newTestTree(c, r, TreeEntry{Name: "empty", Mode: 040000, Hash: EmptyTreeHash})
+	sub, err := parent.Tree("empty")
+	c.Assert(err, IsNil)
+	c.Assert(sub.Hash, Equals, EmptyTreeHash)
+}
+
 func (s *SuiteRepository) TestCommitIterClosePanic(c *C) {
 	r, err := NewRepository(RepositoryFixture, nil)
 	r.Remotes["origin"].upSrv = &MockGitUploadPackService{}
@@ -216,6 +613,27 @@ func (s *SuiteRepository) TestCommitIterClosePanic(c *C) {
 	commits.Close()
 }
 
+func (s *SuiteRepository) TestDeleteBranchAndTag(c *C) {
+	r := NewPlainRepository()
+	hash := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	for _, n := range []core.ReferenceName{"refs/heads/foo", "refs/tags/foo"} {
+		c.Assert(r.References.Set(core.NewHashReference(n, hash)), IsNil)
+	}
+
+	c.Assert(r.DeleteBranch("foo"), IsNil)
+	c.Assert(r.DeleteBranch("foo"), Equals, core.ErrReferenceNotFound)
+
+	ref, err := r.References.Get("refs/tags/foo")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, hash)
+
+	c.Assert(r.DeleteTag("foo"), IsNil)
+	c.Assert(r.DeleteTag("foo"), Equals, core.ErrReferenceNotFound)
+
+	_, err = r.References.Get("refs/tags/foo")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
 func (s *SuiteRepository) TestHeadFromFs(c *C) {
 	for name, fix := range s.dirFixtures {
 		fs := fs.NewOS()
@@ -224,44 +642,85 @@ func (s *SuiteRepository) TestHeadFromFs(c *C) {
 		repo, err := NewRepositoryFromFS(fs, gitPath)
 		c.Assert(err, IsNil, com)
 
-		head, err := repo.Head("")
+		head, err := repo.Head()
 		c.Assert(err, IsNil)
 
-		c.Assert(head, Equals, fix.head)
+		c.Assert(head.Hash, Equals, fix.head)
+		c.Assert(head.Name, Equals, core.ReferenceName("refs/heads/master"))
 	}
 }
 
-func (s *SuiteRepository) TestHeadFromRemote(c *C) {
-	r, err := NewRepository(RepositoryFixture, nil)
-	c.Assert(err, IsNil)
+func (s *SuiteRepository) TestHeadDetached(c *C) {
+	r := NewPlainRepository()
+	hash := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	c.Assert(r.References.Set(core.NewHashReference(core.HEAD, hash)), IsNil)
 
-	upSrv := &MockGitUploadPackService{}
-	r.Remotes[DefaultRemoteName].upSrv = upSrv
-	err = r.Remotes[DefaultRemoteName].Connect()
+	head, err := r.Head()
 	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewHashReference(core.HEAD, hash))
+}
+
+func (s *SuiteRepository) TestHeadErrors(c *C) {
+	r := NewPlainRepository()
+	_, err := r.Head()
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	c.Assert(r.References.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+	_, err = r.Head()
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	c.Assert(r.References.Set(core.NewSymbolicReference("refs/heads/master", core.HEAD)), IsNil)
+	_, err = r.Head()
+	c.Assert(err, Equals, core.ErrReferenceLoop)
+}
+
+func (s *SuiteRepository) TestReference(c *C) {
+	r := NewPlainRepository()
+	hash := core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	head := core.NewSymbolicReference(core.HEAD, "refs/heads/master")
+	master := core.NewHashReference("refs/heads/master", hash)
+	c.Assert(r.References.Set(head), IsNil)
+	c.Assert(r.References.Set(master), IsNil)
 
-	info, err := upSrv.Info()
+	ref, err := r.Reference(core.HEAD, false)
 	c.Assert(err, IsNil)
-	expected := info.Head
+	c.Assert(ref, DeepEquals, head)
+	c.Assert(ref.IsSymbolic(), Equals, true)
 
-	obtained, err := r.Head(DefaultRemoteName)
+	ref, err = r.Reference(core.HEAD, true)
 	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, master)
 
-	c.Assert(obtained, Equals, expected)
+	_, err = r.Reference("refs/heads/foo", true)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
 }
 
-func (s *SuiteRepository) TestHeadErrors(c *C) {
-	r, err := NewRepository(RepositoryFixture, nil)
+func (s *SuiteRepository) benchmarkTreeWalk(c *C, cached bool) {
+	fix := s.dirFixtures["binrels"]
+	fs := fs.NewOS()
+	r, err := NewRepositoryFromFS(fs, fs.Join(fix.path, ".git/"))
+	c.Assert(err, IsNil)
+	if cached {
+		r.Storage = core.NewCachedObjectStorage(r.Storage, 16*1024*1024)
+	}
+
+	commit, err := r.Commit(fix.head)
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
 	c.Assert(err, IsNil)
 
-	upSrv := &MockGitUploadPackService{}
-	r.Remotes[DefaultRemoteName].upSrv = upSrv
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		iter := tree.Files()
+		err := iter.ForEach(func(*File) error { return nil })
+		c.Assert(err, IsNil)
+	}
+}
 
-	remote := "not found"
-	_, err = r.Head(remote)
-	c.Assert(err, ErrorMatches, fmt.Sprintf("unable to find remote %q", remote))
+func (s *SuiteRepository) BenchmarkTreeWalk(c *C) {
+	s.benchmarkTreeWalk(c, false)
+}
 
-	remote = ""
-	_, err = r.Head(remote)
-	c.Assert(err, ErrorMatches, "cannot retrieve local head: no local data found")
+func (s *SuiteRepository) BenchmarkTreeWalkCached(c *C) {
+	s.benchmarkTreeWalk(c, true)
 }
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// RevertOptions are the options of Repository.Revert.
+type RevertOptions struct {
+	// Mainline is the number of the parent, from 1, the changes of a merge
+	// commit are reverted against, as git revert -m does. It is required
+	// for the merges, and not allowed for the rest of the commits.
+	Mainline int
+	// Committer is the author and committer of the new commit, its Name
+	// and Email are the user.name and user.email of the config if they are
+	// empty, and its When is the current time if it is zero.
+	Committer Signature
+}
+
+// RevertResult is the result of Repository.Revert.
+type RevertResult struct {
+	// Commit is the hash of the new commit, the zero hash if the changes
+	// could not be reverted.
+	Commit core.Hash
+	// Tree is the hash of the tree with the changes reverted, with the
+	// conflicts as in MergeResult.Tree.
+	Tree core.Hash
+	// Conflicts are the files whose changes could not be reverted, sorted
+	// by path, see MergeResult.Conflicts.
+	Conflicts []*MergeConflict
+}
+
+// Revert reverts the changes of the commit c, compared to its parent, on top
+// of the commit onto, as git revert does: the changes from the tree of c to
+// the one of its parent are applied as Repository.CherryPick does, and a new
+// commit is written, with onto as its parent, if they have no conflicts. Its
+// message is the one of git, Revert "<subject of c>", telling the hash of c,
+// and its author is its committer. No reference is updated.
+//
+// ErrEmptyCommit is returned if the changes are already reverted in onto,
+// and ErrMainlineRequired if c is a merge and the options do not say which
+// of its parents its changes are reverted against.
+func (r *Repository) Revert(c *Commit, onto *Commit, opts *RevertOptions) (*RevertResult, error) {
+	if opts == nil {
+		opts = &RevertOptions{}
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return nil, err
+	}
+
+	var theirs core.Hash
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", commitSubject(c), c.Hash)
+	if parent != nil {
+		theirs = parent.TreeHash
+	}
+
+	if opts.Mainline != 0 {
+		msg += fmt.Sprintf(", reversing\nchanges made to %s", parent.Hash)
+	}
+
+	label := fmt.Sprintf("parent of %s (%s)", abbrevHash(c.Hash), commitSubject(c))
+	sigs := &CommitOptions{Committer: opts.Committer}
+	h, res, err := r.pick(c.TreeHash, theirs, onto, label, sigs, msg+".\n")
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevertResult{Commit: h, Tree: res.Tree, Conflicts: res.Conflicts}, nil
+}
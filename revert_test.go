@@ -0,0 +1,90 @@
+package git
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func revertOptions(mainline int) *RevertOptions {
+	sig := Signature{Name: "bar", Email: "bar@foo.com", When: time.Unix(100, 0).UTC()}
+	return &RevertOptions{Mainline: mainline, Committer: sig}
+}
+
+func (s *SuiteMerge) TestRevert(c *C) {
+	base := s.commit(c, map[string]string{"foo": "1\n2\n3\n4\n5\n", "bar": "bar\n"})
+	reverted := s.commit(c, map[string]string{"foo": "one\n2\n3\n4\n5\n", "qux": "qux\n"}, base)
+	onto := s.commit(c, map[string]string{"foo": "one\n2\n3\n4\nfive\n", "qux": "qux\n"}, reverted)
+
+	res, err := s.r.Revert(reverted, onto, revertOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 0)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo": "1\n2\n3\n4\nfive\n",
+		"bar": "bar\n",
+	})
+
+	commit, err := s.r.Commit(res.Commit)
+	c.Assert(err, IsNil)
+	c.Assert(commit.TreeHash, Equals, res.Tree)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{onto.Hash})
+	c.Assert(commit.Message, Equals, "Revert \"foo\"\n\nThis reverts commit "+reverted.Hash.String()+".\n")
+	c.Assert(commit.Author.Name, Equals, "bar")
+	c.Assert(commit.Author.When.Unix(), Equals, int64(100))
+	c.Assert(commit.Committer.Name, Equals, "bar")
+
+	// the changes are not there anymore
+	_, err = s.r.Revert(reverted, base, revertOptions(0))
+	c.Assert(err, Equals, ErrEmptyCommit)
+}
+
+func (s *SuiteMerge) TestRevertConflicts(c *C) {
+	base := s.commit(c, map[string]string{"foo": "1\n2\n3\n"})
+	reverted := s.commit(c, map[string]string{"foo": "1\ntwo\n3\n"}, base)
+	onto := s.commit(c, map[string]string{"foo": "1\nTWO\n3\n"}, reverted)
+
+	res, err := s.r.Revert(reverted, onto, revertOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(res.Commit, Equals, core.ZeroHash)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Base.Hash, Not(Equals), res.Conflicts[0].Theirs.Hash)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{
+		"foo": "1\n<<<<<<< " + abbrevHash(onto.Hash) + "\nTWO\n=======\n2\n>>>>>>> parent of " +
+			abbrevHash(reverted.Hash) + " (foo)\n3\n",
+	})
+}
+
+func (s *SuiteMerge) TestRevertMainline(c *C) {
+	base := s.commit(c, map[string]string{"foo": "foo\n"})
+	a := s.commit(c, map[string]string{"foo": "foo\n", "a": "a\n"}, base)
+	b := s.commit(c, map[string]string{"foo": "foo\n", "b": "b\n"}, base)
+	merge := s.commit(c, map[string]string{"foo": "foo\n", "a": "a\n", "b": "b\n"}, a, b)
+
+	_, err := s.r.Revert(merge, merge, revertOptions(0))
+	c.Assert(err, Equals, ErrMainlineRequired)
+
+	_, err = s.r.Revert(a, merge, revertOptions(2))
+	c.Assert(err, Equals, ErrInvalidMainline)
+
+	// the changes of the merge compared to a are the ones of b
+	res, err := s.r.Revert(merge, merge, revertOptions(1))
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"foo": "foo\n", "a": "a\n"})
+
+	commit, err := s.r.Commit(res.Commit)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "Revert \"foo\"\n\n"+
+		"This reverts commit "+merge.Hash.String()+", reversing\n"+
+		"changes made to "+a.Hash.String()+".\n")
+}
+
+func (s *SuiteMerge) TestRevertRoot(c *C) {
+	root := s.commit(c, map[string]string{"foo": "foo\n"})
+	onto := s.commit(c, map[string]string{"foo": "foo\n", "bar": "bar\n"}, root)
+
+	res, err := s.r.Revert(root, onto, revertOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(s.files(c, res.Tree), DeepEquals, map[string]string{"bar": "bar\n"})
+}
@@ -0,0 +1,588 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+var (
+	// ErrRevisionNotFound is returned by ResolveRevision when a revision
+	// can be parsed but not found: there is no reference or object with its
+	// name, or no such parent or reflog entry.
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrInvalidHashPrefix is returned by ExpandHash when the prefix is not
+	// hexadecimal, is shorter than MinHashPrefix or is longer than the hashes
+	// of the object format of the repository.
+	ErrInvalidHashPrefix = errors.New("invalid hash prefix")
+)
+
+// MinHashPrefix is the minimum length of the abbreviated hashes, as in git.
+const MinHashPrefix = 4
+
+// AmbiguousHashError is returned by ExpandHash when several objects have
+// hashes starting with the prefix, the candidates.
+type AmbiguousHashError struct {
+	Prefix     string
+	Candidates []core.Hash
+}
+
+func (e *AmbiguousHashError) Error() string {
+	candidates := make([]string, len(e.Candidates))
+	for i, h := range e.Candidates {
+		candidates[i] = h.String()
+	}
+
+	return fmt.Sprintf("ambiguous hash prefix %s, candidates: %s",
+		e.Prefix, strings.Join(candidates, ", "))
+}
+
+// ExpandHash returns the hash of the only object whose hash starts with the
+// given prefix, an abbreviated hash of at least MinHashPrefix hexadecimal
+// digits. ErrObjectNotFound is returned if there is no such object, and an
+// *AmbiguousHashError if there are several. The storage is searched with
+// core.HashesWithPrefix, without reading the objects if it supports it.
+func (r *Repository) ExpandHash(prefix string) (core.Hash, error) {
+	if len(prefix) < MinHashPrefix || len(prefix) > r.ObjectFormat().HexSize() || !isHex(prefix) {
+		return core.ZeroHash, ErrInvalidHashPrefix
+	}
+
+	prefix = strings.ToLower(prefix)
+	hashes, err := core.HashesWithPrefix(r.Storage, prefix)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	switch len(hashes) {
+	case 0:
+		return core.ZeroHash, ErrObjectNotFound
+	case 1:
+		return hashes[0], nil
+	default:
+		return core.ZeroHash, &AmbiguousHashError{Prefix: prefix, Candidates: hashes}
+	}
+}
+
+// abbreviate returns the shortest prefix of the hash, of at least n and
+// MinHashPrefix hexadecimal digits, that is not the prefix of any other
+// object, as git does, so ExpandHash can expand it.
+func (r *Repository) abbreviate(h core.Hash, n int) (string, error) {
+	s := h.String()
+	if n < MinHashPrefix {
+		n = MinHashPrefix
+	}
+
+	if n >= len(s) {
+		return s, nil
+	}
+
+	hashes, err := core.HashesWithPrefix(r.Storage, s[:n])
+	if err != nil {
+		return "", err
+	}
+
+	for _, other := range hashes {
+		o := other.String()
+		for n < len(s) && o != s && o[:n] == s[:n] {
+			n++
+		}
+	}
+
+	return s[:n], nil
+}
+
+// RevisionError is returned by ResolveRevision when a revision can not be
+// parsed, Pos is the position in the revision of the offending character.
+type RevisionError struct {
+	Revision string
+	Pos      int
+	Reason   string
+}
+
+func (e *RevisionError) Error() string {
+	return fmt.Sprintf("invalid revision %q at %d: %s", e.Revision, e.Pos, e.Reason)
+}
+
+// revisionLookup are the formats of the names looked up for a reference
+// name in a revision, in the order git looks them up.
+var revisionLookup = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// ResolveRevision returns the hash of the object named by the revision, as
+// git rev-parse --verify does, see gitrevisions(7). A revision starts with a
+// hash or a reference name, looked up the way git does, or @ for HEAD,
+// optionally followed by @{n}, the n-th prior value of the reference from
+// its reflog, or the current branch if there is no name. @{-n} is the n-th
+// branch checked out before the current one, also from the reflog, and it
+// is only valid on its own, not after a name, as in HEAD@{-1}.
+//
+// It can be followed by any number of these operators, applied from left to
+// right: ~n, the n-th generation ancestor following the first parents; ^n,
+// the n-th parent, with ^0 being the commit itself; ^{type}, the object
+// found peeling the tags, and the commits for a tree, until an object of
+// the type, commit, tree, blob, tag or object, for any type; and ^{}, the
+// object found peeling the tags. A missing n is 1.
+//
+// The names that are not references are taken as abbreviated hashes, see
+// ExpandHash, as git does.
+//
+// A *RevisionError is returned if the revision can not be parsed,
+// ErrRevisionNotFound if anything it names is not found, and an
+// *AmbiguousHashError if an abbreviated hash is ambiguous.
+func (r *Repository) ResolveRevision(rev string) (core.Hash, error) {
+	p := &revisionParser{r: r, rev: rev}
+	obj, err := p.parse()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	return obj.ID(), nil
+}
+
+// revisionParser resolves a revision as it is parsed, pos is the position of
+// the next character to parse.
+type revisionParser struct {
+	r   *Repository
+	rev string
+	pos int
+}
+
+func (p *revisionParser) parse() (Object, error) {
+	obj, err := p.parseBase()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.pos < len(p.rev) {
+		if obj, err = p.parseOperator(obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+func (p *revisionParser) errorf(pos int, format string, args ...interface{}) error {
+	return &RevisionError{
+		Revision: p.rev,
+		Pos:      pos,
+		Reason:   fmt.Sprintf(format, args...),
+	}
+}
+
+// parseBase parses and resolves the revision up to the first operator: the
+// hash or name of a reference, and its reflog entry if any.
+func (p *revisionParser) parseBase() (Object, error) {
+	end := strings.IndexAny(p.rev, "~^")
+	if end == -1 {
+		end = len(p.rev)
+	}
+
+	base := p.rev[:end]
+	p.pos = end
+
+	var name string
+	var n int
+	i := strings.Index(base, "@{")
+	switch {
+	case base == "":
+		return nil, p.errorf(0, "missing revision name")
+	case strings.HasPrefix(base, "@{-"):
+		var err error
+		if n, i, err = p.parseBraces(base, 3); err != nil {
+			return nil, err
+		}
+
+		if n == 0 {
+			return nil, p.errorf(3, "invalid checkout number")
+		}
+
+		if name, err = p.previousBranch(n); err != nil {
+			return nil, err
+		}
+
+		if i == len(base) {
+			return p.resolveName(name)
+		}
+
+		if !strings.HasPrefix(base[i:], "@{") {
+			return nil, p.errorf(i, "unexpected character %q", base[i])
+		}
+	case base == "@":
+		return p.resolveName("HEAD")
+	case i == -1:
+		return p.resolveName(base)
+	default:
+		name = base[:i]
+	}
+
+	if strings.HasPrefix(base[i+2:], "-") {
+		return nil, p.errorf(i+2, "@{-n} is only valid without a ref")
+	}
+
+	n, end, err := p.parseBraces(base, i+2)
+	if err != nil {
+		return nil, err
+	}
+
+	if end != len(base) {
+		return nil, p.errorf(end, "unexpected character %q", base[end])
+	}
+
+	ref, err := p.reflogReference(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := p.reflogEntry(ref, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.object(h)
+}
+
+// parseBraces parses the number of a reflog entry, or of a checkout, that
+// starts at start, up to its closing brace, returning it and the position
+// after the brace.
+func (p *revisionParser) parseBraces(base string, start int) (int, int, error) {
+	end := strings.IndexByte(base[start:], '}')
+	if end == -1 {
+		return 0, 0, p.errorf(len(base), "missing closing brace")
+	}
+
+	end += start
+	n, err := strconv.Atoi(base[start:end])
+	if err != nil || n < 0 || base[start] == '+' {
+		return 0, 0, p.errorf(start, "unsupported reflog selector %q", base[start:end])
+	}
+
+	return n, end + 1, nil
+}
+
+// resolveName returns the object of the reference with the given name, found
+// the way git does, or the object with the given hash if it is a full hash.
+// The object of the abbreviated hash is returned if there is no reference.
+func (p *revisionParser) resolveName(name string) (Object, error) {
+	if (len(name) == core.SHA1.HexSize() || len(name) == core.SHA256.HexSize()) && isHex(name) {
+		return p.object(core.NewHash(name))
+	}
+
+	ref, err := p.reference(name)
+	if err == ErrRevisionNotFound && len(name) >= MinHashPrefix && isHex(name) {
+		h, err := p.r.ExpandHash(name)
+		if err == ErrObjectNotFound {
+			return nil, ErrRevisionNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return p.object(h)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.object(ref.Hash)
+}
+
+// reference returns the reference found for the given name, resolved, the
+// first found in the order of revisionLookup.
+func (p *revisionParser) reference(name string) (*core.Reference, error) {
+	for _, format := range revisionLookup {
+		if format == "%s" && !isTopLevelReference(name) {
+			continue
+		}
+
+		refName := core.ReferenceName(fmt.Sprintf(format, name))
+		ref, err := p.r.Reference(refName, true)
+		if err == core.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return ref, nil
+	}
+
+	return nil, ErrRevisionNotFound
+}
+
+// isTopLevelReference returns true for the names looked up as they are,
+// HEAD and the other references in capitals at the top of the git
+// directory, and the full names of the references.
+func isTopLevelReference(name string) bool {
+	if strings.HasPrefix(name, "refs/") {
+		return true
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// reflogReference returns the name of the reference whose reflog is used
+// for the given name: the current branch if there is no name, see Head.
+func (p *revisionParser) reflogReference(name string) (core.ReferenceName, error) {
+	if name == "" {
+		head, err := p.r.Head()
+		if err != nil {
+			return "", err
+		}
+
+		return head.Name, nil
+	}
+
+	for _, format := range revisionLookup {
+		if format == "%s" && !isTopLevelReference(name) {
+			continue
+		}
+
+		refName := core.ReferenceName(fmt.Sprintf(format, name))
+		_, err := p.r.References.Get(refName)
+		if err == core.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return refName, nil
+	}
+
+	return "", ErrRevisionNotFound
+}
+
+// reflogEntry returns the n-th prior value of the reference, 0 being the
+// value of its last reflog entry, or the value before the oldest entry if
+// n is the number of entries, as git does.
+func (p *revisionParser) reflogEntry(name core.ReferenceName, n int) (core.Hash, error) {
+	entries, err := p.reflog(name)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	switch {
+	case n < len(entries):
+		return entries[len(entries)-1-n].New, nil
+	case n == len(entries) && n != 0 && entries[0].Old != core.ZeroHash:
+		return entries[0].Old, nil
+	default:
+		return core.ZeroHash, ErrRevisionNotFound
+	}
+}
+
+// previousBranch returns the name of the n-th branch, or hash for a detached
+// HEAD, checked out before the current one, from the messages of the
+// entries of the reflog of HEAD, as git does.
+func (p *revisionParser) previousBranch(n int) (string, error) {
+	entries, err := p.reflog(core.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	const prefix = "checkout: moving from "
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg := entries[i].Message
+		if !strings.HasPrefix(msg, prefix) {
+			continue
+		}
+
+		to := strings.LastIndex(msg, " to ")
+		if to < len(prefix) {
+			continue
+		}
+
+		if n--; n == 0 {
+			return msg[len(prefix):to], nil
+		}
+	}
+
+	return "", ErrRevisionNotFound
+}
+
+func (p *revisionParser) reflog(name core.ReferenceName) ([]*core.ReflogEntry, error) {
+	iter, err := p.r.Reflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+	var entries []*core.ReflogEntry
+	for {
+		entry, err := iter.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// parseOperator parses and applies to obj the operator at the current
+// position.
+func (p *revisionParser) parseOperator(obj Object) (Object, error) {
+	op := p.rev[p.pos]
+	p.pos++
+
+	if op == '^' && p.pos < len(p.rev) && p.rev[p.pos] == '{' {
+		return p.parsePeel(obj)
+	}
+
+	n := 1
+	start := p.pos
+	for p.pos < len(p.rev) && p.rev[p.pos] >= '0' && p.rev[p.pos] <= '9' {
+		p.pos++
+	}
+
+	if p.pos != start {
+		var err error
+		if n, err = strconv.Atoi(p.rev[start:p.pos]); err != nil {
+			return nil, p.errorf(start, "invalid number %q", p.rev[start:p.pos])
+		}
+	}
+
+	if p.pos < len(p.rev) && p.rev[p.pos] != '~' && p.rev[p.pos] != '^' {
+		return nil, p.errorf(p.pos, "unexpected character %q", p.rev[p.pos])
+	}
+
+	c, err := p.peel(obj, core.CommitObject)
+	if err != nil {
+		return nil, err
+	}
+
+	if op == '^' {
+		return p.parent(c, n)
+	}
+
+	for ; n > 0; n-- {
+		if c, err = p.parent(c, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// parsePeel parses and applies to obj the ^{type} operator whose opening
+// brace is at the current position.
+func (p *revisionParser) parsePeel(obj Object) (Object, error) {
+	start := p.pos + 1
+	end := strings.IndexByte(p.rev[start:], '}')
+	if end == -1 {
+		return nil, p.errorf(len(p.rev), "missing closing brace")
+	}
+
+	end += start
+	p.pos = end + 1
+
+	switch typ := p.rev[start:end]; typ {
+	case "":
+		for {
+			tag, ok := obj.(*Tag)
+			if !ok {
+				return obj, nil
+			}
+
+			var err error
+			if obj, err = p.object(tag.Target); err != nil {
+				return nil, err
+			}
+		}
+	case "object":
+		return obj, nil
+	case "commit", "tree", "blob", "tag":
+		t, _ := core.ParseObjectType(typ)
+		return p.peel(obj, t)
+	default:
+		return nil, p.errorf(start, "unsupported object type %q", typ)
+	}
+}
+
+// peel returns the first object of the given type found peeling obj: the
+// tags are followed to their objects, and the commits to their trees.
+// ErrUnsupportedObject is returned if there is none.
+func (p *revisionParser) peel(obj Object, t core.ObjectType) (Object, error) {
+	for obj.Type() != t {
+		var h core.Hash
+		switch o := obj.(type) {
+		case *Tag:
+			h = o.Target
+		case *Commit:
+			if t != core.TreeObject {
+				return nil, ErrUnsupportedObject
+			}
+
+			h = o.TreeHash
+		default:
+			return nil, ErrUnsupportedObject
+		}
+
+		var err error
+		if obj, err = p.object(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+// parent returns the n-th parent of the commit, or the commit itself if n
+// is zero.
+func (p *revisionParser) parent(obj Object, n int) (Object, error) {
+	c := obj.(*Commit)
+	if n == 0 {
+		return c, nil
+	}
+
+	if n > len(c.ParentHashes) {
+		return nil, ErrRevisionNotFound
+	}
+
+	return p.object(c.ParentHashes[n-1])
+}
+
+// object returns the object with the given hash, ErrRevisionNotFound if it
+// is missing.
+func (p *revisionParser) object(h core.Hash) (Object, error) {
+	obj, err := p.r.Object(h)
+	if err == ErrObjectNotFound {
+		return nil, ErrRevisionNotFound
+	}
+
+	return obj, err
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,281 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// revisionsFixture is a repository written by git with a merged branch,
+// feature, and tags of every type of object, with its reflogs. After the
+// merge feature and then master were checked out again.
+const revisionsFixture = "fixtures/revisions.tgz"
+
+type SuiteRevision struct {
+	dir string
+	r   *Repository
+}
+
+var _ = Suite(&SuiteRevision{})
+
+func (s *SuiteRevision) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(revisionsFixture)
+	c.Assert(err, IsNil)
+
+	s.r, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRevision) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+// the expected hashes have been obtained with git rev-parse --verify
+var resolveRevisionTests = []struct {
+	rev      string
+	expected string
+}{
+	{"HEAD", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"@", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"master", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"69901b6fd5437dea6ec24286389cbf061e128c36", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"v1.0", "1c44573a5564b6c9e9207e684d84adcedd8915f6"},
+	{"v1.0^{}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"v1.0^{}~2^2", "40c30b33114ed9c3e16d35075c1f94842f1941f0"},
+	{"nested", "a3b24b0a14fe93b515d233eee7c84df78c13e8ef"},
+	{"nested^{}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"nested^{tag}", "a3b24b0a14fe93b515d233eee7c84df78c13e8ef"},
+	{"v1.0^{commit}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"v1.0^{object}", "1c44573a5564b6c9e9207e684d84adcedd8915f6"},
+	{"master^{tree}", "37b3e0735e9549c8d01021a07a7fa380e37a2749"},
+	{"tree-tag^{}", "37b3e0735e9549c8d01021a07a7fa380e37a2749"},
+	{"tree-tag^{tree}", "37b3e0735e9549c8d01021a07a7fa380e37a2749"},
+	{"blob-tag^{}", "78981922613b2afb6025042ff6bd878ac1994e85"},
+	{"blob-tag^{blob}", "78981922613b2afb6025042ff6bd878ac1994e85"},
+	{"light^{}", "b131c114a72857a3640bd4b2e82c6df638c9bb67"},
+	{"dup", "6b80b95d8791d42cd3515b5604831927500e2fda"},
+	{"heads/dup", "5ca6e7afb567e5ac9c1dddd2af4564fe5201fb0a"},
+	{"refs/heads/dup", "5ca6e7afb567e5ac9c1dddd2af4564fe5201fb0a"},
+	{"origin", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"origin/master", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"master~", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"master^", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"master^^", "35a24d3aa1e884bfa6a183a16079d80fd57c9d92"},
+	{"master^0", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"master~0", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"v1.0~0", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"master~2^2~1", "dc1fa21347e677a874dad336dcf2bb5dc9b77e25"},
+	{"@{-1}", "40c30b33114ed9c3e16d35075c1f94842f1941f0"},
+	{"@{-2}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"@{-3}", "40c30b33114ed9c3e16d35075c1f94842f1941f0"},
+	{"@{-4}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"@{-1}~1", "dc1fa21347e677a874dad336dcf2bb5dc9b77e25"},
+	{"@{-1}@{1}", "dc1fa21347e677a874dad336dcf2bb5dc9b77e25"},
+	{"@{0}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"@{1}", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"master@{0}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"master@{1}", "a043c15d442473337096c50e212d632c2767f0a0"},
+	{"master@{5}", "6b80b95d8791d42cd3515b5604831927500e2fda"},
+	{"heads/master@{2}~1", "b131c114a72857a3640bd4b2e82c6df638c9bb67"},
+	{"HEAD@{1}", "40c30b33114ed9c3e16d35075c1f94842f1941f0"},
+	{"HEAD@{2}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	{"feature@{1}", "dc1fa21347e677a874dad336dcf2bb5dc9b77e25"},
+}
+
+func (s *SuiteRevision) TestResolveRevision(c *C) {
+	for _, t := range resolveRevisionTests {
+		h, err := s.r.ResolveRevision(t.rev)
+		c.Assert(err, IsNil, Commentf("rev=%s", t.rev))
+		c.Assert(h.String(), Equals, t.expected, Commentf("rev=%s", t.rev))
+	}
+}
+
+func (s *SuiteRevision) TestResolveRevisionNotFound(c *C) {
+	for _, rev := range []string{
+		"foo",
+		"0000000000000000000000000000000000000001",
+		"master~3^2",
+		"master~8",
+		"master@{6}",
+		"master@{7}",
+		"foo@{1}",
+		"@{-5}",
+	} {
+		_, err := s.r.ResolveRevision(rev)
+		c.Assert(err, Equals, ErrRevisionNotFound, Commentf("rev=%s", rev))
+	}
+}
+
+func (s *SuiteRevision) TestResolveRevisionUnsupportedObject(c *C) {
+	for _, rev := range []string{
+		"master^{tag}",
+		"master^{blob}",
+		"tree-tag^{commit}",
+		"tree-tag~1",
+		"blob-tag^{tree}",
+		"master^{tree}^1",
+	} {
+		_, err := s.r.ResolveRevision(rev)
+		c.Assert(err, Equals, ErrUnsupportedObject, Commentf("rev=%s", rev))
+	}
+}
+
+func (s *SuiteRevision) TestResolveRevisionInvalid(c *C) {
+	for _, t := range []struct {
+		rev string
+		pos int
+	}{
+		{"", 0},
+		{"~1", 0},
+		{"master~x", 7},
+		{"master^2x", 8},
+		{"master^{", 8},
+		{"master^{foo}", 8},
+		{"master^{}~1^{tree", 17},
+		{"master@{", 8},
+		{"master@{1", 9},
+		{"master@{yesterday}", 8},
+		{"master@{-1}", 8},
+		{"HEAD@{-1}", 6},
+		{"@{-1}@{-1}", 7},
+		{"master@{1}foo", 10},
+		{"@{-0}", 3},
+		{"@{-1}foo", 5},
+		{"master~99999999999999999999", 7},
+	} {
+		_, err := s.r.ResolveRevision(t.rev)
+		comment := Commentf("rev=%s", t.rev)
+		c.Assert(err, FitsTypeOf, &RevisionError{}, comment)
+		c.Assert(err.(*RevisionError).Pos, Equals, t.pos, comment)
+		c.Assert(err.(*RevisionError).Revision, Equals, t.rev, comment)
+	}
+}
+
+func (s *SuiteRevision) TestResolveRevisionCheckoutWithRef(c *C) {
+	for _, rev := range []string{"HEAD@{-1}", "master@{-1}", "@{-1}@{-1}"} {
+		_, err := s.r.ResolveRevision(rev)
+		c.Assert(err, FitsTypeOf, &RevisionError{}, Commentf("rev=%s", rev))
+		c.Assert(err.(*RevisionError).Reason, Equals, "@{-n} is only valid without a ref", Commentf("rev=%s", rev))
+	}
+}
+
+func (s *SuiteRevision) TestRevisionError(c *C) {
+	err := &RevisionError{Revision: "master~x", Pos: 7, Reason: "unexpected character 'x'"}
+	c.Assert(err.Error(), Equals, `invalid revision "master~x" at 7: unexpected character 'x'`)
+}
+
+func (s *SuiteRevision) TestResolveRevisionMemory(c *C) {
+	r, tip := commitLine(c, []*Commit{{}, {}})
+	c.Assert(r.References.Set(core.NewHashReference("refs/heads/master", tip)), IsNil)
+	c.Assert(r.References.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+
+	commit, err := r.Commit(tip)
+	c.Assert(err, IsNil)
+
+	h, err := r.ResolveRevision("HEAD~1")
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, commit.ParentHashes[0])
+
+	_, err = r.ResolveRevision("@{1}")
+	c.Assert(err, Equals, ErrRevisionNotFound)
+}
+
+func (s *SuiteRevision) TestExpandHash(c *C) {
+	for _, prefix := range []string{
+		"6990",
+		"69901b6",
+		"69901B6F",
+		"69901b6fd5437dea6ec24286389cbf061e128c36",
+	} {
+		h, err := s.r.ExpandHash(prefix)
+		c.Assert(err, IsNil, Commentf("prefix=%s", prefix))
+		c.Assert(h.String(), Equals, "69901b6fd5437dea6ec24286389cbf061e128c36")
+	}
+
+	_, err := s.r.ExpandHash("0000")
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	for _, prefix := range []string{
+		"", "699", "6990x", "master",
+		"69901b6fd5437dea6ec24286389cbf061e128c360",
+	} {
+		_, err := s.r.ExpandHash(prefix)
+		c.Assert(err, Equals, ErrInvalidHashPrefix, Commentf("prefix=%s", prefix))
+	}
+}
+
+func (s *SuiteRevision) TestResolveRevisionAbbreviated(c *C) {
+	for _, t := range []struct {
+		rev      string
+		expected string
+	}{
+		{"69901b6", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+		{"69901b6~1", "a043c15d442473337096c50e212d632c2767f0a0"},
+		{"1c44573a^{}", "69901b6fd5437dea6ec24286389cbf061e128c36"},
+	} {
+		h, err := s.r.ResolveRevision(t.rev)
+		c.Assert(err, IsNil, Commentf("rev=%s", t.rev))
+		c.Assert(h.String(), Equals, t.expected, Commentf("rev=%s", t.rev))
+	}
+
+	for _, rev := range []string{"0000", "699"} {
+		_, err := s.r.ResolveRevision(rev)
+		c.Assert(err, Equals, ErrRevisionNotFound, Commentf("rev=%s", rev))
+	}
+}
+
+func (s *SuiteRevision) TestExpandHashAmbiguous(c *C) {
+	// blobs are written until two of them have the same prefix
+	r := NewPlainRepository()
+	seen := make(map[string]core.Hash)
+	var prefix string
+	var candidates []core.Hash
+	for i := 0; candidates == nil; i++ {
+		content := []byte(fmt.Sprintf("blob %d", i))
+		h, err := r.Storage.Set(memory.NewObject(core.BlobObject, int64(len(content)), content))
+		c.Assert(err, IsNil)
+
+		prefix = h.String()[:MinHashPrefix]
+		if other, ok := seen[prefix]; ok {
+			candidates = []core.Hash{other, h}
+			if h.String() < other.String() {
+				candidates = []core.Hash{h, other}
+			}
+		}
+
+		seen[prefix] = h
+	}
+
+	_, err := r.ExpandHash(prefix)
+	c.Assert(err, DeepEquals, &AmbiguousHashError{Prefix: prefix, Candidates: candidates})
+	c.Assert(err, ErrorMatches, "ambiguous hash prefix "+prefix+", candidates: "+
+		candidates[0].String()+", "+candidates[1].String())
+
+	_, err = r.ResolveRevision(prefix)
+	c.Assert(err, FitsTypeOf, &AmbiguousHashError{})
+
+	h, err := r.ExpandHash(candidates[0].String()[:10])
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, candidates[0])
+
+	// the abbreviations are longer than the common prefix of the candidates
+	a, b := candidates[0].String(), candidates[1].String()
+	n := MinHashPrefix
+	for a[n] == b[n] {
+		n++
+	}
+
+	for _, h := range candidates {
+		abbrev, err := r.abbreviate(h, MinHashPrefix)
+		c.Assert(err, IsNil)
+		c.Assert(abbrev, Equals, h.String()[:n+1])
+	}
+}
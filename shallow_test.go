@@ -0,0 +1,148 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+// the head of mergesFixture, and the commits shallow at depth 5
+var (
+	shallowHead   = core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763")
+	shallowDepth5 = []core.Hash{
+		core.NewHash("0ac063db656012ad3b4617e13f6e5d3849b41426"),
+		core.NewHash("4b8bf322541f1422d5fa3d89627ad4ea13c163a4"),
+		core.NewHash("65348e200a5e368f71c8973e0e5359c275be42c5"),
+	}
+)
+
+type SuiteShallow struct{}
+
+var _ = Suite(&SuiteShallow{})
+
+func (s *SuiteShallow) pull(c *C, r *Repository, name string, depth int) {
+	r.Remotes[DefaultRemoteName].upSrv = &fixtureUploadPackService{c: c, name: name}
+	c.Assert(r.PullWithOptions(&PullOptions{Depth: depth}), IsNil)
+}
+
+func (s *SuiteShallow) assertLog(c *C, r *Repository, expected []string) {
+	iter, err := r.Log(LogOptions{From: shallowHead})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), DeepEquals, expected)
+}
+
+func (s *SuiteShallow) TestPullDepth1(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-1", 1)
+
+	shallows, err := r.Shallows.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []core.Hash{shallowHead})
+	s.assertLog(c, r, []string{shallowHead.String()})
+}
+
+// the expected history has been obtained with git log after git clone
+// --depth 5
+func (s *SuiteShallow) TestPullDepth5(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-5", 5)
+
+	shallows, err := r.Shallows.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, shallowDepth5)
+
+	s.assertLog(c, r, []string{
+		"972eb2a3177a422bd2b0ad4991df73d32e0fc763",
+		"4e41be12f377c59513e92d8036c8ffbca3024427",
+		"3535f80b8fc84ebedf448014e79191c0e867b575",
+		"ec34268509ffcc216a4fedc55daaac0dfbb2dbb4",
+		"d823531ae5b7d3cd4a1b7b4cd3ae1a72bae3370a",
+		"4e77e23f41ac412bcea558829c0e3454df543864",
+		"b3ceefccccd8f675401864adcca50ba3b464b93c",
+		"65348e200a5e368f71c8973e0e5359c275be42c5",
+		"40453c574516d6288d84f3eeebe6253fe24bc77c",
+		"0ac063db656012ad3b4617e13f6e5d3849b41426",
+		"053869ce909291337e76ac4e5e989d52b8a12f21",
+		"b363aabeb50df3c06868d116c72e37ce1c72255a",
+		"4b8bf322541f1422d5fa3d89627ad4ea13c163a4",
+	})
+}
+
+func (s *SuiteShallow) TestPullDeepen(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-5", 5)
+	s.pull(c, r, "deepen-10", 10)
+
+	shallows, err := r.Shallows.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, HasLen, 0)
+
+	iter, err := r.Log(LogOptions{From: shallowHead})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), HasLen, 15)
+}
+
+func (s *SuiteShallow) TestPullShallowNotSupported(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	r.Remotes[DefaultRemoteName].upSrv = &fixtureUploadPackService{c: c, noShallow: true}
+	err = r.PullWithOptions(&PullOptions{Depth: 1})
+	c.Assert(err, Equals, ErrShallowNotSupported)
+}
+
+// a missing parent of a commit that is not shallow is still an error
+func (s *SuiteShallow) TestLogMissingParent(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-5", 5)
+	c.Assert(r.Shallows.SetShallow(shallowDepth5[1:]), IsNil)
+
+	iter, err := r.Log(LogOptions{From: shallowHead})
+	c.Assert(err, IsNil)
+	err = iter.ForEach(func(*Commit) error { return nil })
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+// the shallow commits are sent fetching without a depth, so the remote sends
+// the history of feature, see fixtures/upload-pack/fetch-shallow.request
+func (s *SuiteShallow) TestFetchShallowRepository(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-1", 1)
+
+	r.Remotes[DefaultRemoteName].upSrv = &fixtureUploadPackService{c: c, name: "fetch-shallow", refs: map[string]core.Hash{
+		"refs/heads/master":  shallowHead,
+		"refs/heads/feature": fetchFeature2,
+	}}
+	c.Assert(r.Fetch(&FetchOptions{}), IsNil)
+
+	shallows, err := r.Shallows.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(shallows, DeepEquals, []core.Hash{shallowHead})
+
+	iter, err := r.Log(LogOptions{From: fetchFeature2})
+	c.Assert(err, IsNil)
+	c.Assert(logHashes(c, iter), HasLen, 4)
+}
+
+func (s *SuiteShallow) TestFetchShallowRepositoryNotSupported(c *C) {
+	r, err := NewRepository(RepositoryFixture, nil)
+	c.Assert(err, IsNil)
+
+	s.pull(c, r, "depth-1", 1)
+
+	r.Remotes[DefaultRemoteName].upSrv = &fixtureUploadPackService{c: c, noShallow: true, refs: map[string]core.Hash{
+		"refs/heads/master":  shallowHead,
+		"refs/heads/feature": fetchFeature2,
+	}}
+	c.Assert(r.Fetch(&FetchOptions{}), Equals, ErrShallowNotSupported)
+}
@@ -0,0 +1,137 @@
+package git
+
+import (
+	"sort"
+	"strings"
+)
+
+// ShortlogGroup is the key the commits are grouped by in Shortlog.
+type ShortlogGroup int
+
+const (
+	// ShortlogGroupName groups the commits by the name of their author, as
+	// git shortlog does by default.
+	ShortlogGroupName ShortlogGroup = iota
+	// ShortlogGroupEmail groups the commits by the email of their author,
+	// so the commits of an author using several names are counted together.
+	ShortlogGroupEmail
+)
+
+// ShortlogOptions are the options of Shortlog, the commits counted are the
+// ones Log returns with the same LogOptions.
+type ShortlogOptions struct {
+	LogOptions
+	// Group is the key the commits are grouped by.
+	Group ShortlogGroup
+	// Summaries returns the summaries of the commits of every author.
+	Summaries bool
+}
+
+// ShortlogEntry is an author of the commits returned by Shortlog, with the
+// number of commits. The name or email not grouped by is the one of the first
+// commit found.
+type ShortlogEntry struct {
+	Name  string
+	Email string
+	Count int
+	// Summaries are the first lines of the messages of the commits, in the
+	// order they were found, if requested.
+	Summaries []string
+}
+
+// Shortlog returns the authors of the commits Log returns with the given
+// options, grouped by name or email, as git shortlog does, sorted by number
+// of commits, descending, and then by their key. The history is walked once.
+//
+// The names are trimmed and the emails are trimmed and compared ignoring
+// case, to group the commits of the same author written by different tools.
+func (r *Repository) Shortlog(opts ShortlogOptions) ([]ShortlogEntry, error) {
+	iter, err := r.Log(opts.LogOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ShortlogEntry
+	var keys []string
+	byKey := make(map[string]*ShortlogEntry)
+	err = iter.ForEach(func(c *Commit) error {
+		name := strings.TrimSpace(c.Author.Name)
+		email := strings.TrimSpace(c.Author.Email)
+
+		key := name
+		if opts.Group == ShortlogGroupEmail {
+			key = strings.ToLower(email)
+		}
+
+		e, ok := byKey[key]
+		if !ok {
+			e = &ShortlogEntry{Name: name, Email: email}
+			byKey[key] = e
+			entries = append(entries, e)
+			keys = append(keys, key)
+		}
+
+		e.Count++
+		if opts.Summaries {
+			e.Summaries = append(e.Summaries, commitSummary(c.Message))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(&shortlogSort{entries, keys})
+	result := make([]ShortlogEntry, len(entries))
+	for i, e := range entries {
+		result[i] = *e
+	}
+
+	return result, nil
+}
+
+// commitSummary returns the first paragraph of the message, its lines joined
+// by spaces, as git does with the subject of the commits. The blank lines at
+// the beginning are skipped.
+func commitSummary(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if len(lines) != 0 {
+				break
+			}
+
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, " ")
+}
+
+// shortlogSort implements sort.Interface, sorting the entries by count,
+// descending, and then by key.
+type shortlogSort struct {
+	entries []*ShortlogEntry
+	keys    []string
+}
+
+func (s *shortlogSort) Len() int {
+	return len(s.entries)
+}
+
+func (s *shortlogSort) Less(i, j int) bool {
+	if s.entries[i].Count != s.entries[j].Count {
+		return s.entries[i].Count > s.entries[j].Count
+	}
+
+	return s.keys[i] < s.keys[j]
+}
+
+func (s *shortlogSort) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SuiteLog) TestShortlog(c *C) {
+	var commits []*Commit
+	for _, t := range []struct{ name, email, message string }{
+		{"Alice", "alice@example.com", "first\n"},
+		{"Bob", "bob@example.com", "second\nline\n\nbody\n"},
+		{"Alice Smith", "Alice@Example.com", "third\n"},
+		{"Bob", "bob@example.com", "\nfourth\n"},
+		{"Alice", "alice@example.com", "fifth"},
+	} {
+		commits = append(commits, &Commit{
+			Author:  Signature{Name: t.name, Email: t.email},
+			Message: t.message,
+		})
+	}
+
+	r, h := commitLine(c, commits)
+	for _, t := range []struct {
+		opts     ShortlogOptions
+		expected []ShortlogEntry
+	}{
+		{
+			ShortlogOptions{LogOptions: LogOptions{From: h}},
+			[]ShortlogEntry{
+				{Name: "Alice", Email: "alice@example.com", Count: 2},
+				{Name: "Bob", Email: "bob@example.com", Count: 2},
+				{Name: "Alice Smith", Email: "Alice@Example.com", Count: 1},
+			},
+		},
+		{
+			ShortlogOptions{LogOptions: LogOptions{From: h}, Summaries: true},
+			[]ShortlogEntry{
+				{Name: "Alice", Email: "alice@example.com", Count: 2, Summaries: []string{"fifth", "first"}},
+				{Name: "Bob", Email: "bob@example.com", Count: 2, Summaries: []string{"fourth", "second line"}},
+				{Name: "Alice Smith", Email: "Alice@Example.com", Count: 1, Summaries: []string{"third"}},
+			},
+		},
+		{
+			ShortlogOptions{LogOptions: LogOptions{From: h}, Group: ShortlogGroupEmail},
+			[]ShortlogEntry{
+				{Name: "Alice", Email: "alice@example.com", Count: 3},
+				{Name: "Bob", Email: "bob@example.com", Count: 2},
+			},
+		},
+		{
+			ShortlogOptions{LogOptions: LogOptions{From: commits[2].ParentHashes[0]}, Group: ShortlogGroupEmail},
+			[]ShortlogEntry{
+				{Name: "Alice", Email: "alice@example.com", Count: 1},
+				{Name: "Bob", Email: "bob@example.com", Count: 1},
+			},
+		},
+	} {
+		entries, err := r.Shortlog(t.opts)
+		c.Assert(err, IsNil)
+		c.Assert(entries, DeepEquals, t.expected, Commentf("opts=%+v", t.opts))
+	}
+}
+
+// the expected counts have been obtained with git shortlog -s
+func (s *SuiteLog) TestShortlogLogOptions(c *C) {
+	master := core.NewHash("972eb2a3177a422bd2b0ad4991df73d32e0fc763")
+	for _, t := range []struct {
+		opts     LogOptions
+		expected int
+	}{
+		{LogOptions{From: master}, 15},
+		{LogOptions{From: master, FirstParent: true}, 8},
+		{LogOptions{From: master, Path: "master.txt"}, 4},
+		{LogOptions{From: master, Path: "feature.txt", FirstParent: true}, 2},
+	} {
+		entries, err := s.merges.Shortlog(ShortlogOptions{LogOptions: t.opts})
+		c.Assert(err, IsNil)
+		c.Assert(entries, DeepEquals, []ShortlogEntry{
+			{Name: "John Doe", Email: "john@doe.com", Count: t.expected},
+		}, Commentf("opts=%+v", t.opts))
+	}
+}
+
+func (s *SuiteLog) TestShortlogObjectNotFound(c *C) {
+	_, err := s.merges.Shortlog(ShortlogOptions{LogOptions: LogOptions{
+		From: core.NewHash("0000000000000000000000000000000000000001"),
+	}})
+	c.Assert(err, Equals, ErrObjectNotFound)
+}
+
+func (s *SuiteLog) TestCommitSummary(c *C) {
+	for i, t := range []struct{ message, expected string }{
+		{"", ""},
+		{"foo", "foo"},
+		{"foo\n", "foo"},
+		{"foo\nbar\n\nbaz\n", "foo bar"},
+		{"\n\nfoo  \r\nbar\n", "foo bar"},
+	} {
+		c.Assert(commitSummary(t.message), Equals, t.expected, Commentf("%d", i))
+	}
+}
@@ -0,0 +1,294 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/src-d/go-git.v3/diff"
+)
+
+// statWidth is the width of the lines of FileStats.String, the one git uses
+// when the output is not a terminal.
+const statWidth = 80
+
+// FileStat is the number of lines inserted and deleted in a file by a
+// change. The lines of binary files are not counted, their sizes before and
+// after the change are given instead.
+type FileStat struct {
+	Name     string
+	Addition int
+	Deletion int
+	Binary   bool
+	FromSize int64
+	ToSize   int64
+}
+
+// FileStats are the FileStat of the files changed by a commit, sorted by
+// path, see Commit.Stats.
+type FileStats []FileStat
+
+// Stats returns the FileStats of the files changed by the commit, compared
+// with its first parent, or with an empty tree if it has no parents, the
+// same files git show --stat --no-renames shows. A file whose mode
+// changes but not its content is returned without insertions or deletions.
+func (c *Commit) Stats() (FileStats, error) {
+	to, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var from *Tree
+	if len(c.ParentHashes) != 0 {
+		parent, err := c.r.Commit(c.ParentHashes[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if from, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(FileStats, 0, len(changes))
+	for _, ch := range changes {
+		s, err := changeStat(ch)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// changeStat returns the FileStat of the change, counting the lines of a
+// Myers diff of both versions of the file, as Patch does.
+func changeStat(c *Change) (FileStat, error) {
+	s := FileStat{Name: c.Name}
+	if c.Action == Modify && c.From.Hash == c.To.Hash {
+		return s, nil
+	}
+
+	src, err := fileContents(c.Files[0])
+	if err != nil {
+		return s, err
+	}
+
+	dst, err := fileContents(c.Files[1])
+	if err != nil {
+		return s, err
+	}
+
+	if isBinary(src) || isBinary(dst) {
+		s.Binary = true
+		s.FromSize, s.ToSize = int64(len(src)), int64(len(dst))
+		return s, nil
+	}
+
+	for _, l := range patchLines(diff.Do(src, dst)) {
+		switch l.op {
+		case '+':
+			s.Addition++
+		case '-':
+			s.Deletion++
+		}
+	}
+
+	return s, nil
+}
+
+// Insertions returns the number of lines inserted in all the files.
+func (s FileStats) Insertions() int {
+	var n int
+	for _, f := range s {
+		n += f.Addition
+	}
+
+	return n
+}
+
+// Deletions returns the number of lines deleted in all the files.
+func (s FileStats) Deletions() int {
+	var n int
+	for _, f := range s {
+		n += f.Deletion
+	}
+
+	return n
+}
+
+// String returns the stats in the format of git diff --stat: a line for
+// every file, with the number of lines changed and a graph of the insertions
+// and deletions, scaled to fit in 80 columns, and a summary line. The paths
+// too long to fit are abbreviated with "..." at their beginning.
+func (s FileStats) String() string {
+	var nameWidth, maxChange, numberWidth, binWidth int
+	for _, f := range s {
+		if w := utf8.RuneCountInString(f.Name); w > nameWidth {
+			nameWidth = w
+		}
+
+		if f.Binary {
+			// "Bin XXX -> YYY bytes", the counts aligned with "Bin"
+			w := 14 + decimalWidth(f.FromSize) + decimalWidth(f.ToSize)
+			if w > binWidth {
+				binWidth = w
+			}
+
+			numberWidth = 3
+			continue
+		}
+
+		if change := f.Addition + f.Deletion; change > maxChange {
+			maxChange = change
+		}
+	}
+
+	if w := decimalWidth(int64(maxChange)); w > numberWidth {
+		numberWidth = w
+	}
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+
+	// the name takes at least 5/8 of the width, and the graph 3/8 of it
+	// minus the separators, if they do not fit
+	width := statWidth
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for _, f := range s {
+		fmt.Fprintf(buf, " %s | ", statName(f.Name, nameWidth))
+		if f.Binary {
+			fmt.Fprintf(buf, "%*s", numberWidth, "Bin")
+			if f.FromSize != 0 || f.ToSize != 0 {
+				fmt.Fprintf(buf, " %d -> %d bytes", f.FromSize, f.ToSize)
+			}
+
+			buf.WriteByte('\n')
+			continue
+		}
+
+		add, del := f.Addition, f.Deletion
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add != 0 && del != 0 {
+				total = 2
+			}
+
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+
+		fmt.Fprintf(buf, "%*d", numberWidth, f.Addition+f.Deletion)
+		if add+del != 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(strings.Repeat("+", add))
+		buf.WriteString(strings.Repeat("-", del))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString(s.summary())
+	return buf.String()
+}
+
+// summary returns the last line of String, the number of files changed, and
+// of lines inserted and deleted, omitting the one that is zero if the other
+// is not, as git does.
+func (s FileStats) summary() string {
+	if len(s) == 0 {
+		return " 0 files changed\n"
+	}
+
+	ins, del := s.Insertions(), s.Deletions()
+	summary := fmt.Sprintf(" %d %s changed", len(s), plural(len(s), "file", "files"))
+	if ins != 0 || del == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", ins, plural(ins, "insertion", "insertions"))
+	}
+
+	if del != 0 || ins == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", del, plural(del, "deletion", "deletions"))
+	}
+
+	return summary + "\n"
+}
+
+// statName returns the name padded to the given width, or abbreviated to it,
+// starting with "..." and then its components ending it that fit, if any.
+func statName(name string, width int) string {
+	n := utf8.RuneCountInString(name)
+	if n > width {
+		runes := []rune(name)
+		keep := width - 3
+		if keep < 0 {
+			keep = 0
+		}
+
+		name = string(runes[len(runes)-keep:])
+		if i := strings.IndexByte(name, '/'); i != -1 {
+			name = name[i:]
+		}
+
+		name = "..." + name
+		n = utf8.RuneCountInString(name)
+	}
+
+	if n < width {
+		name += strings.Repeat(" ", width-n)
+	}
+
+	return name
+}
+
+// scaleLinear scales it, out of max, to the given width, so at least one
+// column is used if it is not zero.
+func scaleLinear(it, width, max int) int {
+	if it == 0 {
+		return 0
+	}
+
+	return 1 + it*(width-1)/max
+}
+
+func decimalWidth(n int64) int {
+	return len(strconv.FormatInt(n, 10))
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+
+	return plural
+}
@@ -0,0 +1,132 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// statsFixture is a repository written by git with a line of commits
+// inserting, deleting and modifying text and binary files, and changing
+// only the mode of a file.
+const statsFixture = "fixtures/stats.tgz"
+
+// the commits of statsFixture, the oldest first
+const (
+	statsInitial  = "5319342faa047df77cf67b634d287330af8e66eb"
+	statsChanges  = "ca3d4a2f307e96bfa038a3de92741eaaf5babf64"
+	statsScaling  = "bff029f74200c0fcaa868ef7904467c21e3adb0a"
+	statsDeletion = "10a8d846e43e567f57af6c58a4e8dae533b839c7"
+)
+
+type SuiteStats struct {
+	dir string
+	r   *Repository
+}
+
+var _ = Suite(&SuiteStats{})
+
+func (s *SuiteStats) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(statsFixture)
+	c.Assert(err, IsNil)
+
+	s.r, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteStats) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *SuiteStats) TestStats(c *C) {
+	commit, err := s.r.Commit(core.NewHash(statsChanges))
+	c.Assert(err, IsNil)
+
+	stats, err := commit.Stats()
+	c.Assert(err, IsNil)
+	c.Assert(stats, DeepEquals, FileStats{
+		{Name: "README", Addition: 3, Deletion: 1},
+		{Name: "big.txt", Addition: 150},
+		{Name: "bin.dat", Binary: true, FromSize: 100, ToSize: 200},
+		{Name: "docs/guide.md", Deletion: 10},
+		{Name: "empty"},
+		{Name: "script.sh"},
+		{Name: "very/long/path/to/some/deeply/nested/directory/of/files/file.txt", Addition: 5},
+	})
+
+	c.Assert(stats.Insertions(), Equals, 158)
+	c.Assert(stats.Deletions(), Equals, 11)
+}
+
+// the expected output has been obtained with git show --stat --no-renames
+func (s *SuiteStats) TestStatsString(c *C) {
+	for _, t := range []struct {
+		commit   string
+		expected string
+	}{
+		{statsInitial, "" +
+			" README        |   3 +++\n" +
+			" bin.dat       | Bin 0 -> 100 bytes\n" +
+			" docs/guide.md |  10 ++++++++++\n" +
+			" script.sh     |   2 ++\n" +
+			" 4 files changed, 15 insertions(+)\n",
+		},
+		{statsChanges, "" +
+			" README                                             |   4 +-\n" +
+			" big.txt                                            | 150 +++++++++++++++++++++\n" +
+			" bin.dat                                            | Bin 100 -> 200 bytes\n" +
+			" docs/guide.md                                      |  10 --\n" +
+			" empty                                              |   0\n" +
+			" script.sh                                          |   0\n" +
+			" .../some/deeply/nested/directory/of/files/file.txt |   5 +\n" +
+			" 7 files changed, 158 insertions(+), 11 deletions(-)\n",
+		},
+		{statsScaling, "" +
+			" big.txt   | 248 +++++++++++++++++++++++++-------------------------------------\n" +
+			" script.sh |   0\n" +
+			" 2 files changed, 101 insertions(+), 147 deletions(-)\n",
+		},
+		{statsDeletion, "" +
+			" README | 2 --\n" +
+			" 1 file changed, 2 deletions(-)\n",
+		},
+	} {
+		commit, err := s.r.Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil)
+
+		stats, err := commit.Stats()
+		c.Assert(err, IsNil)
+		c.Assert(stats.String(), Equals, t.expected, Commentf("commit=%s", t.commit))
+	}
+}
+
+func (s *SuiteStats) TestStatsStringEmpty(c *C) {
+	c.Assert(FileStats{}.String(), Equals, " 0 files changed\n")
+	c.Assert(FileStats{{Name: "foo", Binary: true}}.String(), Equals, ""+
+		" foo | Bin\n"+
+		" 1 file changed, 0 insertions(+), 0 deletions(-)\n")
+}
+
+func (s *SuiteStats) TestStatName(c *C) {
+	for _, t := range []struct {
+		name     string
+		width    int
+		expected string
+	}{
+		{"foo", 5, "foo  "},
+		{"foo/bar", 7, "foo/bar"},
+		{"foo/bar/baz", 8, ".../baz "},
+		{"foo/bar/baz", 10, ".../baz   "},
+		{"foo/barbaz", 8, "...arbaz"},
+		{"ñandú/ü", 5, ".../ü"},
+		{"foo", 2, "..."},
+	} {
+		c.Assert(statName(t.name, t.width), Equals, t.expected, Commentf("name=%s width=%d", t.name, t.width))
+	}
+}
@@ -0,0 +1,390 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/gitignore"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+)
+
+// StatusCode is the status of a file in the index, compared to HEAD, or in
+// the worktree, compared to the index, with the codes of git status
+// --porcelain.
+type StatusCode byte
+
+const (
+	Unmodified StatusCode = ' '
+	Untracked  StatusCode = '?'
+	Ignored    StatusCode = '!'
+	Modified   StatusCode = 'M'
+	Added      StatusCode = 'A'
+	Deleted    StatusCode = 'D'
+	// UpdatedButUnmerged is the status of the sides of a conflict that
+	// changed the file, the other ones are Added or Deleted.
+	UpdatedButUnmerged StatusCode = 'U'
+)
+
+// FileStatus is the status of a file of a Status.
+type FileStatus struct {
+	// Staging is the status of the file in the index, compared to HEAD.
+	Staging StatusCode
+	// Worktree is the status of the file in the worktree, compared to the
+	// index.
+	Worktree StatusCode
+}
+
+// Status is the status of the files of a worktree, by path, relative to its
+// root, the ones that are not unmodified, see Worktree.Status.
+type Status map[string]*FileStatus
+
+// File returns the status of the file with the given path, unmodified if it
+// is not in the Status.
+func (s Status) File(path string) *FileStatus {
+	if st, ok := s[path]; ok {
+		return st
+	}
+
+	return &FileStatus{Staging: Unmodified, Worktree: Unmodified}
+}
+
+// IsClean returns true if every file is unmodified, or ignored.
+func (s Status) IsClean() bool {
+	for _, st := range s {
+		if st.Worktree != Ignored {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the status in the format of git status --porcelain, see
+// Porcelain, without the ignored files.
+func (s Status) String() string {
+	return s.Porcelain(false)
+}
+
+// Porcelain returns the status in the format of git status --porcelain, and
+// --ignored if ignored is true: a line per file with its codes and its path,
+// quoted as git does if it has unusual characters. The tracked files come
+// first, then the untracked ones and then the ignored ones, each of them
+// sorted by path, as git shows them.
+func (s Status) Porcelain(ignored bool) string {
+	var tracked, untracked, ignoredPaths []string
+	for p, st := range s {
+		switch st.Worktree {
+		case Untracked:
+			untracked = append(untracked, p)
+		case Ignored:
+			ignoredPaths = append(ignoredPaths, p)
+		default:
+			tracked = append(tracked, p)
+		}
+	}
+
+	groups := [][]string{tracked, untracked}
+	if ignored {
+		groups = append(groups, ignoredPaths)
+	}
+
+	var buf bytes.Buffer
+	for _, paths := range groups {
+		sort.Strings(paths)
+		for _, p := range paths {
+			st := s[p]
+			fmt.Fprintf(&buf, "%c%c %s\n", st.Staging, st.Worktree, quotePath(p))
+		}
+	}
+
+	return buf.String()
+}
+
+// quotePath returns the path between double quotes, with its control
+// characters, double quotes, backslashes and bytes out of ASCII escaped, if
+// it has any of them, as git quotes the paths by default.
+func quotePath(p string) string {
+	if strings.IndexFunc(p, func(r rune) bool {
+		return r < 0x20 || r == '"' || r == '\\' || r >= 0x7f
+	}) == -1 {
+		return p
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&buf, `\%03o`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// conflictCodes are the codes of the conflicts by their stages, a bit per
+// stage, index.AncestorStage the least significant one, as git status shows
+// them.
+var conflictCodes = map[int][2]StatusCode{
+	1: {Deleted, Deleted},
+	2: {Added, UpdatedButUnmerged},
+	3: {UpdatedButUnmerged, Deleted},
+	4: {UpdatedButUnmerged, Added},
+	5: {Deleted, UpdatedButUnmerged},
+	6: {Added, Added},
+	7: {UpdatedButUnmerged, UpdatedButUnmerged},
+}
+
+// Status returns the status of the worktree, as git status does: the
+// changes of its index compared to the tree of HEAD, none if HEAD is an
+// unborn branch, and the changes of the files of the worktree compared to
+// the index. The untracked files are listed one by one, unless they are
+// ignored by the .gitignore files of the worktree, and so are the ignored
+// ones, but the directories whose files are all ignored are listed as a
+// whole, with a trailing slash. The renames are not detected.
+//
+// The files whose size and modification time are the ones of their entry
+// of the index are assumed to be unmodified, without reading them, as git
+// does.
+func (w *Worktree) Status() (Status, error) {
+	head, err := w.headFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := w.r.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	s := Status{}
+	set := func(name string, staging, worktree StatusCode) {
+		if staging != Unmodified || worktree != Unmodified {
+			s[name] = &FileStatus{Staging: staging, Worktree: worktree}
+		}
+	}
+
+	tracked := make(map[string]bool, len(idx.Entries))
+	for i := 0; i < len(idx.Entries); i++ {
+		e := idx.Entries[i]
+		tracked[e.Name] = true
+		if e.Stage != index.Merged {
+			var stages int
+			for ; i < len(idx.Entries) && idx.Entries[i].Name == e.Name; i++ {
+				stages |= 1 << uint(idx.Entries[i].Stage-1)
+			}
+
+			i--
+			codes := conflictCodes[stages]
+			set(e.Name, codes[0], codes[1])
+			continue
+		}
+
+		staging := Unmodified
+		if h, ok := head[e.Name]; !ok {
+			staging = Added
+		} else if h.Hash != e.Hash || h.Mode != e.Mode {
+			staging = Modified
+		}
+
+		worktree, err := w.entryStatus(e)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.IntentToAdd {
+			staging, worktree = Unmodified, Added
+		}
+
+		set(e.Name, staging, worktree)
+	}
+
+	for name := range head {
+		if !tracked[name] {
+			set(name, Deleted, Unmodified)
+		}
+	}
+
+	return s, w.untrackedStatus(s, tracked, "", nil)
+}
+
+// headFiles returns the blobs and submodules of the tree of HEAD, by path,
+// none if HEAD is an unborn branch.
+func (w *Worktree) headFiles() (map[string]TreeEntry, error) {
+	ref, err := w.r.Head()
+	if err == core.ErrReferenceNotFound {
+		return map[string]TreeEntry{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := w.r.Commit(ref.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return treeFiles(tree)
+}
+
+// treeFiles returns the blobs and submodules of the given tree, and its
+// subtrees, by path.
+func treeFiles(tree *Tree) (map[string]TreeEntry, error) {
+	files := map[string]TreeEntry{}
+	return files, tree.Walk(func(p string, e TreeEntry) error {
+		if e.Mode != treeEntryDirMode {
+			files[p] = e
+		}
+
+		return nil
+	})
+}
+
+// entryStatus returns the status of the file of the given entry in the
+// worktree, compared to the entry.
+func (w *Worktree) entryStatus(e *index.Entry) (StatusCode, error) {
+	if e.SkipWorktree {
+		return Unmodified, nil
+	}
+
+	full := w.fullPath(e.Name)
+	fi, err := w.lstat(full)
+	if os.IsNotExist(err) || err == nil && fi.IsDir() != isSubmoduleMode(e.Mode) {
+		return Deleted, nil
+	}
+
+	if err != nil {
+		return Unmodified, err
+	}
+
+	if isSubmoduleMode(e.Mode) {
+		return Unmodified, nil
+	}
+
+	if fileMode(fi) != e.Mode {
+		return Modified, nil
+	}
+
+	if e.Size == uint32(fi.Size()) && e.ModifiedAt.Equal(fi.ModTime()) {
+		return Unmodified, nil
+	}
+
+	content, _, err := w.readFile(full, fi)
+	if err == ErrUnsupportedFile {
+		return Modified, nil
+	}
+
+	if err != nil {
+		return Unmodified, err
+	}
+
+	if w.r.ObjectFormat().ComputeHash(core.BlobObject, content) != e.Hash {
+		return Modified, nil
+	}
+
+	return Unmodified, nil
+}
+
+// untrackedStatus adds the untracked and ignored files of the directory with
+// the given name, and its subdirectories, to s, with the patterns of the
+// .gitignore files of its parents.
+func (w *Worktree) untrackedStatus(s Status, tracked map[string]bool, dir string, patterns []gitignore.Pattern) error {
+	var domain []string
+	if dir != "" {
+		domain = strings.Split(dir, "/")
+	}
+
+	patterns, err := w.readGitignore(dir, domain, patterns)
+	if err != nil {
+		return err
+	}
+
+	m := gitignore.NewMatcher(patterns)
+	infos, err := w.fs.ReadDir(w.fullPath(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+		if fi.Name() == gitDirName || tracked[name] {
+			continue
+		}
+
+		ignored := m.Match(append(domain, fi.Name()), fi.IsDir())
+		if !fi.IsDir() {
+			if ignored {
+				s[name] = &FileStatus{Staging: Ignored, Worktree: Ignored}
+			} else {
+				s[name] = &FileStatus{Staging: Untracked, Worktree: Untracked}
+			}
+
+			continue
+		}
+
+		if ignored && !hasTracked(tracked, name) {
+			s[name+"/"] = &FileStatus{Staging: Ignored, Worktree: Ignored}
+			continue
+		}
+
+		if err := w.untrackedStatus(s, tracked, name, patterns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasTracked returns true if any of the tracked files is in the directory
+// with the given name.
+func hasTracked(tracked map[string]bool, dir string) bool {
+	for name := range tracked {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readGitignore returns the given patterns with the ones of the .gitignore
+// file of the directory with the given name appended, if it has one.
+func (w *Worktree) readGitignore(dir string, domain []string, patterns []gitignore.Pattern) ([]gitignore.Pattern, error) {
+	f, err := w.fs.Open(w.fullPath(path.Join(dir, gitignoreFile)))
+	if os.IsNotExist(err) {
+		return patterns, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ps, err := gitignore.ParsePatterns(f, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(patterns[:len(patterns):len(patterns)], ps...), nil
+}
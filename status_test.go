@@ -0,0 +1,169 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+
+	. "gopkg.in/check.v1"
+)
+
+// commitIndex commits the index, on top of HEAD.
+func (s *SuiteWorktree) commitIndex(c *C) {
+	_, err := s.w.Commit("foo", commitOptions(0))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteWorktree) status(c *C) Status {
+	status, err := s.w.Status()
+	c.Assert(err, IsNil)
+	return status
+}
+
+func (s *SuiteWorktree) TestStatus(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.writeFile(c, "bar", "bar\n", 0644)
+	c.Assert(s.status(c).String(), Equals, "?? bar\n?? foo\n")
+
+	for _, name := range []string{"foo", "bar"} {
+		_, err := s.w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(s.status(c).String(), Equals, "A  bar\nA  foo\n")
+
+	s.commitIndex(c)
+	status := s.status(c)
+	c.Assert(status.IsClean(), Equals, true)
+	c.Assert(status.File("foo"), DeepEquals, &FileStatus{Staging: Unmodified, Worktree: Unmodified})
+
+	s.writeFile(c, "foo", "qux\n", 0644)
+	s.writeFile(c, "baz", "baz\n", 0644)
+	c.Assert(os.Remove(filepath.Join(s.dir, "bar")), IsNil)
+	status = s.status(c)
+	c.Assert(status.IsClean(), Equals, false)
+	c.Assert(status.String(), Equals, " D bar\n M foo\n?? baz\n")
+
+	for _, name := range []string{"foo", "bar", "baz"} {
+		_, err := s.w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(s.status(c).String(), Equals, "D  bar\nA  baz\nM  foo\n")
+
+	// modified again after being staged
+	s.writeFile(c, "baz", "qux\n", 0755)
+	c.Assert(s.status(c).String(), Equals, "D  bar\nAM baz\nM  foo\n")
+}
+
+func (s *SuiteWorktree) TestStatusStatCache(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	_, err := s.w.Add("foo")
+	c.Assert(err, IsNil)
+	s.commitIndex(c)
+
+	// the same size and modification time, the content is not compared
+	path := filepath.Join(s.dir, "foo")
+	fi, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	s.writeFile(c, "foo", "bar\n", 0644)
+	c.Assert(os.Chtimes(path, fi.ModTime(), fi.ModTime()), IsNil)
+	c.Assert(s.status(c).IsClean(), Equals, true)
+
+	// the content is compared if the modification time changed
+	mtime := fi.ModTime().Add(time.Second)
+	c.Assert(os.Chtimes(path, mtime, mtime), IsNil)
+	c.Assert(s.status(c).String(), Equals, " M foo\n")
+
+	s.writeFile(c, "foo", "foo\n", 0644)
+	c.Assert(os.Chtimes(path, mtime, mtime), IsNil)
+	c.Assert(s.status(c).IsClean(), Equals, true)
+}
+
+func (s *SuiteWorktree) TestStatusIgnored(c *C) {
+	s.writeFile(c, ".gitignore", "*.log\nbuild/\n", 0644)
+	s.writeFile(c, "foo.log", "foo\n", 0644)
+	s.writeFile(c, "build/foo", "foo\n", 0644)
+	s.writeFile(c, "src/foo", "foo\n", 0644)
+	s.writeFile(c, "src/bar.log", "bar\n", 0644)
+	s.writeFile(c, "src/.gitignore", "!bar.log\nfoo\n", 0644)
+
+	status := s.status(c)
+	c.Assert(status.String(), Equals, ""+
+		"?? .gitignore\n"+
+		"?? src/.gitignore\n"+
+		"?? src/bar.log\n")
+	c.Assert(status.Porcelain(true), Equals, ""+
+		"?? .gitignore\n"+
+		"?? src/.gitignore\n"+
+		"?? src/bar.log\n"+
+		"!! build/\n"+
+		"!! foo.log\n"+
+		"!! src/foo\n")
+
+	// the tracked files are never ignored
+	_, err := s.w.Add("foo.log")
+	c.Assert(err, IsNil)
+	c.Assert(s.status(c).File("foo.log"), DeepEquals, &FileStatus{Staging: Added, Worktree: Unmodified})
+}
+
+func (s *SuiteWorktree) TestStatusMode(c *C) {
+	s.writeFile(c, "run.sh", "#!/bin/sh\n", 0644)
+	_, err := s.w.Add("run.sh")
+	c.Assert(err, IsNil)
+	s.commitIndex(c)
+
+	c.Assert(os.Chmod(filepath.Join(s.dir, "run.sh"), 0755), IsNil)
+	c.Assert(s.status(c).String(), Equals, " M run.sh\n")
+
+	_, err = s.w.Add("run.sh")
+	c.Assert(err, IsNil)
+	c.Assert(s.status(c).String(), Equals, "M  run.sh\n")
+}
+
+func (s *SuiteWorktree) TestStatusString(c *C) {
+	status := Status{
+		"foo":       {Staging: Modified, Worktree: Unmodified},
+		"a\"b":      {Staging: Untracked, Worktree: Untracked},
+		"tab\there": {Staging: Added, Worktree: Deleted},
+		"ñ":         {Staging: UpdatedButUnmerged, Worktree: UpdatedButUnmerged},
+		"bar":       {Staging: Ignored, Worktree: Ignored},
+		"baz":       {Staging: Untracked, Worktree: Untracked},
+	}
+
+	c.Assert(status.String(), Equals, ""+
+		"M  foo\n"+
+		"AD \"tab\\there\"\n"+
+		"UU \"\\303\\261\"\n"+
+		"?? \"a\\\"b\"\n"+
+		"?? baz\n")
+	c.Assert(status.Porcelain(true), Equals, status.String()+"!! bar\n")
+}
+
+func (s *SuiteWorktree) TestStatusConflicts(c *C) {
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+
+	h := core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99")
+	for _, e := range []struct {
+		name   string
+		stages []index.Stage
+	}{
+		{"both-added", []index.Stage{index.OurStage, index.TheirStage}},
+		{"both-modified", []index.Stage{index.AncestorStage, index.OurStage, index.TheirStage}},
+		{"deleted-by-them", []index.Stage{index.AncestorStage, index.OurStage}},
+	} {
+		s.writeFile(c, e.name, "foo\n", 0644)
+		for _, stage := range e.stages {
+			idx.Entries = append(idx.Entries, &index.Entry{
+				Name: e.name, Hash: h, Mode: treeEntryRegularMode, Stage: stage,
+			})
+		}
+	}
+
+	c.Assert(s.r.SetIndex(idx), IsNil)
+	c.Assert(s.status(c).String(), Equals, "AA both-added\nUU both-modified\nUD deleted-by-them\n")
+}
@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/commitgraph"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const (
+	infoPath        = "info"
+	commitGraphPath = "commit-graph"
+)
+
+// CommitGraph returns the commit-graph file of the objects directory,
+// info/commit-graph, or nil if there is none. The file is read the first
+// time, and kept in memory afterwards, until a new one is written. It is
+// always nil for the repositories of another format than core.SHA1, the
+// only one supported by the commitgraph package.
+func (s *ObjectStorage) CommitGraph() (*commitgraph.CommitGraph, error) {
+	if s.format != core.SHA1 {
+		return nil, nil
+	}
+
+	s.m.RLock()
+	g, loaded := s.graph, s.graphLoaded
+	s.m.RUnlock()
+	if loaded {
+		return g, nil
+	}
+
+	f, err := s.fs.Open(s.fs.Join(s.dir, infoPath, commitGraphPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		defer f.Close()
+
+		g = &commitgraph.CommitGraph{}
+		if err := commitgraph.NewDecoder(f).Decode(g); err != nil {
+			return nil, err
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.graphLoaded {
+		s.graph, s.graphLoaded = g, true
+	}
+
+	return s.graph, nil
+}
+
+// WriteCommitGraph writes the given commit-graph to the commit-graph file
+// of the objects directory, replacing the current one, if any. The file is
+// written to its lock file, info/commit-graph.lock, renamed when complete,
+// so ErrLocked is returned if the file is locked by another writer.
+// ErrReadOnly is returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ObjectStorage) WriteCommitGraph(g *commitgraph.CommitGraph) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	if err := wfs.MkdirAll(s.fs.Join(s.dir, infoPath), 0755); err != nil {
+		return err
+	}
+
+	path := s.fs.Join(s.dir, infoPath, commitGraphPath)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil {
+			wfs.Remove(lock.Name())
+			return
+		}
+
+		s.m.Lock()
+		s.graph, s.graphLoaded = g, true
+		s.m.Unlock()
+	}()
+
+	if _, err := commitgraph.NewEncoder(lock).Encode(g); err != nil {
+		return err
+	}
+
+	return lock.Sync()
+}
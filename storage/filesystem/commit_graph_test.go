@@ -0,0 +1,81 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/commitgraph"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type CommitGraphSuite struct {
+	dir     string
+	storage *filesystem.ObjectStorage
+}
+
+var _ = Suite(&CommitGraphSuite{})
+
+func (s *CommitGraphSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.ObjectStorage().(*filesystem.ObjectStorage)
+}
+
+func (s *CommitGraphSuite) TestCommitGraph(c *C) {
+	g, err := s.storage.CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g, IsNil)
+
+	written, err := commitgraph.New([]commitgraph.Node{
+		{Hash: core.NewHash("0ac063db656012ad3b4617e13f6e5d3849b41426")},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(s.storage.WriteCommitGraph(written), IsNil)
+
+	g, err = s.storage.CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g, Equals, written)
+
+	path := filepath.Join(s.dir, "objects", "info", "commit-graph")
+	_, err = os.Stat(path + ".lock")
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	g, err = storage.ObjectStorage().(*filesystem.ObjectStorage).CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g.Hashes, DeepEquals, written.Hashes)
+}
+
+func (s *CommitGraphSuite) TestCommitGraphMalformed(c *C) {
+	dir := filepath.Join(s.dir, "objects", "info")
+	c.Assert(os.MkdirAll(dir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "commit-graph"), []byte("foo"), 0644), IsNil)
+
+	_, err := s.storage.CommitGraph()
+	c.Assert(err, Equals, commitgraph.ErrMalformedCommitGraph)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphLocked(c *C) {
+	dir := filepath.Join(s.dir, "objects", "info")
+	c.Assert(os.MkdirAll(dir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "commit-graph.lock"), nil, 0644), IsNil)
+
+	err := s.storage.WriteCommitGraph(&commitgraph.CommitGraph{})
+	c.Assert(err, Equals, filesystem.ErrLocked)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(err, IsNil)
+
+	err = storage.ObjectStorage().(*filesystem.ObjectStorage).WriteCommitGraph(&commitgraph.CommitGraph{})
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
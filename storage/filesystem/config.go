@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/formats/config"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const (
+	configPath = "config"
+	// maxIncludeDepth is the maximum depth of the included config files,
+	// the one of git.
+	maxIncludeDepth = 10
+)
+
+// ConfigStorage is an implementation of core.ConfigStorage for the config
+// file of a git directory.
+//
+// The file is rewritten when the fs.FS of the storage is a fs.WriteFS.
+type ConfigStorage struct {
+	fs  fs.FS
+	dir string
+}
+
+// NewConfigStorage returns a new ConfigStorage for the config of the git
+// directory at the given path.
+func NewConfigStorage(fs fs.FS, path string) *ConfigStorage {
+	return &ConfigStorage{fs: fs, dir: path}
+}
+
+// Config returns the config of the config file, empty if there is no such
+// file, with its includes resolved. As in git, the relative paths of the
+// includes are relative to the directory of the file including them, a
+// leading "~/" is the home directory of the user, and the files not found
+// are ignored. ErrIncludeDepth is returned if the includes are nested more
+// than 10 levels deep.
+func (s *ConfigStorage) Config() (*config.Config, error) {
+	return s.read(s.fs.Join(s.dir, configPath), 0)
+}
+
+func (s *ConfigStorage) read(path string, depth int) (*config.Config, error) {
+	c := config.New()
+	f, err := s.fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := config.NewDecoder(f).Decode(c); err != nil {
+		return nil, err
+	}
+
+	err = c.ResolveIncludes(func(include string) (*config.Config, error) {
+		if depth == maxIncludeDepth {
+			return nil, ErrIncludeDepth
+		}
+
+		return s.read(s.includePath(path, include), depth+1)
+	})
+
+	return c, err
+}
+
+// includePath returns the path of the file included with the given path by
+// the config file at from.
+func (s *ConfigStorage) includePath(from, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return s.fs.Join(home, path[2:])
+		}
+	}
+
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return s.fs.Join(filepath.Dir(from), path)
+}
+
+// SetConfig rewrites the config file with the given config, without the
+// sections of the files it includes.
+//
+// The file is written to its lock file, config.lock, renamed when complete,
+// so ErrLocked is returned if the file is locked by another writer.
+// ErrReadOnly is returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ConfigStorage) SetConfig(c *config.Config) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	path := s.fs.Join(s.dir, configPath)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil {
+			wfs.Remove(lock.Name())
+		}
+	}()
+
+	if err := config.NewEncoder(lock).Encode(c); err != nil {
+		return err
+	}
+
+	return lock.Sync()
+}
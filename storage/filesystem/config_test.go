@@ -0,0 +1,104 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct {
+	dir     string
+	storage core.ConfigStorage
+}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.ConfigStorage()
+}
+
+func (s *ConfigSuite) writeFile(c *C, path, content string) {
+	path = filepath.Join(s.dir, path)
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+}
+
+func (s *ConfigSuite) TestConfig(c *C) {
+	cfg, err := s.storage.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Sections, HasLen, 0)
+
+	// written by git init
+	s.writeFile(c, "config", "[core]\n"+
+		"\trepositoryformatversion = 0\n"+
+		"\tfilemode = true\n"+
+		"\tbare = false\n"+
+		"\tlogallrefupdates = true\n")
+
+	cfg, err = s.storage.Config()
+	c.Assert(err, IsNil)
+	bare, err := cfg.Bool("core", "", "bare", true)
+	c.Assert(err, IsNil)
+	c.Assert(bare, Equals, false)
+}
+
+func (s *ConfigSuite) TestConfigIncludes(c *C) {
+	abs := filepath.Join(c.MkDir(), "abs")
+	c.Assert(ioutil.WriteFile(abs, []byte("[user]\n\temail = foo@example.com\n"), 0644), IsNil)
+
+	s.writeFile(c, "config", "[include]\n\tpath = inc/a\n\tpath = missing\n\tpath = "+abs+"\n")
+	s.writeFile(c, "inc/a", "[user]\n\tname = Foo\n[include]\n\tpath = b\n")
+	s.writeFile(c, "inc/b", "[core]\n\tbare = true\n")
+
+	cfg, err := s.storage.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.String("user", "", "name"), Equals, "Foo")
+	c.Assert(cfg.String("user", "", "email"), Equals, "foo@example.com")
+	c.Assert(cfg.String("core", "", "bare"), Equals, "true")
+
+	s.writeFile(c, "inc/b", "[include]\n\tpath = a\n")
+	_, err = s.storage.Config()
+	c.Assert(err, Equals, filesystem.ErrIncludeDepth)
+}
+
+func (s *ConfigSuite) TestSetConfig(c *C) {
+	s.writeFile(c, "config", "# comment\n[include]\n\tpath = inc\n[core]\n\tbare = false\n")
+	s.writeFile(c, "inc", "[user]\n\tname = Foo\n")
+
+	cfg, err := s.storage.Config()
+	c.Assert(err, IsNil)
+	cfg.Set("core", "", "bare", "true")
+	cfg.Add("remote", "origin", "url", "https://github.com/src-d/go-git.git")
+	c.Assert(s.storage.SetConfig(cfg), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "config"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "# comment\n"+
+		"[include]\n"+
+		"\tpath = inc\n"+
+		"[core]\n"+
+		"\tbare = true\n"+
+		"[remote \"origin\"]\n"+
+		"\turl = https://github.com/src-d/go-git.git\n")
+
+	_, err = os.Stat(filepath.Join(s.dir, "config.lock"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ConfigSuite) TestSetConfigLocked(c *C) {
+	s.writeFile(c, "config.lock", "")
+
+	cfg, err := s.storage.Config()
+	c.Assert(err, IsNil)
+	c.Assert(s.storage.SetConfig(cfg), Equals, filesystem.ErrLocked)
+}
@@ -0,0 +1,91 @@
+package filesystem
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const indexPath = "index"
+
+// IndexStorage is the storage of the index of a git directory, its index
+// file, in the format of the objects of the directory.
+//
+// The file is rewritten when the fs.FS of the storage is a fs.WriteFS.
+type IndexStorage struct {
+	fs  fs.FS
+	dir string
+}
+
+// NewIndexStorage returns a new IndexStorage for the index of the git
+// directory at the given path.
+func NewIndexStorage(fs fs.FS, path string) *IndexStorage {
+	return &IndexStorage{fs: fs, dir: path}
+}
+
+// Index returns the index of the index file, empty if there is no such
+// file, as in the repositories without commits.
+func (s *IndexStorage) Index() (*index.Index, error) {
+	format, err := readObjectFormat(NewConfigStorage(s.fs, s.dir))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := index.New(format)
+	f, err := s.fs.Open(s.fs.Join(s.dir, indexPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return idx, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := index.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// SetIndex rewrites the index file with the given index.
+//
+// The file is written to its lock file, index.lock, renamed when complete,
+// so ErrLocked is returned if the file is locked by another writer, as git
+// does while it changes the index. ErrReadOnly is returned if the fs.FS of
+// the storage is not a fs.WriteFS.
+func (s *IndexStorage) SetIndex(idx *index.Index) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	path := s.fs.Join(s.dir, indexPath)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil {
+			wfs.Remove(lock.Name())
+		}
+	}()
+
+	if _, err := index.NewEncoder(lock).Encode(idx); err != nil {
+		return err
+	}
+
+	return lock.Sync()
+}
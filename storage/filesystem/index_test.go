@@ -0,0 +1,61 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type IndexSuite struct {
+	dir     string
+	storage *filesystem.IndexStorage
+}
+
+var _ = Suite(&IndexSuite{})
+
+func (s *IndexSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.IndexStorage()
+}
+
+func (s *IndexSuite) TestIndex(c *C) {
+	idx, err := s.storage.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx, DeepEquals, index.New(core.SHA1))
+
+	data, err := ioutil.ReadFile("../../formats/index/fixtures/index-v4")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "index"), data, 0644), IsNil)
+
+	idx, err = s.storage.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Version, Equals, uint32(4))
+	c.Assert(idx.Entries, HasLen, 7)
+	c.Assert(idx.Entries[0].Name, Equals, "a/b/c/baz")
+}
+
+func (s *IndexSuite) TestIndexObjectFormat(c *C) {
+	config := "[extensions]\n\tobjectformat = sha256\n"
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "config"), []byte(config), 0644), IsNil)
+
+	idx, err := s.storage.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Format, Equals, core.SHA256)
+
+	// the fixture is a SHA1 index
+	data, err := ioutil.ReadFile("../../formats/index/fixtures/index-v2")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "index"), data, 0644), IsNil)
+
+	_, err = s.storage.Index()
+	c.Assert(err, Equals, index.ErrMalformedIndex)
+}
@@ -0,0 +1,571 @@
+package filesystem
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/commitgraph"
+	"gopkg.in/src-d/go-git.v3/formats/objfile"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+// ObjectStorage is an implementation of core.ObjectStorage for the objects
+// of a git directory: the loose ones, stored one per file in
+// objects/xx/yyyy..., where xx are the first two hexadecimal digits of their
+// hash, and the ones of the packfiles in objects/pack with an idx file.
+//
+// New objects are written as loose objects, when the fs.FS of the storage is
+// a fs.WriteFS. The hashes of the objects are in the format of the
+// repository, see ObjectFormat, the hashes of other formats are rejected
+// with a *core.ErrObjectFormatMismatch.
+type ObjectStorage struct {
+	fs     fs.FS
+	dir    string
+	format core.ObjectFormat
+
+	m     sync.RWMutex
+	packs []*pack // never modified, replaced when a packfile is added
+
+	graph       *commitgraph.CommitGraph // nil if there is no commit-graph
+	graphLoaded bool
+}
+
+func newObjectStorage(fs fs.FS, dir string, format core.ObjectFormat) (*ObjectStorage, error) {
+	packs, err := loadPacks(fs, fs.Join(dir, "pack"), format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectStorage{fs: fs, dir: dir, format: format, packs: packs}, nil
+}
+
+// ObjectFormat returns the format of the hashes of the objects, the one of
+// the extensions.objectformat option of the config file of the repository.
+func (s *ObjectStorage) ObjectFormat() core.ObjectFormat {
+	return s.format
+}
+
+// Set writes the object as a loose object, the same way git does: its
+// header and content are compressed into a temporary file of the objects
+// directory, which is synced and then renamed to the path of the object, so
+// it is never found half written. Nothing is written if the object already
+// is in the storage.
+//
+// The hash is computed from the written content, ErrHashMismatch is returned
+// if the object has a different one, and a *core.ErrObjectFormatMismatch if
+// it has one of another format. ErrReadOnly is returned if the fs.FS of the
+// storage is not a fs.WriteFS.
+func (s *ObjectStorage) Set(obj core.Object) (core.Hash, error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return core.ZeroHash, ErrReadOnly
+	}
+
+	expected := obj.Hash()
+	if !expected.IsZero() {
+		if err := core.CheckObjectFormat(s.format, expected); err != nil {
+			return core.ZeroHash, err
+		}
+
+		ok, err := s.Has(expected)
+		if err != nil || ok {
+			return expected, err
+		}
+	}
+
+	if err := wfs.MkdirAll(s.dir, 0755); err != nil {
+		return core.ZeroHash, err
+	}
+
+	var h core.Hash
+	tmp, err := writeTempFile(wfs, s.dir, "tmp_obj_", 0444, func(w io.Writer) (err error) {
+		h, err = writeObject(w, s.format, obj)
+		return err
+	})
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	renamed := false
+	defer func() {
+		if !renamed {
+			wfs.Remove(tmp)
+		}
+	}()
+
+	if !expected.IsZero() && h != expected {
+		return core.ZeroHash, ErrHashMismatch
+	}
+
+	ok, err = s.Has(h)
+	if err != nil || ok {
+		return h, err
+	}
+
+	path := s.objectPath(h)
+	if err := wfs.MkdirAll(s.fs.Join(s.dir, h.String()[:2]), 0755); err != nil {
+		return core.ZeroHash, err
+	}
+
+	if err := wfs.Rename(tmp, path); err != nil {
+		// another writer could have written the same object meanwhile
+		if _, errStat := s.fs.Stat(path); errStat == nil {
+			return h, nil
+		}
+
+		return core.ZeroHash, err
+	}
+
+	renamed = true
+	return h, nil
+}
+
+// writeObject writes the object in the format of the loose objects,
+// returning the hash of the written object, in the given format.
+func writeObject(out io.Writer, f core.ObjectFormat, obj core.Object) (core.Hash, error) {
+	w, err := objfile.NewWriterWithFormat(out, f, obj.Type(), obj.Size())
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		w.Close()
+		return core.ZeroHash, err
+	}
+
+	n, err := io.Copy(w, r)
+	r.Close()
+	if err != nil {
+		w.Close()
+		return core.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return core.ZeroHash, err
+	}
+
+	if n != obj.Size() {
+		return core.ZeroHash, io.ErrUnexpectedEOF
+	}
+
+	return w.Hash(), nil
+}
+
+// Get returns the object with the given hash, looking for it in the loose
+// objects first and then in every packfile. Only the header of the loose
+// objects is read, their content is read when requested, see Object.
+func (s *ObjectStorage) Get(h core.Hash) (core.Object, error) {
+	return s.get(h, false)
+}
+
+// get returns the object with the given hash, see Get. If strict is true,
+// the hash of the loose object is computed from its content, and the
+// checksum of the packfile is verified, see Strict.
+func (s *ObjectStorage) get(h core.Hash, strict bool) (core.Object, error) {
+	if err := core.CheckObjectFormat(s.format, h); err != nil {
+		return nil, err
+	}
+
+	obj := &Object{fs: s.fs, path: s.objectPath(h), h: h}
+	err := obj.readHeader()
+	if err == nil {
+		if strict {
+			if err := core.VerifyObject(h, obj); err != nil {
+				return nil, err
+			}
+		}
+
+		return obj, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, p := range s.packList() {
+		if _, ok := p.offsets[h]; !ok {
+			continue
+		}
+
+		if strict {
+			if err := p.verify(); err != nil {
+				return nil, err
+			}
+		}
+
+		return p.get(h)
+	}
+
+	return nil, core.ErrObjectNotFound
+}
+
+// Strict returns a view of the storage verifying the objects read, see
+// core.NewVerifyingObjectStorage: the hash of every loose object read is
+// computed from its content, and the checksum of every packfile is verified
+// the first time an object is read from it, instead of computing the hash
+// of every packed object. core.ErrObjectCorrupted is returned for the
+// corrupted loose objects and packfile.ErrBadChecksum for the objects of
+// corrupted packfiles.
+func (s *ObjectStorage) Strict() core.ObjectStorage {
+	return &strictObjectStorage{s}
+}
+
+// strictObjectStorage is the view of an ObjectStorage returned by Strict.
+type strictObjectStorage struct {
+	*ObjectStorage
+}
+
+// Get returns the object with the given hash, once verified.
+func (s *strictObjectStorage) Get(h core.Hash) (core.Object, error) {
+	return s.get(h, true)
+}
+
+// Iter returns an iterator for all the objects with the given type, see
+// ObjectStorage.Iter, every one of them verified.
+func (s *strictObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
+	return s.iter(t, s.Get)
+}
+
+// Has returns true if the object with the given hash is a loose object or
+// is in the idx file of any packfile, without reading it.
+func (s *ObjectStorage) Has(h core.Hash) (bool, error) {
+	if err := core.CheckObjectFormat(s.format, h); err != nil {
+		return false, err
+	}
+
+	_, err := s.fs.Stat(s.objectPath(h))
+	if err == nil {
+		return true, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	for _, p := range s.packList() {
+		if _, ok := p.offsets[h]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Delete deletes the loose object with the given hash, the objects of the
+// packfiles cannot be deleted alone, core.ErrObjectNotDeletable is returned
+// for them. ErrReadOnly is returned if the fs.FS of the storage is not a
+// fs.WriteFS.
+func (s *ObjectStorage) Delete(h core.Hash) error {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	err := wfs.Remove(s.objectPath(h))
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, p := range s.packList() {
+		if _, ok := p.offsets[h]; ok {
+			return core.ErrObjectNotDeletable
+		}
+	}
+
+	return core.ErrObjectNotFound
+}
+
+// ModTime returns the modification time of the file of the loose object
+// with the given hash, or the one of its packfile if it is packed.
+func (s *ObjectStorage) ModTime(h core.Hash) (time.Time, error) {
+	fi, err := s.fs.Stat(s.objectPath(h))
+	if err == nil {
+		return fi.ModTime(), nil
+	}
+
+	if !os.IsNotExist(err) {
+		return time.Time{}, err
+	}
+
+	for _, p := range s.packList() {
+		if _, ok := p.offsets[h]; !ok {
+			continue
+		}
+
+		fi, err := s.fs.Stat(p.path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return fi.ModTime(), nil
+	}
+
+	return time.Time{}, core.ErrObjectNotFound
+}
+
+// HashesWithPrefix returns the hashes of the objects starting with the given
+// prefix, see core.HashesWithPrefix. Only the files of the fan-out directory
+// of the prefix are read for the loose objects, and the hashes of every idx
+// file are searched, as they are sorted, for the rest.
+func (s *ObjectStorage) HashesWithPrefix(prefix string) ([]core.Hash, error) {
+	var hashes []core.Hash
+	seen := make(map[core.Hash]bool)
+	add := func(h core.Hash) {
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+
+	if len(prefix) >= 2 {
+		files, err := s.fs.ReadDir(s.fs.Join(s.dir, prefix[:2]))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, f := range files {
+			name := prefix[:2] + f.Name()
+			if !f.IsDir() && len(name) == s.format.HexSize() && isHex(name) && strings.HasPrefix(name, prefix) {
+				add(core.NewHash(name))
+			}
+		}
+	} else {
+		loose, err := s.hashes()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range loose {
+			if h.HasPrefix(prefix) {
+				add(h)
+			}
+		}
+	}
+
+	for _, p := range s.packList() {
+		i := sort.Search(len(p.hashes), func(i int) bool {
+			return p.hashes[i].String() >= prefix
+		})
+
+		for ; i < len(p.hashes) && p.hashes[i].HasPrefix(prefix); i++ {
+			add(p.hashes[i])
+		}
+	}
+
+	return hashes, nil
+}
+
+// ConcurrentSafe returns true, Get can be called from several goroutines at
+// once, every call reads the files on its own.
+func (s *ObjectStorage) ConcurrentSafe() bool {
+	return true
+}
+
+// Iter returns an iterator for all the objects with the given type, the
+// loose ones, found scanning the fan-out directories of the objects
+// directory, and the ones in the packfiles.
+func (s *ObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
+	return s.iter(t, s.Get)
+}
+
+func (s *ObjectStorage) iter(t core.ObjectType, get func(core.Hash) (core.Object, error)) (core.ObjectIter, error) {
+	hashes, err := s.hashes()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[core.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		seen[h] = true
+	}
+
+	for _, p := range s.packList() {
+		for _, h := range p.hashes {
+			if !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+	}
+
+	var objects []core.Object
+	for _, h := range hashes {
+		obj, err := get(h)
+		if err != nil {
+			return nil, err
+		}
+
+		if obj.Type() == t {
+			objects = append(objects, obj)
+		}
+	}
+
+	return core.NewObjectSliceIter(objects), nil
+}
+
+func (s *ObjectStorage) packList() []*pack {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.packs
+}
+
+// hashes returns the hashes of all the loose objects, the files with other
+// names are ignored.
+func (s *ObjectStorage) hashes() ([]core.Hash, error) {
+	dirs, err := s.fs.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var hashes []core.Hash
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 || !isHex(d.Name()) {
+			continue
+		}
+
+		files, err := s.fs.ReadDir(s.fs.Join(s.dir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || len(f.Name()) != s.format.HexSize()-2 || !isHex(f.Name()) {
+				continue
+			}
+
+			hashes = append(hashes, core.NewHash(d.Name()+f.Name()))
+		}
+	}
+
+	return hashes, nil
+}
+
+func (s *ObjectStorage) objectPath(h core.Hash) string {
+	hex := h.String()
+	return s.fs.Join(s.dir, hex[:2], hex[2:])
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Object is the core.Object of a loose object file. Its type and size are
+// read from the header of the file when it is found, and its content is read
+// from the file every time it is requested, so it is not kept in memory.
+type Object struct {
+	fs   fs.FS
+	path string
+	h    core.Hash
+	t    core.ObjectType
+	sz   int64
+}
+
+// Hash returns the hash of the object, the one of its file name.
+func (o *Object) Hash() core.Hash { return o.h }
+
+// Type return the core.ObjectType
+func (o *Object) Type() core.ObjectType { return o.t }
+
+// SetType sets the core.ObjectType
+func (o *Object) SetType(t core.ObjectType) { o.t = t }
+
+// Size return the size of the object
+func (o *Object) Size() int64 { return o.sz }
+
+// SetSize set the object size
+func (o *Object) SetSize(s int64) { o.sz = s }
+
+// Content returns the contents of the object, reading them from its file,
+// or nil if they can not be read.
+func (o *Object) Content() []byte {
+	r, err := o.Reader()
+	if err != nil {
+		return nil
+	}
+
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+
+	return content
+}
+
+// Reader returns a core.ObjectReader used to read the object's content from
+// its file, it must be closed to close the file.
+func (o *Object) Reader() (core.ObjectReader, error) {
+	f, r, err := o.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectReader{io.LimitReader(r, o.sz), r, f}, nil
+}
+
+// Writer returns ErrNotImplemented, the loose objects are read only.
+func (o *Object) Writer() (core.ObjectWriter, error) {
+	return nil, ErrNotImplemented
+}
+
+func (o *Object) readHeader() error {
+	f, r, err := o.open()
+	if err != nil {
+		return err
+	}
+
+	o.t, o.sz = r.Type(), r.Size()
+	r.Close()
+	return f.Close()
+}
+
+// open opens the file of the object and reads its header, returning the
+// objfile.Reader positioned at the content.
+func (o *Object) open() (fs.ReadSeekCloser, *objfile.Reader, error) {
+	f, err := o.fs.Open(o.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := objfile.NewReaderWithFormat(f, o.h.Format())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, r, nil
+}
+
+// objectReader reads the content of a loose object, closing its
+// objfile.Reader and its file when closed.
+type objectReader struct {
+	io.Reader
+	r io.Closer
+	f io.Closer
+}
+
+func (r *objectReader) Close() error {
+	errReader := r.r.Close()
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	return errReader
+}
@@ -0,0 +1,25 @@
+package filesystem
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// readObjectFormat returns the object format of the git directory of the
+// given config, the value of its extensions.objectformat option, as written
+// by git init --object-format. It is core.SHA1 if there is no config file
+// or it does not have the option.
+func readObjectFormat(s *ConfigStorage) (core.ObjectFormat, error) {
+	c, err := s.Config()
+	if err != nil {
+		return core.SHA1, err
+	}
+
+	v, ok := c.Value("extensions", "", "objectformat")
+	if !ok {
+		return core.SHA1, nil
+	}
+
+	return core.ParseObjectFormat(strings.ToLower(v))
+}
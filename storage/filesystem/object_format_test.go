@@ -0,0 +1,117 @@
+package filesystem_test
+
+import (
+	"io"
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	"github.com/alcortesm/tgz"
+	. "gopkg.in/check.v1"
+)
+
+type ObjectFormatSuite struct {
+	dir     string
+	storage *filesystem.ObjectStorage
+}
+
+var _ = Suite(&ObjectFormatSuite{})
+
+// the objects of the fixture, a repository initialized with
+// git init --object-format=sha256, the first commit is packed
+var sha256Objects = map[string]core.ObjectType{
+	"d8d0cf660301c81d23df1c3d9aed2f323115e9b008d3954d7327733101fab16e": core.CommitObject,
+	"f9eb995d3a775e65417e31de5d263e7214877e2b55e4d98995ef02ee6e933ef0": core.TreeObject,
+	"4ad1c4ca9c0583454f1ec9bfa728c1a4c68e3912e053bdbb8d7aa7f3b1c13cdc": core.CommitObject,
+	"07896ce315f4c271f09ea03a7e8b103c9a15edf85fead79d40e1b83c79562eef": core.TreeObject,
+	"dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55653": core.BlobObject,
+}
+
+func (s *ObjectFormatSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = tgz.Extract("fixtures/sha256.tgz")
+	c.Assert(err, IsNil)
+
+	fs := fs.NewOS()
+	storage, err := filesystem.New(fs, fs.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	s.storage = storage.ObjectStorage().(*filesystem.ObjectStorage)
+}
+
+func (s *ObjectFormatSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *ObjectFormatSuite) TestObjectFormat(c *C) {
+	c.Assert(s.storage.ObjectFormat(), Equals, core.SHA256)
+	c.Assert(core.ObjectStorageFormat(s.storage), Equals, core.SHA256)
+}
+
+func (s *ObjectFormatSuite) TestGet(c *C) {
+	for hash, typ := range sha256Objects {
+		com := Commentf("hash=%s", hash)
+		h := core.NewHash(hash)
+
+		obj, err := s.storage.Get(h)
+		c.Assert(err, IsNil, com)
+		c.Assert(obj.Hash(), Equals, h, com)
+		c.Assert(obj.Type(), Equals, typ, com)
+		c.Assert(core.SHA256.ComputeHash(obj.Type(), obj.Content()), Equals, h, com)
+	}
+
+	_, err := s.storage.Get(core.NewHash("dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55600"))
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+
+	_, err = s.storage.Get(core.NewHash("ce013625030ba8dba906f756967f9e9ca394464a"))
+	c.Assert(err, DeepEquals, &core.ErrObjectFormatMismatch{Expected: core.SHA256, Actual: core.SHA1})
+}
+
+func (s *ObjectFormatSuite) TestIter(c *C) {
+	iter, err := s.storage.Iter(core.CommitObject)
+	c.Assert(err, IsNil)
+
+	count := 0
+	for {
+		obj, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+
+		c.Assert(err, IsNil)
+		c.Assert(sha256Objects[obj.Hash().String()], Equals, core.CommitObject)
+		count++
+	}
+
+	c.Assert(count, Equals, 2)
+}
+
+func (s *ObjectFormatSuite) TestHashesWithPrefix(c *C) {
+	hashes, err := s.storage.HashesWithPrefix("dabc")
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []core.Hash{
+		core.NewHash("dabc789f60c22621c92df8736ff8cb60e35185584772b93b9315a3e2aab55653"),
+	})
+}
+
+func (s *ObjectFormatSuite) TestSet(c *C) {
+	obj := memory.NewObjectWithFormat(core.SHA256, core.BlobObject, 4, []byte("bar\n"))
+	h, err := s.storage.Set(obj)
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, core.SHA256.ComputeHash(core.BlobObject, []byte("bar\n")))
+
+	read, err := s.storage.Get(h)
+	c.Assert(err, IsNil)
+	c.Assert(string(read.Content()), Equals, "bar\n")
+
+	_, err = s.storage.Set(memory.NewObject(core.BlobObject, 4, []byte("bar\n")))
+	c.Assert(err, DeepEquals, &core.ErrObjectFormatMismatch{Expected: core.SHA256, Actual: core.SHA1})
+}
+
+func (s *ObjectFormatSuite) TestCommitGraph(c *C) {
+	g, err := s.storage.CommitGraph()
+	c.Assert(err, IsNil)
+	c.Assert(g, IsNil)
+}
@@ -0,0 +1,196 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type ObjectSetSuite struct {
+	dir     string
+	storage core.ObjectStorage
+}
+
+var _ = Suite(&ObjectSetSuite{})
+
+func (s *ObjectSetSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.ObjectStorage()
+}
+
+func (s *ObjectSetSuite) TestSet(c *C) {
+	expected := core.NewHash("ce013625030ba8dba906f756967f9e9ca394464a")
+	obj := memory.NewObject(core.BlobObject, 6, []byte("hello\n"))
+
+	h, err := s.storage.Set(obj)
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, expected)
+
+	path := filepath.Join(s.dir, "objects", "ce", "013625030ba8dba906f756967f9e9ca394464a")
+	fi, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode(), Equals, os.FileMode(0444))
+
+	read, err := s.storage.Get(h)
+	c.Assert(err, IsNil)
+	c.Assert(read.Type(), Equals, core.BlobObject)
+	c.Assert(string(read.Content()), Equals, "hello\n")
+
+	// the second time nothing is written
+	h, err = s.storage.Set(obj)
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, expected)
+	fi2, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(fi2.ModTime(), Equals, fi.ModTime())
+
+	s.assertNoTempFiles(c)
+}
+
+func (s *ObjectSetSuite) TestSetWithoutHash(c *C) {
+	obj := noHashObject{memory.NewObject(core.BlobObject, 6, []byte("hello\n"))}
+
+	h, err := s.storage.Set(obj)
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, core.NewHash("ce013625030ba8dba906f756967f9e9ca394464a"))
+
+	ok, err := core.HasObject(s.storage, h)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *ObjectSetSuite) TestSetHashMismatch(c *C) {
+	obj := memory.NewObject(core.BlobObject, 6, []byte("hello\n"))
+	obj.SetType(core.TreeObject)
+
+	_, err := s.storage.Set(obj)
+	c.Assert(err, Equals, filesystem.ErrHashMismatch)
+	s.assertNoTempFiles(c)
+
+	ok, err := core.HasObject(s.storage, obj.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ObjectSetSuite) TestSetShortContent(c *C) {
+	obj := memory.NewObject(core.BlobObject, 6, []byte("hello\n"))
+	obj.SetSize(10)
+
+	_, err := s.storage.Set(obj)
+	c.Assert(err, NotNil)
+	s.assertNoTempFiles(c)
+}
+
+func (s *ObjectSetSuite) TestSetConcurrent(c *C) {
+	obj := memory.NewObject(core.BlobObject, 6, []byte("hello\n"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := s.storage.Set(noHashObject{obj})
+			c.Check(err, IsNil)
+			c.Check(h, Equals, obj.Hash())
+		}()
+	}
+	wg.Wait()
+
+	read, err := s.storage.Get(obj.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(string(read.Content()), Equals, "hello\n")
+	s.assertNoTempFiles(c)
+}
+
+func (s *ObjectSetSuite) TestSetReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(err, IsNil)
+
+	_, err = storage.ObjectStorage().Set(memory.NewObject(core.BlobObject, 6, []byte("hello\n")))
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *ObjectSetSuite) TestStrict(c *C) {
+	good, err := s.storage.Set(memory.NewObject(core.BlobObject, 5, []byte("good\n")))
+	c.Assert(err, IsNil)
+	bad, err := s.storage.Set(memory.NewObject(core.BlobObject, 4, []byte("bad\n")))
+	c.Assert(err, IsNil)
+
+	// the content of the bad object is replaced by the one of the good one
+	path := filepath.Join(s.dir, "objects", bad.String()[:2], bad.String()[2:])
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "objects", good.String()[:2], good.String()[2:]))
+	c.Assert(err, IsNil)
+	c.Assert(os.Chmod(path, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(path, content, 0644), IsNil)
+
+	_, err = s.storage.Get(bad)
+	c.Assert(err, IsNil)
+
+	strict := core.NewVerifyingObjectStorage(s.storage)
+	obj, err := strict.Get(good)
+	c.Assert(err, IsNil)
+	c.Assert(string(obj.Content()), Equals, "good\n")
+
+	_, err = strict.Get(bad)
+	c.Assert(err, DeepEquals, &core.ErrObjectCorrupted{Expected: bad, Actual: good})
+}
+
+func (s *ObjectSetSuite) TestDelete(c *C) {
+	h, err := s.storage.Set(memory.NewObject(core.BlobObject, 6, []byte("hello\n")))
+	c.Assert(err, IsNil)
+
+	mtime, err := s.storage.(core.TimedObjectStorage).ModTime(h)
+	c.Assert(err, IsNil)
+	fi, err := os.Stat(filepath.Join(s.dir, "objects", "ce", "013625030ba8dba906f756967f9e9ca394464a"))
+	c.Assert(err, IsNil)
+	c.Assert(mtime, Equals, fi.ModTime())
+
+	storage := s.storage.(core.DeletableObjectStorage)
+	c.Assert(storage.Delete(h), IsNil)
+	_, err = s.storage.Get(h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+	c.Assert(storage.Delete(h), Equals, core.ErrObjectNotFound)
+
+	_, err = s.storage.(core.TimedObjectStorage).ModTime(h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *ObjectSetSuite) TestDeleteReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(err, IsNil)
+
+	err = storage.ObjectStorage().(core.DeletableObjectStorage).Delete(core.ZeroHash)
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *ObjectSetSuite) assertNoTempFiles(c *C) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, "objects"))
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		c.Assert(f.IsDir(), Equals, true, Commentf("file=%s", f.Name()))
+	}
+}
+
+// noHashObject hides the hash of an object, so it has to be computed while
+// it is written.
+type noHashObject struct {
+	core.Object
+}
+
+func (noHashObject) Hash() core.Hash { return core.ZeroHash }
+
+// readOnlyFS hides the write methods of an fs.FS.
+type readOnlyFS struct {
+	fs.FS
+}
@@ -0,0 +1,501 @@
+package filesystem
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/idxfile"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+// deltaBaseCacheSize is the maximum size of the objects cached by each
+// packfile as delta bases.
+const deltaBaseCacheSize = 16 * 1024 * 1024
+
+// pack is a packfile of the objects directory, whose objects are found by
+// the offsets read from its idx file.
+type pack struct {
+	fs      fs.FS
+	path    string
+	format  core.ObjectFormat
+	offsets map[core.Hash]int64
+	hashes  []core.Hash // sorted, as they are in the idx file
+	bases   *deltaBaseCache
+
+	checksum core.Hash // of the packfile, read from the idx file
+	m        sync.Mutex
+	verified bool
+}
+
+// loadPacks returns the packfiles of the given pack directory that have an
+// idx file, of objects of the given format.
+func loadPacks(fs fs.FS, dir string, format core.ObjectFormat) ([]*pack, error) {
+	files, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var packs []*pack
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".idx") {
+			continue
+		}
+
+		path := fs.Join(dir, strings.TrimSuffix(f.Name(), ".idx")+".pack")
+		if _, err := fs.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		p, err := newPack(fs, fs.Join(dir, f.Name()), path, format)
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, p)
+	}
+
+	return packs, nil
+}
+
+func newPack(fs fs.FS, idxPath, path string, format core.ObjectFormat) (p *pack, err error) {
+	f, err := fs.Open(idxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	idx := &idxfile.Idxfile{Format: format}
+	if err := idxfile.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+
+	return newPackFromIdx(fs, path, idx), nil
+}
+
+func newPackFromIdx(fs fs.FS, path string, idx *idxfile.Idxfile) *pack {
+	p := &pack{
+		fs:      fs,
+		path:    path,
+		format:  idx.Format,
+		offsets: make(map[core.Hash]int64, len(idx.Entries)),
+		hashes:  make([]core.Hash, len(idx.Entries)),
+		bases:   newDeltaBaseCache(deltaBaseCacheSize),
+
+		checksum: idx.PackfileChecksum,
+	}
+
+	for i, e := range idx.Entries {
+		p.offsets[e.Hash] = int64(e.Offset)
+		p.hashes[i] = e.Hash
+	}
+
+	return p
+}
+
+// WritePack writes a packfile with the objects with the given hashes, and its
+// idx file, to the pack directory, named after the packfile checksum as git
+// does, and returns the checksum. The objects of the new packfile are read
+// from it from then on. The packfile is written first and its idx file
+// afterwards, every one of them to a temporary file renamed when complete,
+// so the packfile is not read until both are complete.
+//
+// ErrReadOnly is returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ObjectStorage) WritePack(hashes []core.Hash, opts packfile.EncoderOptions) (core.Hash, error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return core.ZeroHash, ErrReadOnly
+	}
+
+	dir := s.fs.Join(s.dir, "pack")
+	if err := wfs.MkdirAll(dir, 0755); err != nil {
+		return core.ZeroHash, err
+	}
+
+	e := packfile.NewEncoderWithOptions(s, opts)
+	tmpPack, err := writeTempFile(wfs, dir, "tmp_pack_", 0444, func(w io.Writer) (err error) {
+		_, err = e.Encode(w, hashes)
+		return err
+	})
+	if err != nil {
+		return core.ZeroHash, err
+	}
+	// the temporary files are already renamed on success
+	defer wfs.Remove(tmpPack)
+
+	return s.keepPack(wfs, dir, tmpPack, e.Idxfile())
+}
+
+// WritePackfile writes the packfile read from r to the pack directory, as
+// git index-pack --stdin does, along with the idx file generated for it,
+// and returns its checksum. The packfile is copied as it is to a temporary
+// file, which is indexed afterwards, so its objects are never kept in
+// memory, see packfile.Indexer, and it is only renamed, as WritePack does,
+// if it is valid. The delta bases that are not in the packfile, if it is
+// thin, are read from bases, or from the storage if it is nil, and the
+// packfile is completed with them, see packfile.FixThin. The progress of the
+// indexing is written to progress, if it is not nil.
+//
+// ErrReadOnly is returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ObjectStorage) WritePackfile(r io.Reader, bases core.ObjectStorage, progress io.Writer) (core.Hash, error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return core.ZeroHash, ErrReadOnly
+	}
+
+	if bases == nil {
+		bases = s
+	}
+
+	dir := s.fs.Join(s.dir, "pack")
+	if err := wfs.MkdirAll(dir, 0755); err != nil {
+		return core.ZeroHash, err
+	}
+
+	tmpPack, err := writeTempFile(wfs, dir, "tmp_pack_", 0444, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return core.ZeroHash, err
+	}
+	defer wfs.Remove(tmpPack)
+
+	idx, external, err := s.indexPack(tmpPack, bases, progress)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	if len(external) != 0 {
+		objects, err := core.GetMany(bases, external)
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		thin, err := s.fs.Open(tmpPack)
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		tmpPack, err = writeTempFile(wfs, dir, "tmp_pack_", 0444, func(w io.Writer) error {
+			_, err := packfile.FixThinWithFormat(w, thin, s.format, objects)
+			return err
+		})
+		thin.Close()
+		if err != nil {
+			return core.ZeroHash, err
+		}
+		defer wfs.Remove(tmpPack)
+
+		if idx, _, err = s.indexPack(tmpPack, nil, nil); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	return s.keepPack(wfs, dir, tmpPack, idx)
+}
+
+// indexPack returns the idx file of the given packfile, and the hashes of
+// the delta bases read from bases, reading it with two handles, one to
+// index it and another one to read again the delta bases not cached.
+func (s *ObjectStorage) indexPack(path string, bases core.ObjectStorage, progress io.Writer) (
+	idx *idxfile.Idxfile, external []core.Hash, err error) {
+
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	rf, err := s.fs.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		errClose := rf.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	ix := packfile.NewIndexer(f)
+	ix.Bases = bases
+	ix.Packfile = rf
+	ix.Progress = progress
+	ix.Format = s.format
+	if idx, err = ix.Index(nil); err != nil {
+		return nil, nil, err
+	}
+
+	return idx, ix.ExternalBases(), nil
+}
+
+// keepPack writes the idx file of the given temporary packfile and renames
+// both to the pack directory, named after the packfile checksum, the
+// packfile first. The objects of the packfile are read from it from then
+// on.
+func (s *ObjectStorage) keepPack(wfs fs.WriteFS, dir, tmpPack string, idx *idxfile.Idxfile) (core.Hash, error) {
+	tmpIdx, err := writeTempFile(wfs, dir, "tmp_idx_", 0444, func(w io.Writer) (err error) {
+		_, err = idxfile.NewEncoder(w).Encode(idx)
+		return err
+	})
+	if err != nil {
+		return core.ZeroHash, err
+	}
+	defer wfs.Remove(tmpIdx)
+
+	checksum := idx.PackfileChecksum
+	name := s.fs.Join(dir, "pack-"+checksum.String())
+	if err := wfs.Rename(tmpPack, name+".pack"); err != nil {
+		return core.ZeroHash, err
+	}
+
+	if err := wfs.Rename(tmpIdx, name+".idx"); err != nil {
+		return core.ZeroHash, err
+	}
+
+	s.addPack(newPackFromIdx(s.fs, name+".pack", idx))
+	return checksum, nil
+}
+
+// addPack adds the given packfile to the storage, replacing the one with the
+// same path, if any.
+func (s *ObjectStorage) addPack(p *pack) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	packs := make([]*pack, 0, len(s.packs)+1)
+	for _, old := range s.packs {
+		if old.path != p.path {
+			packs = append(packs, old)
+		}
+	}
+
+	s.packs = append(packs, p)
+}
+
+// get returns the object with the given hash, solving its deltas if it is
+// deltified, or core.ErrObjectNotFound if it is not in the packfile.
+func (p *pack) get(h core.Hash) (obj core.Object, err error) {
+	offset, ok := p.offsets[h]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+
+	f, err := p.fs.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	r := &packReader{Seekable: packfile.NewSeekable(f), format: p.format, bases: p.bases}
+	r.HashToOffset = p.offsets
+
+	return r.readObject()
+}
+
+// verify verifies the checksum at the end of the packfile, which must be
+// the checksum of its content and the one in its idx file, returning
+// packfile.ErrBadChecksum otherwise. The packfile is only read the first
+// time it is verified successfully.
+func (p *pack) verify() (err error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.verified {
+		return nil
+	}
+
+	f, err := p.fs.Open(p.path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	size, err := f.Seek(-int64(p.format.Size()), os.SEEK_END)
+	if err != nil {
+		return err
+	}
+
+	var trailer core.Hash
+	if _, err := io.ReadFull(f, trailer[:p.format.Size()]); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+
+	h := p.format.New()
+	if _, err := io.CopyN(h, f, size); err != nil {
+		return err
+	}
+
+	sum := core.NewHashFromBytes(p.format, h.Sum(nil))
+	if sum != core.NewHashFromBytes(p.format, trailer[:]) || sum != p.checksum {
+		return packfile.ErrBadChecksum
+	}
+
+	p.verified = true
+	return nil
+}
+
+// packReader is the packfile.ReadRecaller of a packfile, recalling the delta
+// bases from the cache of the packfile when they are cached.
+type packReader struct {
+	*packfile.Seekable
+	format core.ObjectFormat
+	bases  *deltaBaseCache
+}
+
+// readObject reads the object at the current offset.
+func (r *packReader) readObject() (core.Object, error) {
+	p := packfile.NewParser(r)
+	p.Format = r.format
+	return p.ReadObject()
+}
+
+// RecallByHash returns the object with the given hash, see RecallByOffset.
+func (r *packReader) RecallByHash(h core.Hash) (core.Object, error) {
+	o, ok := r.HashToOffset[h]
+	if !ok {
+		return nil, packfile.ErrCannotRecall.AddDetails("hash not found: %s", h)
+	}
+
+	return r.RecallByOffset(o)
+}
+
+// RecallByOffset returns the object at the given offset from the cache, or
+// reads it, solving its own deltas with this same reader, and caches it.
+func (r *packReader) RecallByOffset(o int64) (obj core.Object, err error) {
+	if obj, ok := r.bases.get(o); ok {
+		return obj, nil
+	}
+
+	beforeJump, err := r.Offset()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_, seekErr := r.Seek(beforeJump, os.SEEK_SET)
+		if err == nil {
+			err = seekErr
+		}
+	}()
+
+	if _, err := r.Seek(o, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	obj, err = r.readObject()
+	if err != nil {
+		return nil, err
+	}
+
+	r.bases.add(o, obj)
+	return obj, nil
+}
+
+// deltaBaseCache is a LRU cache of the delta bases of a packfile, by offset,
+// bounded by the sum of their sizes. It is safe to use from several
+// goroutines at once.
+type deltaBaseCache struct {
+	maxBytes int64
+
+	m       sync.Mutex
+	size    int64
+	lru     *list.List // of *deltaBase, the most recently used first
+	objects map[int64]*list.Element
+}
+
+type deltaBase struct {
+	offset int64
+	obj    core.Object
+}
+
+func newDeltaBaseCache(maxBytes int64) *deltaBaseCache {
+	return &deltaBaseCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		objects:  make(map[int64]*list.Element, 0),
+	}
+}
+
+func (c *deltaBaseCache) get(offset int64) (core.Object, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.objects[offset]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	return e.Value.(*deltaBase).obj, true
+}
+
+func (c *deltaBaseCache) add(offset int64, obj core.Object) {
+	size := obj.Size()
+	if size > c.maxBytes {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.objects[offset]; ok {
+		return
+	}
+
+	for c.size+size > c.maxBytes {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.objects, e.Value.(*deltaBase).offset)
+		c.size -= e.Value.(*deltaBase).obj.Size()
+	}
+
+	c.objects[offset] = c.lru.PushFront(&deltaBase{offset: offset, obj: obj})
+	c.size += size
+}
@@ -0,0 +1,40 @@
+package filesystem
+
+import (
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type DeltaBaseCacheSuite struct{}
+
+var _ = Suite(&DeltaBaseCacheSuite{})
+
+func (s *DeltaBaseCacheSuite) TestEviction(c *C) {
+	cache := newDeltaBaseCache(10)
+	objs := []core.Object{
+		memory.NewObject(core.BlobObject, 4, []byte("1234")),
+		memory.NewObject(core.BlobObject, 4, []byte("5678")),
+		memory.NewObject(core.BlobObject, 11, []byte("too big....")),
+	}
+
+	for i, obj := range objs {
+		cache.add(int64(i), obj)
+	}
+	c.Assert(cache.size, Equals, int64(8))
+
+	obj, ok := cache.get(0)
+	c.Assert(ok, Equals, true)
+	c.Assert(obj, Equals, objs[0])
+
+	// the second one is the least recently used
+	cache.add(3, memory.NewObject(core.BlobObject, 4, []byte("abcd")))
+	_, ok = cache.get(1)
+	c.Assert(ok, Equals, false)
+	_, ok = cache.get(0)
+	c.Assert(ok, Equals, true)
+	_, ok = cache.get(2)
+	c.Assert(ok, Equals, false)
+	c.Assert(cache.size, Equals, int64(8))
+}
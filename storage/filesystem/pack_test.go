@@ -0,0 +1,614 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/idxfile"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	"github.com/alcortesm/tgz"
+	. "gopkg.in/check.v1"
+)
+
+type PackSuite struct {
+	dir     string
+	storage *filesystem.Storage
+}
+
+var _ = Suite(&PackSuite{})
+
+// the objects of the fixture, obtained with git cat-file: a packfile with
+// ofs-deltas, another one with ref-deltas and three loose objects
+var packedObjects = map[string]struct {
+	typ  core.ObjectType
+	size int64
+}{
+	"afb9e4aa23fcc9111239cece8cdbc17a5f46b7ad": {core.BlobObject, 4692},
+	"bb33f08e22763c318a5ce90c69a11fd4c5afc0c2": {core.BlobObject, 4697},
+	"e2292648f78b6e0ae0a9212dc19d155667565419": {core.BlobObject, 4702},
+	"3255264fa458cb7906fd87a8458b260732a2f6f1": {core.BlobObject, 4707},
+	"2a6c9eaf368d81cf9d40c7717673923e5dbfdd0c": {core.BlobObject, 4711},
+	"8e1287b2715d58f283eaa693039e5b70f278e121": {core.BlobObject, 4715},
+	"51c8ec6a66f4cc84d90b462a02a2f5ebc1b303a1": {core.BlobObject, 4719},
+	"09bcb98d777b923d2c60e84c4a97fe96265f27aa": {core.BlobObject, 4723},
+	"95f03e07b3b9c4c3d5b44ceaa3f5cdf8d64f018e": {core.BlobObject, 4727},
+	"d303f8bf224ac3e764f15835a195a2e1ebc9f3d0": {core.BlobObject, 4727},
+	"8f22242b4c0ad4031023ddb35fbec8de17b63866": {core.BlobObject, 4732},
+	"25e97795cd748aaf66d8e562bc64e8fff3c2c4e4": {core.BlobObject, 4737},
+	"c39752edf1e0e8cf38e40b19a17fd8843df0490f": {core.BlobObject, 4737},
+	"9e45ed60565aea5799d5c1044c4260a1820deac1": {core.BlobObject, 4738},
+	"ce013625030ba8dba906f756967f9e9ca394464a": {core.BlobObject, 6},
+	"5973dbfb1076793908bf218aa4295fb8622f99f6": {core.CommitObject, 163},
+	"05c5c1f8f5ec662365a05d5136753a7a7e0535db": {core.CommitObject, 211},
+	"0874541cfea416a0d19e528a1ad17b8bf4b970d5": {core.CommitObject, 211},
+	"18f4963bf0fff1a751cc7ddf6210c2a7cf22b1ab": {core.CommitObject, 211},
+	"2660ce90dbae61ba0e5395bdf1a69d7aae0a140f": {core.CommitObject, 211},
+	"6fd2c1c2a43281684a735247d6c31ca08d071f6e": {core.CommitObject, 211},
+	"b3626848d8784cea0650fd6b92648ad051fa5b64": {core.CommitObject, 211},
+	"bfbb2e080e618a92cc8028e6b93d6acf4f477f89": {core.CommitObject, 211},
+	"dfa83c34fd13e4266dc1d4c4a1913006454467a8": {core.CommitObject, 211},
+	"e7e458c631ef1948a0642e7aa947c8c52422c4cc": {core.CommitObject, 211},
+	"0bd504193af9688be9bbaf35e481fcbf384fac32": {core.CommitObject, 212},
+	"753ff3de63ea9c8fdce64eef1ce2beb1d2461b0f": {core.CommitObject, 212},
+	"9956a71bde8930d7574de16ca5c1e81ec15704ae": {core.CommitObject, 212},
+	"e13d81cf90fd5a4d61da8554073a7dad3b6d1e1c": {core.CommitObject, 215},
+	"07735f40a5b5a60531970b6699477aa779a9ae46": {core.TreeObject, 70},
+	"0caec0768ac0fa7b93602dfbb17160afe0ea4872": {core.TreeObject, 70},
+	"12e4956c415614c7a49c665de16f7333d741638b": {core.TreeObject, 70},
+	"16542536d5d51260161cfb2e1d82816de96637d1": {core.TreeObject, 70},
+	"1abc209cce7c214eaca0ef6e39e324b5a56574f5": {core.TreeObject, 70},
+	"2c6422477f5df458982cf307545450b094c19bad": {core.TreeObject, 70},
+	"3aa7a26ac1c4770d1a52525c52a1731a1e97534c": {core.TreeObject, 70},
+	"3d29c60c7e85575a042ff01b53b137c73697a8bd": {core.TreeObject, 70},
+	"65be9ba7db3656826a2df357501e5b28ff57c20c": {core.TreeObject, 70},
+	"660ae3c4b48b0dc7ccf20c027e9564c04d054b62": {core.TreeObject, 70},
+	"7d0b089bf7fede538227a1ae19e14c199d7939ba": {core.TreeObject, 70},
+	"bf54e19762b5e2145808f2c0946d142b44e5afae": {core.TreeObject, 70},
+	"bfae8efee73bb3ac3dfd4a6146213430ec4c967d": {core.TreeObject, 70},
+	"c5079294be67e7da836bc5961c3e6884d616dd14": {core.TreeObject, 70},
+}
+
+func (s *PackSuite) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract("fixtures/packed-objects.tgz")
+	c.Assert(err, IsNil)
+
+	fs := fs.NewOS()
+	s.storage, err = filesystem.New(fs, fs.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *PackSuite) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *PackSuite) TestGet(c *C) {
+	os := s.storage.ObjectStorage()
+	for hash, expected := range packedObjects {
+		com := Commentf("hash=%s", hash)
+		h := core.NewHash(hash)
+
+		obj, err := os.Get(h)
+		c.Assert(err, IsNil, com)
+		c.Assert(obj.Hash(), Equals, h, com)
+		c.Assert(obj.Type(), Equals, expected.typ, com)
+		c.Assert(obj.Size(), Equals, expected.size, com)
+		c.Assert(core.ComputeHash(obj.Type(), obj.Content()), Equals, h, com)
+	}
+
+	// a blob at the end of a chain of ref-deltas
+	blob, err := os.Get(core.NewHash("95f03e07b3b9c4c3d5b44ceaa3f5cdf8d64f018e"))
+	c.Assert(err, IsNil)
+	c.Assert(string(blob.Content()[:20]), Equals, "line number 1\nline n")
+
+	_, err = os.Get(core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *PackSuite) TestGetConcurrent(c *C) {
+	os := s.storage.ObjectStorage()
+	c.Assert(os.(core.ConcurrentSafeObjectStorage).ConcurrentSafe(), Equals, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range packedObjects {
+				h := core.NewHash(hash)
+				obj, err := os.Get(h)
+				c.Check(err, IsNil)
+				c.Check(core.ComputeHash(obj.Type(), obj.Content()), Equals, h)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (s *PackSuite) TestHas(c *C) {
+	os := s.storage.ObjectStorage()
+	for hash := range packedObjects {
+		ok, err := core.HasObject(os, core.NewHash(hash))
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, true, Commentf("hash=%s", hash))
+	}
+
+	ok, err := core.HasObject(os, core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *PackSuite) TestHashesWithPrefix(c *C) {
+	os := s.storage.ObjectStorage()
+	for _, prefix := range []string{
+		"", "0", "07", "073", "3d29", "ce01", "ffff",
+		"ce013625030ba8dba906f756967f9e9ca394464a",
+	} {
+		var expected []string
+		for hash := range packedObjects {
+			if strings.HasPrefix(hash, prefix) {
+				expected = append(expected, hash)
+			}
+		}
+		sort.Strings(expected)
+
+		hashes, err := core.HashesWithPrefix(os, prefix)
+		c.Assert(err, IsNil)
+
+		var obtained []string
+		for _, h := range hashes {
+			obtained = append(obtained, h.String())
+		}
+
+		c.Assert(obtained, DeepEquals, expected, Commentf("prefix=%s", prefix))
+	}
+}
+
+func (s *PackSuite) TestIter(c *C) {
+	for _, t := range []core.ObjectType{
+		core.CommitObject,
+		core.TreeObject,
+		core.BlobObject,
+		core.TagObject,
+	} {
+		iter, err := s.storage.ObjectStorage().Iter(t)
+		c.Assert(err, IsNil)
+
+		obtained := make(map[string]bool, 0)
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+			c.Assert(obtained[obj.Hash().String()], Equals, false)
+			obtained[obj.Hash().String()] = true
+		}
+
+		expected := make(map[string]bool, 0)
+		for hash, obj := range packedObjects {
+			if obj.typ == t {
+				expected[hash] = true
+			}
+		}
+
+		c.Assert(obtained, DeepEquals, expected, Commentf("type=%s", t))
+	}
+}
+
+type WritePackSuite struct {
+	dir string
+}
+
+var _ = Suite(&WritePackSuite{})
+
+func (s *WritePackSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = tgz.Extract("fixtures/packed-objects.tgz")
+	c.Assert(err, IsNil)
+}
+
+func (s *WritePackSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *WritePackSuite) TestWritePack(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	objects := storage.ObjectStorage().(*filesystem.ObjectStorage)
+
+	var hashes []core.Hash
+	for hash := range packedObjects {
+		hashes = append(hashes, core.NewHash(hash))
+	}
+
+	checksum, err := objects.WritePack(hashes, packfile.DefaultEncoderOptions)
+	c.Assert(err, IsNil)
+
+	dir := filepath.Join(s.dir, ".git", "objects", "pack")
+	name := filepath.Join(dir, "pack-"+checksum.String())
+	pack, err := ioutil.ReadFile(name + ".pack")
+	c.Assert(err, IsNil)
+	c.Assert(pack[len(pack)-20:], DeepEquals, checksum.Bytes())
+
+	idx, err := ioutil.ReadFile(name + ".idx")
+	c.Assert(err, IsNil)
+	assertIdx(c, idx, pack, hashes)
+
+	for _, path := range []string{name + ".pack", name + ".idx"} {
+		fi, err := os.Stat(path)
+		c.Assert(err, IsNil)
+		c.Assert(fi.Mode(), Equals, os.FileMode(0444), Commentf("path=%s", path))
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		c.Assert(strings.HasPrefix(f.Name(), "tmp_"), Equals, false, Commentf("file=%s", f.Name()))
+	}
+
+	// the objects are found in the new packfile alone
+	alone := c.MkDir()
+	packDir := filepath.Join(alone, "objects", "pack")
+	c.Assert(os.MkdirAll(packDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(packDir, "pack-new.pack"), pack, 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(packDir, "pack-new.idx"), idx, 0644), IsNil)
+
+	aloneStorage, err := filesystem.New(fs.NewOS(), alone)
+	c.Assert(err, IsNil)
+	for _, h := range hashes {
+		expected, err := objects.Get(h)
+		c.Assert(err, IsNil)
+
+		obtained, err := aloneStorage.ObjectStorage().Get(h)
+		c.Assert(err, IsNil, Commentf("hash=%s", h))
+		c.Assert(obtained.Type(), Equals, expected.Type())
+		c.Assert(obtained.Content(), DeepEquals, expected.Content())
+	}
+}
+
+func (s *WritePackSuite) TestWritePackReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	_, err = storage.ObjectStorage().(*filesystem.ObjectStorage).WritePack(nil, packfile.EncoderOptions{})
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *WritePackSuite) TestWritePackfile(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	var hashes []core.Hash
+	for hash := range packedObjects {
+		hashes = append(hashes, core.NewHash(hash))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err = packfile.NewEncoderWithOptions(storage.ObjectStorage(), packfile.DefaultEncoderOptions).Encode(buf, hashes)
+	c.Assert(err, IsNil)
+	pack := buf.Bytes()
+
+	dir := c.MkDir()
+	empty, err := filesystem.New(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+	objects := empty.ObjectStorage().(*filesystem.ObjectStorage)
+
+	progress := bytes.NewBuffer(nil)
+	checksum, err := objects.WritePackfile(bytes.NewReader(pack), nil, progress)
+	c.Assert(err, IsNil)
+	c.Assert(checksum.Bytes(), DeepEquals, pack[len(pack)-20:])
+	c.Assert(progress.String(), Matches, ".*Indexing objects: 100% .*, done.\n")
+
+	name := filepath.Join(dir, "objects", "pack", "pack-"+checksum.String())
+	written, err := ioutil.ReadFile(name + ".pack")
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, pack)
+
+	idx, err := ioutil.ReadFile(name + ".idx")
+	c.Assert(err, IsNil)
+	assertIdx(c, idx, pack, hashes)
+
+	for _, h := range hashes {
+		expected, err := storage.ObjectStorage().Get(h)
+		c.Assert(err, IsNil)
+
+		obtained, err := objects.Get(h)
+		c.Assert(err, IsNil, Commentf("hash=%s", h))
+		c.Assert(obtained.Content(), DeepEquals, expected.Content())
+	}
+}
+
+func (s *WritePackSuite) TestWritePackfileThin(c *C) {
+	thin, err := ioutil.ReadFile("../../formats/packfile/fixtures/thin.pack")
+	c.Assert(err, IsNil)
+
+	f, err := os.Open("../../formats/packfile/fixtures/thin-base.pack")
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	bases := memory.NewObjectStorage()
+	c.Assert(packfile.NewDecoder(packfile.NewSeekable(f)).Decode(bases), IsNil)
+
+	dir := c.MkDir()
+	storage, err := filesystem.New(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+	objects := storage.ObjectStorage().(*filesystem.ObjectStorage)
+
+	_, err = objects.WritePackfile(bytes.NewReader(thin), nil, nil)
+	c.Assert(err, ErrorMatches, "cannot recall object: by hash .*")
+
+	checksum, err := objects.WritePackfile(bytes.NewReader(thin), bases, nil)
+	c.Assert(err, IsNil)
+
+	// the packfile kept is completed with its delta base
+	name := filepath.Join(dir, "objects", "pack", "pack-"+checksum.String())
+	idx := &idxfile.Idxfile{}
+	content, err := ioutil.ReadFile(name + ".idx")
+	c.Assert(err, IsNil)
+	c.Assert(idxfile.NewDecoder(bytes.NewReader(content)).Decode(idx), IsNil)
+	c.Assert(idx.Entries, HasLen, 4)
+
+	for _, h := range []string{
+		"0dc1c74dab291f0c7b35680dafb390bf97a40ffe",
+		"11ff56e20e8a30201eb057e9ade09fcc4e6db569",
+	} {
+		_, err := objects.Get(core.NewHash(h))
+		c.Assert(err, IsNil, Commentf("hash=%s", h))
+	}
+
+	assertNoTempFiles(c, filepath.Join(dir, "objects", "pack"))
+}
+
+func (s *WritePackSuite) TestWritePackfileBadChecksum(c *C) {
+	pack, err := ioutil.ReadFile("../../formats/packfile/fixtures/git-fixture.ofs-delta")
+	c.Assert(err, IsNil)
+	pack[len(pack)-1]++
+
+	dir := c.MkDir()
+	storage, err := filesystem.New(fs.NewOS(), dir)
+	c.Assert(err, IsNil)
+
+	_, err = storage.ObjectStorage().(*filesystem.ObjectStorage).WritePackfile(bytes.NewReader(pack), nil, nil)
+	c.Assert(err, Equals, packfile.ErrBadChecksum)
+	assertNoTempFiles(c, filepath.Join(dir, "objects", "pack"))
+}
+
+func (s *WritePackSuite) TestWritePackfileReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	_, err = storage.ObjectStorage().(*filesystem.ObjectStorage).WritePackfile(bytes.NewReader(nil), nil, nil)
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *WritePackSuite) TestStrict(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	strict := core.NewVerifyingObjectStorage(storage.ObjectStorage())
+	for hash, expected := range packedObjects {
+		obj, err := strict.Get(core.NewHash(hash))
+		c.Assert(err, IsNil, Commentf("hash=%s", hash))
+		c.Assert(obj.Size(), Equals, expected.size)
+	}
+
+	iter, err := strict.Iter(core.CommitObject)
+	c.Assert(err, IsNil)
+	c.Assert(core.ForEachContext(context.Background(), iter, func(core.Object) error { return nil }), IsNil)
+}
+
+func (s *WritePackSuite) TestStrictBadChecksum(c *C) {
+	packs, err := filepath.Glob(filepath.Join(s.dir, ".git", "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, Not(HasLen), 0)
+	for _, path := range packs {
+		pack, err := ioutil.ReadFile(path)
+		c.Assert(err, IsNil)
+		pack[len(pack)/2]++
+		c.Assert(os.Chmod(path, 0644), IsNil)
+		c.Assert(ioutil.WriteFile(path, pack, 0644), IsNil)
+	}
+
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	// a blob of a packfile, the loose ones are still read
+	strict := core.NewVerifyingObjectStorage(storage.ObjectStorage())
+	_, err = strict.Get(core.NewHash("afb9e4aa23fcc9111239cece8cdbc17a5f46b7ad"))
+	c.Assert(err, Equals, packfile.ErrBadChecksum)
+	_, err = strict.Get(core.NewHash("c39752edf1e0e8cf38e40b19a17fd8843df0490f"))
+	c.Assert(err, IsNil)
+}
+
+func (s *WritePackSuite) TestDelete(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	objects := storage.ObjectStorage().(*filesystem.ObjectStorage)
+
+	packed := core.NewHash("afb9e4aa23fcc9111239cece8cdbc17a5f46b7ad")
+	c.Assert(objects.Delete(packed), Equals, core.ErrObjectNotDeletable)
+	_, err = objects.Get(packed)
+	c.Assert(err, IsNil)
+
+	// the packed objects have the time of their packfile
+	mtime, err := objects.ModTime(packed)
+	c.Assert(err, IsNil)
+	packs, err := filepath.Glob(filepath.Join(s.dir, ".git", "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	found := false
+	for _, path := range packs {
+		fi, err := os.Stat(path)
+		c.Assert(err, IsNil)
+		found = found || fi.ModTime().Equal(mtime)
+	}
+	c.Assert(found, Equals, true)
+
+	loose := core.NewHash("c39752edf1e0e8cf38e40b19a17fd8843df0490f")
+	c.Assert(objects.Delete(loose), IsNil)
+	_, err = objects.Get(loose)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *WritePackSuite) TestRepack(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	objects := storage.ObjectStorage().(*filesystem.ObjectStorage)
+
+	hashes, err := core.HashesWithPrefix(objects, "")
+	c.Assert(err, IsNil)
+
+	expected := make(map[core.Hash]core.Object, len(hashes))
+	for _, h := range hashes {
+		obj, err := objects.Get(h)
+		c.Assert(err, IsNil)
+		expected[h] = memory.NewObject(obj.Type(), obj.Size(), obj.Content())
+	}
+
+	stats, err := objects.Repack(hashes, packfile.DefaultEncoderOptions)
+	c.Assert(err, IsNil)
+	c.Assert(stats.Objects, Equals, len(hashes))
+
+	dir := filepath.Join(s.dir, ".git", "objects")
+	loose, err := filepath.Glob(filepath.Join(dir, "??", "*"))
+	c.Assert(err, IsNil)
+	c.Assert(loose, HasLen, 0)
+
+	packs, err := filepath.Glob(filepath.Join(dir, "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(packs, HasLen, 1)
+	idxs, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+	c.Assert(err, IsNil)
+	c.Assert(idxs, HasLen, 1)
+	assertNoTempFiles(c, filepath.Join(dir, "pack"))
+
+	var size int64
+	for _, path := range []string{packs[0], idxs[0]} {
+		fi, err := os.Stat(path)
+		c.Assert(err, IsNil)
+		size += fi.Size()
+	}
+	c.Assert(stats.SizeAfter, Equals, size)
+	c.Assert(stats.SizeBefore > stats.SizeAfter, Equals, true)
+
+	// the objects are read from the new packfile, by this storage and a new
+	// one
+	reopened, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	for _, sto := range []core.ObjectStorage{objects, reopened.ObjectStorage()} {
+		for h, obj := range expected {
+			obtained, err := sto.Get(h)
+			c.Assert(err, IsNil, Commentf("hash=%s", h))
+			c.Assert(obtained.Type(), Equals, obj.Type())
+			c.Assert(obtained.Content(), DeepEquals, obj.Content())
+		}
+	}
+}
+
+// the packfiles with objects not repacked are kept
+func (s *WritePackSuite) TestRepackPartial(c *C) {
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	objects := storage.ObjectStorage().(*filesystem.ObjectStorage)
+
+	loose := core.NewHash("c39752edf1e0e8cf38e40b19a17fd8843df0490f")
+	packed := core.NewHash("afb9e4aa23fcc9111239cece8cdbc17a5f46b7ad")
+	before, err := filepath.Glob(filepath.Join(s.dir, ".git", "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+
+	_, err = objects.Repack([]core.Hash{loose, packed}, packfile.DefaultEncoderOptions)
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(filepath.Join(s.dir, ".git", "objects", "c3", loose.String()[2:]))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	after, err := filepath.Glob(filepath.Join(s.dir, ".git", "objects", "pack", "*.pack"))
+	c.Assert(err, IsNil)
+	c.Assert(after, HasLen, len(before)+1)
+
+	for _, h := range []core.Hash{loose, packed} {
+		_, err := objects.Get(h)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *WritePackSuite) TestRepackReadOnly(c *C) {
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	_, err = storage.ObjectStorage().(*filesystem.ObjectStorage).Repack(nil, packfile.EncoderOptions{})
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+// assertNoTempFiles checks that there are no files in dir but the packfiles
+// and their idx files.
+func assertNoTempFiles(c *C, dir string) {
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		c.Assert(strings.HasPrefix(f.Name(), "tmp_"), Equals, false, Commentf("file=%s", f.Name()))
+	}
+}
+
+// assertIdx checks the invariants of the idx file of a packfile with the
+// given objects.
+func assertIdx(c *C, content, pack []byte, hashes []core.Hash) {
+	idx := &idxfile.Idxfile{}
+	c.Assert(idxfile.NewDecoder(bytes.NewReader(content)).Decode(idx), IsNil)
+
+	sum := sha1.Sum(content[:len(content)-20])
+	c.Assert(idx.IdxChecksum.Bytes(), DeepEquals, sum[:])
+	c.Assert(idx.PackfileChecksum.Bytes(), DeepEquals, pack[len(pack)-20:])
+	c.Assert(idx.ObjectCount, Equals, uint32(len(hashes)))
+
+	expected := make(map[core.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		expected[h] = true
+	}
+
+	obtained := make(map[core.Hash]bool, len(idx.Entries))
+	for i, e := range idx.Entries {
+		if i > 0 {
+			c.Assert(bytes.Compare(idx.Entries[i-1].Hash[:], e.Hash[:]) < 0, Equals, true)
+		}
+
+		obtained[e.Hash] = true
+	}
+	c.Assert(obtained, DeepEquals, expected)
+
+	// the entries of the packfile are one after the other
+	entries := append([]idxfile.Entry(nil), idx.Entries...)
+	sort.Sort(entriesByOffset(entries))
+	c.Assert(entries[0].Offset, Equals, uint64(12))
+	for i, e := range entries {
+		end := uint64(len(pack) - 20)
+		if i+1 < len(entries) {
+			end = entries[i+1].Offset
+		}
+
+		crc := crc32.ChecksumIEEE(pack[e.Offset:end])
+		c.Assert(binary.BigEndian.Uint32(e.CRC32[:]), Equals, crc, Commentf("hash=%s", e.Hash))
+	}
+}
+
+type entriesByOffset []idxfile.Entry
+
+func (s entriesByOffset) Len() int           { return len(s) }
+func (s entriesByOffset) Less(i, j int) bool { return s[i].Offset < s[j].Offset }
+func (s entriesByOffset) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
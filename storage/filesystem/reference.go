@@ -0,0 +1,631 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const (
+	refsDir        = "refs"
+	packedRefsPath = "packed-refs"
+	lockSuffix     = ".lock"
+
+	// packedRefsHeader starts the first line of the packed-refs files, with
+	// the traits of the file
+	packedRefsHeader = "# pack-refs with:"
+)
+
+// ReferenceStorage is an implementation of core.ReferenceStorage for the
+// references of a git directory: the loose ones, HEAD, the pseudo references
+// as MERGE_HEAD and the files under refs/, and the ones in the packed-refs
+// file. The loose references take
+// precedence over the packed ones with the same name, as they do in git.
+//
+// New references are written as loose references, the packed-refs file is
+// never written, when the fs.FS of the storage is a fs.WriteFS.
+type ReferenceStorage struct {
+	fs  fs.FS
+	dir string
+}
+
+// NewReferenceStorage returns a new ReferenceStorage for the references of
+// the git directory at the given path.
+func NewReferenceStorage(fs fs.FS, path string) *ReferenceStorage {
+	return &ReferenceStorage{fs: fs, dir: path}
+}
+
+// Set writes the reference to its file, replacing the loose reference with
+// the same name if there is one. The packed reference with the same name,
+// if any, is left as it is, as the loose one takes precedence over it.
+//
+// The reference is written to its lock file, renamed when complete, as
+// SetChecked does, so ErrLocked is returned if another writer is updating
+// it. Only HEAD, the pseudo references and the names under refs/ can be
+// written, ErrInvalidReferenceName is returned otherwise. ErrReadOnly is
+// returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ReferenceStorage) Set(ref *core.Reference) error {
+	return s.setLocked(ref, nil)
+}
+
+// SetChecked writes the reference only if the stored one with the same
+// name, loose or packed, is old, or there is none if old is nil, returning
+// core.ErrReferenceHasChanged otherwise, see core.SetReferenceChecked.
+//
+// The same lock file protocol of git is followed: the reference is written
+// to its lock file, the name of its file followed by .lock, created only if
+// it does not exist, and renamed to its file once the stored reference is
+// checked, so ErrLocked is returned if another writer is updating it.
+func (s *ReferenceStorage) SetChecked(new, old *core.Reference) error {
+	return s.setLocked(new, func() error {
+		current, err := s.Get(new.Name)
+		if err != nil && err != core.ErrReferenceNotFound {
+			return err
+		}
+
+		return core.CheckReferenceUnchanged(current, old)
+	})
+}
+
+// setLocked writes the reference to its lock file, renamed to its file if
+// check, called once the file is locked, returns no error. The lock file is
+// removed on any error.
+func (s *ReferenceStorage) setLocked(new *core.Reference, check func() error) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	parts, ok := splitReferenceName(new.Name)
+	if !ok {
+		return ErrInvalidReferenceName
+	}
+
+	if new.Type != core.HashReference && new.Type != core.SymbolicReference {
+		return core.ErrInvalidReference
+	}
+
+	if err := wfs.MkdirAll(s.path(parts[:len(parts)-1]), 0755); err != nil {
+		return err
+	}
+
+	path := s.path(parts)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return err
+	}
+
+	written := false
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil && written {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil || !written {
+			wfs.Remove(lock.Name())
+		}
+	}()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(lock, new.Content()+"\n"); err != nil {
+		return err
+	}
+
+	written = true
+	return lock.Sync()
+}
+
+// lockFile creates the lock file of the file at the given path, returning
+// ErrLocked if it already exists.
+func lockFile(wfs fs.WriteFS, path string) (fs.File, error) {
+	lock, err := wfs.OpenFile(path+lockSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, ErrLocked
+	}
+
+	return lock, err
+}
+
+// Get returns the reference with the given name, read from its file, or from
+// the packed-refs file if there is no such file. Only HEAD, the pseudo
+// references, which are never packed, and the names under refs/ can be
+// found.
+func (s *ReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
+	parts, ok := splitReferenceName(n)
+	if !ok {
+		return nil, core.ErrReferenceNotFound
+	}
+
+	ref, err := s.read(n, parts)
+	if err != core.ErrReferenceNotFound || len(parts) == 1 {
+		return ref, err
+	}
+
+	packed, err := s.packedRefs(n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range packed {
+		if ref.Name == n {
+			return ref, nil
+		}
+	}
+
+	return nil, core.ErrReferenceNotFound
+}
+
+// Remove deletes the reference with the given name, as git does: it is
+// removed from the packed-refs file first, if it is there, and then its
+// loose file is removed, along with the directories left empty under
+// refs/heads, refs/tags and the like.
+//
+// The packed-refs file is rewritten to its lock file, packed-refs.lock,
+// renamed when complete, so ErrLocked is returned if the file is locked by
+// another writer. ErrReadOnly is returned if the fs.FS of the storage is not
+// a fs.WriteFS.
+func (s *ReferenceStorage) Remove(n core.ReferenceName) error {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	parts, ok := splitReferenceName(n)
+	if !ok {
+		return core.ErrReferenceNotFound
+	}
+
+	packed, err := s.removePacked(wfs, n)
+	if err != nil {
+		return err
+	}
+
+	loose, err := s.removeLoose(wfs, parts)
+	if err != nil {
+		return err
+	}
+
+	if !packed && !loose {
+		return core.ErrReferenceNotFound
+	}
+
+	return nil
+}
+
+func (s *ReferenceStorage) removeLoose(wfs fs.WriteFS, parts []string) (bool, error) {
+	path := s.path(parts)
+	fi, err := s.fs.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if fi.IsDir() {
+		return false, nil
+	}
+
+	if err := wfs.Remove(path); err != nil {
+		return false, err
+	}
+
+	// only the empty directories are removed, the first error stops it
+	for i := len(parts) - 1; i > 2; i-- {
+		if wfs.Remove(s.path(parts[:i])) != nil {
+			break
+		}
+	}
+
+	return true, nil
+}
+
+// removePacked rewrites the packed-refs file without the reference with the
+// given name, if it is there.
+func (s *ReferenceStorage) removePacked(wfs fs.WriteFS, n core.ReferenceName) (removed bool, err error) {
+	if ok, err := s.isPacked(n); err != nil || !ok {
+		return false, err
+	}
+
+	path := s.fs.Join(s.dir, packedRefsPath)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil && removed {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil || !removed {
+			wfs.Remove(lock.Name())
+		}
+	}()
+
+	// read again, it could be rewritten before it was locked
+	content, err := s.readPackedRefs()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := parsePackedRefs(bytes.NewReader(content), ""); err != nil {
+		return false, err
+	}
+
+	filtered := removePackedRef(content, n)
+	if len(filtered) == len(content) {
+		return false, nil
+	}
+
+	if _, err := lock.Write(filtered); err != nil {
+		return false, err
+	}
+
+	return true, lock.Sync()
+}
+
+func (s *ReferenceStorage) isPacked(n core.ReferenceName) (bool, error) {
+	refs, err := s.packedRefs(n.String())
+	if err != nil {
+		return false, err
+	}
+
+	for _, ref := range refs {
+		if ref.Name == n {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// removePackedRef returns the contents of a valid packed-refs file without
+// the line of the reference with the given name, and its peeled line, if
+// any. The rest of the lines are kept as they are.
+func removePackedRef(content []byte, n core.ReferenceName) []byte {
+	var buf bytes.Buffer
+	removed := false
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if removed && len(line) > 0 && line[0] == '^' {
+			continue
+		}
+
+		removed = false
+		fields := strings.Fields(string(line))
+		if len(fields) == 2 && line[0] != '#' && line[0] != '^' && fields[1] == n.String() {
+			removed = true
+			continue
+		}
+
+		buf.Write(line)
+	}
+
+	return buf.Bytes()
+}
+
+// Iter returns an iterator for all the references, HEAD, the ones under
+// refs/ and the packed ones without a loose reference, sorted by name.
+func (s *ReferenceStorage) Iter() (core.ReferenceIter, error) {
+	return s.IterPrefix("")
+}
+
+// IterPrefix returns an iterator for the references whose name starts with
+// the given prefix, sorted by name, as Iter does. Only the directory of the
+// prefix is walked, refs/heads for "refs/heads/" or "refs/heads/fo", and,
+// if the packed-refs file is sorted, as git writes it, its scan stops at the
+// first reference after the prefix.
+func (s *ReferenceStorage) IterPrefix(prefix string) (core.ReferenceIter, error) {
+	var refs []*core.Reference
+	if strings.HasPrefix(core.HEAD.String(), prefix) {
+		head, err := s.Get(core.HEAD)
+		switch err {
+		case nil:
+			refs = append(refs, head)
+		case core.ErrReferenceNotFound:
+		default:
+			return nil, err
+		}
+	}
+
+	if parts, ok := prefixDir(prefix); ok {
+		var loose []*core.Reference
+		if err := s.walk(parts, &loose); err != nil {
+			return nil, err
+		}
+
+		for _, ref := range loose {
+			if strings.HasPrefix(ref.Name.String(), prefix) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	packed, err := s.packedRefs(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	loose := make(map[core.ReferenceName]bool, len(refs))
+	for _, ref := range refs {
+		loose[ref.Name] = true
+	}
+
+	for _, ref := range packed {
+		if !loose[ref.Name] {
+			refs = append(refs, ref)
+		}
+	}
+
+	sort.Sort(referencesByName(refs))
+	return core.NewReferenceSliceIter(refs), nil
+}
+
+// prefixDir returns the components of the deepest directory under refs/
+// holding all the references with the given prefix, if there can be any.
+func prefixDir(prefix string) ([]string, bool) {
+	if strings.HasPrefix(refsDir+"/", prefix) {
+		return []string{refsDir}, true
+	}
+
+	if !strings.HasPrefix(prefix, refsDir+"/") {
+		return nil, false
+	}
+
+	parts := strings.Split(prefix[:strings.LastIndex(prefix, "/")], "/")
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." {
+			return nil, false
+		}
+	}
+
+	return parts, true
+}
+
+func (s *ReferenceStorage) walk(parts []string, refs *[]*core.Reference) error {
+	files, err := s.fs.ReadDir(s.path(parts))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, f := range files {
+		// the lock files of the references being written
+		if strings.HasSuffix(f.Name(), lockSuffix) {
+			continue
+		}
+
+		child := append(parts[:len(parts):len(parts)], f.Name())
+		if f.IsDir() {
+			if err := s.walk(child, refs); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		ref, err := s.read(core.ReferenceName(strings.Join(child, "/")), child)
+		if err != nil {
+			return err
+		}
+
+		*refs = append(*refs, ref)
+	}
+
+	return nil
+}
+
+func (s *ReferenceStorage) read(n core.ReferenceName, parts []string) (ref *core.Reference, err error) {
+	path := s.path(parts)
+	fi, err := s.fs.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, core.ErrReferenceNotFound
+		}
+
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return nil, core.ErrReferenceNotFound
+	}
+
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.ParseReference(n, string(content))
+}
+
+// packedRefs returns the references of the packed-refs file whose name
+// starts with the given prefix, in the order they are found, or none if
+// there is no such file.
+func (s *ReferenceStorage) packedRefs(prefix string) ([]*core.Reference, error) {
+	content, err := s.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePackedRefs(bytes.NewReader(content), prefix)
+}
+
+// readPackedRefs returns the contents of the packed-refs file, or nil if
+// there is no such file.
+func (s *ReferenceStorage) readPackedRefs() (content []byte, err error) {
+	f, err := s.fs.Open(s.fs.Join(s.dir, packedRefsPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	return ioutil.ReadAll(f)
+}
+
+// parsePackedRefs parses the contents of a packed-refs file: a header
+// comment with the traits of the file, like "# pack-refs with: peeled", and
+// a line per reference with its hash and its name, followed by a line with
+// the hash of the object pointed by the tag, starting with "^", for the
+// peeled annotated tags. The peeled hashes are validated but ignored.
+//
+// Only the references whose name starts with the given prefix are returned,
+// and the parsing stops at the first one after them if the header has the
+// sorted trait, so the rest of the file is not validated.
+func parsePackedRefs(r io.Reader, prefix string) ([]*core.Reference, error) {
+	var refs []*core.Reference
+	s := bufio.NewScanner(r)
+	peelable, sorted := false, false
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, packedRefsHeader):
+			sorted = hasTrait(line[len(packedRefsHeader):], "sorted")
+			continue
+		case line == "" || line[0] == '#':
+			continue
+		case line[0] == '^':
+			if !peelable {
+				return nil, ErrPackedRefsBadFormat
+			}
+
+			if _, err := core.ParseReference("", line[1:]); err != nil {
+				return nil, ErrPackedRefsBadFormat
+			}
+
+			// a reference is peeled once
+			peelable = false
+			continue
+		}
+
+		fields := strings.Split(line, " ")
+		if len(fields) != 2 {
+			return nil, ErrPackedRefsBadFormat
+		}
+
+		matches := strings.HasPrefix(fields[1], prefix)
+		if sorted && !matches && fields[1] > prefix {
+			break
+		}
+
+		ref, err := core.ParseReference(core.ReferenceName(fields[1]), fields[0])
+		if err != nil || ref.Type != core.HashReference {
+			return nil, ErrPackedRefsBadFormat
+		}
+
+		peelable = true
+		if matches {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, s.Err()
+}
+
+func hasTrait(traits, trait string) bool {
+	for _, t := range strings.Fields(traits) {
+		if t == trait {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *ReferenceStorage) path(parts []string) string {
+	return s.fs.Join(append([]string{s.dir}, parts...)...)
+}
+
+// splitReferenceName returns the components of the name of a reference, if
+// it is HEAD, a pseudo reference, see isPseudoReference, or a name under
+// refs/ without empty, "." or ".." components, nor components ending with
+// .lock, the suffix of the lock files.
+func splitReferenceName(n core.ReferenceName) ([]string, bool) {
+	if n == core.HEAD || isPseudoReference(n) {
+		return []string{n.String()}, true
+	}
+
+	parts := strings.Split(n.String(), "/")
+	if len(parts) < 2 || parts[0] != refsDir {
+		return nil, false
+	}
+
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." || strings.HasSuffix(p, lockSuffix) {
+			return nil, false
+		}
+	}
+
+	return parts, true
+}
+
+// isPseudoReference returns true if the name is the one of a pseudo
+// reference, the files of the git directory as MERGE_HEAD or ORIG_HEAD:
+// uppercase letters and underscores ending with "_HEAD".
+func isPseudoReference(n core.ReferenceName) bool {
+	s := n.String()
+	if !strings.HasSuffix(s, "_HEAD") {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+type referencesByName []*core.Reference
+
+func (s referencesByName) Len() int           { return len(s) }
+func (s referencesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s referencesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,374 @@
+package filesystem_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	"github.com/alcortesm/tgz"
+	. "gopkg.in/check.v1"
+)
+
+type ReferenceSuite struct {
+	dir     string
+	storage core.CheckedReferenceStorage
+}
+
+var _ = Suite(&ReferenceSuite{})
+
+// the references of the fixture, obtained with git for-each-ref: master and
+// new are loose references, master is also in packed-refs with another hash
+var packedRefsFixture = []string{
+	"ref: refs/heads/master HEAD",
+	"6a1ba8926d1a2065c9f63231cc2cb052e16eed64 refs/heads/feature",
+	"e11a03fb06b08fb3bc39d86cd4f56b183c281b1e refs/heads/master",
+	"e11a03fb06b08fb3bc39d86cd4f56b183c281b1e refs/heads/new",
+	"6a1ba8926d1a2065c9f63231cc2cb052e16eed64 refs/heads/old",
+	"d65924e9181849074e28fd5b5497264d872657eb refs/tags/v1.0",
+	"25b1f489493784477084d3c29b8cd4271bc5f347 refs/tags/v1.1",
+	"97ccd2e41cc376a574360cec587c7470df49846f refs/tags/v2.0",
+}
+
+func (s *ReferenceSuite) SetUpTest(c *C) {
+	var err error
+	s.dir, err = tgz.Extract("fixtures/packed-refs.tgz")
+	c.Assert(err, IsNil)
+
+	storage, err := filesystem.New(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	s.storage = storage.ReferenceStorage().(core.CheckedReferenceStorage)
+}
+
+func (s *ReferenceSuite) TearDownTest(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *ReferenceSuite) TestGet(c *C) {
+	for _, expected := range packedRefsFixture {
+		fields := strings.Fields(expected)
+		n := core.ReferenceName(fields[len(fields)-1])
+
+		ref, err := s.storage.Get(n)
+		c.Assert(err, IsNil, Commentf("name=%s", n))
+		c.Assert(ref.String(), Equals, expected)
+	}
+
+	_, err := s.storage.Get("refs/heads/foo")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *ReferenceSuite) TestIter(c *C) {
+	c.Assert(s.references(c), DeepEquals, packedRefsFixture)
+}
+
+func (s *ReferenceSuite) TestIterPrefix(c *C) {
+	for prefix, expected := range map[string][]string{
+		"":              packedRefsFixture,
+		"H":             packedRefsFixture[:1],
+		"refs":          packedRefsFixture[1:],
+		"refs/heads/":   packedRefsFixture[1:5],
+		"refs/heads/ne": packedRefsFixture[3:4],
+		"refs/tags/v1.": packedRefsFixture[5:7],
+		"refs/notes/":   nil,
+		"refs/../":      nil,
+	} {
+		iter, err := s.storage.(core.PrefixReferenceStorage).IterPrefix(prefix)
+		c.Assert(err, IsNil)
+		c.Assert(iterReferences(c, iter), DeepEquals, expected, Commentf("prefix=%q", prefix))
+	}
+}
+
+func (s *ReferenceSuite) TestIterPrefixSortedPackedRefs(c *C) {
+	hash := "6a1ba8926d1a2065c9f63231cc2cb052e16eed64"
+	path := filepath.Join(s.dir, ".git", "packed-refs")
+	content := hash + " refs/heads/feature\n" + hash + " refs/heads/old\nfoo refs/tags/v1.0\n"
+
+	// the malformed line after the branches is not read if the file is sorted
+	c.Assert(ioutil.WriteFile(path, []byte("# pack-refs with: peeled sorted \n"+content), 0644), IsNil)
+	iter, err := s.storage.(core.PrefixReferenceStorage).IterPrefix("refs/heads/")
+	c.Assert(err, IsNil)
+	c.Assert(iterReferences(c, iter), DeepEquals, packedRefsFixture[1:5])
+
+	_, err = s.storage.Iter()
+	c.Assert(err, Equals, filesystem.ErrPackedRefsBadFormat)
+
+	c.Assert(ioutil.WriteFile(path, []byte("# pack-refs with: peeled \n"+content), 0644), IsNil)
+	_, err = s.storage.(core.PrefixReferenceStorage).IterPrefix("refs/heads/")
+	c.Assert(err, Equals, filesystem.ErrPackedRefsBadFormat)
+}
+
+func (s *ReferenceSuite) TestSet(c *C) {
+	packed := s.readFile(c, "packed-refs")
+
+	for _, ref := range []*core.Reference{
+		core.NewHashReference("refs/heads/old", core.NewHash("e11a03fb06b08fb3bc39d86cd4f56b183c281b1e")),
+		core.NewHashReference("refs/heads/foo/bar", core.NewHash("d65924e9181849074e28fd5b5497264d872657eb")),
+		core.NewSymbolicReference(core.HEAD, "refs/heads/feature"),
+	} {
+		c.Assert(s.storage.Set(ref), IsNil)
+
+		obtained, err := s.storage.Get(ref.Name)
+		c.Assert(err, IsNil)
+		c.Assert(obtained, DeepEquals, ref)
+		c.Assert(s.readFile(c, ref.Name.String()), Equals, ref.Content()+"\n")
+	}
+
+	c.Assert(s.readFile(c, "packed-refs"), Equals, packed)
+	c.Assert(s.references(c), DeepEquals, []string{
+		"ref: refs/heads/feature HEAD",
+		"6a1ba8926d1a2065c9f63231cc2cb052e16eed64 refs/heads/feature",
+		"d65924e9181849074e28fd5b5497264d872657eb refs/heads/foo/bar",
+		"e11a03fb06b08fb3bc39d86cd4f56b183c281b1e refs/heads/master",
+		"e11a03fb06b08fb3bc39d86cd4f56b183c281b1e refs/heads/new",
+		"e11a03fb06b08fb3bc39d86cd4f56b183c281b1e refs/heads/old",
+		"d65924e9181849074e28fd5b5497264d872657eb refs/tags/v1.0",
+		"25b1f489493784477084d3c29b8cd4271bc5f347 refs/tags/v1.1",
+		"97ccd2e41cc376a574360cec587c7470df49846f refs/tags/v2.0",
+	})
+
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, ".git", "refs", "heads"))
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		c.Assert(strings.HasSuffix(f.Name(), ".lock"), Equals, false, Commentf("file=%s", f.Name()))
+	}
+}
+
+func (s *ReferenceSuite) TestPseudoReferences(c *C) {
+	ref := core.NewHashReference(core.MergeHead, core.NewHash("6a1ba8926d1a2065c9f63231cc2cb052e16eed64"))
+	c.Assert(s.storage.Set(ref), IsNil)
+	c.Assert(s.readFile(c, "MERGE_HEAD"), Equals, ref.Content()+"\n")
+
+	obtained, err := s.storage.Get(core.MergeHead)
+	c.Assert(err, IsNil)
+	c.Assert(obtained, DeepEquals, ref)
+
+	// they are not references of the repository
+	c.Assert(s.references(c), DeepEquals, packedRefsFixture)
+
+	c.Assert(s.storage.Remove(core.MergeHead), IsNil)
+	_, err = s.storage.Get(core.MergeHead)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	for _, n := range []core.ReferenceName{"merge_HEAD", "FOO", "_HEAD/FOO"} {
+		err := s.storage.Set(core.NewHashReference(n, core.ZeroHash))
+		c.Assert(err, Equals, filesystem.ErrInvalidReferenceName, Commentf("name=%s", n))
+	}
+}
+
+func (s *ReferenceSuite) TestSetLocked(c *C) {
+	ref := core.NewHashReference("refs/heads/new", core.NewHash("6a1ba8926d1a2065c9f63231cc2cb052e16eed64"))
+	lock := filepath.Join(s.dir, ".git", "refs", "heads", "new.lock")
+	c.Assert(ioutil.WriteFile(lock, []byte("foo"), 0644), IsNil)
+
+	c.Assert(s.storage.Set(ref), Equals, filesystem.ErrLocked)
+	c.Assert(s.readFile(c, "refs/heads/new.lock"), Equals, "foo")
+	c.Assert(s.readFile(c, "refs/heads/new"), Equals, "e11a03fb06b08fb3bc39d86cd4f56b183c281b1e\n")
+
+	c.Assert(os.Remove(lock), IsNil)
+	c.Assert(s.storage.Set(ref), IsNil)
+	c.Assert(s.readFile(c, "refs/heads/new"), Equals, ref.Content()+"\n")
+}
+
+func (s *ReferenceSuite) TestSetErrors(c *C) {
+	for _, n := range []core.ReferenceName{"config", "refs/../config", "refs//heads/foo"} {
+		err := s.storage.Set(core.NewHashReference(n, core.ZeroHash))
+		c.Assert(err, Equals, filesystem.ErrInvalidReferenceName, Commentf("name=%s", n))
+	}
+
+	err := s.storage.Set(&core.Reference{Name: "refs/heads/foo"})
+	c.Assert(err, Equals, core.ErrInvalidReference)
+
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	err = storage.ReferenceStorage().Set(core.NewSymbolicReference(core.HEAD, "refs/heads/feature"))
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *ReferenceSuite) TestSetChecked(c *C) {
+	feature := core.NewHashReference("refs/heads/feature", core.NewHash("6a1ba8926d1a2065c9f63231cc2cb052e16eed64"))
+	updated := core.NewHashReference("refs/heads/feature", core.NewHash("e11a03fb06b08fb3bc39d86cd4f56b183c281b1e"))
+	foo := core.NewSymbolicReference("refs/heads/foo", "refs/heads/feature")
+
+	c.Assert(s.storage.SetChecked(updated, updated), Equals, core.ErrReferenceHasChanged)
+	c.Assert(s.storage.SetChecked(updated, nil), Equals, core.ErrReferenceHasChanged)
+	c.Assert(s.storage.SetChecked(updated, feature), IsNil)
+	c.Assert(s.storage.SetChecked(foo, feature), Equals, core.ErrReferenceHasChanged)
+	c.Assert(s.storage.SetChecked(foo, nil), IsNil)
+
+	for _, ref := range []*core.Reference{updated, foo} {
+		obtained, err := s.storage.Get(ref.Name)
+		c.Assert(err, IsNil)
+		c.Assert(obtained, DeepEquals, ref)
+		c.Assert(s.readFile(c, ref.Name.String()), Equals, ref.Content()+"\n")
+
+		_, err = os.Stat(filepath.Join(s.dir, ".git", ref.Name.String()+".lock"))
+		c.Assert(os.IsNotExist(err), Equals, true)
+	}
+}
+
+func (s *ReferenceSuite) TestSetCheckedErrors(c *C) {
+	ref := core.NewHashReference("refs/heads/new", core.NewHash("6a1ba8926d1a2065c9f63231cc2cb052e16eed64"))
+	c.Assert(s.storage.SetChecked(ref, nil), Equals, core.ErrReferenceHasChanged)
+
+	lock := filepath.Join(s.dir, ".git", "refs", "heads", "new.lock")
+	c.Assert(ioutil.WriteFile(lock, []byte("foo"), 0644), IsNil)
+	current, err := s.storage.Get(ref.Name)
+	c.Assert(err, IsNil)
+	c.Assert(s.storage.SetChecked(ref, current), Equals, filesystem.ErrLocked)
+	c.Assert(s.readFile(c, "refs/heads/new.lock"), Equals, "foo")
+
+	// the lock files are not references
+	c.Assert(s.references(c), DeepEquals, packedRefsFixture)
+	_, err = s.storage.Get("refs/heads/new.lock")
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	err = s.storage.SetChecked(core.NewHashReference("refs/heads/foo.lock", ref.Hash), nil)
+	c.Assert(err, Equals, filesystem.ErrInvalidReferenceName)
+
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	err = storage.ReferenceStorage().(core.CheckedReferenceStorage).SetChecked(ref, current)
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *ReferenceSuite) TestSetCheckedConcurrent(c *C) {
+	old, err := s.storage.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+
+	var wg sync.WaitGroup
+	var updated int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h := core.ComputeHash(core.BlobObject, []byte{byte(i)})
+			err := s.storage.SetChecked(core.NewHashReference(old.Name, h), old)
+			if err == nil {
+				atomic.AddInt32(&updated, 1)
+				return
+			}
+
+			if err != filesystem.ErrLocked && err != core.ErrReferenceHasChanged {
+				c.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	c.Assert(updated, Equals, int32(1))
+}
+
+func (s *ReferenceSuite) TestRemove(c *C) {
+	for _, n := range []core.ReferenceName{
+		"refs/heads/feature", "refs/heads/master", "refs/heads/new", "refs/tags/v1.1",
+	} {
+		c.Assert(s.storage.Remove(n), IsNil, Commentf("name=%s", n))
+
+		_, err := s.storage.Get(n)
+		c.Assert(err, Equals, core.ErrReferenceNotFound, Commentf("name=%s", n))
+	}
+
+	c.Assert(s.readFile(c, "packed-refs"), Equals, ""+
+		"# pack-refs with: peeled fully-peeled sorted \n"+
+		"6a1ba8926d1a2065c9f63231cc2cb052e16eed64 refs/heads/old\n"+
+		"d65924e9181849074e28fd5b5497264d872657eb refs/tags/v1.0\n"+
+		"97ccd2e41cc376a574360cec587c7470df49846f refs/tags/v2.0\n"+
+		"^6a1ba8926d1a2065c9f63231cc2cb052e16eed64\n")
+
+	c.Assert(s.references(c), DeepEquals, []string{
+		"ref: refs/heads/master HEAD",
+		"6a1ba8926d1a2065c9f63231cc2cb052e16eed64 refs/heads/old",
+		"d65924e9181849074e28fd5b5497264d872657eb refs/tags/v1.0",
+		"97ccd2e41cc376a574360cec587c7470df49846f refs/tags/v2.0",
+	})
+
+	_, err := os.Stat(filepath.Join(s.dir, ".git", "packed-refs.lock"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ReferenceSuite) TestRemoveEmptyDirs(c *C) {
+	ref := core.NewHashReference("refs/heads/foo/bar", core.NewHash("d65924e9181849074e28fd5b5497264d872657eb"))
+	c.Assert(s.storage.Set(ref), IsNil)
+	c.Assert(s.storage.Remove(ref.Name), IsNil)
+
+	_, err := os.Stat(filepath.Join(s.dir, ".git", "refs", "heads", "foo"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = os.Stat(filepath.Join(s.dir, ".git", "refs", "heads"))
+	c.Assert(err, IsNil)
+}
+
+func (s *ReferenceSuite) TestRemoveErrors(c *C) {
+	for _, n := range []core.ReferenceName{"refs/heads/foo", "refs/heads", "config"} {
+		err := s.storage.Remove(n)
+		c.Assert(err, Equals, core.ErrReferenceNotFound, Commentf("name=%s", n))
+	}
+
+	lock := filepath.Join(s.dir, ".git", "packed-refs.lock")
+	c.Assert(ioutil.WriteFile(lock, nil, 0644), IsNil)
+	c.Assert(s.storage.Remove("refs/heads/feature"), Equals, filesystem.ErrLocked)
+	c.Assert(s.references(c), DeepEquals, packedRefsFixture)
+
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+	err = storage.ReferenceStorage().Remove("refs/heads/new")
+	c.Assert(err, Equals, filesystem.ErrReadOnly)
+}
+
+func (s *ReferenceSuite) TestPackedRefsMalformed(c *C) {
+	hash := "6a1ba8926d1a2065c9f63231cc2cb052e16eed64"
+	for _, content := range []string{
+		"^" + hash + "\n",
+		hash + " refs/heads/foo\n^" + hash + "\n^" + hash + "\n",
+		hash + " refs/heads/foo\n^foo\n",
+		"foo refs/heads/foo\n",
+		hash + "\n",
+		hash + " refs/heads/foo bar\n",
+	} {
+		path := filepath.Join(s.dir, ".git", "packed-refs")
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+
+		_, err := s.storage.Get("refs/heads/foo")
+		c.Assert(err, Equals, filesystem.ErrPackedRefsBadFormat, Commentf("content=%q", content))
+
+		_, err = s.storage.Iter()
+		c.Assert(err, Equals, filesystem.ErrPackedRefsBadFormat, Commentf("content=%q", content))
+	}
+}
+
+func (s *ReferenceSuite) references(c *C) []string {
+	iter, err := s.storage.Iter()
+	c.Assert(err, IsNil)
+	return iterReferences(c, iter)
+}
+
+func iterReferences(c *C, iter core.ReferenceIter) []string {
+	defer iter.Close()
+
+	var refs []string
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		refs = append(refs, ref.String())
+	}
+
+	return refs
+}
+
+func (s *ReferenceSuite) readFile(c *C, path string) string {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, ".git", path))
+	c.Assert(err, IsNil)
+	return string(content)
+}
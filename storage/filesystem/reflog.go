@@ -0,0 +1,168 @@
+package filesystem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const logsDir = "logs"
+
+// ReflogStorage is an implementation of core.ReflogStorage for the reflogs
+// of a git directory, in logs/ under the name of their reference, like
+// logs/refs/heads/master, with a line per entry, as git writes them:
+//
+//	<old hash> <new hash> <name> <<email>> <timestamp> <timezone>\t<message>
+//
+// New entries are appended to the files, when the fs.FS of the storage is a
+// fs.WriteFS.
+type ReflogStorage struct {
+	fs  fs.FS
+	dir string
+}
+
+// NewReflogStorage returns a new ReflogStorage for the reflogs of the git
+// directory at the given path.
+func NewReflogStorage(fs fs.FS, path string) *ReflogStorage {
+	return &ReflogStorage{fs: fs, dir: path}
+}
+
+// Append appends the entry to the reflog file of the reference, in a single
+// write, creating the file if it does not exist. The message is written in
+// a single line, its runs of white space, new lines included, are replaced
+// by a space, as git does.
+//
+// Only the reflogs of HEAD and the names under refs/ can be written,
+// ErrInvalidReferenceName is returned otherwise. ErrReadOnly is returned if
+// the fs.FS of the storage is not a fs.WriteFS.
+func (s *ReflogStorage) Append(n core.ReferenceName, e *core.ReflogEntry) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	parts, ok := splitReferenceName(n)
+	if !ok {
+		return ErrInvalidReferenceName
+	}
+
+	if err := wfs.MkdirAll(s.path(parts[:len(parts)-1]), 0755); err != nil {
+		return err
+	}
+
+	f, err := wfs.OpenFile(s.path(parts), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	_, err = f.Write(encodeReflogEntry(e))
+	return err
+}
+
+// Entries returns an iterator for the entries of the reflog file of the
+// reference, the oldest first, empty if there is no such file.
+// ErrReflogBadFormat is returned if any line of the file is malformed.
+func (s *ReflogStorage) Entries(n core.ReferenceName) (core.ReflogIter, error) {
+	parts, ok := splitReferenceName(n)
+	if !ok {
+		return nil, ErrInvalidReferenceName
+	}
+
+	f, err := s.fs.Open(s.path(parts))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return core.NewReflogSliceIter(nil), nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := parseReflog(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.NewReflogSliceIter(entries), nil
+}
+
+func (s *ReflogStorage) path(parts []string) string {
+	return s.fs.Join(append([]string{s.dir, logsDir}, parts...)...)
+}
+
+// encodeReflogEntry returns the line of the entry, without the tab if there
+// is no message, as git does.
+func encodeReflogEntry(e *core.ReflogEntry) []byte {
+	line := fmt.Sprintf("%s %s %s", e.Old, e.New, e.Committer.Encode())
+	if msg := strings.Join(strings.Fields(e.Message), " "); msg != "" {
+		line += "\t" + msg
+	}
+
+	return []byte(line + "\n")
+}
+
+// parseReflog parses the lines of a reflog file, see ReflogStorage, the
+// message and the tab before it are optional.
+func parseReflog(r io.Reader) ([]*core.ReflogEntry, error) {
+	var entries []*core.ReflogEntry
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+
+		e, err := parseReflogEntry(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+func parseReflogEntry(line string) (*core.ReflogEntry, error) {
+	// the hashes are of 40 hexadecimal digits, or 64 in the SHA256
+	// repositories
+	size := strings.IndexByte(line, ' ')
+	hashes := 2*size + 2
+	if size <= 0 || len(line) < hashes || line[2*size+1] != ' ' {
+		return nil, ErrReflogBadFormat
+	}
+
+	e := &core.ReflogEntry{}
+	for i, h := range []*core.Hash{&e.Old, &e.New} {
+		ref, err := core.ParseReference("", line[i*(size+1):i*(size+1)+size])
+		if err != nil {
+			return nil, ErrReflogBadFormat
+		}
+
+		*h = ref.Hash
+	}
+
+	sig := line[hashes:]
+	if tab := strings.IndexByte(sig, '\t'); tab != -1 {
+		sig, e.Message = sig[:tab], sig[tab+1:]
+	}
+
+	if !strings.Contains(sig, "<") || !strings.Contains(sig, ">") {
+		return nil, ErrReflogBadFormat
+	}
+
+	e.Committer.Decode([]byte(sig))
+	return e, nil
+}
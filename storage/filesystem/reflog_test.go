@@ -0,0 +1,140 @@
+package filesystem_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReflogSuite struct {
+	dir     string
+	storage core.ReflogStorage
+}
+
+var _ = Suite(&ReflogSuite{})
+
+// written by git commit
+const reflogFixture = "" +
+	"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 John Doe <john@doe.com> 1465833006 +0200\tcommit (initial): first\n" +
+	"ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 6a23eb48373ad6bdd2e0e990a64e821f71938138 John Doe <john@doe.com> 1465833106 +0200\tcommit: next\n"
+
+var reflogFixtureEntries = []*core.ReflogEntry{{
+	Old:       core.ZeroHash,
+	New:       core.NewHash("ae7dd07fa5b2e294f6dc22f36025204f3c7edc53"),
+	Committer: core.Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833006, 0).In(time.FixedZone("", 2*3600))},
+	Message:   "commit (initial): first",
+}, {
+	Old:       core.NewHash("ae7dd07fa5b2e294f6dc22f36025204f3c7edc53"),
+	New:       core.NewHash("6a23eb48373ad6bdd2e0e990a64e821f71938138"),
+	Committer: core.Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833106, 0).In(time.FixedZone("", 2*3600))},
+	Message:   "commit: next",
+}}
+
+func (s *ReflogSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.ReflogStorage()
+}
+
+func (s *ReflogSuite) TestEntries(c *C) {
+	path := filepath.Join(s.dir, "logs", "refs", "heads", "master")
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(reflogFixture), 0644), IsNil)
+
+	assertReflog(c, s.storage, "refs/heads/master", reflogFixtureEntries)
+	assertReflog(c, s.storage, "refs/heads/foo", nil)
+}
+
+func (s *ReflogSuite) TestAppend(c *C) {
+	for _, e := range reflogFixtureEntries {
+		c.Assert(s.storage.Append(core.HEAD, e), IsNil)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "logs", "HEAD"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, reflogFixture)
+	assertReflog(c, s.storage, core.HEAD, reflogFixtureEntries)
+}
+
+func (s *ReflogSuite) TestAppendMessage(c *C) {
+	entries := []*core.ReflogEntry{{
+		New:       core.NewHash("ae7dd07fa5b2e294f6dc22f36025204f3c7edc53"),
+		Committer: reflogFixtureEntries[0].Committer,
+	}, {
+		New:       core.NewHash("ae7dd07fa5b2e294f6dc22f36025204f3c7edc53"),
+		Committer: reflogFixtureEntries[0].Committer,
+		Message:   " commit: first\n\nsecond  line\n",
+	}}
+
+	for _, e := range entries {
+		c.Assert(s.storage.Append("refs/heads/foo/bar", e), IsNil)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "logs", "refs", "heads", "foo", "bar"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, ""+
+		"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 John Doe <john@doe.com> 1465833006 +0200\n"+
+		"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 John Doe <john@doe.com> 1465833006 +0200\tcommit: first second line\n")
+
+	entries[1].Message = "commit: first second line"
+	assertReflog(c, s.storage, "refs/heads/foo/bar", entries)
+}
+
+func (s *ReflogSuite) TestErrors(c *C) {
+	e := reflogFixtureEntries[0]
+	c.Assert(s.storage.Append("config", e), Equals, filesystem.ErrInvalidReferenceName)
+	_, err := s.storage.Entries("refs/../config")
+	c.Assert(err, Equals, filesystem.ErrInvalidReferenceName)
+
+	storage, err := filesystem.New(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(storage.ReflogStorage().Append(core.HEAD, e), Equals, filesystem.ErrReadOnly)
+
+	path := filepath.Join(s.dir, "logs", "HEAD")
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	for _, line := range []string{
+		"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edc53",
+		"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edcz3 John Doe <john@doe.com> 1465833006 +0200",
+		"0000000000000000000000000000000000000000,ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 John Doe <john@doe.com> 1465833006 +0200",
+		"0000000000000000000000000000000000000000 ae7dd07fa5b2e294f6dc22f36025204f3c7edc53 John Doe 1465833006 +0200",
+	} {
+		c.Assert(ioutil.WriteFile(path, []byte(line+"\n"), 0644), IsNil)
+		_, err := s.storage.Entries(core.HEAD)
+		c.Assert(err, Equals, filesystem.ErrReflogBadFormat, Commentf("line=%q", line))
+	}
+}
+
+func assertReflog(c *C, s core.ReflogStorage, n core.ReferenceName, expected []*core.ReflogEntry) {
+	iter, err := s.Entries(n)
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	var i int
+	for ; ; i++ {
+		e, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		c.Assert(i < len(expected), Equals, true)
+		c.Assert(e.Old, Equals, expected[i].Old)
+		c.Assert(e.New, Equals, expected[i].New)
+		c.Assert(e.Committer.Name, Equals, expected[i].Committer.Name)
+		c.Assert(e.Committer.Email, Equals, expected[i].Committer.Email)
+		c.Assert(e.Committer.When.Equal(expected[i].Committer.When), Equals, true)
+		c.Assert(e.Message, Equals, expected[i].Message)
+	}
+
+	c.Assert(i, Equals, len(expected))
+}
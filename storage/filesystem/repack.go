@@ -0,0 +1,162 @@
+package filesystem
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+// RepackStats are the statistics of a repack.
+type RepackStats struct {
+	// Objects is the number of objects of the new packfile.
+	Objects int
+	// SizeBefore and SizeAfter are the sizes in bytes of the loose objects,
+	// the packfiles and their idx files before and after the repack.
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Repack writes a packfile with the objects with the given hashes, see
+// WritePack, and then removes the loose objects it has and the packfiles
+// all whose objects it has, as git repack -a -d does. Nothing is removed
+// until the new packfile and its idx file are complete, and the idx files
+// are removed before their packfiles, so the storage can be read at any
+// point of an interrupted repack, at worst with some objects in several
+// places.
+//
+// ErrReadOnly is returned if the fs.FS of the storage is not a fs.WriteFS.
+func (s *ObjectStorage) Repack(hashes []core.Hash, opts packfile.EncoderOptions) (*RepackStats, error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return nil, ErrReadOnly
+	}
+
+	stats := &RepackStats{Objects: len(hashes)}
+	var err error
+	if stats.SizeBefore, err = s.size(); err != nil {
+		return nil, err
+	}
+
+	if len(hashes) != 0 {
+		if err := s.repack(wfs, hashes, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if stats.SizeAfter, err = s.size(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (s *ObjectStorage) repack(wfs fs.WriteFS, hashes []core.Hash, opts packfile.EncoderOptions) error {
+	checksum, err := s.WritePack(hashes, opts)
+	if err != nil {
+		return err
+	}
+
+	packed := make(map[core.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		packed[h] = true
+	}
+
+	loose, err := s.hashes()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range loose {
+		if !packed[h] {
+			continue
+		}
+
+		if err := wfs.Remove(s.objectPath(h)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	path := s.fs.Join(s.dir, "pack", "pack-"+checksum.String()+".pack")
+	for _, p := range s.packList() {
+		if p.path == path || !p.containedIn(packed) {
+			continue
+		}
+
+		if err := s.removePack(wfs, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// containedIn reports whether all the objects of the packfile are in the
+// given set.
+func (p *pack) containedIn(hashes map[core.Hash]bool) bool {
+	for _, h := range p.hashes {
+		if !hashes[h] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removePack removes the given packfile from the storage and deletes it,
+// its idx file first, so it is not read anymore if it is not deleted.
+func (s *ObjectStorage) removePack(wfs fs.WriteFS, p *pack) error {
+	s.m.Lock()
+	packs := make([]*pack, 0, len(s.packs))
+	for _, old := range s.packs {
+		if old != p {
+			packs = append(packs, old)
+		}
+	}
+
+	s.packs = packs
+	s.m.Unlock()
+
+	idx := strings.TrimSuffix(p.path, ".pack") + ".idx"
+	for _, path := range []string{idx, p.path} {
+		if err := wfs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// size returns the size in bytes of the loose objects, and of the packfiles
+// and idx files of the pack directory.
+func (s *ObjectStorage) size() (int64, error) {
+	loose, err := s.hashes()
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, h := range loose {
+		fi, err := s.fs.Stat(s.objectPath(h))
+		if err != nil {
+			return 0, err
+		}
+
+		size += fi.Size()
+	}
+
+	files, err := s.fs.ReadDir(s.fs.Join(s.dir, "pack"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && (strings.HasSuffix(f.Name(), ".pack") || strings.HasSuffix(f.Name(), ".idx")) {
+			size += f.Size()
+		}
+	}
+
+	return size, nil
+}
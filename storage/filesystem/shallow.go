@@ -0,0 +1,127 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const shallowPath = "shallow"
+
+// ShallowStorage is an implementation of core.ShallowStorage for the shallow
+// commits of a git directory, in its shallow file, with the hash of a commit
+// per line, as git writes it. There is no such file if the history is
+// complete.
+//
+// The file is rewritten when the fs.FS of the storage is a fs.WriteFS.
+type ShallowStorage struct {
+	fs  fs.FS
+	dir string
+}
+
+// NewShallowStorage returns a new ShallowStorage for the shallow commits of
+// the git directory at the given path.
+func NewShallowStorage(fs fs.FS, path string) *ShallowStorage {
+	return &ShallowStorage{fs: fs, dir: path}
+}
+
+// Shallow returns the hashes of the commits in the shallow file, sorted,
+// none if there is no such file. ErrShallowBadFormat is returned if any of
+// its lines is not a hash.
+func (s *ShallowStorage) Shallow() ([]core.Hash, error) {
+	f, err := s.fs.Open(s.fs.Join(s.dir, shallowPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var hashes []core.Hash
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		if !core.IsHashHex(line) {
+			return nil, ErrShallowBadFormat
+		}
+
+		hashes = append(hashes, core.NewHash(line))
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	core.SortHashes(hashes)
+	return hashes, nil
+}
+
+// SetShallow rewrites the shallow file with the given hashes, sorted, or
+// removes it if there are none, as git does.
+//
+// The file is written to its lock file, shallow.lock, renamed when
+// complete, so ErrLocked is returned if the file is locked by another
+// writer. ErrReadOnly is returned if the fs.FS of the storage is not a
+// fs.WriteFS.
+func (s *ShallowStorage) SetShallow(hashes []core.Hash) (err error) {
+	wfs, ok := s.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnly
+	}
+
+	path := s.fs.Join(s.dir, shallowPath)
+	lock, err := lockFile(wfs, path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		errClose := lock.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err == nil && len(hashes) != 0 {
+			err = wfs.Rename(lock.Name(), path)
+		}
+
+		if err != nil || len(hashes) == 0 {
+			wfs.Remove(lock.Name())
+		}
+	}()
+
+	if len(hashes) == 0 {
+		if err := wfs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	sorted := make([]core.Hash, len(hashes))
+	copy(sorted, hashes)
+	core.SortHashes(sorted)
+
+	buf := new(bytes.Buffer)
+	for i, h := range sorted {
+		if i == 0 || h != sorted[i-1] {
+			buf.WriteString(h.String() + "\n")
+		}
+	}
+
+	if _, err := lock.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	return lock.Sync()
+}
@@ -0,0 +1,92 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type ShallowSuite struct {
+	dir     string
+	storage core.ShallowStorage
+}
+
+var _ = Suite(&ShallowSuite{})
+
+// written by git clone --depth 5
+const shallowFixture = "" +
+	"0ac063db656012ad3b4617e13f6e5d3849b41426\n" +
+	"65348e200a5e368f71c8973e0e5359c275be42c5\n" +
+	"4b8bf322541f1422d5fa3d89627ad4ea13c163a4\n"
+
+var shallowFixtureHashes = []core.Hash{
+	core.NewHash("0ac063db656012ad3b4617e13f6e5d3849b41426"),
+	core.NewHash("4b8bf322541f1422d5fa3d89627ad4ea13c163a4"),
+	core.NewHash("65348e200a5e368f71c8973e0e5359c275be42c5"),
+}
+
+func (s *ShallowSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+
+	storage, err := filesystem.New(fs.NewOS(), s.dir)
+	c.Assert(err, IsNil)
+	s.storage = storage.ShallowStorage()
+}
+
+func (s *ShallowSuite) TestShallow(c *C) {
+	hashes, err := s.storage.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+
+	path := filepath.Join(s.dir, "shallow")
+	c.Assert(ioutil.WriteFile(path, []byte(shallowFixture), 0644), IsNil)
+
+	hashes, err = s.storage.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, shallowFixtureHashes)
+}
+
+func (s *ShallowSuite) TestShallowBadFormat(c *C) {
+	path := filepath.Join(s.dir, "shallow")
+	c.Assert(ioutil.WriteFile(path, []byte(shallowFixture+"foo\n"), 0644), IsNil)
+
+	_, err := s.storage.Shallow()
+	c.Assert(err, Equals, filesystem.ErrShallowBadFormat)
+}
+
+func (s *ShallowSuite) TestSetShallow(c *C) {
+	c.Assert(s.storage.SetShallow(shallowFixtureHashes[1:]), IsNil)
+	c.Assert(s.storage.SetShallow(shallowFixtureHashes), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, "shallow"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, ""+
+		"0ac063db656012ad3b4617e13f6e5d3849b41426\n"+
+		"4b8bf322541f1422d5fa3d89627ad4ea13c163a4\n"+
+		"65348e200a5e368f71c8973e0e5359c275be42c5\n")
+
+	hashes, err := s.storage.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, shallowFixtureHashes)
+
+	c.Assert(s.storage.SetShallow(nil), IsNil)
+	_, err = os.Stat(filepath.Join(s.dir, "shallow"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(filepath.Join(s.dir, "shallow.lock"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	c.Assert(s.storage.SetShallow(nil), IsNil)
+}
+
+func (s *ShallowSuite) TestSetShallowLocked(c *C) {
+	lock := filepath.Join(s.dir, "shallow.lock")
+	c.Assert(ioutil.WriteFile(lock, nil, 0644), IsNil)
+
+	c.Assert(s.storage.SetShallow(shallowFixtureHashes), Equals, filesystem.ErrLocked)
+}
@@ -0,0 +1,157 @@
+// Package filesystem implements a core.Storage reading the objects, loose
+// and packed, the references and their reflogs, the config and the index of
+// a git directory, as written by git.
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+var (
+	// ErrNotFound is returned by New when the git directory is not found.
+	ErrNotFound = errors.New("git directory not found")
+	// ErrNotImplemented is returned by the write operations not supported
+	// yet.
+	ErrNotImplemented = errors.New("not implemented yet")
+	// ErrReadOnly is returned by the write operations when the fs.FS of the
+	// storage is not a fs.WriteFS.
+	ErrReadOnly = errors.New("read only filesystem")
+	// ErrInvalidReferenceName is returned by ReferenceStorage.Set when the
+	// name of the reference is not HEAD or a name under refs/.
+	ErrInvalidReferenceName = errors.New("invalid reference name")
+	// ErrPackedRefsBadFormat is returned when the packed-refs file is
+	// corrupted.
+	ErrPackedRefsBadFormat = errors.New("malformed packed-refs file")
+	// ErrLocked is returned when a file to be rewritten is locked, this is,
+	// its lock file exists, as another writer is rewriting it.
+	ErrLocked = errors.New("file locked by another writer")
+	// ErrReflogBadFormat is returned when a reflog file is corrupted.
+	ErrReflogBadFormat = errors.New("malformed reflog file")
+	// ErrHashMismatch is returned by ObjectStorage.Set when the hash of the
+	// written content is not the hash of the object.
+	ErrHashMismatch = errors.New("object hash does not match its content")
+	// ErrShallowBadFormat is returned when the shallow file is corrupted.
+	ErrShallowBadFormat = errors.New("malformed shallow file")
+	// ErrIncludeDepth is returned by ConfigStorage.Config when the config
+	// files include each other too deep, usually in a cycle.
+	ErrIncludeDepth = errors.New("exceeded maximum config include depth")
+)
+
+// Storage is an implementation of core.Storage for a git directory (this
+// is, the .git directory of a repository).
+//
+// Zero values of this type are not safe to use, see the New function below.
+type Storage struct {
+	o *ObjectStorage
+	r *ReferenceStorage
+	l *ReflogStorage
+	s *ShallowStorage
+	c *ConfigStorage
+	i *IndexStorage
+}
+
+// New returns a new Storage for the git directory at the given path, the idx
+// files of its packfiles are read. The format of its objects is the one of
+// the extensions.objectformat option of its config file, core.SHA1 if it has
+// none, and core.ErrUnsupportedObjectFormat is returned if the format is
+// not supported.
+func New(fs fs.FS, path string) (*Storage, error) {
+	if _, err := fs.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	c := NewConfigStorage(fs, path)
+	format, err := readObjectFormat(c)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := newObjectStorage(fs, fs.Join(path, "objects"), format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		o: o,
+		r: NewReferenceStorage(fs, path),
+		l: NewReflogStorage(fs, path),
+		s: NewShallowStorage(fs, path),
+		c: c,
+		i: NewIndexStorage(fs, path),
+	}, nil
+}
+
+// ObjectStorage returns the storage of the objects of the git directory.
+func (s *Storage) ObjectStorage() core.ObjectStorage {
+	return s.o
+}
+
+// ReferenceStorage returns the storage of the references of the git
+// directory.
+func (s *Storage) ReferenceStorage() core.ReferenceStorage {
+	return s.r
+}
+
+// ReflogStorage returns the storage of the reflogs of the references of the
+// git directory.
+func (s *Storage) ReflogStorage() core.ReflogStorage {
+	return s.l
+}
+
+// ShallowStorage returns the storage of the shallow commits of the git
+// directory.
+func (s *Storage) ShallowStorage() core.ShallowStorage {
+	return s.s
+}
+
+// ConfigStorage returns the storage of the config of the git directory.
+func (s *Storage) ConfigStorage() core.ConfigStorage {
+	return s.c
+}
+
+// IndexStorage returns the storage of the index of the git directory.
+func (s *Storage) IndexStorage() *IndexStorage {
+	return s.i
+}
+
+// writeTempFile creates a temporary file in dir, writes it with the given
+// function, syncs it, sets its mode and closes it, returning its path, so it
+// can be renamed once complete. The file is removed on errors.
+func writeTempFile(wfs fs.WriteFS, dir, prefix string, perm os.FileMode,
+	write func(io.Writer) error) (path string, err error) {
+
+	f, err := wfs.TempFile(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+
+		if err != nil {
+			wfs.Remove(f.Name())
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return "", err
+	}
+
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+
+	return f.Name(), f.Chmod(perm)
+}
@@ -0,0 +1,212 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/objfile"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	"github.com/alcortesm/tgz"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type StorageSuite struct {
+	dir     string
+	storage *filesystem.Storage
+}
+
+var _ = Suite(&StorageSuite{})
+
+// the objects of the fixture, obtained with git cat-file
+var looseObjects = map[string]struct {
+	typ  core.ObjectType
+	size int64
+}{
+	"752a9dcf76b0b41f32979e935aa776b6b473ce23": {core.TreeObject, 64},
+	"7ba7b9ea717bab814da474fd9df96a0539d82ebc": {core.TreeObject, 64},
+	"7b402581d3351f582ed2a6af487b7af822051837": {core.CommitObject, 167},
+	"d2d3f7b8b4114a321a197a38e41aa9d33f6a24c8": {core.CommitObject, 216},
+	"ce013625030ba8dba906f756967f9e9ca394464a": {core.BlobObject, 6},
+	"94954abda49de8615a048f8d2e64b5de848e27a1": {core.BlobObject, 12},
+	"3d9aac16b9afb8ad2e008f0da890b7971a9e0cda": {core.CommitObject, 210},
+	"e2da357db129886a2164cba071c48b1ed416a893": {core.TreeObject, 64},
+	"1dab560eef66ede5c726d0428bcac53e348b1000": {core.TagObject, 134},
+	"fc8d475c854cee182b3f6acaad44205060584332": {core.TreeObject, 68},
+	"b9270df7070cc6a5e7dbdec610a7ce4f54c47b20": {core.TreeObject, 35},
+	"06ab7d0f9a35a7d1070711496d6ca1cb892a258f": {core.BlobObject, 13},
+	"587be6b4c3f93f93c489c0111bba5596147a26cb": {core.BlobObject, 2},
+}
+
+func (s *StorageSuite) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract("fixtures/loose-objects.tgz")
+	c.Assert(err, IsNil)
+
+	fs := fs.NewOS()
+	s.storage, err = filesystem.New(fs, fs.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *StorageSuite) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *StorageSuite) TestNewErrorNotFound(c *C) {
+	_, err := filesystem.New(fs.NewOS(), "not_found/.git")
+	c.Assert(err, Equals, filesystem.ErrNotFound)
+}
+
+func (s *StorageSuite) TestGet(c *C) {
+	os := s.storage.ObjectStorage()
+	for hash, expected := range looseObjects {
+		com := Commentf("hash=%s", hash)
+		h := core.NewHash(hash)
+
+		obj, err := os.Get(h)
+		c.Assert(err, IsNil, com)
+		c.Assert(obj.Hash(), Equals, h, com)
+		c.Assert(obj.Type(), Equals, expected.typ, com)
+		c.Assert(obj.Size(), Equals, expected.size, com)
+
+		content := obj.Content()
+		c.Assert(content, HasLen, int(expected.size), com)
+		c.Assert(core.ComputeHash(obj.Type(), content), Equals, h, com)
+
+		r, err := obj.Reader()
+		c.Assert(err, IsNil, com)
+		read, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil, com)
+		c.Assert(r.Close(), IsNil, com)
+		c.Assert(read, DeepEquals, content, com)
+	}
+
+	blob, err := os.Get(core.NewHash("ce013625030ba8dba906f756967f9e9ca394464a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(blob.Content()), Equals, "hello\n")
+
+	_, err = os.Get(core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *StorageSuite) TestHas(c *C) {
+	os := s.storage.ObjectStorage()
+	for hash := range looseObjects {
+		ok, err := core.HasObject(os, core.NewHash(hash))
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, true)
+	}
+
+	ok, err := core.HasObject(os, core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *StorageSuite) TestIter(c *C) {
+	for _, t := range []core.ObjectType{
+		core.CommitObject,
+		core.TreeObject,
+		core.BlobObject,
+		core.TagObject,
+	} {
+		iter, err := s.storage.ObjectStorage().Iter(t)
+		c.Assert(err, IsNil)
+
+		obtained := make(map[string]bool, 0)
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+			c.Assert(obj.Type(), Equals, t)
+			obtained[obj.Hash().String()] = true
+		}
+
+		expected := make(map[string]bool, 0)
+		for hash, obj := range looseObjects {
+			if obj.typ == t {
+				expected[hash] = true
+			}
+		}
+
+		c.Assert(obtained, DeepEquals, expected, Commentf("type=%s", t))
+	}
+}
+
+func (s *StorageSuite) TestReferenceGet(c *C) {
+	rs := s.storage.ReferenceStorage()
+
+	ref, err := rs.Get(core.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, core.NewSymbolicReference(core.HEAD, "refs/heads/master"))
+
+	ref, err = rs.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, core.NewHashReference("refs/heads/master",
+		core.NewHash("d2d3f7b8b4114a321a197a38e41aa9d33f6a24c8")))
+
+	for _, n := range []core.ReferenceName{
+		"refs/heads/foo", "refs/heads", "refs/../HEAD", "config", "refs//heads/master",
+	} {
+		_, err = rs.Get(n)
+		c.Assert(err, Equals, core.ErrReferenceNotFound, Commentf("name=%s", n))
+	}
+}
+
+func (s *StorageSuite) TestReferenceIter(c *C) {
+	iter, err := s.storage.ReferenceStorage().Iter()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	var refs []string
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		refs = append(refs, ref.String())
+	}
+
+	c.Assert(refs, DeepEquals, []string{
+		"ref: refs/heads/master HEAD",
+		"3d9aac16b9afb8ad2e008f0da890b7971a9e0cda refs/heads/feature",
+		"d2d3f7b8b4114a321a197a38e41aa9d33f6a24c8 refs/heads/master",
+		"1dab560eef66ede5c726d0428bcac53e348b1000 refs/tags/v1.0",
+	})
+}
+
+func (s *StorageSuite) TestGetMalformed(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dir, "objects", "ff"), 0755), IsNil)
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, err := w.Write([]byte("blob x\x00foo"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	for content, expected := range map[string]error{
+		"not zlib":   objfile.ErrZLib,
+		buf.String(): objfile.ErrHeader,
+	} {
+		path := filepath.Join(dir, "objects", "ff", "ffffffffffffffffffffffffffffffffffffff")
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+
+		storage, err := filesystem.New(fs.NewOS(), dir)
+		c.Assert(err, IsNil)
+		_, err = storage.ObjectStorage().Get(core.NewHash("ffffffffffffffffffffffffffffffffffffffff"))
+		c.Assert(err, Equals, expected)
+	}
+}
@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/formats/config"
+)
+
+// ConfigStorage is the implementation of core.ConfigStorage for memory. It
+// is safe to use from several goroutines at once.
+type ConfigStorage struct {
+	c *config.Config
+	m sync.Mutex
+}
+
+// NewConfigStorage returns a new ConfigStorage with an empty config
+func NewConfigStorage() *ConfigStorage {
+	return &ConfigStorage{c: config.New()}
+}
+
+// Config returns the config, the one stored, not a copy
+func (s *ConfigStorage) Config() (*config.Config, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.c, nil
+}
+
+// SetConfig replaces the config with the given one
+func (s *ConfigStorage) SetConfig(c *config.Config) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.c = c
+	return nil
+}
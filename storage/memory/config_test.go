@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"gopkg.in/src-d/go-git.v3/formats/config"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigStorageSuite struct{}
+
+var _ = Suite(&ConfigStorageSuite{})
+
+func (s *ConfigStorageSuite) TestSetConfig(c *C) {
+	cs := NewStorage().ConfigStorage()
+	cfg, err := cs.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Sections, HasLen, 0)
+
+	cfg = config.New()
+	cfg.Set("core", "", "bare", "true")
+	c.Assert(cs.SetConfig(cfg), IsNil)
+
+	cfg, err = cs.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.String("core", "", "bare"), Equals, "true")
+}
@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+)
+
+// IndexStorage is the storage of the index of a repository in memory. It is
+// safe to use from several goroutines at once.
+type IndexStorage struct {
+	idx *index.Index
+	m   sync.Mutex
+}
+
+// NewIndexStorage returns a new IndexStorage with an empty index
+func NewIndexStorage() *IndexStorage {
+	return &IndexStorage{idx: index.New(core.SHA1)}
+}
+
+// Index returns the index, the one stored, not a copy
+func (s *IndexStorage) Index() (*index.Index, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.idx, nil
+}
+
+// SetIndex replaces the index with the given one
+func (s *IndexStorage) SetIndex(idx *index.Index) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.idx = idx
+	return nil
+}
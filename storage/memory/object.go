@@ -10,6 +10,7 @@ import (
 // Object on memory core.Object implementation
 type Object struct {
 	t    core.ObjectType
+	f    core.ObjectFormat
 	h    core.Hash
 	cont []byte
 	sz   int64
@@ -17,9 +18,16 @@ type Object struct {
 
 // NewObject creates a new object with the given type and content
 func NewObject(typ core.ObjectType, size int64, cont []byte) *Object {
+	return NewObjectWithFormat(core.SHA1, typ, size, cont)
+}
+
+// NewObjectWithFormat creates a new object with the given type and content,
+// whose hash is computed in the given format.
+func NewObjectWithFormat(f core.ObjectFormat, typ core.ObjectType, size int64, cont []byte) *Object {
 	return &Object{
 		t:    typ,
-		h:    core.ComputeHash(typ, cont),
+		f:    f,
+		h:    f.ComputeHash(typ, cont),
 		cont: cont,
 		sz:   int64(len(cont)),
 	}
@@ -28,15 +36,23 @@ func NewObject(typ core.ObjectType, size int64, cont []byte) *Object {
 // Hash return the object Hash, the hash is calculated on-the-fly the first
 // time is called, the subsequent calls the same Hash is returned even if the
 // type or the content has changed. The Hash is only generated if the size of
-// the content is exactly the Object.Size
+// the content is exactly the Object.Size. The hash is computed in the
+// format of the object, SHA1 unless set otherwise, see SetFormat.
 func (o *Object) Hash() core.Hash {
 	if o.h == core.ZeroHash && int64(len(o.cont)) == o.sz {
-		o.h = core.ComputeHash(o.t, o.cont)
+		o.h = o.f.ComputeHash(o.t, o.cont)
 	}
 
 	return o.h
 }
 
+// Format returns the core.ObjectFormat the hash of the object is computed in.
+func (o *Object) Format() core.ObjectFormat { return o.f }
+
+// SetFormat sets the core.ObjectFormat the hash of the object is computed
+// in, it should be set before the hash is computed.
+func (o *Object) SetFormat(f core.ObjectFormat) { o.f = f }
+
 // Type return the core.ObjectType
 func (o *Object) Type() core.ObjectType { return o.t }
 
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ReferenceStorage is the implementation of core.ReferenceStorage for
+// memory, the references are stored by name. It is safe to use from several
+// goroutines at once.
+type ReferenceStorage struct {
+	References map[core.ReferenceName]*core.Reference
+	m          sync.Mutex
+}
+
+// NewReferenceStorage returns a new empty ReferenceStorage
+func NewReferenceStorage() *ReferenceStorage {
+	return &ReferenceStorage{
+		References: make(map[core.ReferenceName]*core.Reference, 0),
+	}
+}
+
+// Set stores a reference, replacing the one with the same name if any
+func (r *ReferenceStorage) Set(ref *core.Reference) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.References[ref.Name] = ref
+	return nil
+}
+
+// SetChecked stores a reference only if the stored one with the same name is
+// old, or there is none if old is nil, see core.SetReferenceChecked
+func (r *ReferenceStorage) SetChecked(new, old *core.Reference) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if err := core.CheckReferenceUnchanged(r.References[new.Name], old); err != nil {
+		return err
+	}
+
+	r.References[new.Name] = new
+	return nil
+}
+
+// Get returns the reference with the given name
+func (r *ReferenceStorage) Get(n core.ReferenceName) (*core.Reference, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	ref, ok := r.References[n]
+	if !ok {
+		return nil, core.ErrReferenceNotFound
+	}
+
+	return ref, nil
+}
+
+// Remove deletes the reference with the given name
+func (r *ReferenceStorage) Remove(n core.ReferenceName) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.References[n]; !ok {
+		return core.ErrReferenceNotFound
+	}
+
+	delete(r.References, n)
+	return nil
+}
+
+// Iter returns a core.ReferenceIter for all the references, sorted by name
+func (r *ReferenceStorage) Iter() (core.ReferenceIter, error) {
+	return r.IterPrefix("")
+}
+
+// IterPrefix returns a core.ReferenceIter for the references whose name
+// starts with the given prefix, sorted by name
+func (r *ReferenceStorage) IterPrefix(prefix string) (core.ReferenceIter, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	refs := make([]*core.Reference, 0, len(r.References))
+	for _, ref := range r.References {
+		if strings.HasPrefix(ref.Name.String(), prefix) {
+			refs = append(refs, ref)
+		}
+	}
+
+	sort.Sort(referencesByName(refs))
+	return core.NewReferenceSliceIter(refs), nil
+}
+
+type referencesByName []*core.Reference
+
+func (s referencesByName) Len() int           { return len(s) }
+func (s referencesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s referencesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
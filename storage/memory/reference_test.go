@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReferenceStorageSuite struct{}
+
+var _ = Suite(&ReferenceStorageSuite{})
+
+func (s *ReferenceStorageSuite) TestSetAndGet(c *C) {
+	rs := NewStorage().ReferenceStorage()
+
+	_, err := rs.Get(core.HEAD)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	master := core.NewHashReference("refs/heads/master", core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(rs.Set(master), IsNil)
+	c.Assert(rs.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+
+	ref, err := rs.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, master)
+
+	ref, err = rs.Get(core.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Type, Equals, core.SymbolicReference)
+	c.Assert(ref.Target, Equals, core.ReferenceName("refs/heads/master"))
+}
+
+func (s *ReferenceStorageSuite) TestIter(c *C) {
+	rs := NewReferenceStorage()
+	for _, n := range []core.ReferenceName{"refs/tags/v1", core.HEAD, "refs/heads/master"} {
+		c.Assert(rs.Set(core.NewSymbolicReference(n, "refs/heads/master")), IsNil)
+	}
+
+	iter, err := rs.Iter()
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	var names []core.ReferenceName
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		names = append(names, ref.Name)
+	}
+
+	c.Assert(names, DeepEquals, []core.ReferenceName{core.HEAD, "refs/heads/master", "refs/tags/v1"})
+}
+
+func (s *ReferenceStorageSuite) TestRemove(c *C) {
+	rs := NewReferenceStorage()
+	c.Assert(rs.Set(core.NewSymbolicReference(core.HEAD, "refs/heads/master")), IsNil)
+
+	c.Assert(rs.Remove(core.HEAD), IsNil)
+	_, err := rs.Get(core.HEAD)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+
+	c.Assert(rs.Remove(core.HEAD), Equals, core.ErrReferenceNotFound)
+}
+
+func (s *ReferenceStorageSuite) TestSetChecked(c *C) {
+	rs := NewReferenceStorage()
+	a := core.NewHashReference("refs/heads/master", core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	b := core.NewHashReference("refs/heads/master", core.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+
+	c.Assert(rs.SetChecked(a, b), Equals, core.ErrReferenceHasChanged)
+	c.Assert(rs.SetChecked(a, nil), IsNil)
+	c.Assert(rs.SetChecked(b, nil), Equals, core.ErrReferenceHasChanged)
+	c.Assert(rs.SetChecked(b, b), Equals, core.ErrReferenceHasChanged)
+	c.Assert(rs.SetChecked(b, a), IsNil)
+
+	ref, err := rs.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, b)
+}
+
+func (s *ReferenceStorageSuite) TestSetCheckedConcurrent(c *C) {
+	rs := NewReferenceStorage()
+	a := core.NewHashReference("refs/heads/master", core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(rs.Set(a), IsNil)
+
+	var wg sync.WaitGroup
+	var updated int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h := core.ComputeHash(core.BlobObject, []byte{byte(i)})
+			if rs.SetChecked(core.NewHashReference(a.Name, h), a) == nil {
+				atomic.AddInt32(&updated, 1)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	c.Assert(updated, Equals, int32(1))
+}
+
+func (s *ReferenceStorageSuite) TestIterPrefix(c *C) {
+	rs := NewReferenceStorage()
+	for _, n := range []core.ReferenceName{"refs/tags/v1", core.HEAD, "refs/heads/master", "refs/heads/foo"} {
+		c.Assert(rs.Set(core.NewSymbolicReference(n, "refs/heads/master")), IsNil)
+	}
+
+	iter, err := rs.IterPrefix("refs/heads/")
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	var names []core.ReferenceName
+	for {
+		ref, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		names = append(names, ref.Name)
+	}
+
+	c.Assert(names, DeepEquals, []core.ReferenceName{"refs/heads/foo", "refs/heads/master"})
+}
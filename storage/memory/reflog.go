@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ReflogStorage is the implementation of core.ReflogStorage for memory, the
+// entries of every reference are kept in a slice. It is safe to use from
+// several goroutines at once.
+type ReflogStorage struct {
+	Reflogs map[core.ReferenceName][]*core.ReflogEntry
+	m       sync.Mutex
+}
+
+// NewReflogStorage returns a new empty ReflogStorage
+func NewReflogStorage() *ReflogStorage {
+	return &ReflogStorage{
+		Reflogs: make(map[core.ReferenceName][]*core.ReflogEntry, 0),
+	}
+}
+
+// Append adds an entry at the end of the reflog of a reference
+func (r *ReflogStorage) Append(n core.ReferenceName, e *core.ReflogEntry) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.Reflogs[n] = append(r.Reflogs[n], e)
+	return nil
+}
+
+// Entries returns a core.ReflogIter for the entries of the reflog of a
+// reference, the oldest first
+func (r *ReflogStorage) Entries(n core.ReferenceName) (core.ReflogIter, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	entries := make([]*core.ReflogEntry, len(r.Reflogs[n]))
+	copy(entries, r.Reflogs[n])
+	return core.NewReflogSliceIter(entries), nil
+}
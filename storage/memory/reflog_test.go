@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"io"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReflogStorageSuite struct{}
+
+var _ = Suite(&ReflogStorageSuite{})
+
+func (s *ReflogStorageSuite) TestAppendAndEntries(c *C) {
+	rs := NewStorage().ReflogStorage()
+	entries := []*core.ReflogEntry{
+		{New: core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Message: "first"},
+		{Old: core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Message: "second"},
+	}
+
+	for _, e := range entries {
+		c.Assert(rs.Append("refs/heads/master", e), IsNil)
+	}
+
+	iter, err := rs.Entries("refs/heads/master")
+	c.Assert(err, IsNil)
+
+	// the entries appended later are not iterated
+	c.Assert(rs.Append("refs/heads/master", &core.ReflogEntry{}), IsNil)
+
+	for _, expected := range entries {
+		e, err := iter.Next()
+		c.Assert(err, IsNil)
+		c.Assert(e, Equals, expected)
+	}
+
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+
+	iter, err = rs.Entries(core.HEAD)
+	c.Assert(err, IsNil)
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
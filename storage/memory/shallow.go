@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ShallowStorage is the implementation of core.ShallowStorage for memory. It
+// is safe to use from several goroutines at once.
+type ShallowStorage struct {
+	Shallows map[core.Hash]bool
+	m        sync.Mutex
+}
+
+// NewShallowStorage returns a new ShallowStorage without shallow commits
+func NewShallowStorage() *ShallowStorage {
+	return &ShallowStorage{Shallows: make(map[core.Hash]bool, 0)}
+}
+
+// Shallow returns the hashes of the shallow commits, sorted, nil if there
+// are none
+func (s *ShallowStorage) Shallow() ([]core.Hash, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if len(s.Shallows) == 0 {
+		return nil, nil
+	}
+
+	hashes := make([]core.Hash, 0, len(s.Shallows))
+	for h := range s.Shallows {
+		hashes = append(hashes, h)
+	}
+
+	core.SortHashes(hashes)
+	return hashes, nil
+}
+
+// SetShallow replaces the shallow commits with the given ones
+func (s *ShallowStorage) SetShallow(hashes []core.Hash) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.Shallows = make(map[core.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		s.Shallows[h] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type ShallowStorageSuite struct{}
+
+var _ = Suite(&ShallowStorageSuite{})
+
+func (s *ShallowStorageSuite) TestSetShallow(c *C) {
+	ss := NewStorage().ShallowStorage()
+	hashes, err := ss.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+
+	c.Assert(ss.SetShallow([]core.Hash{
+		core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		core.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"),
+		core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}), IsNil)
+
+	hashes, err = ss.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []core.Hash{
+		core.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"),
+		core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	c.Assert(ss.SetShallow(nil), IsNil)
+	hashes, err = ss.Shallow()
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 0)
+}
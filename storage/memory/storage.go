@@ -2,12 +2,67 @@ package memory
 
 import (
 	"fmt"
+	"time"
 
 	"gopkg.in/src-d/go-git.v3/core"
 )
 
 var ErrUnsupportedObjectType = fmt.Errorf("unsupported object type")
 
+// Storage is the implementation of core.Storage keeping the objects, the
+// references, their reflogs, the shallow commits, the config and the index
+// in memory
+type Storage struct {
+	o *ObjectStorage
+	r *ReferenceStorage
+	l *ReflogStorage
+	s *ShallowStorage
+	c *ConfigStorage
+	i *IndexStorage
+}
+
+// NewStorage returns a new empty Storage
+func NewStorage() *Storage {
+	return &Storage{
+		o: NewObjectStorage(),
+		r: NewReferenceStorage(),
+		l: NewReflogStorage(),
+		s: NewShallowStorage(),
+		c: NewConfigStorage(),
+		i: NewIndexStorage(),
+	}
+}
+
+// ObjectStorage returns the storage of the objects
+func (s *Storage) ObjectStorage() core.ObjectStorage {
+	return s.o
+}
+
+// ReferenceStorage returns the storage of the references
+func (s *Storage) ReferenceStorage() core.ReferenceStorage {
+	return s.r
+}
+
+// ReflogStorage returns the storage of the reflogs of the references
+func (s *Storage) ReflogStorage() core.ReflogStorage {
+	return s.l
+}
+
+// ShallowStorage returns the storage of the shallow commits
+func (s *Storage) ShallowStorage() core.ShallowStorage {
+	return s.s
+}
+
+// ConfigStorage returns the storage of the config
+func (s *Storage) ConfigStorage() core.ConfigStorage {
+	return s.c
+}
+
+// IndexStorage returns the storage of the index
+func (s *Storage) IndexStorage() *IndexStorage {
+	return s.i
+}
+
 // ObjectStorage is the implementation of core.ObjectStorage for memory.Object
 type ObjectStorage struct {
 	Objects map[core.Hash]core.Object
@@ -15,23 +70,52 @@ type ObjectStorage struct {
 	Trees   map[core.Hash]core.Object
 	Blobs   map[core.Hash]core.Object
 	Tags    map[core.Hash]core.Object
+	// ModTimes are the last times the objects were set.
+	ModTimes map[core.Hash]time.Time
+
+	format core.ObjectFormat
 }
 
 // NewObjectStorage returns a new empty ObjectStorage
 func NewObjectStorage() *ObjectStorage {
+	return NewObjectStorageWithFormat(core.SHA1)
+}
+
+// NewObjectStorageWithFormat returns a new empty ObjectStorage of objects
+// whose hashes are in the given format.
+func NewObjectStorageWithFormat(f core.ObjectFormat) *ObjectStorage {
 	return &ObjectStorage{
 		Objects: make(map[core.Hash]core.Object, 0),
 		Commits: make(map[core.Hash]core.Object, 0),
 		Trees:   make(map[core.Hash]core.Object, 0),
 		Blobs:   make(map[core.Hash]core.Object, 0),
 		Tags:    make(map[core.Hash]core.Object, 0),
+
+		ModTimes: make(map[core.Hash]time.Time, 0),
+
+		format: f,
 	}
 }
 
+// ObjectFormat returns the format of the hashes of the objects.
+func (o *ObjectStorage) ObjectFormat() core.ObjectFormat {
+	return o.format
+}
+
 // Set stores an object, the object should be properly filled before set it.
+// Its ModTime is updated even if it was already stored, as git does. A
+// *core.ErrObjectFormatMismatch is returned if its hash is not in the format
+// of the storage.
 func (o *ObjectStorage) Set(obj core.Object) (core.Hash, error) {
 	h := obj.Hash()
+	if err := core.CheckObjectFormat(o.format, h); err != nil {
+		return core.ZeroHash, err
+	}
+
 	o.Objects[h] = obj
+	if o.ModTimes != nil {
+		o.ModTimes[h] = time.Now()
+	}
 
 	switch obj.Type() {
 	case core.CommitObject:
@@ -59,6 +143,55 @@ func (o *ObjectStorage) Get(h core.Hash) (core.Object, error) {
 	return obj, nil
 }
 
+// Delete deletes the object with the given hash.
+func (o *ObjectStorage) Delete(h core.Hash) error {
+	if _, ok := o.Objects[h]; !ok {
+		return core.ErrObjectNotFound
+	}
+
+	for _, m := range []map[core.Hash]core.Object{o.Objects, o.Commits, o.Trees, o.Blobs, o.Tags} {
+		delete(m, h)
+	}
+
+	delete(o.ModTimes, h)
+	return nil
+}
+
+// ModTime returns the last time the object with the given hash was set, the
+// zero time if it was stored without calling Set.
+func (o *ObjectStorage) ModTime(h core.Hash) (time.Time, error) {
+	if _, ok := o.Objects[h]; !ok {
+		return time.Time{}, core.ErrObjectNotFound
+	}
+
+	return o.ModTimes[h], nil
+}
+
+// Has returns true if the storage has the object with the given hash.
+func (o *ObjectStorage) Has(h core.Hash) (bool, error) {
+	_, ok := o.Objects[h]
+	return ok, nil
+}
+
+// HashesWithPrefix returns the hashes of the objects starting with the given
+// prefix, see core.HashesWithPrefix, looking at every hash in the storage.
+func (o *ObjectStorage) HashesWithPrefix(prefix string) ([]core.Hash, error) {
+	var hashes []core.Hash
+	for h := range o.Objects {
+		if h.HasPrefix(prefix) {
+			hashes = append(hashes, h)
+		}
+	}
+
+	return hashes, nil
+}
+
+// ConcurrentSafe returns true, Get can be called from several goroutines at
+// once as long as Set is not called at the same time.
+func (o *ObjectStorage) ConcurrentSafe() bool {
+	return true
+}
+
 // Iter returns a core.ObjectIter for the given core.ObjectTybe
 func (o *ObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
 	var series []core.Object
@@ -1,6 +1,8 @@
 package memory
 
 import (
+	"time"
+
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git.v3/core"
 )
@@ -27,6 +29,18 @@ func (s *ObjectStorageSuite) TestSet(c *C) {
 	c.Assert(h.String(), Equals, "bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
 }
 
+func (s *ObjectStorageSuite) TestSetObjectFormat(c *C) {
+	os := NewObjectStorageWithFormat(core.SHA256)
+	c.Assert(os.ObjectFormat(), Equals, core.SHA256)
+
+	h, err := os.Set(NewObjectWithFormat(core.SHA256, core.BlobObject, 4, []byte("bar\n")))
+	c.Assert(err, IsNil)
+	c.Assert(h.Format(), Equals, core.SHA256)
+
+	_, err = os.Set(NewObject(core.BlobObject, 4, []byte("bar\n")))
+	c.Assert(err, DeepEquals, &core.ErrObjectFormatMismatch{Expected: core.SHA256, Actual: core.SHA1})
+}
+
 func (s *ObjectStorageSuite) TestGet(c *C) {
 	os := NewObjectStorage()
 
@@ -48,3 +62,73 @@ func (s *ObjectStorageSuite) TestGet(c *C) {
 
 	c.Assert(ro, DeepEquals, o)
 }
+
+func (s *ObjectStorageSuite) TestHas(c *C) {
+	os := NewObjectStorage()
+
+	h, err := os.Set(NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+
+	ok, err := os.Has(h)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	ok, err = os.Has(core.ZeroHash)
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *ObjectStorageSuite) TestDelete(c *C) {
+	os := NewObjectStorage()
+
+	h, err := os.Set(NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+
+	c.Assert(os.Delete(h), IsNil)
+	_, err = os.Get(h)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+	c.Assert(os.Blobs, HasLen, 0)
+	c.Assert(os.ModTimes, HasLen, 0)
+
+	c.Assert(os.Delete(h), Equals, core.ErrObjectNotFound)
+}
+
+func (s *ObjectStorageSuite) TestModTime(c *C) {
+	os := NewObjectStorage()
+
+	before := time.Now()
+	h, err := os.Set(NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+
+	t, err := os.ModTime(h)
+	c.Assert(err, IsNil)
+	c.Assert(t.Before(before), Equals, false)
+
+	// it is updated when the object is set again
+	os.ModTimes[h] = before.Add(-time.Hour)
+	_, err = os.Set(NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+	t, err = os.ModTime(h)
+	c.Assert(err, IsNil)
+	c.Assert(t.Before(before), Equals, false)
+
+	_, err = os.ModTime(core.ZeroHash)
+	c.Assert(err, Equals, core.ErrObjectNotFound)
+}
+
+func (s *ObjectStorageSuite) TestHashesWithPrefix(c *C) {
+	os := NewObjectStorage()
+
+	foo, err := os.Set(NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+	_, err = os.Set(NewObject(core.BlobObject, 3, []byte("bar")))
+	c.Assert(err, IsNil)
+
+	hashes, err := os.HashesWithPrefix(foo.String()[:4])
+	c.Assert(err, IsNil)
+	c.Assert(hashes, DeepEquals, []core.Hash{foo})
+
+	hashes, err = os.HashesWithPrefix("")
+	c.Assert(err, IsNil)
+	c.Assert(hashes, HasLen, 2)
+}
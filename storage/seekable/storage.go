@@ -3,6 +3,7 @@ package seekable
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
@@ -17,7 +18,8 @@ import (
 //
 // Zero values of this type are not safe to use, see the New function below.
 //
-// Currently only reads are supported, no writting.
+// Currently only reads are supported, no writting, of the repositories of
+// the core.SHA1 format, see filesystem.ObjectStorage for the other ones.
 //
 // Also values from this type are not yet able to track changes on disk, this is,
 // Gitdir values will get outdated as soon as repositories change on disk.
@@ -134,6 +136,123 @@ func (s *ObjectStorage) Get(h core.Hash) (core.Object, error) {
 	return p.ReadObject()
 }
 
+// GetMany returns the objects with the given hashes, see core.GetMany. The
+// packfile is opened once and the objects are read in the order they are
+// stored in it, so it is read forward instead of seeking back and forth.
+func (s *ObjectStorage) GetMany(hs []core.Hash) ([]core.Object, error) {
+	missing := make(map[int]error, 0)
+	var found []core.Hash
+	for i, h := range hs {
+		if _, ok := s.index[h]; ok {
+			found = append(found, h)
+		} else {
+			missing[i] = core.ErrObjectNotFound
+		}
+	}
+
+	read, err := s.readMany(found)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]core.Object, len(hs))
+	for i, h := range hs {
+		objs[i] = read[h]
+	}
+
+	if len(missing) != 0 {
+		return objs, &core.GetManyError{Errors: missing}
+	}
+
+	return objs, nil
+}
+
+// readMany reads the objects with the given hashes, which must be in the
+// index, sorting them by offset first.
+func (s *ObjectStorage) readMany(hs []core.Hash) (objs map[core.Hash]core.Object, err error) {
+	objs = make(map[core.Hash]core.Object, len(hs))
+	if len(hs) == 0 {
+		return objs, nil
+	}
+
+	sort.Sort(byOffset{hs, s.index})
+
+	fs, path, err := s.dir.Packfile()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		errClose := f.Close()
+		if err == nil {
+			err = errClose
+		}
+	}()
+
+	r := packfile.NewSeekable(f)
+	r.HashToOffset = map[core.Hash]int64(s.index)
+	p := packfile.NewParser(r)
+	for _, h := range hs {
+		if _, ok := objs[h]; ok {
+			continue
+		}
+
+		if _, err = f.Seek(s.index[h], os.SEEK_SET); err != nil {
+			return nil, err
+		}
+
+		if objs[h], err = p.ReadObject(); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, nil
+}
+
+// byOffset sorts hashes by the offset of their objects in the packfile.
+type byOffset struct {
+	hashes []core.Hash
+	index  index.Index
+}
+
+func (s byOffset) Len() int {
+	return len(s.hashes)
+}
+
+func (s byOffset) Less(i, j int) bool {
+	return s.index[s.hashes[i]] < s.index[s.hashes[j]]
+}
+
+func (s byOffset) Swap(i, j int) {
+	s.hashes[i], s.hashes[j] = s.hashes[j], s.hashes[i]
+}
+
+// Has returns true if the object with the given hash is in the index of the
+// packfile, without reading the packfile.
+func (s *ObjectStorage) Has(h core.Hash) (bool, error) {
+	_, ok := s.index[h]
+	return ok, nil
+}
+
+// HashesWithPrefix returns the hashes of the objects starting with the given
+// prefix, see core.HashesWithPrefix, looking at every hash in the index of
+// the packfile, without reading the packfile.
+func (s *ObjectStorage) HashesWithPrefix(prefix string) ([]core.Hash, error) {
+	var hashes []core.Hash
+	for h := range s.index {
+		if h.HasPrefix(prefix) {
+			hashes = append(hashes, h)
+		}
+	}
+
+	return hashes, nil
+}
+
 // Iter returns an iterator for all the objects in the packfile with the
 // given type.
 func (s *ObjectStorage) Iter(t core.ObjectType) (core.ObjectIter, error) {
@@ -84,6 +84,101 @@ func (s *FsSuite) TestHashNotFound(c *C) {
 	c.Assert(err, Equals, core.ErrObjectNotFound)
 }
 
+func (s *FsSuite) TestHas(c *C) {
+	for _, fixId := range [...]string{"binary-relations", "binary-relations-no-idx"} {
+		fs := fs.NewOS()
+		gitPath := fs.Join(fixture(fixId, c), ".git/")
+
+		sto, err := seekable.New(fs, gitPath)
+		c.Assert(err, IsNil)
+
+		memSto, err := memStorageFromGitDir(fs, gitPath)
+		c.Assert(err, IsNil)
+
+		for h := range memSto.Objects {
+			ok, err := sto.Has(h)
+			c.Assert(err, IsNil)
+			c.Assert(ok, Equals, true, Commentf("fixture=%s, hash=%s", fixId, h))
+		}
+
+		ok, err := sto.Has(core.ZeroHash)
+		c.Assert(err, IsNil)
+		c.Assert(ok, Equals, false)
+	}
+}
+
+func (s *FsSuite) TestHashesWithPrefix(c *C) {
+	for _, fixId := range [...]string{"binary-relations", "binary-relations-no-idx"} {
+		fs := fs.NewOS()
+		gitPath := fs.Join(fixture(fixId, c), ".git/")
+
+		sto, err := seekable.New(fs, gitPath)
+		c.Assert(err, IsNil)
+
+		memSto, err := memStorageFromGitDir(fs, gitPath)
+		c.Assert(err, IsNil)
+
+		for h := range memSto.Objects {
+			prefix := h.String()[:2]
+			expected, err := core.HashesWithPrefix(memSto, prefix)
+			c.Assert(err, IsNil)
+
+			obtained, err := core.HashesWithPrefix(sto, prefix)
+			c.Assert(err, IsNil)
+			c.Assert(obtained, DeepEquals, expected, Commentf("fixture=%s, prefix=%s", fixId, prefix))
+		}
+
+		hashes, err := sto.HashesWithPrefix("ffffffff")
+		c.Assert(err, IsNil)
+		c.Assert(hashes, HasLen, 0)
+	}
+}
+
+func (s *FsSuite) TestGetMany(c *C) {
+	for _, fixId := range [...]string{
+		"binary-relations",
+		"binary-relations-no-idx",
+		"ref-deltas-no-idx",
+	} {
+		com := Commentf("fixture=%s", fixId)
+		fs := fs.NewOS()
+		gitPath := fs.Join(fixture(fixId, c), ".git/")
+
+		sto, err := seekable.New(fs, gitPath)
+		c.Assert(err, IsNil, com)
+
+		memSto, err := memStorageFromGitDir(fs, gitPath)
+		c.Assert(err, IsNil, com)
+
+		var hashes []core.Hash
+		for h := range memSto.Objects {
+			hashes = append(hashes, h)
+		}
+		hashes = append(hashes, core.ZeroHash, hashes[0])
+
+		objs, err := sto.GetMany(hashes)
+		c.Assert(err, DeepEquals, &core.GetManyError{Errors: map[int]error{
+			len(hashes) - 2: core.ErrObjectNotFound,
+		}}, com)
+		c.Assert(objs, HasLen, len(hashes), com)
+		c.Assert(objs[len(hashes)-2], IsNil, com)
+
+		for i, h := range hashes {
+			if h == core.ZeroHash {
+				continue
+			}
+
+			equal, reason, err := equalsObjects(memSto.Objects[h], objs[i])
+			c.Assert(err, IsNil, com)
+			c.Assert(equal, Equals, true, Commentf("fixture=%s, hash=%s: %s", fixId, h, reason))
+		}
+
+		objs, err = sto.GetMany(hashes[:1])
+		c.Assert(err, IsNil, com)
+		c.Assert(objs, HasLen, 1, com)
+	}
+}
+
 func (s *FsSuite) TestGetCompareWithMemoryStorage(c *C) {
 	for i, fixId := range [...]string{
 		"binary-relations",
@@ -324,3 +419,40 @@ func (s *FsSuite) TestSet(c *C) {
 	_, err = sto.Set(&memory.Object{})
 	c.Assert(err, ErrorMatches, "not implemented yet")
 }
+
+func (s *FsSuite) benchmarkGet(c *C, get func(*seekable.ObjectStorage, []core.Hash)) {
+	fs := fs.NewOS()
+	gitPath := fs.Join(fixture("binary-relations", c), ".git/")
+
+	sto, err := seekable.New(fs, gitPath)
+	c.Assert(err, IsNil)
+
+	memSto, err := memStorageFromGitDir(fs, gitPath)
+	c.Assert(err, IsNil)
+
+	var hashes []core.Hash
+	for h := range memSto.Objects {
+		hashes = append(hashes, h)
+	}
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		get(sto, hashes)
+	}
+}
+
+func (s *FsSuite) BenchmarkGet(c *C) {
+	s.benchmarkGet(c, func(sto *seekable.ObjectStorage, hashes []core.Hash) {
+		for _, h := range hashes {
+			_, err := sto.Get(h)
+			c.Assert(err, IsNil)
+		}
+	})
+}
+
+func (s *FsSuite) BenchmarkGetMany(c *C) {
+	s.benchmarkGet(c, func(sto *seekable.ObjectStorage, hashes []core.Hash) {
+		_, err := sto.GetMany(hashes)
+		c.Assert(err, IsNil)
+	})
+}
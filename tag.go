@@ -14,7 +14,8 @@ import (
 // any type, but tags typically are applied to commit or blob objects. It
 // provides a reference that associates the target with a tag name. It also
 // contains meta-information about the tag, including the tagger, tag date and
-// message.
+// message. The message of a signed tag includes its signature, as git writes
+// it.
 //
 // https://git-scm.com/book/en/v2/Git-Internals-Git-References#Tags
 type Tag struct {
@@ -105,9 +106,50 @@ func (t *Tag) Decode(o core.Object) (err error) {
 	return nil
 }
 
-// Commit returns the commit pointed to by the tag. If the tag points to a
-// different type of object ErrUnsupportedObject will be returned.
+// Encode transforms a Tag into a core.Object, the reverse of Decode: the
+// tagger is omitted if it is empty, and the message is written as it is, so
+// the decoded tags, the signed ones included, keep their hashes. The target
+// must be in the format of the object, a *core.ErrObjectFormatMismatch is
+// returned otherwise.
+func (t *Tag) Encode(o core.Object) (err error) {
+	if err := checkObjectFormat(o, t.Target); err != nil {
+		return err
+	}
+
+	o.SetType(core.TagObject)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\ntype %s\ntag %s\n", t.Target, t.TargetType, t.Name)
+	if t.Tagger.Name != "" || t.Tagger.Email != "" || !t.Tagger.When.IsZero() {
+		fmt.Fprintf(&buf, "tagger %s\n", t.Tagger.Encode())
+	}
+
+	buf.WriteByte('\n')
+	buf.WriteString(t.Message)
+
+	o.SetSize(int64(buf.Len()))
+
+	w, err := o.Writer()
+	if err != nil {
+		return err
+	}
+	defer checkClose(w, &err)
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Commit returns the commit pointed to by the tag, following the tags of
+// tags. If the tag points to a different type of object
+// ErrUnsupportedObject will be returned.
 func (t *Tag) Commit() (*Commit, error) {
+	for t.TargetType == core.TagObject {
+		var err error
+		if t, err = t.r.TagObject(t.Target); err != nil {
+			return nil, err
+		}
+	}
+
 	if t.TargetType != core.CommitObject {
 		return nil, ErrUnsupportedObject
 	}
@@ -125,7 +167,7 @@ func (t *Tag) Tree() (*Tree, error) {
 		if err != nil {
 			return nil, err
 		}
-		return commit.Tree(), nil
+		return commit.Tree()
 	case core.TreeObject:
 		return t.r.Tree(t.Target)
 	default:
@@ -156,23 +198,23 @@ func (t *Tag) String() string {
 	)
 }
 
-// TagIter provides an iterator for a set of tags.
-type TagIter struct {
+// TagObjectIter provides an iterator for a set of annotated tag objects.
+type TagObjectIter struct {
 	core.ObjectIter
 	r *Repository
 }
 
-// NewTagIter returns a TagIter for the given repository and underlying
-// object iterator.
+// NewTagObjectIter returns a TagObjectIter for the given repository and
+// underlying object iterator.
 //
-// The returned TagIter will automatically skip over non-tag objects.
-func NewTagIter(r *Repository, iter core.ObjectIter) *TagIter {
-	return &TagIter{iter, r}
+// The returned TagObjectIter will automatically skip over non-tag objects.
+func NewTagObjectIter(r *Repository, iter core.ObjectIter) *TagObjectIter {
+	return &TagObjectIter{iter, r}
 }
 
 // Next moves the iterator to the next tag and returns a pointer to it. If it
 // has reached the end of the set it will return io.EOF.
-func (iter *TagIter) Next() (*Tag, error) {
+func (iter *TagObjectIter) Next() (*Tag, error) {
 	obj, err := iter.ObjectIter.Next()
 	if err != nil {
 		return nil, err
@@ -3,10 +3,16 @@ package git
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/alcortesm/tgz"
 	. "gopkg.in/check.v1"
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
 )
 
 type expectedTag struct {
@@ -45,14 +51,31 @@ var tagTests = []struct {
 	// TODO: Add fixture with tagged blobs
 }
 
+// tagsFixture is a git directory written by git with tags of every kind: of
+// tags, trees and blobs, signed and lightweight, see the tags below
+const tagsFixture = "fixtures/tags.tgz"
+
 type SuiteTag struct {
 	repos map[string]*Repository
+	dir   string
+	tags  *Repository
 }
 
 var _ = Suite(&SuiteTag{})
 
 func (s *SuiteTag) SetUpSuite(c *C) {
 	s.repos = unpackFixtures(c, tagFixtures)
+
+	var err error
+	s.dir, err = tgz.Extract(tagsFixture)
+	c.Assert(err, IsNil)
+
+	s.tags, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteTag) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
 }
 
 func (s *SuiteTag) TestCommit(c *C) {
@@ -64,7 +87,7 @@ func (s *SuiteTag) TestCommit(c *C) {
 			if exp.Type != core.CommitObject {
 				continue
 			}
-			tag, err := r.Tag(core.NewHash(hash))
+			tag, err := r.TagObject(core.NewHash(hash))
 			c.Assert(err, IsNil)
 			commit, err := tag.Commit()
 			c.Assert(err, IsNil)
@@ -84,7 +107,7 @@ func (s *SuiteTag) TestTree(c *C) {
 			if exp.Type != core.TreeObject {
 				continue
 			}
-			tag, err := r.Tag(core.NewHash(hash))
+			tag, err := r.TagObject(core.NewHash(hash))
 			c.Assert(err, IsNil)
 			tree, err := tag.Tree()
 			c.Assert(err, IsNil)
@@ -105,7 +128,7 @@ func (s *SuiteTag) TestBlob(c *C) {
 				continue
 			}
 			hash := core.NewHash(hashString)
-			tag, err := r.Tag(hash)
+			tag, err := r.TagObject(hash)
 			c.Assert(err, IsNil)
 			testTagExpected(c, tag, hash, exp, "")
 			blob, err := tag.Blob()
@@ -127,7 +150,7 @@ func (s *SuiteTag) TestObject(c *C) {
 				continue
 			}
 			hash := core.NewHash(hashString)
-			tag, err := r.Tag(hash)
+			tag, err := r.TagObject(hash)
 			c.Assert(err, IsNil)
 			testTagExpected(c, tag, hash, exp, "")
 			obj, err := tag.Object()
@@ -156,7 +179,7 @@ func testTagExpected(c *C, tag *Tag, hash core.Hash, exp expectedTag, com string
 	c.Assert(tag.Message, Equals, exp.Message, Commentf("subtest %d, iter %d, message=\"%s\", expected=\"%s\"", com, tag.Message, exp.Message))
 }
 
-func testTagIter(c *C, iter *TagIter, tags map[string]expectedTag, com string) {
+func testTagObjectIter(c *C, iter *TagObjectIter, tags map[string]expectedTag, com string) {
 	for k := 0; k < len(tags); k++ {
 		com = fmt.Sprintf("%siter %d: ", com, k)
 		tag, err := iter.Next()
@@ -173,3 +196,238 @@ func testTagIter(c *C, iter *TagIter, tags map[string]expectedTag, com string) {
 	_, err := iter.Next()
 	c.Assert(err, Equals, io.EOF)
 }
+
+func (s *SuiteTag) TestEncodeRoundTrip(c *C) {
+	repos := map[string]*Repository{tagsFixture: s.tags}
+	for name, r := range s.repos {
+		repos[name] = r
+	}
+
+	for name, r := range repos {
+		iter, err := r.Storage.Iter(core.TagObject)
+		c.Assert(err, IsNil)
+
+		n := 0
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			tag := &Tag{}
+			c.Assert(tag.Decode(obj), IsNil)
+
+			encoded := &memory.Object{}
+			c.Assert(tag.Encode(encoded), IsNil)
+			com := Commentf("repo=%s tag=%s", name, obj.Hash())
+			c.Assert(string(encoded.Content()), Equals, string(obj.Content()), com)
+			c.Assert(encoded.Hash(), Equals, obj.Hash(), com)
+			n++
+		}
+
+		iter.Close()
+		c.Assert(n > 0, Equals, true)
+	}
+}
+
+func (s *SuiteTag) TestEncodeWithoutTagger(c *C) {
+	tag := &Tag{
+		Name:       "v1.0",
+		Message:    "foo\n",
+		TargetType: core.CommitObject,
+		Target:     core.NewHash("9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c"),
+	}
+
+	encoded := &memory.Object{}
+	c.Assert(tag.Encode(encoded), IsNil)
+	c.Assert(encoded.Type(), Equals, core.TagObject)
+	c.Assert(string(encoded.Content()), Equals, ""+
+		"object 9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c\n"+
+		"type commit\n"+
+		"tag v1.0\n"+
+		"\n"+
+		"foo\n")
+}
+
+func (s *SuiteTag) TestSigned(c *C) {
+	tag, err := s.tags.TagObject(core.NewHash("edc9ad14f484a3267efa6a4425ad1f3bf0e306d9"))
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, "signed")
+	c.Assert(strings.HasPrefix(tag.Message, "signed tag\n-----BEGIN PGP SIGNATURE-----\n"), Equals, true)
+	c.Assert(strings.HasSuffix(tag.Message, "\n-----END PGP SIGNATURE-----\n"), Equals, true)
+}
+
+func (s *SuiteTag) TestCommitNested(c *C) {
+	tag, err := s.tags.TagObject(core.NewHash("25acfd0034e92769b886fe6146448326bf308652"))
+	c.Assert(err, IsNil)
+	c.Assert(tag.TargetType, Equals, core.TagObject)
+
+	commit, err := tag.Commit()
+	c.Assert(err, IsNil)
+	c.Assert(commit.Hash, Equals, core.NewHash("9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c"))
+
+	tag, err = s.tags.TagObject(core.NewHash("dada96be4fba2d0bbb79eb61eff944d8e7d2547e"))
+	c.Assert(err, IsNil)
+	_, err = tag.Commit()
+	c.Assert(err, Equals, ErrUnsupportedObject)
+}
+
+func (s *SuiteTag) TestRepositoryTag(c *C) {
+	for _, t := range []struct {
+		name     string
+		peel     bool
+		hash     string
+		expected core.ObjectType
+	}{
+		{"annotated", false, "b6194f3425674c0dde174619f97cd511a0bf4ca4", core.TagObject},
+		{"annotated", true, "9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c", core.CommitObject},
+		{"nested", false, "25acfd0034e92769b886fe6146448326bf308652", core.TagObject},
+		{"nested", true, "9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c", core.CommitObject},
+		{"lightweight", false, "604a6aa6055f632add2017789fdadc93691248e5", core.CommitObject},
+		{"lightweight", true, "604a6aa6055f632add2017789fdadc93691248e5", core.CommitObject},
+		{"blob", false, "e3e43b69a2e72fb26aad4ba441cb69c5ec1ce83a", core.TagObject},
+	} {
+		com := Commentf("name=%s peel=%v", t.name, t.peel)
+		obj, err := s.tags.Tag(t.name, t.peel)
+		c.Assert(err, IsNil, com)
+		c.Assert(obj.ID(), Equals, core.NewHash(t.hash), com)
+		c.Assert(obj.Type(), Equals, t.expected, com)
+	}
+
+	_, err := s.tags.Tag("tree", true)
+	c.Assert(err, Equals, ErrUnsupportedObject)
+
+	_, err = s.tags.Tag("foo", false)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+}
+
+func (s *SuiteTag) TestRepositoryTags(c *C) {
+	iter, err := s.tags.Tags()
+	c.Assert(err, IsNil)
+
+	commits := make(map[core.ReferenceName]string)
+	annotated := make(map[core.ReferenceName]bool)
+	c.Assert(iter.ForEach(func(tag *TagReference) error {
+		annotated[tag.Name] = tag.Tag != nil
+		if tag.Commit != nil {
+			commits[tag.Name] = tag.Commit.Hash.String()
+		}
+
+		return nil
+	}), IsNil)
+
+	c.Assert(commits, DeepEquals, map[core.ReferenceName]string{
+		"refs/tags/annotated":   "9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c",
+		"refs/tags/lightweight": "604a6aa6055f632add2017789fdadc93691248e5",
+		"refs/tags/multiline":   "604a6aa6055f632add2017789fdadc93691248e5",
+		"refs/tags/nested":      "9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c",
+		"refs/tags/signed":      "9d6a11d92cb05071b8fd9e6b0f2c1b42fcc3271c",
+	})
+
+	c.Assert(annotated, DeepEquals, map[core.ReferenceName]bool{
+		"refs/tags/annotated":   true,
+		"refs/tags/blob":        true,
+		"refs/tags/lightweight": false,
+		"refs/tags/multiline":   true,
+		"refs/tags/nested":      true,
+		"refs/tags/signed":      true,
+		"refs/tags/tree":        true,
+	})
+}
+
+func (s *SuiteTag) TestCreateTag(c *C) {
+	r := NewPlainRepository()
+	blob, err := r.Storage.Set(memory.NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+
+	ref, err := r.CreateTag("lightweight", blob, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, core.NewHashReference("refs/tags/lightweight", blob))
+
+	tagger := Signature{Name: "John Doe", Email: "john@doe.com", When: time.Unix(1465833006, 0).In(time.FixedZone("", 2*3600))}
+	ref, err = r.CreateTag("annotated", blob, &CreateTagOptions{Tagger: tagger, Message: "foo tag"})
+	c.Assert(err, IsNil)
+
+	stored, err := r.References.Get("refs/tags/annotated")
+	c.Assert(err, IsNil)
+	c.Assert(stored, DeepEquals, ref)
+
+	tag, err := r.TagObject(ref.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(tag.Name, Equals, "annotated")
+	c.Assert(tag.Tagger.Name, Equals, tagger.Name)
+	c.Assert(tag.Tagger.Email, Equals, tagger.Email)
+	c.Assert(tag.Tagger.When.Equal(tagger.When), Equals, true)
+	c.Assert(tag.Message, Equals, "foo tag\n")
+	c.Assert(tag.TargetType, Equals, core.BlobObject)
+	c.Assert(tag.Target, Equals, blob)
+
+	ref, err = r.CreateTag("nested", tag.Hash, &CreateTagOptions{Message: "tag of a tag\n"})
+	c.Assert(err, IsNil)
+
+	nested, err := r.TagObject(ref.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(nested.Message, Equals, "tag of a tag\n")
+	c.Assert(nested.TargetType, Equals, core.TagObject)
+	c.Assert(nested.Target, Equals, tag.Hash)
+}
+
+func (s *SuiteTag) TestCreateTagExisting(c *C) {
+	r := NewPlainRepository()
+	foo, err := r.Storage.Set(memory.NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+	bar, err := r.Storage.Set(memory.NewObject(core.BlobObject, 3, []byte("bar")))
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateTag("v1", foo, nil)
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateTag("v1", bar, nil)
+	c.Assert(err, Equals, ErrTagExists)
+	_, err = r.CreateTag("v1", bar, &CreateTagOptions{Message: "bar"})
+	c.Assert(err, Equals, ErrTagExists)
+
+	ref, err := r.References.Get("refs/tags/v1")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, foo)
+
+	_, err = r.CreateTag("v1", bar, &CreateTagOptions{Force: true})
+	c.Assert(err, IsNil)
+
+	ref, err = r.References.Get("refs/tags/v1")
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash, Equals, bar)
+
+	iter, err := r.Reflog("refs/tags/v1")
+	c.Assert(err, IsNil)
+	for _, expected := range []*core.ReflogEntry{
+		{New: foo, Message: "tag: tagging " + foo.String()},
+		{Old: foo, New: bar, Message: "tag: tagging " + bar.String()},
+	} {
+		entry, err := iter.Next()
+		c.Assert(err, IsNil)
+		c.Assert(entry.Old, Equals, expected.Old)
+		c.Assert(entry.New, Equals, expected.New)
+		c.Assert(entry.Message, Equals, expected.Message)
+	}
+}
+
+func (s *SuiteTag) TestCreateTagErrors(c *C) {
+	r := NewPlainRepository()
+	foo, err := r.Storage.Set(memory.NewObject(core.BlobObject, 3, []byte("foo")))
+	c.Assert(err, IsNil)
+
+	for _, name := range []string{"", "foo..bar", "foo.lock", "foo bar", ".foo", "foo/", "foo~1"} {
+		_, err := r.CreateTag(name, foo, nil)
+		c.Assert(err, Equals, core.ErrInvalidReferenceName, Commentf("name=%q", name))
+	}
+
+	_, err = r.CreateTag("missing", core.NewHash("0000000000000000000000000000000000000001"), nil)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	iter, err := r.References.Iter()
+	c.Assert(err, IsNil)
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+}
@@ -2,9 +2,13 @@ package git
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,13 +16,32 @@ import (
 )
 
 const (
-	maxTreeDepth = 1024
+	// DefaultMaxTreeDepth is the maximum number of nested subtrees followed
+	// when walking a tree, unless a different limit is set.
+	DefaultMaxTreeDepth = 1024
+)
+
+// Modes of the tree entries, as written by git.
+const (
+	treeEntryDirMode        = os.FileMode(0040000)
+	treeEntryRegularMode    = os.FileMode(0100644)
+	treeEntryExecutableMode = os.FileMode(0100755)
+	treeEntrySymlinkMode    = os.FileMode(0120000)
+	treeEntrySubmoduleMode  = os.FileMode(0160000)
+
+	// type bits of the regular files, the mode without the permissions
+	treeEntryRegularType = os.FileMode(0100000)
 )
 
 // New errors defined by this package.
 var (
-	ErrMaxTreeDepth = errors.New("maximum tree depth exceeded")
-	ErrFileNotFound = errors.New("file not found")
+	ErrMaxTreeDepth      = errors.New("maximum tree depth exceeded")
+	ErrFileNotFound      = errors.New("file not found")
+	ErrDirectoryNotFound = errors.New("directory not found")
+	ErrEntryNotFound     = errors.New("entry not found")
+	ErrIsDirectory       = errors.New("is a directory")
+	ErrInvalidPath       = errors.New("invalid path")
+	ErrInvalidFileMode   = errors.New("invalid file mode")
 )
 
 // Tree is basically like a directory - it references a bunch of other trees
@@ -27,8 +50,9 @@ type Tree struct {
 	Entries []TreeEntry
 	Hash    core.Hash
 
-	r *Repository
-	m map[string]*TreeEntry
+	r   *Repository
+	m   map[string]*TreeEntry
+	mci map[string]*TreeEntry // case folded names, see entryCI
 }
 
 // TreeEntry represents a file
@@ -38,24 +62,94 @@ type TreeEntry struct {
 	Hash core.Hash
 }
 
+// IsExecutable returns true if the entry is an executable file.
+func (e *TreeEntry) IsExecutable() bool {
+	return isExecutableMode(e.Mode)
+}
+
+// IsSymlink returns true if the entry is a symbolic link.
+func (e *TreeEntry) IsSymlink() bool {
+	return isSymlinkMode(e.Mode)
+}
+
+// IsSubmodule returns true if the entry is a git submodule.
+func (e *TreeEntry) IsSubmodule() bool {
+	return isSubmoduleMode(e.Mode)
+}
+
 // File returns the hash of the file identified by the `path` argument.
-// The path is interpreted as relative to the tree receiver.
+// The path is interpreted as relative to the tree receiver. Repeated, leading
+// and trailing slashes and "." components are ignored, ErrInvalidPath is
+// returned if the path has ".." components or does not name any entry.
+//
+// If the path does not exist ErrFileNotFound is returned, if it identifies a
+// directory ErrIsDirectory is returned, and if it identifies a git submodule,
+// whose commit is not available in the storage, a *SubmoduleNotResolvedError
+// is returned.
 func (t *Tree) File(path string) (*File, error) {
-	e, err := t.findEntry(path)
+	pathParts, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := t.findEntry(pathParts)
 	if err != nil {
 		return nil, ErrFileNotFound
 	}
 
-	obj, err := t.r.Storage.Get(e.Hash)
+	return t.file(strings.Join(pathParts, "/"), e)
+}
+
+// FileCI is like File but the components of the path are matched ignoring
+// their case, as it may happen with paths coming from case insensitive file
+// systems. An entry whose name matches exactly is always preferred to the
+// ones differing only by case. The name of the returned file is the path as
+// stored in the tree.
+func (t *Tree) FileCI(path string) (*File, error) {
+	pathParts, err := splitPath(path)
 	if err != nil {
-		if err == core.ErrObjectNotFound {
-			return nil, ErrFileNotFound // a git submodule
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pathParts))
+
+	tree := t
+	for ; len(pathParts) > 1; pathParts = pathParts[1:] {
+		e, err := tree.entryCI(pathParts[0])
+		if err != nil {
+			return nil, ErrFileNotFound
 		}
+
+		if tree, err = tree.subtree(e); err != nil {
+			return nil, ErrFileNotFound
+		}
+
+		names = append(names, e.Name)
+	}
+
+	e, err := tree.entryCI(pathParts[0])
+	if err != nil {
+		return nil, ErrFileNotFound
+	}
+
+	return tree.file(strings.Join(append(names, e.Name), "/"), e)
+}
+
+func (t *Tree) file(path string, e *TreeEntry) (*File, error) {
+	switch e.Mode {
+	case treeEntryDirMode:
+		return nil, ErrIsDirectory
+	case treeEntrySubmoduleMode:
+		return nil, &SubmoduleNotResolvedError{Path: path, Hash: e.Hash}
+	}
+
+	obj, err := t.r.Storage.Get(e.Hash)
+	if err != nil {
 		return nil, err
 	}
 
 	if obj.Type() != core.BlobObject {
-		return nil, ErrFileNotFound // a directory
+		return nil, ErrIsDirectory
 	}
 
 	blob := &Blob{}
@@ -64,13 +158,95 @@ func (t *Tree) File(path string) (*File, error) {
 	return newFile(path, e.Mode, blob), nil
 }
 
-func (t *Tree) findEntry(path string) (*TreeEntry, error) {
-	pathParts := strings.Split(path, "/")
+// SubmoduleNotResolvedError is returned when looking for a file that is a git
+// submodule, Hash is the hash of the commit of the submodule, which is
+// stored in its own repository.
+type SubmoduleNotResolvedError struct {
+	Path string
+	Hash core.Hash
+}
+
+func (e *SubmoduleNotResolvedError) Error() string {
+	return fmt.Sprintf("submodule not resolved: %s (%s)", e.Path, e.Hash)
+}
+
+// MaxTreeDepthError is returned by the TreeWalker, and the rest of the
+// walks of the trees, when the subtrees are nested deeper than the maximum
+// depth, Path is the path of the subtree where the limit was exceeded. It is
+// ErrMaxTreeDepth for errors.Is.
+type MaxTreeDepthError struct {
+	Path     string
+	MaxDepth int
+}
+
+func (e *MaxTreeDepthError) Error() string {
+	return fmt.Sprintf("%s (%d) at %s", ErrMaxTreeDepth, e.MaxDepth, e.Path)
+}
+
+// Is returns true if target is ErrMaxTreeDepth.
+func (e *MaxTreeDepthError) Is(target error) bool {
+	return target == ErrMaxTreeDepth
+}
+
+// maxTreeDepthError returns the *MaxTreeDepthError of the subtree with the
+// given path, for DefaultMaxTreeDepth.
+func maxTreeDepthError(path string) error {
+	return &MaxTreeDepthError{Path: path, MaxDepth: DefaultMaxTreeDepth}
+}
+
+// Tree returns the subtree identified by the `path` argument, a slash
+// separated list of directory names. The path is interpreted as relative to
+// the tree receiver. If any component of the path does not exist
+// ErrEntryNotFound is returned, if it exists but is not a directory (a blob
+// or a submodule) ErrDirectoryNotFound is returned. The path is normalized
+// as File does.
+func (t *Tree) Tree(path string) (*Tree, error) {
+	pathParts, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pathParts) > DefaultMaxTreeDepth {
+		return nil, maxTreeDepthError(strings.Join(pathParts, "/"))
+	}
+
+	tree := t
+	for _, name := range pathParts {
+		if tree, err = tree.dir(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return tree, nil
+}
+
+// FindEntry returns the entry identified by the `path` argument, relative
+// to the tree receiver. Only the intermediate directories are read from the
+// storage, so the entry is returned even when the object it references is
+// not available, as it happens with git submodules. The path is normalized
+// as File does.
+//
+// If any of the intermediate directories does not exist or is not a
+// directory ErrDirectoryNotFound is returned, if the final entry does not
+// exist ErrEntryNotFound is returned.
+func (t *Tree) FindEntry(path string) (*TreeEntry, error) {
+	pathParts, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
 
+	return t.findEntry(pathParts)
+}
+
+func (t *Tree) findEntry(pathParts []string) (*TreeEntry, error) {
 	var tree *Tree
 	var err error
 	for tree = t; len(pathParts) > 1; pathParts = pathParts[1:] {
 		if tree, err = tree.dir(pathParts[0]); err != nil {
+			if err == ErrEntryNotFound {
+				return nil, ErrDirectoryNotFound
+			}
+
 			return nil, err
 		}
 	}
@@ -78,24 +254,50 @@ func (t *Tree) findEntry(path string) (*TreeEntry, error) {
 	return tree.entry(pathParts[0])
 }
 
-var errDirNotFound = errors.New("directory not found")
+// splitPath returns the names of the components of a slash separated path,
+// ignoring the empty and "." components, so leading, trailing and repeated
+// slashes make no difference. ErrInvalidPath is returned if the path has any
+// ".." component or if no component is left.
+func splitPath(path string) ([]string, error) {
+	var pathParts []string
+	for _, name := range strings.Split(path, "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			return nil, ErrInvalidPath
+		}
+
+		pathParts = append(pathParts, name)
+	}
+
+	if len(pathParts) == 0 {
+		return nil, ErrInvalidPath
+	}
+
+	return pathParts, nil
+}
 
 func (t *Tree) dir(baseName string) (*Tree, error) {
 	entry, err := t.entry(baseName)
 	if err != nil {
-		return nil, errDirNotFound
+		return nil, err
 	}
 
-	obj, err := t.r.Storage.Get(entry.Hash)
+	return t.subtree(entry)
+}
+
+func (t *Tree) subtree(entry *TreeEntry) (*Tree, error) {
+	obj, err := t.r.getObject(entry.Hash)
 	if err != nil {
 		if err == core.ErrObjectNotFound { // git submodule
-			return nil, errDirNotFound
+			return nil, ErrDirectoryNotFound
 		}
 		return nil, err
 	}
 
 	if obj.Type() != core.TreeObject {
-		return nil, errDirNotFound // a file
+		return nil, ErrDirectoryNotFound // a file
 	}
 
 	tree := &Tree{r: t.r}
@@ -104,25 +306,123 @@ func (t *Tree) dir(baseName string) (*Tree, error) {
 	return tree, nil
 }
 
-var errEntryNotFound = errors.New("entry not found")
-
 func (t *Tree) entry(baseName string) (*TreeEntry, error) {
 	if t.m == nil {
 		t.buildMap()
 	}
 	entry, ok := t.m[baseName]
 	if !ok {
-		return nil, errEntryNotFound
+		return nil, ErrEntryNotFound
+	}
+
+	return entry, nil
+}
+
+// entryCI returns the entry named baseName or, if there is none, the first
+// one whose name only differs from it by case.
+func (t *Tree) entryCI(baseName string) (*TreeEntry, error) {
+	if entry, err := t.entry(baseName); err == nil {
+		return entry, nil
+	}
+
+	if t.mci == nil {
+		t.buildCaseInsensitiveMap()
+	}
+	entry, ok := t.mci[strings.ToLower(baseName)]
+	if !ok {
+		return nil, ErrEntryNotFound
 	}
 
 	return entry, nil
 }
 
-// Files returns a FileIter allowing to iterate over the Tree
+// Files returns a FileIter allowing to iterate over the Tree, descending at
+// most DefaultMaxTreeDepth levels of subtrees, see FileIter.SetMaxDepth.
 func (t *Tree) Files() *FileIter {
 	return NewFileIter(t.r, t)
 }
 
+// FilesByPrefix returns a FileIter allowing to iterate over the files of the
+// Tree found under the given path prefix, without decoding the subtrees
+// outside of it. The names of the files are still relative to the Tree.
+//
+// If the prefix identifies a file, the iterator only returns that file, if
+// it does not identify any entry of the Tree the iterator is empty. Leading,
+// trailing and repeated slashes and "." components in the prefix are
+// ignored, as in FindEntry, and the iterator returns ErrInvalidPath if it
+// has any ".." component, as well as the errors reading the Tree.
+func (t *Tree) FilesByPrefix(prefix string) *FileIter {
+	if isRootPath(prefix) {
+		return t.Files()
+	}
+
+	pathParts, err := splitPath(prefix)
+	if err != nil {
+		return newErrFileIter(t.r, err)
+	}
+
+	prefix = strings.Join(pathParts, "/")
+	base := strings.Join(pathParts[:len(pathParts)-1], "/")
+	empty := newFileIterWithBase(t.r, &Tree{r: t.r}, base)
+
+	e, err := t.findEntry(pathParts)
+	if err == ErrEntryNotFound || err == ErrDirectoryNotFound {
+		return empty
+	}
+
+	if err != nil {
+		return newErrFileIter(t.r, err)
+	}
+
+	obj, err := t.r.Object(e.Hash)
+	if err == ErrObjectNotFound { // git submodule
+		return empty
+	}
+
+	if err != nil {
+		return newErrFileIter(t.r, err)
+	}
+
+	if tree, ok := obj.(*Tree); ok {
+		return newFileIterWithBase(t.r, tree, prefix)
+	}
+
+	// a single file, iterate over a tree containing only its entry
+	single := &Tree{Entries: []TreeEntry{*e}, r: t.r}
+	return newFileIterWithBase(t.r, single, base)
+}
+
+// isRootPath returns true if the slash separated path has no components but
+// the empty and "." ones, which splitPath ignores.
+func isRootPath(p string) bool {
+	for _, name := range strings.Split(p, "/") {
+		if name != "" && name != "." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FilesNonRecursive returns a FileIter allowing to iterate over the files
+// directly contained in the Tree, without descending into its subtrees.
+func (t *Tree) FilesNonRecursive() *FileIter {
+	return NewNonRecursiveFileIter(t.r, t)
+}
+
+// Walk calls fn for every entry of the Tree and its subtrees, in tree order,
+// with the path of the entry relative to the Tree. The objects of the entries
+// are not read, so submodules are included too. If fn returns core.ErrSkipDir
+// when called for a subtree, the walk does not descend into it and the
+// subtree is not read from the storage, returning it for other entries does
+// nothing. Any other error stops the walk and is returned by Walk.
+func (t *Tree) Walk(fn func(path string, e TreeEntry) error) error {
+	w := NewTreeWalker(t.r, t)
+	defer w.Close()
+
+	return w.walk(fn)
+}
+
 // ID returns the object ID of the tree. The returned value will always match
 // the current value of Tree.Hash.
 //
@@ -136,7 +436,8 @@ func (t *Tree) Type() core.ObjectType {
 	return core.TreeObject
 }
 
-// Decode transform an core.Object into a Tree struct
+// Decode transform an core.Object into a Tree struct. If the content of the
+// object is not a valid tree a *MalformedTreeError is returned.
 func (t *Tree) Decode(o core.Object) (err error) {
 	if o.Type() != core.TreeObject {
 		return ErrUnsupportedObject
@@ -149,6 +450,7 @@ func (t *Tree) Decode(o core.Object) (err error) {
 
 	t.Entries = nil
 	t.m = nil
+	t.mci = nil
 
 	reader, err := o.Reader()
 	if err != nil {
@@ -156,41 +458,268 @@ func (t *Tree) Decode(o core.Object) (err error) {
 	}
 	defer checkClose(reader, &err)
 
-	r := bufio.NewReader(reader)
+	d := &treeDecoder{r: bufio.NewReader(reader), format: t.Hash.Format()}
 	for {
-		mode, err := r.ReadString(' ')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		entry, err := d.next()
+		if err == io.EOF {
+			break
+		}
 
+		if err != nil {
 			return err
 		}
 
-		fm, err := strconv.ParseInt(mode[:len(mode)-1], 8, 32)
-		if err != nil && err != io.EOF {
-			return err
+		t.Entries = append(t.Entries, entry)
+	}
+
+	return nil
+}
+
+// MalformedTreeError is returned when decoding a tree object whose content
+// is not valid, Entry is the index of the malformed entry and Offset the
+// position in the content where the problem was found.
+type MalformedTreeError struct {
+	Offset int64
+	Entry  int
+	Err    error
+}
+
+func (e *MalformedTreeError) Error() string {
+	return fmt.Sprintf("malformed tree: entry %d at offset %d: %s", e.Entry, e.Offset, e.Err)
+}
+
+const (
+	// maximum length of the mode of a tree entry, in octal digits
+	maxTreeEntryModeLength = 7
+	// maximum length of the name of a tree entry, longer names are taken
+	// as malformed input instead of being read into memory
+	maxTreeEntryNameLength = 4096
+)
+
+var (
+	errTreeEntryMode    = errors.New("invalid entry mode")
+	errTreeEntryName    = errors.New("invalid entry name")
+	errTreeEntryNameLen = errors.New("entry name too long")
+)
+
+// treeDecoder reads the entries of a tree one by one, keeping track of the
+// position in the content for the error messages.
+type treeDecoder struct {
+	r      *bufio.Reader
+	format core.ObjectFormat // of the tree and its entries
+	offset int64
+	entry  int
+}
+
+// next returns the next entry, io.EOF if there are no more entries.
+func (d *treeDecoder) next() (TreeEntry, error) {
+	var entry TreeEntry
+
+	mode, err := d.readUntil(' ', maxTreeEntryModeLength, errTreeEntryMode)
+	if err == io.EOF && len(mode) == 0 {
+		return entry, io.EOF
+	}
+
+	if err != nil {
+		return entry, d.error(err)
+	}
+
+	fm, err := strconv.ParseUint(string(mode), 8, 32)
+	if err != nil || len(mode) == 0 {
+		return entry, d.error(errTreeEntryMode)
+	}
+
+	name, err := d.readUntil(0, maxTreeEntryNameLength, errTreeEntryNameLen)
+	if err != nil {
+		return entry, d.error(err)
+	}
+
+	if len(name) == 0 {
+		return entry, d.error(errTreeEntryName)
+	}
+
+	var hash core.Hash
+	n, err := io.ReadFull(d.r, hash[:d.format.Size()])
+	d.offset += int64(n)
+	if err != nil {
+		return entry, d.error(err)
+	}
+
+	entry.Hash = core.NewHashFromBytes(d.format, hash[:])
+
+	entry.Mode = os.FileMode(fm)
+	entry.Name = string(name)
+	d.entry++
+
+	return entry, nil
+}
+
+// readUntil reads up to the delimiter, returning what was read without it.
+// If more than max bytes are found before the delimiter errTooLong is
+// returned.
+func (d *treeDecoder) readUntil(delim byte, max int, errTooLong error) ([]byte, error) {
+	var buf []byte
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return buf, err
+		}
+
+		d.offset++
+		if b == delim {
+			return buf, nil
+		}
+
+		if len(buf) == max {
+			return buf, errTooLong
 		}
 
-		name, err := r.ReadString(0)
-		if err != nil && err != io.EOF {
+		buf = append(buf, b)
+	}
+}
+
+// error wraps the problems found in the content in a *MalformedTreeError,
+// the errors of the underlying reader are returned as they are.
+func (d *treeDecoder) error(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	switch err {
+	case io.ErrUnexpectedEOF, errTreeEntryMode, errTreeEntryName, errTreeEntryNameLen:
+		return &MalformedTreeError{Offset: d.offset, Entry: d.entry, Err: err}
+	}
+
+	return err
+}
+
+// Encode transforms a Tree into a core.Object. The entries are written in
+// git tree order, whatever their order in the Entries slice is, and their
+// modes are converted to the ones used by git: both the modes read from git
+// trees and the os.FileMode values using the Go type bits are accepted. If
+// any entry has a mode without a git equivalent ErrInvalidFileMode is
+// returned, and a *core.ErrObjectFormatMismatch if the hash of any entry is
+// not in the format of the object, see memory.Object.SetFormat.
+func (t *Tree) Encode(o core.Object) (err error) {
+	entries := make([]TreeEntry, len(t.Entries))
+	for i, e := range t.Entries {
+		if e.Mode, err = gitFileMode(e.Mode); err != nil {
 			return err
 		}
 
-		var hash core.Hash
-		if _, err = io.ReadFull(r, hash[:]); err != nil {
+		if err := checkObjectFormat(o, e.Hash); err != nil {
 			return err
 		}
 
-		baseName := name[:len(name)-1]
-		t.Entries = append(t.Entries, TreeEntry{
-			Hash: hash,
-			Mode: os.FileMode(fm),
-			Name: baseName,
-		})
+		entries[i] = e
 	}
 
-	return nil
+	sort.Sort(treeEntrySorter(entries))
+
+	o.SetType(core.TreeObject)
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%o %s", uint32(entry.Mode), entry.Name)
+		buf.WriteByte(0)
+		buf.Write(entry.Hash.Bytes())
+	}
+
+	o.SetSize(int64(buf.Len()))
+
+	w, err := o.Writer()
+	if err != nil {
+		return err
+	}
+	defer checkClose(w, &err)
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// gitFileMode returns the git mode equivalent to m. The modes of git are
+// returned as they are, including the regular files with unusual permissions
+// (like 100664) found in trees written by old versions of git, so decoded
+// trees keep their hashes when encoded again. The os.FileMode values are
+// converted looking at their type bits, regular files being executable if
+// any of the execute permission bits is set. A directory with the symlink bit
+// set is taken as a submodule.
+func gitFileMode(m os.FileMode) (os.FileMode, error) {
+	switch m {
+	case treeEntryDirMode, treeEntryRegularMode, treeEntryExecutableMode,
+		treeEntrySymlinkMode, treeEntrySubmoduleMode:
+		return m, nil
+	}
+
+	if m&^os.ModePerm == treeEntryRegularType {
+		return m, nil // legacy mode of a regular file
+	}
+
+	if m&^(os.ModeType|os.ModePerm) != 0 {
+		return 0, ErrInvalidFileMode
+	}
+
+	switch m & os.ModeType {
+	case 0:
+		if m&0111 != 0 {
+			return treeEntryExecutableMode, nil
+		}
+
+		return treeEntryRegularMode, nil
+	case os.ModeDir:
+		return treeEntryDirMode, nil
+	case os.ModeSymlink:
+		return treeEntrySymlinkMode, nil
+	case os.ModeDir | os.ModeSymlink:
+		return treeEntrySubmoduleMode, nil
+	}
+
+	return 0, ErrInvalidFileMode
+}
+
+// isExecutableMode returns true if m is the mode of a regular file with any
+// of the execute permission bits set, either a git mode or an os.FileMode.
+func isExecutableMode(m os.FileMode) bool {
+	m, err := gitFileMode(m)
+	return err == nil && m&^os.ModePerm == treeEntryRegularType && m&0111 != 0
+}
+
+// isSymlinkMode returns true if m is the mode of a symbolic link, either a
+// git mode or an os.FileMode.
+func isSymlinkMode(m os.FileMode) bool {
+	m, err := gitFileMode(m)
+	return err == nil && m == treeEntrySymlinkMode
+}
+
+// isSubmoduleMode returns true if m is the mode of a git submodule, either a
+// git mode or an os.FileMode.
+func isSubmoduleMode(m os.FileMode) bool {
+	m, err := gitFileMode(m)
+	return err == nil && m == treeEntrySubmoduleMode
+}
+
+// treeEntrySorter sorts tree entries in git tree order, where the names of
+// the subtrees are compared as if they had a trailing slash.
+type treeEntrySorter []TreeEntry
+
+func (s treeEntrySorter) Len() int {
+	return len(s)
+}
+
+func (s treeEntrySorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s treeEntrySorter) Less(i, j int) bool {
+	return treeEntrySortName(s[i]) < treeEntrySortName(s[j])
+}
+
+func treeEntrySortName(e TreeEntry) string {
+	if e.Mode == treeEntryDirMode {
+		return e.Name + "/"
+	}
+
+	return e.Name
 }
 
 func (t *Tree) buildMap() {
@@ -200,6 +729,74 @@ func (t *Tree) buildMap() {
 	}
 }
 
+func (t *Tree) buildCaseInsensitiveMap() {
+	t.mci = make(map[string]*TreeEntry)
+	for i := 0; i < len(t.Entries); i++ {
+		name := strings.ToLower(t.Entries[i].Name)
+		if _, ok := t.mci[name]; !ok {
+			t.mci[name] = &t.Entries[i]
+		}
+	}
+}
+
+// TreeObjectIter provides an iterator for a set of trees, like the ones of a
+// storage, see TreeIter for the subtrees of a tree.
+type TreeObjectIter struct {
+	core.ObjectIter
+	r *Repository
+}
+
+// NewTreeObjectIter returns a TreeObjectIter for the given repository and
+// underlying object iterator.
+func NewTreeObjectIter(r *Repository, iter core.ObjectIter) *TreeObjectIter {
+	return &TreeObjectIter{iter, r}
+}
+
+// Next moves the iterator to the next tree and returns a pointer to it. If it
+// has reached the end of the set it will return io.EOF.
+func (iter *TreeObjectIter) Next() (*Tree, error) {
+	obj, err := iter.ObjectIter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{r: iter.r}
+	return tree, tree.Decode(obj)
+}
+
+// ForEach calls cb for each of the remaining trees of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *TreeObjectIter) ForEach(cb func(*Tree) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each tree of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *TreeObjectIter) ForEachContext(ctx context.Context, cb func(*Tree) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		t, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(t); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
 // treeEntryIter facilitates iterating through the TreeEntry objects in a Tree.
 type treeEntryIter struct {
 	t   *Tree
@@ -217,13 +814,13 @@ func (iter *treeEntryIter) Next() (TreeEntry, error) {
 // TreeEntryIter facilitates iterating through the descendent subtrees of a
 // Tree.
 type TreeIter struct {
-	w TreeWalker
+	w *TreeWalker
 }
 
 // NewTreeIter returns a new TreeIter instance
 func NewTreeIter(r *Repository, t *Tree) *TreeIter {
 	return &TreeIter{
-		w: *NewTreeWalker(r, t),
+		w: NewTreeWalker(r, t),
 	}
 }
 
@@ -241,6 +838,45 @@ func (iter *TreeIter) Next() (*Tree, error) {
 	}
 }
 
+// ForEach calls cb for each of the remaining trees of the iterator and then
+// closes it, as FileIter.ForEach does with the files.
+func (iter *TreeIter) ForEach(cb func(*Tree) error) error {
+	return iter.ForEachContext(context.Background(), cb)
+}
+
+// ForEachContext calls cb for each tree of the iterator and closes it, as
+// FileIter.ForEachContext does with the files.
+func (iter *TreeIter) ForEachContext(ctx context.Context, cb func(*Tree) error) error {
+	defer iter.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		t, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(t); err != nil {
+			if err == core.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// Reset makes the iterator start again from the first tree, even if it has
+// been closed.
+func (iter *TreeIter) Reset() {
+	iter.w.Reset()
+}
+
 // Close closes the TreeIter
 func (iter *TreeIter) Close() {
 	iter.w.Close()
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ArchiveFormat is the format of the archives written by Tree.Archive.
+type ArchiveFormat int
+
+const (
+	// Tar is the ustar format, written as git archive --format=tar does.
+	Tar ArchiveFormat = iota
+	// Zip is the zip format, with the files compressed with Deflate.
+	Zip
+)
+
+// ErrUnsupportedArchiveFormat is returned by Tree.Archive for unknown
+// archive formats.
+var ErrUnsupportedArchiveFormat = errors.New("unsupported archive format")
+
+// archiver writes the entries of an archive in one of the formats.
+type archiver interface {
+	writeDir(path string, h core.Hash) error
+	writeFile(path string, h core.Hash, mode os.FileMode, size int64, r io.Reader) error
+	writeSymlink(path string, h core.Hash, target string) error
+	Close() error
+}
+
+// Archive writes the Tree and its subtrees to w as an archive in the given
+// format. The prefix is prepended to the path of every entry, as in git
+// archive --prefix, so it usually ends with a slash; in such case an entry for
+// the prefix directory is written too. The submodules are written as empty
+// directories, and the modification time of every entry is the Unix epoch, or
+// the first time supported by the format, so archives of the same tree are
+// identical. The contents of the blobs are
+// streamed to w, they are never read at once.
+func (t *Tree) Archive(w io.Writer, format ArchiveFormat, prefix string) error {
+	return t.archive(w, format, prefix, time.Unix(0, 0), core.ZeroHash)
+}
+
+// Archive writes the tree of the commit to w like Tree.Archive, using the
+// committer time as the modification time of the entries. The tar archives
+// also record the hash of the commit, in a pax global header, so their
+// contents are the same as the ones written by git archive for the commit;
+// the zip archives record it as their comment.
+func (c *Commit) Archive(w io.Writer, format ArchiveFormat, prefix string) error {
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	return tree.archive(w, format, prefix, c.Committer.When, c.Hash)
+}
+
+func (t *Tree) archive(w io.Writer, format ArchiveFormat, prefix string, mtime time.Time, commit core.Hash) (err error) {
+	var a archiver
+	switch format {
+	case Tar:
+		if a, err = newTarArchiver(w, mtime, commit); err != nil {
+			return err
+		}
+	case Zip:
+		a = newZipArchiver(w, mtime, commit)
+	default:
+		return ErrUnsupportedArchiveFormat
+	}
+	defer checkClose(a, &err)
+
+	if strings.HasSuffix(prefix, "/") {
+		if err := a.writeDir(prefix, t.Hash); err != nil {
+			return err
+		}
+	}
+
+	return t.Walk(func(path string, e TreeEntry) error {
+		path = prefix + path
+		switch {
+		case e.Mode == treeEntryDirMode || isSubmoduleMode(e.Mode):
+			return a.writeDir(path+"/", e.Hash)
+		case isSymlinkMode(e.Mode):
+			return t.archiveSymlink(a, path, e.Hash)
+		default:
+			return t.archiveFile(a, path, e)
+		}
+	})
+}
+
+func (t *Tree) archiveFile(a archiver, path string, e TreeEntry) (err error) {
+	obj, err := t.r.Storage.Get(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+	defer checkClose(r, &err)
+
+	return a.writeFile(path, e.Hash, e.Mode, obj.Size(), r)
+}
+
+func (t *Tree) archiveSymlink(a archiver, path string, h core.Hash) error {
+	obj, err := t.r.Storage.Get(h)
+	if err != nil {
+		return err
+	}
+
+	blob := &Blob{}
+	if err := blob.Decode(obj); err != nil {
+		return err
+	}
+
+	target, err := newFile(path, treeEntrySymlinkMode, blob).ContentsLimited(maxSymlinkTargetLength)
+	if err != nil {
+		return err
+	}
+
+	return a.writeSymlink(path, h, target)
+}
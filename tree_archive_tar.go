@@ -0,0 +1,259 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+const (
+	tarBlockSize  = 512
+	tarRecordSize = 20 * tarBlockSize
+	tarUmask      = 0002
+	tarMaxOctal   = 077777777777 // the max size and mtime of the headers
+
+	tarTypeReg          = '0'
+	tarTypeSymlink      = '2'
+	tarTypeDir          = '5'
+	tarTypeExtHeader    = 'x'
+	tarTypeGlobalHeader = 'g'
+)
+
+// the offsets and lengths of the fields of an ustar header
+const (
+	tarName      = 0
+	tarNameLen   = 100
+	tarMode      = 100
+	tarUID       = 108
+	tarGID       = 116
+	tarSize      = 124
+	tarMtime     = 136
+	tarChksum    = 148
+	tarTypeflag  = 156
+	tarLinkname  = 157
+	tarMagic     = 257
+	tarVersion   = 263
+	tarUname     = 265
+	tarGname     = 297
+	tarDevmajor  = 329
+	tarDevminor  = 337
+	tarPrefix    = 345
+	tarPrefixLen = 155
+)
+
+// tarArchiver writes ustar archives with the same layout as git archive:
+// the entries are owned by root, their permissions are masked with the
+// default tar.umask of git, and pax extended headers are only used for the
+// names, link targets and sizes that do not fit in the ustar headers.
+type tarArchiver struct {
+	w     io.Writer
+	mtime int64
+	n     int64 // the number of bytes written
+}
+
+func newTarArchiver(w io.Writer, mtime time.Time, commit core.Hash) (*tarArchiver, error) {
+	a := &tarArchiver{w: w, mtime: mtime.Unix()}
+	if a.mtime < 0 {
+		a.mtime = 0
+	}
+
+	var ext []byte
+	if commit != core.ZeroHash {
+		ext = appendPaxRecord(ext, "comment", commit.String())
+	}
+
+	if a.mtime > tarMaxOctal {
+		ext = appendPaxRecord(ext, "mtime", strconv.FormatInt(a.mtime, 10))
+		a.mtime = tarMaxOctal
+	}
+
+	if len(ext) == 0 {
+		return a, nil
+	}
+
+	hdr := a.header(tarTypeGlobalHeader, 0100666, int64(len(ext)))
+	copy(hdr[tarName:], "pax_global_header")
+
+	return a, a.writeBlocks(hdr, ext)
+}
+
+func (a *tarArchiver) writeDir(path string, h core.Hash) error {
+	var ext []byte
+	hdr := a.header(tarTypeDir, (treeEntryDirMode|0777)&^tarUmask, 0)
+	ext = a.setName(hdr, ext, path, h)
+
+	return a.writeEntry(hdr, ext, h)
+}
+
+func (a *tarArchiver) writeFile(path string, h core.Hash, mode os.FileMode, size int64, r io.Reader) error {
+	perm := os.FileMode(0666)
+	if mode&0100 != 0 {
+		perm = 0777
+	}
+
+	var ext []byte
+	headerSize := size
+	if size > tarMaxOctal {
+		ext = appendPaxRecord(ext, "size", strconv.FormatInt(size, 10))
+		headerSize = 0
+	}
+
+	hdr := a.header(tarTypeReg, (mode|perm)&^tarUmask, headerSize)
+	ext = a.setName(hdr, ext, path, h)
+	if err := a.writeEntry(hdr, ext, h); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(a.w, r, size); err != nil {
+		return err
+	}
+	a.n += size
+
+	return a.pad()
+}
+
+func (a *tarArchiver) writeSymlink(path string, h core.Hash, target string) error {
+	var ext []byte
+	hdr := a.header(tarTypeSymlink, treeEntrySymlinkMode|0777, 0)
+	ext = a.setName(hdr, ext, path, h)
+	if len(target) > tarNameLen {
+		copy(hdr[tarLinkname:], fmt.Sprintf("see %s.paxheader", h))
+		ext = appendPaxRecord(ext, "linkpath", target)
+	} else {
+		copy(hdr[tarLinkname:], target)
+	}
+
+	return a.writeEntry(hdr, ext, h)
+}
+
+// Close writes the end of the archive, at least two zeroed blocks, up to the
+// end of the current record.
+func (a *tarArchiver) Close() error {
+	end := (a.n + 2*tarBlockSize + tarRecordSize - 1) / tarRecordSize * tarRecordSize
+	_, err := a.w.Write(make([]byte, end-a.n))
+	return err
+}
+
+// header returns an ustar header, still without its name, for an entry of
+// the given type, the mode is the mode of the tree entry with its
+// permissions already adjusted.
+func (a *tarArchiver) header(typeflag byte, mode os.FileMode, size int64) []byte {
+	hdr := make([]byte, tarBlockSize)
+	hdr[tarTypeflag] = typeflag
+	copy(hdr[tarMode:], fmt.Sprintf("%07o", uint32(mode&07777)))
+	copy(hdr[tarUID:], fmt.Sprintf("%07o", 0))
+	copy(hdr[tarGID:], fmt.Sprintf("%07o", 0))
+	copy(hdr[tarSize:], fmt.Sprintf("%011o", size))
+	copy(hdr[tarMtime:], fmt.Sprintf("%011o", a.mtime))
+	copy(hdr[tarMagic:], "ustar\x00")
+	copy(hdr[tarVersion:], "00")
+	copy(hdr[tarUname:], "root")
+	copy(hdr[tarGname:], "root")
+	copy(hdr[tarDevmajor:], fmt.Sprintf("%07o", 0))
+	copy(hdr[tarDevminor:], fmt.Sprintf("%07o", 0))
+
+	return hdr
+}
+
+// setName sets the path of an entry in its header, splitting it between the
+// name and prefix fields if it is too long, or adding it to the extended
+// header ext if it does not fit there either.
+func (a *tarArchiver) setName(hdr, ext []byte, path string, h core.Hash) []byte {
+	if len(path) <= tarNameLen {
+		copy(hdr[tarName:], path)
+		return ext
+	}
+
+	i := len(path)
+	if i > 1 && path[i-1] == '/' {
+		i--
+	}
+	if i > tarPrefixLen {
+		i = tarPrefixLen
+	}
+	for i--; i > 0 && path[i] != '/'; i-- {
+	}
+
+	if i > 0 && len(path)-i-1 <= tarNameLen {
+		copy(hdr[tarPrefix:], path[:i])
+		copy(hdr[tarName:], path[i+1:])
+		return ext
+	}
+
+	copy(hdr[tarName:], fmt.Sprintf("%s.data", h))
+	return appendPaxRecord(ext, "path", path)
+}
+
+// writeEntry writes the header of an entry, preceded by an extended header
+// with the records in ext, if any, named after the hash of the entry.
+func (a *tarArchiver) writeEntry(hdr, ext []byte, h core.Hash) error {
+	if len(ext) != 0 {
+		extHdr := a.header(tarTypeExtHeader, 0100666, int64(len(ext)))
+		copy(extHdr[tarName:], fmt.Sprintf("%s.paxheader", h))
+		if err := a.writeBlocks(extHdr, ext); err != nil {
+			return err
+		}
+	}
+
+	return a.writeBlocks(hdr, nil)
+}
+
+// writeBlocks writes a header, after computing its checksum, and the given
+// data padded to a whole number of blocks.
+func (a *tarArchiver) writeBlocks(hdr, data []byte) error {
+	setTarChecksum(hdr)
+	if err := a.write(hdr); err != nil {
+		return err
+	}
+
+	if err := a.write(data); err != nil {
+		return err
+	}
+
+	return a.pad()
+}
+
+func (a *tarArchiver) write(b []byte) error {
+	n, err := a.w.Write(b)
+	a.n += int64(n)
+	return err
+}
+
+// pad writes zeros up to the end of the current block.
+func (a *tarArchiver) pad() error {
+	if a.n%tarBlockSize == 0 {
+		return nil
+	}
+
+	return a.write(make([]byte, tarBlockSize-a.n%tarBlockSize))
+}
+
+// setTarChecksum sets the checksum of a header, the sum of all its bytes
+// taking the ones of the checksum field as spaces.
+func setTarChecksum(hdr []byte) {
+	var sum int64
+	for i, b := range hdr {
+		if i >= tarChksum && i < tarChksum+8 {
+			b = ' '
+		}
+
+		sum += int64(b)
+	}
+
+	copy(hdr[tarChksum:], fmt.Sprintf("%07o\x00", sum))
+}
+
+// appendPaxRecord appends a record to a pax extended header, the record
+// starts with its length in decimal, counting the length itself.
+func appendPaxRecord(ext []byte, key, value string) []byte {
+	n := len(key) + len(value) + 4
+	for l := 1; n/10 >= l; l *= 10 {
+		n++
+	}
+
+	return append(ext, fmt.Sprintf("%d %s=%s\n", n, key, value)...)
+}
@@ -0,0 +1,240 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeArchive struct{}
+
+var _ = Suite(&SuiteTreeArchive{})
+
+// newArchiveCommit returns a commit with regular and executable files, short
+// and long symbolic links, a submodule and paths too long for the ustar
+// headers, the same as the one created with git in a repository initialized
+// with the following commands:
+//
+//	echo foo > foo
+//	printf '#!/bin/sh\n' > run && chmod +x run
+//	ln -s foo link && ln -s $(printf 'x%.0s' $(seq 1 120)) longlink
+//	D=$(printf 'd%.0s' $(seq 1 60))/$(printf 'e%.0s' $(seq 1 60))
+//	mkdir -p $D && echo deep > $D/f
+//	echo long > $(printf 'n%.0s' $(seq 1 120))
+//	git add -A
+//	git update-index --add --cacheinfo 160000,d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b,module
+//	export GIT_AUTHOR_DATE="1500000000 +0200" GIT_COMMITTER_DATE="1500000000 +0200"
+//	git -c user.name=A -c user.email=a@example.com commit -m test
+func newArchiveCommit(c *C) *Commit {
+	r := NewPlainRepository()
+	e := newTestTree(c, r, TreeEntry{Name: "f", Mode: 0100644, Hash: newTestBlob(c, r, "deep\n")})
+	d := newTestTree(c, r, TreeEntry{Name: strings.Repeat("e", 60), Mode: 040000, Hash: e.Hash})
+	tree := newTestTree(c, r,
+		TreeEntry{Name: strings.Repeat("d", 60), Mode: 040000, Hash: d.Hash},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: newTestBlob(c, r, "foo\n")},
+		TreeEntry{Name: "link", Mode: 0120000, Hash: newTestBlob(c, r, "foo")},
+		TreeEntry{Name: "longlink", Mode: 0120000, Hash: newTestBlob(c, r, strings.Repeat("x", 120))},
+		TreeEntry{Name: "module", Mode: 0160000, Hash: core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b")},
+		TreeEntry{Name: strings.Repeat("n", 120), Mode: 0100644, Hash: newTestBlob(c, r, "long\n")},
+		TreeEntry{Name: "run", Mode: 0100755, Hash: newTestBlob(c, r, "#!/bin/sh\n")},
+	)
+	c.Assert(tree.Hash.String(), Equals, "2c57cf436741beac84b2b90a6a069ce9663141f4")
+
+	content := fmt.Sprintf("tree %s\n"+
+		"author A <a@example.com> 1500000000 +0200\n"+
+		"committer A <a@example.com> 1500000000 +0200\n"+
+		"\n"+
+		"test\n", tree.Hash)
+	h, err := r.Storage.Set(memory.NewObject(core.CommitObject, int64(len(content)), []byte(content)))
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "d7a6a5796b34ee50a92b29b1d2dc6c72c745af84")
+
+	commit, err := r.Commit(h)
+	c.Assert(err, IsNil)
+
+	return commit
+}
+
+// the expected hashes have been obtained with git archive --format=tar
+func (s *SuiteTreeArchive) TestArchiveTarMatchesGit(c *C) {
+	commit := newArchiveCommit(c)
+	fixture := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	head, err := fixture.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		commit *Commit
+		prefix string
+		hash   string
+	}{
+		{commit, "", "a9e784b845413d7977ec7be4e0fed7731716d7e6"},
+		{commit, "p/", "e59ff5e062458e4bcec5c0d916dc3ee764d08a0d"},
+		{commit, "x", "a63de0a2bc161c0b8dfd32507b3bf364e3097f99"},
+		{head, "", "18ae84d47b3fab3a8be3171e749e2ec5775f063e"},
+		{head, "p/", "fc8b2721418cf2127d4ffcc952cb6ac46ce9dc4d"},
+	} {
+		h := sha1.New()
+		c.Assert(t.commit.Archive(h, Tar, t.prefix), IsNil)
+		c.Assert(fmt.Sprintf("%x", h.Sum(nil)), Equals, t.hash,
+			Commentf("commit=%s, prefix=%q", t.commit.Hash, t.prefix))
+	}
+}
+
+func (s *SuiteTreeArchive) TestArchiveTarContents(c *C) {
+	tree, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	c.Assert(tree.CheckoutWithOptions(dir, CheckoutOptions{}), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(tree.Archive(&buf, Tar, "p/"), IsNil)
+
+	var count int
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		c.Assert(hdr.ModTime.Unix(), Equals, int64(0))
+		c.Assert(strings.HasPrefix(hdr.Name, "p/"), Equals, true)
+		count++
+
+		path := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(hdr.Name, "p/")))
+		fi, err := os.Lstat(path)
+		c.Assert(err, IsNil, Commentf("name=%s", hdr.Name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			c.Assert(fi.IsDir(), Equals, true)
+			c.Assert(hdr.Mode, Equals, int64(0775))
+		case tar.TypeSymlink:
+			target, err := os.Readlink(path)
+			c.Assert(err, IsNil)
+			c.Assert(hdr.Linkname, Equals, target)
+		case tar.TypeReg:
+			c.Assert(hdr.Mode&0100 != 0, Equals, fi.Mode()&0100 != 0, Commentf("name=%s", hdr.Name))
+
+			expected, err := ioutil.ReadFile(path)
+			c.Assert(err, IsNil)
+			obtained, err := ioutil.ReadAll(tr)
+			c.Assert(err, IsNil)
+			c.Assert(string(obtained), Equals, string(expected), Commentf("name=%s", hdr.Name))
+		default:
+			c.Fatalf("unexpected type %q for %s", hdr.Typeflag, hdr.Name)
+		}
+	}
+
+	// p/, 3 directories, 4 files and 2 symbolic links
+	c.Assert(count, Equals, 10)
+}
+
+func (s *SuiteTreeArchive) TestArchiveZip(c *C) {
+	commit := newArchiveCommit(c)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(commit.Archive(&buf, Zip, "p/"), IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, commit.Hash.String())
+
+	d := strings.Repeat("d", 60)
+	e := strings.Repeat("e", 60)
+	n := strings.Repeat("n", 120)
+	expected := []struct {
+		name    string
+		mode    os.FileMode
+		content string
+	}{
+		{"p/", os.ModeDir | 0755, ""},
+		{"p/" + d + "/", os.ModeDir | 0755, ""},
+		{"p/" + d + "/" + e + "/", os.ModeDir | 0755, ""},
+		{"p/" + d + "/" + e + "/f", 0644, "deep\n"},
+		{"p/foo", 0644, "foo\n"},
+		{"p/link", os.ModeSymlink | 0777, "foo"},
+		{"p/longlink", os.ModeSymlink | 0777, strings.Repeat("x", 120)},
+		{"p/module/", os.ModeDir | 0755, ""},
+		{"p/" + n, 0644, "long\n"},
+		{"p/run", 0755, "#!/bin/sh\n"},
+	}
+
+	c.Assert(zr.File, HasLen, len(expected))
+	for i, f := range zr.File {
+		com := Commentf("name=%s", f.Name)
+		c.Assert(f.Name, Equals, expected[i].name, com)
+		c.Assert(f.Mode(), Equals, expected[i].mode, com)
+		c.Assert(f.Modified.Equal(commit.Committer.When), Equals, true, com)
+
+		r, err := f.Open()
+		c.Assert(err, IsNil, com)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil, com)
+		c.Assert(r.Close(), IsNil, com)
+		c.Assert(string(content), Equals, expected[i].content, com)
+	}
+
+	// the archives of the same tree are identical
+	var treeZip, otherZip bytes.Buffer
+	c.Assert(tree.Archive(&treeZip, Zip, "p/"), IsNil)
+	other, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+	c.Assert(other.Archive(&otherZip, Zip, "p/"), IsNil)
+	c.Assert(treeZip.Bytes(), DeepEquals, otherZip.Bytes())
+}
+
+func (s *SuiteTreeArchive) TestArchiveZipDeflate(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(commit.Archive(&buf, Zip, ""), IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		c.Assert(f.Method, Equals, zip.Deflate)
+		file, err := commit.File(f.Name)
+		c.Assert(err, IsNil)
+		expected, err := file.Contents()
+		c.Assert(err, IsNil)
+
+		r, err := f.Open()
+		c.Assert(err, IsNil)
+		obtained, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(r.Close(), IsNil)
+		c.Assert(string(obtained), Equals, expected, Commentf("name=%s", f.Name))
+	}
+}
+
+func (s *SuiteTreeArchive) TestArchiveUnsupportedFormat(c *C) {
+	tree, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(tree.Archive(&buf, ArchiveFormat(-1), ""), Equals, ErrUnsupportedArchiveFormat)
+	c.Assert(buf.Len(), Equals, 0)
+}
@@ -0,0 +1,82 @@
+package git
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// zipMinTime is the first time that can be stored in the zip headers.
+var zipMinTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// zipArchiver writes zip archives with Unix permissions in the external
+// attributes of the entries, so executables and symbolic links are restored
+// by unzip. Nothing depending on the time of writing is recorded, so the
+// archives of the same tree are byte identical.
+type zipArchiver struct {
+	w     *zip.Writer
+	mtime time.Time
+}
+
+func newZipArchiver(w io.Writer, mtime time.Time, commit core.Hash) *zipArchiver {
+	a := &zipArchiver{w: zip.NewWriter(w), mtime: mtime.UTC()}
+	if a.mtime.Before(zipMinTime) {
+		a.mtime = zipMinTime
+	}
+
+	if commit != core.ZeroHash {
+		a.w.SetComment(commit.String())
+	}
+
+	return a
+}
+
+func (a *zipArchiver) writeDir(path string, h core.Hash) error {
+	_, err := a.create(path, os.ModeDir|0755, zip.Store)
+	return err
+}
+
+func (a *zipArchiver) writeFile(path string, h core.Hash, mode os.FileMode, size int64, r io.Reader) error {
+	perm := os.FileMode(0644)
+	if mode&0100 != 0 {
+		perm = 0755
+	}
+
+	w, err := a.create(path, perm, zip.Deflate)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, r, size)
+	return err
+}
+
+func (a *zipArchiver) writeSymlink(path string, h core.Hash, target string) error {
+	w, err := a.create(path, os.ModeSymlink|0777, zip.Store)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, strings.NewReader(target))
+	return err
+}
+
+func (a *zipArchiver) create(path string, mode os.FileMode, method uint16) (io.Writer, error) {
+	hdr := &zip.FileHeader{
+		Name:     path,
+		Method:   method,
+		Modified: a.mtime,
+	}
+	hdr.SetMode(mode)
+
+	return a.w.CreateHeader(hdr)
+}
+
+// Close writes the central directory of the archive.
+func (a *zipArchiver) Close() error {
+	return a.w.Close()
+}
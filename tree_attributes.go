@@ -0,0 +1,339 @@
+package git
+
+import (
+	"bufio"
+	"path"
+	"strings"
+)
+
+const (
+	gitattributesFile = ".gitattributes"
+	attrMacroPrefix   = "[attr]"
+)
+
+// Attrs are the gitattributes of a path, by name. Only the attributes set,
+// unset or with a value are present, the unspecified ones are not.
+type Attrs map[string]Attr
+
+// Attr is the state of an attribute, Set is false for the unset attributes,
+// the ones prefixed by "-", and Value holds the value of the attributes
+// assigned with "=".
+type Attr struct {
+	Set   bool
+	Value string
+}
+
+// IsBinary reports whether the binary attribute is set, which also unsets
+// the text, diff and merge attributes.
+func (a Attrs) IsBinary() bool {
+	return a["binary"].Set
+}
+
+// EOL returns the value of the eol attribute, "lf", "crlf" or "" if it is
+// not specified.
+func (a Attrs) EOL() string {
+	return a["eol"].Value
+}
+
+// Attributes resolves the gitattributes of the paths of a tree from the
+// .gitattributes files found in the tree, following the precedence rules of
+// git: the files in deeper directories override the ones in their parents,
+// and the later lines of a file override the earlier ones. The macros are
+// only defined by the .gitattributes file of the root of the tree, besides
+// the builtin binary macro. The files are read once, when first needed.
+type Attributes struct {
+	t      *Tree
+	macros map[string][]attrAssignment
+	rules  map[string][]attrRule // the rules of each directory
+}
+
+type attrAssignment struct {
+	name  string
+	state *Attr // nil for the unspecified attributes, the ones with "!"
+}
+
+type attrRule struct {
+	pattern     string
+	parts       []string // the components of the pattern, if it has slashes
+	assignments []attrAssignment
+}
+
+// NewAttributes returns the Attributes of a tree.
+func NewAttributes(t *Tree) *Attributes {
+	return &Attributes{
+		t: t,
+		macros: map[string][]attrAssignment{
+			"binary": parseAttrAssignments([]string{"-diff", "-merge", "-text"}),
+		},
+		rules: make(map[string][]attrRule, 0),
+	}
+}
+
+// Attributes returns the gitattributes of the file at the given path of the
+// tree, see the Attributes type for the details.
+func (t *Tree) Attributes(path string) (Attrs, error) {
+	return NewAttributes(t).Attrs(path)
+}
+
+// Attrs returns the gitattributes of the file at the given path, relative to
+// the tree of the Attributes. The file does not need to exist in the tree.
+func (a *Attributes) Attrs(path string) (Attrs, error) {
+	names, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the .gitattributes of the root first, as it defines the macros
+	dirs := make([][]attrRule, len(names))
+	for i := range names {
+		if dirs[i], err = a.dirRules(strings.Join(names[:i], "/")); err != nil {
+			return nil, err
+		}
+	}
+
+	// the rules are applied from the highest precedence to the lowest one,
+	// every attribute keeps the first state assigned to it
+	assigned := make(map[string]*Attr, 0)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel := names[i:]
+		for j := len(dirs[i]) - 1; j >= 0; j-- {
+			if r := &dirs[i][j]; r.match(rel) {
+				a.assign(assigned, r.assignments)
+			}
+		}
+	}
+
+	attrs := make(Attrs, 0)
+	for name, state := range assigned {
+		if state != nil {
+			attrs[name] = *state
+		}
+	}
+
+	return attrs, nil
+}
+
+// assign assigns the attributes not yet assigned, from the last one to the
+// first one, expanding the macros set.
+func (a *Attributes) assign(assigned map[string]*Attr, assignments []attrAssignment) {
+	for i := len(assignments) - 1; i >= 0; i-- {
+		as := assignments[i]
+		if _, ok := assigned[as.name]; ok {
+			continue
+		}
+
+		assigned[as.name] = as.state
+		if macro, ok := a.macros[as.name]; ok && as.state != nil && as.state.Set && as.state.Value == "" {
+			a.assign(assigned, macro)
+		}
+	}
+}
+
+// dirRules returns the rules of the .gitattributes file of a directory, dir
+// is empty for the root of the tree.
+func (a *Attributes) dirRules(dir string) ([]attrRule, error) {
+	if rules, ok := a.rules[dir]; ok {
+		return rules, nil
+	}
+
+	content, err := a.readFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := a.parse(content, dir == "")
+	a.rules[dir] = rules
+
+	return rules, nil
+}
+
+func (a *Attributes) readFile(dir string) (string, error) {
+	tree := a.t
+	if dir != "" {
+		var err error
+		if tree, err = a.t.Tree(dir); err != nil {
+			if err == ErrEntryNotFound || err == ErrDirectoryNotFound {
+				return "", nil
+			}
+
+			return "", err
+		}
+	}
+
+	e, err := tree.entry(gitattributesFile)
+	if err == ErrEntryNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if e.Mode&^0777 != treeEntryRegularType {
+		return "", nil // a directory, symbolic link or submodule
+	}
+
+	f, err := tree.file(gitattributesFile, e)
+	if err != nil {
+		return "", err
+	}
+
+	return f.Contents()
+}
+
+// parse returns the rules of a .gitattributes file, defining its macros if
+// macros is true. The malformed lines and the negative patterns, which are
+// forbidden, are ignored, like the macros out of the root of the tree.
+func (a *Attributes) parse(content string, macros bool) []attrRule {
+	var rules []attrRule
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pattern := fields[0]
+		assignments := parseAttrAssignments(fields[1:])
+		switch {
+		case strings.HasPrefix(pattern, attrMacroPrefix):
+			if macros {
+				a.macros[strings.TrimPrefix(pattern, attrMacroPrefix)] = assignments
+			}
+		case strings.HasPrefix(pattern, "!"):
+		case strings.HasSuffix(pattern, "/"):
+			// only matches directories, the attributes are not inherited
+		default:
+			rules = append(rules, newAttrRule(pattern, assignments))
+		}
+	}
+
+	return rules
+}
+
+func parseAttrAssignments(fields []string) []attrAssignment {
+	var assignments []attrAssignment
+	for _, f := range fields {
+		as := attrAssignment{name: f}
+		switch {
+		case strings.HasPrefix(f, "-"):
+			as.name = f[1:]
+			as.state = &Attr{}
+		case strings.HasPrefix(f, "!"):
+			as.name = f[1:]
+		default:
+			as.state = &Attr{Set: true}
+			if i := strings.IndexByte(f, '='); i >= 0 {
+				as.name, as.state.Value = f[:i], f[i+1:]
+			}
+		}
+
+		if as.name != "" {
+			assignments = append(assignments, as)
+		}
+	}
+
+	return assignments
+}
+
+func newAttrRule(pattern string, assignments []attrAssignment) attrRule {
+	// path.Match negates the character classes with "^", git with "!" too
+	pattern = strings.Replace(pattern, "[!", "[^", -1)
+	r := attrRule{pattern: pattern, assignments: assignments}
+	if strings.Contains(pattern, "/") {
+		r.parts, _ = splitGlob(strings.TrimPrefix(pattern, "/"))
+	}
+
+	return r
+}
+
+// match reports whether the rule matches a path, given by its components
+// relative to the directory of the rule. The patterns without slashes match
+// the base name of the path, the rest the whole path.
+func (r *attrRule) match(names []string) bool {
+	if r.parts == nil {
+		ok, _ := path.Match(r.pattern, names[len(names)-1])
+		return ok
+	}
+
+	return matchGlob(r.parts, names)
+}
+
+// convertEOL converts the end of lines of the contents of a file as git does
+// when writing it to the working tree, with core.eol and core.autocrlf unset:
+// the lone LFs are converted to CRLF if the eol attribute is crlf, unless the
+// text attribute is unset. The text files are written with the native end of
+// lines otherwise, which are always LF here. With text=auto, the contents
+// that look binary or already have any CR are not converted.
+func convertEOL(content string, attrs Attrs) string {
+	text, ok := attrs["text"]
+	if ok && !text.Set || attrs.EOL() != "crlf" {
+		return content
+	}
+
+	s := newTextStats(content)
+	if s.lonelf == 0 {
+		return content
+	}
+
+	if text.Value == "auto" && (s.lonecr != 0 || s.crlf != 0 || s.isBinary()) {
+		return content
+	}
+
+	buf := make([]byte, 0, len(content)+s.lonelf)
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' && (i == 0 || content[i-1] != '\r') {
+			buf = append(buf, '\r')
+		}
+
+		buf = append(buf, content[i])
+	}
+
+	return string(buf)
+}
+
+// textStats are the statistics of the contents of a file used by git to
+// guess if it is binary, see gather_stats in git's convert.c.
+type textStats struct {
+	lonecr, lonelf, crlf    int
+	nul                     int
+	printable, nonprintable int
+}
+
+func newTextStats(content string) textStats {
+	var s textStats
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				s.crlf++
+				i++
+			} else {
+				s.lonecr++
+			}
+		case c == '\n':
+			s.lonelf++
+		case c == 127:
+			s.nonprintable++
+		case c == '\b', c == '\t', c == '\033', c == '\014':
+			s.printable++
+		case c == 0:
+			s.nul++
+			s.nonprintable++
+		case c < 32:
+			s.nonprintable++
+		default:
+			s.printable++
+		}
+	}
+
+	// a trailing EOF character is not taken as non printable
+	if strings.HasSuffix(content, "\032") {
+		s.nonprintable--
+	}
+
+	return s
+}
+
+func (s textStats) isBinary() bool {
+	return s.lonecr != 0 || s.nul != 0 || s.printable>>7 < s.nonprintable
+}
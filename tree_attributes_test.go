@@ -0,0 +1,147 @@
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeAttributes struct{}
+
+var _ = Suite(&SuiteTreeAttributes{})
+
+const (
+	testRootAttributes = "# comment\n" +
+		"*.txt text -diff\n" +
+		"*.bat text eol=crlf\n" +
+		"*.png binary\n" +
+		"*.sh eol=lf\n" +
+		"docs/*.md text=auto\n" +
+		"[attr]mymacro -text diff=foo\n" +
+		"*.mac mymacro\n" +
+		"/root.only -diff\n" +
+		"a.txt diff\n"
+
+	testSubAttributes = "*.txt -text\n" +
+		"*.bat !eol\n" +
+		"deep/**/x.c text eol=crlf\n" +
+		"*.png -binary\n" +
+		"*.mac text\n" +
+		"[attr]mymacro text\n"
+)
+
+// the expected attributes have been obtained with git check-attr -a
+func (s *SuiteTreeAttributes) TestAttributes(c *C) {
+	r := NewPlainRepository()
+	sub := newTestTree(c, r,
+		TreeEntry{Name: ".gitattributes", Mode: 0100644, Hash: newTestBlob(c, r, testSubAttributes)},
+	)
+	tree := newTestTree(c, r,
+		TreeEntry{Name: ".gitattributes", Mode: 0100644, Hash: newTestBlob(c, r, testRootAttributes)},
+		TreeEntry{Name: "docs", Mode: 0100644, Hash: newTestBlob(c, r, "not a directory")},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+
+	set := Attr{Set: true}
+	unset := Attr{}
+	for _, t := range []struct {
+		path  string
+		attrs Attrs
+	}{
+		{"a.txt", Attrs{"diff": set, "text": set}},
+		{"b.txt", Attrs{"diff": unset, "text": set}},
+		{"x.bat", Attrs{"text": set, "eol": {Set: true, Value: "crlf"}}},
+		{"i.png", Attrs{"binary": set, "diff": unset, "merge": unset, "text": unset}},
+		{"run.sh", Attrs{"eol": {Set: true, Value: "lf"}}},
+		{"docs/r.md", Attrs{"text": {Set: true, Value: "auto"}}},
+		{"docs/sub/r.md", Attrs{}},
+		{"x.mac", Attrs{"diff": {Set: true, Value: "foo"}, "text": unset, "mymacro": set}},
+		{"root.only", Attrs{"diff": unset}},
+		{"/sub//a.txt", Attrs{"diff": set, "text": unset}},
+		{"sub/x.bat", Attrs{"text": set}},
+		{"sub/i.png", Attrs{"binary": unset}},
+		{"sub/root.only", Attrs{}},
+		{"sub/x.mac", Attrs{"diff": {Set: true, Value: "foo"}, "text": set, "mymacro": set}},
+		{"sub/deep/x.c", Attrs{"text": set, "eol": {Set: true, Value: "crlf"}}},
+		{"sub/deep/a/x.c", Attrs{"text": set, "eol": {Set: true, Value: "crlf"}}},
+		{"sub/x.c", Attrs{}},
+		{"sub/run.sh", Attrs{"eol": {Set: true, Value: "lf"}}},
+	} {
+		attrs, err := tree.Attributes(t.path)
+		c.Assert(err, IsNil)
+		c.Assert(attrs, DeepEquals, t.attrs, Commentf("path=%s", t.path))
+	}
+
+	attrs, err := tree.Attributes("i.png")
+	c.Assert(err, IsNil)
+	c.Assert(attrs.IsBinary(), Equals, true)
+	c.Assert(attrs.EOL(), Equals, "")
+
+	_, err = tree.Attributes("..")
+	c.Assert(err, Equals, ErrInvalidPath)
+}
+
+func (s *SuiteTreeAttributes) TestAttributesNoFile(c *C) {
+	r := NewPlainRepository()
+	tree := newTestTree(c, r,
+		TreeEntry{Name: ".gitattributes", Mode: 0120000, Hash: newTestBlob(c, r, "* text")},
+	)
+
+	attrs, err := tree.Attributes("foo")
+	c.Assert(err, IsNil)
+	c.Assert(attrs, HasLen, 0)
+}
+
+// the expected contents have been obtained with git checkout
+func (s *SuiteTreeAttributes) TestContentsWithAttrs(c *C) {
+	r := NewPlainRepository()
+	files := []struct {
+		name, content, expected string
+	}{
+		{"x.bat", "a\nb\r\nc\n", "a\r\nb\r\nc\r\n"},
+		{"y.crlf", "a\n", "a\r\n"},
+		{"m.auto", "a\r\nb\n", "a\r\nb\n"},
+		{"t.auto", "a\nb\n", "a\r\nb\r\n"},
+		{"z.auto", "a\x00\n", "a\x00\n"},
+		{"n.bin", "a\n", "a\n"},
+		{"p.txt", "a\n", "a\n"},
+	}
+
+	entries := []TreeEntry{{Name: ".gitattributes", Mode: 0100644, Hash: newTestBlob(c, r,
+		"*.bat text eol=crlf\n*.crlf eol=crlf\n*.auto text=auto eol=crlf\n*.bin -text eol=crlf\n")}}
+	for _, f := range files {
+		entries = append(entries, TreeEntry{Name: f.name, Mode: 0100644, Hash: newTestBlob(c, r, f.content)})
+	}
+	tree := newTestTree(c, r, entries...)
+
+	dir := c.MkDir()
+	c.Assert(tree.CheckoutWithOptions(dir, CheckoutOptions{Attributes: true}), IsNil)
+
+	for _, f := range files {
+		com := Commentf("name=%s", f.name)
+		attrs, err := tree.Attributes(f.name)
+		c.Assert(err, IsNil, com)
+		file, err := tree.File(f.name)
+		c.Assert(err, IsNil, com)
+
+		content, err := file.ContentsWithAttrs(attrs)
+		c.Assert(err, IsNil, com)
+		c.Assert(content, Equals, f.expected, com)
+
+		content, err = file.Contents()
+		c.Assert(err, IsNil, com)
+		c.Assert(content, Equals, f.content, com)
+
+		written, err := ioutil.ReadFile(filepath.Join(dir, f.name))
+		c.Assert(err, IsNil, com)
+		c.Assert(string(written), Equals, f.expected, com)
+	}
+
+	// the conversions are opt-in
+	dir = c.MkDir()
+	c.Assert(tree.CheckoutWithOptions(dir, CheckoutOptions{}), IsNil)
+	written, err := ioutil.ReadFile(filepath.Join(dir, "x.bat"))
+	c.Assert(err, IsNil)
+	c.Assert(string(written), Equals, "a\nb\r\nc\n")
+}
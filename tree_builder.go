@@ -0,0 +1,135 @@
+package git
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+// TreeBuilder builds new trees, including all their subtrees, from a set of
+// paths. The trees are written with Tree.Encode, so the resulting hashes
+// match the ones of the same trees written by git.
+type TreeBuilder struct {
+	root *treeBuilderNode
+}
+
+// treeBuilderNode is an entry of a tree being built, a directory if
+// children is not nil, a leaf with the given hash and mode otherwise.
+type treeBuilderNode struct {
+	mode     os.FileMode
+	hash     core.Hash
+	children map[string]*treeBuilderNode
+}
+
+func newTreeBuilderDir() *treeBuilderNode {
+	return &treeBuilderNode{
+		mode:     treeEntryDirMode,
+		children: make(map[string]*treeBuilderNode, 0),
+	}
+}
+
+// NewTreeBuilder returns a new empty TreeBuilder.
+func NewTreeBuilder() *TreeBuilder {
+	return &TreeBuilder{root: newTreeBuilderDir()}
+}
+
+// Insert adds an entry with the given hash and mode at the given slash
+// separated path, creating the intermediate directories when needed. Any
+// existing entry at the path is replaced, as are the entries that are not
+// directories found in the middle of the path.
+func (b *TreeBuilder) Insert(p string, hash core.Hash, mode os.FileMode) {
+	parts := splitTreeBuilderPath(p)
+	if len(parts) == 0 {
+		return
+	}
+
+	dir := b.root
+	for _, name := range parts[:len(parts)-1] {
+		child, ok := dir.children[name]
+		if !ok || child.children == nil {
+			child = newTreeBuilderDir()
+			dir.children[name] = child
+		}
+
+		dir = child
+	}
+
+	dir.children[parts[len(parts)-1]] = &treeBuilderNode{mode: mode, hash: hash}
+}
+
+// Remove deletes the entry at the given path, a file or a whole directory.
+// The directories left empty are removed as well, since git does not store
+// empty trees. Removing a path that does not exist does nothing.
+func (b *TreeBuilder) Remove(p string) {
+	parts := splitTreeBuilderPath(p)
+	if len(parts) == 0 {
+		return
+	}
+
+	b.root.remove(parts)
+}
+
+func (n *treeBuilderNode) remove(parts []string) {
+	child, ok := n.children[parts[0]]
+	if !ok {
+		return
+	}
+
+	if len(parts) > 1 {
+		if child.children == nil {
+			return
+		}
+
+		child.remove(parts[1:])
+		if len(child.children) != 0 {
+			return
+		}
+	}
+
+	delete(n.children, parts[0])
+}
+
+// Write stores in s the tree and all its subtrees and returns the hash of
+// the root tree.
+func (b *TreeBuilder) Write(s core.ObjectStorage) (core.Hash, error) {
+	return b.root.write(s)
+}
+
+func (n *treeBuilderNode) write(s core.ObjectStorage) (core.Hash, error) {
+	t := &Tree{}
+	for name, child := range n.children {
+		hash := child.hash
+		if child.children != nil {
+			var err error
+			if hash, err = child.write(s); err != nil {
+				return core.ZeroHash, err
+			}
+		}
+
+		t.Entries = append(t.Entries, TreeEntry{
+			Name: name,
+			Mode: child.mode,
+			Hash: hash,
+		})
+	}
+
+	obj := &memory.Object{}
+	obj.SetFormat(core.ObjectStorageFormat(s))
+	if err := t.Encode(obj); err != nil {
+		return core.ZeroHash, err
+	}
+
+	return s.Set(obj)
+}
+
+func splitTreeBuilderPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"os"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+
+	. "gopkg.in/check.v1"
+)
+
+type TreeBuilderSuite struct{}
+
+var _ = Suite(&TreeBuilderSuite{})
+
+// the hashes have been obtained from a repository created with git
+var treeBuilderFixture = []struct {
+	path string
+	hash string
+	mode int
+}{
+	{"README", "100b0dec8c53a40e4de7714b2c612dad5fad9985", 0100644},
+	{"a-b/x", "76018072e09c5d31c8c6e3113b8aa0fe625195ca", 0100644},
+	{"a.c", "257cc5642cb1a054f08cc83f2d943e56fd3ebe99", 0100644},
+	{"a/b/c", "5716ca5987cbf97d6bb54920bea6adde242d87e6", 0100644},
+	{"run", "1a2485251c33a70432394c93fb89330ef214bfc9", 0100755},
+}
+
+func newFixtureTreeBuilder() *TreeBuilder {
+	b := NewTreeBuilder()
+	for i := len(treeBuilderFixture) - 1; i >= 0; i-- {
+		f := treeBuilderFixture[i]
+		b.Insert(f.path, core.NewHash(f.hash), os.FileMode(f.mode))
+	}
+
+	return b
+}
+
+func (s *TreeBuilderSuite) TestWrite(c *C) {
+	storage := memory.NewObjectStorage()
+
+	h, err := newFixtureTreeBuilder().Write(storage)
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "8a88152e50e6bbbbd34a9c352d0683c83c2aeccc")
+
+	r := &Repository{Storage: storage}
+	tree, err := r.Tree(h)
+	c.Assert(err, IsNil)
+
+	var names []string
+	for _, e := range tree.Entries {
+		names = append(names, e.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"README", "a-b", "a.c", "a", "run"})
+
+	for _, t := range []struct {
+		path string
+		hash string
+	}{
+		{"a", "a754d1ed22d58b10658f228e6673255940863329"},
+		{"a-b", "80120a9987cf1774bfa01d7b8fab66854c672447"},
+		{"a/b", ""},
+	} {
+		sub, err := tree.Tree(t.path)
+		c.Assert(err, IsNil, Commentf("path=%s", t.path))
+		if t.hash != "" {
+			c.Assert(sub.Hash.String(), Equals, t.hash, Commentf("path=%s", t.path))
+		}
+	}
+
+	e, err := tree.FindEntry("a/b/c")
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash.String(), Equals, "5716ca5987cbf97d6bb54920bea6adde242d87e6")
+}
+
+func (s *TreeBuilderSuite) TestRemove(c *C) {
+	b := newFixtureTreeBuilder()
+	b.Insert("d/e/f", core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99"), 0100644)
+	b.Remove("not-found")
+	b.Remove("a.c/not-found")
+	b.Remove("d/e/f")
+
+	h, err := b.Write(memory.NewObjectStorage())
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "8a88152e50e6bbbbd34a9c352d0683c83c2aeccc")
+
+	b.Remove("a")
+	storage := memory.NewObjectStorage()
+	h, err = b.Write(storage)
+	c.Assert(err, IsNil)
+
+	tree, err := (&Repository{Storage: storage}).Tree(h)
+	c.Assert(err, IsNil)
+	c.Assert(tree.Entries, HasLen, 4)
+	_, err = tree.FindEntry("a")
+	c.Assert(err, Equals, ErrEntryNotFound)
+}
+
+func (s *TreeBuilderSuite) TestInsertReplaces(c *C) {
+	b := NewTreeBuilder()
+	b.Insert("a", core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99"), 0100644)
+	b.Insert("/a/b/", core.NewHash("5716ca5987cbf97d6bb54920bea6adde242d87e6"), 0100644)
+
+	storage := memory.NewObjectStorage()
+	h, err := b.Write(storage)
+	c.Assert(err, IsNil)
+
+	tree, err := (&Repository{Storage: storage}).Tree(h)
+	c.Assert(err, IsNil)
+	e, err := tree.FindEntry("a/b")
+	c.Assert(err, IsNil)
+	c.Assert(e.Hash.String(), Equals, "5716ca5987cbf97d6bb54920bea6adde242d87e6")
+}
+
+func (s *TreeBuilderSuite) TestWriteEmpty(c *C) {
+	h, err := NewTreeBuilder().Write(memory.NewObjectStorage())
+	c.Assert(err, IsNil)
+	c.Assert(h.String(), Equals, "4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+}
@@ -0,0 +1,253 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// ErrUnsafeEntryName is returned by Tree.Checkout for the entries whose
+// names would write outside of their directory, like "..", or inside the
+// .git directory.
+var ErrUnsafeEntryName = errors.New("unsafe tree entry name")
+
+// CheckoutError is returned by Tree.Checkout when an entry cannot be written.
+// Written holds the paths, relative to the checkout directory, of the files
+// and symbolic links written before the error.
+type CheckoutError struct {
+	Path    string
+	Written []string
+	Err     error
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("checkout %s: %s", e.Path, e.Err)
+}
+
+// CheckoutOptions are the options of Tree.CheckoutWithOptions.
+type CheckoutOptions struct {
+	// SymlinksAsFiles writes the symbolic links as regular files holding
+	// their targets, as git does with core.symlinks set to false.
+	SymlinksAsFiles bool
+	// Attributes converts the end of lines of the files according to the
+	// .gitattributes files of the tree, as File.ContentsWithAttrs does.
+	Attributes bool
+}
+
+// DefaultCheckoutOptions are the options used by Tree.Checkout, the symbolic
+// links are written as files on Windows, where creating them usually needs
+// special privileges.
+var DefaultCheckoutOptions = CheckoutOptions{
+	SymlinksAsFiles: runtime.GOOS == "windows",
+}
+
+// Checkout writes the Tree and its subtrees in the directory dir, creating it
+// if needed, using DefaultCheckoutOptions. See CheckoutWithOptions.
+func (t *Tree) Checkout(dir string) error {
+	return t.CheckoutWithOptions(dir, DefaultCheckoutOptions)
+}
+
+// CheckoutWithOptions writes the Tree and its subtrees in the directory dir,
+// creating it if needed. The files are written with 0644 or 0755 permissions,
+// depending on their mode, streaming the contents of their blobs, and the
+// symbolic links are created with their targets. The submodules are checked
+// out as empty directories, as git does for the submodules not initialized.
+//
+// The existing files are replaced, but nothing is ever written outside of
+// dir: the entries with unsafe names return ErrUnsafeEntryName and the
+// existing directories are not followed if they are symbolic links. On error
+// a *CheckoutError is returned with the paths already written.
+func (t *Tree) CheckoutWithOptions(dir string, o CheckoutOptions) error {
+	c := &treeCheckout{r: t.r, dir: dir, o: o}
+	if o.Attributes {
+		c.attrs = NewAttributes(t)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &CheckoutError{Err: err}
+	}
+
+	var current string
+	err := t.Walk(func(path string, e TreeEntry) error {
+		current = path
+		return c.checkout(path, e)
+	})
+	if err != nil {
+		return &CheckoutError{Path: current, Written: c.written, Err: err}
+	}
+
+	return nil
+}
+
+type treeCheckout struct {
+	r       *Repository
+	dir     string
+	o       CheckoutOptions
+	attrs   *Attributes
+	written []string
+}
+
+func (c *treeCheckout) checkout(path string, e TreeEntry) error {
+	if !isSafeEntryName(e.Name) {
+		return ErrUnsafeEntryName
+	}
+
+	fsPath := filepath.Join(c.dir, filepath.FromSlash(path))
+	switch {
+	case e.Mode == treeEntryDirMode || isSubmoduleMode(e.Mode):
+		return checkoutDir(fsPath)
+	case isSymlinkMode(e.Mode) && !c.o.SymlinksAsFiles:
+		if err := c.checkoutSymlink(fsPath, e.Hash); err != nil {
+			return err
+		}
+	default:
+		perm := os.FileMode(0644)
+		if isExecutableMode(e.Mode) {
+			perm = 0755
+		}
+
+		if err := c.checkoutFile(fsPath, path, e.Hash, perm); err != nil {
+			return err
+		}
+	}
+
+	c.written = append(c.written, path)
+	return nil
+}
+
+// checkoutDir creates a directory, an existing one is only accepted if it is
+// not a symbolic link, so the entries inside it are never written elsewhere.
+func checkoutDir(path string) error {
+	err := os.Mkdir(path, 0755)
+	if !os.IsExist(err) {
+		return err
+	}
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%s exists and is not a directory", path)
+	}
+
+	return nil
+}
+
+func (c *treeCheckout) checkoutFile(path, treePath string, h core.Hash, perm os.FileMode) (err error) {
+	obj, err := c.r.Storage.Get(h)
+	if err != nil {
+		return err
+	}
+
+	reader, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+	defer checkClose(reader, &err)
+
+	var r io.Reader = reader
+	if c.attrs != nil {
+		// the contents are only read at once if they may be converted
+		if r, err = c.convertEOL(treePath, reader); err != nil {
+			return err
+		}
+	}
+
+	if err := removeNonDir(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer checkClose(f, &err)
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (c *treeCheckout) convertEOL(path string, r io.Reader) (io.Reader, error) {
+	attrs, err := c.attrs.Attrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if attrs.EOL() != "crlf" {
+		return r, nil
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(convertEOL(string(content), attrs)), nil
+}
+
+func (c *treeCheckout) checkoutSymlink(path string, h core.Hash) error {
+	obj, err := c.r.Storage.Get(h)
+	if err != nil {
+		return err
+	}
+
+	blob := &Blob{}
+	if err := blob.Decode(obj); err != nil {
+		return err
+	}
+
+	target, err := newFile(path, treeEntrySymlinkMode, blob).ContentsLimited(maxSymlinkTargetLength)
+	if err != nil {
+		return err
+	}
+
+	if err := removeNonDir(path); err != nil {
+		return err
+	}
+
+	return os.Symlink(target, path)
+}
+
+// removeNonDir removes the file or symbolic link at path, if any, so it can
+// be created again without following an existing symbolic link.
+func removeNonDir(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return fmt.Errorf("%s exists and is a directory", path)
+	}
+
+	return os.Remove(path)
+}
+
+// isSafeEntryName reports whether an entry name can be written in the
+// directory of its tree, without escaping it or writing inside .git.
+func isSafeEntryName(name string) bool {
+	switch {
+	case name == "", name == ".", name == "..":
+		return false
+	case strings.EqualFold(name, ".git"):
+		return false
+	case strings.ContainsAny(name, "/\x00"):
+		return false
+	case os.PathSeparator != '/' && strings.ContainsRune(name, os.PathSeparator):
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,143 @@
+package git
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeCheckout struct{}
+
+var _ = Suite(&SuiteTreeCheckout{})
+
+func (s *SuiteTreeCheckout) TestCheckoutFixture(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	dir := filepath.Join(c.MkDir(), "checkout")
+	c.Assert(tree.Checkout(dir), IsNil)
+
+	iter := tree.Files()
+	defer iter.Close()
+
+	var count int
+	for f, err := iter.Next(); err != io.EOF; f, err = iter.Next() {
+		c.Assert(err, IsNil)
+		count++
+
+		expected, err := f.Contents()
+		c.Assert(err, IsNil)
+		obtained, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Name)))
+		c.Assert(err, IsNil)
+		c.Assert(string(obtained), Equals, expected, Commentf("file=%s", f.Name))
+	}
+	c.Assert(count, Equals, 9)
+}
+
+func (s *SuiteTreeCheckout) newModesTree(c *C) *Tree {
+	r := NewPlainRepository()
+	foo := newTestBlob(c, r, "foo\n")
+	run := newTestBlob(c, r, "#!/bin/sh\n")
+	link := newTestBlob(c, r, "sub/bar")
+
+	sub := newTestTree(c, r, TreeEntry{Name: "bar", Mode: 0100644, Hash: foo})
+	return newTestTree(c, r,
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: foo},
+		TreeEntry{Name: "link", Mode: 0120000, Hash: link},
+		TreeEntry{Name: "module", Mode: 0160000, Hash: core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b")},
+		TreeEntry{Name: "run", Mode: 0100755, Hash: run},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+}
+
+func (s *SuiteTreeCheckout) TestCheckoutModes(c *C) {
+	dir := c.MkDir()
+	c.Assert(s.newModesTree(c).CheckoutWithOptions(dir, CheckoutOptions{}), IsNil)
+
+	fi, err := os.Lstat(filepath.Join(dir, "foo"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().IsRegular(), Equals, true)
+	c.Assert(fi.Mode()&0111, Equals, os.FileMode(0))
+
+	fi, err = os.Lstat(filepath.Join(dir, "run"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().IsRegular(), Equals, true)
+	c.Assert(fi.Mode()&0100, Equals, os.FileMode(0100))
+
+	target, err := os.Readlink(filepath.Join(dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(target, Equals, "sub/bar")
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "module"))
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+
+	// checking out again replaces the existing files and links
+	c.Assert(s.newModesTree(c).CheckoutWithOptions(dir, CheckoutOptions{}), IsNil)
+}
+
+func (s *SuiteTreeCheckout) TestCheckoutSymlinksAsFiles(c *C) {
+	dir := c.MkDir()
+	o := CheckoutOptions{SymlinksAsFiles: true}
+	c.Assert(s.newModesTree(c).CheckoutWithOptions(dir, o), IsNil)
+
+	fi, err := os.Lstat(filepath.Join(dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().IsRegular(), Equals, true)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "sub/bar")
+}
+
+func (s *SuiteTreeCheckout) TestCheckoutUnsafeNames(c *C) {
+	for _, name := range []string{"..", ".", ".git", ".GIT", "a/b"} {
+		r := NewPlainRepository()
+		foo := newTestBlob(c, r, "foo\n")
+		sub := newTestTree(c, r, TreeEntry{Name: "passwd", Mode: 0100644, Hash: foo})
+		tree := newTestTree(c, r,
+			TreeEntry{Name: "-foo", Mode: 0100644, Hash: foo},
+			TreeEntry{Name: name, Mode: 040000, Hash: sub.Hash},
+		)
+
+		base := c.MkDir()
+		dir := filepath.Join(base, "checkout")
+		err := tree.Checkout(dir)
+		com := Commentf("name=%q", name)
+		c.Assert(err, FitsTypeOf, &CheckoutError{}, com)
+
+		cerr := err.(*CheckoutError)
+		c.Assert(cerr.Err, Equals, ErrUnsafeEntryName, com)
+		c.Assert(cerr.Path, Equals, name, com)
+		c.Assert(cerr.Written, DeepEquals, []string{"-foo"}, com)
+
+		_, err = os.Lstat(filepath.Join(base, "passwd"))
+		c.Assert(os.IsNotExist(err), Equals, true, com)
+	}
+}
+
+func (s *SuiteTreeCheckout) TestCheckoutDoesNotFollowSymlinks(c *C) {
+	outside := c.MkDir()
+	dir := c.MkDir()
+	c.Assert(os.Symlink(outside, filepath.Join(dir, "sub")), IsNil)
+
+	err := s.newModesTree(c).CheckoutWithOptions(dir, CheckoutOptions{})
+	c.Assert(err, FitsTypeOf, &CheckoutError{})
+	c.Assert(err.(*CheckoutError).Path, Equals, "sub")
+
+	files, err := ioutil.ReadDir(outside)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
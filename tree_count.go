@@ -0,0 +1,111 @@
+package git
+
+import (
+	"path"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// Count returns the number of files and subtrees reachable from the tree,
+// counting every time they appear. Submodules are not counted. Only the
+// subtrees are read from the storage, and each distinct subtree is read
+// once, no matter how many times it appears.
+func (t *Tree) Count() (files int, trees int, err error) {
+	total, err := newTreeCounter(t.r, false).count(t, "", 0)
+	return total.files, total.trees, err
+}
+
+// Size returns the total size of the files reachable from the tree, counting
+// every time they appear, as they would take in a checkout. The sizes are
+// taken from the objects without reading their contents, and each distinct
+// subtree and blob is looked up once.
+func (t *Tree) Size() (int64, error) {
+	total, err := newTreeCounter(t.r, true).count(t, "", 0)
+	return total.size, err
+}
+
+type treeCount struct {
+	files int
+	trees int
+	size  int64
+}
+
+// treeCounter counts the entries of trees, remembering the counts of the
+// subtrees and, if sizes is set, the sizes of the blobs already seen.
+type treeCounter struct {
+	r     *Repository
+	sizes bool
+	trees map[core.Hash]treeCount
+	blobs map[core.Hash]int64
+}
+
+func newTreeCounter(r *Repository, sizes bool) *treeCounter {
+	return &treeCounter{
+		r:     r,
+		sizes: sizes,
+		trees: make(map[core.Hash]treeCount, 0),
+		blobs: make(map[core.Hash]int64, 0),
+	}
+}
+
+// count counts the entries of the tree t, with the given path.
+func (c *treeCounter) count(t *Tree, base string, depth int) (treeCount, error) {
+	var total treeCount
+	if depth > DefaultMaxTreeDepth {
+		return total, maxTreeDepthError(base)
+	}
+
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		switch e.Mode {
+		case treeEntrySubmoduleMode:
+			continue
+		case treeEntryDirMode:
+			sub, ok := c.trees[e.Hash]
+			if !ok {
+				tree, err := t.subtree(e)
+				if err != nil {
+					return total, err
+				}
+
+				if sub, err = c.count(tree, path.Join(base, e.Name), depth+1); err != nil {
+					return total, err
+				}
+
+				c.trees[e.Hash] = sub
+			}
+
+			total.files += sub.files
+			total.trees += sub.trees + 1
+			total.size += sub.size
+		default:
+			total.files++
+			if !c.sizes {
+				continue
+			}
+
+			size, err := c.blobSize(e.Hash)
+			if err != nil {
+				return total, err
+			}
+
+			total.size += size
+		}
+	}
+
+	return total, nil
+}
+
+func (c *treeCounter) blobSize(h core.Hash) (int64, error) {
+	if size, ok := c.blobs[h]; ok {
+		return size, nil
+	}
+
+	obj, err := c.r.Storage.Get(h)
+	if err != nil {
+		return 0, err
+	}
+
+	c.blobs[h] = obj.Size()
+	return obj.Size(), nil
+}
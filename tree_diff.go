@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path"
 	"sort"
 	"strings"
 
@@ -31,9 +32,14 @@ const (
 	Modify
 )
 
+// Change represents a modification of a file between two trees. From and To
+// are the entries of the file in the source and destination tree, the one
+// of the missing side is the zero value for insertions and deletions.
 type Change struct {
 	Action
 	Name  string
+	From  TreeEntry
+	To    TreeEntry
 	Files [2]*File
 }
 
@@ -47,6 +53,13 @@ func newEmpty() Changes {
 	return make([]*Change, 0, 0)
 }
 
+// DiffTree compares the trees a and b and returns the changes needed to turn
+// a into b, sorted by path. A nil tree is considered empty. Only the subtrees
+// whose hashes differ are traversed, so comparing trees sharing most of
+// their subtrees is cheap.
+//
+// A file replaced by a directory, or the other way around, is reported as
+// the deletion of the old files and the insertion of the new ones.
 func DiffTree(a, b *Tree) ([]*Change, error) {
 	if a == b {
 		return newEmpty(), nil
@@ -98,108 +111,196 @@ func newWithEmpty(a, b *Tree) (Changes, error) {
 		tree = a
 	}
 
-	iter := tree.Files()
-	defer iter.Close()
-
-	for {
-		file, err := iter.Next()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, fmt.Errorf("cannot get next file: %s", err)
-		}
+	if err := changes.addFiles(tree, "", 0, action); err != nil {
+		return nil, err
+	}
 
-		var files [2]*File
-		if action == Insert {
-			files[1] = file
-		} else {
-			files[0] = file
-		}
+	return changes, nil
+}
 
-		changes = append(changes, &Change{
-			Action: action,
-			Name:   file.Name,
-			Files:  files,
-		})
+func newDiffTree(a, b *Tree) ([]*Change, error) {
+	changes := newEmpty()
+	if err := changes.diff(a, b, "", 0); err != nil {
+		return nil, err
 	}
 
+	sort.Sort(changes)
 	return changes, nil
 }
 
-// FIXME: this is very inefficient, but correct.
-// The proper way to do this is to implement a diff-tree algorithm,
-// while taking advantage of the tree hashes to avoid traversing
-// subtrees when the hash is equal in both inputs.
-func newDiffTree(a, b *Tree) ([]*Change, error) {
-	result := make([]*Change, 0)
+// diff appends the changes between the subtrees a and b, located at base.
+// The objects of the entries changed are read at once, one batch for each
+// tree, see core.GetMany.
+func (c *Changes) diff(a, b *Tree, base string, depth int) error {
+	if depth > DefaultMaxTreeDepth {
+		return maxTreeDepthError(base)
+	}
 
-	aChanges, err := newWithEmpty(a, nil)
+	if a.m == nil {
+		a.buildMap()
+	}
+
+	if b.m == nil {
+		b.buildMap()
+	}
+
+	// the pairs of entries changed, the missing one is nil for the
+	// insertions and deletions
+	var froms, tos []*TreeEntry
+	for i := range b.Entries {
+		to := &b.Entries[i]
+		from, ok := a.m[to.Name]
+		if ok && from.Hash == to.Hash && from.Mode == to.Mode {
+			continue
+		}
+
+		froms = append(froms, from)
+		tos = append(tos, to)
+	}
+
+	for i := range a.Entries {
+		if _, ok := b.m[a.Entries[i].Name]; !ok {
+			froms = append(froms, &a.Entries[i])
+			tos = append(tos, nil)
+		}
+	}
+
+	fromObjs, err := entryObjects(a.r, froms)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create nil-diff of source tree: %s", err)
+		return err
 	}
-	sort.Sort(aChanges)
 
-	bChanges, err := newWithEmpty(nil, b)
+	toObjs, err := entryObjects(b.r, tos)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create nil-diff of destination tree: %s", err)
-	}
-	sort.Sort(bChanges)
-
-	for len(aChanges) > 0 && len(bChanges) > 0 {
-		switch comp := strings.Compare(aChanges[0].Name, bChanges[0].Name); {
-		case comp == 0: // append as "Modify" or ignore if not changed
-			modified, err := hasChange(a, b, aChanges[0].Name)
-			if err != nil {
-				return nil, err
-			}
-
-			if modified {
-				result = append(result, &Change{
-					Action: Modify,
-					Name:   aChanges[0].Name,
-					Files:  [2]*File{aChanges[0].Files[0], bChanges[0].Files[1]},
-				})
-			}
-
-			aChanges = aChanges[1:]
-			bChanges = bChanges[1:]
-		case comp < 0: // delete first a change
-			result = append(result, aChanges[0])
-			aChanges = aChanges[1:]
-		case comp > 0: // insert first b change
-			result = append(result, bChanges[0])
-			bChanges = bChanges[1:]
+		return err
+	}
+
+	for i := range froms {
+		switch {
+		case froms[i] == nil:
+			err = c.addObject(*tos[i], toObjs[i], base, depth, Insert)
+		case tos[i] == nil:
+			err = c.addObject(*froms[i], fromObjs[i], base, depth, Delete)
+		default:
+			err = c.diffEntries(*froms[i], *tos[i], fromObjs[i], toObjs[i], base, depth)
+		}
+
+		if err != nil {
+			return err
 		}
 	}
 
-	// append all remaining changes in aChanges, if any, as deletes
-	// append all remaining changes in bChanges, if any, as inserts
-	result = append(result, aChanges...)
-	result = append(result, bChanges...)
+	return nil
+}
 
-	return result, nil
+// diffEntries appends the changes between two entries with the same name
+// but different hash or mode, given their objects.
+func (c *Changes) diffEntries(from, to TreeEntry, fromObj, toObj Object, base string, depth int) error {
+	fromTree, fromIsTree := fromObj.(*Tree)
+	toTree, toIsTree := toObj.(*Tree)
+	switch {
+	case fromIsTree && toIsTree:
+		return c.diff(fromTree, toTree, path.Join(base, to.Name), depth+1)
+	case fromObj == nil || toObj == nil || fromIsTree || toIsTree:
+		// a type change, or a git submodule on any side
+		if err := c.addObject(from, fromObj, base, depth, Delete); err != nil {
+			return err
+		}
+
+		return c.addObject(to, toObj, base, depth, Insert)
+	}
+
+	*c = append(*c, &Change{
+		Action: Modify,
+		Name:   path.Join(base, to.Name),
+		From:   from,
+		To:     to,
+		Files: [2]*File{
+			newFile(path.Join(base, from.Name), from.Mode, fromObj.(*Blob)),
+			newFile(path.Join(base, to.Name), to.Mode, toObj.(*Blob)),
+		},
+	})
+
+	return nil
 }
 
-func hasChange(a, b *Tree, path string) (bool, error) {
-	ha, err := hash(a, path)
-	if err != nil {
-		return false, err
+// addObject appends the insertion or deletion of all the files reachable
+// from the object of the given entry, of the tree at base, with the given
+// depth.
+func (c *Changes) addObject(e TreeEntry, obj Object, base string, depth int, action Action) error {
+	switch o := obj.(type) {
+	case *Tree:
+		return c.addFiles(o, path.Join(base, e.Name), depth+1, action)
+	case *Blob:
+		c.add(newFile(path.Join(base, e.Name), e.Mode, o), e, action)
 	}
 
-	hb, err := hash(b, path)
-	if err != nil {
-		return false, err
+	return nil
+}
+
+// addFiles appends the insertion or deletion of all the files in the tree,
+// at base with the given depth, so the subtrees deeper than
+// DefaultMaxTreeDepth from the root are not followed.
+func (c *Changes) addFiles(t *Tree, base string, depth int, action Action) error {
+	iter := newFileIterWithBase(t.r, t, base)
+	iter.SetMaxDepth(DefaultMaxTreeDepth - depth)
+	defer iter.Close()
+
+	for {
+		file, err := iter.Next()
+		if err == io.EOF {
+			break
+		} else if e, ok := err.(*MaxTreeDepthError); ok {
+			return maxTreeDepthError(e.Path)
+		} else if err != nil {
+			return fmt.Errorf("cannot get next file: %s", err)
+		}
+
+		c.add(file, TreeEntry{
+			Name: path.Base(file.Name),
+			Mode: file.Mode,
+			Hash: file.Hash,
+		}, action)
+	}
+
+	return nil
+}
+
+func (c *Changes) add(f *File, e TreeEntry, action Action) {
+	change := &Change{Action: action, Name: f.Name}
+	if action == Insert {
+		change.To = e
+		change.Files[1] = f
+	} else {
+		change.From = e
+		change.Files[0] = f
 	}
 
-	return ha != hb, nil
+	*c = append(*c, change)
 }
 
-func hash(tree *Tree, path string) (core.Hash, error) {
-	file, err := tree.File(path)
+// entryObjects returns the objects referenced by the given entries, reading
+// them at once. The object is nil for the nil entries and for the ones not
+// available in the storage, as it happens with git submodules.
+func entryObjects(r *Repository, entries []*TreeEntry) ([]Object, error) {
+	hs := make([]core.Hash, 0, len(entries))
+	for _, e := range entries {
+		if e != nil {
+			hs = append(hs, e.Hash)
+		}
+	}
+
+	objs, err := r.objects(hs)
 	if err != nil {
-		var empty core.Hash
-		return empty, fmt.Errorf("cannot find file %s in tree: %s", path, err)
+		return nil, err
 	}
 
-	return file.Hash, nil
+	result := make([]Object, len(entries))
+	for i, e := range entries {
+		if e != nil {
+			result[i], objs = objs[0], objs[1:]
+		}
+	}
+
+	return result, nil
 }
@@ -1,11 +1,14 @@
 package git
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"sort"
 
 	"gopkg.in/src-d/go-git.v3/core"
 	"gopkg.in/src-d/go-git.v3/formats/packfile"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -342,6 +345,131 @@ func (s *DiffTreeSuite) TestDiffTree(c *C) {
 	}
 }
 
+// newTestTree stores in the repository a tree with the given entries, that
+// must be given in git order, and returns it.
+func newTestTree(c *C, r *Repository, entries ...TreeEntry) *Tree {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%o %s", e.Mode, e.Name)
+		buf.WriteByte(0)
+		buf.Write(e.Hash.Bytes())
+	}
+
+	obj := memory.NewObject(core.TreeObject, int64(buf.Len()), buf.Bytes())
+	h, err := r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+
+	tree, err := r.Tree(h)
+	c.Assert(err, IsNil)
+
+	return tree
+}
+
+func newTestBlob(c *C, r *Repository, content string) core.Hash {
+	obj := memory.NewObject(core.BlobObject, int64(len(content)), []byte(content))
+	h, err := r.Storage.Set(obj)
+	c.Assert(err, IsNil)
+
+	return h
+}
+
+func (s *DiffTreeSuite) TestDiffTreeModeChange(c *C) {
+	r := NewPlainRepository()
+	foo := newTestBlob(c, r, "foo")
+	bar := newTestBlob(c, r, "bar")
+
+	sub := newTestTree(c, r, TreeEntry{Name: "bar", Mode: 0100644, Hash: bar})
+	a := newTestTree(c, r,
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: foo},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+	b := newTestTree(c, r,
+		TreeEntry{Name: "foo", Mode: 0100755, Hash: foo},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+
+	changes, err := DiffTree(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].Action, Equals, Modify)
+	c.Assert(changes[0].Name, Equals, "foo")
+	c.Assert(changes[0].From.Mode, Equals, os.FileMode(0100644))
+	c.Assert(changes[0].To.Mode, Equals, os.FileMode(0100755))
+	c.Assert(changes[0].From.Hash, Equals, changes[0].To.Hash)
+	assertChanges(changes, c)
+}
+
+func (s *DiffTreeSuite) TestDiffTreeTypeChange(c *C) {
+	r := NewPlainRepository()
+	foo := newTestBlob(c, r, "foo")
+	bar := newTestBlob(c, r, "bar")
+
+	sub := newTestTree(c, r,
+		TreeEntry{Name: "bar", Mode: 0100644, Hash: bar},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: foo},
+	)
+	a := newTestTree(c, r,
+		TreeEntry{Name: "bar", Mode: 0100644, Hash: bar},
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: foo},
+	)
+	b := newTestTree(c, r,
+		TreeEntry{Name: "bar", Mode: 0100644, Hash: bar},
+		TreeEntry{Name: "foo", Mode: 040000, Hash: sub.Hash},
+	)
+
+	changes, err := DiffTree(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(changes[0].Action, Equals, Delete)
+	c.Assert(changes[0].Name, Equals, "foo")
+	c.Assert(changes[0].From.Hash, Equals, foo)
+	c.Assert(changes[0].To, DeepEquals, TreeEntry{})
+	c.Assert(changes[1].Action, Equals, Insert)
+	c.Assert(changes[1].Name, Equals, "foo/bar")
+	c.Assert(changes[1].From, DeepEquals, TreeEntry{})
+	c.Assert(changes[1].To.Hash, Equals, bar)
+	c.Assert(changes[2].Action, Equals, Insert)
+	c.Assert(changes[2].Name, Equals, "foo/foo")
+	assertChanges(changes, c)
+
+	changes, err = DiffTree(b, a)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(changes[0].Action, Equals, Insert)
+	c.Assert(changes[0].Name, Equals, "foo")
+	c.Assert(changes[1].Action, Equals, Delete)
+	c.Assert(changes[1].Name, Equals, "foo/bar")
+	c.Assert(changes[2].Action, Equals, Delete)
+	c.Assert(changes[2].Name, Equals, "foo/foo")
+	assertChanges(changes, c)
+}
+
+func (s *DiffTreeSuite) TestDiffTreeSkipsEqualSubtrees(c *C) {
+	r := NewPlainRepository()
+	foo := newTestBlob(c, r, "foo")
+	bar := newTestBlob(c, r, "bar")
+
+	sub := newTestTree(c, r, TreeEntry{Name: "bar", Mode: 0100644, Hash: bar})
+	a := newTestTree(c, r,
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: foo},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+	b := newTestTree(c, r,
+		TreeEntry{Name: "foo", Mode: 0100644, Hash: bar},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	r.Storage = storage
+
+	changes, err := DiffTree(a, b)
+	c.Assert(err, IsNil)
+	c.Assert(changes, HasLen, 1)
+	c.Assert(changes[0].Action, Equals, Modify)
+	c.Assert(changes[0].Name, Equals, "foo")
+	c.Assert(storage.gets[sub.Hash], Equals, 0)
+}
+
 func assertChanges(a Changes, c *C) {
 	for _, changes := range a {
 		switch changes.Action {
@@ -394,5 +522,5 @@ func tree(repo *Repository, commitHashStr string) (*Tree, error) {
 		return nil, err
 	}
 
-	return commit.Tree(), nil
+	return commit.Tree()
 }
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"path"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// FindEntriesByHash returns the paths, relative to the tree, of all the
+// entries of the tree and its subtrees pointing to the object with hash h,
+// in tree order. Both blobs and subtrees are matched, the subtrees matching
+// h are not descended into, as they cannot contain themselves.
+//
+// Every distinct subtree is read and searched once, the paths found in it
+// are reused for all the places where it appears.
+func (t *Tree) FindEntriesByHash(h core.Hash) ([]string, error) {
+	f := &hashFinder{
+		r:     t.r,
+		hash:  h,
+		found: make(map[core.Hash][]string, 0),
+	}
+
+	return f.find(t, "", 0)
+}
+
+// hashFinder searches for a hash in a tree, remembering the paths found in
+// each subtree, relative to it.
+type hashFinder struct {
+	r     *Repository
+	hash  core.Hash
+	found map[core.Hash][]string
+}
+
+// find returns the paths found in the tree t, with the given path.
+func (f *hashFinder) find(t *Tree, base string, depth int) ([]string, error) {
+	if depth > DefaultMaxTreeDepth {
+		return nil, maxTreeDepthError(base)
+	}
+
+	var paths []string
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		if e.Hash == f.hash {
+			paths = append(paths, e.Name)
+			continue
+		}
+
+		if e.Mode != treeEntryDirMode {
+			continue
+		}
+
+		found, ok := f.found[e.Hash]
+		if !ok {
+			sub, err := t.subtree(e)
+			if err != nil {
+				return nil, err
+			}
+
+			if found, err = f.find(sub, path.Join(base, e.Name), depth+1); err != nil {
+				return nil, err
+			}
+
+			f.found[e.Hash] = found
+		}
+
+		for _, p := range found {
+			paths = append(paths, e.Name+"/"+p)
+		}
+	}
+
+	return paths, nil
+}
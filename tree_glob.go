@@ -0,0 +1,156 @@
+package git
+
+import (
+	"path"
+	"strings"
+)
+
+const globStar = "**"
+
+// Glob returns the files of the tree whose full path, relative to the tree
+// receiver, matches the given pattern. The pattern syntax is the same as in
+// path.Match, applied to each slash separated component, with the addition
+// of the "**" component, which matches zero or more directories; a trailing
+// "**" matches every file below the directories matched so far.
+//
+// Directories are never returned, even if their path matches the pattern, and
+// only the subtrees that can contain matching files and the blobs of the files
+// returned are read, so patterns like "vendor/**" do not read the whole tree.
+func (t *Tree) Glob(pattern string) ([]*File, error) {
+	parts, err := splitGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &globber{r: t.r, seen: make(map[string]bool, 0)}
+	if err := g.glob(t, "", parts, 0); err != nil {
+		return nil, err
+	}
+
+	return g.files, nil
+}
+
+// splitGlob returns the slash separated components of a pattern, or
+// path.ErrBadPattern if any of them is malformed.
+func splitGlob(pattern string) ([]string, error) {
+	parts := strings.Split(pattern, "/")
+	for _, p := range parts {
+		if p == globStar {
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return parts, nil
+}
+
+// matchGlob reports whether the components of a file path match the ones of
+// a pattern returned by splitGlob, with the same semantics as Glob.
+func matchGlob(parts, names []string) bool {
+	if len(parts) == 0 {
+		return len(names) == 0
+	}
+
+	if parts[0] == globStar {
+		if len(parts) == 1 {
+			return len(names) != 0
+		}
+
+		for i := range names {
+			if matchGlob(parts[1:], names[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(names) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(parts[0], names[0]); !ok {
+		return false
+	}
+
+	return matchGlob(parts[1:], names[1:])
+}
+
+type globber struct {
+	r     *Repository
+	files []*File
+	seen  map[string]bool
+}
+
+func (g *globber) glob(t *Tree, base string, parts []string, depth int) error {
+	if depth > DefaultMaxTreeDepth {
+		return maxTreeDepthError(base)
+	}
+
+	star := parts[0] == globStar
+	if star && len(parts) > 1 {
+		// "**" matching zero directories
+		if err := g.glob(t, base, parts[1:], depth); err != nil {
+			return err
+		}
+	}
+
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		if !star {
+			if ok, _ := path.Match(parts[0], e.Name); !ok {
+				continue
+			}
+		}
+
+		name := path.Join(base, e.Name)
+		switch e.Mode {
+		case treeEntrySubmoduleMode:
+			continue
+		case treeEntryDirMode:
+			rest := parts[1:]
+			if star {
+				rest = parts // "**" matching one more directory
+			}
+
+			if len(rest) == 0 {
+				continue // a directory matching the whole pattern
+			}
+
+			tree, err := t.subtree(e)
+			if err != nil {
+				return err
+			}
+
+			if err := g.glob(tree, name, rest, depth+1); err != nil {
+				return err
+			}
+		default:
+			if len(parts) == 1 {
+				if err := g.add(name, e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *globber) add(name string, e *TreeEntry) error {
+	if g.seen[name] {
+		return nil
+	}
+	g.seen[name] = true
+
+	blob, err := g.r.Blob(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	g.files = append(g.files, newFile(name, e.Mode, blob))
+	return nil
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"path"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeGlob struct {
+	repos map[string]*Repository
+}
+
+var _ = Suite(&SuiteTreeGlob{})
+
+func (s *SuiteTreeGlob) SetUpSuite(c *C) {
+	s.repos = unpackFixtures(c, fixtureRepos)
+}
+
+func (s *SuiteTreeGlob) TestGlob(c *C) {
+	for i, t := range []struct {
+		repo    string   // the repo name as in localRepos
+		commit  string   // the commit to glob in
+		pattern string   // the pattern to match
+		files   []string // the expected files, in tree order
+	}{
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "*", []string{
+			".gitignore", "CHANGELOG", "LICENSE", "binary.jpg",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "*.go", nil},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "go/*.go", []string{
+			"go/example.go",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "*/*.go", []string{
+			"go/example.go", "vendor/foo.go",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "**/*.go", []string{
+			"go/example.go", "vendor/foo.go",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "**/**/*.json", []string{
+			"json/long.json", "json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "json/**", []string{
+			"json/long.json", "json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "j*", nil},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "*/short.json", []string{
+			"json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "LICENSE/*", nil},
+		{"https://github.com/spinnaker/spinnaker.git", "b32b2aecae2cfca4840dd480f8082da206a538da", "etc/**/*.conf", []string{
+			"etc/apache2/sites-available/spinnaker.conf",
+			"etc/init/spinnaker.conf",
+		}},
+		{"https://github.com/spinnaker/spinnaker.git", "b32b2aecae2cfca4840dd480f8082da206a538da", "etc/**/sites-*/*", []string{
+			"etc/apache2/sites-available/spinnaker.conf",
+		}},
+	} {
+		com := Commentf("subtest %d, pattern=%s", i, t.pattern)
+		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil, com)
+
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		files, err := tree.Glob(t.pattern)
+		c.Assert(err, IsNil, com)
+
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		c.Assert(names, DeepEquals, t.files, com)
+	}
+}
+
+func (s *SuiteTreeGlob) TestGlobBadPattern(c *C) {
+	commit, err := s.repos["https://github.com/tyba/git-fixture.git"].Commit(
+		core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	files, err := tree.Glob("go/[")
+	c.Assert(err, Equals, path.ErrBadPattern)
+	c.Assert(files, IsNil)
+}
+
+// countingStorage records the hashes of the objects read from the storage.
+type countingStorage struct {
+	core.ObjectStorage
+	gets map[core.Hash]int
+}
+
+func (s *countingStorage) Get(h core.Hash) (core.Object, error) {
+	s.gets[h]++
+	return s.ObjectStorage.Get(h)
+}
+
+func (s *SuiteTreeGlob) TestGlobDoesNotDescendIntoUnmatchedDirs(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	repo := &Repository{Storage: storage}
+
+	tree, err := repo.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	files, err := tree.Glob("vendor/**")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+	c.Assert(files[0].Name, Equals, "vendor/foo.go")
+
+	for _, h := range []string{
+		"a39771a7651f97faf5c72e08224d857fc35133db", // go
+		"5a877e6a906a2743ad6e45d99c1793642aaf8eda", // json
+		"586af567d0bb5e771e49bdd9434f5e0fb76d25fa", // php
+	} {
+		c.Assert(storage.gets[core.NewHash(h)], Equals, 0, Commentf("tree %s", h))
+	}
+}
+
+func (s *SuiteTreeGlob) TestGlobReadsMatchedBlobsOnly(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	repo := &Repository{Storage: storage}
+
+	tree, err := repo.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	files, err := tree.Glob("**/*.go")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+
+	matched := make(map[core.Hash]bool, 0)
+	for _, f := range files {
+		matched[f.Hash] = true
+		c.Assert(storage.gets[f.Hash], Equals, 1, Commentf("file %s", f.Name))
+	}
+
+	for _, e := range tree.Entries {
+		if e.Mode != treeEntryDirMode && !matched[e.Hash] {
+			c.Assert(storage.gets[e.Hash], Equals, 0, Commentf("file %s", e.Name))
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package git
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrGrepPatternNotSet is returned by Tree.Grep if no pattern is given.
+var ErrGrepPatternNotSet = errors.New("grep pattern not set")
+
+// GrepOptions are the options of Tree.Grep.
+type GrepOptions struct {
+	// Pattern is the regular expression searched in every line.
+	Pattern *regexp.Regexp
+	// Include, if not empty, limits the search to the files whose path
+	// matches any of these patterns, with the same syntax as Tree.Glob.
+	Include []string
+	// Exclude skips the files whose path matches any of these patterns.
+	Exclude []string
+	// IgnoreCase makes the pattern match regardless of the case.
+	IgnoreCase bool
+	// Context is the number of lines returned before and after each match.
+	Context int
+	// Binary searches the binary files too, they are skipped otherwise.
+	Binary bool
+	// MaxLineLength is the maximum length of the lines, as in
+	// File.LineScanner, zero means DefaultMaxLineLength.
+	MaxLineLength int
+}
+
+// GrepResult is a line matched by Tree.Grep.
+type GrepResult struct {
+	// Path is the path of the file, relative to the tree.
+	Path string
+	// LineNumber is the number of the matched line, starting at 1.
+	LineNumber int
+	// Line is the matched line, without its end of line.
+	Line string
+	// Before and After are the lines of context around the matched line,
+	// fewer than GrepOptions.Context at the beginning and end of the file.
+	Before []string
+	After  []string
+}
+
+// Grep returns the lines of the files of the tree, and its subtrees, matching
+// the given options, in tree order. The files are read line by line from the
+// blobs, without loading their whole contents, and only the blobs of the
+// files whose path is included are read. Symbolic links and submodules are
+// not searched.
+func (t *Tree) Grep(o GrepOptions) ([]GrepResult, error) {
+	g, err := newGrepper(o)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Walk(func(path string, e TreeEntry) error {
+		if e.Mode == treeEntryDirMode || isSymlinkMode(e.Mode) || isSubmoduleMode(e.Mode) {
+			return nil
+		}
+
+		if !g.matchPath(path) {
+			return nil
+		}
+
+		obj, err := t.r.Storage.Get(e.Hash)
+		if err != nil {
+			return err
+		}
+
+		blob := &Blob{}
+		if err := blob.Decode(obj); err != nil {
+			return err
+		}
+
+		return g.grep(newFile(path, e.Mode, blob))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return g.results, nil
+}
+
+type grepper struct {
+	o       GrepOptions
+	re      *regexp.Regexp
+	include [][]string
+	exclude [][]string
+	results []GrepResult
+}
+
+func newGrepper(o GrepOptions) (*grepper, error) {
+	if o.Pattern == nil {
+		return nil, ErrGrepPatternNotSet
+	}
+
+	g := &grepper{o: o, re: o.Pattern}
+	if o.IgnoreCase {
+		re, err := regexp.Compile("(?i)" + o.Pattern.String())
+		if err != nil {
+			return nil, err
+		}
+
+		g.re = re
+	}
+
+	var err error
+	if g.include, err = splitGlobs(o.Include); err != nil {
+		return nil, err
+	}
+
+	if g.exclude, err = splitGlobs(o.Exclude); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func splitGlobs(patterns []string) ([][]string, error) {
+	var globs [][]string
+	for _, p := range patterns {
+		parts, err := splitGlob(p)
+		if err != nil {
+			return nil, err
+		}
+
+		globs = append(globs, parts)
+	}
+
+	return globs, nil
+}
+
+func (g *grepper) matchPath(path string) bool {
+	names := strings.Split(path, "/")
+	for _, parts := range g.exclude {
+		if matchGlob(parts, names) {
+			return false
+		}
+	}
+
+	if len(g.include) == 0 {
+		return true
+	}
+
+	for _, parts := range g.include {
+		if matchGlob(parts, names) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *grepper) grep(f *File) error {
+	if !g.o.Binary {
+		bin, err := f.IsBinary()
+		if err != nil {
+			return err
+		}
+
+		if bin {
+			return nil
+		}
+	}
+
+	var before []string
+	var pending []int // the results still missing lines of context after
+	var n int
+	return f.ForEachLine(g.o.MaxLineLength, func(line string) error {
+		n++
+		for _, i := range pending {
+			g.results[i].After = append(g.results[i].After, line)
+		}
+
+		for len(pending) != 0 && len(g.results[pending[0]].After) == g.o.Context {
+			pending = pending[1:]
+		}
+
+		if g.re.MatchString(line) {
+			g.results = append(g.results, GrepResult{
+				Path:       f.Name,
+				LineNumber: n,
+				Line:       line,
+				Before:     append([]string(nil), before...),
+			})
+
+			if g.o.Context > 0 {
+				pending = append(pending, len(g.results)-1)
+			}
+		}
+
+		if g.o.Context > 0 {
+			before = append(before, line)
+			if len(before) > g.o.Context {
+				before = before[1:]
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"path"
+	"regexp"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeGrep struct {
+	tree *Tree
+}
+
+var _ = Suite(&SuiteTreeGrep{})
+
+func (s *SuiteTreeGrep) SetUpSuite(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+
+	s.tree, err = commit.Tree()
+	c.Assert(err, IsNil)
+}
+
+func grepLineNumbers(results []GrepResult) []int {
+	var lines []int
+	for _, r := range results {
+		lines = append(lines, r.LineNumber)
+	}
+
+	return lines
+}
+
+// the expected lines have been obtained with git grep -n -I
+func (s *SuiteTreeGrep) TestGrepGlobs(c *C) {
+	results, err := s.tree.Grep(GrepOptions{
+		Pattern: regexp.MustCompile("^func "),
+		Include: []string{"**/*.go"},
+		Exclude: []string{"vendor/**"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(grepLineNumbers(results), DeepEquals, []int{
+		31, 37, 41, 45, 49, 53, 57, 62, 67, 74, 79, 86, 101, 110, 116, 124, 128, 134, 138,
+	})
+	c.Assert(results[0].Path, Equals, "go/example.go")
+	c.Assert(results[0].Line, Equals, "func NewWriter() *Writer {")
+
+	results, err = s.tree.Grep(GrepOptions{
+		Pattern: regexp.MustCompile("^func "),
+		Include: []string{"vendor/*"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []GrepResult{
+		{Path: "vendor/foo.go", LineNumber: 5, Line: "func main() {"},
+	})
+}
+
+func (s *SuiteTreeGrep) TestGrepIgnoreCaseAndContext(c *C) {
+	results, err := s.tree.Grep(GrepOptions{
+		Pattern:    regexp.MustCompile("copyright"),
+		IgnoreCase: true,
+		Context:    1,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []GrepResult{{
+		Path:       "LICENSE",
+		LineNumber: 3,
+		Line:       "Copyright (c) 2015 Tyba",
+		Before:     []string{""},
+		After:      []string{""},
+	}, {
+		Path:       "LICENSE",
+		LineNumber: 12,
+		Line:       "The above copyright notice and this permission notice shall be included in all",
+		Before:     []string{""},
+		After:      []string{"copies or substantial portions of the Software."},
+	}, {
+		Path:       "LICENSE",
+		LineNumber: 18,
+		Line:       "AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER",
+		Before:     []string{"FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE"},
+		After:      []string{"LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,"},
+	}})
+}
+
+func (s *SuiteTreeGrep) TestGrepOverlappingContext(c *C) {
+	r := NewPlainRepository()
+	tree := newTestTree(c, r,
+		TreeEntry{Name: "a", Mode: 0100644, Hash: newTestBlob(c, r, "1\nx2\nx3\n4\n5\n6\nx7")},
+		TreeEntry{Name: "link", Mode: 0120000, Hash: newTestBlob(c, r, "x")},
+	)
+
+	results, err := tree.Grep(GrepOptions{Pattern: regexp.MustCompile("x"), Context: 2})
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []GrepResult{
+		{Path: "a", LineNumber: 2, Line: "x2", Before: []string{"1"}, After: []string{"x3", "4"}},
+		{Path: "a", LineNumber: 3, Line: "x3", Before: []string{"1", "x2"}, After: []string{"4", "5"}},
+		{Path: "a", LineNumber: 7, Line: "x7", Before: []string{"5", "6"}},
+	})
+}
+
+func (s *SuiteTreeGrep) TestGrepBinary(c *C) {
+	r := NewPlainRepository()
+	tree := newTestTree(c, r,
+		TreeEntry{Name: "bin", Mode: 0100644, Hash: newTestBlob(c, r, "foo\x00\nfoo\n")},
+		TreeEntry{Name: "text", Mode: 0100644, Hash: newTestBlob(c, r, "foo\n")},
+	)
+
+	results, err := tree.Grep(GrepOptions{Pattern: regexp.MustCompile("foo")})
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, []GrepResult{{Path: "text", LineNumber: 1, Line: "foo"}})
+
+	results, err = tree.Grep(GrepOptions{Pattern: regexp.MustCompile("foo"), Binary: true})
+	c.Assert(err, IsNil)
+	c.Assert(grepLineNumbers(results), DeepEquals, []int{1, 2, 1})
+}
+
+func (s *SuiteTreeGrep) TestGrepErrors(c *C) {
+	_, err := s.tree.Grep(GrepOptions{})
+	c.Assert(err, Equals, ErrGrepPatternNotSet)
+
+	_, err = s.tree.Grep(GrepOptions{Pattern: regexp.MustCompile("x"), Include: []string{"["}})
+	c.Assert(err, Equals, path.ErrBadPattern)
+}
@@ -0,0 +1,87 @@
+package git
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/gitignore"
+)
+
+const gitignoreFile = ".gitignore"
+
+// IgnoreMatcher returns a gitignore.Matcher with the patterns of the
+// .gitignore files of the tree and its subtrees, every one of them scoped to
+// its directory. The patterns of the deeper directories take precedence over
+// the ones of their parents, as in git. The .gitignore files that are not
+// regular files, like symbolic links, are ignored.
+func (t *Tree) IgnoreMatcher() (gitignore.Matcher, error) {
+	var files []gitignoreFilePatterns
+	err := t.Walk(func(p string, e TreeEntry) error {
+		if e.Name != gitignoreFile || e.Mode&^0777 != treeEntryRegularType {
+			return nil
+		}
+
+		var domain []string
+		if dir := path.Dir(p); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+
+		ps, err := t.readGitignore(e.Hash, domain)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, gitignoreFilePatterns{domain: domain, patterns: ps})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the walk may find the files of some subtrees before the ones of their
+	// parents, if their names sort before .gitignore
+	sort.Stable(gitignoreFilesByDepth(files))
+
+	var ps []gitignore.Pattern
+	for _, f := range files {
+		ps = append(ps, f.patterns...)
+	}
+
+	return gitignore.NewMatcher(ps), nil
+}
+
+func (t *Tree) readGitignore(h core.Hash, domain []string) (ps []gitignore.Pattern, err error) {
+	obj, err := t.r.Storage.Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer checkClose(r, &err)
+
+	return gitignore.ParsePatterns(r, domain)
+}
+
+type gitignoreFilePatterns struct {
+	domain   []string
+	patterns []gitignore.Pattern
+}
+
+type gitignoreFilesByDepth []gitignoreFilePatterns
+
+func (s gitignoreFilesByDepth) Len() int {
+	return len(s)
+}
+
+func (s gitignoreFilesByDepth) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s gitignoreFilesByDepth) Less(i, j int) bool {
+	return len(s[i].domain) < len(s[j].domain)
+}
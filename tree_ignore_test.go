@@ -0,0 +1,74 @@
+package git
+
+import (
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeIgnore struct{}
+
+var _ = Suite(&SuiteTreeIgnore{})
+
+func (s *SuiteTreeIgnore) TestIgnoreMatcher(c *C) {
+	r := NewPlainRepository()
+	sub := newTestTree(c, r,
+		// sorts before .gitignore, so it is found before the one of the root
+		TreeEntry{Name: "+", Mode: 040000, Hash: newTestTree(c, r,
+			TreeEntry{Name: ".gitignore", Mode: 0100644, Hash: newTestBlob(c, r, "!b.log\n")},
+		).Hash},
+		TreeEntry{Name: ".gitignore", Mode: 0100644, Hash: newTestBlob(c, r, "!*.log\n/local\n")},
+	)
+	tree := newTestTree(c, r,
+		TreeEntry{Name: "+", Mode: 040000, Hash: newTestTree(c, r,
+			TreeEntry{Name: ".gitignore", Mode: 0100644, Hash: newTestBlob(c, r, "!a.log\n")},
+		).Hash},
+		TreeEntry{Name: ".gitignore", Mode: 0100644, Hash: newTestBlob(c, r, "*.log\ntmp/\n")},
+		TreeEntry{Name: "link", Mode: 040000, Hash: newTestTree(c, r,
+			TreeEntry{Name: ".gitignore", Mode: 0120000, Hash: newTestBlob(c, r, "*")},
+		).Hash},
+		TreeEntry{Name: "sub", Mode: 040000, Hash: sub.Hash},
+	)
+
+	m, err := tree.IgnoreMatcher()
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"+/a.log", false, false},
+		{"+/b.log", false, true},
+		{"sub/a.log", false, false},
+		{"sub/+/a.log", false, false},
+		{"sub/+/b.log", false, false},
+		{"sub/local", false, true},
+		{"local", false, false},
+		{"tmp", true, true},
+		{"tmp", false, false},
+		{"sub/tmp/a.log", false, true},
+		{"link/foo", false, false},
+	} {
+		c.Assert(m.Match(strings.Split(t.path, "/"), t.isDir), Equals, t.ignored, Commentf("path=%s", t.path))
+	}
+}
+
+func (s *SuiteTreeIgnore) TestIgnoreMatcherFixture(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	m, err := tree.IgnoreMatcher()
+	c.Assert(err, IsNil)
+	c.Assert(m.Match([]string{"CHANGELOG"}, false), Equals, false)
+	c.Assert(m.Match([]string{"java", "Foo.class"}, false), Equals, true)
+	c.Assert(m.Match([]string{"hs_err_pid42.log"}, false), Equals, true)
+	c.Assert(m.Match([]string{".mtj.tmp"}, true), Equals, true)
+	c.Assert(m.Match([]string{".mtj.tmp"}, false), Equals, false)
+}
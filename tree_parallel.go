@@ -0,0 +1,262 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v3/core"
+)
+
+// parallelBufferPerWorker is the number of files, per worker, that may be
+// read ahead of the ones returned by a parallel FileIter.
+const parallelBufferPerWorker = 4
+
+var errParallelWalkStopped = errors.New("parallel walk stopped")
+
+// FilesParallel returns a FileIter over the files of the tree and its
+// subtrees, like Files, whose objects are read from the storage by the given
+// number of goroutines. The subtrees and blobs are read ahead of the files
+// returned by Next, but the files are still returned in tree order; the
+// files read ahead are bounded by the number of workers.
+//
+// The storage of the repository is only used from several goroutines if it
+// implements core.ConcurrentSafeObjectStorage and reports that it is safe,
+// otherwise, or if workers is lower than 2, the iterator is the same as the
+// one returned by Files. The iterator must be closed to release its
+// goroutines if it is not exhausted.
+func (t *Tree) FilesParallel(workers int) *FileIter {
+	s, ok := t.r.Storage.(core.ConcurrentSafeObjectStorage)
+	if workers < 2 || !ok || !s.ConcurrentSafe() {
+		return t.Files()
+	}
+
+	return &FileIter{p: newParallelFileWalker(t.r, t, workers)}
+}
+
+// objectFuture is an object being read by the workers of a
+// parallelFileWalker, ready is closed once obj or err are set.
+type objectFuture struct {
+	h     core.Hash
+	name  string
+	mode  os.FileMode
+	ready chan struct{}
+	obj   Object
+	err   error
+}
+
+func newObjectFuture(h core.Hash, name string, mode os.FileMode) *objectFuture {
+	return &objectFuture{h: h, name: name, mode: mode, ready: make(chan struct{})}
+}
+
+// parallelFileWalker walks a tree in a goroutine, sending the objects of
+// the entries and the prefetched subtrees to a pool of workers, and queues
+// the futures of the files, in tree order, in a bounded channel, so the
+// files are returned in order as soon as they are read. The goroutines are
+// started by the first call to next.
+type parallelFileWalker struct {
+	r        *Repository
+	root     *Tree
+	workers  int
+	maxDepth int
+
+	started bool
+	jobs    chan *objectFuture
+	files   chan *objectFuture
+	done    chan struct{}
+	wg      sync.WaitGroup
+	err     error // returned by next once the walk is finished
+}
+
+func newParallelFileWalker(r *Repository, t *Tree, workers int) *parallelFileWalker {
+	return &parallelFileWalker{
+		r:        r,
+		root:     t,
+		workers:  workers,
+		maxDepth: DefaultMaxTreeDepth,
+	}
+}
+
+func (p *parallelFileWalker) start() {
+	p.started = true
+	p.err = nil
+	p.jobs = make(chan *objectFuture, p.workers)
+	p.files = make(chan *objectFuture, p.workers*parallelBufferPerWorker)
+	p.done = make(chan struct{})
+
+	p.wg.Add(p.workers + 1)
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+
+	go p.produce()
+}
+
+func (p *parallelFileWalker) work() {
+	defer p.wg.Done()
+	for f := range p.jobs {
+		select {
+		case <-p.done:
+			f.err = errParallelWalkStopped
+		default:
+			f.obj, f.err = p.r.Object(f.h)
+		}
+
+		close(f.ready)
+	}
+}
+
+func (p *parallelFileWalker) produce() {
+	defer p.wg.Done()
+	defer close(p.files)
+	defer close(p.jobs)
+
+	err := p.walk(p.root, "", 0)
+	if err == nil || err == errParallelWalkStopped {
+		return
+	}
+
+	f := newObjectFuture(core.ZeroHash, "", 0)
+	f.err = err
+	close(f.ready)
+	p.queue(f)
+}
+
+// walk walks the tree t, found at base, as TreeWalker does: the objects not
+// found in the storage, like submodules, are skipped.
+func (p *parallelFileWalker) walk(t *Tree, base string, depth int) error {
+	if depth > p.maxDepth {
+		return &MaxTreeDepthError{Path: base, MaxDepth: p.maxDepth}
+	}
+
+	// the subtrees are read in advance, they are needed to walk on
+	subtrees := make(map[int]*objectFuture, 0)
+	for i, e := range t.Entries {
+		if e.Mode == treeEntryDirMode {
+			f := newObjectFuture(e.Hash, path.Join(base, e.Name), e.Mode)
+			if !p.submit(f) {
+				return errParallelWalkStopped
+			}
+
+			subtrees[i] = f
+		}
+	}
+
+	for i, e := range t.Entries {
+		f, ok := subtrees[i]
+		if !ok {
+			if isSubmoduleMode(e.Mode) {
+				has, err := p.r.hasObject(e.Hash)
+				if err != nil {
+					return err
+				}
+
+				if !has {
+					continue
+				}
+			}
+
+			f = newObjectFuture(e.Hash, path.Join(base, e.Name), e.Mode)
+			if !p.submit(f) || !p.queue(f) {
+				return errParallelWalkStopped
+			}
+
+			continue
+		}
+
+		select {
+		case <-f.ready:
+		case <-p.done:
+			return errParallelWalkStopped
+		}
+
+		if f.err == ErrObjectNotFound {
+			continue
+		}
+		if f.err != nil {
+			return f.err
+		}
+
+		if tree, ok := f.obj.(*Tree); ok {
+			if err := p.walk(tree, f.name, depth+1); err != nil {
+				return err
+			}
+		} else if !p.queue(f) {
+			return errParallelWalkStopped
+		}
+	}
+
+	return nil
+}
+
+func (p *parallelFileWalker) submit(f *objectFuture) bool {
+	select {
+	case p.jobs <- f:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *parallelFileWalker) queue(f *objectFuture) bool {
+	select {
+	case p.files <- f:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *parallelFileWalker) next() (*File, error) {
+	if !p.started {
+		p.start()
+	}
+
+	for p.err == nil {
+		f, ok := <-p.files
+		if !ok {
+			p.err = io.EOF
+			break
+		}
+
+		<-f.ready
+		if f.err == ErrObjectNotFound {
+			continue
+		}
+		if f.err != nil {
+			p.err = f.err
+			break
+		}
+
+		if blob, ok := f.obj.(*Blob); ok {
+			return newFile(f.name, f.mode, blob), nil
+		}
+	}
+
+	return nil, p.err
+}
+
+// stop stops the goroutines, if they are running, and waits for them.
+func (p *parallelFileWalker) stop() {
+	if !p.started || p.done == nil {
+		return
+	}
+
+	close(p.done)
+	p.wg.Wait()
+	p.done = nil
+}
+
+func (p *parallelFileWalker) close() {
+	p.stop()
+	p.started = true
+	p.err = io.EOF
+}
+
+func (p *parallelFileWalker) reset() {
+	p.stop()
+	p.started = false
+	p.err = nil
+}
@@ -0,0 +1,183 @@
+package git
+
+import (
+	"io"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeParallel struct {
+	repos map[string]*Repository
+}
+
+var _ = Suite(&SuiteTreeParallel{})
+
+func (s *SuiteTreeParallel) SetUpSuite(c *C) {
+	s.repos = unpackFixtures(c, fixtureRepos)
+}
+
+type fileIterEntry struct {
+	name string
+	hash core.Hash
+}
+
+func fileIterEntries(c *C, iter *FileIter) ([]fileIterEntry, error) {
+	defer iter.Close()
+
+	var entries []fileIterEntry
+	for {
+		f, err := iter.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, fileIterEntry{f.Name, f.Hash})
+	}
+}
+
+func (s *SuiteTreeParallel) TestFilesParallel(c *C) {
+	for url, r := range s.repos {
+		commits, err := r.Commits()
+		c.Assert(err, IsNil)
+
+		for {
+			commit, err := commits.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			tree, err := commit.Tree()
+			c.Assert(err, IsNil)
+
+			expected, err := fileIterEntries(c, tree.Files())
+			c.Assert(err, IsNil)
+
+			iter := tree.FilesParallel(4)
+			c.Assert(iter.p, NotNil)
+			obtained, err := fileIterEntries(c, iter)
+			c.Assert(err, IsNil)
+			c.Assert(obtained, DeepEquals, expected, Commentf("repo=%s, commit=%s", url, commit.Hash))
+		}
+	}
+}
+
+func (s *SuiteTreeParallel) TestFilesParallelSkipsSubmodules(c *C) {
+	tree, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+
+	expected, err := fileIterEntries(c, tree.Files())
+	c.Assert(err, IsNil)
+	obtained, err := fileIterEntries(c, tree.FilesParallel(2))
+	c.Assert(err, IsNil)
+	c.Assert(obtained, DeepEquals, expected)
+	c.Assert(obtained, HasLen, 6)
+}
+
+func (s *SuiteTreeParallel) TestFilesParallelMaxDepth(c *C) {
+	tree, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+
+	serial := tree.Files()
+	serial.SetMaxDepth(1)
+	expected, expectedErr := fileIterEntries(c, serial)
+
+	parallel := tree.FilesParallel(2)
+	parallel.SetMaxDepth(1)
+	obtained, err := fileIterEntries(c, parallel)
+
+	c.Assert(err, DeepEquals, expectedErr)
+	c.Assert(err, FitsTypeOf, &MaxTreeDepthError{})
+	c.Assert(obtained, DeepEquals, expected)
+}
+
+func (s *SuiteTreeParallel) TestFilesParallelCloseAndReset(c *C) {
+	r := s.repos["https://github.com/spinnaker/spinnaker.git"]
+	commit, err := r.Commit(core.NewHash("b32b2aecae2cfca4840dd480f8082da206a538da"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	expected, err := fileIterEntries(c, tree.Files())
+	c.Assert(err, IsNil)
+
+	iter := tree.FilesParallel(4)
+	f, err := iter.Next()
+	c.Assert(err, IsNil)
+	c.Assert(f.Name, Equals, expected[0].name)
+
+	// closing the iterator stops its goroutines
+	iter.Close()
+	c.Assert(iter.p.done, IsNil)
+	_, err = iter.Next()
+	c.Assert(err, Equals, io.EOF)
+
+	iter.Reset()
+	obtained, err := fileIterEntries(c, iter)
+	c.Assert(err, IsNil)
+	c.Assert(obtained, DeepEquals, expected)
+}
+
+func (s *SuiteTreeParallel) TestFilesParallelFallback(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	c.Assert(tree.FilesParallel(1).p, IsNil)
+
+	serialRepo := &Repository{Storage: serialStorage{r.Storage}}
+	tree, err = serialRepo.Tree(tree.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(tree.FilesParallel(4).p, IsNil)
+}
+
+// serialStorage hides the ConcurrentSafe method of a storage
+type serialStorage struct {
+	core.ObjectStorage
+}
+
+// latencyStorage is a storage whose Get sleeps for a while, as a remote one
+type latencyStorage struct {
+	core.ObjectStorage
+	latency time.Duration
+}
+
+func (s latencyStorage) Get(h core.Hash) (core.Object, error) {
+	time.Sleep(s.latency)
+	return s.ObjectStorage.Get(h)
+}
+
+func (s latencyStorage) ConcurrentSafe() bool {
+	return true
+}
+
+func (s *SuiteTreeParallel) benchmarkFiles(c *C, files func(*Tree) *FileIter) {
+	r := s.repos["https://github.com/spinnaker/spinnaker.git"]
+	r = &Repository{Storage: latencyStorage{r.Storage, 100 * time.Microsecond}}
+	commit, err := r.Commit(core.NewHash("b32b2aecae2cfca4840dd480f8082da206a538da"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		_, err := fileIterEntries(c, files(tree))
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *SuiteTreeParallel) BenchmarkFiles(c *C) {
+	s.benchmarkFiles(c, func(t *Tree) *FileIter { return t.Files() })
+}
+
+func (s *SuiteTreeParallel) BenchmarkFilesParallel(c *C) {
+	s.benchmarkFiles(c, func(t *Tree) *FileIter { return t.FilesParallel(8) })
+}
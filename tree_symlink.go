@@ -0,0 +1,126 @@
+package git
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// maximum number of symbolic links followed resolving a path, the same
+	// limit of Linux before failing with ELOOP
+	maxSymlinkHops = 40
+	// maximum length of the target of a symbolic link, as PATH_MAX
+	maxSymlinkTargetLength = 4096
+)
+
+var (
+	// ErrSymlinkLoop is returned when more than 40 symbolic links are found
+	// resolving a path, as it happens with cyclic links.
+	ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+	// ErrSymlinkOutsideTree is returned when a symbolic link found resolving
+	// a path has an absolute target, or a relative target out of the tree.
+	ErrSymlinkOutsideTree = errors.New("symbolic link target outside the tree")
+)
+
+// FileFollowSymlinks is like File but the symbolic links found in the path,
+// including the last component, are followed as long as their targets are
+// relative paths inside the tree. The name of the returned file is the path
+// of the file after resolving all the links.
+//
+// Links pointing out of the tree, or with absolute targets, make it fail
+// with ErrSymlinkOutsideTree, and following more than 40 links, as with
+// cyclic links, makes it fail with ErrSymlinkLoop.
+func (t *Tree) FileFollowSymlinks(path string) (*File, error) {
+	pending, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &symlinkResolver{trees: []*Tree{t}, pending: pending}
+	return r.resolve()
+}
+
+// symlinkResolver walks a path, keeping the trees and names of the already
+// resolved components.
+type symlinkResolver struct {
+	trees   []*Tree
+	names   []string
+	pending []string
+	hops    int
+}
+
+func (r *symlinkResolver) resolve() (*File, error) {
+	for len(r.pending) != 0 {
+		name := r.pending[0]
+		r.pending = r.pending[1:]
+
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(r.names) == 0 {
+				return nil, ErrSymlinkOutsideTree
+			}
+
+			r.trees = r.trees[:len(r.trees)-1]
+			r.names = r.names[:len(r.names)-1]
+			continue
+		}
+
+		tree := r.trees[len(r.trees)-1]
+		e, err := tree.entry(name)
+		if err != nil {
+			return nil, ErrFileNotFound
+		}
+
+		if e.IsSymlink() {
+			if err := r.follow(tree, e); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if len(r.pending) == 0 {
+			return tree.file(strings.Join(append(r.names, name), "/"), e)
+		}
+
+		sub, err := tree.subtree(e)
+		if err != nil {
+			return nil, ErrFileNotFound
+		}
+
+		r.trees = append(r.trees, sub)
+		r.names = append(r.names, name)
+	}
+
+	// the path, or the target of its last link, is the tree itself or one of
+	// the directories containing it
+	return nil, ErrIsDirectory
+}
+
+// follow replaces the link e, found in tree, by the components of its
+// target.
+func (r *symlinkResolver) follow(tree *Tree, e *TreeEntry) error {
+	r.hops++
+	if r.hops > maxSymlinkHops {
+		return ErrSymlinkLoop
+	}
+
+	link, err := tree.file(e.Name, e)
+	if err != nil {
+		return err
+	}
+
+	target, err := link.ContentsLimited(maxSymlinkTargetLength)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(target, "/") {
+		return ErrSymlinkOutsideTree
+	}
+
+	r.pending = append(strings.Split(target, "/"), r.pending...)
+	return nil
+}
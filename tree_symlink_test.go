@@ -0,0 +1,110 @@
+package git
+
+import (
+	"os"
+	"strconv"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTreeSymlink struct {
+	tree *Tree
+}
+
+var _ = Suite(&SuiteTreeSymlink{})
+
+func (s *SuiteTreeSymlink) SetUpSuite(c *C) {
+	r := NewPlainRepository()
+
+	b := NewTreeBuilder()
+	for _, e := range []struct {
+		path    string
+		content string
+		link    bool
+	}{
+		{"docs/v1/README.md", "v1", false},
+		{"docs/v2/README.md", "v2", false},
+		{"docs/latest", "v2", true},
+		{"docs/stable", "latest", true},
+		{"docs/previous", "./../docs/v1/", true},
+		{"docs/readme", "latest/README.md", true},
+		{"README.md", "docs/stable/README.md", true},
+		{"loop/a", "b", true},
+		{"loop/b", "a", true},
+		{"loop/self", "self/file", true},
+		{"escape/up", "../../etc/passwd", true},
+		{"escape/absolute", "/etc/passwd", true},
+		{"escape/root", "../..", true},
+		{"escape/top", "..", true},
+		{"broken", "not-found", true},
+	} {
+		mode := 0100644
+		if e.link {
+			mode = 0120000
+		}
+
+		b.Insert(e.path, newTestBlob(c, r, e.content), os.FileMode(mode))
+	}
+
+	// a chain of links from chain/1 to chain/42, which is not a link, so
+	// chain/1 needs a link more than the limit
+	for i := 1; i <= maxSymlinkHops+1; i++ {
+		target := strconv.Itoa(i + 1)
+		b.Insert("chain/"+strconv.Itoa(i), newTestBlob(c, r, target), 0120000)
+	}
+	b.Insert("chain/"+strconv.Itoa(maxSymlinkHops+2), newTestBlob(c, r, "end"), 0100644)
+
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	s.tree, err = r.Tree(h)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteTreeSymlink) TestFileFollowSymlinks(c *C) {
+	for i, t := range []struct {
+		path     string
+		name     string // the expected name of the file
+		contents string // the expected contents of the file
+		err      error  // the expected error
+	}{
+		{"docs/v2/README.md", "docs/v2/README.md", "v2", nil},
+		{"docs/latest/README.md", "docs/v2/README.md", "v2", nil},
+		{"docs/stable/README.md", "docs/v2/README.md", "v2", nil},
+		{"docs/previous/README.md", "docs/v1/README.md", "v1", nil},
+		{"docs/readme", "docs/v2/README.md", "v2", nil},
+		{"README.md", "docs/v2/README.md", "v2", nil},
+		{"chain/2", "chain/42", "end", nil},
+		{"chain/1", "", "", ErrSymlinkLoop},
+		{"loop/a", "", "", ErrSymlinkLoop},
+		{"loop/self", "", "", ErrSymlinkLoop},
+		{"escape/up", "", "", ErrSymlinkOutsideTree},
+		{"escape/absolute", "", "", ErrSymlinkOutsideTree},
+		{"escape/root/README.md", "", "", ErrSymlinkOutsideTree},
+		{"escape/top/README.md", "docs/v2/README.md", "v2", nil},
+		{"broken", "", "", ErrFileNotFound},
+		{"docs/latest/not-found", "", "", ErrFileNotFound},
+		{"docs/latest", "", "", ErrIsDirectory},
+		{"docs/v2/README.md/x", "", "", ErrFileNotFound},
+		{"../README.md", "", "", ErrInvalidPath},
+	} {
+		com := Commentf("subtest %d, path=%s", i, t.path)
+		file, err := s.tree.FileFollowSymlinks(t.path)
+		c.Assert(err, Equals, t.err, com)
+		if t.err != nil {
+			continue
+		}
+
+		c.Assert(file.Name, Equals, t.name, com)
+		contents, err := file.Contents()
+		c.Assert(err, IsNil, com)
+		c.Assert(contents, Equals, t.contents, com)
+	}
+
+	// the links are not followed by File
+	file, err := s.tree.File("README.md")
+	c.Assert(err, IsNil)
+	c.Assert(file.IsSymlink(), Equals, true)
+	_, err = s.tree.File("docs/latest/README.md")
+	c.Assert(err, Equals, ErrFileNotFound)
+}
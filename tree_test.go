@@ -1,10 +1,17 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"io"
+	"math/rand"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -188,7 +195,8 @@ func (s *SuiteTree) TestFile(c *C) {
 		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
 		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
 
-		tree := commit.Tree()
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
 		file, err := tree.File(t.path)
 		found := err == nil
 
@@ -205,6 +213,204 @@ func (s *SuiteTree) TestFile(c *C) {
 	}
 }
 
+func (s *SuiteTree) TestFileErrors(c *C) {
+	r := s.repos["https://github.com/alcortesm/binary-relations.git"]
+	commit, err := r.Commit(core.NewHash("c44b5176e99085c8fe36fa27b045590a7b9d34c9"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	for _, path := range []string{"not-found", "src/not-found", "Makefile/not-found"} {
+		_, err = tree.File(path)
+		c.Assert(err, Equals, ErrFileNotFound, Commentf("path=%s", path))
+	}
+
+	_, err = tree.File("src/map-slice")
+	c.Assert(err, Equals, ErrIsDirectory)
+
+	_, err = tree.File("src/binrels")
+	c.Assert(err, DeepEquals, &SubmoduleNotResolvedError{
+		Path: "src/binrels",
+		Hash: core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b"),
+	})
+}
+
+func (s *SuiteTree) TestFileCI(c *C) {
+	r := NewPlainRepository()
+	upper := newTestBlob(c, r, "upper")
+	title := newTestBlob(c, r, "title")
+	guide := newTestBlob(c, r, "guide")
+
+	b := NewTreeBuilder()
+	b.Insert("README.md", upper, 0100644)
+	b.Insert("Readme.md", title, 0100644)
+	b.Insert("Docs/Guide.txt", guide, 0100644)
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	tree, err := r.Tree(h)
+	c.Assert(err, IsNil)
+
+	for i, t := range []struct {
+		path string
+		name string
+		hash core.Hash
+	}{
+		{"README.md", "README.md", upper},
+		{"Readme.md", "Readme.md", title},
+		{"readme.md", "README.md", upper},
+		{"ReadMe.MD", "README.md", upper},
+		{"docs/guide.TXT", "Docs/Guide.txt", guide},
+		{"Docs/Guide.txt", "Docs/Guide.txt", guide},
+	} {
+		com := Commentf("subtest %d, path=%s", i, t.path)
+		file, err := tree.FileCI(t.path)
+		c.Assert(err, IsNil, com)
+		c.Assert(file.Name, Equals, t.name, com)
+		c.Assert(file.Hash, Equals, t.hash, com)
+	}
+
+	_, err = tree.FileCI("docs")
+	c.Assert(err, Equals, ErrIsDirectory)
+
+	for _, path := range []string{"not-found", "docs/not-found", "readme.md/not-found"} {
+		_, err = tree.FileCI(path)
+		c.Assert(err, Equals, ErrFileNotFound, Commentf("path=%s", path))
+	}
+
+	_, err = tree.File("readme.md")
+	c.Assert(err, Equals, ErrFileNotFound)
+}
+
+func (s *SuiteTree) TestTree(c *C) {
+	for i, t := range []struct {
+		repo     string // the repo name as in localRepos
+		commit   string // the commit to search for the subtree
+		path     string // the path of the subtree to find
+		treeHash string // expected hash of the returned subtree
+		err      error  // expected error
+	}{
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc",
+			"5fba7b5285ff9bb2e369dda3f4279cb53b755808", nil,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/sites-available",
+			"48112f982a38f0be464dbe1b10c37bf665a4b329", nil,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/not-found/sites-available",
+			"", ErrEntryNotFound,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/not-found",
+			"", ErrEntryNotFound,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/sites-available/spinnaker.conf",
+			"", ErrDirectoryNotFound,
+		},
+		{
+			"https://github.com/alcortesm/binary-relations.git",
+			"c44b5176e99085c8fe36fa27b045590a7b9d34c9", "Makefile/src",
+			"", ErrDirectoryNotFound,
+		},
+	} {
+		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
+
+		com := Commentf("subtest %d, path=%s, commit=%s", i, t.path, t.commit)
+		root, err := commit.Tree()
+		c.Assert(err, IsNil)
+		tree, err := root.Tree(t.path)
+		c.Assert(err, Equals, t.err, com)
+		if t.err != nil {
+			continue
+		}
+
+		c.Assert(tree.Hash.String(), Equals, t.treeHash, com)
+		c.Assert(len(tree.Entries) > 0, Equals, true, com)
+	}
+}
+
+func (s *SuiteTree) TestFindEntry(c *C) {
+	for i, t := range []struct {
+		repo      string // the repo name as in localRepos
+		commit    string // the commit to search for the entry
+		path      string // the path of the entry to find
+		entryHash string // expected hash of the returned entry
+		mode      string // expected mode of the returned entry
+		err       error  // expected error
+	}{
+		{
+			"https://github.com/tyba/git-fixture.git",
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "LICENSE",
+			"c192bd6a24ea1ab01d78686e417c8bdc7c3d197f", "100644", nil,
+		},
+		{
+			"https://github.com/tyba/git-fixture.git",
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "vendor",
+			"cf4aa3b38974fb7d81f367c0830f7d78d65ab86b", "40000", nil,
+		},
+		{
+			"https://github.com/tyba/git-fixture.git",
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "not-found",
+			"", "", ErrEntryNotFound,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/sites-available/spinnaker.conf",
+			"1d452c616be4fb16d2cc6b8a7e7a2208a6e64d2d", "100644", nil,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/sites-available/not-found",
+			"", "", ErrEntryNotFound,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/not-found/sites-available/spinnaker.conf",
+			"", "", ErrDirectoryNotFound,
+		},
+		{
+			"https://github.com/spinnaker/spinnaker.git",
+			"b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/sites-available/spinnaker.conf/not-found",
+			"", "", ErrDirectoryNotFound,
+		},
+		// git submodule
+		{
+			"https://github.com/cpcs499/Final_Pres_P.git",
+			"70bade703ce556c2c7391a8065c45c943e8b6bc3", "Final",
+			"a772b2445793d616a1b5deb4a36738a2c3a4cc37", "160000", nil,
+		},
+		{
+			"https://github.com/cpcs499/Final_Pres_P.git",
+			"70bade703ce556c2c7391a8065c45c943e8b6bc3", "Final/not-found",
+			"", "", ErrDirectoryNotFound,
+		},
+	} {
+		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
+
+		com := Commentf("subtest %d, path=%s, commit=%s", i, t.path, t.commit)
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		entry, err := tree.FindEntry(t.path)
+		c.Assert(err, Equals, t.err, com)
+		if t.err != nil {
+			continue
+		}
+
+		c.Assert(entry.Hash.String(), Equals, t.entryHash, com)
+		c.Assert(strconv.FormatInt(int64(entry.Mode), 8), Equals, t.mode, com)
+	}
+}
+
 func (s *SuiteTree) TestFiles(c *C) {
 	for i, t := range []struct {
 		repo   string   // the repo name as in localRepos
@@ -260,7 +466,8 @@ func (s *SuiteTree) TestFiles(c *C) {
 		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
 		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
 
-		tree := commit.Tree()
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
 		var output []string
 		iter := tree.Files()
 		defer iter.Close()
@@ -274,6 +481,99 @@ func (s *SuiteTree) TestFiles(c *C) {
 	}
 }
 
+func (s *SuiteTree) TestFilesByPrefix(c *C) {
+	for i, t := range []struct {
+		repo   string   // the repo name as in localRepos
+		commit string   // the commit to search for the files
+		prefix string   // the prefix of the files
+		files  []string // the expected files, in tree order
+	}{
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "json", []string{
+			"json/long.json", "json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "json/", []string{
+			"json/long.json", "json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "/json//", []string{
+			"json/long.json", "json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "json/short.json", []string{
+			"json/short.json",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "LICENSE", []string{
+			"LICENSE",
+		}},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "not-found", nil},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "json/not-found", nil},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "LICENSE/not-found", nil},
+		{"https://github.com/tyba/git-fixture.git", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", "/", []string{
+			".gitignore", "CHANGELOG", "LICENSE", "binary.jpg", "go/example.go",
+			"json/long.json", "json/short.json", "php/crappy.php", "vendor/foo.go",
+		}},
+		{"https://github.com/spinnaker/spinnaker.git", "b32b2aecae2cfca4840dd480f8082da206a538da", "etc/apache2/", []string{
+			"etc/apache2/sites-available/spinnaker.conf",
+		}},
+	} {
+		commit, err := s.repos[t.repo].Commit(core.NewHash(t.commit))
+		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
+
+		var output []string
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		iter := tree.FilesByPrefix(t.prefix)
+		for file, err := iter.Next(); err == nil; file, err = iter.Next() {
+			output = append(output, file.Name)
+		}
+		iter.Close()
+
+		c.Assert(output, DeepEquals, t.files, Commentf("subtest %d, prefix=%s", i, t.prefix))
+	}
+}
+
+func (s *SuiteTree) TestFilesByPrefixErrors(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	for _, prefix := range []string{"..", "../json", "json/../LICENSE", "json/.."} {
+		iter := tree.FilesByPrefix(prefix)
+		_, err := iter.Next()
+		c.Assert(err, Equals, ErrInvalidPath, Commentf("prefix=%q", prefix))
+		iter.Close()
+	}
+
+	json, err := tree.FindEntry("json")
+	c.Assert(err, IsNil)
+	broken := &Repository{Storage: brokenStorage{r.Storage, json.Hash}}
+	tree, err = broken.Tree(tree.Hash)
+	c.Assert(err, IsNil)
+
+	for _, prefix := range []string{"json", "json/short.json"} {
+		iter := tree.FilesByPrefix(prefix)
+		_, err := iter.Next()
+		c.Assert(err, Equals, errBrokenStorage, Commentf("prefix=%q", prefix))
+		iter.Close()
+	}
+}
+
+var errBrokenStorage = errors.New("broken storage")
+
+// brokenStorage fails to read the object with the given hash.
+type brokenStorage struct {
+	core.ObjectStorage
+	broken core.Hash
+}
+
+func (s brokenStorage) Get(h core.Hash) (core.Object, error) {
+	if h == s.broken {
+		return nil, errBrokenStorage
+	}
+
+	return s.ObjectStorage.Get(h)
+}
+
 // This core.Object implementation has a reader that only returns 6
 // bytes at a time, this should simulate the conditions when a read
 // returns less bytes than asked, for example when reading a hash which
@@ -1478,3 +1778,419 @@ func EntriesEquals(a, b []TreeEntry) bool {
 
 	return true
 }
+
+func (s *SuiteTree) TestEncodeRoundTrip(c *C) {
+	for name, r := range s.repos {
+		iter, err := r.Storage.Iter(core.TreeObject)
+		c.Assert(err, IsNil)
+
+		for {
+			obj, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			c.Assert(err, IsNil)
+
+			tree := &Tree{}
+			c.Assert(tree.Decode(obj), IsNil)
+
+			encoded := &memory.Object{}
+			c.Assert(tree.Encode(encoded), IsNil)
+			com := Commentf("repo=%s tree=%s", name, obj.Hash())
+			c.Assert(string(encoded.Content()), Equals, string(obj.Content()), com)
+			c.Assert(encoded.Hash(), Equals, obj.Hash(), com)
+
+			decoded := &Tree{}
+			c.Assert(decoded.Decode(encoded), IsNil)
+			c.Assert(decoded.Entries, DeepEquals, tree.Entries, com)
+		}
+
+		iter.Close()
+	}
+}
+
+func (s *SuiteTree) TestEncodeSortsEntries(c *C) {
+	hash := core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99")
+	tree := &Tree{Entries: []TreeEntry{
+		{Name: "a", Mode: 040000, Hash: hash},
+		{Name: "a.c", Mode: 0100644, Hash: hash},
+		{Name: "a-b", Mode: 0100644, Hash: hash},
+	}}
+
+	obj := &memory.Object{}
+	c.Assert(tree.Encode(obj), IsNil)
+
+	decoded := &Tree{}
+	c.Assert(decoded.Decode(obj), IsNil)
+	c.Assert(decoded.Entries, DeepEquals, []TreeEntry{
+		{Name: "a-b", Mode: 0100644, Hash: hash},
+		{Name: "a.c", Mode: 0100644, Hash: hash},
+		{Name: "a", Mode: 040000, Hash: hash},
+	})
+	c.Assert(tree.Entries[0].Name, Equals, "a")
+}
+
+func (s *SuiteTree) TestEncodeFileModes(c *C) {
+	for i, t := range []struct {
+		mode     os.FileMode
+		expected os.FileMode
+		err      error
+	}{
+		{0040000, 0040000, nil},
+		{0100644, 0100644, nil},
+		{0100755, 0100755, nil},
+		{0120000, 0120000, nil},
+		{0160000, 0160000, nil},
+		{0644, 0100644, nil},
+		{0600, 0100644, nil},
+		{0755, 0100755, nil},
+		{0744, 0100755, nil},
+		{os.ModeDir | 0755, 0040000, nil},
+		{os.ModeSymlink | 0777, 0120000, nil},
+		{os.ModeDir | os.ModeSymlink, 0160000, nil},
+		{0100664, 0100664, nil},
+		{0100600, 0100600, nil},
+		{0140000, 0, ErrInvalidFileMode},
+		{os.ModeNamedPipe | 0644, 0, ErrInvalidFileMode},
+		{os.ModeDevice | 0644, 0, ErrInvalidFileMode},
+		{os.ModeSetuid | 0755, 0, ErrInvalidFileMode},
+	} {
+		com := Commentf("subtest %d, mode=%o", i, uint32(t.mode))
+		tree := &Tree{Entries: []TreeEntry{{Name: "foo", Mode: t.mode}}}
+
+		obj := &memory.Object{}
+		err := tree.Encode(obj)
+		c.Assert(err, Equals, t.err, com)
+		if err != nil {
+			continue
+		}
+
+		decoded := &Tree{}
+		c.Assert(decoded.Decode(obj), IsNil, com)
+		c.Assert(decoded.Entries[0].Mode, Equals, t.expected, com)
+	}
+}
+
+// the hash has been obtained writing the same content with git hash-object
+func (s *SuiteTree) TestEncodeLegacyFileMode(c *C) {
+	hash := core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99")
+	content := "100644 README\x00" + string(hash.Bytes()) + "100664 legacy\x00" + string(hash.Bytes())
+
+	obj := &memory.Object{}
+	obj.SetType(core.TreeObject)
+	obj.SetSize(int64(len(content)))
+	w, err := obj.Writer()
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte(content))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	c.Assert(obj.Hash().String(), Equals, "12dba4a5e7b4b2c151b32a2eddc2be453a0af508")
+
+	tree := &Tree{}
+	c.Assert(tree.Decode(obj), IsNil)
+	c.Assert(tree.Entries[1].Mode, Equals, os.FileMode(0100664))
+
+	encoded := &memory.Object{}
+	c.Assert(tree.Encode(encoded), IsNil)
+	c.Assert(string(encoded.Content()), Equals, content)
+	c.Assert(encoded.Hash().String(), Equals, "12dba4a5e7b4b2c151b32a2eddc2be453a0af508")
+}
+
+func (s *SuiteTree) TestFindEntriesByHash(c *C) {
+	r := NewPlainRepository()
+	bad := newTestBlob(c, r, "bad")
+	good := newTestBlob(c, r, "good")
+
+	b := NewTreeBuilder()
+	b.Insert("a/bad", bad, 0100644)
+	b.Insert("b/bad", bad, 0100644)
+	b.Insert("c/d/bad", bad, 0100755)
+	b.Insert("c/good", good, 0100644)
+	b.Insert("e", bad, 0100644)
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	tree, err := (&Repository{Storage: storage}).Tree(h)
+	c.Assert(err, IsNil)
+
+	paths, err := tree.FindEntriesByHash(bad)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"a/bad", "b/bad", "c/d/bad", "e"})
+
+	a, err := tree.FindEntry("a")
+	c.Assert(err, IsNil)
+	c.Assert(storage.gets[a.Hash], Equals, 1)
+
+	paths, err = tree.FindEntriesByHash(a.Hash)
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"a", "b"})
+
+	paths, err = tree.FindEntriesByHash(core.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+	c.Assert(err, IsNil)
+	c.Assert(paths, HasLen, 0)
+}
+
+func (s *SuiteTree) TestFindEntriesByHashFixture(c *C) {
+	r := s.repos["https://github.com/alcortesm/binary-relations.git"]
+	commit, err := r.Commit(core.NewHash("c44b5176e99085c8fe36fa27b045590a7b9d34c9"))
+	c.Assert(err, IsNil)
+
+	// the submodules are found but not descended into
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	paths, err := tree.FindEntriesByHash(core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b"))
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"src/binrels"})
+
+	paths, err = tree.FindEntriesByHash(core.NewHash("12431e98381dd5097e1a19fe53429c72ef1f328e"))
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{"src/map-slice/map-slice.go"})
+}
+
+func (s *SuiteTree) TestPathNormalization(c *C) {
+	r := s.repos["https://github.com/alcortesm/binary-relations.git"]
+	commit, err := r.Commit(core.NewHash("c44b5176e99085c8fe36fa27b045590a7b9d34c9"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	for i, t := range []struct {
+		path string // the path to look for
+		name string // the expected name of the file, empty if invalid
+	}{
+		{"src/map-slice/map-slice.go", "src/map-slice/map-slice.go"},
+		{"./src/map-slice/map-slice.go", "src/map-slice/map-slice.go"},
+		{"src//map-slice///map-slice.go", "src/map-slice/map-slice.go"},
+		{"/src/map-slice/map-slice.go", "src/map-slice/map-slice.go"},
+		{"src/map-slice/map-slice.go/", "src/map-slice/map-slice.go"},
+		{"src/./map-slice/./map-slice.go", "src/map-slice/map-slice.go"},
+		{"./Makefile", "Makefile"},
+		{"", ""},
+		{"/", ""},
+		{".", ""},
+		{".//./", ""},
+		{"..", ""},
+		{"../Makefile", ""},
+		{"src/../Makefile", ""},
+		{"src/map-slice/../../Makefile", ""},
+		{"a/../../etc", ""},
+		{"src/map-slice/..", ""},
+	} {
+		com := Commentf("subtest %d, path=%q", i, t.path)
+
+		file, err := tree.File(t.path)
+		_, entryErr := tree.FindEntry(t.path)
+		if t.name == "" {
+			c.Assert(err, Equals, ErrInvalidPath, com)
+			c.Assert(entryErr, Equals, ErrInvalidPath, com)
+			_, err = tree.Tree(t.path)
+			c.Assert(err, Equals, ErrInvalidPath, com)
+			_, err = tree.FileCI(t.path)
+			c.Assert(err, Equals, ErrInvalidPath, com)
+			continue
+		}
+
+		c.Assert(err, IsNil, com)
+		c.Assert(entryErr, IsNil, com)
+		c.Assert(file.Name, Equals, t.name, com)
+	}
+
+	sub, err := tree.Tree("./src//map-slice/")
+	c.Assert(err, IsNil)
+	c.Assert(sub.Entries, HasLen, 1)
+}
+
+func (s *SuiteTree) TestCount(c *C) {
+	for i, t := range []struct {
+		repo  string // the repo name as in localRepos
+		tree  string // the tree to count
+		files int    // expected number of files
+		trees int    // expected number of subtrees
+		size  int64  // expected size of the files
+	}{
+		// use git ls-tree -r -l and git ls-tree -r -d to get the expected values
+		{"https://github.com/tyba/git-fixture.git", "a8d315b2b1c615d43042c3a62402b8a54288cf5c", 9, 4, 310289},
+	} {
+		com := Commentf("subtest %d, tree=%s", i, t.tree)
+		tree, err := s.repos[t.repo].Tree(core.NewHash(t.tree))
+		c.Assert(err, IsNil, com)
+
+		files, trees, err := tree.Count()
+		c.Assert(err, IsNil, com)
+		c.Assert(files, Equals, t.files, com)
+		c.Assert(trees, Equals, t.trees, com)
+
+		size, err := tree.Size()
+		c.Assert(err, IsNil, com)
+		c.Assert(size, Equals, t.size, com)
+	}
+
+	commit, err := s.repos["https://github.com/spinnaker/spinnaker.git"].Commit(core.NewHash("b32b2aecae2cfca4840dd480f8082da206a538da"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	files, trees, err := tree.Count()
+	c.Assert(err, IsNil)
+	c.Assert(files, Equals, 114)
+	c.Assert(trees, Equals, 23)
+	size, err := tree.Size()
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(624777))
+}
+
+func (s *SuiteTree) TestCountDuplicatedSubtrees(c *C) {
+	r := NewPlainRepository()
+	foo := newTestBlob(c, r, "foo")
+	bar := newTestBlob(c, r, "bar!")
+
+	b := NewTreeBuilder()
+	b.Insert("a/b/foo", foo, 0100644)
+	b.Insert("a/bar", bar, 0100644)
+	b.Insert("c/b/foo", foo, 0100644)
+	b.Insert("c/bar", bar, 0100644)
+	b.Insert("foo", foo, 0100644)
+	b.Insert("submodule", core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b"), 0160000)
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	tree, err := (&Repository{Storage: storage}).Tree(h)
+	c.Assert(err, IsNil)
+
+	files, trees, err := tree.Count()
+	c.Assert(err, IsNil)
+	c.Assert(files, Equals, 5)
+	c.Assert(trees, Equals, 4)
+	c.Assert(storage.gets[foo], Equals, 0)
+
+	size, err := tree.Size()
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(3*3+2*4))
+
+	a, err := tree.FindEntry("a")
+	c.Assert(err, IsNil)
+	c.Assert(storage.gets[a.Hash], Equals, 2)
+	c.Assert(storage.gets[foo], Equals, 1)
+}
+
+// newTreeObject returns a tree object with the given content, without
+// checking it.
+func newTreeObject(content []byte) *memory.Object {
+	return memory.NewObject(core.TreeObject, int64(len(content)), content)
+}
+
+func (s *SuiteTree) TestDecodeMalformed(c *C) {
+	hash := core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99")
+	entry := "100644 foo\x00" + string(hash.Bytes())
+
+	for i, t := range []struct {
+		content string
+		offset  int64
+		entry   int
+		err     string
+	}{
+		{"100644", 6, 0, "unexpected EOF"},
+		{"100644 foo", 10, 0, "unexpected EOF"},
+		{"100644 foo\x00" + string(hash[:10]), 21, 0, "unexpected EOF"},
+		{entry + "40000 bar\x00", 41, 1, "unexpected EOF"},
+		{"10064x foo\x00" + string(hash.Bytes()), 7, 0, "invalid entry mode"},
+		{" foo\x00" + string(hash.Bytes()), 1, 0, "invalid entry mode"},
+		{"-100644 foo\x00" + string(hash.Bytes()), 8, 0, "invalid entry mode"},
+		{"1006440000 foo\x00" + string(hash.Bytes()), 8, 0, "invalid entry mode"},
+		{entry + "100644 \x00" + string(hash.Bytes()), 39, 1, "invalid entry name"},
+		{"100644 " + strings.Repeat("a", maxTreeEntryNameLength+1), 7 + maxTreeEntryNameLength + 1, 0, "entry name too long"},
+	} {
+		com := Commentf("subtest %d", i)
+		err := (&Tree{}).Decode(newTreeObject([]byte(t.content)))
+		c.Assert(err, FitsTypeOf, &MalformedTreeError{}, com)
+
+		malformed := err.(*MalformedTreeError)
+		c.Assert(malformed.Offset, Equals, t.offset, com)
+		c.Assert(malformed.Entry, Equals, t.entry, com)
+		c.Assert(malformed.Err, ErrorMatches, t.err, com)
+	}
+
+	tree := &Tree{}
+	long := "100644 " + strings.Repeat("a", maxTreeEntryNameLength) + "\x00" + string(hash.Bytes())
+	c.Assert(tree.Decode(newTreeObject([]byte(long))), IsNil)
+	c.Assert(tree.Entries[0].Name, HasLen, maxTreeEntryNameLength)
+}
+
+// TestDecodeTruncatedAndCorrupted feeds truncated and randomly corrupted
+// versions of a real tree to Decode, which must either succeed or return a
+// *MalformedTreeError, never panic or return other errors.
+func (s *SuiteTree) TestDecodeTruncatedAndCorrupted(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	obj, err := r.Storage.Get(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	original := &Tree{}
+	c.Assert(original.Decode(obj), IsNil)
+	content := obj.Content()
+
+	// the offsets where each entry ends
+	ends := make(map[int]int, 0)
+	for i, end := 0, 0; i < len(original.Entries); i++ {
+		e := original.Entries[i]
+		end += len(strconv.FormatUint(uint64(e.Mode), 8)) + 1 + len(e.Name) + 1 + 20
+		ends[end] = i + 1
+	}
+
+	for size := 1; size < len(content); size++ {
+		com := Commentf("size=%d", size)
+		tree := &Tree{}
+		err := tree.Decode(newTreeObject(content[:size]))
+		if entries, ok := ends[size]; ok {
+			c.Assert(err, IsNil, com)
+			c.Assert(tree.Entries, DeepEquals, original.Entries[:entries], com)
+			continue
+		}
+
+		c.Assert(err, FitsTypeOf, &MalformedTreeError{}, com)
+	}
+
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		corrupted := make([]byte, len(content))
+		copy(corrupted, content)
+		for j := rnd.Intn(4); j >= 0; j-- {
+			corrupted[rnd.Intn(len(corrupted))] = byte(rnd.Intn(256))
+		}
+
+		err := (&Tree{}).Decode(newTreeObject(corrupted))
+		if err != nil {
+			c.Assert(err, FitsTypeOf, &MalformedTreeError{}, Commentf("iteration %d", i))
+		}
+	}
+}
+
+func (s *SuiteTree) TestTreeIterForEachContext(c *C) {
+	r := s.repos["https://github.com/tyba/git-fixture.git"]
+	commit, err := r.Commit(core.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int
+	iter := NewTreeIter(r, tree)
+	err = iter.ForEachContext(ctx, func(t *Tree) error {
+		count++
+		cancel()
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(count, Equals, 1)
+	c.Assert(iter.w.stack, IsNil)
+
+	count = 0
+	err = NewTreeIter(r, tree).ForEachContext(context.Background(), func(t *Tree) error {
+		count++
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, 4)
+}
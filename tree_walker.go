@@ -3,6 +3,8 @@ package git
 import (
 	"io"
 	"path"
+
+	"gopkg.in/src-d/go-git.v3/core"
 )
 
 const (
@@ -11,26 +13,78 @@ const (
 
 // TreeWalker provides a means of walking through all of the entries in a Tree.
 type TreeWalker struct {
-	stack []treeEntryIter
-	base  string
+	stack     []treeEntryIter
+	base      string
+	recursive bool
+	maxDepth  int
 
-	r *Repository
+	r        *Repository
+	root     *Tree
+	rootBase string // the base of the entries of root, see Reset
 }
 
 // NewTreeWalker returns a new TreeWalker for the given repository and tree.
+// The walker descends recursively into every subtree.
 //
 // It is the caller's responsibility to call Close() when finished with the
 // tree walker.
 func NewTreeWalker(r *Repository, t *Tree) *TreeWalker {
+	return newTreeWalker(r, t, true)
+}
+
+// NewNonRecursiveTreeWalker returns a new TreeWalker for the given repository
+// and tree that only returns the immediate entries of the tree. Subtrees are
+// still returned but the walker does not descend into them, callers can
+// create a new walker for them if they need to.
+//
+// It is the caller's responsibility to call Close() when finished with the
+// tree walker.
+func NewNonRecursiveTreeWalker(r *Repository, t *Tree) *TreeWalker {
+	return newTreeWalker(r, t, false)
+}
+
+func newTreeWalker(r *Repository, t *Tree, recursive bool) *TreeWalker {
 	w := TreeWalker{
-		stack: make([]treeEntryIter, 0, startingStackSize),
-		base:  "",
-		r:     r,
+		stack:     make([]treeEntryIter, 0, startingStackSize),
+		base:      "",
+		recursive: recursive,
+		maxDepth:  DefaultMaxTreeDepth,
+		r:         r,
+		root:      t,
 	}
 	w.stack = append(w.stack, treeEntryIter{t, 0})
 	return &w
 }
 
+// setBase sets the path prefixed to the names of the entries of the tree of
+// the walker, before the walk starts.
+func (w *TreeWalker) setBase(base string) {
+	w.base = base
+	w.rootBase = base
+}
+
+// Reset makes the walker start again from the first entry of its tree, even
+// if it has been closed.
+func (w *TreeWalker) Reset() {
+	w.stack = append(make([]treeEntryIter, 0, startingStackSize), treeEntryIter{w.root, 0})
+	w.base = w.rootBase
+}
+
+// Clone returns a new walker at the same position of the walk, which then
+// advances independently of w. The clone must be closed too.
+func (w *TreeWalker) Clone() *TreeWalker {
+	clone := *w
+	clone.stack = append(make([]treeEntryIter, 0, cap(w.stack)), w.stack...)
+	return &clone
+}
+
+// SetMaxDepth sets the maximum number of nested subtrees the walker descends
+// into, DefaultMaxTreeDepth by default. When a subtree deeper than that is
+// found Next returns a *MaxTreeDepthError.
+func (w *TreeWalker) SetMaxDepth(depth int) {
+	w.maxDepth = depth
+}
+
 // Next returns the next object from the tree. Objects are returned in order
 // and subtrees are included. After the last object has been returned further
 // calls to Next() will return io.EOF.
@@ -39,6 +93,50 @@ func NewTreeWalker(r *Repository, t *Tree) *TreeWalker {
 // underlying repository will be skipped automatically. It is possible that this
 // may change in future versions.
 func (w *TreeWalker) Next() (name string, entry TreeEntry, obj Object, err error) {
+	for {
+		name, entry, err = w.nextEntry()
+		if err != nil {
+			return
+		}
+
+		if isSubmoduleMode(entry.Mode) {
+			// the commits of the submodules are usually not in the
+			// storage, do not try to read them if so
+			var ok bool
+			if ok, err = w.r.hasObject(entry.Hash); err != nil {
+				return
+			}
+
+			if !ok {
+				continue
+			}
+		}
+
+		obj, err = w.r.Object(entry.Hash)
+		if err == ErrObjectNotFound {
+			// FIXME: Avoid doing this here in case the caller actually cares about
+			//        missing objects.
+			err = nil
+			continue // ignore entries without hash (= submodule dirs)
+		}
+
+		if err != nil {
+			return
+		}
+
+		break
+	}
+
+	if t, ok := obj.(*Tree); ok && w.recursive {
+		w.push(t, name)
+	}
+
+	return
+}
+
+// nextEntry returns the next entry from the tree, and its path, without
+// reading the object it points to.
+func (w *TreeWalker) nextEntry() (name string, entry TreeEntry, err error) {
 	for {
 		current := len(w.stack) - 1
 		if current < 0 {
@@ -46,9 +144,9 @@ func (w *TreeWalker) Next() (name string, entry TreeEntry, obj Object, err error
 			err = io.EOF
 			return
 		}
-		if current > maxTreeDepth {
+		if current > w.maxDepth {
 			// We're probably following bad data or some self-referencing tree
-			err = ErrMaxTreeDepth
+			err = &MaxTreeDepthError{Path: w.base, MaxDepth: w.maxDepth}
 			return
 		}
 
@@ -64,29 +162,52 @@ func (w *TreeWalker) Next() (name string, entry TreeEntry, obj Object, err error
 			return
 		}
 
-		obj, err = w.r.Object(entry.Hash)
-		if err == ErrObjectNotFound {
-			// FIXME: Avoid doing this here in case the caller actually cares about
-			//        missing objects.
-			err = nil
-			continue // ignore entries without hash (= submodule dirs)
-		}
-
 		name = path.Join(w.base, entry.Name)
+		return
+	}
+}
+
+// push makes the walker descend into the subtree t found at the given path.
+func (w *TreeWalker) push(t *Tree, name string) {
+	w.stack = append(w.stack, treeEntryIter{t, 0})
+	w.base = name
+}
 
+// walk calls fn for each of the remaining entries, see Tree.Walk.
+func (w *TreeWalker) walk(fn func(path string, e TreeEntry) error) error {
+	for {
+		name, entry, err := w.nextEntry()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			return
+			return err
 		}
 
-		break
-	}
+		err = fn(name, entry)
+		if err == core.ErrSkipDir {
+			continue
+		}
+		if err != nil {
+			return err
+		}
 
-	if t, ok := obj.(*Tree); ok {
-		w.stack = append(w.stack, treeEntryIter{t, 0})
-		w.base = path.Join(w.base, entry.Name)
-	}
+		if entry.Mode != treeEntryDirMode || !w.recursive {
+			continue
+		}
 
-	return
+		obj, err := w.r.Object(entry.Hash)
+		if err == ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if t, ok := obj.(*Tree); ok {
+			w.push(t, name)
+		}
+	}
 }
 
 // Tree returns the tree that the tree walker most recently operated on.
@@ -1,11 +1,15 @@
 package git
 
 import (
+	"errors"
 	"io"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
 
 	. "gopkg.in/check.v1"
 )
@@ -99,7 +103,9 @@ func (s *SuiteTreeWalker) TestNext(c *C) {
 		commit, err := r.Commit(core.NewHash(t.commit))
 		c.Assert(err, IsNil, Commentf("subtest %d: %v (%s)", i, err, t.commit))
 
-		walker := NewTreeWalker(r, commit.Tree())
+		tree, err := commit.Tree()
+		c.Assert(err, IsNil)
+		walker := NewTreeWalker(r, tree)
 		for k := 0; k < len(t.objs); k++ {
 			info := t.objs[k]
 			mode, err := strconv.ParseInt(info.Mode, 8, 32)
@@ -117,3 +123,289 @@ func (s *SuiteTreeWalker) TestNext(c *C) {
 		c.Assert(err, Equals, io.EOF)
 	}
 }
+
+func (s *SuiteTreeWalker) TestCloneAndReset(c *C) {
+	t := treeWalkerTests[0]
+	r := s.repos[t.repo]
+	commit, err := r.Commit(core.NewHash(t.commit))
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	names := func(w *TreeWalker) []string {
+		var names []string
+		for {
+			name, _, _, err := w.Next()
+			if err == io.EOF {
+				return names
+			}
+			c.Assert(err, IsNil)
+			names = append(names, name)
+		}
+	}
+
+	var expected []string
+	for _, obj := range t.objs {
+		expected = append(expected, obj.Name)
+	}
+
+	walker := NewTreeWalker(r, tree)
+	defer walker.Close()
+	for i := 0; i < 5; i++ {
+		_, _, _, err := walker.Next()
+		c.Assert(err, IsNil)
+	}
+
+	clone := walker.Clone()
+	defer clone.Close()
+	c.Assert(names(clone), DeepEquals, expected[5:])
+	c.Assert(names(walker), DeepEquals, expected[5:])
+
+	walker.Reset()
+	c.Assert(names(walker), DeepEquals, expected)
+
+	walker.Close()
+	walker.Reset()
+	c.Assert(names(walker), DeepEquals, expected)
+}
+
+func (s *SuiteTreeWalker) TestNextNonRecursive(c *C) {
+	r := s.repos["https://github.com/alcortesm/binary-relations.git"]
+	commit, err := r.Commit(core.NewHash("b373f85fa2594d7dcd9989f4a5858a81647fb8ea"))
+	c.Assert(err, IsNil)
+
+	expected := []expectedTreeWalkerEntry{
+		{core.BlobObject, "100644", ".gitignore", "7f41905b4d77ab4a9a2d334fcd0fb5db6e8e2183"},
+		{core.BlobObject, "100644", "Makefile", "d441e4e769b53cbd4b1215a1387f8c3108bac97d"},
+		{core.BlobObject, "100644", "binary-relations.tex", "cb50b067cc8cd9f639611d41416575c991ad8e97"},
+		{core.TreeObject, "040000", "imgs-gen", "b33007b7e83a738576c3f44369fe2f674bb23d5d"},
+		{core.TreeObject, "040000", "src", "ec9d27c4df99caec3a817e9c018812a6c56c1b00"},
+	}
+
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	walker := NewNonRecursiveTreeWalker(r, tree)
+	defer walker.Close()
+	for k, info := range expected {
+		name, entry, obj, err := walker.Next()
+		c.Assert(err, IsNil, Commentf("iter %d, err=%v", k, err))
+		c.Assert(name, Equals, info.Name, Commentf("iter %d", k))
+		c.Assert(obj.Type(), Equals, info.Kind, Commentf("iter %d", k))
+		c.Assert(entry.Hash.String(), Equals, info.Hash, Commentf("iter %d", k))
+	}
+
+	_, _, _, err = walker.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+// newDeepTree returns a tree with a single file nested in depth directories
+// named "a", created in a new memory storage.
+func newDeepTree(c *C, depth int) *Tree {
+	r := NewPlainRepository()
+	blob := newTestBlob(c, r, "deep")
+
+	p := "file"
+	for i := 0; i < depth; i++ {
+		p = "a/" + p
+	}
+
+	b := NewTreeBuilder()
+	b.Insert(p, blob, 0100644)
+	h, err := b.Write(r.Storage)
+	c.Assert(err, IsNil)
+
+	tree, err := r.Tree(h)
+	c.Assert(err, IsNil)
+
+	return tree
+}
+
+func countFiles(iter *FileIter) (int, error) {
+	defer iter.Close()
+
+	var n int
+	for {
+		_, err := iter.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+}
+
+func (s *SuiteTreeWalker) TestMaxDepth(c *C) {
+	tree := newDeepTree(c, 4)
+
+	walker := NewTreeWalker(tree.r, tree)
+	walker.SetMaxDepth(2)
+
+	var names []string
+	var err error
+	for {
+		var name string
+		if name, _, _, err = walker.Next(); err != nil {
+			break
+		}
+
+		names = append(names, name)
+	}
+
+	c.Assert(names, DeepEquals, []string{"a", "a/a", "a/a/a"})
+	c.Assert(err, DeepEquals, &MaxTreeDepthError{Path: "a/a/a", MaxDepth: 2})
+	c.Assert(err.Error(), Equals, "maximum tree depth exceeded (2) at a/a/a")
+
+	walker.Close()
+}
+
+func (s *SuiteTreeWalker) TestMaxDepthFiles(c *C) {
+	tree := newDeepTree(c, DefaultMaxTreeDepth+10)
+
+	_, err := countFiles(tree.Files())
+	c.Assert(err, FitsTypeOf, &MaxTreeDepthError{})
+	c.Assert(err.(*MaxTreeDepthError).MaxDepth, Equals, DefaultMaxTreeDepth)
+
+	iter := tree.Files()
+	iter.SetMaxDepth(DefaultMaxTreeDepth + 10)
+	n, err := countFiles(iter)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	iter = newDeepTree(c, 10).Files()
+	iter.SetMaxDepth(5)
+	_, err = countFiles(iter)
+	c.Assert(err, FitsTypeOf, &MaxTreeDepthError{})
+}
+
+// the walks of the trees return the same error as the walker
+func (s *SuiteTreeWalker) TestMaxDepthErrors(c *C) {
+	tree := newDeepTree(c, DefaultMaxTreeDepth+10)
+	deep := strings.Repeat("a/", DefaultMaxTreeDepth+1)
+	deep = deep[:len(deep)-1]
+
+	_, _, countErr := tree.Count()
+	_, findErr := tree.FindEntriesByHash(core.NewHash("0000000000000000000000000000000000000001"))
+	_, globErr := tree.Glob("**/file")
+	_, treeErr := tree.Tree(deep)
+	_, diffErr := DiffTree(&Tree{r: tree.r}, tree)
+	_, emptyDiffErr := DiffTree(nil, tree)
+
+	for i, err := range []error{countErr, findErr, globErr, treeErr, diffErr, emptyDiffErr} {
+		c.Assert(err, DeepEquals, &MaxTreeDepthError{Path: deep, MaxDepth: DefaultMaxTreeDepth}, Commentf("%d", i))
+		c.Assert(errors.Is(err, ErrMaxTreeDepth), Equals, true)
+	}
+}
+
+func (s *SuiteTreeWalker) TestWalkSkipDir(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	storage := &countingStorage{r.Storage, make(map[core.Hash]int, 0)}
+	repo := &Repository{Storage: storage}
+
+	tree, err := repo.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	var paths []string
+	err = tree.Walk(func(path string, e TreeEntry) error {
+		paths = append(paths, path)
+		if path == "json" || path == "vendor" || path == "LICENSE" {
+			return core.ErrSkipDir
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, []string{
+		".gitignore", "CHANGELOG", "LICENSE", "binary.jpg",
+		"go", "go/example.go", "json", "php", "php/crappy.php", "vendor",
+	})
+
+	for _, h := range []string{
+		"5a877e6a906a2743ad6e45d99c1793642aaf8eda", // json
+		"cf4aa3b38974fb7d81f367c0830f7d78d65ab86b", // vendor
+		"49c6bb89b17060d7b4deacb7b338fcc6ea2352a9", // json/long.json
+		"9dea2395f5403188298c1dabe8bdafe562c491e3", // vendor/foo.go
+		"c192bd6a24ea1ab01d78686e417c8bdc7c3d197f", // LICENSE
+	} {
+		c.Assert(storage.gets[core.NewHash(h)], Equals, 0, Commentf("object %s", h))
+	}
+}
+
+func (s *SuiteTreeWalker) TestWalkError(c *C) {
+	r := unpackFixtures(c, fixtureRepos)["https://github.com/tyba/git-fixture.git"]
+	tree, err := r.Tree(core.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	c.Assert(err, IsNil)
+
+	stop := errors.New("stop")
+	var paths []string
+	err = tree.Walk(func(path string, e TreeEntry) error {
+		paths = append(paths, path)
+		if path == "go/example.go" {
+			return stop
+		}
+
+		return nil
+	})
+	c.Assert(err, Equals, stop)
+	c.Assert(paths, DeepEquals, []string{
+		".gitignore", "CHANGELOG", "LICENSE", "binary.jpg", "go", "go/example.go",
+	})
+}
+
+func (s *SuiteTreeWalker) TestWalkSubmodules(c *C) {
+	r := s.repos["https://github.com/alcortesm/binary-relations.git"]
+	commit, err := r.Commit(core.NewHash("c44b5176e99085c8fe36fa27b045590a7b9d34c9"))
+	c.Assert(err, IsNil)
+
+	var submodules []string
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+	err = tree.Walk(func(path string, e TreeEntry) error {
+		if e.Mode == 0160000 {
+			submodules = append(submodules, path)
+		}
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(submodules, DeepEquals, []string{"src/binrels"})
+}
+
+// getCountingStorage counts the calls to Get for every hash
+type getCountingStorage struct {
+	*memory.ObjectStorage
+	sync.Mutex
+	gets map[core.Hash]int
+}
+
+func (s *getCountingStorage) Get(h core.Hash) (core.Object, error) {
+	s.Lock()
+	s.gets[h]++
+	s.Unlock()
+
+	return s.ObjectStorage.Get(h)
+}
+
+func (s *SuiteTreeWalker) TestNextSubmodulesNotRead(c *C) {
+	tree, err := newArchiveCommit(c).Tree()
+	c.Assert(err, IsNil)
+
+	storage := &getCountingStorage{
+		ObjectStorage: tree.r.Storage.(*memory.ObjectStorage),
+		gets:          make(map[core.Hash]int, 0),
+	}
+	r := &Repository{Storage: storage}
+	tree, err = r.Tree(tree.Hash)
+	c.Assert(err, IsNil)
+
+	submodule := core.NewHash("d2fdbfa3273cf09b32e4f6340c83c3e01c90ca6b")
+	for _, iter := range []*FileIter{tree.Files(), tree.FilesParallel(2)} {
+		files, err := fileIterEntries(c, iter)
+		c.Assert(err, IsNil)
+		c.Assert(files, HasLen, 6)
+		c.Assert(storage.gets[submodule], Equals, 0)
+	}
+}
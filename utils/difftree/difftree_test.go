@@ -397,5 +397,5 @@ func tree(repo *git.Repository, commitHashStr string) (*git.Tree, error) {
 		return nil, err
 	}
 
-	return commit.Tree(), nil
+	return commit.Tree()
 }
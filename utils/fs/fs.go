@@ -19,3 +19,46 @@ type ReadSeekCloser interface {
 	io.ReadCloser
 	io.Seeker
 }
+
+// WriteFS is implemented by the FS that can also be written, the storages
+// backed by an FS not implementing it are read only.
+type WriteFS interface {
+	FS
+	// OpenFile opens the file at path for writing, with the given flags of
+	// os.OpenFile, creating it with the given mode if it does not exist.
+	OpenFile(path string, flag int, perm os.FileMode) (File, error)
+	// TempFile creates a new temporary file in the directory dir, with a
+	// name beginning with prefix, opened for writing.
+	TempFile(dir, prefix string) (File, error)
+	// MkdirAll creates a directory named path, along with any necessary
+	// parents.
+	MkdirAll(path string, perm os.FileMode) error
+	// Rename moves the file from to the path to, replacing it if it exists.
+	Rename(from, to string) error
+	// Remove removes the file or the empty directory at path.
+	Remove(path string) error
+}
+
+// File is a file opened for writing.
+type File interface {
+	io.WriteCloser
+	// Name returns the path of the file.
+	Name() string
+	// Sync commits the content of the file to stable storage.
+	Sync() error
+	// Chmod changes the mode of the file.
+	Chmod(mode os.FileMode) error
+}
+
+// SymlinkFS is implemented by the FS supporting symbolic links, the ones not
+// implementing it follow them.
+type SymlinkFS interface {
+	FS
+	// Lstat returns the filesystem info for a path, of the symbolic link
+	// itself if it is one.
+	Lstat(path string) (os.FileInfo, error)
+	// Readlink returns the destination of the symbolic link at path.
+	Readlink(path string) (string, error)
+	// Symlink creates the symbolic link path pointing to target.
+	Symlink(target, path string) error
+}
@@ -1,12 +1,15 @@
 package fs
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 )
 
-// OS is a simple FS implementation for the current host filesystem.
+// OS is a simple FS implementation for the current host filesystem, it is
+// also a WriteFS and a SymlinkFS.
 type OS struct{}
 
 // NewOS returns a new OS.
@@ -19,6 +22,24 @@ func (o *OS) Stat(path string) (os.FileInfo, error) {
 	return os.Stat(path)
 }
 
+// Lstat returns the filesystem info for a path, without following it if it
+// is a symbolic link, see os.Lstat.
+func (o *OS) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// Readlink returns the destination of the symbolic link at path, see
+// os.Readlink.
+func (o *OS) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+// Symlink creates the symbolic link path pointing to target, see
+// os.Symlink.
+func (o *OS) Symlink(target, path string) error {
+	return os.Symlink(target, path)
+}
+
 // Open returns a ReadSeekCloser for the specified path.
 func (o *OS) Open(path string) (ReadSeekCloser, error) {
 	return os.Open(path)
@@ -34,3 +55,89 @@ func (o *OS) ReadDir(path string) ([]os.FileInfo, error) {
 func (o *OS) Join(elem ...string) string {
 	return filepath.Join(elem...)
 }
+
+// OpenFile opens the file at path for writing with the given flags, see
+// os.OpenFile.
+func (o *OS) OpenFile(path string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+// TempFile creates a new temporary file in the directory dir, see
+// ioutil.TempFile.
+func (o *OS) TempFile(dir, prefix string) (File, error) {
+	return ioutil.TempFile(dir, prefix)
+}
+
+// MkdirAll creates a directory named path, along with any necessary parents,
+// see os.MkdirAll.
+func (o *OS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Rename moves the file from to the path to, replacing it if it exists. When
+// both paths are in different filesystems the file is copied and then
+// removed, so the move is not atomic in that case.
+func (o *OS) Rename(from, to string) error {
+	err := os.Rename(from, to)
+	if lerr, ok := err.(*os.LinkError); ok && lerr.Err == syscall.EXDEV {
+		return move(from, to)
+	}
+
+	return err
+}
+
+// Remove removes the file or the empty directory at path, see os.Remove.
+func (o *OS) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// move copies the file from to a temporary file next to the path to, with
+// the same mode, renames it to to and removes from.
+func move(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := ioutil.TempFile(filepath.Dir(to), filepath.Base(to))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(dst.Name())
+		}
+	}()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Chmod(fi.Mode()); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dst.Name(), to); err != nil {
+		return err
+	}
+
+	return os.Remove(from)
+}
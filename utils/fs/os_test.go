@@ -3,6 +3,7 @@ package fs
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/alcortesm/tgz"
@@ -149,3 +150,80 @@ func (s *FSImplSuite) TestReadDir(c *C) {
 		c.Assert(obtained, DeepEquals, expected, com)
 	}
 }
+
+func (s *FSImplSuite) TestWrite(c *C) {
+	fs := NewOS().(WriteFS)
+	dir := fs.Join(c.MkDir(), "a", "b")
+	c.Assert(fs.MkdirAll(dir, 0755), IsNil)
+
+	f, err := fs.TempFile(dir, "tmp_")
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Dir(f.Name()), Equals, dir)
+	_, err = f.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Sync(), IsNil)
+	c.Assert(f.Chmod(0444), IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	path := fs.Join(dir, "foo")
+	c.Assert(fs.Rename(f.Name(), path), IsNil)
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo")
+
+	_, err = fs.Stat(f.Name())
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	c.Assert(os.IsExist(err), Equals, true)
+
+	c.Assert(fs.Remove(path), IsNil)
+	_, err = fs.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	f, err = fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte("bar"))
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	content, err = ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "bar")
+}
+
+func (s *FSImplSuite) TestMove(c *C) {
+	dir := c.MkDir()
+	from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	c.Assert(ioutil.WriteFile(from, []byte("foo"), 0444), IsNil)
+
+	c.Assert(move(from, to), IsNil)
+	content, err := ioutil.ReadFile(to)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo")
+
+	fi, err := os.Stat(to)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode(), Equals, os.FileMode(0444))
+
+	_, err = os.Stat(from)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *FSImplSuite) TestSymlink(c *C) {
+	dir := c.MkDir()
+	link := filepath.Join(dir, "link")
+	fs := NewOS().(SymlinkFS)
+	c.Assert(fs.Symlink("foo", link), IsNil)
+
+	fi, err := fs.Lstat(link)
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode()&os.ModeSymlink, Equals, os.ModeSymlink)
+
+	target, err := fs.Readlink(link)
+	c.Assert(err, IsNil)
+	c.Assert(target, Equals, "foo")
+}
@@ -0,0 +1,126 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+)
+
+var (
+	// ErrNotSigned is returned by the Verify methods when the object has no
+	// PGP signature.
+	ErrNotSigned = errors.New("object not signed")
+	// ErrSigningKeyNotFound is returned by the Verify methods when the key
+	// of the signature is not in the keyring.
+	ErrSigningKeyNotFound = errors.New("signing key not found in the keyring")
+	// ErrInvalidSignature is returned by the Verify methods when the
+	// signature is malformed or does not match the signed object.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// pgpSignatureBegin is the first line of an armored PGP signature.
+const pgpSignatureBegin = "-----BEGIN PGP SIGNATURE-----"
+
+// Verify checks the PGP signature of the commit with the keys of the given
+// armored keyring, returning the entity of the key that made it. The payload
+// signed is the commit written without its gpgsig header, as git signs it.
+func (c *Commit) Verify(armoredKeyRing io.Reader) (*openpgp.Entity, error) {
+	sig := c.PGPSignature()
+	if sig == "" {
+		return nil, ErrNotSigned
+	}
+
+	unsigned := *c
+	unsigned.ExtraHeaders = nil
+	for _, h := range c.ExtraHeaders {
+		if h.Key != pgpSignatureHeader {
+			unsigned.ExtraHeaders = append(unsigned.ExtraHeaders, h)
+		}
+	}
+
+	payload := &memory.Object{}
+	payload.SetFormat(unsigned.TreeHash.Format())
+	if err := unsigned.Encode(payload); err != nil {
+		return nil, err
+	}
+
+	return verifySignature(armoredKeyRing, payload.Content(), sig)
+}
+
+// PGPSignature returns the armored PGP signature of a signed tag, the end of
+// its message from the line starting it, or an empty string if the tag is
+// not signed.
+func (t *Tag) PGPSignature() string {
+	_, sig := t.splitSignature()
+	return sig
+}
+
+// Verify checks the PGP signature of the tag with the keys of the given
+// armored keyring, returning the entity of the key that made it. The payload
+// signed is the tag written with its message without the signature, as git
+// signs it.
+func (t *Tag) Verify(armoredKeyRing io.Reader) (*openpgp.Entity, error) {
+	message, sig := t.splitSignature()
+	if sig == "" {
+		return nil, ErrNotSigned
+	}
+
+	unsigned := *t
+	unsigned.Message = message
+
+	payload := &memory.Object{}
+	payload.SetFormat(unsigned.Target.Format())
+	if err := unsigned.Encode(payload); err != nil {
+		return nil, err
+	}
+
+	return verifySignature(armoredKeyRing, payload.Content(), sig)
+}
+
+// splitSignature returns the message of the tag without its signature, and
+// the signature, which git appends to the message: the last line of the
+// message starting with pgpSignatureBegin and the rest of it, so the armored
+// blocks quoted in the message are kept in it.
+func (t *Tag) splitSignature() (message, sig string) {
+	for end := len(t.Message); ; {
+		i := strings.LastIndex(t.Message[:end], pgpSignatureBegin)
+		if i == -1 {
+			return t.Message, ""
+		}
+
+		if i == 0 || t.Message[i-1] == '\n' {
+			return t.Message[:i], t.Message[i:]
+		}
+
+		end = i
+	}
+}
+
+func verifySignature(armoredKeyRing io.Reader, payload []byte, sig string) (*openpgp.Entity, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(armoredKeyRing)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(sig))
+	switch err.(type) {
+	case nil:
+		return entity, nil
+	case openpgperrors.SignatureError, openpgperrors.StructuralError, openpgperrors.InvalidArgumentError:
+		return nil, ErrInvalidSignature
+	}
+
+	switch err {
+	case openpgperrors.ErrUnknownIssuer:
+		return nil, ErrSigningKeyNotFound
+	case io.EOF, io.ErrUnexpectedEOF:
+		return nil, ErrInvalidSignature
+	}
+
+	return nil, err
+}
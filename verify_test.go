@@ -0,0 +1,123 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/alcortesm/tgz"
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteVerify struct {
+	dir string
+	r   *Repository
+	key []byte
+}
+
+var _ = Suite(&SuiteVerify{})
+
+func (s *SuiteVerify) SetUpSuite(c *C) {
+	var err error
+	s.dir, err = tgz.Extract(signedFixture)
+	c.Assert(err, IsNil)
+
+	s.r, err = NewRepositoryFromFS(fs.NewOS(), filepath.Join(s.dir, ".git"))
+	c.Assert(err, IsNil)
+
+	s.key, err = ioutil.ReadFile(filepath.Join(s.dir, "key.asc"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteVerify) TearDownSuite(c *C) {
+	c.Assert(os.RemoveAll(s.dir), IsNil)
+}
+
+func (s *SuiteVerify) TestCommitVerify(c *C) {
+	for hash, expected := range map[string]error{
+		"3a39de40a330153150c5da97ee0f7a5a21baa600": nil,
+		"dfb58170a4d60fdd7ab88b55b37d40ea86118e3e": nil, // with a mergetag header
+		"8b2f8c71a30ba472ac9b1552c0f23d83d9b9f95f": ErrNotSigned,
+		"75eb68de71a83326076d5cd899272cf90536a452": ErrSigningKeyNotFound,
+	} {
+		com := Commentf("commit=%s", hash)
+		commit, err := s.r.Commit(core.NewHash(hash))
+		c.Assert(err, IsNil, com)
+
+		entity, err := commit.Verify(bytes.NewReader(s.key))
+		c.Assert(err, Equals, expected, com)
+		if expected == nil {
+			c.Assert(entity.Identities, HasLen, 1, com)
+			_, ok := entity.Identities["John Doe <john@doe.com>"]
+			c.Assert(ok, Equals, true, com)
+		}
+	}
+}
+
+func (s *SuiteVerify) TestCommitVerifyInvalid(c *C) {
+	commit, err := s.r.Commit(core.NewHash("3a39de40a330153150c5da97ee0f7a5a21baa600"))
+	c.Assert(err, IsNil)
+
+	commit.Message = "Add the private key\n"
+	_, err = commit.Verify(bytes.NewReader(s.key))
+	c.Assert(err, Equals, ErrInvalidSignature)
+
+	commit.ExtraHeaders = []ExtraHeader{{Key: "gpgsig", Value: "foo"}}
+	_, err = commit.Verify(bytes.NewReader(s.key))
+	c.Assert(err, Equals, ErrInvalidSignature)
+}
+
+func (s *SuiteVerify) TestTagVerify(c *C) {
+	for hash, expected := range map[string]error{
+		"5c89a3b6ff63a035246c9b9055279b805e6f8a39": nil,
+		"3c95299c71a88a3df59151c7fabe2037e3b2b14b": nil,
+		"88bff06efcb4608b9e132c3e18767bf277a796db": ErrSigningKeyNotFound,
+	} {
+		com := Commentf("tag=%s", hash)
+		tag, err := s.r.TagObject(core.NewHash(hash))
+		c.Assert(err, IsNil, com)
+
+		_, err = tag.Verify(bytes.NewReader(s.key))
+		c.Assert(err, Equals, expected, com)
+	}
+
+	tag, err := s.r.TagObject(core.NewHash("5c89a3b6ff63a035246c9b9055279b805e6f8a39"))
+	c.Assert(err, IsNil)
+
+	sig := tag.PGPSignature()
+	c.Assert(sig[:len(pgpSignatureBegin)], Equals, pgpSignatureBegin)
+	c.Assert(tag.Message, Equals, "signed tag\n"+sig)
+
+	tag.Name = "v2.0"
+	_, err = tag.Verify(bytes.NewReader(s.key))
+	c.Assert(err, Equals, ErrInvalidSignature)
+
+	tag.Message = "signed tag\n"
+	c.Assert(tag.PGPSignature(), Equals, "")
+	_, err = tag.Verify(bytes.NewReader(s.key))
+	c.Assert(err, Equals, ErrNotSigned)
+}
+
+func (s *SuiteVerify) TestTagSplitSignature(c *C) {
+	quoted := pgpSignatureBegin + "\n\nquoted\n-----END PGP SIGNATURE-----\n"
+	sig := pgpSignatureBegin + "\n\nsignature\n-----END PGP SIGNATURE-----\n"
+	for _, t := range []struct {
+		message, expected, sig string
+	}{
+		{"signed tag\n" + sig, "signed tag\n", sig},
+		{"signed tag\n\n" + quoted + "\n" + sig, "signed tag\n\n" + quoted + "\n", sig},
+		{"signed tag\n" + sig + "inline " + pgpSignatureBegin + "\n", "signed tag\n", sig + "inline " + pgpSignatureBegin + "\n"},
+		{"inline " + pgpSignatureBegin + "\n", "inline " + pgpSignatureBegin + "\n", ""},
+		{"unsigned tag\n", "unsigned tag\n", ""},
+	} {
+		tag := &Tag{Message: t.message}
+		message, sig := tag.splitSignature()
+		c.Assert(message, Equals, t.expected, Commentf("message=%q", t.message))
+		c.Assert(sig, Equals, t.sig, Commentf("message=%q", t.message))
+		c.Assert(tag.PGPSignature(), Equals, t.sig)
+	}
+}
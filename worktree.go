@@ -0,0 +1,172 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/storage/memory"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+const gitDirName = ".git"
+
+var (
+	// ErrPathOutsideWorktree is returned by the operations of Worktree when
+	// a path is not in the worktree, or it is in its .git directory.
+	ErrPathOutsideWorktree = errors.New("path is outside the worktree")
+	// ErrUnsupportedFile is returned by Worktree.Add when the file is not a
+	// regular file or a symbolic link, as a directory.
+	ErrUnsupportedFile = errors.New("not a regular file or a symbolic link")
+	// ErrReadOnlyWorktree is returned by the operations of Worktree writing
+	// its files when its filesystem is not a fs.WriteFS.
+	ErrReadOnlyWorktree = errors.New("worktree is read only")
+)
+
+// Worktree is the working directory of a repository, the files whose changes
+// are added to its index, see Repository.Index, to be committed.
+type Worktree struct {
+	r    *Repository
+	fs   fs.FS
+	path string
+}
+
+// Worktree returns the worktree of the repository at the given path of the
+// filesystem fs, usually the parent of its .git directory. The symbolic
+// links are followed if fs is not a fs.SymlinkFS.
+func (r *Repository) Worktree(fs fs.FS, path string) *Worktree {
+	return &Worktree{r: r, fs: fs, path: path}
+}
+
+// name returns the name in the index of the file at the given path, relative
+// to the root of the worktree.
+func (w *Worktree) name(path string) (string, error) {
+	name := filepath.ToSlash(filepath.Clean(path))
+	if name == "." || filepath.IsAbs(path) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", ErrPathOutsideWorktree
+	}
+
+	for _, dir := range strings.Split(name, "/") {
+		if dir == gitDirName {
+			return "", ErrPathOutsideWorktree
+		}
+	}
+
+	return name, nil
+}
+
+// fullPath returns the path in the filesystem of the file with the given
+// name.
+func (w *Worktree) fullPath(name string) string {
+	return w.fs.Join(append([]string{w.path}, strings.Split(name, "/")...)...)
+}
+
+func (w *Worktree) lstat(path string) (os.FileInfo, error) {
+	if sfs, ok := w.fs.(fs.SymlinkFS); ok {
+		return sfs.Lstat(path)
+	}
+
+	return w.fs.Stat(path)
+}
+
+// Add adds the file at the given path, relative to the root of the
+// worktree, to the index, as git add does: its content is stored as a blob,
+// whose hash is returned, and its entry of the index is replaced, see
+// index.Index.Add. If the file does not exist, its entry is removed and the
+// hash is zero. ErrPathOutsideWorktree is returned if the path is not in
+// the worktree and ErrUnsupportedFile if it is a directory.
+func (w *Worktree) Add(path string) (core.Hash, error) {
+	name, err := w.name(path)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	idx, err := w.r.Index()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	full := w.fullPath(name)
+	fi, err := w.lstat(full)
+	if os.IsNotExist(err) {
+		if idx.Remove(name) != nil {
+			return core.ZeroHash, err
+		}
+
+		return w.r.ObjectFormat().ZeroHash(), w.r.SetIndex(idx)
+	}
+
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	h, mode, err := w.storeBlob(full, fi)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	idx.Add(name, h, mode, index.NewStat(fi))
+	return h, w.r.SetIndex(idx)
+}
+
+// storeBlob stores the content of the file at the given path, with the
+// given info, as a blob, returning its hash and the mode of its tree
+// entries.
+func (w *Worktree) storeBlob(path string, fi os.FileInfo) (core.Hash, os.FileMode, error) {
+	content, mode, err := w.readFile(path, fi)
+	if err != nil {
+		return core.ZeroHash, 0, err
+	}
+
+	blob := memory.NewObjectWithFormat(w.r.ObjectFormat(), core.BlobObject, int64(len(content)), content)
+	h, err := w.r.Storage.Set(blob)
+	return h, mode, err
+}
+
+// readFile returns the content of the blob of the file at the given path,
+// with the given info, the destination of the symbolic links, and the mode
+// of its tree entries. ErrUnsupportedFile is returned if it is not a regular
+// file or a symbolic link.
+func (w *Worktree) readFile(path string, fi os.FileInfo) ([]byte, os.FileMode, error) {
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := w.fs.(fs.SymlinkFS).Readlink(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return []byte(filepath.ToSlash(target)), treeEntrySymlinkMode, nil
+	case fi.Mode().IsRegular():
+		f, err := w.fs.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer f.Close()
+
+		content, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return content, fileMode(fi), nil
+	default:
+		return nil, 0, ErrUnsupportedFile
+	}
+}
+
+// fileMode returns the mode of the tree entries of the regular files and
+// symbolic links with the given info.
+func fileMode(fi os.FileInfo) os.FileMode {
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return treeEntrySymlinkMode
+	case fi.Mode()&0111 != 0:
+		return treeEntryExecutableMode
+	default:
+		return treeEntryRegularMode
+	}
+}
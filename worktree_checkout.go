@@ -0,0 +1,513 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+// CheckoutConflictError is returned by Worktree.Checkout when it would
+// overwrite the local changes of the files, or untracked files, unless it is
+// forced. Nothing is changed then.
+type CheckoutConflictError struct {
+	// Paths are the files with local changes in the way, sorted.
+	Paths []string
+}
+
+func (e *CheckoutConflictError) Error() string {
+	return fmt.Sprintf("checkout would overwrite the local changes of %s", strings.Join(e.Paths, ", "))
+}
+
+// PartialCheckoutError is returned by Worktree.Checkout when some files of
+// the worktree could not be updated. The index and HEAD are updated anyway,
+// as git does, so those files are changed in Worktree.Status.
+type PartialCheckoutError struct {
+	// Errors are the errors of the files not updated, by path.
+	Errors map[string]error
+}
+
+func (e *PartialCheckoutError) Error() string {
+	paths := make([]string, 0, len(e.Errors))
+	for p := range e.Errors {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+	return fmt.Sprintf("checkout %s: %s (%d files failed)", paths[0], e.Errors[paths[0]], len(paths))
+}
+
+// WorktreeCheckoutOptions are the options of Worktree.Checkout.
+type WorktreeCheckoutOptions struct {
+	// Branch is the full name of the branch checked out, as
+	// "refs/heads/master". HEAD is detached if it is empty.
+	Branch core.ReferenceName
+	// Hash is the commit checked out, with a detached HEAD, if Branch is
+	// empty, or the one of the branch created.
+	Hash core.Hash
+	// Create creates Branch before checking it out, pointing to Hash, or to
+	// HEAD if Hash is zero.
+	Create bool
+	// Force discards the local changes of the index and the worktree, and
+	// the untracked files in the way, instead of failing, and replaces
+	// Branch when creating it if it already exists.
+	Force bool
+}
+
+// Checkout switches the worktree to the branch or the commit of the options,
+// as git checkout does, updating the files changed between HEAD and the
+// commit, and their entries of the index, and moving HEAD: it points to the
+// branch, created first if the options ask for it, or to the commit, if no
+// branch is given. HEAD is checked out again, without moving it, if neither
+// are given. The branch switched to is recorded in the reflog of HEAD.
+//
+// The local changes of the rest of the files are kept, and so are the ones
+// of the files changed if they are the same in the commit. A
+// *CheckoutConflictError is returned otherwise, unless the options force
+// it, and then every local change is discarded. The files that can not be
+// written or removed are returned in a *PartialCheckoutError.
+//
+// ErrReadOnlyWorktree is returned if the worktree is not in a fs.WriteFS,
+// and the symbolic links are written as files holding their targets if it
+// is not in a fs.SymlinkFS.
+func (w *Worktree) Checkout(opts *WorktreeCheckoutOptions) error {
+	if opts == nil {
+		opts = &WorktreeCheckoutOptions{}
+	}
+
+	wfs, ok := w.fs.(fs.WriteFS)
+	if !ok {
+		return ErrReadOnlyWorktree
+	}
+
+	target, err := w.checkoutTarget(opts)
+	if err != nil {
+		return err
+	}
+
+	commit, err := w.r.Commit(target)
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	to, err := treeFiles(tree)
+	if err != nil {
+		return err
+	}
+
+	from, err := w.headFiles()
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Index()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	changed := changedFiles(from, to)
+	if opts.Force {
+		for _, e := range idx.Entries {
+			changed[e.Name] = true
+		}
+
+		for p, st := range status {
+			if st.Worktree != Untracked && st.Worktree != Ignored {
+				changed[p] = true
+			}
+		}
+	} else if conflicts := checkoutConflicts(changed, to, idx, status); len(conflicts) != 0 {
+		return &CheckoutConflictError{Paths: conflicts}
+	}
+
+	if opts.Create {
+		cfg := &BranchConfig{Name: strings.TrimPrefix(opts.Branch.String(), branchPrefix)}
+		if _, err := w.r.CreateBranch(cfg, target, &CreateBranchOptions{Force: opts.Force}); err != nil {
+			return err
+		}
+	}
+
+	failed := w.updateFiles(wfs, idx, changed, to)
+	if err := w.r.SetIndex(idx); err != nil {
+		return err
+	}
+
+	if err := w.moveHead(opts, target); err != nil {
+		return err
+	}
+
+	if len(failed) != 0 {
+		return &PartialCheckoutError{Errors: failed}
+	}
+
+	return nil
+}
+
+// checkoutTarget returns the hash of the commit checked out with the given
+// options, core.ErrInvalidReferenceName is returned if a branch created is
+// not under refs/heads/, and ErrBranchExists if it already exists, unless
+// it is forced.
+func (w *Worktree) checkoutTarget(opts *WorktreeCheckoutOptions) (core.Hash, error) {
+	if opts.Create {
+		if !strings.HasPrefix(opts.Branch.String(), branchPrefix) {
+			return core.ZeroHash, core.ErrInvalidReferenceName
+		}
+
+		_, err := w.r.References.Get(opts.Branch)
+		if err == nil && !opts.Force {
+			return core.ZeroHash, ErrBranchExists
+		}
+
+		if err != nil && err != core.ErrReferenceNotFound {
+			return core.ZeroHash, err
+		}
+	}
+
+	if opts.Branch != "" && !opts.Create {
+		ref, err := w.r.Reference(opts.Branch, true)
+		if err != nil {
+			return core.ZeroHash, err
+		}
+
+		return ref.Hash, nil
+	}
+
+	if !opts.Hash.IsZero() {
+		return opts.Hash, nil
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	return head.Hash, nil
+}
+
+// changedFiles returns the paths of the files that are not the same in the
+// given trees.
+func changedFiles(from, to map[string]TreeEntry) map[string]bool {
+	changed := map[string]bool{}
+	for p, e := range from {
+		if t, ok := to[p]; !ok || t.Hash != e.Hash || t.Mode != e.Mode {
+			changed[p] = true
+		}
+	}
+
+	for p := range to {
+		if _, ok := from[p]; !ok {
+			changed[p] = true
+		}
+	}
+
+	return changed
+}
+
+// checkoutConflicts returns the sorted paths of the files changed whose
+// local changes, with the given index and status, would be overwritten by
+// the files of the tree to, and the untracked files in the way of its files
+// and directories.
+func checkoutConflicts(changed map[string]bool, to map[string]TreeEntry, idx *index.Index, status Status) []string {
+	var conflicts []string
+	for p, st := range status {
+		switch {
+		case st.Worktree == Ignored:
+		case st.Worktree == Untracked:
+			if inTheWay(strings.TrimSuffix(p, "/"), to) {
+				conflicts = append(conflicts, p)
+			}
+		case changed[p]:
+			if !isCheckedOut(p, st, to, idx) {
+				conflicts = append(conflicts, p)
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// isCheckedOut returns true if the file with the given path and status is
+// already the one of the tree to, in the index and the worktree, or it is
+// removed from both if it is not in the tree.
+func isCheckedOut(p string, st *FileStatus, to map[string]TreeEntry, idx *index.Index) bool {
+	entry, staged := idx.Entry(p)
+	e, ok := to[p]
+	if !ok {
+		return !staged && st.Staging == Deleted
+	}
+
+	return staged && entry.Hash == e.Hash && entry.Mode == e.Mode && st.Worktree == Unmodified
+}
+
+// inTheWay returns true if the untracked file with the given path would be
+// overwritten by a file of the given ones: if it is one of them, or it is
+// in any of their directories, or any of them is in it.
+func inTheWay(p string, files map[string]TreeEntry) bool {
+	if _, ok := files[p]; ok {
+		return true
+	}
+
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if _, ok := files[dir]; ok {
+			return true
+		}
+	}
+
+	for name := range files {
+		if strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateFiles removes the files changed that are not in to, and writes the
+// rest, along with their entries of the index, returning the errors of the
+// ones that could not be updated, by path.
+func (w *Worktree) updateFiles(wfs fs.WriteFS, idx *index.Index, changed map[string]bool, to map[string]TreeEntry) map[string]error {
+	paths := make([]string, 0, len(changed))
+	for p := range changed {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+	failed := map[string]error{}
+	// the files are removed first, so the directories can replace them
+	for _, p := range paths {
+		if _, ok := to[p]; ok {
+			continue
+		}
+
+		idx.Remove(p)
+		if err := w.removeFile(wfs, p); err != nil {
+			failed[p] = err
+		}
+	}
+
+	for _, p := range paths {
+		e, ok := to[p]
+		if !ok {
+			continue
+		}
+
+		if current, ok := idx.Entry(p); ok && current.Hash == e.Hash && current.Mode == e.Mode {
+			if s, err := w.entryStatus(current); err == nil && s == Unmodified {
+				continue
+			}
+		}
+
+		stat, err := w.writeFile(wfs, p, e)
+		if err != nil {
+			failed[p] = err
+		}
+
+		idx.Add(p, e.Hash, e.Mode, stat)
+	}
+
+	return failed
+}
+
+// removeFile removes the file with the given name, if it exists, and the
+// directories left empty.
+func (w *Worktree) removeFile(wfs fs.WriteFS, name string) error {
+	full := w.fullPath(name)
+	if _, err := w.lstat(full); err == nil {
+		if err := wfs.Remove(full); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// only the empty directories are removed, the first error stops it
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if wfs.Remove(w.fullPath(dir)) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the file with the given name and entry of a tree,
+// replacing the file at its path, if any, and returns its stat data. The
+// submodules are written as empty directories, as git does for the ones not
+// initialized.
+func (w *Worktree) writeFile(wfs fs.WriteFS, name string, e TreeEntry) (index.Stat, error) {
+	full := w.fullPath(name)
+	if dir := path.Dir(name); dir != "." {
+		if err := w.makeDir(wfs, dir); err != nil {
+			return index.Stat{}, err
+		}
+	}
+
+	if isSubmoduleMode(e.Mode) {
+		return index.Stat{}, wfs.MkdirAll(full, 0755)
+	}
+
+	if err := w.removeNonDir(wfs, full); err != nil {
+		return index.Stat{}, err
+	}
+
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
+		return index.Stat{}, err
+	}
+
+	if sfs, ok := w.fs.(fs.SymlinkFS); ok && isSymlinkMode(e.Mode) {
+		err = writeSymlink(sfs, full, blob)
+	} else {
+		perm := os.FileMode(0644)
+		if isExecutableMode(e.Mode) {
+			perm = 0755
+		}
+
+		err = writeBlob(wfs, full, blob, perm)
+	}
+
+	if err != nil {
+		return index.Stat{}, err
+	}
+
+	fi, err := w.lstat(full)
+	if err != nil {
+		return index.Stat{}, err
+	}
+
+	return index.NewStat(fi), nil
+}
+
+// makeDir creates the directory with the given name and its parents,
+// removing the files in their way.
+func (w *Worktree) makeDir(wfs fs.WriteFS, name string) error {
+	var dir string
+	for _, p := range strings.Split(name, "/") {
+		dir = path.Join(dir, p)
+		fi, err := w.lstat(w.fullPath(dir))
+		if err == nil && !fi.IsDir() {
+			if err := wfs.Remove(w.fullPath(dir)); err != nil {
+				return err
+			}
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return wfs.MkdirAll(w.fullPath(name), 0755)
+}
+
+// removeNonDir removes the file or symbolic link at the given path, if any,
+// so it can be written again, as the function of Tree.Checkout does.
+func (w *Worktree) removeNonDir(wfs fs.WriteFS, full string) error {
+	fi, err := w.lstat(full)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return fmt.Errorf("%s exists and is a directory", full)
+	}
+
+	return wfs.Remove(full)
+}
+
+func writeSymlink(sfs fs.SymlinkFS, full string, blob *Blob) error {
+	target, err := newFile(full, treeEntrySymlinkMode, blob).ContentsLimited(maxSymlinkTargetLength)
+	if err != nil {
+		return err
+	}
+
+	return sfs.Symlink(target, full)
+}
+
+func writeBlob(wfs fs.WriteFS, full string, blob *Blob, perm os.FileMode) (err error) {
+	r, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer checkClose(r, &err)
+
+	f, err := wfs.OpenFile(full, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer checkClose(f, &err)
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	// the permissions are not left to the umask
+	return f.Chmod(perm)
+}
+
+// moveHead points HEAD to the branch or the commit checked out, with an
+// entry in its reflog, if any of them is given in the options.
+func (w *Worktree) moveHead(opts *WorktreeCheckoutOptions, target core.Hash) error {
+	var head *core.Reference
+	switch {
+	case opts.Branch != "":
+		head = core.NewSymbolicReference(core.HEAD, opts.Branch)
+	case !opts.Hash.IsZero():
+		head = core.NewHashReference(core.HEAD, target)
+	default:
+		return nil
+	}
+
+	old, err := w.r.Reference(core.HEAD, false)
+	if err != nil && err != core.ErrReferenceNotFound {
+		return err
+	}
+
+	msg := fmt.Sprintf("checkout: moving from %s to %s", headName(old), headName(head))
+	return w.r.UpdateReference(head, old, w.r.reflogCommitter(), msg)
+}
+
+// headName returns the name of the given HEAD in the messages of the reflog:
+// the short name of its branch, or its hash if it is detached.
+func headName(head *core.Reference) string {
+	switch {
+	case head == nil:
+		return ""
+	case head.IsSymbolic():
+		return strings.TrimPrefix(head.Target.String(), branchPrefix)
+	default:
+		return head.Hash.String()
+	}
+}
+
+// reflogCommitter returns the committer of the entries of the reflog written
+// by the operations without one, the user of the config, if any, at the
+// current time.
+func (r *Repository) reflogCommitter() Signature {
+	s := Signature{When: time.Now()}
+	if cfg, err := r.Config(); err == nil {
+		s.Name = cfg.String("user", "", "name")
+		s.Email = cfg.String("user", "", "email")
+	}
+
+	return s
+}
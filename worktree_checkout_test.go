@@ -0,0 +1,215 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// branches commits foo, dir/bar, run.sh and link on master, and then foo
+// changed, dir/bar removed and new/baz added on feature, returning their
+// commits. HEAD is left on feature.
+func (s *SuiteWorktree) branches(c *C) (master, feature core.Hash) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.writeFile(c, "dir/bar", "bar\n", 0644)
+	s.writeFile(c, "run.sh", "#!/bin/sh\n", 0755)
+	c.Assert(os.Symlink("foo", filepath.Join(s.dir, "link")), IsNil)
+	s.add(c, "foo", "dir/bar", "run.sh", "link")
+	master, err := s.w.Commit("master", commitOptions(0))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/feature", Create: true}), IsNil)
+	s.writeFile(c, "foo", "qux\n", 0644)
+	c.Assert(os.Remove(filepath.Join(s.dir, "dir", "bar")), IsNil)
+	s.writeFile(c, "new/baz", "baz\n", 0755)
+	s.add(c, "foo", "dir/bar", "new/baz")
+	feature, err = s.w.Commit("feature", commitOptions(1))
+	c.Assert(err, IsNil)
+
+	return master, feature
+}
+
+func (s *SuiteWorktree) readFile(c *C, name string) string {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	c.Assert(err, IsNil)
+	return string(content)
+}
+
+func (s *SuiteWorktree) exists(c *C, name string) bool {
+	_, err := os.Lstat(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return false
+	}
+
+	c.Assert(err, IsNil)
+	return true
+}
+
+func (s *SuiteWorktree) TestCheckout(c *C) {
+	master, feature := s.branches(c)
+	head, err := s.r.Reference(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewSymbolicReference(core.HEAD, "refs/heads/feature"))
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"}), IsNil)
+	c.Assert(s.readFile(c, "foo"), Equals, "foo\n")
+	c.Assert(s.readFile(c, "dir/bar"), Equals, "bar\n")
+	c.Assert(s.exists(c, "new"), Equals, false)
+	c.Assert(s.status(c).IsClean(), Equals, true)
+
+	head, err = s.r.Reference(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewSymbolicReference(core.HEAD, "refs/heads/master"))
+
+	// detached
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Hash: feature}), IsNil)
+	c.Assert(s.readFile(c, "foo"), Equals, "qux\n")
+	c.Assert(s.exists(c, "dir"), Equals, false)
+	c.Assert(s.status(c).IsClean(), Equals, true)
+
+	fi, err := os.Lstat(filepath.Join(s.dir, "new", "baz"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0755))
+
+	head, err = s.r.Reference(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewHashReference(core.HEAD, feature))
+
+	c.Assert(s.reflog(c, core.HEAD)[1:], DeepEquals, []string{
+		"checkout: moving from master to feature",
+		"commit: feature",
+		"checkout: moving from feature to master",
+		"checkout: moving from master to " + feature.String(),
+	})
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"}), IsNil)
+	branch, err := s.r.Reference("refs/heads/master", false)
+	c.Assert(err, IsNil)
+	c.Assert(branch.Hash, Equals, master)
+}
+
+func (s *SuiteWorktree) TestCheckoutFiles(c *C) {
+	s.branches(c)
+	c.Assert(os.RemoveAll(filepath.Join(s.dir, "link")), IsNil)
+	c.Assert(os.Chmod(filepath.Join(s.dir, "run.sh"), 0644), IsNil)
+	s.add(c, "link", "run.sh")
+	_, err := s.w.Commit("modes", commitOptions(2))
+	c.Assert(err, IsNil)
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"}), IsNil)
+	target, err := os.Readlink(filepath.Join(s.dir, "link"))
+	c.Assert(err, IsNil)
+	c.Assert(target, Equals, "foo")
+
+	fi, err := os.Lstat(filepath.Join(s.dir, "run.sh"))
+	c.Assert(err, IsNil)
+	c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0755))
+	c.Assert(s.status(c).IsClean(), Equals, true)
+}
+
+func (s *SuiteWorktree) TestCheckoutLocalChanges(c *C) {
+	s.branches(c)
+
+	// the changes of the files that are the same in both are kept
+	s.writeFile(c, "run.sh", "#!/bin/bash\n", 0755)
+	s.writeFile(c, "untracked", "foo\n", 0644)
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"}), IsNil)
+	c.Assert(s.status(c).String(), Equals, " M run.sh\n?? untracked\n")
+
+	// and so are the ones of the files changed if they are the same
+	s.writeFile(c, "foo", "qux\n", 0644)
+	s.add(c, "foo")
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/feature"}), IsNil)
+	c.Assert(s.status(c).String(), Equals, " M run.sh\n?? untracked\n")
+
+	s.writeFile(c, "foo", "changed\n", 0644)
+	s.writeFile(c, "dir/bar", "untracked\n", 0644)
+	err := s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"})
+	c.Assert(err, DeepEquals, &CheckoutConflictError{Paths: []string{"dir/bar", "foo"}})
+	c.Assert(err.Error(), Equals, "checkout would overwrite the local changes of dir/bar, foo")
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name, Equals, core.ReferenceName("refs/heads/feature"))
+	c.Assert(s.readFile(c, "foo"), Equals, "changed\n")
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master", Force: true}), IsNil)
+	c.Assert(s.readFile(c, "foo"), Equals, "foo\n")
+	c.Assert(s.readFile(c, "dir/bar"), Equals, "bar\n")
+	c.Assert(s.status(c).String(), Equals, "?? untracked\n")
+}
+
+func (s *SuiteWorktree) TestCheckoutForceHead(c *C) {
+	s.branches(c)
+	s.writeFile(c, "foo", "changed\n", 0644)
+	s.writeFile(c, "staged", "staged\n", 0644)
+	s.add(c, "staged")
+	c.Assert(os.Remove(filepath.Join(s.dir, "run.sh")), IsNil)
+
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Force: true}), IsNil)
+	c.Assert(s.status(c).IsClean(), Equals, true)
+	c.Assert(s.readFile(c, "foo"), Equals, "qux\n")
+	c.Assert(s.exists(c, "staged"), Equals, false)
+
+	head, err := s.r.Reference(core.HEAD, false)
+	c.Assert(err, IsNil)
+	c.Assert(head.Target, Equals, core.ReferenceName("refs/heads/feature"))
+}
+
+func (s *SuiteWorktree) TestCheckoutCreate(c *C) {
+	master, _ := s.branches(c)
+
+	opts := &WorktreeCheckoutOptions{Branch: "refs/heads/master", Create: true}
+	c.Assert(s.w.Checkout(opts), Equals, ErrBranchExists)
+
+	opts = &WorktreeCheckoutOptions{Branch: "refs/heads/old", Hash: master, Create: true}
+	c.Assert(s.w.Checkout(opts), IsNil)
+	c.Assert(s.readFile(c, "foo"), Equals, "foo\n")
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewHashReference("refs/heads/old", master))
+
+	opts = &WorktreeCheckoutOptions{Branch: "HEAD", Create: true}
+	c.Assert(s.w.Checkout(opts), Equals, core.ErrInvalidReferenceName)
+}
+
+func (s *SuiteWorktree) TestCheckoutPartial(c *C) {
+	s.branches(c)
+	c.Assert(os.Remove(filepath.Join(s.dir, "dir")), IsNil)
+	s.writeFile(c, "dir", "file\n", 0644)
+	s.add(c, "dir")
+	_, err := s.w.Commit("dir", commitOptions(2))
+	c.Assert(err, IsNil)
+
+	// an ignored directory in the way of a file is not removed
+	c.Assert(s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/master"}), IsNil)
+	s.writeFile(c, ".gitignore", "ignored\n", 0644)
+	s.writeFile(c, "dir/ignored", "foo\n", 0644)
+
+	err = s.w.Checkout(&WorktreeCheckoutOptions{Branch: "refs/heads/feature"})
+	c.Assert(err, FitsTypeOf, &PartialCheckoutError{})
+	c.Assert(err.(*PartialCheckoutError).Errors, HasLen, 1)
+	c.Assert(err.(*PartialCheckoutError).Errors["dir"], NotNil)
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name, Equals, core.ReferenceName("refs/heads/feature"))
+	c.Assert(s.readFile(c, "foo"), Equals, "qux\n")
+	c.Assert(s.readFile(c, "new/baz"), Equals, "baz\n")
+	c.Assert(s.status(c).File("dir").Worktree, Not(Equals), Unmodified)
+}
+
+type readOnlyFS struct {
+	fs.FS
+}
+
+func (s *SuiteWorktree) TestCheckoutReadOnly(c *C) {
+	w := s.r.Worktree(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(w.Checkout(nil), Equals, ErrReadOnlyWorktree)
+}
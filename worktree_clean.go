@@ -0,0 +1,230 @@
+package git
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+)
+
+// CleanOptions are the options of Worktree.Clean.
+type CleanOptions struct {
+	// Dir removes the untracked directories too, the ones without tracked
+	// files, as git clean -d does, otherwise their files are kept.
+	Dir bool
+	// RemoveIgnored removes the ignored files too, as git clean -x does.
+	RemoveIgnored bool
+	// DryRun lists the paths that would be removed in Removed, without
+	// removing them, as git clean -n does.
+	DryRun bool
+	// Removed are the paths removed by Worktree.Clean, sorted, the ones of
+	// the directories removed as a whole with a trailing slash.
+	Removed []string
+}
+
+// Clean removes the untracked files of the worktree, as git clean does,
+// listing their paths in the Removed field of the options: the files that
+// Worktree.Status lists as untracked, and the ignored ones if the options
+// say so. The directories without tracked files are removed as a whole, if
+// the options say so too, unless some of their files are kept, and then
+// their files are removed one by one.
+//
+// The .git directory is never touched, nor are the untracked directories
+// with a .git, the repositories in the worktree, and ErrReadOnlyWorktree is
+// returned if the worktree is not in a fs.WriteFS, unless it is a dry run.
+func (w *Worktree) Clean(opts *CleanOptions) error {
+	if opts == nil {
+		opts = &CleanOptions{}
+	}
+
+	opts.Removed = nil
+	wfs, ok := w.fs.(fs.WriteFS)
+	if !ok && !opts.DryRun {
+		return ErrReadOnlyWorktree
+	}
+
+	idx, err := w.r.Index()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	c := &cleaner{
+		w:       w,
+		opts:    opts,
+		tracked: make(map[string]bool),
+		kept:    make(map[string]bool),
+		repos:   make(map[string]bool),
+	}
+
+	for _, e := range idx.Entries {
+		for dir := path.Dir(e.Name); dir != "." && !c.tracked[dir]; dir = path.Dir(dir) {
+			c.tracked[dir] = true
+		}
+	}
+
+	removed := make(map[string][]string)
+	for p, st := range status {
+		if st.Worktree != Untracked && st.Worktree != Ignored {
+			continue
+		}
+
+		dirs := c.untrackedDirs(p)
+		ok, err := c.removable(st, dirs)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			removed[p] = dirs
+			continue
+		}
+
+		for _, dir := range dirs {
+			c.kept[dir] = true
+		}
+	}
+
+	paths := make(map[string]bool, len(removed))
+	for p, dirs := range removed {
+		for _, dir := range dirs {
+			if !c.kept[dir] {
+				p = dir + "/"
+				break
+			}
+		}
+
+		paths[p] = true
+	}
+
+	for p := range paths {
+		opts.Removed = append(opts.Removed, p)
+	}
+
+	sort.Strings(opts.Removed)
+	if opts.DryRun {
+		return nil
+	}
+
+	for _, p := range opts.Removed {
+		if strings.HasSuffix(p, "/") {
+			_, err = w.removeDir(wfs, strings.TrimSuffix(p, "/"))
+		} else {
+			err = wfs.Remove(w.fullPath(p))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleaner classifies the untracked files of a Status for Worktree.Clean.
+type cleaner struct {
+	w    *Worktree
+	opts *CleanOptions
+	// tracked are the directories with tracked files.
+	tracked map[string]bool
+	// kept are the untracked directories with files that are not removed.
+	kept map[string]bool
+	// repos tells if the untracked directories checked are repositories.
+	repos map[string]bool
+}
+
+// untrackedDirs returns the untracked directories with the file of a Status
+// with the given path, from the outermost one, along with the file itself
+// if it is a directory, when the path has a trailing slash.
+func (c *cleaner) untrackedDirs(p string) []string {
+	dir := strings.TrimSuffix(p, "/")
+	if dir == p {
+		dir = path.Dir(p)
+	}
+
+	var dirs []string
+	for ; dir != "." && !c.tracked[dir]; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	return dirs
+}
+
+// removable returns true if the file with the given status, in the given
+// untracked directories, is removed with the options of the cleaner.
+func (c *cleaner) removable(st *FileStatus, dirs []string) (bool, error) {
+	if st.Worktree == Ignored && !c.opts.RemoveIgnored {
+		return false, nil
+	}
+
+	if len(dirs) != 0 && !c.opts.Dir {
+		return false, nil
+	}
+
+	for _, dir := range dirs {
+		if ok, err := c.isRepository(dir); ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// isRepository returns true if the directory with the given name has a .git
+// in it.
+func (c *cleaner) isRepository(dir string) (bool, error) {
+	if ok, checked := c.repos[dir]; checked {
+		return ok, nil
+	}
+
+	_, err := c.w.lstat(c.w.fullPath(path.Join(dir, gitDirName)))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	c.repos[dir] = err == nil
+	return err == nil, nil
+}
+
+// removeDir removes the directory with the given name, along with its files
+// and subdirectories, but the ones named .git and their parents, returning
+// false if it is kept because of them.
+func (w *Worktree) removeDir(wfs fs.WriteFS, name string) (bool, error) {
+	full := w.fullPath(name)
+	infos, err := w.fs.ReadDir(full)
+	if err != nil {
+		return false, err
+	}
+
+	removed := true
+	for _, fi := range infos {
+		child := path.Join(name, fi.Name())
+		switch {
+		case fi.Name() == gitDirName:
+			removed = false
+		case fi.IsDir():
+			ok, err := w.removeDir(wfs, child)
+			if err != nil {
+				return false, err
+			}
+
+			removed = removed && ok
+		default:
+			if err := wfs.Remove(w.fullPath(child)); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if !removed {
+		return false, nil
+	}
+
+	return true, wfs.Remove(full)
+}
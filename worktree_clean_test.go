@@ -0,0 +1,113 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+// untracked commits foo and dir/bar, and writes untracked and ignored files
+// around them.
+func (s *SuiteWorktree) untracked(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.writeFile(c, "dir/bar", "bar\n", 0644)
+	s.writeFile(c, ".gitignore", "*.log\nbuild/\n", 0644)
+	s.add(c, "foo", "dir/bar", ".gitignore")
+	_, err := s.w.Commit("foo", commitOptions(0))
+	c.Assert(err, IsNil)
+
+	s.writeFile(c, "qux", "qux\n", 0644)
+	s.writeFile(c, "foo.log", "foo\n", 0644)
+	s.writeFile(c, "dir/qux", "qux\n", 0644)
+	s.writeFile(c, "dir/bar.log", "bar\n", 0644)
+	s.writeFile(c, "new/a/b", "b\n", 0644)
+	s.writeFile(c, "new/c", "c\n", 0644)
+	s.writeFile(c, "logs/a/foo.log", "foo\n", 0644)
+	s.writeFile(c, "logs/b", "b\n", 0644)
+	s.writeFile(c, "build/foo", "foo\n", 0644)
+}
+
+func (s *SuiteWorktree) TestClean(c *C) {
+	s.untracked(c)
+
+	opts := &CleanOptions{DryRun: true}
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"dir/qux", "qux"})
+	c.Assert(s.exists(c, "qux"), Equals, true)
+
+	opts.DryRun = false
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"dir/qux", "qux"})
+	c.Assert(s.status(c).Porcelain(true), Equals, ""+
+		"?? logs/b\n"+
+		"?? new/a/b\n"+
+		"?? new/c\n"+
+		"!! build/\n"+
+		"!! dir/bar.log\n"+
+		"!! foo.log\n"+
+		"!! logs/a/foo.log\n")
+
+	// the directories with ignored files are kept
+	opts = &CleanOptions{Dir: true}
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"logs/b", "new/"})
+	c.Assert(s.status(c).Porcelain(true), Equals, ""+
+		"!! build/\n"+
+		"!! dir/bar.log\n"+
+		"!! foo.log\n"+
+		"!! logs/a/foo.log\n")
+
+	c.Assert(s.readFile(c, "foo"), Equals, "foo\n")
+	c.Assert(s.readFile(c, "dir/bar"), Equals, "bar\n")
+}
+
+func (s *SuiteWorktree) TestCleanIgnored(c *C) {
+	s.untracked(c)
+
+	opts := &CleanOptions{RemoveIgnored: true}
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"dir/bar.log", "dir/qux", "foo.log", "qux"})
+
+	opts = &CleanOptions{Dir: true, RemoveIgnored: true}
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"build/", "logs/", "new/"})
+	c.Assert(s.status(c).IsClean(), Equals, true)
+	c.Assert(s.status(c), HasLen, 0)
+	c.Assert(s.readFile(c, "dir/bar"), Equals, "bar\n")
+}
+
+func (s *SuiteWorktree) TestCleanGitDir(c *C) {
+	s.untracked(c)
+	s.writeFile(c, ".git/config", "", 0644)
+	s.writeFile(c, "repo/.git/config", "", 0644)
+	s.writeFile(c, "repo/foo", "foo\n", 0644)
+	s.writeFile(c, "new/a/.git/config", "", 0644)
+
+	opts := &CleanOptions{Dir: true, RemoveIgnored: true}
+	c.Assert(s.w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{
+		"build/", "dir/bar.log", "dir/qux", "foo.log", "logs/", "new/c", "qux",
+	})
+
+	c.Assert(s.exists(c, ".git/config"), Equals, true)
+	c.Assert(s.exists(c, "repo/foo"), Equals, true)
+	c.Assert(s.exists(c, "new/a/.git/config"), Equals, true)
+	c.Assert(s.exists(c, "new/a/b"), Equals, true)
+	c.Assert(s.exists(c, "new/c"), Equals, false)
+}
+
+func (s *SuiteWorktree) TestCleanReadOnly(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	w := s.r.Worktree(readOnlyFS{fs.NewOS()}, s.dir)
+	c.Assert(w.Clean(nil), Equals, ErrReadOnlyWorktree)
+
+	opts := &CleanOptions{DryRun: true}
+	c.Assert(w.Clean(opts), IsNil)
+	c.Assert(opts.Removed, DeepEquals, []string{"foo"})
+
+	_, err := os.Stat(filepath.Join(s.dir, "foo"))
+	c.Assert(err, IsNil)
+}
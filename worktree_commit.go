@@ -0,0 +1,392 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+)
+
+var (
+	// ErrEmptyCommit is returned by Worktree.Commit when the tree of the
+	// commit is the one of its parent, or empty if it has none, unless the
+	// empty commits are allowed, and by Repository.CherryPick and
+	// Repository.Revert when the changes are already in the commit they
+	// are applied onto.
+	ErrEmptyCommit = errors.New("nothing to commit")
+	// ErrUnmergedEntries is returned by Worktree.Commit when the index has
+	// conflicts.
+	ErrUnmergedEntries = errors.New("index has unmerged entries")
+	// ErrNothingToAmend is returned by Worktree.Commit when amending on an
+	// unborn branch.
+	ErrNothingToAmend = errors.New("nothing to amend")
+	// ErrMissingIdentity is returned by Worktree.Commit when the committer
+	// has no name or email, and the config has no user.name or user.email.
+	ErrMissingIdentity = errors.New("committer identity unknown")
+)
+
+// IndexObjectNotFoundError is returned by Worktree.Commit when the object of
+// an entry of the index, or of a tree of its cache tree, is not in the
+// storage, as git write-tree fails then. Path is the name of the entry, or
+// the path of the directory of the tree. It is core.ErrObjectNotFound for
+// errors.Is.
+type IndexObjectNotFoundError struct {
+	Path string
+	Hash core.Hash
+}
+
+func (e *IndexObjectNotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", core.ErrObjectNotFound, e.Hash, e.Path)
+}
+
+// Is returns true if target is core.ErrObjectNotFound.
+func (e *IndexObjectNotFoundError) Is(target error) bool {
+	return target == core.ErrObjectNotFound
+}
+
+// CommitOptions are the options of Worktree.Commit.
+type CommitOptions struct {
+	// Author is the author of the commit, the committer if its Name is
+	// empty, or the author of the commit amended, at the time of the
+	// committer if its When is zero.
+	Author Signature
+	// Committer is the committer of the commit, its Name and Email are the
+	// user.name and user.email of the config if they are empty, and its
+	// When is the current time if it is zero.
+	Committer Signature
+	// AllowEmptyCommit allows the commits with the tree of their parent.
+	AllowEmptyCommit bool
+	// Amend replaces the commit of HEAD, the new commit has its parents
+	// and, unless the Author is given, its author.
+	Amend bool
+}
+
+// signatures returns the author and the committer of a commit replacing the
+// given one, if amend is not nil, with the given config.
+func (o *CommitOptions) signatures(r *Repository, amend *Commit) (author, committer Signature, err error) {
+	if o != nil {
+		author, committer = o.Author, o.Committer
+	}
+
+	if committer.Name == "" || committer.Email == "" {
+		cfg, err := r.Config()
+		if err != nil {
+			return author, committer, err
+		}
+
+		if committer.Name == "" {
+			committer.Name = cfg.String("user", "", "name")
+		}
+
+		if committer.Email == "" {
+			committer.Email = cfg.String("user", "", "email")
+		}
+
+		if committer.Name == "" || committer.Email == "" {
+			return author, committer, ErrMissingIdentity
+		}
+	}
+
+	if committer.When.IsZero() {
+		committer.When = time.Now()
+	}
+
+	if author.Name == "" {
+		author = committer
+		if amend != nil {
+			author = amend.Author
+		}
+	}
+
+	if author.When.IsZero() {
+		author.When = committer.When
+	}
+
+	return author, committer, nil
+}
+
+// Commit records the index in a new commit with the given message, as git
+// commit does, returning its hash: the trees of the index are written,
+// reusing the valid ones of its cache tree, which is updated, and so is the
+// branch of HEAD, or HEAD itself if it is detached, see
+// Repository.UpdateReference, with an entry in its reflog.
+//
+// The parent of the commit is HEAD, along with core.MergeHead, which is
+// removed, while a merge is stopped, or none on an unborn branch. When
+// amending, the commit has the parents of HEAD instead, and the message of
+// HEAD if the given one is empty.
+//
+// ErrUnmergedEntries is returned if the index has conflicts, an
+// *IndexObjectNotFoundError if any of its objects is missing, and
+// ErrEmptyCommit if the tree is the one of the first parent, unless it is a
+// merge or the options allow it.
+func (w *Worktree) Commit(msg string, opts *CommitOptions) (core.Hash, error) {
+	idx, err := w.r.Index()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return core.ZeroHash, ErrUnmergedEntries
+		}
+	}
+
+	branch, old, err := w.headBranch()
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	var amend *Commit
+	var parents []core.Hash
+	kind := "commit"
+	switch {
+	case opts != nil && opts.Amend:
+		if old == nil {
+			return core.ZeroHash, ErrNothingToAmend
+		}
+
+		if amend, err = w.r.Commit(old.Hash); err != nil {
+			return core.ZeroHash, err
+		}
+
+		parents = amend.ParentHashes
+		if msg == "" {
+			msg = amend.Message
+		}
+
+		kind = "commit (amend)"
+	case old == nil:
+		kind = "commit (initial)"
+	default:
+		parents = []core.Hash{old.Hash}
+		merge, err := w.r.References.Get(core.MergeHead)
+		if err == nil {
+			parents = append(parents, merge.Hash)
+			kind = "commit (merge)"
+		} else if err != core.ErrReferenceNotFound {
+			return core.ZeroHash, err
+		}
+	}
+
+	tw := &indexTreeWriter{r: w.r, cache: idx.Cache, tree: &index.Tree{}}
+	tree, _, err := tw.write(idx.Entries, "")
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	if opts == nil || !opts.AllowEmptyCommit {
+		if err := w.checkEmpty(tree, parents); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	author, committer, err := opts.signatures(w.r, amend)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	if msg != "" && !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	commit := &Commit{
+		Author:       author,
+		Committer:    committer,
+		Message:      msg,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+
+	o := w.r.newObject()
+	if err := commit.Encode(o); err != nil {
+		return core.ZeroHash, err
+	}
+
+	h, err := w.r.Storage.Set(o)
+	if err != nil {
+		return core.ZeroHash, err
+	}
+
+	subject := strings.SplitN(msg, "\n", 2)[0]
+	new := core.NewHashReference(branch, h)
+	if err := w.r.UpdateReference(new, old, committer, kind+": "+subject); err != nil {
+		return core.ZeroHash, err
+	}
+
+	if len(parents) > 1 && amend == nil {
+		if err := w.r.References.Remove(core.MergeHead); err != nil {
+			return core.ZeroHash, err
+		}
+	}
+
+	idx.Cache = tw.tree
+	return h, w.r.SetIndex(idx)
+}
+
+// headBranch returns the name of the reference updated by the commits, the
+// branch HEAD points to or HEAD itself if it is detached, and the reference
+// stored with that name, nil on an unborn branch. HEAD is pointed to the
+// master branch if the repository has none, as a new plain one.
+func (w *Worktree) headBranch() (core.ReferenceName, *core.Reference, error) {
+	head, err := w.r.Reference(core.HEAD, false)
+	if err == core.ErrReferenceNotFound {
+		head = core.NewSymbolicReference(core.HEAD, branchName("master"))
+		err = w.r.References.Set(head)
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !head.IsSymbolic() {
+		return core.HEAD, head, nil
+	}
+
+	old, err := w.r.References.Get(head.Target)
+	if err == core.ErrReferenceNotFound {
+		return head.Target, nil, nil
+	}
+
+	return head.Target, old, err
+}
+
+// checkEmpty returns ErrEmptyCommit if the given tree is the one of the
+// first of the given parents, or empty without parents. The merges are
+// never empty.
+func (w *Worktree) checkEmpty(tree core.Hash, parents []core.Hash) error {
+	if len(parents) > 1 {
+		return nil
+	}
+
+	if len(parents) == 0 {
+		if isEmptyTree(tree) {
+			return ErrEmptyCommit
+		}
+
+		return nil
+	}
+
+	parent, err := w.r.Commit(parents[0])
+	if err != nil {
+		return err
+	}
+
+	if parent.TreeHash == tree {
+		return ErrEmptyCommit
+	}
+
+	return nil
+}
+
+// indexTreeWriter writes the trees of the entries of an index, reusing the
+// valid trees of its cache tree, and builds the cache tree of the trees
+// written.
+type indexTreeWriter struct {
+	r     *Repository
+	cache *index.Tree
+	tree  *index.Tree
+}
+
+// write writes the tree of the directory with the given path, "" for the
+// root, with the given entries, the ones of the index in the directory,
+// returning its hash, or false if its tree is empty, and then it is not
+// written but for the root. The entries added with git add -N are left out,
+// as git does. An *IndexObjectNotFoundError is returned if the object of an
+// entry, or a tree reused, is not in the storage.
+func (w *indexTreeWriter) write(entries []*index.Entry, dir string) (core.Hash, bool, error) {
+	if sub := w.cache.Subtree(dir); sub != nil && sub.Entries[0].Entries == len(entries) {
+		if err := w.check(dir, sub.Entries[0].Hash); err != nil {
+			return core.ZeroHash, false, err
+		}
+
+		sub.Entries[0].Path = pathBase(dir)
+		w.tree.Entries = append(w.tree.Entries, sub.Entries...)
+		return sub.Entries[0].Hash, true, nil
+	}
+
+	pos := len(w.tree.Entries)
+	w.tree.Entries = append(w.tree.Entries, index.TreeEntry{Path: pathBase(dir), Entries: len(entries)})
+
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	tree := &Tree{}
+	for i := 0; i < len(entries); {
+		e := entries[i]
+		name := e.Name[len(prefix):]
+		slash := strings.IndexByte(name, '/')
+		if slash == -1 {
+			if !e.IntentToAdd {
+				// the commits of the submodules are in their repositories
+				if !isSubmoduleMode(e.Mode) {
+					if err := w.check(e.Name, e.Hash); err != nil {
+						return core.ZeroHash, false, err
+					}
+				}
+
+				tree.Entries = append(tree.Entries, TreeEntry{Name: name, Mode: e.Mode, Hash: e.Hash})
+			}
+
+			i++
+			continue
+		}
+
+		sub := prefix + name[:slash]
+		end := i + 1
+		for end < len(entries) && strings.HasPrefix(entries[end].Name, sub+"/") {
+			end++
+		}
+
+		h, ok, err := w.write(entries[i:end], sub)
+		if err != nil {
+			return core.ZeroHash, false, err
+		}
+
+		if ok {
+			tree.Entries = append(tree.Entries, TreeEntry{Name: name[:slash], Mode: treeEntryDirMode, Hash: h})
+			w.tree.Entries[pos].Trees++
+		}
+
+		i = end
+	}
+
+	if len(tree.Entries) == 0 && dir != "" {
+		w.tree.Entries = w.tree.Entries[:pos]
+		return core.ZeroHash, false, nil
+	}
+
+	o := w.r.newObject()
+	if err := tree.Encode(o); err != nil {
+		return core.ZeroHash, false, err
+	}
+
+	h, err := w.r.Storage.Set(o)
+	if err != nil {
+		return core.ZeroHash, false, err
+	}
+
+	w.tree.Entries[pos].Hash = h
+	return h, len(tree.Entries) != 0, nil
+}
+
+// check returns an *IndexObjectNotFoundError if the object with the given
+// hash, of the entry or tree with the given path, is not in the storage.
+func (w *indexTreeWriter) check(p string, h core.Hash) error {
+	ok, err := w.r.hasObject(h)
+	if err != nil || ok {
+		return err
+	}
+
+	return &IndexObjectNotFoundError{Path: p, Hash: h}
+}
+
+// pathBase returns the last component of the given slash separated path.
+func pathBase(p string) string {
+	return p[strings.LastIndexByte(p, '/')+1:]
+}
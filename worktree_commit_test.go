@@ -0,0 +1,310 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/formats/index"
+
+	. "gopkg.in/check.v1"
+)
+
+func commitOptions(sec int64) *CommitOptions {
+	sig := Signature{Name: "foo", Email: "foo@bar.com", When: time.Unix(sec, 0).UTC()}
+	return &CommitOptions{Author: sig, Committer: sig}
+}
+
+func (s *SuiteWorktree) add(c *C, names ...string) {
+	for _, name := range names {
+		_, err := s.w.Add(name)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *SuiteWorktree) TestCommit(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.writeFile(c, "bin/run.sh", "#!/bin/sh\n", 0755)
+	s.writeFile(c, "a/b/c", "c\n", 0644)
+	c.Assert(os.Symlink("foo", filepath.Join(s.dir, "link")), IsNil)
+	s.add(c, "foo", "bin/run.sh", "a/b/c", "link")
+
+	// the hashes of the commits of git with the same files and signatures
+	first, err := s.w.Commit("first", commitOptions(1500000000))
+	c.Assert(err, IsNil)
+	c.Assert(first, Equals, core.NewHash("6b8f53ccaad97a793764db7762bc02e04edf2a37"))
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewHashReference("refs/heads/master", first))
+
+	commit, err := s.r.Commit(first)
+	c.Assert(err, IsNil)
+	c.Assert(commit.TreeHash, Equals, core.NewHash("58821021ec10b14d0a768ae894e2980413b7ab91"))
+	c.Assert(commit.Message, Equals, "first\n")
+	c.Assert(commit.NumParents(), Equals, 0)
+
+	s.writeFile(c, "foo", "bar\n", 0644)
+	s.add(c, "foo")
+	second, err := s.w.Commit("second\n", commitOptions(1500000100))
+	c.Assert(err, IsNil)
+	c.Assert(second, Equals, core.NewHash("5fd1ac51549e57e1af38f689b4a6b5eb5312cfe4"))
+
+	c.Assert(s.reflog(c, "refs/heads/master"), DeepEquals, []string{
+		"commit (initial): first", "commit: second",
+	})
+	c.Assert(s.reflog(c, core.HEAD), DeepEquals, []string{
+		"commit (initial): first", "commit: second",
+	})
+
+	// the cache tree of the index is the one of the commit
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Cache.Entries[0], DeepEquals, index.TreeEntry{
+		Entries: 4, Trees: 2,
+		Hash: core.NewHash("ddb548640527963e5b26da6206ab66073f4ada9d"),
+	})
+	c.Assert(idx.Cache.Entries[1:], HasLen, 3)
+}
+
+func (s *SuiteWorktree) reflog(c *C, n core.ReferenceName) []string {
+	iter, err := s.r.Reflog(n)
+	c.Assert(err, IsNil)
+	defer iter.Close()
+
+	var msgs []string
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return msgs
+		}
+
+		c.Assert(err, IsNil)
+		msgs = append(msgs, e.Message)
+	}
+}
+
+// indexedObjectStorage has the objects of the entries and the cache tree of
+// an index, which are not in the fixtures, as well as the ones of its
+// storage.
+type indexedObjectStorage struct {
+	core.ObjectStorage
+	indexed map[core.Hash]bool
+}
+
+func newIndexedObjectStorage(s core.ObjectStorage, idx *index.Index) *indexedObjectStorage {
+	indexed := make(map[core.Hash]bool, 0)
+	for _, e := range idx.Entries {
+		indexed[e.Hash] = true
+	}
+
+	for _, e := range idx.Cache.Entries {
+		indexed[e.Hash] = true
+	}
+
+	return &indexedObjectStorage{s, indexed}
+}
+
+func (s *indexedObjectStorage) Has(h core.Hash) (bool, error) {
+	if s.indexed[h] {
+		return true, nil
+	}
+
+	return core.HasObject(s.ObjectStorage, h)
+}
+
+func (s *SuiteWorktree) TestCommitCacheTree(c *C) {
+	for _, version := range []string{"v2", "v3"} {
+		s.SetUpTest(c)
+		data, err := ioutil.ReadFile("formats/index/fixtures/index-" + version)
+		c.Assert(err, IsNil)
+		idx := index.New(core.SHA1)
+		c.Assert(index.NewDecoder(bytes.NewReader(data)).Decode(idx), IsNil)
+		c.Assert(s.r.SetIndex(idx), IsNil)
+		s.r.Storage = newIndexedObjectStorage(s.r.Storage, idx)
+
+		// the intent-to-add entry of the v3 one is not committed
+		h, err := s.w.Commit("foo", commitOptions(0))
+		c.Assert(err, IsNil)
+
+		commit, err := s.r.Commit(h)
+		c.Assert(err, IsNil)
+		c.Assert(commit.TreeHash, Equals, core.NewHash("bc6aff6663aeb1876838b8c10383dfc3bf0e8beb"))
+	}
+
+	// a valid tree is reused as it is, if it is in the storage
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+	bogus := core.NewHash("0000000000000000000000000000000000000001")
+	for i, e := range idx.Cache.Entries {
+		if e.Path == "c" {
+			idx.Cache.Entries[i].Hash = bogus
+		} else {
+			idx.Cache.Entries[i].Entries = -1
+		}
+	}
+
+	c.Assert(s.r.SetIndex(idx), IsNil)
+
+	_, err = s.w.Commit("bar", commitOptions(0))
+	c.Assert(err, DeepEquals, &IndexObjectNotFoundError{Path: "a/b/c", Hash: bogus})
+}
+
+func (s *SuiteWorktree) TestCommitIdentity(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.add(c, "foo")
+
+	_, err := s.w.Commit("foo", nil)
+	c.Assert(err, Equals, ErrMissingIdentity)
+
+	cfg, err := s.r.Config()
+	c.Assert(err, IsNil)
+	cfg.Set("user", "", "name", "bar")
+	cfg.Set("user", "", "email", "bar@foo.com")
+	c.Assert(s.r.SetConfig(cfg), IsNil)
+
+	author := Signature{Name: "qux", Email: "qux@foo.com", When: time.Unix(0, 0).UTC()}
+	h, err := s.w.Commit("foo", &CommitOptions{Author: author})
+	c.Assert(err, IsNil)
+
+	commit, err := s.r.Commit(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Author.Name, Equals, "qux")
+	c.Assert(commit.Author.When.Equal(author.When), Equals, true)
+	c.Assert(commit.Committer.Name, Equals, "bar")
+	c.Assert(commit.Committer.Email, Equals, "bar@foo.com")
+	c.Assert(time.Since(commit.Committer.When) < time.Minute, Equals, true)
+}
+
+func (s *SuiteWorktree) TestCommitAmend(c *C) {
+	_, err := s.w.Commit("foo", &CommitOptions{Committer: commitOptions(0).Committer, Amend: true})
+	c.Assert(err, Equals, ErrNothingToAmend)
+
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.add(c, "foo")
+	first, err := s.w.Commit("first", commitOptions(0))
+	c.Assert(err, IsNil)
+
+	s.writeFile(c, "bar", "bar\n", 0644)
+	s.add(c, "bar")
+	second, err := s.w.Commit("second", commitOptions(1))
+	c.Assert(err, IsNil)
+
+	// no changes, the message is replaced and the author kept
+	opts := commitOptions(2)
+	opts.Author = Signature{}
+	opts.Amend = true
+	amended, err := s.w.Commit("amended", opts)
+	c.Assert(err, IsNil)
+
+	commit, err := s.r.Commit(amended)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{first})
+	c.Assert(commit.Message, Equals, "amended\n")
+	c.Assert(commit.Author.When.Unix(), Equals, int64(1))
+	c.Assert(commit.Committer.When.Unix(), Equals, int64(2))
+
+	old, err := s.r.Commit(second)
+	c.Assert(err, IsNil)
+	c.Assert(commit.TreeHash, Equals, old.TreeHash)
+
+	amended, err = s.w.Commit("", opts)
+	c.Assert(err, IsNil)
+	commit, err = s.r.Commit(amended)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "amended\n")
+
+	c.Assert(s.reflog(c, "refs/heads/master"), DeepEquals, []string{
+		"commit (initial): first", "commit: second",
+		"commit (amend): amended", "commit (amend): amended",
+	})
+}
+
+func (s *SuiteWorktree) TestCommitMerge(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.add(c, "foo")
+	first, err := s.w.Commit("first", commitOptions(0))
+	c.Assert(err, IsNil)
+
+	s.writeFile(c, "foo", "bar\n", 0644)
+	s.add(c, "foo")
+	second, err := s.w.Commit("second", commitOptions(1))
+	c.Assert(err, IsNil)
+
+	// a merge without changes is not empty
+	c.Assert(s.r.References.Set(core.NewHashReference(core.MergeHead, first)), IsNil)
+	merge, err := s.w.Commit("merge", commitOptions(2))
+	c.Assert(err, IsNil)
+
+	commit, err := s.r.Commit(merge)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []core.Hash{second, first})
+
+	_, err = s.r.References.Get(core.MergeHead)
+	c.Assert(err, Equals, core.ErrReferenceNotFound)
+	c.Assert(s.reflog(c, core.HEAD)[2], Equals, "commit (merge): merge")
+}
+
+func (s *SuiteWorktree) TestCommitDetached(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.add(c, "foo")
+	first, err := s.w.Commit("first", commitOptions(0))
+	c.Assert(err, IsNil)
+	c.Assert(s.r.References.Set(core.NewHashReference(core.HEAD, first)), IsNil)
+
+	s.writeFile(c, "foo", "bar\n", 0644)
+	s.add(c, "foo")
+	second, err := s.w.Commit("second", commitOptions(1))
+	c.Assert(err, IsNil)
+
+	head, err := s.r.References.Get(core.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head, DeepEquals, core.NewHashReference(core.HEAD, second))
+
+	master, err := s.r.References.Get("refs/heads/master")
+	c.Assert(err, IsNil)
+	c.Assert(master.Hash, Equals, first)
+}
+
+func (s *SuiteWorktree) TestCommitErrors(c *C) {
+	_, err := s.w.Commit("foo", commitOptions(0))
+	c.Assert(err, Equals, ErrEmptyCommit)
+
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.add(c, "foo")
+	_, err = s.w.Commit("foo", commitOptions(0))
+	c.Assert(err, IsNil)
+
+	_, err = s.w.Commit("foo", commitOptions(1))
+	c.Assert(err, Equals, ErrEmptyCommit)
+
+	opts := commitOptions(1)
+	opts.AllowEmptyCommit = true
+	_, err = s.w.Commit("foo", opts)
+	c.Assert(err, IsNil)
+
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+	idx.Entries = append(idx.Entries, &index.Entry{
+		Name: "foo", Hash: idx.Entries[0].Hash, Mode: treeEntryRegularMode, Stage: index.OurStage,
+	})
+	idx.Entries[0].Name = "bar"
+	c.Assert(s.r.SetIndex(idx), IsNil)
+	_, err = s.w.Commit("foo", commitOptions(2))
+	c.Assert(err, Equals, ErrUnmergedEntries)
+
+	// the blob of the entry is missing, as git write-tree fails
+	missing := core.NewHash("0000000000000000000000000000000000000001")
+	idx.Entries = idx.Entries[:1]
+	idx.Entries[0].Hash = missing
+	idx.Cache = nil
+	c.Assert(s.r.SetIndex(idx), IsNil)
+	_, err = s.w.Commit("foo", commitOptions(3))
+	c.Assert(err, DeepEquals, &IndexObjectNotFoundError{Path: "bar", Hash: missing})
+	c.Assert(errors.Is(err, core.ErrObjectNotFound), Equals, true)
+}
@@ -0,0 +1,123 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v3/core"
+	"gopkg.in/src-d/go-git.v3/storage/filesystem"
+	"gopkg.in/src-d/go-git.v3/utils/fs"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteWorktree struct {
+	dir string
+	r   *Repository
+	w   *Worktree
+}
+
+var _ = Suite(&SuiteWorktree{})
+
+func (s *SuiteWorktree) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	s.r = NewPlainRepository()
+	s.w = s.r.Worktree(fs.NewOS(), s.dir)
+}
+
+func (s *SuiteWorktree) writeFile(c *C, name, content string, perm os.FileMode) {
+	path := filepath.Join(s.dir, name)
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte(content), perm), IsNil)
+}
+
+func (s *SuiteWorktree) TestAdd(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	s.writeFile(c, "bin/run.sh", "#!/bin/sh\n", 0755)
+	c.Assert(os.Symlink("foo", filepath.Join(s.dir, "link")), IsNil)
+
+	for name, mode := range map[string]os.FileMode{
+		"foo":        treeEntryRegularMode,
+		"bin/run.sh": treeEntryExecutableMode,
+		"link":       treeEntrySymlinkMode,
+	} {
+		h, err := s.w.Add(name)
+		c.Assert(err, IsNil)
+
+		idx, err := s.r.Index()
+		c.Assert(err, IsNil)
+		e, ok := idx.Entry(name)
+		c.Assert(ok, Equals, true, Commentf("name=%s", name))
+		c.Assert(e.Hash, Equals, h)
+		c.Assert(e.Mode, Equals, mode, Commentf("name=%s", name))
+
+		blob, err := s.r.Blob(h)
+		c.Assert(err, IsNil)
+		c.Assert(blob.Size, Equals, int64(e.Size))
+	}
+
+	foo, err := s.r.Blob(core.NewHash("257cc5642cb1a054f08cc83f2d943e56fd3ebe99"))
+	c.Assert(err, IsNil)
+	c.Assert(foo.Size, Equals, int64(4))
+
+	// the symlink is stored, not its destination
+	link, err := s.r.Blob(core.NewHash("19102815663d23f8b75a47e7a01965dcdc96468c"))
+	c.Assert(err, IsNil)
+	c.Assert(link.Size, Equals, int64(3))
+
+	fi, err := os.Stat(filepath.Join(s.dir, "foo"))
+	c.Assert(err, IsNil)
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+	e, _ := idx.Entry("foo")
+	c.Assert(e.ModifiedAt.Equal(fi.ModTime()), Equals, true)
+}
+
+func (s *SuiteWorktree) TestAddRemoved(c *C) {
+	s.writeFile(c, "foo", "foo\n", 0644)
+	_, err := s.w.Add("foo")
+	c.Assert(err, IsNil)
+
+	c.Assert(os.Remove(filepath.Join(s.dir, "foo")), IsNil)
+	h, err := s.w.Add("foo")
+	c.Assert(err, IsNil)
+	c.Assert(h.IsZero(), Equals, true)
+
+	idx, err := s.r.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 0)
+
+	_, err = s.w.Add("foo")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteWorktree) TestAddErrors(c *C) {
+	s.writeFile(c, "dir/foo", "foo\n", 0644)
+	_, err := s.w.Add("dir")
+	c.Assert(err, Equals, ErrUnsupportedFile)
+
+	for _, path := range []string{"", ".", "..", "../foo", "dir/../../foo", "/foo", ".git/config", "dir/.git"} {
+		_, err := s.w.Add(path)
+		c.Assert(err, Equals, ErrPathOutsideWorktree, Commentf("path=%s", path))
+	}
+}
+
+func (s *SuiteWorktree) TestAddToFS(c *C) {
+	gitDir := filepath.Join(s.dir, ".git")
+	c.Assert(os.Mkdir(gitDir, 0755), IsNil)
+	s.r.Indexes = filesystem.NewIndexStorage(fs.NewOS(), gitDir)
+
+	s.writeFile(c, "a/foo", "foo\n", 0644)
+	s.writeFile(c, "bar", "bar\n", 0644)
+	for _, name := range []string{"bar", "a/foo"} {
+		_, err := s.w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	idx, err := filesystem.NewIndexStorage(fs.NewOS(), gitDir).Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 2)
+	c.Assert(idx.Entries[0].Name, Equals, "a/foo")
+	c.Assert(idx.Entries[1].Name, Equals, "bar")
+}